@@ -0,0 +1,93 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrMaxStepsExceeded is returned by RunAgentLoop if the model still calls tools after MaxSteps steps.
+var ErrMaxStepsExceeded = errors.New("openai: agent loop exceeded max steps")
+
+// defaultAgentMaxSteps is the number of steps of the agent loop if it isn't set.
+const defaultAgentMaxSteps = 10
+
+type AgentLoopOptions struct {
+	// MaxSteps is the maximum number of chat completions requested by the loop, 10 if it's zero.
+	MaxSteps int
+	// StepCallback is called with every message of the loop in order: the messages of
+	// ChatCompletionOptions with step 0, then the assistant message of each step and
+	// the tool messages answering its calls, with the step number starting from 1.
+	StepCallback func(step int, msg ChatMessage)
+	// Scratchpad receives the same messages as StepCallback, it's appended to.
+	// It's the whole conversation of the loop, e.g. for debugging.
+	Scratchpad *[]ChatMessage
+}
+
+// RunAgentLoop is used to run the chat completion until the model stops calling tools.
+// The tools of functions are sent unless opts.Tools is set, calls of the model are validated
+// by functions.ValidateCall and answered with the results of functions.Call. Rejected calls
+// aren't executed, their *ToolCallRejectedError is sent back to the model as the result, as well
+// as the errors of the functions, so it can correct the call. It returns the response of the last step, along with
+// ErrMaxStepsExceeded if the model still calls tools after loop.MaxSteps steps.
+//
+// opts isn't modified, the messages of the loop are passed to loop.StepCallback and loop.Scratchpad.
+func (e *Engine) RunAgentLoop(ctx context.Context, opts *ChatCompletionOptions, functions *FunctionRegistry, loop AgentLoopOptions) (*ChatCompletionResponse, error) {
+	if loop.MaxSteps <= 0 {
+		loop.MaxSteps = defaultAgentMaxSteps
+	}
+	record := func(step int, msg ChatMessage) {
+		if loop.Scratchpad != nil {
+			*loop.Scratchpad = append(*loop.Scratchpad, msg)
+		}
+		if loop.StepCallback != nil {
+			loop.StepCallback(step, msg)
+		}
+	}
+	for _, msg := range opts.Messages {
+		record(0, msg)
+	}
+
+	req := *opts
+	req.Messages = append([]ChatMessage(nil), opts.Messages...)
+	if req.Tools == nil {
+		req.Tools = functions.ChatTools()
+	}
+	for step := 1; ; step++ {
+		resp, err := e.ChatCompletion(ctx, &req)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Choices) == 0 {
+			return resp, errors.New("agent loop: no choices")
+		}
+		msg := resp.Choices[0].Message
+		record(step, msg)
+		if len(msg.ToolCalls) == 0 {
+			return resp, nil
+		}
+		if step == loop.MaxSteps {
+			return resp, fmt.Errorf("%w: %d", ErrMaxStepsExceeded, loop.MaxSteps)
+		}
+		req.Messages = append(req.Messages, msg)
+		for _, call := range msg.ToolCalls {
+			var result string
+			err := functions.ValidateCall(call, req.Tools)
+			if err == nil {
+				result, err = functions.Call(ctx, call.Function.Name, call.Function.Arguments)
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			if err != nil {
+				result = "error: " + err.Error()
+			}
+			toolMsg := ChatMessage{Role: "tool", Content: result, ToolCallId: call.Id}
+			record(step, toolMsg)
+			req.Messages = append(req.Messages, toolMsg)
+		}
+	}
+}
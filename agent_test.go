@@ -0,0 +1,94 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAgentServer responds with the messages in order, and records the request bodies.
+func newAgentServer(t *testing.T, requests *[]*ChatCompletionOptions, messages ...string) *Engine {
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var opts ChatCompletionOptions
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&opts))
+		*requests = append(*requests, &opts)
+		msg := messages[min(len(*requests), len(messages))-1]
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":` + msg + `,"finish_reason":"stop"}]}`))
+	})
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	return e
+}
+
+const weatherToolCall = `{"role":"assistant","content":null,"tool_calls":[` +
+	`{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Berlin\",\"unit\":\"celsius\"}"}},` +
+	`{"id":"call_2","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"\"}"}}]}`
+
+func TestRunAgentLoop(t *testing.T) {
+	var requests []*ChatCompletionOptions
+	e := newAgentServer(t, &requests, weatherToolCall, `{"role":"assistant","content":"It's sunny in Berlin."}`)
+	functions := NewFunctionRegistry()
+	require.NoError(t, functions.RegisterFromStruct(&weatherHandler{}))
+
+	var (
+		scratchpad []ChatMessage
+		steps      []int
+	)
+	opts := testChatOptions()
+	resp, err := e.RunAgentLoop(context.Background(), opts, functions, AgentLoopOptions{
+		StepCallback: func(step int, msg ChatMessage) { steps = append(steps, step) },
+		Scratchpad:   &scratchpad,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "It's sunny in Berlin.", resp.Choices[0].Message.Content)
+	assert.Len(t, opts.Messages, 1, "the options must not be modified")
+
+	require.Len(t, requests, 2)
+	assert.Equal(t, []string{"get_uv_index", "get_weather"}, []string{requests[0].Tools[0].Function.Name, requests[0].Tools[1].Function.Name})
+	require.Len(t, requests[1].Messages, 4)
+	assert.Equal(t, "call_1", requests[1].Messages[1].ToolCalls[0].Id)
+	assert.Equal(t, ChatMessage{Role: "tool", Content: "sunny in Berlin, 20 celsius", ToolCallId: "call_1"}, requests[1].Messages[2])
+	assert.Equal(t, ChatMessage{Role: "tool", Content: "error: city is required", ToolCallId: "call_2"}, requests[1].Messages[3])
+
+	assert.Equal(t, []int{0, 1, 1, 1, 2}, steps)
+	require.Len(t, scratchpad, 5)
+	assert.Equal(t, requests[1].Messages, scratchpad[:4])
+	assert.Equal(t, "It's sunny in Berlin.", scratchpad[4].Content)
+}
+
+func TestRunAgentLoopMaxSteps(t *testing.T) {
+	var requests []*ChatCompletionOptions
+	e := newAgentServer(t, &requests, weatherToolCall)
+	functions := NewFunctionRegistry()
+	require.NoError(t, functions.RegisterFromStruct(&weatherHandler{}))
+
+	var scratchpad []ChatMessage
+	resp, err := e.RunAgentLoop(context.Background(), testChatOptions(), functions, AgentLoopOptions{MaxSteps: 2, Scratchpad: &scratchpad})
+	assert.True(t, errors.Is(err, ErrMaxStepsExceeded))
+	require.NotNil(t, resp)
+	assert.Len(t, resp.Choices[0].Message.ToolCalls, 2)
+	assert.Len(t, requests, 2)
+	assert.Len(t, scratchpad, 5, "the user message, the tool calls with results, and the last tool calls")
+}
+
+func TestChatMessageToolCallsJSON(t *testing.T) {
+	var msg ChatMessage
+	require.NoError(t, json.Unmarshal([]byte(weatherToolCall), &msg))
+	require.Len(t, msg.ToolCalls, 2)
+	assert.Equal(t, ToolCall{Id: "call_2", Type: "function", Function: ToolCallFunction{Name: "get_weather", Arguments: `{"city":""}`}}, msg.ToolCalls[1])
+	b, err := json.Marshal(msg)
+	require.NoError(t, err)
+	assert.JSONEq(t, weatherToolCall, string(b))
+
+	b, err = json.Marshal(ChatMessage{Role: "tool", Content: "20", ToolCallId: "call_1"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"role":"tool","content":"20","tool_call_id":"call_1"}`, string(b))
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// AssistantTool is the tool of the assistant, "code_interpreter", "file_search" or "function"
+// of Function.
+type AssistantTool struct {
+	Type     string              `json:"type"`
+	Function *FunctionDefinition `json:"function,omitempty"`
+}
+
+// assistantsContext returns the context of the request to the Assistants API, which requires
+// the OpenAI-Beta header of its version.
+func assistantsContext(ctx context.Context, endpoint string) context.Context {
+	ctx = ContextWithHeaders(ctx, http.Header{"OpenAI-Beta": {"assistants=v2"}})
+	return withRequestInfo(ctx, endpoint, "")
+}
+
+// Limits of the files of the tool resources.
+const (
+	maxCodeInterpreterFiles   = 20
+	maxFileSearchVectorStores = 1
+)
+
+// ToolResources are the files used by the tools of the assistant or the thread.
+//
+// Docs: https://platform.openai.com/docs/api-reference/assistants/createAssistant#assistants-createassistant-tool_resources
+type ToolResources struct {
+	CodeInterpreter *CodeInterpreterResources `json:"code_interpreter,omitempty"`
+	FileSearch      *FileSearchResources      `json:"file_search,omitempty"`
+}
+
+type CodeInterpreterResources struct {
+	// The files available to the code_interpreter tool, up to 20.
+	FileIds []string `json:"file_ids" binding:"max=20"`
+}
+
+type FileSearchResources struct {
+	// The vector stores searched by the file_search tool, up to 1.
+	VectorStoreIds []string `json:"vector_store_ids" binding:"max=1"`
+}
+
+// ToolResourcesBuilder is used to build ToolResources, the limits of the API are checked by Build.
+type ToolResourcesBuilder struct {
+	fileIds        []string
+	vectorStoreIds []string
+}
+
+func NewToolResourcesBuilder() *ToolResourcesBuilder {
+	return &ToolResourcesBuilder{}
+}
+
+// WithCodeInterpreterFiles adds the files of the code_interpreter tool.
+func (b *ToolResourcesBuilder) WithCodeInterpreterFiles(fileIds ...string) *ToolResourcesBuilder {
+	b.fileIds = append(b.fileIds, fileIds...)
+	return b
+}
+
+// WithFileSearchVectorStores adds the vector stores of the file_search tool.
+func (b *ToolResourcesBuilder) WithFileSearchVectorStores(vectorStoreIds ...string) *ToolResourcesBuilder {
+	b.vectorStoreIds = append(b.vectorStoreIds, vectorStoreIds...)
+	return b
+}
+
+// Build returns the tool resources of the added files. The resources of the tool without files
+// are omitted. It returns the error if the files of any tool exceed the limit of the API, the
+// code_interpreter tool takes up to 20 files, the file_search tool takes 1 vector store.
+func (b *ToolResourcesBuilder) Build() (*ToolResources, error) {
+	var errs []error
+	if len(b.fileIds) > maxCodeInterpreterFiles {
+		errs = append(errs, fmt.Errorf("code_interpreter takes up to %d files, got %d", maxCodeInterpreterFiles, len(b.fileIds)))
+	}
+	if len(b.vectorStoreIds) > maxFileSearchVectorStores {
+		errs = append(errs, fmt.Errorf("file_search takes up to %d vector store, got %d", maxFileSearchVectorStores, len(b.vectorStoreIds)))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	resources := &ToolResources{}
+	if len(b.fileIds) != 0 {
+		resources.CodeInterpreter = &CodeInterpreterResources{FileIds: append([]string(nil), b.fileIds...)}
+	}
+	if len(b.vectorStoreIds) != 0 {
+		resources.FileSearch = &FileSearchResources{VectorStoreIds: append([]string(nil), b.vectorStoreIds...)}
+	}
+	return resources, nil
+}
+
+// Assistant is the model with the instructions and the tools which runs on threads, see CreateRun.
+//
+// Docs: https://platform.openai.com/docs/api-reference/assistants/object
+type Assistant struct {
+	Id           string          `json:"id"`
+	Object       string          `json:"object"`
+	CreatedAt    int64           `json:"created_at"`
+	Name         string          `json:"name,omitempty"`
+	Description  string          `json:"description,omitempty"`
+	Model        Model           `json:"model"`
+	Instructions string          `json:"instructions,omitempty"`
+	Tools        []AssistantTool `json:"tools"`
+	// The files of the tools, nil if the tools have no files.
+	ToolResources *ToolResources    `json:"tool_resources,omitempty"`
+	Temperature   float32           `json:"temperature,omitempty"`
+	TopP          float32           `json:"top_p,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+}
+
+type CreateAssistantOptions struct {
+	// ID of the model to use.
+	Model Model `json:"model" binding:"required"`
+	// The name of the assistant, up to 256 characters.
+	Name string `json:"name,omitempty" binding:"max=256"`
+	// The description of the assistant, up to 512 characters.
+	Description string `json:"description,omitempty" binding:"max=512"`
+	// The system instructions of the assistant, up to 256,000 characters.
+	Instructions string `json:"instructions,omitempty" binding:"max=256000"`
+	// The tools of the assistant, up to 128.
+	Tools []AssistantTool `json:"tools,omitempty" binding:"max=128"`
+	// The files of the tools, see ToolResourcesBuilder.
+	ToolResources *ToolResources    `json:"tool_resources,omitempty"`
+	Temperature   float32           `json:"temperature,omitempty"`
+	TopP          float32           `json:"top_p,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+}
+
+// CreateAssistant is used to create the assistant.
+//
+// Docs: https://platform.openai.com/docs/api-reference/assistants/createAssistant
+func (e *Engine) CreateAssistant(ctx context.Context, opts *CreateAssistantOptions) (*Assistant, error) {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	uri := e.apiBaseURL + "/assistants"
+	ctx = assistantsContext(ctx, "/assistants")
+	var assistant Assistant
+	if err := e.sendJSON(ctx, http.MethodPost, uri, opts, &assistant); err != nil {
+		return nil, err
+	}
+	return &assistant, nil
+}
+
+// CreateAssistantWithAutoSchemas is the same as CreateAssistant, but the functions of registry
+// are added to the tools of the assistant, with the schemas generated from their parameters, so
+// they stay in sync with the handlers. The tools of opts are kept, except for the functions of
+// the same names as the registered ones, which are replaced. opts isn't modified.
+func (e *Engine) CreateAssistantWithAutoSchemas(ctx context.Context, opts *CreateAssistantOptions, registry *FunctionRegistry) (*Assistant, error) {
+	req := *opts
+	req.Tools = mergeAssistantTools(opts.Tools, registry.AssistantTools())
+	return e.CreateAssistant(ctx, &req)
+}
+
+// mergeAssistantTools returns the tools followed by the functions, the functions replace the tools
+// of the same names in place.
+func mergeAssistantTools(tools, functions []AssistantTool) []AssistantTool {
+	merged := append([]AssistantTool(nil), tools...)
+	index := make(map[string]int)
+	for i, tool := range merged {
+		if tool.Function != nil {
+			index[tool.Function.Name] = i
+		}
+	}
+	for _, f := range functions {
+		if i, ok := index[f.Function.Name]; ok {
+			merged[i] = f
+			continue
+		}
+		merged = append(merged, f)
+	}
+	return merged
+}
+
+// RetrieveAssistant returns the assistant.
+//
+// Docs: https://platform.openai.com/docs/api-reference/assistants/getAssistant
+func (e *Engine) RetrieveAssistant(ctx context.Context, assistantId string) (*Assistant, error) {
+	uri := e.apiBaseURL + "/assistants/" + url.PathEscape(assistantId)
+	ctx = assistantsContext(ctx, "/assistants/{assistant_id}")
+	var assistant Assistant
+	if err := e.sendJSON(ctx, http.MethodGet, uri, nil, &assistant); err != nil {
+		return nil, err
+	}
+	return &assistant, nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAssistantWithAutoSchemas(t *testing.T) {
+	var created CreateAssistantOptions
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/assistants", r.URL.Path)
+		assert.Equal(t, "assistants=v2", r.Header.Get("OpenAI-Beta"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+		json.NewEncoder(w).Encode(Assistant{Id: "asst_1", Object: "assistant", Model: created.Model, Tools: created.Tools})
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	functions := NewFunctionRegistry()
+	require.NoError(t, functions.RegisterFromStruct(&weatherHandler{}))
+	opts := &CreateAssistantOptions{Model: "gpt-4o", Tools: []AssistantTool{
+		{Type: "function", Function: &FunctionDefinition{Name: "get_weather", Description: "stale"}},
+		{Type: "file_search"},
+	}}
+	assistant, err := e.CreateAssistantWithAutoSchemas(context.Background(), opts, functions)
+	require.NoError(t, err)
+	assert.Equal(t, "asst_1", assistant.Id)
+
+	registered := functions.ChatTools()
+	require.Len(t, registered, 2)
+	require.Len(t, created.Tools, 3)
+	assert.Equal(t, "get_weather", created.Tools[0].Function.Name, "the stale function is replaced in place")
+	assert.JSONEq(t, string(registered[1].Function.Parameters), string(created.Tools[0].Function.Parameters))
+	assert.Equal(t, AssistantTool{Type: "file_search"}, created.Tools[1])
+	assert.Equal(t, "get_uv_index", created.Tools[2].Function.Name)
+	assert.Equal(t, "stale", opts.Tools[0].Function.Description, "opts isn't modified")
+	assert.Len(t, opts.Tools, 2)
+}
+
+func TestRetrieveAssistant(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/assistants/asst_1", r.URL.Path)
+		assert.Equal(t, "assistants=v2", r.Header.Get("OpenAI-Beta"))
+		w.Write([]byte(`{"id":"asst_1","object":"assistant","created_at":1698984975,"name":"Math Tutor","model":"gpt-4o",
+			"instructions":"You are a personal math tutor.","tools":[{"type":"code_interpreter"}],"metadata":{}}`))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	assistant, err := e.RetrieveAssistant(context.Background(), "asst_1")
+	require.NoError(t, err)
+	assert.Equal(t, "You are a personal math tutor.", assistant.Instructions)
+	assert.Equal(t, []AssistantTool{{Type: "code_interpreter"}}, assistant.Tools)
+}
+
+func TestToolResourcesBuilder(t *testing.T) {
+	resources, err := NewToolResourcesBuilder().
+		WithCodeInterpreterFiles("file-1", "file-2").
+		WithCodeInterpreterFiles("file-3").
+		WithFileSearchVectorStores("vs_1").
+		Build()
+	require.NoError(t, err)
+	b, err := json.Marshal(resources)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"code_interpreter":{"file_ids":["file-1","file-2","file-3"]},"file_search":{"vector_store_ids":["vs_1"]}}`, string(b))
+
+	resources, err = NewToolResourcesBuilder().WithFileSearchVectorStores("vs_1").Build()
+	require.NoError(t, err)
+	assert.Nil(t, resources.CodeInterpreter, "the tool without files is omitted")
+
+	files := make([]string, 21)
+	for i := range files {
+		files[i] = "file-" + string(rune('a'+i))
+	}
+	_, err = NewToolResourcesBuilder().WithCodeInterpreterFiles(files...).WithFileSearchVectorStores("vs_1", "vs_2").Build()
+	assert.EqualError(t, err, "code_interpreter takes up to 20 files, got 21\nfile_search takes up to 1 vector store, got 2")
+
+	e := New("test")
+	e.apiBaseURL = "http://127.0.0.1:0" // nothing is sent
+	_, err = e.CreateAssistant(context.Background(), &CreateAssistantOptions{Model: "gpt-4o",
+		ToolResources: &ToolResources{FileSearch: &FileSearchResources{VectorStoreIds: []string{"vs_1", "vs_2"}}}})
+	assert.ErrorContains(t, err, "VectorStoreIds", "the limits are validated by CreateAssistant too")
+}
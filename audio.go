@@ -1,13 +1,25 @@
 package openai
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
+	"strings"
 )
 
+// Response formats of transcriptions and translations.
+const (
+	AudioResponseFormatJSON        = "json"
+	AudioResponseFormatVerboseJSON = "verbose_json"
+)
+
+// maxAudioPromptTokens is the number of tokens of the prompt the model takes into account.
+const maxAudioPromptTokens = 224
+
+// ErrInvalidLanguage is returned by Transcribe if the language isn't an ISO-639-1 code.
+var ErrInvalidLanguage = errors.New("openai: invalid language")
+
 type AudioOptions struct {
 	// The audio file to process, in one of these formats:
 	// mp3, mp4, mpeg, mpga, m4a, wav, or webm.
@@ -25,6 +37,9 @@ type AudioOptions struct {
 	// If set to 0, the model will use log probability to automatically increase
 	// the temperature until certain thresholds are hit.
 	Temperature float32
+	// The format of the response, json if it's empty. With verbose_json
+	// the response also has the language and the duration of the audio.
+	ResponseFormat string `binding:"omitempty,oneof=json verbose_json"`
 }
 
 type TranscribeOptions struct {
@@ -36,23 +51,31 @@ type TranscribeOptions struct {
 
 type TranscribeResponse struct {
 	Text string `json:"text"`
+	// The detected language of the audio, e.g. "german". Only set with verbose_json.
+	Language string `json:"language,omitempty"`
+	// The duration of the audio in seconds. Only set with verbose_json.
+	Duration float64 `json:"duration,omitempty"`
 }
 
 // Transcribe audio into the input language.
 //
 // Docs: https://platform.openai.com/docs/api-reference/audio/create
 func (e *Engine) Transcribe(ctx context.Context, options *TranscribeOptions) (*TranscribeResponse, error) {
-	if err := e.validate.StructCtx(ctx, options); err != nil {
+	if err := e.validate.ValidateCtx(ctx, options); err != nil {
+		return nil, err
+	}
+	if err := validateLanguage(options.Language); err != nil {
 		return nil, err
 	}
 
 	url := e.apiBaseURL + "/audio/transcriptions"
+	ctx = withRequestInfo(ctx, "/audio/transcriptions", options.Model)
 
-	body, contentType, err := newTranscribeBody(options)
+	body, err := newTranscribeBody(options, e.multipartBufferSize)
 	if err != nil {
 		return nil, err
 	}
-	req, err := e.newReq(ctx, "POST", url, contentType, body)
+	req, err := e.newMultipartReq(ctx, url, body)
 	if err != nil {
 		return nil, err
 	}
@@ -67,21 +90,85 @@ func (e *Engine) Transcribe(ctx context.Context, options *TranscribeOptions) (*T
 	return &jsonResp, nil
 }
 
-func newTranscribeBody(options *TranscribeOptions) (io.Reader, string, error) {
-	body := &bytes.Buffer{}
-	writer, err := newMultiPartWriter(body, options.AudioOptions)
+// validateLanguage checks that language is empty or an ISO-639-1 code.
+func validateLanguage(language string) error {
+	if language == "" {
+		return nil
+	}
+	if len(language) != 2 || language[0] < 'a' || language[0] > 'z' || language[1] < 'a' || language[1] > 'z' {
+		return fmt.Errorf("%w %q: expected ISO-639-1 code of two lowercase letters, e.g. \"en\" or \"de\"", ErrInvalidLanguage, language)
+	}
+	return nil
+}
+
+// TranscribeWithGlossary transcribes the audio file, spelling the glossary terms, e.g.
+// proper nouns and acronyms, as given. The terms are appended to the prompt of options
+// as far as they fit into the prompt budget of the model, the oldest terms, which are
+// first in glossary, are dropped first. options may be nil.
+func (e *Engine) TranscribeWithGlossary(ctx context.Context, file io.Reader, glossary []string, options *TranscribeOptions) (*TranscribeResponse, error) {
+	if options == nil {
+		options = &TranscribeOptions{}
+	}
+	audio := &AudioOptions{}
+	if options.AudioOptions != nil {
+		*audio = *options.AudioOptions
+	}
+	audio.File = file
+	prompt, err := packGlossaryPrompt(audio.Prompt, glossary, maxAudioPromptTokens)
 	if err != nil {
-		return nil, "", err
+		return nil, err
+	}
+	audio.Prompt = prompt
+	return e.Transcribe(ctx, &TranscribeOptions{AudioOptions: audio, Language: options.Language})
+}
+
+// packGlossaryPrompt appends as many of the last glossary terms to prompt as fit into
+// the budget of tokens. The terms keep their order. The tokens are counted by the GPT-2
+// tokenizer, which the multilingual tokenizer of Whisper extends with more tokens of the
+// other languages, so their prompts are counted conservatively.
+func packGlossaryPrompt(prompt string, glossary []string, budget int) (string, error) {
+	t, err := tokenizer(encodingR50kBase)
+	if err != nil {
+		return "", err
+	}
+	var (
+		terms  []string
+		packed = prompt
+	)
+	for i := len(glossary) - 1; i >= 0; i-- {
+		term := strings.TrimSpace(glossary[i])
+		if term == "" {
+			continue
+		}
+		candidate := joinGlossaryPrompt(prompt, append([]string{term}, terms...))
+		if len(t.EncodeOrdinary(candidate)) > budget {
+			break
+		}
+		terms = append([]string{term}, terms...)
+		packed = candidate
+	}
+	return packed, nil
+}
+
+func joinGlossaryPrompt(prompt string, terms []string) string {
+	glossary := strings.Join(terms, ", ")
+	if prompt == "" {
+		return glossary
+	}
+	return prompt + " " + glossary
+}
+
+func newTranscribeBody(options *TranscribeOptions, bufferSize int64) (*multipartBody, error) {
+	writer, err := newMultiPartWriter(options.AudioOptions, bufferSize)
+	if err != nil {
+		return nil, err
 	}
 	if options.Language != "" {
 		if err := writer.WriteField("language", options.Language); err != nil {
-			return nil, "", fmt.Errorf("write language: %w", err)
+			return nil, fmt.Errorf("write language: %w", err)
 		}
 	}
-	if err := writer.Close(); err != nil {
-		return nil, "", fmt.Errorf("close writer: %w", err)
-	}
-	return body, writer.FormDataContentType(), nil
+	return writer.Close()
 }
 
 type TranslateOptions struct {
@@ -90,24 +177,29 @@ type TranslateOptions struct {
 
 type TranslateResponse struct {
 	Text string `json:"text"`
+	// The language of the translation, always "english". Only set with verbose_json.
+	Language string `json:"language,omitempty"`
+	// The duration of the audio in seconds. Only set with verbose_json.
+	Duration float64 `json:"duration,omitempty"`
 }
 
 // Translate audio into English.
 //
 // Docs: https://platform.openai.com/docs/api-reference/audio/create
 func (e *Engine) Translate(ctx context.Context, options *TranslateOptions) (*TranslateResponse, error) {
-	if err := e.validate.StructCtx(ctx, options); err != nil {
+	if err := e.validate.ValidateCtx(ctx, options); err != nil {
 		return nil, err
 	}
 
 	url := e.apiBaseURL + "/audio/translations"
+	ctx = withRequestInfo(ctx, "/audio/translations", options.Model)
 
-	body, contentType, err := newTranslateBody(options)
+	body, err := newTranslateBody(options, e.multipartBufferSize)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := e.newReq(ctx, "POST", url, contentType, body)
+	req, err := e.newMultipartReq(ctx, url, body)
 	if err != nil {
 		return nil, err
 	}
@@ -122,33 +214,29 @@ func (e *Engine) Translate(ctx context.Context, options *TranslateOptions) (*Tra
 	return &jsonResp, nil
 }
 
-func newTranslateBody(options *TranslateOptions) (io.Reader, string, error) {
-	body := &bytes.Buffer{}
-	writer, err := newMultiPartWriter(body, options.AudioOptions)
+func newTranslateBody(options *TranslateOptions, bufferSize int64) (*multipartBody, error) {
+	writer, err := newMultiPartWriter(options.AudioOptions, bufferSize)
 	if err != nil {
-		return nil, "", err
-	}
-	if err := writer.Close(); err != nil {
-		return nil, "", fmt.Errorf("close writer: %w", err)
+		return nil, err
 	}
-	return body, writer.FormDataContentType(), nil
+	return writer.Close()
 }
 
-func newMultiPartWriter(body *bytes.Buffer, options *AudioOptions) (*multipart.Writer, error) {
-	writer := multipart.NewWriter(body)
+func newMultiPartWriter(options *AudioOptions, bufferSize int64) (*multipartBuilder, error) {
+	writer := newMultipartBuilder(bufferSize)
 	if err := writer.WriteField("model", string(options.Model)); err != nil {
 		return nil, fmt.Errorf("write model: %w", err)
 	}
-	// TODO: support additional response data via verbose_json? what about other formats (vtt, srt)?g
-	if err := writer.WriteField("response_format", "json"); err != nil {
-		return nil, fmt.Errorf("write response format: %w", err)
+	// TODO: what about other formats (text, vtt, srt)? They aren't JSON.
+	responseFormat := options.ResponseFormat
+	if responseFormat == "" {
+		responseFormat = AudioResponseFormatJSON
 	}
-	file, err := writer.CreateFormFile("file", "file."+options.AudioFormat)
-	if err != nil {
-		return nil, fmt.Errorf("create form file: %w", err)
+	if err := writer.WriteField("response_format", responseFormat); err != nil {
+		return nil, fmt.Errorf("write response format: %w", err)
 	}
-	if _, err := io.Copy(file, options.File); err != nil {
-		return nil, fmt.Errorf("copy file: %w", err)
+	if err := writer.WriteFile("file", "file."+options.AudioFormat, options.File); err != nil {
+		return nil, fmt.Errorf("write file: %w", err)
 	}
 	if options.Prompt != "" {
 		if err := writer.WriteField("prompt", options.Prompt); err != nil {
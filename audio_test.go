@@ -4,8 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTranscribe(t *testing.T) {
@@ -53,3 +59,84 @@ func TestTranslate(t *testing.T) {
 		log.Println(string(b))
 	}
 }
+
+func TestTranscribeInvalidLanguage(t *testing.T) {
+	e := New("test")
+	for _, language := range []string{"english", "EN", "e", "en-US", "d3"} {
+		options := transcribeOptions(strings.NewReader("RIFF audio"))
+		options.Language = language
+		_, err := e.Transcribe(context.Background(), options)
+		assert.ErrorIs(t, err, ErrInvalidLanguage, language)
+		assert.ErrorContains(t, err, "ISO-639-1", language)
+	}
+}
+
+func TestTranscribeVerboseJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		assert.Equal(t, "verbose_json", r.FormValue("response_format"))
+		assert.Equal(t, "de", r.FormValue("language"))
+		w.Write([]byte(`{"task":"transcribe","language":"german","duration":8.47,"text":"hallo","segments":[]}`))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	options := transcribeOptions(strings.NewReader("RIFF audio"))
+	options.Language = "de"
+	options.ResponseFormat = AudioResponseFormatVerboseJSON
+	r, err := e.Transcribe(context.Background(), options)
+	require.NoError(t, err)
+	assert.Equal(t, &TranscribeResponse{Text: "hallo", Language: "german", Duration: 8.47}, r)
+}
+
+func TestTranscribeWithGlossary(t *testing.T) {
+	var prompt string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		prompt = r.FormValue("prompt")
+		w.Write([]byte(`{"text":"hallo"}`))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	options := transcribeOptions(nil)
+	options.Prompt = "Meeting notes:"
+	_, err := e.TranscribeWithGlossary(context.Background(), strings.NewReader("RIFF audio"), []string{"0x9ef", "Kubernetes"}, options)
+	require.NoError(t, err)
+	assert.Equal(t, "Meeting notes: 0x9ef, Kubernetes", prompt)
+	assert.Equal(t, "Meeting notes:", options.Prompt, "options aren't modified")
+
+	assert.NotPanics(t, func() {
+		e.TranscribeWithGlossary(context.Background(), strings.NewReader("RIFF audio"), []string{"0x9ef"}, nil)
+	}, "nil options are allowed")
+}
+
+func TestPackGlossaryPrompt(t *testing.T) {
+	gpt2, err := tokenizer(encodingR50kBase)
+	require.NoError(t, err)
+	glossary := []string{"Alpha", "Bravo", " ", "Charlie", "Delta"}
+	for _, tc := range []struct {
+		glossary []string
+		prompt   string
+		budget   int
+		want     string
+	}{
+		{glossary, "", 100, "Alpha, Bravo, Charlie, Delta"},
+		{glossary, "Names:", 100, "Names: Alpha, Bravo, Charlie, Delta"},
+		// The oldest terms are dropped first
+		{glossary, "", 3, "Charlie, Delta"},
+		{glossary, "Names:", 3, "Names: Delta"},
+		{glossary, "", 0, ""},
+		{glossary, "A prompt which is over the budget", 2, "A prompt which is over the budget"},
+		// "東京都, 大阪府" is 14 tokens, it'd be estimated as 5 tokens by its length and Zürich would fit
+		{[]string{"Zürich", "東京都", "大阪府"}, "", 14, "東京都, 大阪府"},
+		{[]string{"Zürich", "東京都", "大阪府"}, "", 13, "大阪府"},
+	} {
+		packed, err := packGlossaryPrompt(tc.prompt, tc.glossary, tc.budget)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, packed, "%q %d", tc.prompt, tc.budget)
+		assert.LessOrEqual(t, len(gpt2.EncodeOrdinary(packed)), max(tc.budget, len(gpt2.EncodeOrdinary(tc.prompt))))
+	}
+}
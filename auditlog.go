@@ -0,0 +1,173 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"iter"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Types of the actor of the audit log event.
+const (
+	AuditLogActorSession = "session"
+	AuditLogActorAPIKey  = "api_key"
+)
+
+// AuditLogEvent is the user action or the configuration change of the organization.
+type AuditLogEvent struct {
+	Id string `json:"id"`
+	// The type of the event, e.g. "api_key.created" or "project.archived".
+	Type string `json:"type"`
+	// The Unix timestamp of the event.
+	EffectiveAt int64 `json:"effective_at"`
+	// The project of the event, nil if it isn't scoped to the project.
+	Project *AuditLogProject `json:"project,omitempty"`
+	Actor   AuditLogActor    `json:"actor"`
+	// APIKey is the API key the action was taken with, the same as Actor.APIKey.
+	// It's nil if the action was taken in the session.
+	APIKey *AuditLogAPIKey `json:"-"`
+	// Details is the payload of the event specific to its type, e.g. the changes of the modified
+	// object. Decode it by the type, it's nil if the event has none.
+	Details json.RawMessage `json:"-"`
+}
+
+func (e *AuditLogEvent) UnmarshalJSON(b []byte) error {
+	type event AuditLogEvent
+	if err := json.Unmarshal(b, (*event)(e)); err != nil {
+		return err
+	}
+	// The payload is keyed by the type of the event
+	var payloads map[string]json.RawMessage
+	if err := json.Unmarshal(b, &payloads); err != nil {
+		return err
+	}
+	e.Details = payloads[e.Type]
+	e.APIKey = e.Actor.APIKey
+	return nil
+}
+
+func (e AuditLogEvent) MarshalJSON() ([]byte, error) {
+	type event AuditLogEvent
+	b, err := json.Marshal(event(e))
+	if err != nil || e.Details == nil {
+		return b, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	fields[e.Type] = e.Details
+	return json.Marshal(fields)
+}
+
+// AuditLogProject is the project of the audit log event.
+type AuditLogProject struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// AuditLogActor is the user who took the action in the session, or the API key it was taken
+// with, depending on the type.
+type AuditLogActor struct {
+	Type    string           `json:"type"`
+	Session *AuditLogSession `json:"session,omitempty"`
+	APIKey  *AuditLogAPIKey  `json:"api_key,omitempty"`
+}
+
+// AuditLogSession is the session of the user who took the action.
+type AuditLogSession struct {
+	User      AuditLogUser `json:"user"`
+	IPAddress string       `json:"ip_address"`
+}
+
+// AuditLogAPIKey is the API key the action was taken with, owned by the user or the service account,
+// depending on the type, see APIKeyOwner.
+type AuditLogAPIKey struct {
+	Id             string                  `json:"id"`
+	Type           string                  `json:"type"`
+	User           *AuditLogUser           `json:"user,omitempty"`
+	ServiceAccount *AuditLogServiceAccount `json:"service_account,omitempty"`
+}
+
+// AuditLogUser is the user of the audit log event.
+type AuditLogUser struct {
+	Id    string `json:"id"`
+	Email string `json:"email"`
+}
+
+// AuditLogServiceAccount is the service account of the audit log event.
+type AuditLogServiceAccount struct {
+	Id string `json:"id"`
+}
+
+type AuditLogOptions struct {
+	ListOptions
+	// The range of the time of the events, the start is inclusive and the end is exclusive.
+	// Either of them may be nil.
+	EffectiveAt [2]*time.Time
+	// Only return the events of the projects.
+	ProjectIds []string
+	// Only return the events of the types, e.g. "api_key.created".
+	EventTypes []string
+	// Only return the events of the actors, the IDs of the users, the API keys or the service accounts.
+	ActorIds []string
+	// Only return the events of the users of the emails.
+	ActorEmails []string
+	// Only return the events of the targets, e.g. the IDs of the projects or the API keys.
+	ResourceIds []string
+}
+
+// ListAuditLogs returns the page of the audit log events of the organization, the most recent first.
+// The audit logging must be enabled in the settings of the organization.
+//
+// Docs: https://platform.openai.com/docs/api-reference/audit-logs/list
+func (e *Engine) ListAuditLogs(ctx context.Context, opts *AuditLogOptions) (*Page[AuditLogEvent], error) {
+	if opts == nil {
+		opts = &AuditLogOptions{}
+	}
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	q := opts.ListOptions.query()
+	if start := opts.EffectiveAt[0]; start != nil {
+		q.Set("effective_at[gte]", strconv.FormatInt(start.Unix(), 10))
+	}
+	if end := opts.EffectiveAt[1]; end != nil {
+		q.Set("effective_at[lt]", strconv.FormatInt(end.Unix(), 10))
+	}
+	for name, values := range map[string][]string{
+		"project_ids[]":  opts.ProjectIds,
+		"event_types[]":  opts.EventTypes,
+		"actor_ids[]":    opts.ActorIds,
+		"actor_emails[]": opts.ActorEmails,
+		"resource_ids[]": opts.ResourceIds,
+	} {
+		if len(values) != 0 {
+			q[name] = values
+		}
+	}
+	uri := withQuery(e.apiBaseURL+"/organization/audit_logs", q)
+	ctx = withRequestInfo(ctx, "/organization/audit_logs", "")
+	var page Page[AuditLogEvent]
+	if err := e.sendJSON(ctx, http.MethodGet, uri, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// AllAuditLogs iterates over the audit log events of all pages, starting with the page of opts.
+func (e *Engine) AllAuditLogs(ctx context.Context, opts *AuditLogOptions) iter.Seq2[AuditLogEvent, error] {
+	var o AuditLogOptions
+	if opts != nil {
+		o = *opts
+	}
+	return paginate(ctx, o.After, func(ctx context.Context, after string) (*Page[AuditLogEvent], error) {
+		o.After = after
+		return e.ListAuditLogs(ctx, &o)
+	})
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAuditLogEvents = `[
+	{"id":"audit_log-1","type":"api_key.created","effective_at":1720804090,
+		"project":{"id":"proj_1","name":"Production"},
+		"actor":{"type":"session","session":{"user":{"id":"user-1","email":"admin@example.com"},"ip_address":"127.0.0.1"}},
+		"api_key.created":{"id":"key_1","data":{"scopes":["resource.operation"]}}},
+	{"id":"audit_log-2","type":"project.archived","effective_at":1720804100,
+		"actor":{"type":"api_key","api_key":{"id":"key_2","type":"service_account","service_account":{"id":"svc_acct_1"}}},
+		"project.archived":{"id":"proj_2"}},
+	{"id":"audit_log-3","type":"logout.succeeded","effective_at":1720804200,
+		"actor":{"type":"session","session":{"user":{"id":"user-1","email":"admin@example.com"},"ip_address":"127.0.0.1"}}}
+]`
+
+func TestListAuditLogs(t *testing.T) {
+	var queries []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/organization/audit_logs", r.URL.Path)
+		assert.Equal(t, "Bearer sk-admin", r.Header.Get("Authorization"))
+		queries = append(queries, r.URL.Query())
+		var events []json.RawMessage
+		require.NoError(t, json.Unmarshal([]byte(testAuditLogEvents), &events))
+		page := Page[json.RawMessage]{Object: "list", Data: events[:2], FirstId: "audit_log-1", LastId: "audit_log-2", HasMore: true}
+		if r.URL.Query().Get("after") == "audit_log-2" {
+			page = Page[json.RawMessage]{Object: "list", Data: events[2:], FirstId: "audit_log-3", LastId: "audit_log-3"}
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer srv.Close()
+	e := New("sk-project", WithAdminAPIKey("sk-admin"))
+	e.apiBaseURL = srv.URL
+
+	start, end := time.Unix(1720800000, 0), time.Unix(1720900000, 0)
+	page, err := e.ListAuditLogs(context.Background(), &AuditLogOptions{
+		ListOptions: ListOptions{Limit: 2},
+		EffectiveAt: [2]*time.Time{&start, &end},
+		ProjectIds:  []string{"proj_1", "proj_2"},
+		EventTypes:  []string{"api_key.created", "project.archived"},
+		ActorEmails: []string{"admin@example.com"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{
+		"limit":             {"2"},
+		"effective_at[gte]": {"1720800000"},
+		"effective_at[lt]":  {"1720900000"},
+		"project_ids[]":     {"proj_1", "proj_2"},
+		"event_types[]":     {"api_key.created", "project.archived"},
+		"actor_emails[]":    {"admin@example.com"},
+	}, queries[0])
+	require.Len(t, page.Data, 2)
+
+	created := page.Data[0]
+	assert.Equal(t, "api_key.created", created.Type)
+	assert.Equal(t, int64(1720804090), created.EffectiveAt)
+	assert.Equal(t, &AuditLogProject{Id: "proj_1", Name: "Production"}, created.Project)
+	assert.Equal(t, AuditLogActorSession, created.Actor.Type)
+	assert.Equal(t, "admin@example.com", created.Actor.Session.User.Email)
+	assert.Nil(t, created.APIKey)
+	assert.JSONEq(t, `{"id":"key_1","data":{"scopes":["resource.operation"]}}`, string(created.Details))
+
+	archived := page.Data[1]
+	assert.Nil(t, archived.Project)
+	require.NotNil(t, archived.APIKey)
+	assert.Equal(t, &AuditLogAPIKey{Id: "key_2", Type: APIKeyOwnerServiceAccount, ServiceAccount: &AuditLogServiceAccount{Id: "svc_acct_1"}}, archived.APIKey)
+	assert.Same(t, archived.Actor.APIKey, archived.APIKey)
+	assert.JSONEq(t, `{"id":"proj_2"}`, string(archived.Details))
+
+	b, err := json.Marshal(created)
+	require.NoError(t, err)
+	var decoded AuditLogEvent
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, created, decoded, "the details are marshaled by the type")
+
+	var ids []string
+	for event, err := range e.AllAuditLogs(context.Background(), &AuditLogOptions{EventTypes: []string{"logout.succeeded"}}) {
+		require.NoError(t, err)
+		ids = append(ids, event.Id)
+		if event.Id == "audit_log-3" {
+			assert.Nil(t, event.Details)
+		}
+	}
+	assert.Equal(t, []string{"audit_log-1", "audit_log-2", "audit_log-3"}, ids)
+	assert.Equal(t, []string{"logout.succeeded"}, queries[2]["event_types[]"], "the filters apply to every page")
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+const (
+	defaultAdaptiveMaxConcurrency = 32
+	// remainingRequestsHeader is the number of requests left in the rate limit window.
+	remainingRequestsHeader = "X-Ratelimit-Remaining-Requests"
+)
+
+// BatchOptions configures the parallelism of ChatCompletionBatch and EmbeddingsBatch.
+type BatchOptions struct {
+	// Concurrency is the number of requests in flight, 1 if it's zero.
+	// If Adaptive is set, it's the initial number of requests in flight.
+	Concurrency int
+	// Adaptive adjusts the number of requests in flight to the capacity of the API
+	// if it's set, otherwise the number of requests in flight is fixed.
+	Adaptive *AdaptiveConcurrency
+}
+
+// AdaptiveConcurrency adjusts the number of requests in flight with the additive increase,
+// multiplicative decrease (AIMD) scheme: the limit is increased by one after a window of
+// successful responses and halved on a 429 or 5xx response. Responses of all attempts,
+// including the ones retried by engine, are taken into account.
+type AdaptiveConcurrency struct {
+	// Min is the lower bound of the number of requests in flight, 1 if it's zero.
+	Min int
+	// Max is the upper bound of the number of requests in flight, 32 if it's zero.
+	Max int
+	// Window is the number of successful responses after which the limit is increased.
+	// If it's zero, it's the current limit, so the limit grows by one per round of requests.
+	Window int
+	// SeedFromHeaders sets the limit to the number of remaining requests reported
+	// by the x-ratelimit-remaining-requests header of the first response.
+	SeedFromHeaders bool
+}
+
+type ChatCompletionBatchResult struct {
+	Response *ChatCompletionResponse
+	Err      error
+}
+
+type EmbeddingsBatchResult struct {
+	Response *EmbeddingsResponse
+	Err      error
+}
+
+// ChatCompletionBatch sends the chat completion requests in parallel. The results are in the
+// order of requests, a failed request doesn't stop the others. Once ctx is done, the requests
+// which weren't sent yet fail with the error of ctx.
+func (e *Engine) ChatCompletionBatch(ctx context.Context, requests []*ChatCompletionOptions, opts BatchOptions) []ChatCompletionBatchResult {
+	results := make([]ChatCompletionBatchResult, len(requests))
+	errs := e.runBatch(ctx, "/chat/completions", len(requests), opts, func(ctx context.Context, i int) error {
+		var err error
+		results[i].Response, err = e.ChatCompletion(ctx, requests[i])
+		return err
+	})
+	for i, err := range errs {
+		results[i].Err = err
+	}
+	return results
+}
+
+// EmbeddingsBatch sends the embeddings requests in parallel. The results are in the
+// order of requests, a failed request doesn't stop the others. Once ctx is done, the requests
+// which weren't sent yet fail with the error of ctx.
+func (e *Engine) EmbeddingsBatch(ctx context.Context, requests []*EmbeddingsOptions, opts BatchOptions) []EmbeddingsBatchResult {
+	results := make([]EmbeddingsBatchResult, len(requests))
+	errs := e.runBatch(ctx, "/embeddings", len(requests), opts, func(ctx context.Context, i int) error {
+		var err error
+		results[i].Response, err = e.Embeddings(ctx, requests[i])
+		return err
+	})
+	for i, err := range errs {
+		results[i].Err = err
+	}
+	return results
+}
+
+// runBatch calls do for each of n requests, keeping the number of calls in flight within the limit.
+func (e *Engine) runBatch(ctx context.Context, endpoint string, n int, opts BatchOptions, do func(ctx context.Context, i int) error) []error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	errs := make([]error, n)
+	l := newConcurrencyLimiter(opts, func(limit int) {
+		e.recordConcurrency(endpoint, limit)
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		epoch, err := l.acquire(ctx)
+		if err != nil {
+			for ; i < n; i++ {
+				errs[i] = err
+			}
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer l.release()
+			reqCtx := ctx
+			if opts.Adaptive != nil {
+				reqCtx = withResponseObserver(ctx, func(resp *http.Response) {
+					l.observe(epoch, resp)
+				})
+			}
+			errs[i] = do(reqCtx, i)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// concurrencyLimiter limits the number of requests in flight. If it's adaptive,
+// the limit is adjusted by the responses passed to observe.
+type concurrencyLimiter struct {
+	mu        sync.Mutex
+	cfg       AdaptiveConcurrency
+	limit     int
+	inFlight  int
+	successes int
+	// epoch is incremented on every decrease, responses to requests sent
+	// before the decrease don't decrease the limit again.
+	epoch    int
+	seeded   bool
+	changed  chan struct{}
+	onChange func(limit int)
+}
+
+func newConcurrencyLimiter(opts BatchOptions, onChange func(limit int)) *concurrencyLimiter {
+	l := &concurrencyLimiter{
+		limit:    opts.Concurrency,
+		changed:  make(chan struct{}),
+		onChange: onChange,
+	}
+	if opts.Adaptive != nil {
+		l.cfg = *opts.Adaptive
+	}
+	if l.cfg.Min <= 0 {
+		l.cfg.Min = 1
+	}
+	if l.cfg.Max <= 0 {
+		l.cfg.Max = defaultAdaptiveMaxConcurrency
+	}
+	if l.cfg.Max < l.cfg.Min {
+		l.cfg.Max = l.cfg.Min
+	}
+	if opts.Adaptive == nil {
+		if l.limit <= 0 {
+			l.limit = 1
+		}
+	} else {
+		l.limit = l.clamp(l.limit)
+		onChange(l.limit)
+	}
+	return l
+}
+
+func (l *concurrencyLimiter) clamp(limit int) int {
+	if limit < l.cfg.Min {
+		return l.cfg.Min
+	}
+	if limit > l.cfg.Max {
+		return l.cfg.Max
+	}
+	return limit
+}
+
+// acquire blocks until the request can be sent, it returns the current epoch.
+func (l *concurrencyLimiter) acquire(ctx context.Context) (int, error) {
+	for {
+		l.mu.Lock()
+		if l.inFlight < l.limit {
+			l.inFlight++
+			epoch := l.epoch
+			l.mu.Unlock()
+			return epoch, nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+func (l *concurrencyLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.notify()
+}
+
+// notify wakes up the waiting acquire calls, l.mu must be held.
+func (l *concurrencyLimiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// observe adjusts the limit by the response to the request sent in epoch.
+func (l *concurrencyLimiter) observe(epoch int, resp *http.Response) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit := l.limit
+	if l.cfg.SeedFromHeaders && !l.seeded {
+		if remaining, err := strconv.Atoi(resp.Header.Get(remainingRequestsHeader)); err == nil {
+			l.seeded = true
+			limit = l.clamp(remaining)
+		}
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		l.successes = 0
+		if epoch == l.epoch {
+			l.epoch++
+			limit = l.clamp(limit / 2)
+		}
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		l.successes++
+		window := l.cfg.Window
+		if window <= 0 {
+			window = limit
+		}
+		if l.successes >= window {
+			l.successes = 0
+			limit = l.clamp(limit + 1)
+		}
+	}
+	if limit != l.limit {
+		l.limit = limit
+		l.notify()
+		l.onChange(limit)
+	}
+}
+
+type responseObserverKey struct{}
+
+// withResponseObserver registers fn to be called with the response of every attempt of the request.
+func withResponseObserver(ctx context.Context, fn func(resp *http.Response)) context.Context {
+	return context.WithValue(ctx, responseObserverKey{}, fn)
+}
+
+func observeResponse(ctx context.Context, resp *http.Response) {
+	if fn, ok := ctx.Value(responseObserverKey{}).(func(resp *http.Response)); ok && resp != nil {
+		fn(resp)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type concurrencyCollector struct {
+	testCollector
+	mu     sync.Mutex
+	limits []int
+}
+
+func (c *concurrencyCollector) RecordConcurrency(endpoint string, limit int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limits = append(c.limits, limit)
+}
+
+func (c *concurrencyCollector) RecordRequestDuration(string, string, time.Duration, int) {}
+func (c *concurrencyCollector) RecordTokenUsage(string, int, int)                        {}
+func (c *concurrencyCollector) RecordError(string, string, string)                       {}
+
+// newCapacityServer answers chat completions with the content of the last message.
+// Requests above capacity in flight are rejected with 429.
+func newCapacityServer(t *testing.T, capacity int32, delay time.Duration, maxInFlight *int32) *httptest.Server {
+	var inFlight int32
+	return newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(maxInFlight, max, n) {
+				break
+			}
+		}
+		if capacity > 0 && n > capacity {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"message":"rate limit reached","type":"requests"}}`))
+			return
+		}
+		var opts ChatCompletionOptions
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&opts))
+		time.Sleep(delay)
+		json.NewEncoder(w).Encode(ChatCompletionResponse{
+			Choices: []ChatCompletionChoice{{Message: ChatMessage{Role: "assistant", Content: opts.Messages[0].Content}}},
+		})
+	})
+}
+
+func batchRequests(n int) []*ChatCompletionOptions {
+	requests := make([]*ChatCompletionOptions, n)
+	for i := range requests {
+		requests[i] = &ChatCompletionOptions{
+			Model:    ModelGPT3Dot5Turbo,
+			Messages: []ChatMessage{{Role: "user", Content: fmt.Sprint(i)}},
+		}
+	}
+	return requests
+}
+
+func TestChatCompletionBatch(t *testing.T) {
+	var maxInFlight int32
+	srv := newCapacityServer(t, 0, 10*time.Millisecond, &maxInFlight)
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	results := e.ChatCompletionBatch(context.Background(), batchRequests(20), BatchOptions{Concurrency: 3})
+	require.Len(t, results, 20)
+	for i, r := range results {
+		require.NoError(t, r.Err)
+		assert.Equal(t, fmt.Sprint(i), r.Response.Choices[0].Message.Content)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&maxInFlight))
+}
+
+func TestChatCompletionBatchCanceled(t *testing.T) {
+	var maxInFlight int32
+	srv := newCapacityServer(t, 0, 50*time.Millisecond, &maxInFlight)
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	results := e.ChatCompletionBatch(ctx, batchRequests(5), BatchOptions{})
+	for _, r := range results {
+		assert.ErrorIs(t, r.Err, context.DeadlineExceeded)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&maxInFlight))
+}
+
+func TestAdaptiveConcurrencyConverges(t *testing.T) {
+	const capacity = 8
+	var maxInFlight int32
+	srv := newCapacityServer(t, capacity, 5*time.Millisecond, &maxInFlight)
+	c := &concurrencyCollector{}
+	e := New("test", WithMetrics(c))
+	e.apiBaseURL = srv.URL
+	e.backoff = func(int, *http.Response) time.Duration { return time.Millisecond }
+	e.SetMaxRetries(20)
+
+	results := e.ChatCompletionBatch(context.Background(), batchRequests(600), BatchOptions{
+		Adaptive: &AdaptiveConcurrency{Min: 1, Max: 64},
+	})
+	for i, r := range results {
+		require.NoError(t, r.Err)
+		assert.Equal(t, fmt.Sprint(i), r.Response.Choices[0].Message.Content)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	require.NotEmpty(t, c.limits)
+	assert.Equal(t, 1, c.limits[0])
+	var ramp int
+	for ramp < len(c.limits) && c.limits[ramp] <= capacity {
+		ramp++
+	}
+	require.Less(t, ramp, len(c.limits), "limit must probe above the capacity")
+	// Once the capacity was reached, the limit saws around it instead of collapsing or running away
+	var sum int
+	for _, limit := range c.limits[ramp:] {
+		assert.GreaterOrEqual(t, limit, capacity/2-1)
+		assert.LessOrEqual(t, limit, 2*capacity)
+		sum += limit
+	}
+	mean := float64(sum) / float64(len(c.limits)-ramp)
+	t.Logf("limits: %v, mean %.1f", c.limits[ramp:], mean)
+	assert.InDelta(t, capacity, mean, capacity/2)
+}
+
+func TestAdaptiveConcurrencySeedFromHeaders(t *testing.T) {
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Ratelimit-Remaining-Requests", "5")
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+	})
+	c := &concurrencyCollector{}
+	e := New("test", WithMetrics(c))
+	e.apiBaseURL = srv.URL
+
+	results := e.ChatCompletionBatch(context.Background(), batchRequests(3), BatchOptions{
+		Concurrency: 1,
+		Adaptive:    &AdaptiveConcurrency{Max: 4, Window: 100, SeedFromHeaders: true},
+	})
+	for _, r := range results {
+		require.NoError(t, r.Err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	assert.Equal(t, []int{1, 4}, c.limits, "seeded limit must be bounded by Max")
+}
+
+func TestEmbeddingsBatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var opts EmbeddingsOptions
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&opts))
+		if opts.Input[0] == "fail" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"invalid input","type":"invalid_request_error"}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(EmbeddingsResponse{Data: []Embedding{{Embedding: []float32{float32(len(opts.Input[0]))}}}})
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	results := e.EmbeddingsBatch(context.Background(), []*EmbeddingsOptions{
+		{Model: ModelTextEmbedding3Small, Input: []string{"a"}},
+		{Model: ModelTextEmbedding3Small, Input: []string{"fail"}},
+		{Model: ModelTextEmbedding3Small, Input: []string{"abc"}},
+	}, BatchOptions{Concurrency: 2, Adaptive: &AdaptiveConcurrency{}})
+	require.Len(t, results, 3)
+	require.NoError(t, results[0].Err)
+	assert.Equal(t, []float32{1}, results[0].Response.Data[0].Embedding)
+	var apiErr APIError
+	require.ErrorAs(t, results[1].Err, &apiErr)
+	assert.Equal(t, "invalid input", apiErr.Err.Message)
+	require.NoError(t, results[2].Err)
+	assert.Equal(t, []float32{3}, results[2].Response.Data[0].Embedding)
+}
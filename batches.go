@@ -0,0 +1,265 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// BatchCompletionWindow24h is the time frame the batch is processed within, the only one supported.
+const BatchCompletionWindow24h = "24h"
+
+// Statuses of the batch.
+const (
+	BatchValidating = "validating"
+	BatchFailed     = "failed"
+	BatchInProgress = "in_progress"
+	BatchFinalizing = "finalizing"
+	BatchCompleted  = "completed"
+	BatchExpired    = "expired"
+	BatchCancelling = "cancelling"
+	BatchCancelled  = "cancelled"
+)
+
+// Batch is the batch of requests processed asynchronously, see CreateBatch. The results
+// are written to the output file, parse it with ParseBatchOutputFile.
+type Batch struct {
+	Id     string `json:"id"`
+	Object string `json:"object"`
+	// The endpoint of the requests, e.g. "/v1/chat/completions".
+	Endpoint string `json:"endpoint"`
+	// The errors of the validation of the input file, nil if it's valid.
+	Errors           *BatchErrors `json:"errors,omitempty"`
+	InputFileId      string       `json:"input_file_id"`
+	CompletionWindow string       `json:"completion_window"`
+	Status           string       `json:"status"`
+	// The file of the results of the successful requests and of the failed ones,
+	// they are set once the batch is completed.
+	OutputFileId string `json:"output_file_id,omitempty"`
+	ErrorFileId  string `json:"error_file_id,omitempty"`
+	// The Unix timestamps of the changes of the status, zero until the batch reaches the status.
+	CreatedAt     int64              `json:"created_at"`
+	InProgressAt  int64              `json:"in_progress_at,omitempty"`
+	ExpiresAt     int64              `json:"expires_at,omitempty"`
+	FinalizingAt  int64              `json:"finalizing_at,omitempty"`
+	CompletedAt   int64              `json:"completed_at,omitempty"`
+	FailedAt      int64              `json:"failed_at,omitempty"`
+	ExpiredAt     int64              `json:"expired_at,omitempty"`
+	CancellingAt  int64              `json:"cancelling_at,omitempty"`
+	CancelledAt   int64              `json:"cancelled_at,omitempty"`
+	RequestCounts BatchRequestCounts `json:"request_counts"`
+	Metadata      map[string]string  `json:"metadata,omitempty"`
+}
+
+// BatchErrors are the errors of the validation of the batch input file.
+type BatchErrors struct {
+	Object string                 `json:"object"`
+	Data   []BatchValidationError `json:"data"`
+}
+
+// BatchValidationError is the error of the line of the batch input file.
+type BatchValidationError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// The parameter of the request which caused the error, if any.
+	Param string `json:"param,omitempty"`
+	// The number of the line of the input file, zero if the error isn't specific to the line.
+	Line int `json:"line,omitempty"`
+}
+
+type BatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+type CreateBatchOptions struct {
+	// The ID of the JSONL file of the requests, uploaded with FilePurposeBatch.
+	InputFileId string `json:"input_file_id" binding:"required"`
+	// The endpoint of the requests, e.g. "/v1/chat/completions".
+	Endpoint string `json:"endpoint" binding:"required"`
+	// The time frame the batch is processed within, BatchCompletionWindow24h.
+	CompletionWindow string `json:"completion_window" binding:"required"`
+	// Set of up to 16 key-value pairs attached to the batch.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// CreateBatch creates the batch of the requests of the uploaded input file.
+//
+// Docs: https://platform.openai.com/docs/api-reference/batch/create
+func (e *Engine) CreateBatch(ctx context.Context, opts *CreateBatchOptions) (*Batch, error) {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	uri := e.apiBaseURL + "/batches"
+	ctx = withRequestInfo(ctx, "/batches", "")
+	var batch Batch
+	if err := e.sendJSON(ctx, http.MethodPost, uri, opts, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// RetrieveBatch returns the batch, e.g. to poll its status.
+//
+// Docs: https://platform.openai.com/docs/api-reference/batch/retrieve
+func (e *Engine) RetrieveBatch(ctx context.Context, batchId string) (*Batch, error) {
+	uri := e.apiBaseURL + "/batches/" + url.PathEscape(batchId)
+	ctx = withRequestInfo(ctx, "/batches/{batch_id}", "")
+	var batch Batch
+	if err := e.sendJSON(ctx, http.MethodGet, uri, nil, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+type ListBatchesOptions struct {
+	ListOptions
+	// Only return the batches of the status, e.g. BatchInProgress. The API doesn't filter the batches,
+	// the ones of other statuses are dropped from the page, so it may have fewer batches than Limit.
+	Status string
+}
+
+// ListBatches returns the page of batches of the organization, the most recent first.
+//
+// Docs: https://platform.openai.com/docs/api-reference/batch/list
+func (e *Engine) ListBatches(ctx context.Context, opts *ListBatchesOptions) (*Page[Batch], error) {
+	if opts == nil {
+		opts = &ListBatchesOptions{}
+	}
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	uri := withQuery(e.apiBaseURL+"/batches", opts.ListOptions.query())
+	ctx = withRequestInfo(ctx, "/batches", "")
+	var page Page[Batch]
+	if err := e.sendJSON(ctx, http.MethodGet, uri, nil, &page); err != nil {
+		return nil, err
+	}
+	if opts.Status != "" {
+		// The cursors of the page are kept, so the pagination isn't affected
+		batches := page.Data[:0]
+		for _, b := range page.Data {
+			if b.Status == opts.Status {
+				batches = append(batches, b)
+			}
+		}
+		page.Data = batches
+	}
+	return &page, nil
+}
+
+// AllBatches iterates over the batches of all pages, starting with the page of opts.
+func (e *Engine) AllBatches(ctx context.Context, opts *ListBatchesOptions) iter.Seq2[Batch, error] {
+	var o ListBatchesOptions
+	if opts != nil {
+		o = *opts
+	}
+	return paginate(ctx, o.After, func(ctx context.Context, after string) (*Page[Batch], error) {
+		o.After = after
+		return e.ListBatches(ctx, &o)
+	})
+}
+
+// CancelBatch cancels the batch in progress. Its status is BatchCancelling until the requests
+// in flight are finished, then BatchCancelled, and the results of the finished requests are
+// written to the output file.
+//
+// Docs: https://platform.openai.com/docs/api-reference/batch/cancel
+func (e *Engine) CancelBatch(ctx context.Context, batchId string) (*Batch, error) {
+	uri := e.apiBaseURL + "/batches/" + url.PathEscape(batchId) + "/cancel"
+	ctx = withRequestInfo(ctx, "/batches/{batch_id}/cancel", "")
+	var batch Batch
+	if err := e.sendJSON(ctx, http.MethodPost, uri, nil, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// batchRequest is the line of the batch input file.
+type batchRequest struct {
+	CustomId string                 `json:"custom_id"`
+	Method   string                 `json:"method"`
+	URL      string                 `json:"url"`
+	Body     *ChatCompletionOptions `json:"body"`
+}
+
+// SubmitBatch is used to submit the chat completion requests as the batch: they are written
+// to the JSONL input file, which is streamed to UploadFile as it's written, without the temporary
+// file, and the batch of the file is created. The requests are validated, translated and sanitized
+// like the ones of ChatCompletion before the upload. The result of every request is identified
+// by its CustomId, "req-<index>" by default, which must be unique.
+//
+// The completion window is BatchCompletionWindow24h if it's empty. The uploaded file is deleted
+// if the batch can't be created, so no input file is left behind by the failed submission.
+//
+// The input file is streamed in chunks unless it fits into the multipart buffer of the engine,
+// see SetMultipartBufferSize, so the upload bigger than the buffer isn't retried.
+func (e *Engine) SubmitBatch(ctx context.Context, requests []*ChatCompletionOptions, completionWindow string, metadata map[string]string) (*Batch, error) {
+	if len(requests) == 0 {
+		return nil, errors.New("submit batch: no requests")
+	}
+	if completionWindow == "" {
+		completionWindow = BatchCompletionWindow24h
+	}
+	lines := make([]batchRequest, len(requests))
+	ids := make(map[string]int, len(requests))
+	for i, opts := range requests {
+		body, err := e.chatCompletionBody(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("request %d: %w", i, err)
+		}
+		id := opts.CustomId
+		if id == "" {
+			id = "req-" + strconv.Itoa(i)
+		}
+		if j, ok := ids[id]; ok {
+			return nil, fmt.Errorf("request %d: custom ID %q of request %d isn't unique", i, id, j)
+		}
+		ids[id] = i
+		lines[i] = batchRequest{CustomId: id, Method: http.MethodPost, URL: "/v1/chat/completions", Body: body}
+	}
+
+	pr, pw := io.Pipe()
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		enc := json.NewEncoder(pw)
+		for i := range lines {
+			if err := enc.Encode(&lines[i]); err != nil {
+				pw.CloseWithError(fmt.Errorf("write request %d: %w", i, err))
+				return
+			}
+		}
+		pw.Close()
+	}()
+	file, err := e.UploadFile(ctx, &UploadFileOptions{File: pr, Filename: "batch.jsonl", Purpose: FilePurposeBatch})
+	// The writer is stopped if the upload failed before the file was read to the end
+	pr.CloseWithError(errors.New("submit batch: upload finished"))
+	<-written
+	if err != nil {
+		return nil, fmt.Errorf("upload batch input file: %w", err)
+	}
+	batch, err := e.CreateBatch(ctx, &CreateBatchOptions{
+		InputFileId:      file.Id,
+		Endpoint:         "/v1/chat/completions",
+		CompletionWindow: completionWindow,
+		Metadata:         metadata,
+	})
+	if err != nil {
+		if _, deleteErr := e.DeleteFile(context.WithoutCancel(ctx), file.Id); deleteErr != nil {
+			return nil, fmt.Errorf("create batch: %w (delete input file %s: %v)", err, file.Id, deleteErr)
+		}
+		return nil, fmt.Errorf("create batch: %w", err)
+	}
+	return batch, nil
+}
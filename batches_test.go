@@ -0,0 +1,171 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBatchServer serves the upload of the batch input file, the creation of the batch and
+// the deletion of the file. The creation fails with status if it's set.
+func newBatchServer(t *testing.T, status int) (*Engine, *[]string, *bytes.Buffer) {
+	var (
+		calls []string
+		input bytes.Buffer
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/files":
+			file, header, err := r.FormFile("file")
+			require.NoError(t, err)
+			assert.Equal(t, FilePurposeBatch, r.FormValue("purpose"))
+			assert.Equal(t, "batch.jsonl", header.Filename)
+			n, err := io.Copy(&input, file)
+			require.NoError(t, err)
+			json.NewEncoder(w).Encode(File{Id: "file-1", Object: "file", Bytes: n, Purpose: FilePurposeBatch})
+		case r.Method == http.MethodPost && r.URL.Path == "/batches":
+			if status != 0 {
+				w.WriteHeader(status)
+				w.Write([]byte(`{"error":{"message":"invalid input file","type":"invalid_request_error"}}`))
+				return
+			}
+			var opts CreateBatchOptions
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&opts))
+			json.NewEncoder(w).Encode(Batch{Id: "batch_1", Object: "batch", Endpoint: opts.Endpoint, InputFileId: opts.InputFileId,
+				CompletionWindow: opts.CompletionWindow, Status: BatchValidating, Metadata: opts.Metadata})
+		case r.Method == http.MethodDelete && r.URL.Path == "/files/file-1":
+			w.Write([]byte(`{"id":"file-1","object":"file","deleted":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	return e, &calls, &input
+}
+
+func TestSubmitBatch(t *testing.T) {
+	e, calls, input := newBatchServer(t, 0)
+	e.SetMultipartBufferSize(0)
+	requests := []*ChatCompletionOptions{testChatOptions(), testChatOptions(), testChatOptions()}
+	requests[1].CustomId = "greeting"
+	requests[2].MaxTokens = 64
+
+	batch, err := e.SubmitBatch(context.Background(), requests, "", map[string]string{"job": "nightly"})
+	require.NoError(t, err)
+	assert.Equal(t, &Batch{Id: "batch_1", Object: "batch", Endpoint: "/v1/chat/completions", InputFileId: "file-1",
+		CompletionWindow: BatchCompletionWindow24h, Status: BatchValidating, Metadata: map[string]string{"job": "nightly"}}, batch)
+	assert.Equal(t, []string{"POST /files", "POST /batches"}, *calls)
+
+	lines := strings.Split(strings.TrimSpace(input.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.JSONEq(t, `{"custom_id":"req-0","method":"POST","url":"/v1/chat/completions",
+		"body":{"model":"gpt-3.5-turbo","max_tokens":1024,"messages":[{"role":"user","content":"hello"}]}}`, lines[0])
+	assert.Contains(t, lines[1], `"custom_id":"greeting"`)
+	assert.Contains(t, lines[2], `"custom_id":"req-2"`)
+	assert.Contains(t, lines[2], `"max_tokens":64`)
+	assert.Empty(t, requests[0].CustomId, "the requests aren't modified")
+	assert.Zero(t, requests[0].MaxTokens)
+}
+
+func TestSubmitBatchDeletesInputFile(t *testing.T) {
+	e, calls, _ := newBatchServer(t, http.StatusBadRequest)
+	_, err := e.SubmitBatch(context.Background(), []*ChatCompletionOptions{testChatOptions()}, BatchCompletionWindow24h, nil)
+	var apiErr APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "invalid input file", apiErr.Err.Message)
+	assert.Equal(t, []string{"POST /files", "POST /batches", "DELETE /files/file-1"}, *calls)
+}
+
+func TestSubmitBatchInvalidRequests(t *testing.T) {
+	e, calls, _ := newBatchServer(t, 0)
+	duplicate := testChatOptions()
+	duplicate.CustomId = "req-0"
+	_, err := e.SubmitBatch(context.Background(), []*ChatCompletionOptions{testChatOptions(), duplicate}, "", nil)
+	assert.EqualError(t, err, `request 1: custom ID "req-0" of request 0 isn't unique`)
+	_, err = e.SubmitBatch(context.Background(), []*ChatCompletionOptions{testChatOptions(), {Model: "gpt-4o"}}, "", nil)
+	assert.ErrorContains(t, err, "request 1: ")
+	_, err = e.SubmitBatch(context.Background(), nil, "", nil)
+	assert.Error(t, err)
+	assert.Empty(t, *calls, "nothing is uploaded")
+}
+
+const testBatches = `[
+	{"id":"batch_3","object":"batch","endpoint":"/v1/chat/completions","errors":null,"input_file_id":"file-3","completion_window":"24h",
+		"status":"in_progress","created_at":1714508499,"in_progress_at":1714508500,"expires_at":1714594899,
+		"request_counts":{"total":100,"completed":40,"failed":1},"metadata":{"job":"nightly"}},
+	{"id":"batch_2","object":"batch","endpoint":"/v1/chat/completions","input_file_id":"file-2","completion_window":"24h",
+		"status":"failed","created_at":1714508400,"failed_at":1714508410,
+		"errors":{"object":"list","data":[{"code":"invalid_json_line","message":"This line is not parseable as valid JSON.","line":3}]},
+		"request_counts":{"total":0,"completed":0,"failed":0}},
+	{"id":"batch_1","object":"batch","endpoint":"/v1/chat/completions","input_file_id":"file-1","completion_window":"24h",
+		"status":"in_progress","created_at":1714508300,"in_progress_at":1714508301,"request_counts":{"total":10,"completed":0,"failed":0}}
+]`
+
+func TestListBatches(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/batches", r.URL.Path)
+		queries = append(queries, r.URL.RawQuery)
+		var batches []json.RawMessage
+		require.NoError(t, json.Unmarshal([]byte(testBatches), &batches))
+		page := Page[json.RawMessage]{Object: "list", Data: batches[:2], FirstId: "batch_3", LastId: "batch_2", HasMore: true}
+		if r.URL.Query().Get("after") == "batch_2" {
+			page = Page[json.RawMessage]{Object: "list", Data: batches[2:], FirstId: "batch_1", LastId: "batch_1"}
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	page, err := e.ListBatches(context.Background(), &ListBatchesOptions{ListOptions: ListOptions{Limit: 2}})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 2)
+	assert.Equal(t, Batch{Id: "batch_2", Object: "batch", Endpoint: "/v1/chat/completions", InputFileId: "file-2",
+		CompletionWindow: BatchCompletionWindow24h, Status: BatchFailed, CreatedAt: 1714508400, FailedAt: 1714508410,
+		Errors: &BatchErrors{Object: "list", Data: []BatchValidationError{{Code: "invalid_json_line", Message: "This line is not parseable as valid JSON.", Line: 3}}},
+	}, page.Data[1])
+	assert.Nil(t, page.Data[0].Errors)
+	assert.Equal(t, BatchRequestCounts{Total: 100, Completed: 40, Failed: 1}, page.Data[0].RequestCounts)
+	assert.Equal(t, int64(1714508500), page.Data[0].InProgressAt)
+
+	var ids []string
+	for b, err := range e.AllBatches(context.Background(), &ListBatchesOptions{Status: BatchInProgress}) {
+		require.NoError(t, err)
+		ids = append(ids, b.Id)
+	}
+	assert.Equal(t, []string{"batch_3", "batch_1"}, ids, "the batches are filtered by status")
+	assert.Equal(t, []string{"limit=2", "", "after=batch_2"}, queries)
+}
+
+func TestCancelBatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/batches/batch_1/cancel", r.URL.Path)
+		w.Write([]byte(`{"id":"batch_1","object":"batch","status":"cancelling","created_at":1714508300,"cancelling_at":1714508500,
+			"request_counts":{"total":10,"completed":2,"failed":0}}`))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	batch, err := e.CancelBatch(context.Background(), "batch_1")
+	require.NoError(t, err)
+	assert.Equal(t, BatchCancelling, batch.Status)
+	assert.Equal(t, int64(1714508500), batch.CancellingAt)
+	assert.Zero(t, batch.CancelledAt)
+}
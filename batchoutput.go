@@ -0,0 +1,199 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxBatchLineSize is the maximum size of the line of the batch output file.
+const maxBatchLineSize = 16 << 20
+
+// BatchOutputLine is the result of a single request of the batch.
+type BatchOutputLine struct {
+	Id string `json:"id"`
+	// The ID of the request set by the caller in the input file.
+	CustomId string `json:"custom_id"`
+	// The response of the request, set if the server has responded, even with an error status code.
+	Response *BatchResponse `json:"response"`
+	// The error of the request, set if it failed without a response.
+	Error *BatchError `json:"error"`
+}
+
+// BatchResponse is the response to the request of the batch.
+type BatchResponse struct {
+	StatusCode int    `json:"status_code"`
+	RequestId  string `json:"request_id"`
+	// The body of the response, e.g. ChatCompletionResponse for the chat completion request.
+	Body json.RawMessage `json:"body"`
+}
+
+// Decode is used to unmarshal the body of the response into v.
+func (r *BatchResponse) Decode(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// BatchError is the error of the request of the batch which failed without a response.
+type BatchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch request failed: %s: %s", e.Code, e.Message)
+}
+
+// BatchLineError is returned by BatchOutputIterator.Response for the line which can't be decoded.
+type BatchLineError struct {
+	// The number of the line, starting from 1.
+	Line int
+	Err  error
+}
+
+func (e *BatchLineError) Error() string {
+	return fmt.Sprintf("decode line %d: %v", e.Line, e.Err)
+}
+
+func (e *BatchLineError) Unwrap() error {
+	return e.Err
+}
+
+// BatchOutputIterator reads the batch output file line by line, so the file isn't loaded into memory.
+type BatchOutputIterator struct {
+	sc      *bufio.Scanner
+	n       int
+	line    *BatchOutputLine
+	lineErr error
+}
+
+// ParseBatchOutputFile is used to iterate over the results of the batch output file in the NDJSON
+// format. Blank lines are skipped, malformed lines are returned by Response as BatchLineError
+// without stopping the iteration:
+//
+//	it, err := openai.ParseBatchOutputFile(r)
+//	...
+//	for it.Next() {
+//		line, err := it.Response()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+func ParseBatchOutputFile(r io.Reader) (*BatchOutputIterator, error) {
+	if r == nil {
+		return nil, errors.New("batch output file reader is nil")
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, maxBatchLineSize)
+	return &BatchOutputIterator{sc: sc}, nil
+}
+
+// Next advances the iterator to the next line, it returns false once the file is read to the end
+// or reading fails, see Err.
+func (it *BatchOutputIterator) Next() bool {
+	for it.sc.Scan() {
+		it.n++
+		b := bytes.TrimSpace(it.sc.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		var line BatchOutputLine
+		if err := json.Unmarshal(b, &line); err != nil {
+			it.line, it.lineErr = nil, &BatchLineError{Line: it.n, Err: err}
+		} else {
+			it.line, it.lineErr = &line, nil
+		}
+		return true
+	}
+	it.line, it.lineErr = nil, nil
+	return false
+}
+
+// Response returns the result of the current line, or BatchLineError if the line is malformed.
+func (it *BatchOutputIterator) Response() (*BatchOutputLine, error) {
+	return it.line, it.lineErr
+}
+
+// Err returns the error which stopped the iteration, it's nil if the file was read to the end.
+func (it *BatchOutputIterator) Err() error {
+	return it.sc.Err()
+}
+
+// BatchRequestError is the error of the request of the batch, a line of the batch error file.
+type BatchRequestError struct {
+	Id string
+	// The ID of the request set by the caller in the input file, see ChatCompletionOptions.CustomId.
+	CustomId string
+	// The status code of the error response, zero if the request failed without a response.
+	StatusCode int
+	// The code of the error, e.g. "invalid_request_error", or the type of the error response
+	// if it has no code.
+	Code    string
+	Message string
+}
+
+func (e *BatchRequestError) Error() string {
+	return fmt.Sprintf("batch request %s failed: %s: %s", e.CustomId, e.Code, e.Message)
+}
+
+// DownloadBatchErrors is used to download the error file of the batch and parse the errors of its
+// failed requests, in the order of the file. Match them with the requests by CustomId. It returns
+// no errors if the batch has no error file, e.g. if it isn't completed yet or all requests succeeded.
+// The malformed line of the file is returned as BatchLineError.
+func DownloadBatchErrors(ctx context.Context, engine *Engine, batchId string) ([]*BatchRequestError, error) {
+	batch, err := engine.RetrieveBatch(ctx, batchId)
+	if err != nil {
+		return nil, err
+	}
+	if batch.ErrorFileId == "" {
+		return nil, nil
+	}
+	content, err := engine.RetrieveFileContent(ctx, batch.ErrorFileId)
+	if err != nil {
+		return nil, fmt.Errorf("download error file %s: %w", batch.ErrorFileId, err)
+	}
+	defer content.Close()
+	it, err := ParseBatchOutputFile(content)
+	if err != nil {
+		return nil, err
+	}
+	var errs []*BatchRequestError
+	for it.Next() {
+		line, err := it.Response()
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, newBatchRequestError(line))
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("read error file %s: %w", batch.ErrorFileId, contextError(ctx, err))
+	}
+	return errs, nil
+}
+
+// newBatchRequestError returns the error of the line of the error file, which has the error
+// response or the error of the request which failed without a response.
+func newBatchRequestError(line *BatchOutputLine) *BatchRequestError {
+	reqErr := &BatchRequestError{Id: line.Id, CustomId: line.CustomId}
+	switch {
+	case line.Error != nil:
+		reqErr.Code, reqErr.Message = line.Error.Code, line.Error.Message
+	case line.Response != nil:
+		reqErr.StatusCode = line.Response.StatusCode
+		var apiErr APIError
+		if err := line.Response.Decode(&apiErr); err == nil {
+			reqErr.Code, reqErr.Message = apiErr.Err.Code, apiErr.Err.Message
+			if reqErr.Code == "" {
+				reqErr.Code = apiErr.Err.Type
+			}
+		}
+	}
+	return reqErr
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const batchOutput = `{"id":"batch_req_1","custom_id":"request-1","response":{"status_code":200,"request_id":"req_1","body":{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"}}]}},"error":null}
+
+{"id":"batch_req_2","custom_id":"request-2",
+{"id":"batch_req_3","custom_id":"request-3","response":null,"error":{"code":"batch_expired","message":"This request could not be executed before the completion window expired."}}
+`
+
+func TestParseBatchOutputFile(t *testing.T) {
+	it, err := ParseBatchOutputFile(strings.NewReader(batchOutput))
+	require.NoError(t, err)
+
+	require.True(t, it.Next())
+	line, err := it.Response()
+	require.NoError(t, err)
+	assert.Equal(t, "request-1", line.CustomId)
+	require.NotNil(t, line.Response)
+	assert.Equal(t, 200, line.Response.StatusCode)
+	var resp ChatCompletionResponse
+	require.NoError(t, line.Response.Decode(&resp))
+	assert.Equal(t, "hi", resp.Choices[0].Message.Content)
+	assert.Nil(t, line.Error)
+
+	require.True(t, it.Next(), "malformed line must not stop the iteration")
+	line, err = it.Response()
+	assert.Nil(t, line)
+	var lineErr *BatchLineError
+	require.True(t, errors.As(err, &lineErr))
+	assert.Equal(t, 3, lineErr.Line, "blank lines are counted")
+
+	require.True(t, it.Next())
+	line, err = it.Response()
+	require.NoError(t, err)
+	assert.Equal(t, "request-3", line.CustomId)
+	assert.Nil(t, line.Response)
+	require.NotNil(t, line.Error)
+	assert.Equal(t, "batch_expired", line.Error.Code)
+
+	assert.False(t, it.Next())
+	assert.NoError(t, it.Err())
+}
+
+func TestParseBatchOutputFileTooLongLine(t *testing.T) {
+	it, err := ParseBatchOutputFile(strings.NewReader(`{"id":"` + strings.Repeat("a", maxBatchLineSize) + `"}`))
+	require.NoError(t, err)
+	assert.False(t, it.Next())
+	assert.ErrorIs(t, it.Err(), bufio.ErrTooLong)
+
+	_, err = ParseBatchOutputFile(nil)
+	assert.Error(t, err)
+}
+
+func TestDownloadBatchErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/batches/batch_1":
+			w.Write([]byte(`{"id":"batch_1","object":"batch","status":"completed","output_file_id":"file-out","error_file_id":"file-err"}`))
+		case "/batches/batch_2":
+			w.Write([]byte(`{"id":"batch_2","object":"batch","status":"completed","output_file_id":"file-out"}`))
+		case "/files/file-err/content":
+			w.Write([]byte(`{"id":"batch_req_1","custom_id":"req-1","response":{"status_code":400,"request_id":"req_abc",` +
+				`"body":{"error":{"message":"Invalid 'messages': empty array.","type":"invalid_request_error","param":"messages","code":null}}},"error":null}` + "\n" +
+				"\n" +
+				`{"id":"batch_req_2","custom_id":"greeting","response":{"status_code":429,"request_id":"req_def",` +
+				`"body":{"error":{"message":"Rate limit reached.","type":"requests","code":"rate_limit_exceeded"}}},"error":null}` + "\n" +
+				`{"id":"batch_req_3","custom_id":"req-5","response":null,"error":{"code":"batch_expired","message":"This request could not be executed before the completion window expired."}}` + "\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(notFoundBody))
+		}
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	errs, err := DownloadBatchErrors(context.Background(), e, "batch_1")
+	require.NoError(t, err)
+	assert.Equal(t, []*BatchRequestError{
+		{Id: "batch_req_1", CustomId: "req-1", StatusCode: 400, Code: "invalid_request_error", Message: "Invalid 'messages': empty array."},
+		{Id: "batch_req_2", CustomId: "greeting", StatusCode: 429, Code: "rate_limit_exceeded", Message: "Rate limit reached."},
+		{Id: "batch_req_3", CustomId: "req-5", Code: "batch_expired", Message: "This request could not be executed before the completion window expired."},
+	}, errs)
+	assert.EqualError(t, errs[1], "batch request greeting failed: rate_limit_exceeded: Rate limit reached.")
+
+	errs, err = DownloadBatchErrors(context.Background(), e, "batch_2")
+	require.NoError(t, err)
+	assert.Empty(t, errs, "the batch has no error file")
+
+	_, err = DownloadBatchErrors(context.Background(), e, "batch_3")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+// ErrNoLogprobs is returned by MeanLogprob if the choice has no log probabilities,
+// set ChatCompletionOptions.Logprobs to request them.
+var ErrNoLogprobs = errors.New("openai: choice has no logprobs")
+
+// ChoiceScorer scores the choice of the chat completion, the higher the score the better the choice.
+type ChoiceScorer interface {
+	Score(choice *ChatCompletionChoice) (float64, error)
+}
+
+// ChoiceScorerFunc is the function used as ChoiceScorer.
+type ChoiceScorerFunc func(choice *ChatCompletionChoice) (float64, error)
+
+func (f ChoiceScorerFunc) Score(choice *ChatCompletionChoice) (float64, error) {
+	return f(choice)
+}
+
+// Built-in scorers of the choices.
+var (
+	// MeanLogprob scores the choice by the mean log probability of its content tokens, the model
+	// is the most confident in the choice of the highest mean. The choice of zero tokens scores
+	// -Inf, the lowest possible score. It returns ErrNoLogprobs if the choice has no log probabilities.
+	MeanLogprob ChoiceScorer = ChoiceScorerFunc(meanLogprob)
+	// LongestComplete prefers the choices the model completed, of the "stop" finish reason,
+	// over the others, e.g. cut off at max_tokens with "length". The longer content is preferred
+	// among the choices of the same kind.
+	LongestComplete = TieBreak(ChoiceScorerFunc(completeScore), ChoiceScorerFunc(contentLength))
+)
+
+func meanLogprob(choice *ChatCompletionChoice) (float64, error) {
+	if choice.Logprobs == nil {
+		return 0, ErrNoLogprobs
+	}
+	tokens := choice.Logprobs.Content
+	if len(tokens) == 0 {
+		return math.Inf(-1), nil
+	}
+	var sum float64
+	for _, t := range tokens {
+		if math.IsNaN(t.Logprob) {
+			return 0, fmt.Errorf("logprob of token %q is NaN", t.Token)
+		}
+		sum += t.Logprob
+	}
+	return sum / float64(len(tokens)), nil
+}
+
+func completeScore(choice *ChatCompletionChoice) (float64, error) {
+	if choice.FinishReason == "stop" {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func contentLength(choice *ChatCompletionChoice) (float64, error) {
+	return float64(utf8.RuneCountInString(choice.Message.Content)), nil
+}
+
+// TieBreak returns the scorer which scores the choices by the first scorer, and breaks the ties
+// by the next scorers in order, e.g. TieBreak(MeanLogprob, LongestComplete). Score returns
+// the score of the first scorer, the tie-breakers only apply to SelectChoice.
+func TieBreak(scorers ...ChoiceScorer) ChoiceScorer {
+	var flat tieBreakScorer
+	for _, s := range scorers {
+		if t, ok := s.(tieBreakScorer); ok {
+			flat = append(flat, t...)
+			continue
+		}
+		flat = append(flat, s)
+	}
+	return flat
+}
+
+type tieBreakScorer []ChoiceScorer
+
+func (t tieBreakScorer) Score(choice *ChatCompletionChoice) (float64, error) {
+	if len(t) == 0 {
+		return 0, nil
+	}
+	return t[0].Score(choice)
+}
+
+// scores returns the scores of the choice by scorer and its tie-breakers.
+func scores(scorer ChoiceScorer, choice *ChatCompletionChoice) ([]float64, error) {
+	scorers, ok := scorer.(tieBreakScorer)
+	if !ok {
+		scorers = tieBreakScorer{scorer}
+	}
+	scores := make([]float64, len(scorers))
+	for i, s := range scorers {
+		score, err := s.Score(choice)
+		if err != nil {
+			return nil, err
+		}
+		if math.IsNaN(score) {
+			return nil, errors.New("score is NaN")
+		}
+		scores[i] = score
+	}
+	return scores, nil
+}
+
+// SelectChoice returns the choice of resp of the highest score by scorer. The ties are broken
+// by the tie-breakers of TieBreak, and then by the order of the choices. It returns the error
+// of the scorer, if any, or the error if resp has no choices.
+func SelectChoice(resp *ChatCompletionResponse, scorer ChoiceScorer) (*ChatCompletionChoice, error) {
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("select choice: no choices")
+	}
+	var (
+		best       *ChatCompletionChoice
+		bestScores []float64
+	)
+	for i := range resp.Choices {
+		choice := &resp.Choices[i]
+		s, err := scores(scorer, choice)
+		if err != nil {
+			return nil, fmt.Errorf("score choice %d: %w", choice.Index, err)
+		}
+		if best == nil || better(s, bestScores) {
+			best, bestScores = choice, s
+		}
+	}
+	return best, nil
+}
+
+// better reports whether the scores a are lexicographically greater than b.
+func better(a, b []float64) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] > b[i]
+		}
+	}
+	return false
+}
+
+// ChatCompletionBestOf is used to request n choices of the chat completion in one request, and
+// select the best one of them by scorer, see SelectChoice. The response with all the choices is
+// returned along with the best one, e.g. to log the candidates. Set opts.Logprobs for the scorers
+// of the log probabilities, e.g. MeanLogprob. opts isn't modified.
+func (e *Engine) ChatCompletionBestOf(ctx context.Context, opts *ChatCompletionOptions, n int, scorer ChoiceScorer) (*ChatCompletionChoice, *ChatCompletionResponse, error) {
+	if n < 1 {
+		return nil, nil, fmt.Errorf("best of %d: n must be positive", n)
+	}
+	req := *opts
+	req.N = n
+	resp, err := e.ChatCompletion(ctx, &req)
+	if err != nil {
+		return nil, resp, err
+	}
+	best, err := SelectChoice(resp, scorer)
+	return best, resp, err
+}
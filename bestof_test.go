@@ -0,0 +1,114 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bestOfResponse has the choices ranked differently by the scorers: the longest complete one
+// is the least confident, the most confident one is short, the longest one is cut off, and
+// the last one has no tokens.
+const bestOfResponse = `{"id":"chatcmpl-1","choices":[
+	{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"Paris is the capital of France."},
+	 "logprobs":{"content":[{"token":"Paris","logprob":-1},{"token":" is","logprob":-2},{"token":" the capital.","logprob":-1.5}]}},
+	{"index":1,"finish_reason":"stop","message":{"role":"assistant","content":"Paris."},
+	 "logprobs":{"content":[{"token":"Paris","logprob":-0.1},{"token":".","logprob":-0.1}]}},
+	{"index":2,"finish_reason":"length","message":{"role":"assistant","content":"The capital of France is, of course, the"},
+	 "logprobs":{"content":[{"token":"The","logprob":-0.5},{"token":" capital","logprob":-0.5}]}},
+	{"index":3,"finish_reason":"stop","message":{"role":"assistant","content":""},"logprobs":{"content":[]}}
+]}`
+
+func bestOfFixture(t *testing.T) *ChatCompletionResponse {
+	var resp ChatCompletionResponse
+	require.NoError(t, json.Unmarshal([]byte(bestOfResponse), &resp))
+	return &resp
+}
+
+func TestSelectChoice(t *testing.T) {
+	constant := ChoiceScorerFunc(func(*ChatCompletionChoice) (float64, error) { return 0, nil })
+	for _, tt := range []struct {
+		name   string
+		scorer ChoiceScorer
+		want   int
+	}{
+		{name: "mean logprob", scorer: MeanLogprob, want: 1},
+		{name: "longest complete", scorer: LongestComplete, want: 0},
+		{name: "tie-breakers in order", scorer: TieBreak(constant, LongestComplete), want: 0},
+		{name: "ties by order", scorer: constant, want: 0},
+		{name: "complete then confident", scorer: TieBreak(ChoiceScorerFunc(completeScore), MeanLogprob), want: 1},
+		{name: "confident then longest", scorer: TieBreak(ChoiceScorerFunc(func(c *ChatCompletionChoice) (float64, error) {
+			// Rounded down, the confident choices tie
+			score, err := meanLogprob(c)
+			return math.Floor(score), err
+		}), ChoiceScorerFunc(contentLength)), want: 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := bestOfFixture(t)
+			choice, err := SelectChoice(resp, tt.scorer)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, choice.Index)
+			assert.Same(t, &resp.Choices[tt.want], choice)
+		})
+	}
+}
+
+func TestMeanLogprob(t *testing.T) {
+	resp := bestOfFixture(t)
+	score, err := MeanLogprob.Score(&resp.Choices[0])
+	require.NoError(t, err)
+	assert.InDelta(t, -1.5, score, 1e-9)
+	score, err = MeanLogprob.Score(&resp.Choices[3])
+	require.NoError(t, err)
+	assert.True(t, math.IsInf(score, -1), "the choice of zero tokens scores the lowest")
+	assert.False(t, math.IsNaN(score))
+
+	resp.Choices[1].Logprobs = nil
+	_, err = SelectChoice(resp, MeanLogprob)
+	assert.True(t, errors.Is(err, ErrNoLogprobs), "unexpected error: %v", err)
+	assert.ErrorContains(t, err, "score choice 1")
+
+	resp.Choices[0].Logprobs.Content[0].Logprob = math.NaN()
+	_, err = MeanLogprob.Score(&resp.Choices[0])
+	assert.ErrorContains(t, err, "NaN")
+
+	_, err = SelectChoice(&ChatCompletionResponse{}, MeanLogprob)
+	assert.Error(t, err)
+}
+
+func TestChatCompletionBestOf(t *testing.T) {
+	var requests []map[string]interface{}
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		requests = append(requests, body)
+		w.Write([]byte(bestOfResponse))
+	})
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	opts := testChatOptions()
+	opts.Logprobs = true
+	best, resp, err := e.ChatCompletionBestOf(context.Background(), opts, 4, MeanLogprob)
+	require.NoError(t, err)
+	assert.Equal(t, "Paris.", best.Message.Content)
+	assert.Len(t, resp.Choices, 4, "all the candidates are returned")
+	assert.Zero(t, opts.N, "the options must not be modified")
+
+	require.Len(t, requests, 1)
+	assert.EqualValues(t, 4, requests[0]["n"])
+	assert.Equal(t, true, requests[0]["logprobs"])
+
+	_, _, err = e.ChatCompletionBestOf(context.Background(), opts, 0, MeanLogprob)
+	assert.Error(t, err)
+	assert.Len(t, requests, 1)
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultLatencyBudgetFloor is the minimum remaining budget to start the attempt with.
+const defaultLatencyBudgetFloor = time.Second
+
+// ErrLatencyBudgetExhausted is matched by *LatencyBudgetError.
+var ErrLatencyBudgetExhausted = errors.New("openai: latency budget exhausted")
+
+// WithLatencyBudget is used to set the latency budget of every request: the total duration of
+// its attempts and the backoff sleeps between them. Every attempt times out once the remaining
+// budget is spent, except for the time reserved for the backoff and the attempt after it, if
+// it may be retried, so the timeout of the attempts shrinks as the budget is consumed. The request
+// isn't retried if less than the floor of the budget would remain after the backoff, see
+// WithLatencyBudgetFloor, and *LatencyBudgetError is returned then.
+//
+// The budget and the timeouts of the attempts are measured by the clock of the engine, see
+// WithClock. The deadline of the context of the request applies as well, the tighter of them
+// limits the attempts.
+func WithLatencyBudget(budget time.Duration) EngineOption {
+	return func(e *Engine) {
+		e.latencyBudget = budget
+	}
+}
+
+// WithLatencyBudgetFloor is used to set the minimum remaining latency budget the attempt of
+// the request is started with, 1 second by default, see WithLatencyBudget.
+func WithLatencyBudgetFloor(floor time.Duration) EngineOption {
+	return func(e *Engine) {
+		e.latencyBudgetFloor = floor
+	}
+}
+
+type latencyBudgetKey struct{}
+
+// ContextWithLatencyBudget returns the context which sets the latency budget of requests sent
+// with it, overriding the budget of the engine, see WithLatencyBudget.
+func ContextWithLatencyBudget(ctx context.Context, budget time.Duration) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, latencyBudgetKey{}, budget)
+}
+
+// AttemptTiming is the timing of the attempt of the request within its latency budget.
+type AttemptTiming struct {
+	// Start of the attempt since the start of the request.
+	Start    time.Duration
+	Duration time.Duration
+	// Timeout of the attempt derived from the remaining budget.
+	Timeout time.Duration
+	// StatusCode of the response, zero if the attempt failed without the response.
+	StatusCode int
+	// Err of the attempt, e.g. context.DeadlineExceeded if it timed out.
+	Err error
+}
+
+func (t AttemptTiming) String() string {
+	result := fmt.Sprint(t.StatusCode)
+	if t.Err != nil {
+		result = t.Err.Error()
+	}
+	return fmt.Sprintf("%s of %s: %s", t.Duration, t.Timeout, result)
+}
+
+// LatencyBudgetError is returned if the latency budget of the request ran out before the request
+// succeeded: the last attempt timed out, or the retry was skipped because it wouldn't fit into
+// the remaining budget. It unwraps to the error of the last attempt. The deadline of the context
+// of the request is reported by the context error instead.
+type LatencyBudgetError struct {
+	Budget   time.Duration
+	Attempts []AttemptTiming
+	Err      error
+}
+
+func (e *LatencyBudgetError) Error() string {
+	attempts := make([]string, len(e.Attempts))
+	for i, t := range e.Attempts {
+		attempts[i] = t.String()
+	}
+	return fmt.Sprintf("openai: latency budget of %s exhausted after %d attempts (%s): %v",
+		e.Budget, len(e.Attempts), strings.Join(attempts, ", "), e.Err)
+}
+
+func (e *LatencyBudgetError) Unwrap() error {
+	return e.Err
+}
+
+func (e *LatencyBudgetError) Is(target error) bool {
+	return target == ErrLatencyBudgetExhausted
+}
+
+// requestBudget tracks the latency budget of the request across its attempts.
+type requestBudget struct {
+	e        *Engine
+	total    time.Duration
+	floor    time.Duration
+	start    time.Time
+	attempts []AttemptTiming
+	// attemptCtx is the context of the current attempt, which times out with the budget.
+	attemptCtx context.Context
+}
+
+// newRequestBudget returns the budget of the request sent with ctx, or nil if there is none.
+func (e *Engine) newRequestBudget(ctx context.Context) *requestBudget {
+	total := e.latencyBudget
+	if d, ok := ctx.Value(latencyBudgetKey{}).(time.Duration); ok {
+		total = d
+	}
+	if total <= 0 {
+		return nil
+	}
+	floor := e.latencyBudgetFloor
+	if floor <= 0 {
+		floor = defaultLatencyBudgetFloor
+	}
+	return &requestBudget{e: e, total: total, floor: floor, start: e.clock.Now()}
+}
+
+// remaining returns the remaining budget, limited by the deadline of ctx.
+func (b *requestBudget) remaining(ctx context.Context) time.Duration {
+	remaining := b.total - b.e.clock.Now().Sub(b.start)
+	// The deadlines of contexts are in the wall time
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < remaining {
+		remaining = time.Until(deadline)
+	}
+	return remaining
+}
+
+// startAttempt returns attempt with the timeout of the remaining budget. If the attempt may be
+// retried, the backoff and the floor of the retry are reserved, as long as the floor remains.
+// The attempt times out on the clock of the engine.
+func (b *requestBudget) startAttempt(attempt *http.Request, n, maxRetries int) (*http.Request, context.CancelFunc) {
+	timeout := b.remaining(attempt.Context())
+	if n < maxRetries {
+		if reserve := b.e.backoff(n, nil) + b.floor; timeout-reserve >= b.floor {
+			timeout -= reserve
+		}
+	}
+	b.attempts = append(b.attempts, AttemptTiming{Start: b.e.clock.Now().Sub(b.start), Timeout: timeout})
+	ctx, cancel := withClockTimeout(attempt.Context(), b.e.clock, timeout)
+	b.attemptCtx = ctx
+	return attempt.WithContext(ctx), cancel
+}
+
+// endAttempt records the result of the attempt and returns its error, which wraps
+// context.DeadlineExceeded if the attempt timed out. The attempt context is canceled once
+// the body of resp is closed.
+func (b *requestBudget) endAttempt(resp *http.Response, err error, cancel context.CancelFunc) error {
+	if err != nil {
+		err = contextError(b.attemptCtx, err)
+	}
+	t := &b.attempts[len(b.attempts)-1]
+	t.Duration = b.e.clock.Now().Sub(b.start) - t.Start
+	t.Err = err
+	if resp == nil {
+		cancel()
+		return err
+	}
+	t.StatusCode = resp.StatusCode
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return err
+}
+
+// fits reports whether the retry after the backoff wait fits into the remaining budget.
+func (b *requestBudget) fits(ctx context.Context, wait time.Duration) bool {
+	return b.remaining(ctx)-wait >= b.floor
+}
+
+// timedOut reports whether the last attempt timed out with the budget, rather than with ctx.
+func (b *requestBudget) timedOut(ctx context.Context) bool {
+	return ctx.Err() == nil && errors.Is(doneReason(b.attemptCtx), context.DeadlineExceeded)
+}
+
+func (b *requestBudget) error(err error) error {
+	return &LatencyBudgetError{Budget: b.total, Attempts: b.attempts, Err: err}
+}
+
+// cancelOnClose cancels the context of the response when its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSlowServer responds with 503 after advancing clock by the latencies of the attempts in order.
+func newSlowServer(t *testing.T, clock *TestClock, latencies ...time.Duration) (*httptest.Server, *int32) {
+	var n int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(atomic.AddInt32(&n, 1)) - 1
+		clock.Advance(latencies[min(i, len(latencies)-1)])
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, `{"error":{"message":"overloaded"}}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &n
+}
+
+func TestLatencyBudgetAcrossAttempts(t *testing.T) {
+	clock := newAutoClock()
+	srv, n := newSlowServer(t, clock, 8*time.Second, 10*time.Second)
+	e := New("test", WithClock(clock), WithLatencyBudget(20*time.Second))
+	e.apiBaseURL = srv.URL
+	e.SetMaxRetries(5)
+
+	_, err := e.ListModels(context.Background())
+	var budgetErr *LatencyBudgetError
+	require.ErrorAs(t, err, &budgetErr)
+	assert.ErrorIs(t, err, ErrLatencyBudgetExhausted)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "the error of the last attempt is wrapped")
+	assert.EqualValues(t, 2, atomic.LoadInt32(n), "the third attempt wouldn't fit")
+	assert.Equal(t, 20*time.Second, budgetErr.Budget)
+	// The first attempt reserves the backoff of 500ms and the floor of 1s for the retry,
+	// the second one the backoff of 1s and the floor. The second attempt times out on the
+	// clock after 9.5s, then 1.5s remain, so the retry would start with 0.5s, below the floor.
+	require.Len(t, budgetErr.Attempts, 2)
+	assert.Equal(t, AttemptTiming{Start: 0, Duration: 8 * time.Second, Timeout: 18500 * time.Millisecond, StatusCode: http.StatusServiceUnavailable}, budgetErr.Attempts[0])
+	last := budgetErr.Attempts[1]
+	assert.Equal(t, 8500*time.Millisecond, last.Start)
+	assert.Equal(t, 9500*time.Millisecond, last.Timeout)
+	assert.ErrorIs(t, last.Err, context.DeadlineExceeded)
+	assert.Equal(t, []time.Duration{defaultRetryBaseDelay}, clock.Slept())
+	assert.Contains(t, err.Error(), "latency budget of 20s exhausted after 2 attempts (8s of 18.5s: 503, 10s of 9.5s: ")
+}
+
+func TestLatencyBudgetAttemptTimeoutOnClock(t *testing.T) {
+	clock := NewTestClock(time.Unix(0, 0))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The attempt times out in the middle of the request
+		clock.Advance(5 * time.Second)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+			t.Error("the attempt didn't time out on the clock")
+		}
+	}))
+	t.Cleanup(srv.Close)
+	e := New("test", WithClock(clock), WithLatencyBudget(5*time.Second))
+	e.apiBaseURL = srv.URL
+
+	start := time.Now()
+	_, err := e.ListModels(context.Background())
+	var budgetErr *LatencyBudgetError
+	require.ErrorAs(t, err, &budgetErr)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Len(t, budgetErr.Attempts, 1)
+	assert.Equal(t, 5*time.Second, budgetErr.Attempts[0].Timeout)
+	assert.Equal(t, 5*time.Second, budgetErr.Attempts[0].Duration)
+	assert.Less(t, time.Since(start), 5*time.Second, "the timeout doesn't wait for the wall clock")
+}
+
+func TestLatencyBudgetFloor(t *testing.T) {
+	clock := newAutoClock()
+	srv, n := newSlowServer(t, clock, 8*time.Second, 10*time.Second)
+	e := New("test", WithClock(clock), WithLatencyBudget(20*time.Second), WithLatencyBudgetFloor(100*time.Millisecond))
+	e.apiBaseURL = srv.URL
+	e.SetMaxRetries(5)
+
+	_, err := e.ListModels(context.Background())
+	var budgetErr *LatencyBudgetError
+	require.ErrorAs(t, err, &budgetErr)
+	assert.EqualValues(t, 3, atomic.LoadInt32(n), "the retry with 0.5s is above the floor")
+	require.Len(t, budgetErr.Attempts, 3)
+	assert.Equal(t, 500*time.Millisecond, budgetErr.Attempts[2].Timeout, "the last attempt gets the rest of the budget")
+}
+
+func TestLatencyBudgetAttemptTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+	e := New("test", WithLatencyBudgetFloor(time.Millisecond))
+	e.apiBaseURL = srv.URL
+
+	ctx := ContextWithLatencyBudget(context.Background(), 50*time.Millisecond)
+	_, err := e.ListModels(ctx)
+	var budgetErr *LatencyBudgetError
+	require.ErrorAs(t, err, &budgetErr)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Len(t, budgetErr.Attempts, 1)
+	assert.InDelta(t, 50*time.Millisecond, budgetErr.Attempts[0].Timeout, float64(5*time.Millisecond))
+	assert.GreaterOrEqual(t, budgetErr.Attempts[0].Duration, budgetErr.Attempts[0].Timeout)
+
+	// The deadline of the caller is reported as is
+	ctx, cancel := context.WithTimeout(ContextWithLatencyBudget(context.Background(), time.Minute), 50*time.Millisecond)
+	defer cancel()
+	_, err = e.ListModels(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.False(t, errors.Is(err, ErrLatencyBudgetExhausted), "unexpected error: %v", err)
+}
+
+func TestLatencyBudgetContextDeadline(t *testing.T) {
+	var deadlines []time.Time
+	e := New("test", WithLatencyBudget(20*time.Second), WithHTTPClient(&http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			deadline, _ := req.Context().Deadline()
+			deadlines = append(deadlines, deadline)
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		}),
+	}))
+
+	_, err := e.ListModels(context.Background())
+	require.Error(t, err, "the empty body isn't JSON")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = e.ListModels(ctx)
+	require.Error(t, err)
+
+	require.Len(t, deadlines, 2)
+	assert.WithinDuration(t, time.Now().Add(20*time.Second), deadlines[0], time.Second)
+	callerDeadline, _ := ctx.Deadline()
+	assert.Equal(t, callerDeadline, deadlines[1], "the tighter deadline of the caller applies")
+
+	e = New("test", WithHTTPClient(&http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			_, ok := req.Context().Deadline()
+			assert.False(t, ok, "there is no budget by default")
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		}),
+	}))
+	e.ListModels(context.Background())
+}
+
+func TestLatencyBudgetSuccess(t *testing.T) {
+	clock := newAutoClock()
+	var n int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clock.Advance(2 * time.Second)
+		if atomic.AddInt32(&n, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, `{"error":{"message":"overloaded"}}`)
+			return
+		}
+		fmt.Fprintln(w, `{"data":[{"id":"gpt-4"}]}`)
+	}))
+	t.Cleanup(srv.Close)
+	e := New("test", WithClock(clock), WithLatencyBudget(20*time.Second))
+	e.apiBaseURL = srv.URL
+	e.SetMaxRetries(2)
+
+	models, err := e.ListModels(context.Background())
+	require.NoError(t, err, "the body is read after the attempt ends")
+	assert.Len(t, models.Data, 1)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&n))
+}
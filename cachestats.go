@@ -0,0 +1,87 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"sync"
+)
+
+// PromptCacheStats are the statistics of the prompt cache across the responses of the engine.
+type PromptCacheStats struct {
+	// HitCount is the number of responses which read a part of the prompt from the cache.
+	HitCount int64
+	// MissCount is the number of responses to the prompts long enough to be cached,
+	// at least 1024 tokens, which read nothing from the cache.
+	MissCount int64
+	// CachedTokensSaved is the number of prompt tokens read from the cache.
+	CachedTokensSaved int64
+	// EstimatedSavings in USD is the difference between the price of the cached tokens as input
+	// tokens and their discounted price. Only the models of the known pricing are counted.
+	EstimatedSavings float64
+}
+
+// CacheStatsCollector is notified of the prompt cache usage of every response which reports token usage.
+type CacheStatsCollector interface {
+	// RecordPromptCache is called with the cached tokens of the response and its estimated savings in USD.
+	RecordPromptCache(model string, hit bool, cachedTokens int, savings float64)
+}
+
+// WithCacheStatsCollector is used to collect the prompt cache statistics, see Engine.PromptCacheStats.
+func WithCacheStatsCollector(collector CacheStatsCollector) EngineOption {
+	return func(e *Engine) {
+		e.cacheStatsCollector = collector
+	}
+}
+
+// promptCacheSavings returns the savings in USD of reading the tokens from the cache, zero if the model isn't known.
+func promptCacheSavings(model Model, cachedTokens int) float64 {
+	price, ok := modelPriceOf(model)
+	if !ok {
+		return 0
+	}
+	return float64(cachedTokens) * (price.input - price.cached) / 1e6
+}
+
+// cacheStats is shared by the engine and its clones.
+type cacheStats struct {
+	mu    sync.Mutex
+	stats PromptCacheStats
+}
+
+// PromptCacheStats returns the snapshot of the prompt cache statistics. They are collected from
+// the usage of chat completion, completion, edit and embedding responses if the engine has
+// the metrics collector, see WithMetrics, or WithCacheStatsCollector, the stats are zero otherwise.
+// The stats are shared with the clones of the engine.
+func (e *Engine) PromptCacheStats() *PromptCacheStats {
+	if e.cacheStats == nil {
+		return &PromptCacheStats{}
+	}
+	e.cacheStats.mu.Lock()
+	defer e.cacheStats.mu.Unlock()
+	stats := e.cacheStats.stats
+	return &stats
+}
+
+func (e *Engine) recordCacheStats(model Model, usage Usage) {
+	if e.metrics == nil && e.cacheStatsCollector == nil || e.cacheStats == nil {
+		return
+	}
+	cached := usage.CachedTokens()
+	if cached == 0 && usage.PromptTokens < minCachedPromptTokens {
+		return // the prompt is too short to be cached
+	}
+	savings := promptCacheSavings(model, cached)
+	e.cacheStats.mu.Lock()
+	if cached > 0 {
+		e.cacheStats.stats.HitCount++
+	} else {
+		e.cacheStats.stats.MissCount++
+	}
+	e.cacheStats.stats.CachedTokensSaved += int64(cached)
+	e.cacheStats.stats.EstimatedSavings += savings
+	e.cacheStats.mu.Unlock()
+	if e.cacheStatsCollector != nil {
+		e.cacheStatsCollector.RecordPromptCache(string(model), cached > 0, cached, savings)
+	}
+}
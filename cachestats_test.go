@@ -0,0 +1,81 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCacheStatsCollector struct {
+	records []string
+}
+
+func (c *testCacheStatsCollector) RecordPromptCache(model string, hit bool, cachedTokens int, savings float64) {
+	c.records = append(c.records, fmt.Sprintf("%s %t %d %.6f", model, hit, cachedTokens, savings))
+}
+
+// newCacheUsageServer reports the prompt and cached tokens in order, one pair per response.
+func newCacheUsageServer(t *testing.T, usage [][2]int, opts ...EngineOption) *Engine {
+	var n int
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		u := usage[n]
+		n++
+		fmt.Fprintf(w, `{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"}}],`+
+			`"usage":{"prompt_tokens":%d,"completion_tokens":1,"total_tokens":%d,"prompt_tokens_details":{"cached_tokens":%d}}}`,
+			u[0], u[0]+1, u[1])
+	})
+	e := New("test", opts...)
+	e.apiBaseURL = srv.URL
+	return e
+}
+
+func TestPromptCacheStats(t *testing.T) {
+	collector := &testCacheStatsCollector{}
+	e := newCacheUsageServer(t, [][2]int{{2000, 0}, {2000, 1792}, {100, 0}, {4000, 3968}}, WithCacheStatsCollector(collector))
+	opts := testChatOptions()
+	opts.Model = "gpt-4o-2024-08-06"
+	for i := 0; i < 3; i++ {
+		_, err := e.ChatCompletion(context.Background(), opts)
+		require.NoError(t, err)
+	}
+	opts.Model = "gpt-4.1-mini"
+	clone, err := e.Clone()
+	require.NoError(t, err)
+	_, err = clone.ChatCompletion(context.Background(), opts)
+	require.NoError(t, err)
+
+	stats := e.PromptCacheStats()
+	assert.Equal(t, int64(2), stats.HitCount)
+	assert.Equal(t, int64(1), stats.MissCount, "the short prompt can't be cached, it's not the miss")
+	assert.Equal(t, int64(1792+3968), stats.CachedTokensSaved)
+	assert.InDelta(t, 1792*1.25/1e6+3968*0.30/1e6, stats.EstimatedSavings, 1e-12)
+	assert.Equal(t, []string{
+		"gpt-4o-2024-08-06 false 0 0.000000",
+		"gpt-4o-2024-08-06 true 1792 0.002240",
+		"gpt-4.1-mini true 3968 0.001190",
+	}, collector.records)
+
+	stats.HitCount = 100
+	assert.Equal(t, int64(2), e.PromptCacheStats().HitCount, "the snapshot must be returned")
+}
+
+func TestPromptCacheStatsWithMetrics(t *testing.T) {
+	e := newCacheUsageServer(t, [][2]int{{2000, 1024}}, WithMetrics(&testCollector{}))
+	opts := testChatOptions()
+	opts.Model = "unpriced-model"
+	_, err := e.ChatCompletion(context.Background(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, &PromptCacheStats{HitCount: 1, CachedTokensSaved: 1024}, e.PromptCacheStats())
+
+	e = newCacheUsageServer(t, [][2]int{{2000, 1024}})
+	_, err = e.ChatCompletion(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	assert.Equal(t, &PromptCacheStats{}, e.PromptCacheStats(), "the stats must not be collected by default")
+}
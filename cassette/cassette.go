@@ -0,0 +1,495 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+// Package cassette records HTTP interactions with the API into cassette files
+// and replays them, so tests of the code using the API don't depend on the network.
+//
+// In the record mode requests are sent by the underlying transport and the sanitized
+// request/response pairs are saved to the cassette file once the recorder is stopped.
+// In the replay mode responses are served from the cassette file, requests which
+// weren't recorded fail.
+package cassette
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	openai "github.com/0x9ef/openai-go"
+)
+
+// Mode of the recorder.
+type Mode int
+
+const (
+	// ModeReplay serves responses from the cassette file.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests and records the interactions into the cassette file.
+	ModeRecord
+)
+
+// ErrNoInteraction is returned by the recorder in the replay mode for requests
+// which don't match any recorded interaction.
+var ErrNoInteraction = errors.New("cassette: no recorded interaction")
+
+// SanitizedHeaders are the headers which are stripped from the recorded interactions.
+var SanitizedHeaders = []string{"Authorization", "Api-Key", "Cookie", "Set-Cookie", "Openai-Organization"}
+
+// Cassette is the content of the cassette file.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is the recorded pair of request and response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Body is the body of the request or response. JSON bodies are stored as JSON,
+// so they are pretty-printed in the cassette file, other text bodies as strings
+// and binary bodies as base64.
+type Body struct {
+	JSON   json.RawMessage `json:"body,omitempty"`
+	Text   string          `json:"text_body,omitempty"`
+	Binary []byte          `json:"binary_body,omitempty"`
+}
+
+type Request struct {
+	Method string `json:"method"`
+	// URL is the path of the request with the query, e.g. "/v1/models?limit=10".
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body
+	// BodyHash is the hash of the canonicalized body the request is matched by.
+	BodyHash string `json:"body_hash"`
+}
+
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body
+	// Frames of the event stream, set instead of the body for text/event-stream responses.
+	Frames []Frame `json:"frames,omitempty"`
+}
+
+// Frame is a single event of the event stream, including the blank line terminating it.
+type Frame struct {
+	Data string `json:"data"`
+	// Delay is the time since the previous frame, or since the response if it's the first frame,
+	// in nanoseconds.
+	Delay time.Duration `json:"delay"`
+}
+
+// Recorder is the http.RoundTripper which records or replays interactions.
+type Recorder struct {
+	// Transport sends requests in the record mode, http.DefaultTransport if it's nil.
+	Transport http.RoundTripper
+	// ReplayDelays makes the replayed event streams wait for the recorded delay before every frame.
+	ReplayDelays bool
+	// Clock measures the delays of the recorded frames and waits for the replayed ones,
+	// the system clock if it's nil, see openai.TestClock.
+	Clock openai.Clock
+
+	mode        Mode
+	path        string
+	mu          sync.Mutex
+	cassette    Cassette
+	used        []bool
+	onUnmatched func(err error)
+}
+
+// New is used to initialize recorder of the cassette file at path. In the replay mode
+// the cassette file is loaded, in the record mode it's overwritten by Stop.
+func New(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{mode: mode, path: path}
+	if mode == ModeReplay {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read cassette: %w", err)
+		}
+		if err := json.Unmarshal(b, &r.cassette); err != nil {
+			return nil, fmt.Errorf("decode cassette %s: %w", path, err)
+		}
+		r.used = make([]bool, len(r.cassette.Interactions))
+	}
+	return r, nil
+}
+
+// Start is used to initialize recorder in tests, the cassette is saved when the test finishes.
+// Unmatched requests in the replay mode fail the test.
+func Start(t testing.TB, path string, mode Mode) *Recorder {
+	t.Helper()
+	r, err := New(path, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.onUnmatched = func(err error) {
+		t.Error(err)
+	}
+	t.Cleanup(func() {
+		if err := r.Stop(); err != nil {
+			t.Error(err)
+		}
+	})
+	return r
+}
+
+// Client returns HTTP client which sends requests through the recorder.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// EngineOption returns the option which makes engine send requests through the recorder.
+func (r *Recorder) EngineOption() openai.EngineOption {
+	return openai.WithHTTPClient(r.Client())
+}
+
+// Stop saves the recorded interactions to the cassette file in the record mode.
+// Event streams which weren't read to the end are saved as far as they were read.
+func (r *Recorder) Stop() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	b, err := json.MarshalIndent(r.cassette, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("encode cassette: %w", err)
+	}
+	return os.WriteFile(r.path, append(b, '\n'), 0o644)
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cassette: read request body: %w", err)
+		}
+	}
+	recorded := Request{
+		Method:   req.Method,
+		URL:      req.URL.RequestURI(),
+		Header:   sanitizeHeader(req.Header),
+		Body:     newBody(body),
+		BodyHash: bodyHash(req.Header.Get("Content-Type"), body),
+	}
+	if r.mode == ModeReplay {
+		return r.replay(req, recorded)
+	}
+	return r.record(req, body, recorded)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte, recorded Request) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	interaction := &Interaction{Request: recorded, Response: Response{
+		StatusCode: resp.StatusCode,
+		Header:     sanitizeHeader(resp.Header),
+	}}
+	interaction.Response.Header.Del("Content-Length")
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+
+	if isEventStream(resp.Header) {
+		resp.Body = &recordingStream{r: r, interaction: interaction, body: resp.Body, last: r.clock().Now()}
+		return resp, nil
+	}
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	interaction.Response.Body = newBody(b)
+	r.mu.Unlock()
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, recorded Request) (*http.Response, error) {
+	r.mu.Lock()
+	var interaction *Interaction
+	for i, it := range r.cassette.Interactions {
+		if !r.used[i] && it.Request.Method == recorded.Method && it.Request.URL == recorded.URL && it.Request.BodyHash == recorded.BodyHash {
+			r.used[i] = true
+			interaction = it
+			break
+		}
+	}
+	r.mu.Unlock()
+	if interaction == nil {
+		err := fmt.Errorf("%w for %s %s with body hash %s in %s", ErrNoInteraction, recorded.Method, recorded.URL, recorded.BodyHash, r.path)
+		if r.onUnmatched != nil {
+			r.onUnmatched(err)
+		}
+		return nil, err
+	}
+	resp := &http.Response{
+		Status:     fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+		StatusCode: interaction.Response.StatusCode,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     interaction.Response.Header.Clone(),
+		Request:    req,
+	}
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
+	}
+	if interaction.Response.Frames != nil {
+		resp.ContentLength = -1
+		resp.Body = &replayStream{ctx: req.Context(), frames: interaction.Response.Frames, delays: r.ReplayDelays, clock: r.clock()}
+		return resp, nil
+	}
+	b := interaction.Response.Body.bytes()
+	resp.ContentLength = int64(len(b))
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	return resp, nil
+}
+
+// recordingStream passes the event stream through and records it frame by frame.
+type recordingStream struct {
+	r           *Recorder
+	interaction *Interaction
+	body        io.ReadCloser
+	buf         []byte
+	last        time.Time
+	done        bool
+}
+
+func (s *recordingStream) Read(p []byte) (int, error) {
+	n, err := s.body.Read(p)
+	s.buf = append(s.buf, p[:n]...)
+	for {
+		i := frameEnd(s.buf)
+		if i < 0 {
+			break
+		}
+		s.addFrame(s.buf[:i])
+		s.buf = s.buf[i:]
+	}
+	if err != nil {
+		s.flush()
+	}
+	return n, err
+}
+
+func (s *recordingStream) Close() error {
+	s.flush()
+	return s.body.Close()
+}
+
+// flush records the incomplete frame at the end of the stream.
+func (s *recordingStream) flush() {
+	if s.done {
+		return
+	}
+	s.done = true
+	if len(s.buf) != 0 {
+		s.addFrame(s.buf)
+		s.buf = nil
+	}
+}
+
+func (s *recordingStream) addFrame(b []byte) {
+	now := s.r.clock().Now()
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.interaction.Response.Frames = append(s.interaction.Response.Frames, Frame{Data: string(b), Delay: now.Sub(s.last)})
+	s.last = now
+}
+
+// frameEnd returns the end of the first frame terminated by a blank line, or -1.
+func frameEnd(b []byte) int {
+	for i := 0; i < len(b); i++ {
+		if b[i] != '\n' && b[i] != '\r' {
+			continue
+		}
+		j := i + 1
+		if b[i] == '\r' && j < len(b) && b[j] == '\n' {
+			j++
+		}
+		if j < len(b) && (b[j] == '\n' || b[j] == '\r') {
+			k := j + 1
+			if b[j] == '\r' {
+				if k == len(b) {
+					return -1 // the CRLF may be split between reads
+				}
+				if b[k] == '\n' {
+					k++
+				}
+			}
+			return k
+		}
+	}
+	return -1
+}
+
+// replayStream serves the recorded frames of the event stream.
+type replayStream struct {
+	ctx    context.Context
+	frames []Frame
+	delays bool
+	clock  openai.Clock
+	cur    []byte
+}
+
+func (s *replayStream) Read(p []byte) (int, error) {
+	for len(s.cur) == 0 {
+		if len(s.frames) == 0 {
+			return 0, io.EOF
+		}
+		f := s.frames[0]
+		s.frames = s.frames[1:]
+		if s.delays && f.Delay > 0 {
+			if err := s.clock.Sleep(s.ctx, f.Delay); err != nil {
+				return 0, err
+			}
+		}
+		s.cur = []byte(f.Data)
+	}
+	n := copy(p, s.cur)
+	s.cur = s.cur[n:]
+	return n, nil
+}
+
+func (s *replayStream) Close() error {
+	s.frames, s.cur = nil, nil
+	return nil
+}
+
+func (r *Recorder) clock() openai.Clock {
+	if r.Clock == nil {
+		return openai.SystemClock()
+	}
+	return r.Clock
+}
+
+func isEventStream(h http.Header) bool {
+	return strings.HasPrefix(h.Get("Content-Type"), "text/event-stream")
+}
+
+func sanitizeHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range SanitizedHeaders {
+		h.Del(name)
+	}
+	if len(h) == 0 {
+		return nil
+	}
+	return h
+}
+
+func newBody(b []byte) Body {
+	switch {
+	case len(b) == 0:
+		return Body{}
+	case json.Valid(b):
+		return Body{JSON: json.RawMessage(b)}
+	case utf8.Valid(b):
+		return Body{Text: string(b)}
+	}
+	return Body{Binary: b}
+}
+
+func (b Body) bytes() []byte {
+	switch {
+	case b.JSON != nil:
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, b.JSON); err == nil {
+			return buf.Bytes()
+		}
+		return b.JSON
+	case b.Binary != nil:
+		return b.Binary
+	}
+	return []byte(b.Text)
+}
+
+// bodyHash returns the hash of the canonicalized body: JSON is hashed regardless of formatting
+// and the order of object keys, multipart forms regardless of the boundary.
+func bodyHash(contentType string, b []byte) string {
+	h := sha256.New()
+	if canonical, ok := canonicalJSON(b); ok {
+		h.Write(canonical)
+	} else if !writeCanonicalMultipart(h, contentType, b) {
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func canonicalJSON(b []byte) ([]byte, bool) {
+	if len(b) == 0 || !json.Valid(b) {
+		return nil, false
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, false
+	}
+	canonical, err := json.Marshal(v) // keys of objects are sorted
+	return canonical, err == nil
+}
+
+func writeCanonicalMultipart(w io.Writer, contentType string, b []byte) bool {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return false
+	}
+	mr := multipart.NewReader(bytes.NewReader(b), params["boundary"])
+	type part struct {
+		name, filename string
+		data           []byte
+	}
+	var parts []part
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false
+		}
+		data, err := io.ReadAll(p)
+		if err != nil {
+			return false
+		}
+		parts = append(parts, part{p.FormName(), p.FileName(), data})
+	}
+	sort.SliceStable(parts, func(i, j int) bool { return parts[i].name < parts[j].name })
+	for _, p := range parts {
+		fmt.Fprintf(w, "%q %q %d\n", p.name, p.filename, len(p.data))
+		w.Write(p.data)
+	}
+	return true
+}
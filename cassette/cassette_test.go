@@ -0,0 +1,238 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package cassette
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/0x9ef/openai-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// redirectTransport sends the requests for the API to the test server.
+func redirectTransport(srv *httptest.Server) http.RoundTripper {
+	target, _ := url.Parse(srv.URL)
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+		return http.DefaultTransport.RoundTrip(req)
+	})
+}
+
+var errNetworkDisabled = errors.New("network disabled")
+
+var noNetwork = roundTripperFunc(func(*http.Request) (*http.Response, error) {
+	return nil, errNetworkDisabled
+})
+
+const streamFrameDelay = 30 * time.Millisecond
+
+func newAPIServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/chat/completions":
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			if strings.Contains(string(body), "goodbye") {
+				w.Write([]byte(`{"id":"chatcmpl-2","choices":[{"message":{"role":"assistant","content":"bye"}}]}`))
+				return
+			}
+			w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+		case "/v1/completions":
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, text := range []string{"Once", " upon", " a time"} {
+				fmt.Fprintf(w, "data: {\"id\":\"cmpl-1\",\"choices\":[{\"text\":%q,\"index\":0}]}\n\n", text)
+				w.(http.Flusher).Flush()
+				time.Sleep(streamFrameDelay)
+			}
+			w.Write([]byte("data: [DONE]\n\n"))
+		case "/v1/models":
+			w.Header().Set("Set-Cookie", "session=secret")
+			w.Write([]byte(`{"data":[{"id":"gpt-4","object":"model","owned_by":"openai"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func chatOptions(content string) *openai.ChatCompletionOptions {
+	return &openai.ChatCompletionOptions{
+		Model:    openai.ModelGPT3Dot5Turbo,
+		Messages: []openai.ChatMessage{{Role: "user", Content: content}},
+	}
+}
+
+func readStream(t *testing.T, e *openai.Engine) (string, []time.Duration) {
+	s, err := e.CompletionStream(context.Background(), &openai.CompletionOptions{Model: "gpt-3.5-turbo-instruct", Prompt: []string{"a"}})
+	require.NoError(t, err)
+	defer s.Close()
+	var (
+		text   string
+		delays []time.Duration
+		last   = time.Now()
+	)
+	for {
+		r, err := s.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		text += r.Choices[0].Text
+		delays = append(delays, time.Since(last))
+		last = time.Now()
+	}
+	return text, delays
+}
+
+func TestRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	srv := newAPIServer(t)
+
+	t.Run("record", func(t *testing.T) {
+		r := Start(t, path, ModeRecord)
+		r.Transport = redirectTransport(srv)
+		e := openai.New("sk-secret", r.EngineOption())
+
+		resp, err := e.ChatCompletion(context.Background(), chatOptions("hello"))
+		require.NoError(t, err)
+		assert.Equal(t, "hi", resp.Choices[0].Message.Content)
+		resp, err = e.ChatCompletion(context.Background(), chatOptions("goodbye"))
+		require.NoError(t, err)
+		assert.Equal(t, "bye", resp.Choices[0].Message.Content)
+		text, _ := readStream(t, e)
+		assert.Equal(t, "Once upon a time", text)
+		_, err = e.ListModels(context.Background())
+		require.NoError(t, err)
+	})
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	content := string(b)
+	assert.NotContains(t, content, "sk-secret", "auth headers must be stripped")
+	assert.NotContains(t, content, "session=secret")
+	assert.Contains(t, content, `"content": "hello"`, "bodies must be pretty-printed")
+	assert.Contains(t, content, `"data": "data: {\"id\":\"cmpl-1\",\"choices\":[{\"text\":\" upon\",\"index\":0}]}\n\n"`, "streams must be recorded frame by frame")
+
+	srv.Close()
+
+	t.Run("replay", func(t *testing.T) {
+		r := Start(t, path, ModeReplay)
+		r.Transport = noNetwork
+		r.ReplayDelays = true
+		clock := openai.NewTestClock(time.Unix(1700000000, 0))
+		clock.SetAutoAdvance(true)
+		r.Clock = clock
+		e := openai.New("sk-other", r.EngineOption())
+
+		// The order of requests doesn't matter, they are matched by body
+		resp, err := e.ChatCompletion(context.Background(), chatOptions("goodbye"))
+		require.NoError(t, err)
+		assert.Equal(t, "bye", resp.Choices[0].Message.Content)
+		resp, err = e.ChatCompletion(context.Background(), chatOptions("hello"))
+		require.NoError(t, err)
+		assert.Equal(t, "hi", resp.Choices[0].Message.Content)
+
+		text, delays := readStream(t, e)
+		assert.Equal(t, "Once upon a time", text)
+		require.Len(t, delays, 3)
+		slept := clock.Slept()
+		require.GreaterOrEqual(t, len(slept), 2)
+		assert.GreaterOrEqual(t, slept[1], streamFrameDelay/2, "inter-frame delays must be replayed")
+
+		models, err := e.ListModels(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, openai.Model("gpt-4"), models.Data[0].ID)
+	})
+}
+
+func TestReplayUnmatched(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	srv := newAPIServer(t)
+	rec, err := New(path, ModeRecord)
+	require.NoError(t, err)
+	rec.Transport = redirectTransport(srv)
+	e := openai.New("test", rec.EngineOption())
+	_, err = e.ChatCompletion(context.Background(), chatOptions("hello"))
+	require.NoError(t, err)
+	require.NoError(t, rec.Stop())
+
+	r, err := New(path, ModeReplay)
+	require.NoError(t, err)
+	r.Transport = noNetwork
+	e = openai.New("test", r.EngineOption())
+
+	_, err = e.ChatCompletion(context.Background(), chatOptions("something else"))
+	assert.ErrorIs(t, err, ErrNoInteraction)
+	assert.NotErrorIs(t, err, errNetworkDisabled)
+
+	_, err = e.ChatCompletion(context.Background(), chatOptions("hello"))
+	require.NoError(t, err)
+	_, err = e.ChatCompletion(context.Background(), chatOptions("hello"))
+	assert.ErrorIs(t, err, ErrNoInteraction, "every interaction must be replayed once")
+}
+
+func TestFrameEnd(t *testing.T) {
+	for _, tc := range []struct {
+		in  string
+		end int
+	}{
+		{"data: a\n\ndata: b\n\n", 9},
+		{"data: a\r\n\r\ndata: b", 11},
+		{"data: a\r\rdata: b", 9},
+		{"data: a\n", -1},
+		{"data: a\r\n\r", -1},
+		{"data: a\r\n", -1},
+		{"", -1},
+	} {
+		assert.Equal(t, tc.end, frameEnd([]byte(tc.in)), "%q", tc.in)
+	}
+}
+
+func TestBodyHash(t *testing.T) {
+	assert.Equal(t,
+		bodyHash("application/json", []byte(`{"model":"gpt-4","n":1}`)),
+		bodyHash("application/json", []byte("{\n  \"n\": 1,\n  \"model\": \"gpt-4\"\n}")),
+		"JSON is hashed regardless of formatting and key order")
+	assert.NotEqual(t,
+		bodyHash("application/json", []byte(`{"model":"gpt-4","n":1}`)),
+		bodyHash("application/json", []byte(`{"model":"gpt-4","n":2}`)))
+
+	form := func(file string) (string, []byte) {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		w.WriteField("model", "whisper-1")
+		fw, _ := w.CreateFormFile("file", "audio.mp3")
+		fw.Write([]byte(file))
+		w.Close()
+		return w.FormDataContentType(), buf.Bytes()
+	}
+	ct1, b1 := form("ID3 audio")
+	ct2, b2 := form("ID3 audio")
+	require.NotEqual(t, ct1, ct2, "boundaries must be random")
+	assert.Equal(t, bodyHash(ct1, b1), bodyHash(ct2, b2), "multipart is hashed regardless of the boundary")
+	ct3, b3 := form("other audio")
+	assert.NotEqual(t, bodyHash(ct1, b1), bodyHash(ct3, b3))
+}
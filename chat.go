@@ -2,14 +2,22 @@ package openai
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 )
 
 type ChatCompletionOptions struct {
+	// Ctx carries per-request values, e.g. for middleware of the HTTP client.
+	// It's merged with the context passed to ChatCompletion: the request is aborted
+	// when either of them is done, and the earlier deadline applies.
+	Ctx context.Context `json:"-"`
 	// ID of the model to use.
 	Model Model `json:"model" binding:"required"`
 	// The messages to generate chat completions for, in the chat format.
-	Messages []ChatMessage `json:"messages" binding:"required"`
+	Messages []ChatMessage `json:"messages" binding:"required,dive"`
+	// The system prompt of the models which take it in the top-level instructions
+	// instead of the system messages, see ModelProfile.Instructions.
+	Instructions string `json:"instructions,omitempty"`
 	// What sampling temperature to use, between 0 and 2.
 	// Higher values like 0.8 will make the output more random, while lower values
 	// like 0.2 will make it more focused and deterministic.
@@ -20,52 +28,304 @@ type ChatCompletionOptions struct {
 	TopP float32 `json:"top_p,omitempty"`
 	// How many chat completions to generate for each input message.
 	N int `json:"n,omitempty"`
+	// Whether to return the log probabilities of the output tokens in the choices.
+	Logprobs bool `json:"logprobs,omitempty"`
+	// The number of the most likely tokens to return at each position, between 0 and 20, with their
+	// log probabilities. Logprobs must be set.
+	TopLogprobs int `json:"top_logprobs,omitempty" binding:"omitempty,max=20"`
 	// Up to 4 sequences where the API will stop generating further tokens.
 	Stop []string `json:"stop,omitempty"`
 	// The maximum number of tokens to generate in the chat completion.
 	// The total length of input tokens and generated tokens is limited by the model's context length.
 	MaxTokens int `json:"max_tokens,omitempty"`
+	// An upper bound for the number of tokens that can be generated for a completion,
+	// including visible output tokens and reasoning tokens. Replaces MaxTokens for reasoning models.
+	MaxCompletionTokens int `json:"max_completion_tokens,omitempty"`
 	// Number between -2.0 and 2.0. Positive values penalize new tokens based on whether
 	// they appear in the text so far, increasing the model's likelihood to talk about new topics.
 	PresencePenalty float32 `json:"presence_penalty,omitempty"`
 	// Number between -2.0 and 2.0. Positive values penalize new tokens based on their existing
 	// frequency in the text so far, decreasing the model's likelihood to repeat the same line verbatim.
 	FrequencyPenalty float32 `json:"frequency_penalty,omitempty"`
+	// A list of tools the model may call, up to 128 functions.
+	Tools []ChatTool `json:"tools,omitempty"`
+	// Whether to enable parallel function calling during tool use.
+	ParallelToolCalls *bool `json:"parallel_tool_calls,omitempty"`
+	// Whether to store the output of the chat completion, so it can be retrieved, updated or deleted later.
+	Store bool `json:"store,omitempty"`
+	// Set of up to 16 key-value pairs attached to the stored chat completion.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// The format of the output, e.g. the JSON object of the given schema.
+	ResponseFormat *ChatResponseFormat `json:"response_format,omitempty"`
+	// ValidateResponseSchema validates the content of the first choice against the JSON schema
+	// of ResponseFormat, a *SchemaViolationError is returned along with the response if it
+	// doesn't conform. It's useful with non-strict schemas, which the model may drift from.
+	ValidateResponseSchema bool `json:"-"`
+	// MoveVolatileMessages moves the messages marked as Volatile to the end of Messages,
+	// keeping their order, so the prefix of the prompt stays the same across requests
+	// and can be served from the prompt cache. It changes the order the model sees.
+	MoveVolatileMessages bool `json:"-"`
+	// The options of the streamed response, only set them for ChatCompletionStream.
+	StreamOptions *ChatStreamOptions `json:"stream_options,omitempty"`
+	// CustomId is the ID of the request of the batch submitted with SubmitBatch, which identifies
+	// its result in the output file. It's "req-<index>" by default.
+	CustomId string `json:"-"`
+}
+
+type ChatStreamOptions struct {
+	// Whether to stream the usage of the whole request in the last chunk, before the end
+	// of the stream. Its choices are empty.
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type ChatMessage struct {
 	Content string `json:"content"`
 	Role    string `json:"role"`
+	// Parts is the multimodal content of the message, e.g. text and images.
+	// If it's set, it's sent instead of Content.
+	Parts []ContentPart `json:"-" binding:"dive"`
+	// Volatile marks the message which varies across requests, e.g. with a timestamp
+	// or a request ID. It isn't sent, see ChatCompletionOptions.MoveVolatileMessages.
+	Volatile bool `json:"-"`
+	// Annotations of the generated message, e.g. the URL citations of the web search.
+	// They aren't sent, see ExtractText.
+	Annotations []ChatAnnotation `json:"-"`
+	// ToolCalls are the calls of the tools generated by the model, the assistant message.
+	ToolCalls []ToolCall `json:"-"`
+	// ToolCallId is the ID of the call the tool message responds to.
+	ToolCallId string `json:"-"`
+	// Refusal is the refusal of the model to reply in the requested format, the content
+	// of the assistant message is empty then.
+	Refusal string `json:"-"`
+}
+
+// chatMessage is the JSON representation of ChatMessage, the content is either a string or parts.
+type chatMessage struct {
+	Content    interface{} `json:"content"`
+	Role       string      `json:"role"`
+	ToolCalls  []ToolCall  `json:"tool_calls,omitempty"`
+	ToolCallId string      `json:"tool_call_id,omitempty"`
+	Refusal    string      `json:"refusal,omitempty"`
+}
+
+func (m ChatMessage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.wire())
+}
+
+func (m ChatMessage) wire() chatMessage {
+	w := chatMessage{Content: m.Content, Role: m.Role, ToolCalls: m.ToolCalls, ToolCallId: m.ToolCallId, Refusal: m.Refusal}
+	switch {
+	case m.Parts != nil:
+		w.Content = m.Parts
+	case m.Content == "" && len(m.ToolCalls) != 0:
+		w.Content = nil
+	}
+	return w
+}
+
+func (m *ChatMessage) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Content     json.RawMessage  `json:"content"`
+		Role        string           `json:"role"`
+		Annotations []ChatAnnotation `json:"annotations"`
+		ToolCalls   []ToolCall       `json:"tool_calls"`
+		ToolCallId  string           `json:"tool_call_id"`
+		Refusal     string           `json:"refusal"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*m = ChatMessage{Role: v.Role, Annotations: v.Annotations, ToolCalls: v.ToolCalls, ToolCallId: v.ToolCallId, Refusal: v.Refusal}
+	switch {
+	case len(v.Content) == 0 || string(v.Content) == "null":
+		return nil
+	case v.Content[0] == '[':
+		return json.Unmarshal(v.Content, &m.Parts)
+	default:
+		return json.Unmarshal(v.Content, &m.Content)
+	}
 }
 
 type ChatCompletionResponse struct {
 	Id      string `json:"id"`
 	Object  string `json:"object"`
 	Created int    `json:"created"`
-	Choices []struct {
-		Message      ChatMessage `json:"message"`
-		Index        int         `json:"index"`
-		FinishReason string      `json:"finish_reason"`
-	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	Model   Model  `json:"model"`
+	// Metadata of the stored chat completion.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Fingerprint of the backend configuration that the model runs with.
+	SystemFingerprint string                 `json:"system_fingerprint,omitempty"`
+	Choices           []ChatCompletionChoice `json:"choices"`
+	Usage             Usage                  `json:"usage"`
+	// ID of the request assigned by the API, useful when reporting issues.
+	RequestId string `json:"-"`
+}
+
+type ChatCompletionChoice struct {
+	Message      ChatMessage `json:"message"`
+	Index        int         `json:"index"`
+	FinishReason string      `json:"finish_reason"`
+	// The log probabilities of the tokens of the choice, set with ChatCompletionOptions.Logprobs.
+	Logprobs *ChatLogprobs `json:"logprobs,omitempty"`
+}
+
+// ChatLogprobs holds the log probabilities of the tokens of the chat completion choice.
+type ChatLogprobs struct {
+	// The tokens of the content of the message.
+	Content []ChatTokenLogprob `json:"content"`
+	// The tokens of the refusal of the message.
+	Refusal []ChatTokenLogprob `json:"refusal,omitempty"`
+}
+
+type ChatTokenLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+	// The UTF-8 bytes of the token, the characters may span multiple tokens.
+	Bytes []int `json:"bytes,omitempty"`
+	// The most likely tokens at the position, up to ChatCompletionOptions.TopLogprobs.
+	TopLogprobs []ChatTopLogprob `json:"top_logprobs,omitempty"`
+}
+
+type ChatTopLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+	Bytes   []int   `json:"bytes,omitempty"`
 }
 
 // ChatCompletion given messages, the model will return one or more predicted chat completions.
 //
 // Docs: https://beta.openai.com/docs/api-reference/chat
 func (e *Engine) ChatCompletion(ctx context.Context, opts *ChatCompletionOptions) (*ChatCompletionResponse, error) {
-	if err := e.validate.StructCtx(ctx, opts); err != nil {
+	ctx, cancel := mergeContext(ctx, opts.Ctx)
+	defer cancel()
+	result, err := e.chatCompletion(ctx, opts)
+	if e.overflow != nil && isContextLengthExceeded(err) && !overflowRecoveryFrom(ctx) {
+		result, err = e.recoverOverflow(ctx, opts, err)
+	}
+	if err == nil && opts.ValidateResponseSchema {
+		err = validateResponseSchema(opts, result)
+	}
+	return result, err
+}
+
+func (e *Engine) chatCompletion(ctx context.Context, opts *ChatCompletionOptions) (*ChatCompletionResponse, error) {
+	resp, err := e.sendChatCompletion(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	var result ChatCompletionResponse
+	if err := unmarshal(resp, &result); err != nil {
+		return nil, err
+	}
+	result.RequestId = resp.Header.Get("X-Request-Id")
+	e.recordUsage(e.chatModel(opts.Model), result.Usage)
+	return &result, nil
+}
+
+// ChatCompletionRaw is the same as ChatCompletion, but returns the raw JSON body of the response,
+// e.g. to read the fields of the new API features which ChatCompletionResponse doesn't model yet.
+// The body is checked to be valid JSON. The overflow strategy and the response schema validation
+// don't apply to it.
+func (e *Engine) ChatCompletionRaw(ctx context.Context, opts *ChatCompletionOptions) (json.RawMessage, error) {
+	ctx, cancel := mergeContext(ctx, opts.Ctx)
+	defer cancel()
+	resp, err := e.sendChatCompletion(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	var raw json.RawMessage
+	if err := unmarshal(resp, &raw); err != nil {
+		return nil, err
+	}
+	var result struct {
+		Usage Usage `json:"usage"`
+	}
+	if err := json.Unmarshal(raw, &result); err == nil {
+		e.recordUsage(e.chatModel(opts.Model), result.Usage)
+	}
+	return raw, nil
+}
+
+// withDefaults returns the copy of opts with the default max tokens set,
+// unless the max completion tokens are set.
+func (opts *ChatCompletionOptions) withDefaults() *ChatCompletionOptions {
+	out := *opts
+	if out.MaxTokens == 0 && out.MaxCompletionTokens == 0 {
+		out.MaxTokens = defaultMaxTokens
+	}
+	return &out
+}
+
+// chatCompletionBody validates opts and returns the body of the chat completion request
+// with the defaults set, translated for the model and sanitized. opts isn't modified.
+func (e *Engine) chatCompletionBody(ctx context.Context, opts *ChatCompletionOptions) (*ChatCompletionOptions, error) {
+	if model := e.chatModel(opts.Model); model != opts.Model {
+		withModel := *opts
+		withModel.Model = model
+		opts = &withModel
+	}
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	translated, err := e.translate(normalizePromptCache(opts.withDefaults()))
+	if err != nil {
+		return nil, err
+	}
+	return e.sanitize(translated), nil
+}
+
+// sendChatCompletion sends the chat completion request and returns the successful response.
+func (e *Engine) sendChatCompletion(ctx context.Context, opts *ChatCompletionOptions) (*http.Response, error) {
+	body, err := e.chatCompletionBody(ctx, opts)
+	if err != nil {
 		return nil, err
 	}
 	uri := e.apiBaseURL + "/chat/completions"
-	if opts.MaxTokens == 0 {
-		opts.MaxTokens = defaultMaxTokens
+	ctx = withRequestInfo(ctx, "/chat/completions", body.Model)
+	r, err := marshalJson(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := e.newReq(ctx, http.MethodPost, uri, "json", r)
+	if err != nil {
+		return nil, err
+	}
+	return e.doReq(req)
+}
+
+// ChatCompletionWithContext is the same as ChatCompletion, but also returns ctx enriched
+// with metadata of the response: the request ID, the model and the token usage.
+// The metadata is read with RequestIdFromContext, ModelFromContext, PromptTokensFromContext
+// and CompletionTokensFromContext. If the request fails, ctx is returned as is.
+func (e *Engine) ChatCompletionWithContext(ctx context.Context, opts *ChatCompletionOptions) (*ChatCompletionResponse, context.Context, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	result, err := e.ChatCompletion(ctx, opts)
+	if err != nil {
+		return nil, ctx, err
 	}
-	r, err := marshalJson(opts)
+	model := result.Model
+	if model == "" {
+		model = opts.Model
+	}
+	return result, withResponseInfo(ctx, responseInfo{
+		requestId:        result.RequestId,
+		model:            model,
+		promptTokens:     result.Usage.PromptTokens,
+		completionTokens: result.Usage.CompletionTokens,
+	}), nil
+}
+
+// UpdateChatCompletion replaces metadata of the chat completion stored with the Store option.
+//
+// Docs: https://platform.openai.com/docs/api-reference/chat/update
+func (e *Engine) UpdateChatCompletion(ctx context.Context, id string, metadata map[string]string) (*ChatCompletionResponse, error) {
+	uri := e.apiBaseURL + "/chat/completions/" + id
+	ctx = withRequestInfo(ctx, "/chat/completions/{id}", "")
+	r, err := marshalJson(struct {
+		Metadata map[string]string `json:"metadata"`
+	}{metadata})
 	if err != nil {
 		return nil, err
 	}
@@ -83,3 +343,107 @@ func (e *Engine) ChatCompletion(ctx context.Context, opts *ChatCompletionOptions
 	}
 	return &result, nil
 }
+
+// DeleteChatCompletion deletes the chat completion stored with the Store option.
+//
+// Docs: https://platform.openai.com/docs/api-reference/chat/delete
+func (e *Engine) DeleteChatCompletion(ctx context.Context, id string) (*Deleted, error) {
+	uri := e.apiBaseURL + "/chat/completions/" + id
+	ctx = withRequestInfo(ctx, "/chat/completions/{id}", "")
+	return e.deleteObject(ctx, uri)
+}
+
+// ChatCompletionStream is a stream of chat completion chunks, it must be closed after use.
+type ChatCompletionStream struct {
+	resp   *http.Response
+	reader *sseReader
+	cancel context.CancelFunc
+}
+
+// ChatCompletionStreamResponse is a single chunk of the streamed chat completion.
+// Choices of the chunk carry only the content generated since the previous chunk.
+type ChatCompletionStreamResponse struct {
+	Id                string                       `json:"id"`
+	Object            string                       `json:"object"`
+	Created           int                          `json:"created"`
+	Model             Model                        `json:"model"`
+	SystemFingerprint string                       `json:"system_fingerprint,omitempty"`
+	Choices           []ChatCompletionStreamChoice `json:"choices"`
+	// The usage of the whole request, only set in the last chunk if ChatStreamOptions.IncludeUsage is set.
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+type ChatCompletionStreamChoice struct {
+	Delta        ChatMessageDelta `json:"delta"`
+	Index        int              `json:"index"`
+	FinishReason string           `json:"finish_reason"`
+}
+
+// ChatMessageDelta is the part of the message generated since the previous chunk.
+// The role is only set in the first chunk of the choice.
+type ChatMessageDelta struct {
+	Content string `json:"content"`
+	Role    string `json:"role,omitempty"`
+}
+
+// ChatCompletionStream is like ChatCompletion, but the completion is streamed back as it's generated.
+//
+// Docs: https://platform.openai.com/docs/api-reference/chat/create#chat-create-stream
+func (e *Engine) ChatCompletionStream(ctx context.Context, opts *ChatCompletionOptions) (*ChatCompletionStream, error) {
+	ctx, cancel := mergeContext(ctx, opts.Ctx)
+	stream, err := e.chatCompletionStream(ctx, opts)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stream.cancel = cancel
+	return stream, nil
+}
+
+func (e *Engine) chatCompletionStream(ctx context.Context, opts *ChatCompletionOptions) (*ChatCompletionStream, error) {
+	body, err := e.chatCompletionBody(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	uri := e.apiBaseURL + "/chat/completions"
+	ctx = withRequestInfo(ctx, "/chat/completions", body.Model)
+	r, err := marshalJson(struct {
+		*ChatCompletionOptions
+		Stream bool `json:"stream"`
+	}{body, true})
+	if err != nil {
+		return nil, err
+	}
+	req, err := e.newReq(ctx, http.MethodPost, uri, "json", r)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.doReq(req)
+	if err != nil {
+		return nil, err
+	}
+	return &ChatCompletionStream{resp: resp, reader: newSSEReader(resp.Body)}, nil
+}
+
+// Recv returns the next chunk of the stream. It returns io.EOF when the stream is finished,
+// ErrStreamCanceled if the context of the request is done, StreamAPIError if the server
+// reported the error, StreamProtocolError if the chunk is malformed, or StreamClosedUnexpectedly,
+// which matches ErrStreamClosed, if the stream ended before it was finished.
+func (s *ChatCompletionStream) Recv() (*ChatCompletionStreamResponse, error) {
+	var chunk ChatCompletionStreamResponse
+	if err := s.reader.decode(&chunk); err != nil {
+		return nil, streamError(s.resp.Request.Context(), err)
+	}
+	return &chunk, nil
+}
+
+// Close closes the stream. The connection is reused if the stream was
+// read to the end, otherwise it's closed.
+func (s *ChatCompletionStream) Close() error {
+	defer s.cancel()
+	if s.reader.done {
+		drainBody(s.resp.Body)
+		return nil
+	}
+	return s.resp.Body.Close()
+}
@@ -0,0 +1,192 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type tenantKey struct{}
+
+func newChatTestServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	if handler == nil {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+		}
+	}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testChatOptions() *ChatCompletionOptions {
+	return &ChatCompletionOptions{
+		Model:    ModelGPT3Dot5Turbo,
+		Messages: []ChatMessage{{Role: "user", Content: "hello"}},
+	}
+}
+
+func TestChatCompletionOptionsContextValues(t *testing.T) {
+	srv := newChatTestServer(t, nil)
+	var tenant interface{}
+	e := New("test", WithHTTPClient(&http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			tenant = req.Context().Value(tenantKey{})
+			return http.DefaultTransport.RoundTrip(req)
+		}),
+	}))
+	e.apiBaseURL = srv.URL
+
+	opts := testChatOptions()
+	opts.Ctx = context.WithValue(context.Background(), tenantKey{}, "tenant-1")
+	_, err := e.ChatCompletion(context.Background(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, "tenant-1", tenant)
+}
+
+func TestChatCompletionOptionsContextCancel(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	})
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	t.Run("options context canceled", func(t *testing.T) {
+		optsCtx, cancel := context.WithCancel(context.Background())
+		opts := testChatOptions()
+		opts.Ctx = optsCtx
+		time.AfterFunc(20*time.Millisecond, cancel)
+		_, err := e.ChatCompletion(context.Background(), opts)
+		assert.True(t, errors.Is(err, context.Canceled), err)
+	})
+	t.Run("earlier deadline of options context", func(t *testing.T) {
+		optsCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		ctx, cancel2 := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel2()
+		opts := testChatOptions()
+		opts.Ctx = optsCtx
+		_, err := e.ChatCompletion(ctx, opts)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), err)
+	})
+	t.Run("earlier deadline of call context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		opts := testChatOptions()
+		opts.Ctx = context.Background()
+		_, err := e.ChatCompletion(ctx, opts)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), err)
+	})
+}
+
+func TestMergeContextDeadline(t *testing.T) {
+	early := time.Now().Add(time.Minute)
+	late := early.Add(time.Hour)
+	a, cancelA := context.WithDeadline(context.Background(), late)
+	defer cancelA()
+	b, cancelB := context.WithDeadline(context.Background(), early)
+	defer cancelB()
+
+	ctx, cancel := mergeContext(a, b)
+	defer cancel()
+	d, ok := ctx.Deadline()
+	require.True(t, ok)
+	assert.Equal(t, early, d)
+}
+
+func TestChatCompletionRaw(t *testing.T) {
+	body := `{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"}}],` +
+		`"usage":{"prompt_tokens":9,"completion_tokens":3,"total_tokens":12},"service_tier":"flex"}`
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var opts map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&opts))
+		switch opts["model"] {
+		case "invalid":
+			w.Write([]byte(`{"id":"chatcmpl-1",`))
+		case "error":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"invalid model","type":"invalid_request_error"}}`))
+		default:
+			assert.EqualValues(t, defaultMaxTokens, opts["max_tokens"], "the defaults apply")
+			w.Write([]byte(body))
+		}
+	})
+	agg := &UsageAggregator{}
+	e := New("test", WithUsageAggregation(agg))
+	e.apiBaseURL = srv.URL
+
+	raw, err := e.ChatCompletionRaw(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	assert.JSONEq(t, body, string(raw))
+	var resp struct {
+		ServiceTier string `json:"service_tier"`
+	}
+	require.NoError(t, json.Unmarshal(raw, &resp))
+	assert.Equal(t, "flex", resp.ServiceTier, "the fields unknown to the library are kept")
+	assert.Equal(t, int64(12), agg.Summary()[ModelGPT3Dot5Turbo].TotalTokens)
+
+	opts := testChatOptions()
+	opts.Model = "invalid"
+	_, err = e.ChatCompletionRaw(context.Background(), opts)
+	assert.Error(t, err, "the body must be valid JSON")
+	opts.Model = "error"
+	_, err = e.ChatCompletionRaw(context.Background(), opts)
+	var apiErr APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "invalid model", apiErr.Err.Message)
+	_, err = e.ChatCompletionRaw(context.Background(), &ChatCompletionOptions{})
+	assert.Error(t, err, "the options are validated")
+}
+
+func TestUpdateChatCompletion(t *testing.T) {
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/chat/completions/chatcmpl-1", r.URL.Path)
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]interface{}{"metadata": map[string]interface{}{"tenant": "acme"}}, body)
+		w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","metadata":{"tenant":"acme"}}`))
+	})
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	r, err := e.UpdateChatCompletion(context.Background(), "chatcmpl-1", map[string]string{"tenant": "acme"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"tenant": "acme"}, r.Metadata)
+}
+
+func TestChatCompletionStream(t *testing.T) {
+	e := newChatStreamServer(t, []string{"Hel", "lo"}, nil)
+	s, err := e.ChatCompletionStream(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	defer s.Close()
+	var content string
+	for {
+		chunk, err := s.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		assert.Equal(t, "chatcmpl-1", chunk.Id)
+		content += chunk.Choices[0].Delta.Content
+	}
+	assert.Equal(t, "Hello", content)
+}
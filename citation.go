@@ -0,0 +1,307 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// AnnotationURLCitation is the type of the annotation of the chat message which cites the web page.
+const AnnotationURLCitation = "url_citation"
+
+// ChatAnnotation is the annotation of the generated chat message.
+type ChatAnnotation struct {
+	// Type of the annotation, AnnotationURLCitation.
+	Type        string       `json:"type"`
+	URLCitation *URLCitation `json:"url_citation,omitempty"`
+}
+
+// URLCitation cites the web page from the part of the message content between StartIndex and EndIndex.
+type URLCitation struct {
+	StartIndex int    `json:"start_index"`
+	EndIndex   int    `json:"end_index"`
+	URL        string `json:"url"`
+	Title      string `json:"title"`
+}
+
+// CitationMode controls how ExtractText treats the citation markers of the text.
+type CitationMode int
+
+const (
+	// CitationStrip removes the markers.
+	CitationStrip CitationMode = iota
+	// CitationFootnotes replaces the markers with footnote references, e.g. [1], numbered in the
+	// order of ExtractedText.Sources. The same source cited many times keeps its number.
+	CitationFootnotes
+	// CitationPreserve keeps the markers as they are.
+	CitationPreserve
+)
+
+// CitationSource is the source cited by the text, either the web page or the file.
+type CitationSource struct {
+	// Type of the citation, AnnotationURLCitation or AnnotationFileCitation.
+	Type  string
+	URL   string
+	Title string
+	// The cited file and quote, see ResolveAnnotations for the name of the file.
+	FileId string
+	Quote  string
+}
+
+// ExtractedText is the text returned by ExtractText.
+type ExtractedText struct {
+	Text string
+	// Sources cited by the text in the order they are cited first, Sources[0] is footnote [1].
+	Sources []CitationSource
+}
+
+// AnnotatedText is the text with citation annotations: ChatMessage, ThreadMessage or ThreadMessageText.
+type AnnotatedText interface {
+	annotatedText() (string, []textCitation)
+}
+
+// textCitation is the citation of the text between start and end, marker is the cited text if it's known.
+type textCitation struct {
+	start, end int
+	marker     string
+	source     CitationSource
+}
+
+func (m ChatMessage) annotatedText() (string, []textCitation) {
+	var citations []textCitation
+	for _, a := range m.Annotations {
+		if a.URLCitation == nil {
+			continue
+		}
+		citations = append(citations, textCitation{
+			start: a.URLCitation.StartIndex,
+			end:   a.URLCitation.EndIndex,
+			source: CitationSource{
+				Type:  AnnotationURLCitation,
+				URL:   a.URLCitation.URL,
+				Title: a.URLCitation.Title,
+			},
+		})
+	}
+	return m.Content, citations
+}
+
+func (t *ThreadMessageText) annotatedText() (string, []textCitation) {
+	var citations []textCitation
+	for _, a := range t.Annotations {
+		if a.URLCitation != nil {
+			citations = append(citations, textCitation{
+				start:  a.StartIndex,
+				end:    a.EndIndex,
+				marker: a.Text,
+				source: CitationSource{
+					Type:  AnnotationURLCitation,
+					URL:   a.URLCitation.URL,
+					Title: a.URLCitation.Title,
+				},
+			})
+			continue
+		}
+		if a.FileCitation == nil {
+			continue // file paths are links to generated files, not citations
+		}
+		citations = append(citations, textCitation{
+			start:  a.StartIndex,
+			end:    a.EndIndex,
+			marker: a.Text,
+			source: CitationSource{
+				Type:   AnnotationFileCitation,
+				FileId: a.FileCitation.FileId,
+				Quote:  a.FileCitation.Quote,
+			},
+		})
+	}
+	return t.Value, citations
+}
+
+// annotatedText joins the text contents of the message with blank lines.
+func (m *ThreadMessage) annotatedText() (string, []textCitation) {
+	var (
+		b         strings.Builder
+		citations []textCitation
+	)
+	for _, content := range m.Content {
+		if content.Text == nil {
+			continue
+		}
+		if b.Len() != 0 {
+			b.WriteString("\n\n")
+		}
+		text, cs := content.Text.annotatedText()
+		for _, c := range resolveCitations(text, cs) {
+			c.start += b.Len()
+			c.end += b.Len()
+			c.marker = "" // the offsets are resolved already
+			citations = append(citations, c)
+		}
+		b.WriteString(text)
+	}
+	return b.String(), citations
+}
+
+// ExtractText returns the text of msg with the citation markers treated according to mode,
+// along with the cited sources.
+//
+// Offsets of annotations are byte offsets into the text. Annotations of thread messages carry the
+// marker they annotate, e.g. "【4:0†source】", which is looked up if the offsets don't point to it, e.g.
+// because they count characters rather than bytes. Offsets which don't fall on the character
+// boundaries are widened to the whole characters, annotations out of the text are ignored.
+// Overlapping annotations are treated as the single marker citing all of their sources.
+//
+// When markers are stripped or replaced with footnotes, the spaces before them are removed
+// too, unless the marker is followed by a letter or digit, e.g. "in 2024 【4:0†source】." becomes
+// "in 2024." or "in 2024[1].".
+func ExtractText(msg AnnotatedText, mode CitationMode) ExtractedText {
+	text, citations := msg.annotatedText()
+	citations = resolveCitations(text, citations)
+
+	var (
+		out     strings.Builder
+		result  ExtractedText
+		numbers = make(map[CitationSource]int)
+		pos     int
+	)
+	number := func(source CitationSource) int {
+		key := CitationSource{Type: source.Type, URL: source.URL, FileId: source.FileId}
+		n, ok := numbers[key]
+		if !ok {
+			result.Sources = append(result.Sources, source)
+			n = len(result.Sources)
+			numbers[key] = n
+		}
+		return n
+	}
+	for i := 0; i < len(citations); {
+		start, end := citations[i].start, citations[i].end
+		group := []CitationSource{citations[i].source}
+		for i++; i < len(citations) && citations[i].start < end; i++ {
+			end = max(end, citations[i].end)
+			group = append(group, citations[i].source)
+		}
+		out.WriteString(text[pos:start])
+		pos = end
+		if mode == CitationPreserve {
+			out.WriteString(text[start:end])
+			for _, source := range group {
+				number(source)
+			}
+			continue
+		}
+		if next, _ := utf8.DecodeRuneInString(text[end:]); end == len(text) || !unicode.IsLetter(next) && !unicode.IsDigit(next) {
+			trimmed := strings.TrimRight(out.String(), " \t")
+			out.Reset()
+			out.WriteString(trimmed)
+		}
+		for _, source := range group {
+			n := number(source)
+			if mode == CitationFootnotes {
+				fmt.Fprintf(&out, "[%d]", n)
+			}
+		}
+	}
+	out.WriteString(text[pos:])
+	result.Text = out.String()
+	return result
+}
+
+// resolveCitations returns the citations which point into the text, with the offsets fixed
+// to the character boundaries, sorted by offsets.
+func resolveCitations(text string, citations []textCitation) []textCitation {
+	resolved := make([]textCitation, 0, len(citations))
+	for _, c := range citations {
+		start, end, ok := resolveSpan(text, c.start, c.end, c.marker)
+		if !ok {
+			continue
+		}
+		c.start, c.end = start, end
+		resolved = append(resolved, c)
+	}
+	sort.SliceStable(resolved, func(i, j int) bool {
+		if resolved[i].start != resolved[j].start {
+			return resolved[i].start < resolved[j].start
+		}
+		return resolved[i].end < resolved[j].end
+	})
+	return resolved
+}
+
+func resolveSpan(text string, start, end int, marker string) (int, int, bool) {
+	if marker != "" {
+		if 0 <= start && start <= end && end <= len(text) && text[start:end] == marker {
+			return start, end, true
+		}
+		// The offsets may count characters rather than bytes
+		if s, e, ok := runeSpan(text, start, end); ok && text[s:e] == marker {
+			return s, e, true
+		}
+		// Otherwise the occurrence of the marker closest to the start is taken
+		best := -1
+		for i := 0; ; {
+			j := strings.Index(text[i:], marker)
+			if j < 0 {
+				break
+			}
+			if best < 0 || abs(i+j-start) < abs(best-start) {
+				best = i + j
+			}
+			i += j + len(marker)
+		}
+		if best < 0 {
+			return 0, 0, false
+		}
+		return best, best + len(marker), true
+	}
+	if start < 0 || start >= end || start >= len(text) {
+		return 0, 0, false
+	}
+	end = min(end, len(text))
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+	return start, end, true
+}
+
+// runeSpan converts the character offsets into byte offsets.
+func runeSpan(text string, start, end int) (int, int, bool) {
+	if start < 0 || start > end {
+		return 0, 0, false
+	}
+	s, e, n := -1, -1, 0
+	for i := range text {
+		if n == start {
+			s = i
+		}
+		if n == end {
+			e = i
+			break
+		}
+		n++
+	}
+	if n == end && e < 0 {
+		e = len(text)
+	}
+	if s < 0 && start == end && e == len(text) {
+		s = e
+	}
+	return s, e, s >= 0 && e >= 0
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// byteSpan returns the byte offsets of the first occurrence of marker in text.
+func byteSpan(t *testing.T, text, marker string) (int, int) {
+	i := strings.Index(text, marker)
+	require.GreaterOrEqual(t, i, 0, marker)
+	return i, i + len(marker)
+}
+
+// charSpan returns the character offsets of the first occurrence of marker in text.
+func charSpan(t *testing.T, text, marker string) (int, int) {
+	start, end := byteSpan(t, text, marker)
+	return utf8.RuneCountInString(text[:start]), utf8.RuneCountInString(text[:end])
+}
+
+func urlCitation(t *testing.T, text, marker, url string) ChatAnnotation {
+	start, end := byteSpan(t, text, marker)
+	return ChatAnnotation{Type: AnnotationURLCitation, URLCitation: &URLCitation{StartIndex: start, EndIndex: end, URL: url, Title: url}}
+}
+
+type citationGolden struct {
+	strip, footnotes string
+	sources          []string
+}
+
+func assertCitationGolden(t *testing.T, msg AnnotatedText, want citationGolden) {
+	t.Helper()
+	for mode, text := range map[CitationMode]string{CitationStrip: want.strip, CitationFootnotes: want.footnotes} {
+		got := ExtractText(msg, mode)
+		assert.Equal(t, text, got.Text, "mode %d", mode)
+		var sources []string
+		for _, s := range got.Sources {
+			sources = append(sources, s.URL+s.FileId)
+		}
+		assert.Equal(t, want.sources, sources, "mode %d", mode)
+	}
+	preserved, _ := msg.annotatedText()
+	assert.Equal(t, preserved, ExtractText(msg, CitationPreserve).Text)
+}
+
+func TestExtractTextChat(t *testing.T) {
+	content := "東京は日本の首都です ([ja.wikipedia.org](https://ja.wikipedia.org/wiki/東京))。" +
+		"Paris est la capitale de la France ([fr.wikipedia.org](https://fr.wikipedia.org/wiki/Paris)) et Zürich " +
+		"ist keine Hauptstadt ([de.wikipedia.org](https://de.wikipedia.org/wiki/Zürich))."
+	raw, err := json.Marshal(map[string]interface{}{
+		"role":    "assistant",
+		"content": content,
+		"annotations": []ChatAnnotation{
+			urlCitation(t, content, " ([fr.wikipedia.org](https://fr.wikipedia.org/wiki/Paris))", "https://fr.wikipedia.org/wiki/Paris"),
+			urlCitation(t, content, "([ja.wikipedia.org](https://ja.wikipedia.org/wiki/東京))", "https://ja.wikipedia.org/wiki/東京"),
+			urlCitation(t, content, "([de.wikipedia.org](https://de.wikipedia.org/wiki/Zürich))", "https://de.wikipedia.org/wiki/Zürich"),
+		},
+	})
+	require.NoError(t, err)
+	var msg ChatMessage
+	require.NoError(t, json.Unmarshal(raw, &msg))
+	require.Len(t, msg.Annotations, 3)
+
+	assertCitationGolden(t, msg, citationGolden{
+		strip:     "東京は日本の首都です。Paris est la capitale de la France et Zürich ist keine Hauptstadt.",
+		footnotes: "東京は日本の首都です[1]。Paris est la capitale de la France[2] et Zürich ist keine Hauptstadt[3].",
+		sources: []string{
+			"https://ja.wikipedia.org/wiki/東京",
+			"https://fr.wikipedia.org/wiki/Paris",
+			"https://de.wikipedia.org/wiki/Zürich",
+		},
+	})
+}
+
+func TestExtractTextOverlapping(t *testing.T) {
+	content := "Один источник (a) (b), снова (a)."
+	aStart, aEnd := byteSpan(t, content, "(a)")
+	bStart, bEnd := byteSpan(t, content, "(b)")
+	again := strings.LastIndex(content, "(a)")
+	msg := ChatMessage{Role: "assistant", Content: content, Annotations: []ChatAnnotation{
+		{Type: AnnotationURLCitation, URLCitation: &URLCitation{StartIndex: aStart, EndIndex: bEnd, URL: "https://a.example"}},
+		{Type: AnnotationURLCitation, URLCitation: &URLCitation{StartIndex: bStart, EndIndex: bEnd, URL: "https://b.example"}},
+		{Type: AnnotationURLCitation, URLCitation: &URLCitation{StartIndex: aStart, EndIndex: aEnd, URL: "https://c.example"}},
+		{Type: AnnotationURLCitation, URLCitation: &URLCitation{StartIndex: again, EndIndex: again + 3, URL: "https://a.example"}},
+		// Out of the text
+		{Type: AnnotationURLCitation, URLCitation: &URLCitation{StartIndex: len(content), EndIndex: len(content) + 5, URL: "https://d.example"}},
+	}}
+	assertCitationGolden(t, msg, citationGolden{
+		strip:     "Один источник, снова.",
+		footnotes: "Один источник[1][2][3], снова[2].",
+		sources:   []string{"https://c.example", "https://a.example", "https://b.example"},
+	})
+
+	// Offsets in the middle of the character are widened to the whole character
+	msg = ChatMessage{Content: "ß【1】ü", Annotations: []ChatAnnotation{
+		{Type: AnnotationURLCitation, URLCitation: &URLCitation{StartIndex: 3, EndIndex: len("ß【1】") - 1, URL: "https://e.example"}},
+	}}
+	assert.Equal(t, "ß[1]ü", ExtractText(msg, CitationFootnotes).Text)
+}
+
+func TestExtractTextThreadMessage(t *testing.T) {
+	first := "Der Himmel ist blau【4:0†source】【4:1†source】."
+	second := "天空是蓝色的 【5:0†source】，海也是。"
+	s0, e0 := charSpan(t, first, "【4:0†source】") // character offsets
+	s1, e1 := byteSpan(t, first, "【4:1†source】")
+	s2, e2 := byteSpan(t, second, "【5:0†source】")
+	msg := &ThreadMessage{Role: "assistant", Content: []ThreadMessageContent{
+		{Type: "text", Text: &ThreadMessageText{Value: first, Annotations: []Annotation{
+			{Type: AnnotationFileCitation, Text: "【4:0†source】", StartIndex: s0, EndIndex: e0, FileCitation: &FileCitation{FileId: "file-sky"}},
+			{Type: AnnotationFileCitation, Text: "【4:1†source】", StartIndex: s1, EndIndex: e1, FileCitation: &FileCitation{FileId: "file-color"}},
+			{Type: AnnotationFilePath, Text: "sandbox:/mnt/data/sky.png", StartIndex: 0, EndIndex: 3, FilePath: &FilePath{FileId: "file-png"}},
+		}}},
+		{Type: "image_file"},
+		{Type: "text", Text: &ThreadMessageText{Value: second, Annotations: []Annotation{
+			{Type: AnnotationFileCitation, Text: "【5:0†source】", StartIndex: s2 + 7, EndIndex: e2 + 7, FileCitation: &FileCitation{FileId: "file-sky"}},
+		}}},
+	}}
+	assertCitationGolden(t, msg, citationGolden{
+		strip:     "Der Himmel ist blau.\n\n天空是蓝色的，海也是。",
+		footnotes: "Der Himmel ist blau[1][2].\n\n天空是蓝色的[1]，海也是。",
+		sources:   []string{"file-sky", "file-color"},
+	})
+	assert.Equal(t, "Der Himmel ist blau[1][2].", ExtractText(msg.Content[0].Text, CitationFootnotes).Text)
+}
@@ -0,0 +1,293 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time of the engine: the retry backoff, the attempt timeouts of the
+// latency budget, the polling of fine-tuning jobs, the reconnects of event streams, the token
+// rate limiter and the cooldowns of the key pool all use it. Replace it with TestClock to run
+// time-dependent code without waiting.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Sleep blocks for d, or until ctx is done, in which case it returns ctx.Err().
+	Sleep(ctx context.Context, d time.Duration) error
+	// AfterFunc calls f in its own goroutine once d elapses. stop prevents the call, it reports
+	// whether it did, like time.Timer.Stop.
+	AfterFunc(d time.Duration, f func()) (stop func() bool)
+}
+
+// SystemClock returns the clock of the system, it's the default clock of the engine.
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) (stop func() bool) {
+	return time.AfterFunc(d, f).Stop
+}
+
+// withClockTimeout returns the copy of ctx which times out after d on the clock. For the system
+// clock it's the context with the deadline, the other clocks cancel it with the cause
+// context.DeadlineExceeded once d elapses on them.
+func withClockTimeout(ctx context.Context, clock Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := clock.(systemClock); ok {
+		return context.WithTimeout(ctx, d)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := clock.AfterFunc(d, func() {
+		cancel(context.DeadlineExceeded)
+	})
+	return ctx, func() {
+		stop()
+		cancel(context.Canceled)
+	}
+}
+
+// WithClock is used to set the clock of the engine. It's also set for the token rate limiter
+// and the key pool of the engine, unless their clock is set with SetClock.
+func WithClock(clock Clock) EngineOption {
+	return func(e *Engine) {
+		e.clock = clock
+	}
+}
+
+// shareClock sets the clock of the engine for its token rate limiter and key pool which have none.
+func (e *Engine) shareClock() {
+	if e.clock == nil {
+		e.clock = systemClock{}
+	}
+	if _, ok := e.clock.(systemClock); ok {
+		return
+	}
+	if l := e.embeddingsLimiter; l != nil {
+		l.mu.Lock()
+		if l.clock == nil {
+			l.clock = e.clock
+		}
+		l.mu.Unlock()
+	}
+	if p := e.keys; p != nil {
+		p.mu.Lock()
+		if p.clock == nil {
+			p.clock = e.clock
+		}
+		p.mu.Unlock()
+	}
+}
+
+// clockOrSystem returns clock, or the system clock if it's nil.
+func clockOrSystem(clock Clock) Clock {
+	if clock == nil {
+		return systemClock{}
+	}
+	return clock
+}
+
+// TestClock is the Clock which only moves when it's advanced, e.g. in tests:
+//
+//	clock := openai.NewTestClock(time.Unix(0, 0))
+//	e := openai.New(apiKey, openai.WithClock(clock))
+//	go e.ChatCompletion(ctx, opts) // the first attempt fails, the retry backs off
+//	clock.BlockUntil(1)            // waits for the backoff to start
+//	clock.Advance(time.Second)     // ends the backoff, the request is retried
+//
+// With SetAutoAdvance, sleeps advance the clock and return right away instead,
+// which runs sequential code through its waits instantly.
+type TestClock struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	now      time.Time
+	auto     bool
+	sleepers []*testSleeper
+	timers   []*testTimer
+	slept    []time.Duration
+}
+
+type testSleeper struct {
+	until time.Time
+	done  chan struct{}
+}
+
+type testTimer struct {
+	until time.Time
+	f     func()
+}
+
+// NewTestClock returns the clock which is stopped at now.
+func NewTestClock(now time.Time) *TestClock {
+	c := &TestClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the time of the clock.
+func (c *TestClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sleep blocks until the clock is advanced by d, or until ctx is done. With auto-advance
+// it advances the clock by d instead.
+func (c *TestClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.slept = append(c.slept, d)
+	if d <= 0 || c.auto {
+		var fired []func()
+		if d > 0 {
+			fired = c.advance(d)
+		}
+		c.mu.Unlock()
+		fire(fired)
+		return nil
+	}
+	s := &testSleeper{until: c.now.Add(d), done: make(chan struct{})}
+	c.sleepers = append(c.sleepers, s)
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		c.remove(s)
+		c.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// AfterFunc calls f once the clock is advanced by d, before Advance, or the sleep which
+// advances the clock, returns, so f must not use the clock. With auto-advance, the timer
+// doesn't advance the clock itself, it's fired by the sleeps which do.
+func (c *TestClock) AfterFunc(d time.Duration, f func()) (stop func() bool) {
+	if d <= 0 {
+		f()
+		return func() bool { return false }
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &testTimer{until: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, other := range c.timers {
+			if other == t {
+				c.timers = append(c.timers[:i], c.timers[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Advance moves the clock forward by d and wakes up the sleepers and fires the timers it passes.
+func (c *TestClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	fired := c.advance(d)
+	c.mu.Unlock()
+	fire(fired)
+}
+
+// advance moves the clock forward by d, it returns the functions of the timers it passes,
+// which are called once the lock is released.
+func (c *TestClock) advance(d time.Duration) (fired []func()) {
+	c.now = c.now.Add(d)
+	sort.SliceStable(c.sleepers, func(i, j int) bool { return c.sleepers[i].until.Before(c.sleepers[j].until) })
+	n := 0
+	for _, s := range c.sleepers {
+		if s.until.After(c.now) {
+			c.sleepers[n] = s
+			n++
+			continue
+		}
+		close(s.done)
+	}
+	c.sleepers = c.sleepers[:n]
+	n = 0
+	for _, t := range c.timers {
+		if t.until.After(c.now) {
+			c.timers[n] = t
+			n++
+			continue
+		}
+		fired = append(fired, t.f)
+	}
+	c.timers = c.timers[:n]
+	c.cond.Broadcast()
+	return fired
+}
+
+func fire(fired []func()) {
+	for _, f := range fired {
+		f()
+	}
+}
+
+func (c *TestClock) remove(s *testSleeper) {
+	for i, other := range c.sleepers {
+		if other == s {
+			c.sleepers = append(c.sleepers[:i], c.sleepers[i+1:]...)
+			break
+		}
+	}
+	c.cond.Broadcast()
+}
+
+// SetAutoAdvance makes sleeps advance the clock and return right away, rather than wait for Advance.
+func (c *TestClock) SetAutoAdvance(auto bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.auto = auto
+}
+
+// BlockUntil blocks until n goroutines are sleeping on the clock.
+func (c *TestClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.sleepers) < n {
+		c.cond.Wait()
+	}
+}
+
+// Sleepers returns the number of goroutines sleeping on the clock.
+func (c *TestClock) Sleepers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.sleepers)
+}
+
+// Slept returns the durations of all sleeps on the clock in order, including the ones in progress.
+func (c *TestClock) Slept() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.slept...)
+}
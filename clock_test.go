@@ -0,0 +1,163 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRetryServer(t *testing.T, failures int32, retryAfter string) (*httptest.Server, *int32) {
+	var n int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&n, 1) <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, `{"error":{"message":"overloaded"}}`)
+			return
+		}
+		fmt.Fprintln(w, `{"data":[]}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &n
+}
+
+func TestRetryBackoffOnTestClock(t *testing.T) {
+	srv, n := newRetryServer(t, 2, "")
+	clock := NewTestClock(time.Unix(1700000000, 0))
+	e := New("test", WithClock(clock))
+	e.apiBaseURL = srv.URL
+	e.SetMaxRetries(2)
+
+	done := make(chan error)
+	go func() {
+		_, err := e.ListModels(context.Background())
+		done <- err
+	}()
+
+	clock.BlockUntil(1)
+	assert.EqualValues(t, 1, atomic.LoadInt32(n))
+	clock.Advance(defaultRetryBaseDelay - time.Millisecond)
+	assert.Equal(t, 1, clock.Sleepers(), "the backoff isn't over yet")
+	clock.Advance(time.Millisecond)
+
+	clock.BlockUntil(1)
+	assert.EqualValues(t, 2, atomic.LoadInt32(n))
+	clock.Advance(2 * defaultRetryBaseDelay)
+
+	require.NoError(t, <-done)
+	assert.EqualValues(t, 3, atomic.LoadInt32(n))
+	assert.Equal(t, []time.Duration{defaultRetryBaseDelay, 2 * defaultRetryBaseDelay}, clock.Slept())
+}
+
+func TestRetryAfterOnTestClock(t *testing.T) {
+	srv, n := newRetryServer(t, 1, "7")
+	clock := newAutoClock()
+	e := New("test", WithClock(clock))
+	e.apiBaseURL = srv.URL
+	e.SetMaxRetries(1)
+
+	start := clock.Now()
+	_, err := e.ListModels(context.Background())
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, atomic.LoadInt32(n))
+	assert.Equal(t, []time.Duration{7 * time.Second}, clock.Slept())
+	assert.Equal(t, 7*time.Second, clock.Now().Sub(start))
+}
+
+func TestRetryBackoffCanceled(t *testing.T) {
+	srv, n := newRetryServer(t, 1, "")
+	clock := NewTestClock(time.Unix(1700000000, 0))
+	e := New("test", WithClock(clock))
+	e.apiBaseURL = srv.URL
+	e.SetMaxRetries(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := e.ListModels(ctx)
+		done <- err
+	}()
+	clock.BlockUntil(1)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.EqualValues(t, 1, atomic.LoadInt32(n))
+	assert.Zero(t, clock.Sleepers())
+}
+
+func TestTestClockSleep(t *testing.T) {
+	clock := NewTestClock(time.Unix(0, 0))
+	assert.NoError(t, clock.Sleep(context.Background(), 0))
+
+	done := make(chan error)
+	go func() { done <- clock.Sleep(context.Background(), 2*time.Second) }()
+	go func() { done <- clock.Sleep(context.Background(), time.Second) }()
+	clock.BlockUntil(2)
+	clock.Advance(time.Second)
+	assert.NoError(t, <-done)
+	assert.Equal(t, 1, clock.Sleepers())
+	clock.Advance(time.Second)
+	assert.NoError(t, <-done)
+	assert.Equal(t, time.Unix(2, 0), clock.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, clock.Sleep(ctx, time.Second), context.Canceled)
+
+	clock.SetAutoAdvance(true)
+	assert.NoError(t, clock.Sleep(context.Background(), time.Minute))
+	assert.Equal(t, time.Unix(62, 0), clock.Now())
+}
+
+func TestTestClockAfterFunc(t *testing.T) {
+	clock := NewTestClock(time.Unix(0, 0))
+	var fired []string
+	clock.AfterFunc(2*time.Second, func() { fired = append(fired, "2s") })
+	stop := clock.AfterFunc(time.Second, func() { fired = append(fired, "stopped") })
+	clock.AfterFunc(time.Second, func() { fired = append(fired, "1s") })
+	assert.True(t, stop())
+	assert.False(t, stop(), "the timer is stopped once")
+
+	clock.Advance(time.Second)
+	assert.Equal(t, []string{"1s"}, fired, "the timers are fired before Advance returns")
+	clock.SetAutoAdvance(true)
+	require.NoError(t, clock.Sleep(context.Background(), time.Second))
+	assert.Equal(t, []string{"1s", "2s"}, fired, "the sleeps advancing the clock fire the timers")
+
+	ctx, cancel := withClockTimeout(context.Background(), clock, time.Second)
+	defer cancel()
+	assert.NoError(t, ctx.Err(), "the timer doesn't advance the clock")
+	clock.Advance(time.Second)
+	assert.ErrorIs(t, context.Cause(ctx), context.DeadlineExceeded)
+}
+
+func TestWithClockShared(t *testing.T) {
+	clock := NewTestClock(time.Unix(1700000000, 0))
+	limiter := NewTokenRateLimiter(100)
+	pool := NewKeyPool("a", "b")
+	e := New("test", WithEmbeddingsTokenLimit(limiter), WithKeyPool(pool), WithClock(clock))
+	assert.Same(t, clock, e.clock)
+	assert.Same(t, clock, limiter.clock)
+	assert.Same(t, clock, pool.clock)
+
+	own := NewTestClock(time.Unix(0, 0))
+	limiter = NewTokenRateLimiter(100)
+	limiter.SetClock(own)
+	New("test", WithEmbeddingsTokenLimit(limiter), WithClock(clock))
+	assert.Same(t, own, limiter.clock, "the clock set with SetClock is kept")
+
+	limiter = NewTokenRateLimiter(100)
+	New("test", WithEmbeddingsTokenLimit(limiter))
+	assert.Nil(t, limiter.clock, "the system clock is used")
+}
@@ -5,7 +5,9 @@ package openai
 
 import (
 	"context"
+	"io"
 	"net/http"
+	"sort"
 )
 
 type CompletionOptions struct {
@@ -25,23 +27,44 @@ type CompletionOptions struct {
 	// Up to 4 sequences where the API will stop generating further tokens.
 	// The returned text will not contain the stop sequence.
 	Stop []string `json:"stop,omitempty"`
+	// Include the log probabilities on the logprobs most likely tokens, as well the chosen tokens.
+	// The maximum value for logprobs is 5.
+	Logprobs int `json:"logprobs,omitempty" binding:"omitempty,max=5"`
+	// Echo back the prompt in addition to the completion.
+	Echo bool `json:"echo,omitempty"`
+}
+
+// withDefaults returns the copy of opts with the default max tokens set.
+func (opts *CompletionOptions) withDefaults() *CompletionOptions {
+	out := *opts
+	if out.MaxTokens == 0 {
+		out.MaxTokens = defaultMaxTokens
+	}
+	return &out
+}
+
+// CompletionLogprobs holds the log probabilities of the completion tokens.
+type CompletionLogprobs struct {
+	Tokens        []string             `json:"tokens"`
+	TokenLogprobs []float64            `json:"token_logprobs"`
+	TopLogprobs   []map[string]float64 `json:"top_logprobs"`
+	TextOffset    []int                `json:"text_offset"`
+}
+
+type CompletionChoice struct {
+	Text         string              `json:"text"`
+	Index        int                 `json:"index"`
+	Logprobs     *CompletionLogprobs `json:"logprobs,omitempty"`
+	FinishReason string              `json:"finish_reason"`
 }
 
 type CompletionResponse struct {
-	Id      string `json:"id"`
-	Object  string `json:"object"`
-	Created int    `json:"created"`
-	Model   Model  `json:"model"`
-	Choices []struct {
-		Text         string `json:"text"`
-		Index        int    `json:"index"`
-		FinishReason string `json:"finish_reason"`
-	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	Id      string             `json:"id"`
+	Object  string             `json:"object"`
+	Created int                `json:"created"`
+	Model   Model              `json:"model"`
+	Choices []CompletionChoice `json:"choices"`
+	Usage   Usage              `json:"usage"`
 }
 
 // Completion given a prompt, the model will return one or more predicted completions,
@@ -50,13 +73,12 @@ type CompletionResponse struct {
 // The default number of tokens to complete is 1024.
 // Docs: https://beta.openai.com/docs/api-reference/completions
 func (e *Engine) Completion(ctx context.Context, opts *CompletionOptions) (*CompletionResponse, error) {
-	if err := e.validate.StructCtx(ctx, opts); err != nil {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
 		return nil, err
 	}
 	uri := e.apiBaseURL + "/completions"
-	if opts.MaxTokens == 0 {
-		opts.MaxTokens = defaultMaxTokens
-	}
+	ctx = withRequestInfo(ctx, "/completions", opts.Model)
+	opts = opts.withDefaults()
 	r, err := marshalJson(opts)
 	if err != nil {
 		return nil, err
@@ -74,5 +96,131 @@ func (e *Engine) Completion(ctx context.Context, opts *CompletionOptions) (*Comp
 	if err := unmarshal(resp, &jsonResp); err != nil {
 		return nil, err
 	}
+	e.recordUsage(opts.Model, jsonResp.Usage)
 	return &jsonResp, nil
 }
+
+// CompletionStream is a stream of completion chunks, it must be closed after use.
+type CompletionStream struct {
+	resp   *http.Response
+	reader *sseReader
+}
+
+// CompletionStreamResponse is a single chunk of the streamed completion.
+// Choices of the chunk carry only the text generated since the previous chunk.
+type CompletionStreamResponse struct {
+	Id      string             `json:"id"`
+	Object  string             `json:"object"`
+	Created int                `json:"created"`
+	Model   Model              `json:"model"`
+	Choices []CompletionChoice `json:"choices"`
+}
+
+// CompletionStream is like Completion, but the completion is streamed back as it's generated.
+//
+// When multiple prompts are set, or N is greater than one, chunks of different choices are interleaved.
+// Choices are identified by their index, which is prompt index * N + choice index.
+//
+// Docs: https://platform.openai.com/docs/api-reference/completions/create#completions/create-stream
+func (e *Engine) CompletionStream(ctx context.Context, opts *CompletionOptions) (*CompletionStream, error) {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	uri := e.apiBaseURL + "/completions"
+	ctx = withRequestInfo(ctx, "/completions", opts.Model)
+	opts = opts.withDefaults()
+	r, err := marshalJson(struct {
+		*CompletionOptions
+		Stream bool `json:"stream"`
+	}{opts, true})
+	if err != nil {
+		return nil, err
+	}
+	req, err := e.newReq(ctx, http.MethodPost, uri, "json", r)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.doReq(req)
+	if err != nil {
+		return nil, err
+	}
+	return &CompletionStream{resp: resp, reader: newSSEReader(resp.Body)}, nil
+}
+
+// Recv returns the next chunk of the stream. It returns io.EOF when the stream is finished,
+// ErrStreamCanceled if the context of the request is done, StreamAPIError if the server
+// reported the error, StreamProtocolError if the chunk is malformed, or StreamClosedUnexpectedly,
+// which matches ErrStreamClosed, if the stream ended before it was finished.
+func (s *CompletionStream) Recv() (*CompletionStreamResponse, error) {
+	var chunk CompletionStreamResponse
+	if err := s.reader.decode(&chunk); err != nil {
+		return nil, streamError(s.resp.Request.Context(), err)
+	}
+	return &chunk, nil
+}
+
+// Close closes the stream. The connection is reused if the stream was
+// read to the end, otherwise it's closed.
+func (s *CompletionStream) Close() error {
+	if s.reader.done {
+		drainBody(s.resp.Body)
+		return nil
+	}
+	return s.resp.Body.Close()
+}
+
+// Collect reads the stream until it is finished and assembles the chunks into
+// the response, as it would be returned by Completion. Choices are sorted by index.
+// The stream is closed afterwards.
+//
+// The usage isn't reported by the streaming endpoint and is left empty.
+func (s *CompletionStream) Collect() (*CompletionResponse, error) {
+	defer s.Close()
+	var (
+		result  CompletionResponse
+		choices = make(map[int]*CompletionChoice)
+	)
+	for {
+		chunk, err := s.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.Id, result.Object, result.Created, result.Model = chunk.Id, chunk.Object, chunk.Created, chunk.Model
+		for _, delta := range chunk.Choices {
+			choice, ok := choices[delta.Index]
+			if !ok {
+				choice = &CompletionChoice{Index: delta.Index}
+				choices[delta.Index] = choice
+			}
+			// With echo the prompt arrives as the first delta of the choice,
+			// so it's appended once like any other text.
+			choice.Text += delta.Text
+			if delta.Logprobs != nil {
+				if choice.Logprobs == nil {
+					choice.Logprobs = &CompletionLogprobs{}
+				}
+				choice.Logprobs.append(delta.Logprobs)
+			}
+			if delta.FinishReason != "" {
+				choice.FinishReason = delta.FinishReason
+			}
+		}
+	}
+	for _, choice := range choices {
+		result.Choices = append(result.Choices, *choice)
+	}
+	sort.Slice(result.Choices, func(i, j int) bool {
+		return result.Choices[i].Index < result.Choices[j].Index
+	})
+	return &result, nil
+}
+
+func (l *CompletionLogprobs) append(delta *CompletionLogprobs) {
+	l.Tokens = append(l.Tokens, delta.Tokens...)
+	l.TokenLogprobs = append(l.TokenLogprobs, delta.TokenLogprobs...)
+	l.TopLogprobs = append(l.TopLogprobs, delta.TopLogprobs...)
+	l.TextOffset = append(l.TextOffset, delta.TextOffset...)
+}
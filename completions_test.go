@@ -6,9 +6,16 @@ package openai
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCompletion(t *testing.T) {
@@ -28,3 +35,90 @@ func TestCompletion(t *testing.T) {
 		log.Println(string(b))
 	}
 }
+
+func newCompletionStreamServer(t *testing.T, frames []string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, true, body["stream"])
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, f := range frames {
+			fmt.Fprintf(w, "data: %s\n\n", f)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+}
+
+func TestCompletionStreamInterleaved(t *testing.T) {
+	srv := newCompletionStreamServer(t, []string{
+		`{"id":"cmpl-1","object":"text_completion","model":"gpt-3.5-turbo-instruct","choices":[{"text":"Hel","index":0}]}`,
+		`{"id":"cmpl-1","object":"text_completion","model":"gpt-3.5-turbo-instruct","choices":[{"text":"Bon","index":1}]}`,
+		`{"id":"cmpl-1","object":"text_completion","model":"gpt-3.5-turbo-instruct","choices":[{"text":"jour","index":1}]}`,
+		`{"id":"cmpl-1","object":"text_completion","model":"gpt-3.5-turbo-instruct","choices":[{"text":"lo","index":0}]}`,
+		`{"id":"cmpl-1","object":"text_completion","model":"gpt-3.5-turbo-instruct","choices":[{"text":"","index":1,"finish_reason":"stop"}]}`,
+		`{"id":"cmpl-1","object":"text_completion","model":"gpt-3.5-turbo-instruct","choices":[{"text":"","index":0,"finish_reason":"length"}]}`,
+	})
+	defer srv.Close()
+
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	s, err := e.CompletionStream(context.Background(), &CompletionOptions{
+		Model:  "gpt-3.5-turbo-instruct",
+		Prompt: []string{"Say hello", "Say hello in french"},
+	})
+	require.NoError(t, err)
+	r, err := s.Collect()
+	require.NoError(t, err)
+
+	assert.Equal(t, "cmpl-1", r.Id)
+	require.Len(t, r.Choices, 2)
+	assert.Equal(t, CompletionChoice{Text: "Hello", Index: 0, FinishReason: "length"}, r.Choices[0])
+	assert.Equal(t, CompletionChoice{Text: "Bonjour", Index: 1, FinishReason: "stop"}, r.Choices[1])
+}
+
+func TestCompletionStreamEcho(t *testing.T) {
+	srv := newCompletionStreamServer(t, []string{
+		`{"id":"cmpl-2","choices":[{"text":"1, 2,","index":0,"logprobs":{"tokens":["1",","," 2",","],"token_logprobs":[null,-0.1,-0.2,-0.3],"text_offset":[0,1,2,4]}}]}`,
+		`{"id":"cmpl-2","choices":[{"text":" 3","index":0,"logprobs":{"tokens":[" 3"],"token_logprobs":[-0.01],"text_offset":[5]}}]}`,
+		`{"id":"cmpl-2","choices":[{"text":"","index":0,"finish_reason":"stop"}]}`,
+	})
+	defer srv.Close()
+
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	s, err := e.CompletionStream(context.Background(), &CompletionOptions{
+		Model:    "gpt-3.5-turbo-instruct",
+		Prompt:   []string{"1, 2,"},
+		Echo:     true,
+		Logprobs: 1,
+	})
+	require.NoError(t, err)
+	r, err := s.Collect()
+	require.NoError(t, err)
+
+	require.Len(t, r.Choices, 1)
+	assert.Equal(t, "1, 2, 3", r.Choices[0].Text, "echoed prompt must appear once")
+	assert.Equal(t, []string{"1", ",", " 2", ",", " 3"}, r.Choices[0].Logprobs.Tokens)
+	assert.Equal(t, []int{0, 1, 2, 4, 5}, r.Choices[0].Logprobs.TextOffset)
+}
+
+func TestCompletionStreamRecv(t *testing.T) {
+	srv := newCompletionStreamServer(t, []string{
+		`{"id":"cmpl-3","choices":[{"text":"a","index":0}]}`,
+	})
+	defer srv.Close()
+
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	s, err := e.CompletionStream(context.Background(), &CompletionOptions{
+		Model:  "gpt-3.5-turbo-instruct",
+		Prompt: []string{"a"},
+	})
+	require.NoError(t, err)
+	defer s.Close()
+	chunk, err := s.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "a", chunk.Choices[0].Text)
+	_, err = s.Recv()
+	assert.Equal(t, io.EOF, err)
+}
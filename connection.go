@@ -0,0 +1,73 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrConnectionFailed is returned by TestConnection if the API can't be reached, e.g. the base
+// URL is wrong or the network is down. The error also wraps the error of the request.
+var ErrConnectionFailed = errors.New("openai: connection failed")
+
+// ConnectionTestResult is the result of TestConnection.
+type ConnectionTestResult struct {
+	// APIKeyValid reports whether the API key was accepted.
+	APIKeyValid bool
+	// The organization and the project of the API key, reported by the API.
+	OrganizationId string
+	ProjectId      string
+	// ModelsAccessible reports whether the API key has access to any model.
+	ModelsAccessible bool
+	// Latency is the duration of the request.
+	Latency time.Duration
+}
+
+// TestConnection is used to check the API key, the organization and the reachability of the base
+// URL with one request listing the models, e.g. before starting the long batch job. The request
+// isn't retried, so Latency is the one of a single round trip.
+//
+// The result is returned along with the error response of the API, e.g. the APIError of the rejected
+// API key, which matches ErrUnauthorized, or of the API key without access to the organization or
+// the project, which matches ErrForbidden. The error matching ErrConnectionFailed is returned
+// without the result if the API can't be reached.
+func (e *Engine) TestConnection(ctx context.Context) (*ConnectionTestResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	uri := e.apiBaseURL + "/models"
+	ctx = withRequestInfo(ContextWithMaxRetries(ctx, 0), "/models", "")
+	req, err := e.newReq(ctx, http.MethodGet, uri, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	start := e.clock.Now()
+	resp, err := e.doReq(req)
+	result := &ConnectionTestResult{Latency: e.clock.Now().Sub(start)}
+	if err != nil {
+		var apiErr APIError
+		switch {
+		case errors.As(err, &apiErr):
+			// The key is valid, but it has no access, e.g. to the organization of the engine
+			result.APIKeyValid = errors.Is(err, ErrForbidden)
+			return result, err
+		case ctx.Err() != nil:
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %w", ErrConnectionFailed, err)
+	}
+	result.APIKeyValid = true
+	result.OrganizationId = resp.Header.Get("OpenAI-Organization")
+	result.ProjectId = resp.Header.Get("OpenAI-Project")
+	var models ListModelsResponse
+	if err := unmarshal(resp, &models); err != nil {
+		return result, err
+	}
+	result.ModelsAccessible = len(models.Data) != 0
+	return result, nil
+}
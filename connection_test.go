@@ -0,0 +1,65 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestConnection(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/models", r.URL.Path)
+		switch r.Header.Get("Authorization") {
+		case "Bearer valid":
+			w.Header().Set("OpenAI-Organization", "org-acme")
+			w.Header().Set("OpenAI-Project", "proj_1")
+			w.Write([]byte(`{"object":"list","data":[{"id":"gpt-4o","object":"model","owned_by":"system"}]}`))
+		case "Bearer no-access":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":{"message":"You are not allowed to access this organization","type":"invalid_request_error"}}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"message":"Incorrect API key provided","type":"invalid_request_error","code":"invalid_api_key"}}`))
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	e := New("valid")
+	e.apiBaseURL = srv.URL
+	e.clock = newAutoClock() // the latency is zero
+	result, err := e.TestConnection(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &ConnectionTestResult{APIKeyValid: true, OrganizationId: "org-acme", ProjectId: "proj_1", ModelsAccessible: true}, result)
+
+	e = New("invalid")
+	e.apiBaseURL = srv.URL
+	result, err = e.TestConnection(ctx)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	assert.NotErrorIs(t, err, ErrForbidden)
+	require.NotNil(t, result)
+	assert.False(t, result.APIKeyValid)
+
+	e = New("no-access")
+	e.apiBaseURL = srv.URL
+	result, err = e.TestConnection(ctx)
+	assert.ErrorIs(t, err, ErrForbidden)
+	require.NotNil(t, result)
+	assert.True(t, result.APIKeyValid)
+	assert.False(t, result.ModelsAccessible)
+	assert.Equal(t, 3, requests)
+
+	e = New("valid")
+	e.apiBaseURL = "http://127.0.0.1:1"
+	_, err = e.TestConnection(ctx)
+	assert.ErrorIs(t, err, ErrConnectionFailed)
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"net/http"
+	"sync"
+)
+
+// The connection pool settings of the transport of the engine created by New. All the requests
+// of the engine go to the single host, api.openai.com, so the per-host limit of idle connections
+// of http.DefaultTransport, 2, makes every concurrent request above it open a new connection,
+// with its TCP and TLS handshakes, and close it afterwards. With the limit equal to the overall
+// limit of 100 the connections of up to 100 concurrent requests are reused, while the number of
+// idle sockets kept open stays bounded, see BenchmarkConnectionPooling. The number of connections
+// isn't limited, the concurrency is up to the caller, e.g. limited by the rate limits of the API.
+const (
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 100
+	DefaultMaxConnsPerHost     = 0
+)
+
+// connectionPool is the connection pool settings of http.Transport.
+type connectionPool struct {
+	maxIdle        int
+	maxIdlePerHost int
+	maxTotal       int
+}
+
+func (p connectionPool) apply(t *http.Transport) {
+	t.MaxIdleConns = p.maxIdle
+	t.MaxIdleConnsPerHost = p.maxIdlePerHost
+	t.MaxConnsPerHost = p.maxTotal
+}
+
+// defaultTransport is the transport of the engines created by New without WithHTTPClient,
+// it's shared by them like http.DefaultTransport is.
+var defaultTransport = sync.OnceValue(func() http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	connectionPool{
+		maxIdle:        DefaultMaxIdleConns,
+		maxIdlePerHost: DefaultMaxIdleConnsPerHost,
+		maxTotal:       DefaultMaxConnsPerHost,
+	}.apply(t)
+	return t
+})
+
+// WithConnectionPooling is used to configure the connection pool of the transport of the HTTP
+// client, if it's *http.Transport: the maximum number of idle connections, maxIdle, of idle
+// connections to the host, maxIdlePerHost, and of all the connections to the host, idle or
+// active, maxTotal. Zero is no limit, except for maxIdlePerHost, which is 2 then, see http.Transport.
+// The defaults are DefaultMaxIdleConns, DefaultMaxIdleConnsPerHost and DefaultMaxConnsPerHost.
+//
+// The client passed with WithHTTPClient isn't modified, a copy of it is used instead.
+func WithConnectionPooling(maxIdle, maxIdlePerHost, maxTotal int) EngineOption {
+	return func(e *Engine) {
+		e.connPool = &connectionPool{maxIdle: maxIdle, maxIdlePerHost: maxIdlePerHost, maxTotal: maxTotal}
+	}
+}
+
+// SetMaxIdleConnsPerHost is used to set the maximum number of idle connections to the host
+// of the connection pool, see WithConnectionPooling. It replaces the transport of the HTTP client
+// with its copy, so it should be called before requests are sent.
+func (e *Engine) SetMaxIdleConnsPerHost(n int) {
+	e.client = withTransport(e.client, func(t *http.Transport) {
+		t.MaxIdleConnsPerHost = n
+	})
+	if e.connPool != nil {
+		pool := *e.connPool
+		pool.maxIdlePerHost = n
+		e.connPool = &pool
+	}
+}
+
+// withConnectionPool returns a copy of client with the connection pool of its transport configured.
+func withConnectionPool(client *http.Client, pool connectionPool) *http.Client {
+	return withTransport(client, pool.apply)
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultConnectionPooling(t *testing.T) {
+	e := New("test")
+	transport := e.client.Transport.(*http.Transport)
+	assert.Equal(t, DefaultMaxIdleConns, transport.MaxIdleConns)
+	assert.Equal(t, DefaultMaxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, DefaultMaxConnsPerHost, transport.MaxConnsPerHost)
+	assert.Same(t, transport, New("test").client.Transport, "the default transport is shared")
+	assert.Equal(t, 0, http.DefaultTransport.(*http.Transport).MaxIdleConnsPerHost, "http.DefaultTransport isn't modified")
+}
+
+func TestWithConnectionPooling(t *testing.T) {
+	e := New("test", WithConnectionPooling(10, 5, 20))
+	transport := e.client.Transport.(*http.Transport)
+	assert.Equal(t, 10, transport.MaxIdleConns)
+	assert.Equal(t, 5, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 20, transport.MaxConnsPerHost)
+	assert.Equal(t, DefaultMaxIdleConnsPerHost, defaultTransport().(*http.Transport).MaxIdleConnsPerHost)
+
+	client := &http.Client{Transport: &http.Transport{}}
+	e = New("test", WithHTTPClient(client), WithConnectionPooling(10, 5, 20), WithDisableKeepAlive())
+	transport = e.client.Transport.(*http.Transport)
+	assert.Equal(t, 5, transport.MaxIdleConnsPerHost)
+	assert.True(t, transport.DisableKeepAlives)
+	assert.Zero(t, client.Transport.(*http.Transport).MaxIdleConnsPerHost, "the client passed by the caller isn't modified")
+
+	child, err := e.Clone(WithConnectionPooling(1, 1, 1))
+	require.NoError(t, err)
+	assert.Equal(t, 1, child.client.Transport.(*http.Transport).MaxIdleConnsPerHost)
+	assert.Equal(t, 5, e.client.Transport.(*http.Transport).MaxIdleConnsPerHost)
+}
+
+func TestSetMaxIdleConnsPerHost(t *testing.T) {
+	e := New("test")
+	e.SetMaxIdleConnsPerHost(7)
+	transport := e.client.Transport.(*http.Transport)
+	assert.Equal(t, 7, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, DefaultMaxIdleConns, transport.MaxIdleConns)
+	assert.Equal(t, DefaultMaxIdleConnsPerHost, defaultTransport().(*http.Transport).MaxIdleConnsPerHost)
+}
+
+func TestConnectionPoolingReuse(t *testing.T) {
+	const concurrency = 20
+	srv, conns := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		fmt.Fprintln(w, `{"data":[]}`)
+	})
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	for round := 0; round < 3; round++ {
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := e.ListModels(context.Background())
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+	}
+	assert.LessOrEqual(t, atomic.LoadInt32(conns), int32(concurrency), "idle connections are reused across rounds")
+}
+
+// BenchmarkConnectionPooling compares the throughput of bursts of concurrent requests over TLS
+// with the different limits of idle connections to the host. With the limit below the size of
+// the burst, the connections above it are closed once the burst is over, and the next burst opens
+// them again with the TLS handshakes, "conns/op" is the number of connections opened per burst.
+func BenchmarkConnectionPooling(b *testing.B) {
+	const concurrency = 64
+	for _, maxIdlePerHost := range []int{2, 16, 64, DefaultMaxIdleConnsPerHost} {
+		b.Run(fmt.Sprintf("maxIdlePerHost=%d", maxIdlePerHost), func(b *testing.B) {
+			var conns int32
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(time.Millisecond) // the latency of the API
+				fmt.Fprintln(w, `{"data":[]}`)
+			}))
+			srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					atomic.AddInt32(&conns, 1)
+				}
+			}
+			srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+			srv.StartTLS()
+			defer srv.Close()
+			e := New("test", WithHTTPClient(srv.Client()),
+				WithConnectionPooling(DefaultMaxIdleConns, maxIdlePerHost, DefaultMaxConnsPerHost))
+			e.apiBaseURL = srv.URL
+			defer e.client.CloseIdleConnections()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+				for j := 0; j < concurrency; j++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						if _, err := e.ListModels(context.Background()); err != nil {
+							b.Error(err)
+						}
+					}()
+				}
+				wg.Wait()
+			}
+			b.ReportMetric(float64(atomic.LoadInt32(&conns))/float64(b.N), "conns/op")
+		})
+	}
+}
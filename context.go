@@ -0,0 +1,94 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import "context"
+
+// mergedContext is canceled when either of contexts is done,
+// its values are looked up in both contexts.
+type mergedContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c mergedContext) Value(key interface{}) interface{} {
+	if v := c.Context.Value(key); v != nil {
+		return v
+	}
+	return c.values.Value(key)
+}
+
+// mergeContext merges the context of options into ctx. The merged context has the earlier deadline
+// of both contexts and is canceled when either of them is done. Values of ctx take precedence.
+// The returned function releases resources of the merged context and must be called after use.
+func mergeContext(ctx, optsCtx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if optsCtx == nil {
+		return ctx, func() {}
+	}
+	merged, cancel := context.WithCancelCause(ctx)
+	cancelDeadline := context.CancelFunc(func() {})
+	if d, ok := optsCtx.Deadline(); ok {
+		if cur, ok := merged.Deadline(); !ok || d.Before(cur) {
+			merged, cancelDeadline = context.WithDeadline(merged, d)
+		}
+	}
+	stop := context.AfterFunc(optsCtx, func() {
+		cancel(context.Cause(optsCtx))
+	})
+	return mergedContext{Context: merged, values: optsCtx}, func() {
+		stop()
+		cancelDeadline()
+		cancel(context.Canceled)
+	}
+}
+
+type responseInfoKey struct{}
+
+// responseInfo is the metadata of the response stored in the context by ChatCompletionWithContext.
+type responseInfo struct {
+	requestId        string
+	model            Model
+	promptTokens     int
+	completionTokens int
+}
+
+func withResponseInfo(ctx context.Context, info responseInfo) context.Context {
+	return context.WithValue(ctx, responseInfoKey{}, info)
+}
+
+func responseInfoFrom(ctx context.Context) (responseInfo, bool) {
+	if ctx == nil {
+		return responseInfo{}, false
+	}
+	info, ok := ctx.Value(responseInfoKey{}).(responseInfo)
+	return info, ok
+}
+
+// RequestIdFromContext returns the ID of the request assigned by the API.
+// It reports false if ctx doesn't carry the response metadata or the API didn't return the ID.
+func RequestIdFromContext(ctx context.Context) (string, bool) {
+	info, ok := responseInfoFrom(ctx)
+	return info.requestId, ok && info.requestId != ""
+}
+
+// ModelFromContext returns the model which generated the response.
+func ModelFromContext(ctx context.Context) (Model, bool) {
+	info, ok := responseInfoFrom(ctx)
+	return info.model, ok
+}
+
+// PromptTokensFromContext returns the number of tokens in the prompt.
+func PromptTokensFromContext(ctx context.Context) (int, bool) {
+	info, ok := responseInfoFrom(ctx)
+	return info.promptTokens, ok
+}
+
+// CompletionTokensFromContext returns the number of tokens in the generated completion.
+func CompletionTokensFromContext(ctx context.Context) (int, bool) {
+	info, ok := responseInfoFrom(ctx)
+	return info.completionTokens, ok
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCancelBeforeRequest(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	e.SetMaxRetries(3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := e.ChatCompletion(ctx, testChatOptions())
+	assert.ErrorIs(t, err, context.Canceled)
+	var apiErr APIError
+	assert.False(t, errors.As(err, &apiErr))
+	assert.Zero(t, atomic.LoadInt32(&calls))
+}
+
+func TestCancelDuringHeaders(t *testing.T) {
+	var calls int32
+	received := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		// The request context is only canceled once the body was read
+		io.Copy(io.Discard, r.Body)
+		received <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	e.clock = newAutoClock()
+	e.SetMaxRetries(3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-received
+		cancel()
+	}()
+	_, err := e.ChatCompletion(ctx, testChatOptions())
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls), "canceled request must not be retried")
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = e.ChatCompletion(ctx, testChatOptions())
+	<-received
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestCancelErrorResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := e.ChatCompletion(ctx, testChatOptions())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	var apiErr APIError
+	assert.False(t, errors.As(err, &apiErr))
+}
+
+// newInterruptedStreamServer sends the first chunk of the completion stream,
+// then waits for the client to go away if hang is set, or closes the stream otherwise.
+func newInterruptedStreamServer(t *testing.T, hang bool) *Engine {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"id\":\"cmpl-1\",\"choices\":[{\"text\":\"a\",\"index\":0}]}\n\n"))
+		w.(http.Flusher).Flush()
+		if hang {
+			<-r.Context().Done()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	return e
+}
+
+func TestCancelMidStream(t *testing.T) {
+	e := newInterruptedStreamServer(t, true)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := e.CompletionStream(ctx, &CompletionOptions{Model: "gpt-3.5-turbo-instruct", Prompt: []string{"a"}})
+	require.NoError(t, err)
+	defer s.Close()
+
+	_, err = s.Recv()
+	require.NoError(t, err)
+	cancel()
+	_, err = s.Recv()
+	assert.ErrorIs(t, err, ErrStreamCanceled)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, ErrStreamClosed)
+}
+
+func TestStreamClosedByServer(t *testing.T) {
+	e := newInterruptedStreamServer(t, false)
+	s, err := e.CompletionStream(context.Background(), &CompletionOptions{Model: "gpt-3.5-turbo-instruct", Prompt: []string{"a"}})
+	require.NoError(t, err)
+	defer s.Close()
+
+	_, err = s.Recv()
+	require.NoError(t, err)
+	_, err = s.Recv()
+	assert.ErrorIs(t, err, ErrStreamClosed)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.NotErrorIs(t, err, ErrStreamCanceled)
+	assert.NotErrorIs(t, err, context.Canceled)
+}
+
+func TestChatCompletionWithContext(t *testing.T) {
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req_123")
+		w.Write([]byte(`{"id":"chatcmpl-1","model":"gpt-3.5-turbo-0125","choices":[{"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":9,"completion_tokens":2,"total_tokens":11}}`))
+	})
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	parent := context.WithValue(context.Background(), tenantKey{}, "tenant-1")
+	r, ctx, err := e.ChatCompletionWithContext(parent, testChatOptions())
+	require.NoError(t, err)
+	assert.Equal(t, "req_123", r.RequestId)
+	assert.Equal(t, "tenant-1", ctx.Value(tenantKey{}))
+
+	requestId, ok := RequestIdFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "req_123", requestId)
+	model, ok := ModelFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, Model("gpt-3.5-turbo-0125"), model)
+	promptTokens, ok := PromptTokensFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, 9, promptTokens)
+	completionTokens, ok := CompletionTokensFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, 2, completionTokens)
+
+	_, ok = PromptTokensFromContext(parent)
+	assert.False(t, ok)
+	_, ok = RequestIdFromContext(parent)
+	assert.False(t, ok)
+}
+
+func TestChatCompletionWithContextError(t *testing.T) {
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"bad request","type":"invalid_request_error"}}`))
+	})
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	parent := context.Background()
+	r, ctx, err := e.ChatCompletionWithContext(parent, testChatOptions())
+	assert.Error(t, err)
+	assert.Nil(t, r)
+	assert.Equal(t, parent, ctx)
+	_, ok := ModelFromContext(ctx)
+	assert.False(t, ok)
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// ErrReplyModerated is returned by Conversation.Send when the reply of the model isn't allowed
+// by the moderation policy of the conversation.
+var ErrReplyModerated = errors.New("openai: reply not allowed by moderation policy")
+
+// Conversation is the multi-turn chat with the model, which keeps the history of the turns
+// and sends it with every request. The conversation can be forked to explore the different
+// continuations from the same point of the history, see Fork. It isn't safe for concurrent use,
+// fork it for every goroutine instead.
+type Conversation struct {
+	engine *Engine
+	// SystemPrompt is sent as the system message before the messages, if it's set.
+	SystemPrompt string
+	// Options of the chat completion requests. Their messages are ignored,
+	// the system prompt and the messages of the conversation are sent instead.
+	Options ChatCompletionOptions
+	// Messages are the turns of the conversation, without the system prompt.
+	Messages []ChatMessage
+	// ModerationPolicy, if it's set, is used to moderate the replies of the model before they're
+	// appended to the conversation, see Engine.ModerateResponse.
+	ModerationPolicy ModerationPolicy
+}
+
+// NewConversation is used to start the conversation with the model of opts through the engine.
+// opts is copied, so it isn't affected by the conversation.
+func NewConversation(e *Engine, systemPrompt string, opts *ChatCompletionOptions) *Conversation {
+	return &Conversation{engine: e, SystemPrompt: systemPrompt, Options: cloneChatCompletionOptions(*opts)}
+}
+
+// Send is used to send the user message with the content, and append the reply of the model
+// to the conversation, the first choice of the response. If the request fails, the conversation
+// is left as it was. If ModerationPolicy is set and the reply isn't allowed by it, ErrReplyModerated
+// is returned with the response, and the conversation is left as it was too.
+func (c *Conversation) Send(ctx context.Context, content string) (*ChatCompletionResponse, error) {
+	c.Messages = append(c.Messages, ChatMessage{Role: "user", Content: content})
+	resp, err := c.engine.ChatCompletion(ctx, c.request())
+	if err == nil && len(resp.Choices) == 0 {
+		err = errors.New("conversation: no choices")
+	}
+	if err == nil && c.ModerationPolicy != nil {
+		err = c.moderate(ctx, resp)
+	}
+	if err != nil {
+		c.Messages = c.Messages[:len(c.Messages)-1]
+		return resp, err
+	}
+	c.Messages = append(c.Messages, resp.Choices[0].Message)
+	return resp, nil
+}
+
+// moderate returns ErrReplyModerated if the first choice of resp isn't allowed by the policy.
+func (c *Conversation) moderate(ctx context.Context, resp *ChatCompletionResponse) error {
+	moderated, err := c.engine.ModerateResponse(ctx, resp, c.ModerationPolicy)
+	if err != nil {
+		return err
+	}
+	if result, ok := moderated.Moderations[resp.Choices[0].Index]; ok && !c.ModerationPolicy.Allow(result) {
+		return ErrReplyModerated
+	}
+	return nil
+}
+
+// request returns the options of the request of the next turn.
+func (c *Conversation) request() *ChatCompletionOptions {
+	req := c.Options
+	req.Messages = make([]ChatMessage, 0, len(c.Messages)+1)
+	if c.SystemPrompt != "" {
+		req.Messages = append(req.Messages, ChatMessage{Role: "system", Content: c.SystemPrompt})
+	}
+	req.Messages = append(req.Messages, c.Messages...)
+	return &req
+}
+
+// Fork returns the deep copy of the conversation: the messages, the system prompt, the options
+// and the moderation policy.
+// Changing the fork, e.g. sending the messages through it, doesn't affect c, and vice versa.
+// The fork shares the engine with c.
+func (c *Conversation) Fork() *Conversation {
+	return &Conversation{
+		engine:           c.engine,
+		SystemPrompt:     c.SystemPrompt,
+		Options:          cloneChatCompletionOptions(c.Options),
+		Messages:         cloneMessages(c.Messages),
+		ModerationPolicy: c.ModerationPolicy,
+	}
+}
+
+// Merge is used to append the messages of other, starting at the index keepFrom, to c, e.g.
+// the turns of the fork since it was forked at len(c.Messages). The messages are copied.
+// It returns the error if keepFrom is out of the range of the messages of other.
+func (c *Conversation) Merge(other *Conversation, keepFrom int) error {
+	if keepFrom < 0 || keepFrom > len(other.Messages) {
+		return fmt.Errorf("merge conversation: index %d out of range [0, %d]", keepFrom, len(other.Messages))
+	}
+	c.Messages = append(c.Messages, cloneMessages(other.Messages[keepFrom:])...)
+	return nil
+}
+
+func cloneMessages(messages []ChatMessage) []ChatMessage {
+	if messages == nil {
+		return nil
+	}
+	out := make([]ChatMessage, len(messages))
+	for i, m := range messages {
+		if m.Parts != nil {
+			m.Parts = slices.Clone(m.Parts)
+			for j, part := range m.Parts {
+				if part.ImageURL != nil {
+					image := *part.ImageURL
+					m.Parts[j].ImageURL = &image
+				}
+			}
+		}
+		if m.Annotations != nil {
+			m.Annotations = slices.Clone(m.Annotations)
+			for j, a := range m.Annotations {
+				if a.URLCitation != nil {
+					citation := *a.URLCitation
+					m.Annotations[j].URLCitation = &citation
+				}
+			}
+		}
+		m.ToolCalls = slices.Clone(m.ToolCalls)
+		out[i] = m
+	}
+	return out
+}
+
+// cloneChatCompletionOptions returns the deep copy of opts.
+func cloneChatCompletionOptions(opts ChatCompletionOptions) ChatCompletionOptions {
+	opts.Messages = cloneMessages(opts.Messages)
+	opts.Stop = slices.Clone(opts.Stop)
+	if opts.Tools != nil {
+		opts.Tools = slices.Clone(opts.Tools)
+		for i := range opts.Tools {
+			opts.Tools[i].Function.Parameters = bytes.Clone(opts.Tools[i].Function.Parameters)
+		}
+	}
+	if opts.ParallelToolCalls != nil {
+		parallel := *opts.ParallelToolCalls
+		opts.ParallelToolCalls = &parallel
+	}
+	opts.Metadata = maps.Clone(opts.Metadata)
+	if opts.ResponseFormat != nil {
+		format := *opts.ResponseFormat
+		if format.JSONSchema != nil {
+			schema := *format.JSONSchema
+			schema.Schema = bytes.Clone(schema.Schema)
+			format.JSONSchema = &schema
+		}
+		opts.ResponseFormat = &format
+	}
+	if opts.StreamOptions != nil {
+		streamOpts := *opts.StreamOptions
+		opts.StreamOptions = &streamOpts
+	}
+	return opts
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newConversationServer replies with the content of the last message and the number of messages.
+func newConversationServer(t *testing.T, requests *[]*ChatCompletionOptions) *Engine {
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var opts ChatCompletionOptions
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&opts))
+		*requests = append(*requests, &opts)
+		last := opts.Messages[len(opts.Messages)-1].Content
+		if last == "fail" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"invalid request","type":"invalid_request_error"}}`))
+			return
+		}
+		fmt.Fprintf(w, `{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"%s #%d"}}]}`, last, len(opts.Messages))
+	})
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	return e
+}
+
+func contents(messages []ChatMessage) []string {
+	out := make([]string, len(messages))
+	for i, m := range messages {
+		out[i] = m.Content
+	}
+	return out
+}
+
+func TestConversationFork(t *testing.T) {
+	var requests []*ChatCompletionOptions
+	e := newConversationServer(t, &requests)
+	opts := testChatOptions()
+	c := NewConversation(e, "You are terse.", opts)
+	_, err := c.Send(context.Background(), "hi")
+	require.NoError(t, err)
+
+	fork := c.Fork()
+	forkedAt := len(c.Messages)
+	_, err = fork.Send(context.Background(), "left")
+	require.NoError(t, err)
+	_, err = c.Send(context.Background(), "right")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hi", "hi #2", "left", "left #4"}, contents(fork.Messages))
+	assert.Equal(t, []string{"hi", "hi #2", "right", "right #4"}, contents(c.Messages), "the branches are independent")
+	require.Len(t, requests, 3)
+	assert.Equal(t, []string{"You are terse.", "hi", "hi #2", "left"}, contents(requests[1].Messages))
+	assert.Equal(t, ModelGPT3Dot5Turbo, requests[1].Model, "the fork keeps the options")
+
+	require.NoError(t, c.Merge(fork, forkedAt))
+	assert.Equal(t, []string{"hi", "hi #2", "right", "right #4", "left", "left #4"}, contents(c.Messages))
+	fork.Messages[2].Content = "changed"
+	assert.Equal(t, "left", c.Messages[4].Content, "the merged messages are copied")
+	assert.Error(t, c.Merge(fork, 5))
+	assert.Error(t, c.Merge(fork, -1))
+	assert.NoError(t, c.Merge(fork, len(fork.Messages)), "nothing to merge")
+	assert.Len(t, c.Messages, 6)
+
+	_, err = c.Send(context.Background(), "fail")
+	assert.Error(t, err)
+	assert.Len(t, c.Messages, 6, "the failed turn isn't kept")
+	assert.Empty(t, opts.Messages[1:], "the options of the conversation are copied")
+}
+
+// forkFixture returns the conversation with every reference field of the options and the messages set.
+func forkFixture() *Conversation {
+	parallel := true
+	return &Conversation{
+		SystemPrompt: "system",
+		Options: ChatCompletionOptions{
+			Model:             "gpt-4o",
+			Messages:          []ChatMessage{{Role: "user", Content: "ignored"}},
+			Stop:              []string{"\n"},
+			Tools:             []ChatTool{{Type: "function", Function: FunctionDefinition{Name: "f", Parameters: json.RawMessage(`{"type":"object"}`)}}},
+			ParallelToolCalls: &parallel,
+			Metadata:          map[string]string{"tenant": "acme"},
+			ResponseFormat: &ChatResponseFormat{Type: ResponseFormatJSONSchema, JSONSchema: &JSONSchemaFormat{
+				Name: "weather", Schema: json.RawMessage(weatherSchema),
+			}},
+			StreamOptions: &ChatStreamOptions{IncludeUsage: true},
+		},
+		Messages: []ChatMessage{
+			{Role: "user", Parts: []ContentPart{NewImageURLPart("https://example.com/cat.png", ImageDetailLow)}},
+			{Role: "assistant", Annotations: []ChatAnnotation{{Type: AnnotationURLCitation, URLCitation: &URLCitation{URL: "https://example.com"}}},
+				ToolCalls: []ToolCall{{Id: "call_1", Type: "function", Function: ToolCallFunction{Name: "f", Arguments: "{}"}}}},
+		},
+	}
+}
+
+func TestConversationForkIndependence(t *testing.T) {
+	// The fixture covers every field which holds the reference, the new ones must be deep-copied by Fork
+	v := reflect.ValueOf(forkFixture().Options)
+	for i := 0; i < v.NumField(); i++ {
+		switch f := v.Field(i); f.Kind() {
+		case reflect.Slice, reflect.Map, reflect.Ptr:
+			assert.False(t, f.IsNil(), "the fixture must set %s", v.Type().Field(i).Name)
+		}
+	}
+
+	c := forkFixture()
+	fork := c.Fork()
+	assert.Equal(t, c, fork)
+
+	fork.SystemPrompt = "changed"
+	o := &fork.Options
+	o.Messages[0].Content = "changed"
+	o.Stop[0] = "changed"
+	o.Tools[0].Function.Parameters[0] = '['
+	*o.ParallelToolCalls = false
+	o.Metadata["tenant"] = "changed"
+	o.ResponseFormat.JSONSchema.Schema[0] = '['
+	o.ResponseFormat.JSONSchema.Name = "changed"
+	o.StreamOptions.IncludeUsage = false
+	fork.Messages[0].Parts[0].ImageURL.URL = "changed"
+	fork.Messages[1].Annotations[0].URLCitation.URL = "changed"
+	fork.Messages[1].ToolCalls[0].Function.Arguments = "changed"
+	fork.Messages = append(fork.Messages, ChatMessage{Role: "user", Content: "more"})
+	assert.Equal(t, forkFixture(), c, "changing the fork must not affect the original")
+
+	c.Messages[0].Parts[0].ImageURL.URL = "changed again"
+	assert.Equal(t, "changed", fork.Messages[0].Parts[0].ImageURL.URL, "changing the original must not affect the fork")
+}
+
+func TestConversationSendModeration(t *testing.T) {
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moderations" {
+			var body struct {
+				Input []string `json:"input"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Len(t, body.Input, 1)
+			fmt.Fprintf(w, `{"id":"modr-1","results":[{"flagged":%t}]}`, body.Input[0] == "bad")
+			return
+		}
+		var opts ChatCompletionOptions
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&opts))
+		fmt.Fprintf(w, `{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"%s"}}]}`, opts.Messages[len(opts.Messages)-1].Content)
+	})
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	c := NewConversation(e, "", testChatOptions())
+	c.ModerationPolicy = ModerationPolicyNotFlagged
+	_, err := c.Send(context.Background(), "good")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"good", "good"}, contents(c.Messages))
+
+	resp, err := c.Send(context.Background(), "bad")
+	assert.ErrorIs(t, err, ErrReplyModerated)
+	require.NotNil(t, resp)
+	assert.Equal(t, "bad", resp.Choices[0].Message.Content)
+	assert.Equal(t, []string{"good", "good"}, contents(c.Messages), "the rejected turn must not be kept")
+}
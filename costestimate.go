@@ -0,0 +1,80 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPricingUnavailable is returned by EstimatePromptCost if the price of the model isn't known,
+// e.g. of the fine-tuned model.
+var ErrPricingUnavailable = errors.New("openai: pricing of the model unavailable")
+
+// CostEstimate is the estimated cost of the chat completion request before it's sent.
+type CostEstimate struct {
+	// PromptTokens is the estimated number of tokens of the prompt.
+	PromptTokens int
+	// MaxCompletionTokens is the number of completion tokens the request may be charged for at most:
+	// the limit of the completion tokens of every choice, times the number of choices.
+	MaxCompletionTokens int
+	// MinCostUSD is the cost of the prompt only, the cost of the request with the empty completion.
+	MinCostUSD float64
+	// MaxCostUSD is the cost of the prompt and MaxCompletionTokens, the cost of the request
+	// at most, e.g. to abort the request whose MaxCostUSD exceeds the budget.
+	MaxCostUSD float64
+	// Currency of the costs, always "USD".
+	Currency string
+}
+
+// EstimatePromptCost is used to estimate the cost of the chat completion request of opts without
+// sending it, by the public prices of the models. The request is estimated the way it'd be sent:
+// with the default model of the engine if the model is empty, see WithDefaultModel, and with the
+// default limit of the completion tokens if it's not set. The prompt tokens, the instructions and
+// the messages, are counted by the tokenizer of the model as in Engine.CountMessagesTokens and
+// charged at the price of the uncached tokens, so the actual cost is lower if the prompt is cached.
+// ErrPricingUnavailable is returned if the model isn't known.
+func (e *Engine) EstimatePromptCost(opts *ChatCompletionOptions) (*CostEstimate, error) {
+	model := e.chatModel(opts.Model)
+	price, ok := modelPriceOf(model)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrPricingUnavailable, model)
+	}
+	completion := opts.MaxCompletionTokens
+	if completion == 0 {
+		completion = opts.MaxTokens
+	}
+	if completion == 0 {
+		completion = defaultMaxTokens
+	}
+	if opts.N > 1 {
+		completion *= opts.N
+	}
+	prompt, err := promptTokens(model, opts)
+	if err != nil {
+		return nil, err
+	}
+	minCost := float64(prompt) * price.input / 1e6
+	return &CostEstimate{
+		PromptTokens:        prompt,
+		MaxCompletionTokens: completion,
+		MinCostUSD:          minCost,
+		MaxCostUSD:          minCost + float64(completion)*price.output/1e6,
+		Currency:            "USD",
+	}, nil
+}
+
+// promptTokens returns the number of tokens of the prompt of the chat completion request for
+// the model: the instructions, the messages and the reply primer, counted by the tokenizer.
+func promptTokens(model Model, opts *ChatCompletionOptions) (int, error) {
+	count, err := tokenCounter(model)
+	if err != nil {
+		return 0, err
+	}
+	n, err := countMessagesTokens(model, opts.Messages)
+	if err != nil {
+		return 0, err
+	}
+	return n + count(opts.Instructions), nil
+}
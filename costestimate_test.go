@@ -0,0 +1,51 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimatePromptCost(t *testing.T) {
+	e := New("test")
+	opts := &ChatCompletionOptions{
+		Model:     "gpt-4o-2024-08-06",
+		Messages:  []ChatMessage{{Role: "user", Content: "Hello, world"}},
+		MaxTokens: 100,
+		N:         2,
+	}
+	estimate, err := e.EstimatePromptCost(opts)
+	require.NoError(t, err)
+	assert.Equal(t, 3+(3+1+3), estimate.PromptTokens)
+	assert.Equal(t, 200, estimate.MaxCompletionTokens, "the limit applies to every choice")
+	assert.InDelta(t, 10*2.50/1e6, estimate.MinCostUSD, 1e-12)
+	assert.InDelta(t, (10*2.50+200*10.00)/1e6, estimate.MaxCostUSD, 1e-12)
+	assert.Equal(t, "USD", estimate.Currency)
+
+	estimate, err = New("test", WithDefaultModel("gpt-4o-mini")).EstimatePromptCost(&ChatCompletionOptions{
+		Messages: []ChatMessage{{Role: "user", Content: "Hello, world"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, defaultMaxTokens, estimate.MaxCompletionTokens, "the default limit of the request")
+	assert.InDelta(t, (10*0.15+defaultMaxTokens*0.60)/1e6, estimate.MaxCostUSD, 1e-12)
+
+	// The instructions are 8 tokens of o200k_base
+	opts = &ChatCompletionOptions{
+		Model:        "gpt-4o",
+		Instructions: "お誕生日おめでとう",
+		Messages:     []ChatMessage{{Role: "user", Content: "こんにちは世界"}},
+	}
+	estimate, err = e.EstimatePromptCost(opts)
+	require.NoError(t, err)
+	messages, err := e.CountMessagesTokens(context.Background(), opts.Messages, opts.Model)
+	require.NoError(t, err)
+	assert.Equal(t, messages+8, estimate.PromptTokens, "the same count as CountMessagesTokens")
+
+	_, err = e.EstimatePromptCost(&ChatCompletionOptions{Model: "ft:gpt-4o-mini-2024-07-18:acme::abc123"})
+	assert.ErrorIs(t, err, ErrPricingUnavailable)
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// defaultCostEstimateEvery is the number of chunks between the cost estimates.
+const defaultCostEstimateEvery = 10
+
+type StreamingCostOptions struct {
+	// Every is the number of chunks between the estimates, 10 if it's zero.
+	Every int
+	// OnEstimate is called with the estimated cost of the request in USD every Every chunks,
+	// and with the final cost once the stream is finished. It may be nil.
+	OnEstimate func(estimatedUSD float64)
+}
+
+// StreamingCostMonitor is used to monitor the cost of the chat completion while it's streamed.
+// The completion tokens are counted in the content of the deltas of every choice, and the prompt
+// tokens in the instructions and the messages of the request, by the tokenizer of the model. The
+// count is replaced with the cost of the actual usage of the request once it's streamed, see
+// ChatStreamOptions.IncludeUsage. The cost is zero for the models of the unknown pricing or tokenizer.
+type StreamingCostMonitor struct {
+	stream *ChatCompletionStream
+	opts   StreamingCostOptions
+	model  Model
+	count  func(text string) int
+	prompt int
+	// completion is the content of every choice so far.
+	completion map[int]*strings.Builder
+	chunks     int
+	done       bool
+
+	mu     sync.Mutex
+	cost   float64
+	actual bool
+}
+
+// NewStreamingCostMonitor returns the monitor of the stream of the chat completion requested
+// with opts. Read the chunks with Recv of the monitor instead of the stream.
+func NewStreamingCostMonitor(stream *ChatCompletionStream, opts *ChatCompletionOptions, costOpts StreamingCostOptions) *StreamingCostMonitor {
+	if costOpts.Every <= 0 {
+		costOpts.Every = defaultCostEstimateEvery
+	}
+	m := &StreamingCostMonitor{
+		stream:     stream,
+		opts:       costOpts,
+		model:      opts.Model,
+		completion: make(map[int]*strings.Builder),
+	}
+	// Without the tokenizer nothing is counted, the cost stays zero
+	if count, err := tokenCounter(opts.Model); err == nil {
+		m.count = count
+		m.prompt, _ = promptTokens(opts.Model, opts)
+	}
+	return m
+}
+
+// StreamingCostEstimate is used to stream the chat completion along with the estimates of its cost,
+// see StreamingCostMonitor. The usage is requested to be streamed, so once its chunk is read,
+// FinalCost returns the cost of the actual usage. opts isn't modified.
+func (e *Engine) StreamingCostEstimate(ctx context.Context, opts *ChatCompletionOptions, costOpts StreamingCostOptions) (*StreamingCostMonitor, error) {
+	req := *opts
+	streamOpts := ChatStreamOptions{IncludeUsage: true}
+	req.StreamOptions = &streamOpts
+	stream, err := e.ChatCompletionStream(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	return NewStreamingCostMonitor(stream, opts, costOpts), nil
+}
+
+// Recv returns the next chunk of the stream, see ChatCompletionStream.Recv.
+func (m *StreamingCostMonitor) Recv() (*ChatCompletionStreamResponse, error) {
+	chunk, err := m.stream.Recv()
+	if errors.Is(err, io.EOF) {
+		if !m.done {
+			m.done = true
+			m.estimate()
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if chunk.Usage != nil {
+		m.mu.Lock()
+		m.cost, m.actual = estimatedCost(m.model, *chunk.Usage), true
+		m.mu.Unlock()
+		return chunk, nil
+	}
+	for _, choice := range chunk.Choices {
+		content, ok := m.completion[choice.Index]
+		if !ok {
+			content = &strings.Builder{}
+			m.completion[choice.Index] = content
+		}
+		content.WriteString(choice.Delta.Content)
+	}
+	if m.chunks++; m.chunks%m.opts.Every == 0 {
+		m.estimate()
+	}
+	return chunk, nil
+}
+
+// estimate updates the estimated cost, unless the actual usage is known, and reports it.
+// The content of every choice is counted as a whole, the tokens don't align with the deltas.
+func (m *StreamingCostMonitor) estimate() {
+	m.mu.Lock()
+	if !m.actual && m.count != nil {
+		var completion int
+		for _, content := range m.completion {
+			completion += m.count(content.String())
+		}
+		m.cost = estimatedCost(m.model, Usage{PromptTokens: m.prompt, CompletionTokens: completion})
+	}
+	cost := m.cost
+	m.mu.Unlock()
+	if m.opts.OnEstimate != nil {
+		m.opts.OnEstimate(cost)
+	}
+}
+
+// FinalCost returns the cost of the request in USD: the cost of the actual usage if it was
+// streamed, the last estimate otherwise. It may be called concurrently with Recv.
+func (m *StreamingCostMonitor) FinalCost() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cost
+}
+
+// Close closes the stream, see ChatCompletionStream.Close.
+func (m *StreamingCostMonitor) Close() error {
+	return m.stream.Close()
+}
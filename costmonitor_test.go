@@ -0,0 +1,107 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCostStreamServer streams 25 chunks of 4 characters, and the usage if it's requested.
+func newCostStreamServer(t *testing.T) *Engine {
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			StreamOptions *ChatStreamOptions `json:"stream_options"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 25; i++ {
+			fmt.Fprint(w, `data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"abcd"}}]}`+"\n\n")
+		}
+		if body.StreamOptions != nil && body.StreamOptions.IncludeUsage {
+			fmt.Fprint(w, `data: {"id":"chatcmpl-1","choices":[],"usage":{"prompt_tokens":8,"completion_tokens":25,"total_tokens":33}}`+"\n\n")
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	return e
+}
+
+func readMonitor(t *testing.T, m *StreamingCostMonitor) (content string) {
+	defer m.Close()
+	for {
+		chunk, err := m.Recv()
+		if err == io.EOF {
+			return content
+		}
+		require.NoError(t, err)
+		for _, choice := range chunk.Choices {
+			content += choice.Delta.Content
+		}
+	}
+}
+
+func TestStreamingCostEstimate(t *testing.T) {
+	e := newCostStreamServer(t)
+	opts := testChatOptions()
+	opts.Model = "gpt-4o"
+	// The prompt is 8 tokens: 3 of the message overhead, 1 of the role, 1 of the content and 3 of the reply primer
+	cost := func(prompt, completion int) float64 { return (float64(prompt)*2.50 + float64(completion)*10.00) / 1e6 }
+
+	var estimates []float64
+	m, err := e.StreamingCostEstimate(context.Background(), opts, StreamingCostOptions{
+		OnEstimate: func(estimatedUSD float64) { estimates = append(estimates, estimatedUSD) },
+	})
+	require.NoError(t, err)
+	assert.Nil(t, opts.StreamOptions, "the options must not be modified")
+	assert.Equal(t, strings.Repeat("abcd", 25), readMonitor(t, m))
+	require.Len(t, estimates, 3)
+	assert.InDelta(t, cost(8, 10), estimates[0], 1e-12)
+	assert.InDelta(t, cost(8, 20), estimates[1], 1e-12)
+	assert.InDelta(t, cost(8, 25), estimates[2], 1e-12, "the actual usage replaces the estimate")
+	assert.InDelta(t, cost(8, 25), m.FinalCost(), 1e-12)
+
+	stream, err := e.ChatCompletionStream(context.Background(), opts)
+	require.NoError(t, err)
+	estimates = nil
+	m = NewStreamingCostMonitor(stream, opts, StreamingCostOptions{
+		Every:      20,
+		OnEstimate: func(estimatedUSD float64) { estimates = append(estimates, estimatedUSD) },
+	})
+	readMonitor(t, m)
+	require.Len(t, estimates, 2)
+	assert.InDelta(t, cost(8, 25), m.FinalCost(), 1e-12, "the last estimate is final without the usage")
+	_, err = m.Recv()
+	assert.Equal(t, io.EOF, err)
+	assert.Len(t, estimates, 2, "the final cost is reported once")
+}
+
+func TestStreamingCostMonitorChoices(t *testing.T) {
+	e := newChatStreamServer(t, []string{"Hel", "lo", " wor", "ld"}, nil)
+	opts := testChatOptions()
+	opts.Model = "gpt-4o-mini"
+	stream, err := e.ChatCompletionStream(context.Background(), opts)
+	require.NoError(t, err)
+	m := NewStreamingCostMonitor(stream, opts, StreamingCostOptions{Every: 1})
+	readMonitor(t, m)
+	// The tokens of the choice are counted in its whole content, "Hello world" is 2 tokens of o200k_base
+	// while the deltas would be 4
+	assert.InDelta(t, (8*0.15+2*0.60)/1e6, m.FinalCost(), 1e-12)
+
+	opts.Model = "unpriced-model"
+	stream, err = e.ChatCompletionStream(context.Background(), opts)
+	require.NoError(t, err)
+	m = NewStreamingCostMonitor(stream, opts, StreamingCostOptions{})
+	readMonitor(t, m)
+	assert.Zero(t, m.FinalCost())
+}
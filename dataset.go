@@ -0,0 +1,203 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FineTuningMessage is a message of the fine-tuning example.
+type FineTuningMessage struct {
+	ChatMessage
+	// Weight of the assistant message, 0 excludes the message from training, 1 includes it.
+	// Messages without weight are included.
+	Weight *int `json:"weight,omitempty"`
+}
+
+func (m FineTuningMessage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		chatMessage
+		Weight *int `json:"weight,omitempty"`
+	}{m.ChatMessage.wire(), m.Weight})
+}
+
+func (m *FineTuningMessage) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Weight *int `json:"weight"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	m.Weight = v.Weight
+	return m.ChatMessage.UnmarshalJSON(b)
+}
+
+// FineTuningExample is a single example of the supervised fine-tuning dataset, i.e. a line of the JSONL file.
+type FineTuningExample struct {
+	Messages []FineTuningMessage `json:"messages"`
+}
+
+// PreferencePair is a single example of the preference (DPO) fine-tuning dataset.
+type PreferencePair struct {
+	Input struct {
+		Messages []ChatMessage `json:"messages"`
+	} `json:"input"`
+	// Output preferred over NonPreferredOutput, it must contain exactly one assistant message.
+	PreferredOutput []ChatMessage `json:"preferred_output"`
+	// Output which shouldn't be preferred, it must contain exactly one assistant message.
+	NonPreferredOutput []ChatMessage `json:"non_preferred_output"`
+}
+
+// DatasetIssue describes a problem of a single example of the dataset.
+type DatasetIssue struct {
+	// Index of the example (line of the JSONL file), starting with 0.
+	Index   int
+	Message string
+}
+
+// DatasetError is returned when examples of the dataset are invalid.
+type DatasetError struct {
+	Issues []DatasetIssue
+}
+
+func (e *DatasetError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid dataset: %d issue(s)", len(e.Issues))
+	for _, issue := range e.Issues {
+		fmt.Fprintf(&b, "; example %d: %s", issue.Index, issue.Message)
+	}
+	return b.String()
+}
+
+// ValidateFineTuningDataset checks that every example has an assistant message which
+// is used for training, and that weights are either 0 or 1.
+func ValidateFineTuningDataset(examples []FineTuningExample) error {
+	var issues []DatasetIssue
+	for i, ex := range examples {
+		var assistant, trained int
+		for _, m := range ex.Messages {
+			if m.Weight != nil && *m.Weight != 0 && *m.Weight != 1 {
+				issues = append(issues, DatasetIssue{i, fmt.Sprintf("weight must be 0 or 1, got %d", *m.Weight)})
+			}
+			if m.Weight != nil && m.Role != "assistant" {
+				issues = append(issues, DatasetIssue{i, fmt.Sprintf("weight is only allowed on assistant messages, got %s", m.Role)})
+			}
+			if m.Role == "assistant" {
+				assistant++
+				if m.Weight == nil || *m.Weight != 0 {
+					trained++
+				}
+			}
+		}
+		switch {
+		case assistant == 0:
+			issues = append(issues, DatasetIssue{i, "no assistant message"})
+		case trained == 0:
+			issues = append(issues, DatasetIssue{i, "every assistant message has weight 0, the example trains nothing"})
+		}
+	}
+	if len(issues) != 0 {
+		return &DatasetError{Issues: issues}
+	}
+	return nil
+}
+
+// ValidatePreferenceDataset checks that every pair has input messages, and that both
+// preferred and non-preferred outputs contain exactly one assistant message.
+func ValidatePreferenceDataset(pairs []PreferencePair) error {
+	var issues []DatasetIssue
+	for i, p := range pairs {
+		if len(p.Input.Messages) == 0 {
+			issues = append(issues, DatasetIssue{i, "no input messages"})
+		}
+		if !isSingleAssistantMessage(p.PreferredOutput) {
+			issues = append(issues, DatasetIssue{i, "preferred output must contain exactly one assistant message"})
+		}
+		if !isSingleAssistantMessage(p.NonPreferredOutput) {
+			issues = append(issues, DatasetIssue{i, "non-preferred output must contain exactly one assistant message"})
+		}
+	}
+	if len(issues) != 0 {
+		return &DatasetError{Issues: issues}
+	}
+	return nil
+}
+
+func isSingleAssistantMessage(messages []ChatMessage) bool {
+	return len(messages) == 1 && messages[0].Role == "assistant"
+}
+
+// WriteFineTuningJSONL validates examples and writes them to w in the JSONL format.
+func WriteFineTuningJSONL(w io.Writer, examples []FineTuningExample) error {
+	if err := ValidateFineTuningDataset(examples); err != nil {
+		return err
+	}
+	return writeJSONL(w, len(examples), func(i int) interface{} { return examples[i] })
+}
+
+// ReadFineTuningJSONL reads examples in the JSONL format from r. The examples aren't validated.
+func ReadFineTuningJSONL(r io.Reader) ([]FineTuningExample, error) {
+	var examples []FineTuningExample
+	err := readJSONL(r, func(line []byte) error {
+		var ex FineTuningExample
+		if err := json.Unmarshal(line, &ex); err != nil {
+			return err
+		}
+		examples = append(examples, ex)
+		return nil
+	})
+	return examples, err
+}
+
+// WritePreferenceJSONL validates pairs and writes them to w in the JSONL format.
+func WritePreferenceJSONL(w io.Writer, pairs []PreferencePair) error {
+	if err := ValidatePreferenceDataset(pairs); err != nil {
+		return err
+	}
+	return writeJSONL(w, len(pairs), func(i int) interface{} { return pairs[i] })
+}
+
+// ReadPreferenceJSONL reads pairs in the JSONL format from r. The pairs aren't validated.
+func ReadPreferenceJSONL(r io.Reader) ([]PreferencePair, error) {
+	var pairs []PreferencePair
+	err := readJSONL(r, func(line []byte) error {
+		var p PreferencePair
+		if err := json.Unmarshal(line, &p); err != nil {
+			return err
+		}
+		pairs = append(pairs, p)
+		return nil
+	})
+	return pairs, err
+}
+
+func writeJSONL(w io.Writer, n int, item func(i int) interface{}) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw) // Encode terminates every value with a newline
+	for i := 0; i < n; i++ {
+		if err := enc.Encode(item(i)); err != nil {
+			return fmt.Errorf("encode example %d: %w", i, err)
+		}
+	}
+	return bw.Flush()
+}
+
+func readJSONL(r io.Reader, decode func(line []byte) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 16<<20)
+	for i := 0; sc.Scan(); i++ {
+		line := sc.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		if err := decode(line); err != nil {
+			return fmt.Errorf("decode line %d: %w", i+1, err)
+		}
+	}
+	return sc.Err()
+}
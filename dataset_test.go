@@ -0,0 +1,97 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestFineTuningJSONLRoundTrip(t *testing.T) {
+	examples := []FineTuningExample{{
+		Messages: []FineTuningMessage{
+			{ChatMessage: ChatMessage{Role: "user", Content: "Capital of France?"}},
+			{ChatMessage: ChatMessage{Role: "assistant", Content: "London"}, Weight: intPtr(0)},
+			{ChatMessage: ChatMessage{Role: "user", Content: "Are you sure?"}},
+			{ChatMessage: ChatMessage{Role: "assistant", Content: "Paris"}},
+		},
+	}}
+	var buf bytes.Buffer
+	require.NoError(t, WriteFineTuningJSONL(&buf, examples))
+	assert.Equal(t, `{"messages":[{"content":"Capital of France?","role":"user"},`+
+		`{"content":"London","role":"assistant","weight":0},`+
+		`{"content":"Are you sure?","role":"user"},`+
+		`{"content":"Paris","role":"assistant"}]}`+"\n", buf.String())
+
+	read, err := ReadFineTuningJSONL(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, examples, read)
+}
+
+func TestValidateFineTuningDataset(t *testing.T) {
+	err := ValidateFineTuningDataset([]FineTuningExample{
+		{Messages: []FineTuningMessage{
+			{ChatMessage: ChatMessage{Role: "user", Content: "hi"}},
+			{ChatMessage: ChatMessage{Role: "assistant", Content: "hello"}, Weight: intPtr(1)},
+		}},
+		{Messages: []FineTuningMessage{
+			{ChatMessage: ChatMessage{Role: "user", Content: "hi"}},
+			{ChatMessage: ChatMessage{Role: "assistant", Content: "hello"}, Weight: intPtr(0)},
+		}},
+		{Messages: []FineTuningMessage{
+			{ChatMessage: ChatMessage{Role: "user", Content: "hi"}, Weight: intPtr(1)},
+			{ChatMessage: ChatMessage{Role: "assistant", Content: "hello"}, Weight: intPtr(2)},
+		}},
+	})
+	var dsErr *DatasetError
+	require.True(t, errors.As(err, &dsErr))
+	assert.Equal(t, []DatasetIssue{
+		{1, "every assistant message has weight 0, the example trains nothing"},
+		{2, "weight is only allowed on assistant messages, got user"},
+		{2, "weight must be 0 or 1, got 2"},
+	}, dsErr.Issues)
+
+	var buf bytes.Buffer
+	assert.Error(t, WriteFineTuningJSONL(&buf, []FineTuningExample{{}}))
+	assert.Zero(t, buf.Len(), "invalid dataset must not be written")
+}
+
+func TestPreferenceJSONLRoundTrip(t *testing.T) {
+	var pair PreferencePair
+	pair.Input.Messages = []ChatMessage{{Role: "user", Content: "Hello"}}
+	pair.PreferredOutput = []ChatMessage{{Role: "assistant", Content: "Hi, how can I help?"}}
+	pair.NonPreferredOutput = []ChatMessage{{Role: "assistant", Content: "What?"}}
+
+	var buf bytes.Buffer
+	require.NoError(t, WritePreferenceJSONL(&buf, []PreferencePair{pair}))
+	assert.Equal(t, `{"input":{"messages":[{"content":"Hello","role":"user"}]},`+
+		`"preferred_output":[{"content":"Hi, how can I help?","role":"assistant"}],`+
+		`"non_preferred_output":[{"content":"What?","role":"assistant"}]}`+"\n", buf.String())
+
+	read, err := ReadPreferenceJSONL(strings.NewReader("\n" + buf.String() + "\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []PreferencePair{pair}, read)
+}
+
+func TestValidatePreferenceDataset(t *testing.T) {
+	var pair PreferencePair
+	pair.Input.Messages = []ChatMessage{{Role: "user", Content: "Hello"}}
+	pair.PreferredOutput = []ChatMessage{{Role: "assistant", Content: "Hi"}, {Role: "assistant", Content: "there"}}
+	pair.NonPreferredOutput = []ChatMessage{{Role: "user", Content: "What?"}}
+
+	err := ValidatePreferenceDataset([]PreferencePair{pair})
+	var dsErr *DatasetError
+	require.True(t, errors.As(err, &dsErr))
+	assert.Equal(t, []DatasetIssue{
+		{0, "preferred output must contain exactly one assistant message"},
+		{0, "non-preferred output must contain exactly one assistant message"},
+	}, dsErr.Issues)
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// redacted replaces the credentials in the debug dump and the printed secrets.
+const redacted = "[REDACTED]"
+
+// redactedHeaders are the request headers which values are replaced in the debug dump.
+var redactedHeaders = []string{"Authorization", "Api-Key"}
+
+// WithDebugDump is used to write raw HTTP requests and responses sent by engine to w,
+// e.g. os.Stderr. It's intended for interactive debugging, the values of headers carrying
+// credentials are replaced with [REDACTED]. Every attempt of a retried request is written,
+// bodies of streamed responses are omitted to not hold back the stream.
+func WithDebugDump(w io.Writer) EngineOption {
+	return func(e *Engine) {
+		e.debugDump = &debugDumper{w: w}
+	}
+}
+
+// WithDebugDumpToFile is the same as WithDebugDump, but appends the dump to the file at path.
+// The file is created if it doesn't exist, and it's opened and closed for every written pair
+// of request and response. Errors of writing the file are ignored.
+func WithDebugDumpToFile(path string) EngineOption {
+	return WithDebugDump(appendFile(path))
+}
+
+type debugDumper struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// dumpRequest returns the dump of the attempt of request, with the body if it can be read
+// without consuming the body of the attempt.
+func (e *Engine) dumpRequest(req *http.Request) []byte {
+	if e.debugDump == nil {
+		return nil
+	}
+	dump := req.Clone(req.Context())
+	for _, h := range redactedHeaders {
+		if dump.Header.Get(h) != "" {
+			dump.Header.Set(h, redacted)
+		}
+	}
+	withBody := req.GetBody != nil
+	if withBody {
+		body, err := req.GetBody()
+		if err != nil {
+			return []byte(fmt.Sprintf("dump request: %v\n", err))
+		}
+		dump.Body = body
+	}
+	b, err := httputil.DumpRequestOut(dump, withBody)
+	if err != nil {
+		return []byte(fmt.Sprintf("dump request: %v\n", err))
+	}
+	return b
+}
+
+// dumpResponse writes the dump of the request along with the response or error
+// the request ended with. The body of the response is buffered to be dumped,
+// unless it's a stream.
+func (e *Engine) dumpResponse(reqDump []byte, resp *http.Response, err error) {
+	if e.debugDump == nil {
+		return
+	}
+	var buf bytes.Buffer
+	buf.Write(reqDump)
+	buf.WriteString("\n\n")
+	if err != nil {
+		fmt.Fprintf(&buf, "error: %v", err)
+	} else {
+		stream := strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+		b, err := httputil.DumpResponse(resp, !stream)
+		if err != nil {
+			fmt.Fprintf(&buf, "dump response: %v", err)
+		}
+		buf.Write(b)
+	}
+	buf.WriteString("\n\n")
+
+	d := e.debugDump
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.w.Write(buf.Bytes())
+}
+
+// appendFile is a writer which appends to the file at the path.
+type appendFile string
+
+func (path appendFile) Write(p []byte) (int, error) {
+	f, err := os.OpenFile(string(path), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	n, err := f.Write(p)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
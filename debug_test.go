@@ -0,0 +1,96 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugDump(t *testing.T) {
+	var calls int
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":{"message":"overloaded"}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+	})
+	var buf bytes.Buffer
+	e := New("sk-secret", WithDebugDump(&buf))
+	e.apiBaseURL = srv.URL
+	e.clock = newAutoClock()
+	e.SetMaxRetries(1)
+
+	r, err := e.ChatCompletion(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	assert.Equal(t, "hi", r.Choices[0].Message.Content, "dumped response must still be readable")
+
+	dump := buf.String()
+	assert.Equal(t, 2, strings.Count(dump, "POST /chat/completions HTTP/1.1"), "every attempt is dumped")
+	assert.Equal(t, 2, strings.Count(dump, `"content":"hello"`))
+	assert.Contains(t, dump, "Authorization: [REDACTED]")
+	assert.NotContains(t, dump, "sk-secret")
+	assert.Contains(t, dump, "HTTP/1.1 503 Service Unavailable")
+	assert.Contains(t, dump, `{"error":{"message":"overloaded"}}`)
+	assert.Contains(t, dump, "HTTP/1.1 200 OK")
+	assert.Contains(t, dump, `"content":"hi"`)
+}
+
+func TestDebugDumpRedactsApiKey(t *testing.T) {
+	srv := newChatTestServer(t, nil)
+	var buf bytes.Buffer
+	e := New("test", WithDebugDump(&buf))
+	e.apiBaseURL = srv.URL
+	e.SetRequestSigner(RequestSignerFunc(func(_ string, _ *url.URL, header http.Header, _ func() ([]byte, error)) error {
+		header.Set("api-key", "azure-secret")
+		return nil
+	}))
+	_, err := e.ChatCompletion(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "Api-Key: [REDACTED]")
+	assert.NotContains(t, buf.String(), "azure-secret")
+}
+
+func TestDebugDumpStream(t *testing.T) {
+	e := newInterruptedStreamServer(t, true)
+	var buf bytes.Buffer
+	WithDebugDump(&buf)(e)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := e.CompletionStream(ctx, &CompletionOptions{Model: "gpt-3.5-turbo-instruct", Prompt: []string{"a"}})
+	require.NoError(t, err)
+	defer s.Close()
+
+	r, err := s.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "a", r.Choices[0].Text)
+	assert.Contains(t, buf.String(), "Content-Type: text/event-stream")
+	assert.NotContains(t, buf.String(), "cmpl-1", "stream body must not be dumped")
+}
+
+func TestDebugDumpToFile(t *testing.T) {
+	srv := newChatTestServer(t, nil)
+	path := filepath.Join(t.TempDir(), "dump.txt")
+	e := New("test", WithDebugDumpToFile(path))
+	e.apiBaseURL = srv.URL
+	for i := 0; i < 2; i++ {
+		_, err := e.ChatCompletion(context.Background(), testChatOptions())
+		require.NoError(t, err)
+	}
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(b), "POST /chat/completions HTTP/1.1"))
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrNotFound is matched by the APIError of 404 responses, e.g. if the deleted object doesn't exist.
+	ErrNotFound = errors.New("openai: not found")
+	// ErrNotDeleted is returned by delete methods if the API responded that the object wasn't deleted.
+	ErrNotDeleted = errors.New("openai: object not deleted")
+)
+
+// Deleted is the response of every delete method.
+type Deleted struct {
+	Id      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
+// deleteObject deletes the object at uri. The 404 response is returned as the APIError
+// matching ErrNotFound, the response with deleted set to false as ErrNotDeleted.
+func (e *Engine) deleteObject(ctx context.Context, uri string) (*Deleted, error) {
+	req, err := e.newReq(ctx, http.MethodDelete, uri, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.doReq(req)
+	if err != nil {
+		return nil, err
+	}
+	var jsonResp Deleted
+	if err := unmarshal(resp, &jsonResp); err != nil {
+		return nil, err
+	}
+	if !jsonResp.Deleted {
+		return nil, fmt.Errorf("%w: %s %s", ErrNotDeleted, jsonResp.Object, jsonResp.Id)
+	}
+	return &jsonResp, nil
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDeleteTestServer(t *testing.T, path string, status int, body string) *Engine {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		assert.Equal(t, path, r.URL.Path)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	return e
+}
+
+const notFoundBody = `{"error":{"message":"No such object","type":"invalid_request_error"}}`
+
+func TestDeleteModel(t *testing.T) {
+	const path = "/models/ft:gpt-4o-mini:acme::abc123"
+	opts := &DeleteModelOptions{ID: "ft:gpt-4o-mini:acme::abc123"}
+
+	t.Run("deleted", func(t *testing.T) {
+		e := newDeleteTestServer(t, path, http.StatusOK, `{"id":"ft:gpt-4o-mini:acme::abc123","object":"model","deleted":true}`)
+		r, err := e.DeleteModel(context.Background(), opts)
+		require.NoError(t, err)
+		assert.Equal(t, &Deleted{Id: "ft:gpt-4o-mini:acme::abc123", Object: "model", Deleted: true}, r)
+	})
+	t.Run("not found", func(t *testing.T) {
+		e := newDeleteTestServer(t, path, http.StatusNotFound, notFoundBody)
+		_, err := e.DeleteModel(context.Background(), opts)
+		assert.ErrorIs(t, err, ErrNotFound)
+		var apiErr APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, "No such object", apiErr.Err.Message)
+	})
+	t.Run("not deleted", func(t *testing.T) {
+		e := newDeleteTestServer(t, path, http.StatusOK, `{"id":"ft:gpt-4o-mini:acme::abc123","object":"model","deleted":false}`)
+		_, err := e.DeleteModel(context.Background(), opts)
+		assert.ErrorIs(t, err, ErrNotDeleted)
+		assert.NotErrorIs(t, err, ErrNotFound)
+	})
+	t.Run("base model", func(t *testing.T) {
+		e := New("test")
+		e.apiBaseURL = "http://127.0.0.1:0" // nothing is sent
+		for _, id := range []Model{"gpt-4o-mini", ModelGPT4, "curie-ft:acme"} {
+			_, err := e.DeleteModel(context.Background(), &DeleteModelOptions{ID: id})
+			assert.ErrorIs(t, err, ErrCannotDeleteBaseModel)
+		}
+	})
+}
+
+func TestDeleteChatCompletion(t *testing.T) {
+	const path = "/chat/completions/chatcmpl-1"
+
+	t.Run("deleted", func(t *testing.T) {
+		e := newDeleteTestServer(t, path, http.StatusOK, `{"id":"chatcmpl-1","object":"chat.completion.deleted","deleted":true}`)
+		r, err := e.DeleteChatCompletion(context.Background(), "chatcmpl-1")
+		require.NoError(t, err)
+		assert.Equal(t, &Deleted{Id: "chatcmpl-1", Object: "chat.completion.deleted", Deleted: true}, r)
+	})
+	t.Run("not found", func(t *testing.T) {
+		e := newDeleteTestServer(t, path, http.StatusNotFound, notFoundBody)
+		_, err := e.DeleteChatCompletion(context.Background(), "chatcmpl-1")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+	t.Run("not deleted", func(t *testing.T) {
+		e := newDeleteTestServer(t, path, http.StatusOK, `{"id":"chatcmpl-1","object":"chat.completion.deleted","deleted":false}`)
+		_, err := e.DeleteChatCompletion(context.Background(), "chatcmpl-1")
+		assert.ErrorIs(t, err, ErrNotDeleted)
+	})
+}
+
+func TestAPIErrorNotFound(t *testing.T) {
+	var apiErr APIError
+	apiErr.Err.StatusCode = http.StatusBadRequest
+	assert.NotErrorIs(t, apiErr, ErrNotFound)
+	apiErr.Err.StatusCode = http.StatusNotFound
+	assert.ErrorIs(t, apiErr, ErrNotFound)
+}
+
+func TestDeleteResponse(t *testing.T) {
+	e := newDeleteTestServer(t, "/responses/resp_1", http.StatusOK, `{"id":"resp_1","object":"response.deleted","deleted":true}`)
+	r, err := e.DeleteResponse(context.Background(), "resp_1")
+	require.NoError(t, err)
+	assert.Equal(t, &Deleted{Id: "resp_1", Object: "response.deleted", Deleted: true}, r)
+
+	e = newDeleteTestServer(t, "/responses/resp_1", http.StatusNotFound, notFoundBody)
+	_, err = e.DeleteResponse(context.Background(), "resp_1")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// FieldDiff is a field which differs between two options. The value of the field
+// is nil if it's unset, other values are decoded from the JSON representation of options:
+// numbers are json.Number, objects are map[string]interface{} and arrays are []interface{}.
+type FieldDiff struct {
+	// Path of the field, e.g. "temperature", "messages[0].content" or "metadata.tenant".
+	Path   string      `json:"path"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// String returns the diff in the form of "path: before -> after", values are rendered as JSON.
+func (d FieldDiff) String() string {
+	return fmt.Sprintf("%s: %s -> %s", d.Path, renderDiffValue(d.Before), renderDiffValue(d.After))
+}
+
+func renderDiffValue(v interface{}) string {
+	if v == nil {
+		return "<unset>"
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// DiffOptions returns the fields which differ between options a and b, as they are sent to the API.
+// Fields which aren't sent, e.g. Ctx, are ignored. Nil and empty slices and maps are equal to unset fields,
+// while zero values of pointer fields aren't. Nil options are equal to zero options. The diffs are ordered by path, fields of objects are ordered by name.
+func DiffOptions(a, b *ChatCompletionOptions) []FieldDiff {
+	var diffs []FieldDiff
+	// Objects and arrays are compared field by field, added and removed values are reported as a whole
+	diffValues(&diffs, "", optionsValue(a), optionsValue(b))
+	return diffs
+}
+
+// EqualOptions reports whether options a and b are sent to the API in the same way, see DiffOptions.
+func EqualOptions(a, b *ChatCompletionOptions) bool {
+	return len(DiffOptions(a, b)) == 0
+}
+
+func optionsValue(opts *ChatCompletionOptions) interface{} {
+	if opts == nil {
+		opts = &ChatCompletionOptions{}
+	}
+	b, err := json.Marshal(opts)
+	if err != nil {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil
+	}
+	return v
+}
+
+func diffValues(diffs *[]FieldDiff, path string, a, b interface{}) {
+	a, b = normalizeDiffValue(a), normalizeDiffValue(b)
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if aok && bok {
+		keys := make([]string, 0, len(am)+len(bm))
+		for k := range am {
+			keys = append(keys, k)
+		}
+		for k := range bm {
+			if _, ok := am[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			diffValues(diffs, joinDiffPath(path, k), am[k], bm[k])
+		}
+		return
+	}
+	as, aok := a.([]interface{})
+	bs, bok := b.([]interface{})
+	if aok && bok {
+		n := len(as)
+		if len(bs) > n {
+			n = len(bs)
+		}
+		for i := 0; i < n; i++ {
+			var av, bv interface{}
+			if i < len(as) {
+				av = as[i]
+			}
+			if i < len(bs) {
+				bv = bs[i]
+			}
+			diffValues(diffs, path+"["+strconv.Itoa(i)+"]", av, bv)
+		}
+		return
+	}
+	if a != b {
+		*diffs = append(*diffs, FieldDiff{Path: path, Before: a, After: b})
+	}
+}
+
+// normalizeDiffValue returns nil for empty arrays and objects, so they are equal to unset ones.
+func normalizeDiffValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+	}
+	return v
+}
+
+var diffIdentRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func joinDiffPath(path, key string) string {
+	if !diffIdentRe.MatchString(key) {
+		return path + "[" + strconv.Quote(key) + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
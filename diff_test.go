@@ -0,0 +1,90 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func diffTestOptions() *ChatCompletionOptions {
+	return &ChatCompletionOptions{
+		Model: ModelGPT4,
+		Messages: []ChatMessage{
+			{Role: "system", Content: "You are terse."},
+			{Role: "user", Content: "Describe the image."},
+		},
+		Temperature: 0.2,
+		Stop:        []string{"\n\n"},
+		Metadata:    map[string]string{"experiment": "base"},
+	}
+}
+
+func TestDiffOptions(t *testing.T) {
+	a := diffTestOptions()
+	b := diffTestOptions()
+	b.Ctx = context.Background()
+	b.Messages = append([]ChatMessage(nil), a.Messages...)
+	b.Messages[0].Content = "You are verbose."
+	b.Messages[1].Parts = []ContentPart{
+		{Type: ContentPartText, Text: "Describe the image."},
+		{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: "https://example.com/cat.png"}},
+	}
+	b.Messages = append(b.Messages, ChatMessage{Role: "user", Content: "Briefly."})
+	b.Temperature = 0.7
+	b.TopP = 0.9
+	b.Stop = nil
+	b.ParallelToolCalls = boolPtr(false)
+	b.Metadata = map[string]string{"experiment": "variant-b", "tenant.id": "acme"}
+
+	diffs := DiffOptions(a, b)
+	var lines []string
+	for _, d := range diffs {
+		lines = append(lines, d.String())
+	}
+	assert.Equal(t, strings.Join([]string{
+		`messages[0].content: "You are terse." -> "You are verbose."`,
+		`messages[1].content: "Describe the image." -> [{"text":"Describe the image.","type":"text"},{"image_url":{"url":"https://example.com/cat.png"},"type":"image_url"}]`,
+		`messages[2]: <unset> -> {"content":"Briefly.","role":"user"}`,
+		`metadata.experiment: "base" -> "variant-b"`,
+		`metadata["tenant.id"]: <unset> -> "acme"`,
+		`parallel_tool_calls: <unset> -> false`,
+		`stop: ["\n\n"] -> <unset>`,
+		`temperature: 0.2 -> 0.7`,
+		`top_p: <unset> -> 0.9`,
+	}, "\n"), strings.Join(lines, "\n"))
+
+	js, err := json.Marshal(diffs[len(diffs)-2])
+	require.NoError(t, err)
+	assert.Equal(t, `{"path":"temperature","before":0.2,"after":0.7}`, string(js))
+}
+
+func TestDiffOptionsEqual(t *testing.T) {
+	a := diffTestOptions()
+	b := diffTestOptions()
+	b.Ctx = context.Background()
+	assert.Empty(t, DiffOptions(a, b))
+	assert.True(t, EqualOptions(a, b))
+
+	// Nil and empty slices and maps are equal
+	a.Stop, b.Stop = nil, []string{}
+	a.Metadata, b.Metadata = map[string]string{}, nil
+	assert.True(t, EqualOptions(a, b))
+
+	// Pointer to the zero value isn't equal to nil
+	b.ParallelToolCalls = boolPtr(false)
+	assert.False(t, EqualOptions(a, b))
+
+	assert.True(t, EqualOptions(nil, nil))
+	assert.Equal(t, []FieldDiff{{Path: "model", Before: "", After: "gpt-4"}}, DiffOptions(nil, &ChatCompletionOptions{Model: ModelGPT4}))
+}
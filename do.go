@@ -0,0 +1,47 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// Do sends request to an arbitrary endpoint of the API, it makes possible to use endpoints
+// which aren't supported by the library yet. The path is relative to the base URL, e.g. "/responses".
+//
+// The request goes through the same pipeline as any other request (authorization, signing, retries, metrics).
+// The body is marshaled to JSON unless it's nil, the response is unmarshaled into result unless it's nil.
+func (e *Engine) Do(ctx context.Context, method, path string, body interface{}, result interface{}) error {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	uri := e.apiBaseURL + path
+	ctx = withRequestInfo(ctx, path, "")
+	var (
+		r        io.Reader
+		postType string
+	)
+	if body != nil {
+		var err error
+		if r, err = marshalJson(body); err != nil {
+			return err
+		}
+		postType = "json"
+	}
+	req, err := e.newReq(ctx, method, uri, postType, r)
+	if err != nil {
+		return err
+	}
+	resp, err := e.doReq(req)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		drainBody(resp.Body)
+		return nil
+	}
+	return unmarshal(resp, result)
+}
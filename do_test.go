@@ -0,0 +1,61 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/responses", r.URL.Path)
+		assert.Equal(t, "Bearer test", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]string{"model": "gpt-4o", "input": "hello"}, body)
+		w.Write([]byte(`{"id":"resp_1","status":"completed"}`))
+	}))
+	defer srv.Close()
+
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	var result struct {
+		Id     string `json:"id"`
+		Status string `json:"status"`
+	}
+	err := e.Do(context.Background(), http.MethodPost, "responses", map[string]string{
+		"model": "gpt-4o",
+		"input": "hello",
+	}, &result)
+	require.NoError(t, err)
+	assert.Equal(t, "resp_1", result.Id)
+	assert.Equal(t, "completed", result.Status)
+}
+
+func TestDoAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"message":"No such response","type":"invalid_request_error"}}`))
+	}))
+	defer srv.Close()
+
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	err := e.Do(context.Background(), http.MethodDelete, "/responses/resp_1", nil, nil)
+	var apiErr APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusNotFound, apiErr.Err.StatusCode)
+	assert.Equal(t, "No such response", apiErr.Err.Message)
+}
@@ -32,11 +32,7 @@ type EditResponse struct {
 		Index        int    `json:"index"`
 		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	Usage Usage `json:"usage"`
 }
 
 // Edit given a prompt and an instruction, the model will return an edited version of the prompt.
@@ -46,10 +42,11 @@ type EditResponse struct {
 //
 // Docs: https://beta.openai.com/docs/api-reference/edits
 func (e *Engine) Edit(ctx context.Context, opts *EditOptions) (*EditResponse, error) {
-	if err := e.validate.StructCtx(ctx, opts); err != nil {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
 		return nil, err
 	}
 	url := e.apiBaseURL + "/edits"
+	ctx = withRequestInfo(ctx, "/edits", opts.Model)
 	r, err := marshalJson(opts)
 	if err != nil {
 		return nil, err
@@ -66,5 +63,6 @@ func (e *Engine) Edit(ctx context.Context, opts *EditOptions) (*EditResponse, er
 	if err := unmarshal(resp, &jsonResp); err != nil {
 		return nil, err
 	}
+	e.recordUsage(opts.Model, jsonResp.Usage)
 	return &jsonResp, nil
 }
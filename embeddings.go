@@ -0,0 +1,238 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Embedding models.
+//
+// Learn more: https://platform.openai.com/docs/models/embeddings
+const (
+	ModelTextEmbeddingAda002 Model = "text-embedding-ada-002"
+	ModelTextEmbedding3Small Model = "text-embedding-3-small"
+	ModelTextEmbedding3Large Model = "text-embedding-3-large"
+)
+
+type EmbeddingsOptions struct {
+	// ID of the model to use.
+	Model Model `json:"model" binding:"required"`
+	// Input text to embed. Each input must not exceed the max input tokens for the model
+	// and the array can't have more than 2048 elements, unless AutoBatch is set.
+	Input []string `json:"input" binding:"required,min=1"`
+	// The number of dimensions the resulting output embeddings should have.
+	// Only supported in text-embedding-3 and later models.
+	Dimensions int `json:"dimensions,omitempty"`
+	// A unique identifier representing your end-user.
+	User string `json:"user,omitempty"`
+	// AutoBatch splits Input with more than BatchSize elements into batches, which are
+	// sent as separate requests and merged into one response.
+	AutoBatch bool `json:"-"`
+	// BatchSize is the maximum number of inputs per request if AutoBatch is set, 2048 if it's zero.
+	BatchSize int `json:"-" binding:"omitempty,max=2048"`
+	// BatchConcurrency is the number of batches sent in parallel, 1 if it's zero.
+	BatchConcurrency int `json:"-"`
+}
+
+// maxEmbeddingsInputs is the maximum number of inputs of the embeddings request.
+const maxEmbeddingsInputs = 2048
+
+type Embedding struct {
+	Object    string    `json:"object"`
+	Embedding []float32 `json:"embedding"`
+	Index     int       `json:"index"`
+}
+
+// ErrInconsistentDimensions is returned by EmbeddingsResponse.ToMatrix if the embeddings
+// of the response have different dimensions.
+var ErrInconsistentDimensions = errors.New("openai: inconsistent embedding dimensions")
+
+type EmbeddingsResponse struct {
+	Object string      `json:"object"`
+	Data   []Embedding `json:"data"`
+	Model  Model       `json:"model"`
+	Usage  Usage       `json:"usage"`
+}
+
+// Embeddings creates an embedding vector representing the input text.
+//
+// If the embeddings token limiter is set, the call blocks until the number of input tokens,
+// counted by the tokenizer of the model, fits into the budget.
+//
+// Docs: https://platform.openai.com/docs/api-reference/embeddings/create
+func (e *Engine) Embeddings(ctx context.Context, opts *EmbeddingsOptions) (*EmbeddingsResponse, error) {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	if opts.AutoBatch {
+		batchSize := opts.BatchSize
+		if batchSize <= 0 {
+			batchSize = maxEmbeddingsInputs
+		}
+		if len(opts.Input) > batchSize {
+			return e.embeddingsBatches(ctx, opts, batchSize)
+		}
+	}
+	uri := e.apiBaseURL + "/embeddings"
+	ctx = withRequestInfo(ctx, "/embeddings", opts.Model)
+	var reservation *TokenReservation
+	if e.embeddingsLimiter != nil {
+		var err error
+		reservation, err = e.embeddingsLimiter.Wait(ctx, inputTokens(opts.Model, opts.Input))
+		if err != nil {
+			return nil, err
+		}
+	}
+	jsonResp, err := e.embeddings(ctx, uri, opts)
+	if reservation != nil {
+		if err != nil {
+			// Failed requests don't consume tokens
+			reservation.Reconcile(0)
+		} else {
+			reservation.Reconcile(jsonResp.Usage.PromptTokens)
+		}
+	}
+	return jsonResp, err
+}
+
+func (e *Engine) embeddings(ctx context.Context, uri string, opts *EmbeddingsOptions) (*EmbeddingsResponse, error) {
+	r, err := marshalJson(opts)
+	if err != nil {
+		return nil, err
+	}
+	req, err := e.newReq(ctx, http.MethodPost, uri, "json", r)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.doReq(req)
+	if err != nil {
+		return nil, err
+	}
+	var jsonResp EmbeddingsResponse
+	if err := unmarshal(resp, &jsonResp); err != nil {
+		return nil, err
+	}
+	e.recordUsage(opts.Model, jsonResp.Usage)
+	return &jsonResp, nil
+}
+
+// embeddingsBatches sends Input in batches of batchSize elements and merges the responses.
+// The indices of embeddings are relative to the whole Input and the usage is summed across
+// batches. The first failed batch cancels the rest and its error is returned.
+func (e *Engine) embeddingsBatches(ctx context.Context, opts *EmbeddingsOptions, batchSize int) (*EmbeddingsResponse, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	n := (len(opts.Input) + batchSize - 1) / batchSize
+	responses := make([]*EmbeddingsResponse, n)
+	var (
+		mu       sync.Mutex
+		firstErr error
+	)
+	errs := e.runBatch(ctx, "/embeddings", n, BatchOptions{Concurrency: opts.BatchConcurrency}, func(ctx context.Context, i int) error {
+		batch := *opts
+		batch.AutoBatch = false
+		batch.Input = opts.Input[i*batchSize : min((i+1)*batchSize, len(opts.Input))]
+		var err error
+		responses[i], err = e.Embeddings(ctx, &batch)
+		if err != nil {
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = err
+				cancel()
+			}
+			mu.Unlock()
+		}
+		return err
+	})
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	for _, err := range errs {
+		if err != nil {
+			// The batch wasn't sent, because ctx is done
+			return nil, err
+		}
+	}
+	result := &EmbeddingsResponse{
+		Object: responses[0].Object,
+		Model:  responses[0].Model,
+		Data:   make([]Embedding, 0, len(opts.Input)),
+	}
+	for i, resp := range responses {
+		for _, embedding := range resp.Data {
+			embedding.Index += i * batchSize
+			result.Data = append(result.Data, embedding)
+		}
+		result.Usage.PromptTokens += resp.Usage.PromptTokens
+		result.Usage.CompletionTokens += resp.Usage.CompletionTokens
+		result.Usage.TotalTokens += resp.Usage.TotalTokens
+	}
+	return result, nil
+}
+
+// EmbedOption is used to set optional parameters of EmbedString and EmbedStrings.
+type EmbedOption func(opts *EmbeddingsOptions)
+
+// WithEmbedDimensions is used to set the number of dimensions of the embeddings.
+func WithEmbedDimensions(dimensions int) EmbedOption {
+	return func(opts *EmbeddingsOptions) {
+		opts.Dimensions = dimensions
+	}
+}
+
+// WithEmbedUser is used to set the unique identifier of the end-user.
+func WithEmbedUser(user string) EmbedOption {
+	return func(opts *EmbeddingsOptions) {
+		opts.User = user
+	}
+}
+
+// EmbedString returns the embedding vector of the text.
+func (e *Engine) EmbedString(ctx context.Context, model Model, text string, opts ...EmbedOption) ([]float32, error) {
+	vectors, err := e.EmbedStrings(ctx, model, []string{text}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// EmbedStrings returns embedding vectors of the texts, in the order of texts.
+func (e *Engine) EmbedStrings(ctx context.Context, model Model, texts []string, opts ...EmbedOption) ([][]float32, error) {
+	req := &EmbeddingsOptions{Model: model, Input: texts}
+	for _, opt := range opts {
+		opt(req)
+	}
+	resp, err := e.Embeddings(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.vectors(len(texts))
+}
+
+// vectors returns the embedding vectors ordered by their index. The response must have
+// exactly one embedding for each of n inputs.
+func (r *EmbeddingsResponse) vectors(n int) ([][]float32, error) {
+	if len(r.Data) != n {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", n, len(r.Data))
+	}
+	vectors := make([][]float32, n)
+	for _, embedding := range r.Data {
+		if embedding.Index < 0 || embedding.Index >= n {
+			return nil, fmt.Errorf("embedding index %d out of range [0, %d)", embedding.Index, n)
+		}
+		if vectors[embedding.Index] != nil {
+			return nil, fmt.Errorf("duplicate embedding index %d", embedding.Index)
+		}
+		vectors[embedding.Index] = embedding.Embedding
+	}
+	return vectors, nil
+}
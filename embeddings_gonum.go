@@ -0,0 +1,45 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+//go:build gonum
+
+package openai
+
+import (
+	"fmt"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// ToMatrix is used to assemble the embeddings of the response into the dense matrix, one row per
+// embedding in the order of Index, e.g. to use them with gonum/mat or gonum/stat.
+// ErrInconsistentDimensions is returned if the embeddings have different dimensions.
+// The matrix is nil if the response has no embeddings.
+//
+// The method is only available with the "gonum" build tag, so gonum isn't a mandatory dependency.
+func (r *EmbeddingsResponse) ToMatrix() (*mat.Dense, error) {
+	if len(r.Data) == 0 {
+		return nil, nil
+	}
+	data := append([]Embedding(nil), r.Data...)
+	sort.SliceStable(data, func(i, j int) bool {
+		return data[i].Index < data[j].Index
+	})
+	dims := len(data[0].Embedding)
+	if dims == 0 {
+		return nil, fmt.Errorf("%w: embedding %d is empty", ErrInconsistentDimensions, data[0].Index)
+	}
+	values := make([]float64, 0, len(data)*dims)
+	for _, embedding := range data {
+		if len(embedding.Embedding) != dims {
+			return nil, fmt.Errorf("%w: embedding %d has %d dimensions, expected %d",
+				ErrInconsistentDimensions, embedding.Index, len(embedding.Embedding), dims)
+		}
+		for _, v := range embedding.Embedding {
+			values = append(values, float64(v))
+		}
+	}
+	return mat.NewDense(len(data), dims, values), nil
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+//go:build gonum
+
+package openai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddingsToMatrix(t *testing.T) {
+	resp := &EmbeddingsResponse{Data: []Embedding{
+		{Index: 1, Embedding: []float32{4, 5, 6}},
+		{Index: 0, Embedding: []float32{1, 2, 3}},
+	}}
+	m, err := resp.ToMatrix()
+	require.NoError(t, err)
+	rows, cols := m.Dims()
+	assert.Equal(t, 2, rows)
+	assert.Equal(t, 3, cols)
+	assert.Equal(t, []float64{1, 2, 3}, m.RawRowView(0), "rows must be in the order of index")
+	assert.Equal(t, []float64{4, 5, 6}, m.RawRowView(1))
+
+	resp.Data = append(resp.Data, Embedding{Index: 2, Embedding: []float32{7, 8}})
+	_, err = resp.ToMatrix()
+	assert.ErrorIs(t, err, ErrInconsistentDimensions)
+
+	m, err = new(EmbeddingsResponse).ToMatrix()
+	require.NoError(t, err)
+	assert.Nil(t, m)
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newEmbeddingsTestServer(t *testing.T, response string) (*Engine, *map[string]interface{}) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(srv.Close)
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	return e, &body
+}
+
+func TestEmbedString(t *testing.T) {
+	e, body := newEmbeddingsTestServer(t, `{"data":[{"embedding":[0.1,0.2],"index":0}]}`)
+	v, err := e.EmbedString(context.Background(), ModelTextEmbedding3Small, "hello",
+		WithEmbedDimensions(2), WithEmbedUser("user-1"))
+	require.NoError(t, err)
+	assert.Equal(t, []float32{0.1, 0.2}, v)
+	assert.Equal(t, map[string]interface{}{
+		"model":      "text-embedding-3-small",
+		"input":      []interface{}{"hello"},
+		"dimensions": float64(2),
+		"user":       "user-1",
+	}, *body)
+}
+
+func TestEmbedStringUnexpectedCount(t *testing.T) {
+	for _, response := range []string{
+		`{"data":[]}`,
+		`{"data":[{"embedding":[0.1],"index":0},{"embedding":[0.2],"index":1}]}`,
+	} {
+		e, _ := newEmbeddingsTestServer(t, response)
+		_, err := e.EmbedString(context.Background(), ModelTextEmbedding3Small, "hello")
+		assert.ErrorContains(t, err, "expected 1 embeddings")
+	}
+}
+
+func TestEmbedStringsOrder(t *testing.T) {
+	e, _ := newEmbeddingsTestServer(t, `{"data":[
+		{"embedding":[3],"index":2},
+		{"embedding":[1],"index":0},
+		{"embedding":[2],"index":1}
+	]}`)
+	v, err := e.EmbedStrings(context.Background(), ModelTextEmbedding3Small, []string{"a", "b", "c"})
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{1}, {2}, {3}}, v)
+}
+
+func TestEmbedStringsInvalidIndex(t *testing.T) {
+	for _, response := range []string{
+		`{"data":[{"embedding":[1],"index":0},{"embedding":[2],"index":0}]}`,
+		`{"data":[{"embedding":[1],"index":0},{"embedding":[2],"index":2}]}`,
+	} {
+		e, _ := newEmbeddingsTestServer(t, response)
+		_, err := e.EmbedStrings(context.Background(), ModelTextEmbedding3Small, []string{"a", "b"})
+		assert.Error(t, err)
+	}
+}
+
+func TestEmbedStringsAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"too long","type":"invalid_request_error"}}`))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	_, err := e.EmbedStrings(context.Background(), ModelTextEmbedding3Small, []string{"a"})
+	var apiErr APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "too long", apiErr.Err.Message)
+
+	_, err = e.EmbedStrings(context.Background(), ModelTextEmbedding3Small, nil)
+	assert.Error(t, err, "empty input is rejected by validation")
+}
+
+// newEmbeddingsEchoServer embeds every input as its length, in reverse order of inputs.
+// Inputs longer than fail are rejected.
+func newEmbeddingsEchoServer(t *testing.T, fail int) (*Engine, *[][]string) {
+	var (
+		mu      sync.Mutex
+		batches [][]string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req EmbeddingsOptions
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		mu.Lock()
+		batches = append(batches, req.Input)
+		mu.Unlock()
+		resp := EmbeddingsResponse{Object: "list", Model: req.Model}
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			if fail > 0 && len(req.Input[i]) >= fail {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":{"message":"too long","type":"invalid_request_error"}}`))
+				return
+			}
+			resp.Data = append(resp.Data, Embedding{Embedding: []float32{float32(len(req.Input[i]))}, Index: i})
+		}
+		resp.Usage = Usage{PromptTokens: len(req.Input), TotalTokens: len(req.Input)}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	return e, &batches
+}
+
+func TestEmbeddingsAutoBatch(t *testing.T) {
+	input := make([]string, 5000)
+	for i := range input {
+		input[i] = strings.Repeat("a", i%7+1)
+	}
+	for _, concurrency := range []int{0, 3} {
+		e, batches := newEmbeddingsEchoServer(t, 0)
+		resp, err := e.Embeddings(context.Background(), &EmbeddingsOptions{
+			Model:            ModelTextEmbedding3Small,
+			Input:            input,
+			AutoBatch:        true,
+			BatchConcurrency: concurrency,
+		})
+		require.NoError(t, err)
+		require.Len(t, *batches, 3)
+		sizes := []int{len((*batches)[0]), len((*batches)[1]), len((*batches)[2])}
+		assert.ElementsMatch(t, []int{2048, 2048, 904}, sizes)
+		assert.Equal(t, Usage{PromptTokens: 5000, TotalTokens: 5000}, resp.Usage)
+		assert.Equal(t, ModelTextEmbedding3Small, resp.Model)
+
+		vectors, err := resp.vectors(len(input))
+		require.NoError(t, err)
+		for i, v := range vectors {
+			require.Equal(t, []float32{float32(len(input[i]))}, v, "embedding %d", i)
+		}
+	}
+}
+
+func TestEmbeddingsAutoBatchSize(t *testing.T) {
+	e, batches := newEmbeddingsEchoServer(t, 0)
+	vectors, err := e.EmbedStrings(context.Background(), ModelTextEmbedding3Small, []string{"a", "bb", "ccc"}, func(opts *EmbeddingsOptions) {
+		opts.AutoBatch = true
+		opts.BatchSize = 2
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "bb"}, {"ccc"}}, *batches)
+	assert.Equal(t, [][]float32{{1}, {2}, {3}}, vectors)
+
+	_, err = e.Embeddings(context.Background(), &EmbeddingsOptions{Model: ModelTextEmbedding3Small, Input: []string{"a"}, AutoBatch: true, BatchSize: 4096})
+	assert.Error(t, err, "batch size is limited by validation")
+}
+
+func TestEmbeddingsAutoBatchSmallInput(t *testing.T) {
+	e, batches := newEmbeddingsEchoServer(t, 0)
+	_, err := e.Embeddings(context.Background(), &EmbeddingsOptions{Model: ModelTextEmbedding3Small, Input: []string{"a", "b"}, AutoBatch: true})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "b"}}, *batches)
+}
+
+func TestEmbeddingsAutoBatchError(t *testing.T) {
+	e, batches := newEmbeddingsEchoServer(t, 3)
+	_, err := e.Embeddings(context.Background(), &EmbeddingsOptions{
+		Model:     ModelTextEmbedding3Small,
+		Input:     []string{"a", "b", "ccc", "d", "e", "f"},
+		AutoBatch: true,
+		BatchSize: 2,
+	})
+	var apiErr APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "too long", apiErr.Err.Message)
+	assert.Len(t, *batches, 2, "the batches after the failed one aren't sent")
+}
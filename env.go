@@ -0,0 +1,203 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables read by NewEngineFromEnv.
+const (
+	EnvAPIKey         = "OPENAI_API_KEY"
+	EnvBaseURL        = "OPENAI_BASE_URL"
+	EnvOrganizationId = "OPENAI_ORG_ID"
+	EnvLogLevel       = "OPENAI_LOG_LEVEL"
+	EnvLogBody        = "OPENAI_LOG_BODY"
+)
+
+// ErrNoAPIKey is returned by NewEngineFromEnv if OPENAI_API_KEY isn't set.
+var ErrNoAPIKey = errors.New("openai: " + EnvAPIKey + " isn't set")
+
+// NewEngineFromEnv is used to initialize engine configured by the environment variables:
+//
+//   - OPENAI_API_KEY is the API key, it's required.
+//   - OPENAI_BASE_URL is the API base URL, e.g. of the proxy.
+//   - OPENAI_ORG_ID is the organization ID, see SetOrganizationId.
+//   - OPENAI_LOG_LEVEL is the level of the log of the requests, one of debug, info, warn, error
+//     and off. Every attempt of the requests is logged with the handler of the default slog
+//     logger, regardless of the level of the default logger: the successful ones at the debug
+//     level, and the failed ones, including those which are retried, at the warn level. The
+//     credentials aren't logged. The requests aren't logged if it's off or isn't set.
+//   - OPENAI_LOG_BODY=1 logs the bodies of the requests and the responses along with the attempts,
+//     up to 4096 bytes each, the bodies of the streamed responses aren't logged. They are logged
+//     at the debug level, so it only takes effect with OPENAI_LOG_LEVEL=debug.
+//     WARNING: the bodies carry the prompts and the completions, which may contain personal
+//     and other sensitive data. Only enable it for troubleshooting.
+//
+// It's useful to enable the logging during the deployment troubleshooting without code changes.
+// opts are applied after the configuration of the environment, so they take precedence over it.
+func NewEngineFromEnv(opts ...EngineOption) (*Engine, error) {
+	apiKey := os.Getenv(EnvAPIKey)
+	if apiKey == "" {
+		return nil, ErrNoAPIKey
+	}
+	var envOpts []EngineOption
+	if baseURL := os.Getenv(EnvBaseURL); baseURL != "" {
+		envOpts = append(envOpts, func(e *Engine) {
+			e.apiBaseURL = strings.TrimSuffix(baseURL, "/")
+		})
+	}
+	if organizationId := os.Getenv(EnvOrganizationId); organizationId != "" {
+		envOpts = append(envOpts, func(e *Engine) {
+			e.organizationId = organizationId
+		})
+	}
+	if v := os.Getenv(EnvLogLevel); v != "" {
+		level, off, err := parseLogLevel(v)
+		if err != nil {
+			return nil, err
+		}
+		if !off {
+			logger := slog.New(levelHandler{level: level, h: slog.Default().Handler()})
+			envOpts = append(envOpts, func(e *Engine) {
+				e.logger = logger
+			})
+		}
+	}
+	if v := os.Getenv(EnvLogBody); v != "" {
+		logBody, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("openai: invalid %s %q: %w", EnvLogBody, v, err)
+		}
+		if logBody {
+			envOpts = append(envOpts, func(e *Engine) {
+				e.logBodies = true
+			})
+		}
+	}
+	return New(apiKey, append(envOpts, opts...)...), nil
+}
+
+// maxLogBodyLength is the maximum number of bytes of the request and response bodies in the log.
+const maxLogBodyLength = 4096
+
+// parseLogLevel parses the value of OPENAI_LOG_LEVEL.
+func parseLogLevel(v string) (level slog.Level, off bool, err error) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "debug":
+		return slog.LevelDebug, false, nil
+	case "info":
+		return slog.LevelInfo, false, nil
+	case "warn", "warning":
+		return slog.LevelWarn, false, nil
+	case "error":
+		return slog.LevelError, false, nil
+	case "off":
+		return 0, true, nil
+	}
+	return 0, false, fmt.Errorf("openai: invalid %s %q, must be one of debug, info, warn, error and off", EnvLogLevel, v)
+}
+
+// logAttempt logs the nth attempt of the request, counting from 1, which took d and ended with resp or err.
+func (e *Engine) logAttempt(attempt *http.Request, n int, d time.Duration, resp *http.Response, err error) {
+	if e.logger == nil {
+		return
+	}
+	ctx := attempt.Context()
+	level := slog.LevelDebug
+	if err != nil || resp.StatusCode >= 400 {
+		level = slog.LevelWarn
+	}
+	if !e.logger.Enabled(ctx, level) {
+		return
+	}
+	info := requestInfoFrom(ctx)
+	attrs := []slog.Attr{
+		slog.String("method", attempt.Method),
+		slog.String("url", attempt.URL.Redacted()),
+		slog.String("endpoint", info.endpoint),
+		slog.Int("attempt", n),
+		slog.Duration("duration", d),
+	}
+	if info.model != "" {
+		attrs = append(attrs, slog.String("model", string(info.model)))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	} else {
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+		if id := resp.Header.Get("X-Request-Id"); id != "" {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+	}
+	if e.logBodies && e.logger.Enabled(ctx, slog.LevelDebug) {
+		if attempt.GetBody != nil {
+			if body, err := attempt.GetBody(); err == nil {
+				attrs = append(attrs, slog.String("request_body", readLogBody(body)))
+			}
+		}
+		if resp != nil && !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+			// Only the logged part is read, the body may be the large download
+			b, readErr := io.ReadAll(io.LimitReader(resp.Body, maxLogBodyLength+1))
+			// The body is read again by the caller
+			resp.Body = &prefixedBody{Reader: io.MultiReader(bytes.NewReader(b), resp.Body), Closer: resp.Body}
+			if readErr == nil {
+				attrs = append(attrs, slog.String("response_body", truncateLogBody(b)))
+			}
+		}
+	}
+	e.logger.LogAttrs(ctx, level, "openai: request", attrs...)
+}
+
+// prefixedBody is the body of the response whose beginning was read for the log.
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
+
+func readLogBody(body io.ReadCloser) string {
+	defer body.Close()
+	b, _ := io.ReadAll(io.LimitReader(body, maxLogBodyLength+1))
+	return truncateLogBody(b)
+}
+
+func truncateLogBody(b []byte) string {
+	if len(b) > maxLogBodyLength {
+		return string(b[:maxLogBodyLength]) + "..."
+	}
+	return string(b)
+}
+
+// levelHandler is the handler which logs the records of the level and above with h,
+// regardless of the level h is enabled for.
+type levelHandler struct {
+	level slog.Leveler
+	h     slog.Handler
+}
+
+func (h levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.h.Handle(ctx, r)
+}
+
+func (h levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return levelHandler{level: h.level, h: h.h.WithAttrs(attrs)}
+}
+
+func (h levelHandler) WithGroup(name string) slog.Handler {
+	return levelHandler{level: h.level, h: h.h.WithGroup(name)}
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setDefaultLogger sets the default slog logger writing to buf of the info level for the test.
+func setDefaultLogger(t *testing.T, buf *bytes.Buffer) {
+	t.Helper()
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+}
+
+func TestNewEngineFromEnv(t *testing.T) {
+	srv := newChatTestServer(t, nil)
+	t.Setenv(EnvAPIKey, "sk-env")
+	t.Setenv(EnvBaseURL, srv.URL+"/")
+	t.Setenv(EnvOrganizationId, "org-env")
+	t.Setenv(EnvLogLevel, "")
+	t.Setenv(EnvLogBody, "")
+
+	e, err := NewEngineFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, "sk-env", e.apiKey)
+	assert.Equal(t, srv.URL, e.apiBaseURL)
+	assert.Equal(t, "org-env", e.organizationId)
+	assert.Nil(t, e.logger, "the requests aren't logged by default")
+
+	e, err = NewEngineFromEnv(func(e *Engine) { e.organizationId = "org-opt" })
+	require.NoError(t, err)
+	assert.Equal(t, "org-opt", e.organizationId, "opts take precedence over the environment")
+
+	t.Setenv(EnvAPIKey, "")
+	_, err = NewEngineFromEnv()
+	assert.True(t, errors.Is(err, ErrNoAPIKey))
+}
+
+func TestNewEngineFromEnvLogLevel(t *testing.T) {
+	srv := newChatTestServer(t, nil)
+	t.Setenv(EnvAPIKey, "sk-env")
+	t.Setenv(EnvBaseURL, srv.URL)
+	t.Setenv(EnvLogBody, "")
+
+	for _, tt := range []struct {
+		level  string
+		logged bool
+	}{
+		{level: "debug", logged: true},
+		{level: "DEBUG", logged: true},
+		{level: "info"},
+		{level: "error"},
+		{level: "off"},
+	} {
+		t.Run(tt.level, func(t *testing.T) {
+			var buf bytes.Buffer
+			setDefaultLogger(t, &buf)
+			t.Setenv(EnvLogLevel, tt.level)
+			e, err := NewEngineFromEnv()
+			require.NoError(t, err)
+			_, err = e.ChatCompletion(context.Background(), testChatOptions())
+			require.NoError(t, err)
+			if tt.logged {
+				assert.Contains(t, buf.String(), "level=DEBUG", "the level of the default logger doesn't apply")
+				assert.Contains(t, buf.String(), "status=200")
+			} else {
+				assert.Empty(t, buf.String())
+			}
+		})
+	}
+
+	t.Setenv(EnvLogLevel, "verbose")
+	_, err := NewEngineFromEnv()
+	assert.EqualError(t, err, `openai: invalid OPENAI_LOG_LEVEL "verbose", must be one of debug, info, warn, error and off`)
+}
+
+func TestNewEngineFromEnvLogBody(t *testing.T) {
+	srv := newChatTestServer(t, nil)
+	t.Setenv(EnvAPIKey, "sk-env")
+	t.Setenv(EnvBaseURL, srv.URL)
+	t.Setenv(EnvLogLevel, "debug")
+
+	var buf bytes.Buffer
+	setDefaultLogger(t, &buf)
+	t.Setenv(EnvLogBody, "1")
+	e, err := NewEngineFromEnv()
+	require.NoError(t, err)
+	_, err = e.ChatCompletion(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "request_body=")
+	assert.Contains(t, buf.String(), "response_body=")
+
+	t.Setenv(EnvLogBody, "yes")
+	_, err = NewEngineFromEnv()
+	assert.Error(t, err)
+}
+
+func TestLogAttempt(t *testing.T) {
+	var calls int
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-Request-Id", "req_"+strings.Repeat("1", calls))
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":{"message":"overloaded"}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+	})
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	e := New("sk-secret")
+	e.logger = logger
+	e.apiBaseURL = srv.URL
+	e.clock = newAutoClock()
+	e.SetMaxRetries(1)
+
+	_, err := e.ChatCompletion(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2, "every attempt is logged")
+	assert.Contains(t, lines[0], "level=WARN")
+	assert.Contains(t, lines[0], "status=503")
+	assert.Contains(t, lines[0], "attempt=1")
+	assert.Contains(t, lines[0], "request_id=req_1")
+	assert.Contains(t, lines[1], "level=DEBUG")
+	assert.Contains(t, lines[1], "method=POST")
+	assert.Contains(t, lines[1], "endpoint=/chat/completions")
+	assert.Contains(t, lines[1], "model=gpt-3.5-turbo")
+	assert.Contains(t, lines[1], "status=200")
+	assert.Contains(t, lines[1], "attempt=2")
+	assert.NotContains(t, buf.String(), "sk-secret")
+	assert.NotContains(t, buf.String(), "hello", "the bodies aren't logged by default")
+
+	buf.Reset()
+	e = New("sk-secret")
+	e.logger, e.logBodies = logger, true
+	e.apiBaseURL = srv.URL
+	r, err := e.ChatCompletion(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	assert.Equal(t, "hi", r.Choices[0].Message.Content, "logged response must still be readable")
+	assert.Contains(t, buf.String(), `\"content\":\"hello\"`)
+	assert.Contains(t, buf.String(), `\"content\":\"hi\"`)
+
+	buf.Reset()
+	e = New("sk-secret")
+	e.logger, e.logBodies = slog.New(slog.NewTextHandler(&buf, nil)), true
+	e.apiBaseURL = srv.URL
+	_, err = e.ChatCompletion(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	assert.Empty(t, buf.String(), "the successful attempts are logged at the debug level")
+}
+
+func TestLogAttemptLargeBody(t *testing.T) {
+	content := strings.Repeat("a", 3*maxLogBodyLength)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+	var buf bytes.Buffer
+	e := New("sk-secret")
+	e.logger, e.logBodies = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})), true
+	e.apiBaseURL = srv.URL
+
+	req, err := e.newReq(context.Background(), http.MethodGet, srv.URL+"/files/file-abc123/content", "", nil)
+	require.NoError(t, err)
+	resp, err := e.doReq(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(b), "the body is read on after the logged part")
+	assert.Contains(t, buf.String(), "response_body="+strings.Repeat("a", maxLogBodyLength)+"...")
+}
+
+func TestTruncateLogBody(t *testing.T) {
+	assert.Equal(t, "short", truncateLogBody([]byte("short")))
+	long := truncateLogBody(bytes.Repeat([]byte("a"), maxLogBodyLength+10))
+	assert.Equal(t, maxLogBodyLength+3, len(long))
+	assert.True(t, strings.HasSuffix(long, "..."))
+}
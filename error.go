@@ -3,14 +3,41 @@
 // that can be found in the LICENSE file.
 package openai
 
-import "encoding/json"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrStreamCanceled is returned by Recv when the stream was abandoned by the caller,
+	// i.e. the context of the request is done. The error also wraps the context error.
+	ErrStreamCanceled = errors.New("openai: stream canceled")
+	// ErrStreamClosed is returned by Recv when the stream ended before it was finished,
+	// e.g. the server closed the connection. The error also wraps the read error.
+	ErrStreamClosed = errors.New("openai: stream closed before completion")
+	// ErrRateLimit is matched by the APIError of responses rejected by the rate limit.
+	// It isn't matched by 429 responses of the exceeded quota, which aren't transient.
+	ErrRateLimit = errors.New("openai: rate limit exceeded")
+	// ErrUnauthorized is matched by the APIError of 401 responses, e.g. if the API key is invalid.
+	ErrUnauthorized = errors.New("openai: unauthorized")
+	// ErrForbidden is matched by the APIError of 403 responses, e.g. if the API key has no access
+	// to the organization or the project.
+	ErrForbidden = errors.New("openai: forbidden")
+)
 
 type APIError struct {
 	Err struct {
 		StatusCode int    `json:"status_code"`
 		Message    string `json:"message"`
 		Type       string `json:"type"`
+		Code       string `json:"code,omitempty"`
 	} `json:"error"`
+	// cause is the error which ended the request after the error response,
+	// e.g. the deadline exceeded while waiting to retry.
+	cause error
 }
 
 func (e APIError) Error() string {
@@ -18,5 +45,70 @@ func (e APIError) Error() string {
 	if err != nil {
 		return "undefined error"
 	}
+	if e.cause != nil {
+		return string(b) + ": " + e.cause.Error()
+	}
 	return string(b)
 }
+
+// Unwrap returns the error which ended the request after the error response, e.g.
+// context.DeadlineExceeded if the deadline exceeded while waiting to retry. It's nil
+// if the error response was final.
+func (e APIError) Unwrap() error {
+	return e.cause
+}
+
+// Is reports whether the error matches target, i.e. ErrNotFound for 404 responses,
+// ErrUnauthorized for 401, ErrForbidden for 403 and ErrRateLimit for responses rejected
+// by the rate limit.
+func (e APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Err.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.Err.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.Err.StatusCode == http.StatusForbidden
+	case ErrRateLimit:
+		return e.Err.Code == "rate_limit_exceeded" ||
+			e.Err.StatusCode == http.StatusTooManyRequests && e.Err.Code != "insufficient_quota"
+	}
+	return false
+}
+
+// newAPIError decodes the error response.
+func newAPIError(resp *http.Response) (APIError, error) {
+	var apiErr APIError
+	if err := unmarshal(resp, &apiErr); err != nil {
+		return apiErr, err
+	}
+	if apiErr.Err.StatusCode == 0 {
+		// Overwrite apiErr status code if it's zero
+		apiErr.Err.StatusCode = resp.StatusCode
+	}
+	return apiErr, nil
+}
+
+// contextError classifies err of the request made with ctx. If ctx is done, the returned
+// error wraps context.Canceled or context.DeadlineExceeded, no matter where the request failed.
+func contextError(ctx context.Context, err error) error {
+	ctxErr := doneReason(ctx)
+	if ctxErr == nil || errors.Is(err, ctxErr) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ctxErr, err)
+}
+
+// doneReason returns context.Canceled or context.DeadlineExceeded if ctx is done.
+// The cause is preferred over ctx.Err(), so the deadline of the options context
+// merged into ctx is reported as DeadlineExceeded rather than Canceled.
+func doneReason(ctx context.Context) error {
+	err := ctx.Err()
+	if err == nil {
+		return nil
+	}
+	if cause := context.Cause(ctx); errors.Is(cause, context.DeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
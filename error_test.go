@@ -0,0 +1,65 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIErrorIsRateLimit(t *testing.T) {
+	for _, tc := range []struct {
+		statusCode int
+		code       string
+		want       bool
+	}{
+		{http.StatusTooManyRequests, "rate_limit_exceeded", true},
+		{http.StatusTooManyRequests, "", true},
+		{http.StatusTooManyRequests, "insufficient_quota", false},
+		{0, "rate_limit_exceeded", true},
+		{http.StatusBadRequest, "", false},
+	} {
+		var apiErr APIError
+		apiErr.Err.StatusCode, apiErr.Err.Code = tc.statusCode, tc.code
+		err := fmt.Errorf("chat: %w", apiErr)
+		assert.Equal(t, tc.want, errors.Is(err, ErrRateLimit), "%d %s", tc.statusCode, tc.code)
+		assert.False(t, errors.Is(err, ErrNotFound))
+	}
+}
+
+func TestAPIErrorUnwrap(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"message":"slow down","type":"requests","code":"rate_limit_exceeded"}}`))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	e.SetMaxRetries(3)
+	e.backoff = func(int, *http.Response) time.Duration { return time.Minute }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := e.ListModels(ctx)
+	assert.ErrorIs(t, err, ErrRateLimit)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "the deadline exceeded while waiting to retry")
+	var apiErr APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "slow down", apiErr.Err.Message)
+	assert.Contains(t, err.Error(), "context deadline exceeded")
+
+	e.SetMaxRetries(0)
+	_, err = e.ListModels(context.Background())
+	assert.ErrorIs(t, err, ErrRateLimit)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Nil(t, apiErr.Unwrap(), "the final error response doesn't wrap anything")
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// maxFallbackRetries is the maximum number of retries of every model of the fallback chain.
+const maxFallbackRetries = 1
+
+// FallbackAttempt is the failed attempt of the model of the fallback chain.
+type FallbackAttempt struct {
+	Model Model
+	Err   error
+}
+
+// FallbackResult is the result of ChatCompletionWithFallback.
+type FallbackResult struct {
+	// The response of the model which served the request, nil if all models failed.
+	Response *ChatCompletionResponse
+	// The model which served the request, empty if all models failed.
+	Model Model
+	// The failed attempts in the order of models.
+	Failed []FallbackAttempt
+}
+
+// ChatCompletionWithFallback is like ChatCompletion, but if opts.Model fails because it's overloaded,
+// rate limited, out of quota or the server fails, the request is sent to the fallback models in order
+// until one of them succeeds. Other errors, e.g. invalid requests or content filter blocks, are returned
+// right away. The request is translated for every model by the model profiles of engine (WithModelProfiles).
+//
+// Every model is retried at most once, even if engine is set to retry more (SetMaxRetries), so the latency
+// of the chain is bounded by the number of models. It may be lowered further with ContextWithMaxRetries.
+//
+// The result tells which model served the request and which ones failed, it's returned along with the error
+// of the last model if all of them failed.
+func (e *Engine) ChatCompletionWithFallback(ctx context.Context, opts *ChatCompletionOptions, fallbacks []Model) (*FallbackResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	maxRetries := maxFallbackRetries
+	if n, ok := ctx.Value(maxRetriesKey{}).(int); ok {
+		maxRetries = min(n, maxFallbackRetries)
+	}
+	ctx = ContextWithMaxRetries(ctx, maxRetries)
+	result := &FallbackResult{}
+	models := append([]Model{opts.Model}, fallbacks...)
+	var err error
+	for _, model := range models {
+		attempt := *opts
+		attempt.Model = model
+		var resp *ChatCompletionResponse
+		if resp, err = e.ChatCompletion(ctx, &attempt); err == nil {
+			result.Response, result.Model = resp, model
+			return result, nil
+		}
+		result.Failed = append(result.Failed, FallbackAttempt{Model: model, Err: err})
+		if !isFallbackError(err) || ctx.Err() != nil {
+			break
+		}
+	}
+	return result, err
+}
+
+// isFallbackError reports whether the model failed because of its capacity or the server,
+// so another model may succeed.
+func isFallbackError(err error) bool {
+	var apiErr APIError
+	if !errors.As(err, &apiErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	switch apiErr.Err.Code {
+	case "content_filter", "content_policy_violation":
+		return false
+	}
+	return apiErr.Err.StatusCode == http.StatusTooManyRequests || apiErr.Err.StatusCode >= 500
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFallbackServer answers chat completions of every model with the scripted status code,
+// 200 if the model isn't scripted. The bodies of requests are recorded by model.
+func newFallbackServer(t *testing.T, statuses map[Model]int, opts ...EngineOption) (*Engine, map[Model][]map[string]interface{}) {
+	var mu sync.Mutex
+	requests := make(map[Model][]map[string]interface{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		model := Model(body["model"].(string))
+		mu.Lock()
+		requests[model] = append(requests[model], body)
+		mu.Unlock()
+		switch status := statuses[model]; status {
+		case 0:
+			w.Write([]byte(`{"id":"chatcmpl-1","model":"` + string(model) + `","choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+		case http.StatusBadRequest:
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":{"message":"blocked","type":"invalid_request_error","code":"content_filter"}}`))
+		default:
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":{"message":"overloaded","type":"server_error","code":"rate_limit_exceeded"}}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	e := New("sk-test", opts...)
+	e.apiBaseURL = srv.URL
+	e.clock = newAutoClock()
+	return e, requests
+}
+
+func TestChatCompletionWithFallback(t *testing.T) {
+	registry := NewModelProfileRegistry()
+	require.NoError(t, registry.Register(string(ModelGPT3Dot5Turbo), ModelProfile{NoParallelToolCalls: true}))
+	e, requests := newFallbackServer(t, map[Model]int{ModelGPT4: http.StatusTooManyRequests}, WithModelProfiles(registry, nil))
+	e.SetMaxRetries(5)
+
+	opts := testChatOptions()
+	opts.Model = ModelGPT4
+	opts.ParallelToolCalls = boolPtr(true)
+	result, err := e.ChatCompletionWithFallback(context.Background(), opts, []Model{ModelGPT3Dot5Turbo})
+	require.NoError(t, err)
+	assert.Equal(t, ModelGPT3Dot5Turbo, result.Model)
+	assert.Equal(t, "hi", result.Response.Choices[0].Message.Content)
+	require.Len(t, result.Failed, 1)
+	assert.Equal(t, ModelGPT4, result.Failed[0].Model)
+	assert.ErrorIs(t, result.Failed[0].Err, ErrRateLimit)
+
+	assert.Len(t, requests[ModelGPT4], 1+maxFallbackRetries, "retries of every model must be bounded")
+	require.Len(t, requests[ModelGPT3Dot5Turbo], 1)
+	assert.NotContains(t, requests[ModelGPT3Dot5Turbo][0], "parallel_tool_calls", "the request must be translated for the fallback model")
+	assert.Equal(t, ModelGPT4, opts.Model, "options must not be modified")
+
+	delete(requests, ModelGPT4)
+	_, err = e.ChatCompletionWithFallback(ContextWithMaxRetries(context.Background(), 0), opts, []Model{ModelGPT3Dot5Turbo})
+	require.NoError(t, err)
+	assert.Len(t, requests[ModelGPT4], 1, "the retries of the context are kept")
+}
+
+func TestChatCompletionWithFallbackNotRetryable(t *testing.T) {
+	e, requests := newFallbackServer(t, map[Model]int{ModelGPT4: http.StatusBadRequest})
+
+	opts := testChatOptions()
+	opts.Model = ModelGPT4
+	result, err := e.ChatCompletionWithFallback(context.Background(), opts, []Model{ModelGPT3Dot5Turbo})
+	var apiErr APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "content_filter", apiErr.Err.Code)
+	assert.Nil(t, result.Response)
+	assert.Len(t, result.Failed, 1)
+	assert.Empty(t, requests[ModelGPT3Dot5Turbo], "content filter blocks must not fall back")
+}
+
+func TestChatCompletionWithFallbackExhausted(t *testing.T) {
+	e, requests := newFallbackServer(t, map[Model]int{
+		ModelGPT4:          http.StatusServiceUnavailable,
+		ModelGPT3Dot5Turbo: http.StatusTooManyRequests,
+	})
+
+	opts := testChatOptions()
+	opts.Model = ModelGPT4
+	result, err := e.ChatCompletionWithFallback(context.Background(), opts, []Model{ModelGPT3Dot5Turbo})
+	assert.ErrorIs(t, err, ErrRateLimit, "the error of the last model must be returned")
+	assert.Empty(t, result.Model)
+	require.Len(t, result.Failed, 2)
+	assert.Equal(t, []Model{ModelGPT4, ModelGPT3Dot5Turbo}, []Model{result.Failed[0].Model, result.Failed[1].Model})
+	assert.Len(t, requests[ModelGPT4], 1, "engine isn't set to retry")
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrSlowConsumer is returned by ChunkReceiver.Recv if the receiver was dropped
+	// by SlowConsumerDrop policy because its buffer was full.
+	ErrSlowConsumer = errors.New("openai: receiver dropped, it's too slow")
+	// ErrReceiverClosed is returned by ChunkReceiver.Recv after the receiver is closed.
+	ErrReceiverClosed = errors.New("openai: receiver closed")
+)
+
+// SlowConsumerPolicy controls what FanOut does when the buffer of the receiver is full.
+type SlowConsumerPolicy int
+
+const (
+	// SlowConsumerBlock makes the upstream wait until the slowest receiver has room
+	// in its buffer, so every receiver gets every chunk.
+	SlowConsumerBlock SlowConsumerPolicy = iota
+	// SlowConsumerDrop closes the receiver whose buffer is full, it gets the buffered
+	// chunks followed by ErrSlowConsumer. Other receivers aren't held back.
+	SlowConsumerDrop
+)
+
+// defaultFanOutBuffer is the number of chunks buffered per receiver if it isn't set.
+const defaultFanOutBuffer = 16
+
+type FanOutOptions struct {
+	// Buffer is the number of chunks buffered per receiver, 16 if it's zero.
+	Buffer int
+	// Policy for the receiver whose buffer is full.
+	Policy SlowConsumerPolicy
+}
+
+// ChunkReceiver receives the chunks of the stream shared by FanOut.
+type ChunkReceiver struct {
+	fanOut    *fanOut
+	chunks    chan *ChatCompletionStreamResponse
+	err       error // terminal error, set before chunks is closed
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type fanOut struct {
+	stream   *ChatCompletionStream
+	mu       sync.Mutex
+	active   int
+	stopOnce sync.Once
+}
+
+// FanOut reads stream once and delivers every chunk to each of n receivers. When the stream ends
+// or fails, every receiver gets the buffered chunks followed by the terminal error of the stream,
+// io.EOF if it's finished. The stream is closed once it ends, or once all receivers are closed,
+// so it must not be used after it's passed to FanOut. Every receiver must be closed after use.
+//
+// Receivers share the chunks, they must not be modified.
+func FanOut(stream *ChatCompletionStream, n int, opts FanOutOptions) []*ChunkReceiver {
+	if opts.Buffer <= 0 {
+		opts.Buffer = defaultFanOutBuffer
+	}
+	f := &fanOut{stream: stream, active: n}
+	receivers := make([]*ChunkReceiver, n)
+	for i := range receivers {
+		receivers[i] = &ChunkReceiver{
+			fanOut: f,
+			chunks: make(chan *ChatCompletionStreamResponse, opts.Buffer),
+			done:   make(chan struct{}),
+		}
+	}
+	go f.run(receivers, opts.Policy)
+	return receivers
+}
+
+func (f *fanOut) run(receivers []*ChunkReceiver, policy SlowConsumerPolicy) {
+	defer f.stream.Close()
+	open := append([]*ChunkReceiver(nil), receivers...)
+	for len(open) != 0 {
+		chunk, err := f.stream.Recv()
+		if err != nil {
+			for _, r := range open {
+				r.finish(err)
+			}
+			return
+		}
+		n := 0
+		for _, r := range open {
+			if r.deliver(chunk, policy) {
+				open[n] = r
+				n++
+			}
+		}
+		open = open[:n]
+	}
+}
+
+// stop aborts the stream if it's not read anymore, the reading goroutine exits once Recv fails.
+// The body is closed rather than the stream, which isn't safe to close while Recv is running.
+func (f *fanOut) stop() {
+	f.stopOnce.Do(func() {
+		f.stream.resp.Body.Close()
+	})
+}
+
+// deliver sends chunk to the receiver and reports whether the receiver is still open.
+func (r *ChunkReceiver) deliver(chunk *ChatCompletionStreamResponse, policy SlowConsumerPolicy) bool {
+	if policy == SlowConsumerDrop {
+		select {
+		case r.chunks <- chunk:
+			return true
+		case <-r.done:
+			return false
+		default:
+			r.finish(ErrSlowConsumer)
+			return false
+		}
+	}
+	select {
+	case r.chunks <- chunk:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+func (r *ChunkReceiver) finish(err error) {
+	r.err = err
+	close(r.chunks)
+}
+
+// Recv returns the next chunk of the stream. Once all chunks are received, it returns the terminal
+// error of the stream, io.EOF if it's finished, or ErrSlowConsumer if the receiver was dropped.
+func (r *ChunkReceiver) Recv() (*ChatCompletionStreamResponse, error) {
+	select {
+	case <-r.done:
+		return nil, ErrReceiverClosed
+	default:
+	}
+	select {
+	case chunk, ok := <-r.chunks:
+		if !ok {
+			return nil, r.err
+		}
+		return chunk, nil
+	case <-r.done:
+		return nil, ErrReceiverClosed
+	}
+}
+
+// Close unsubscribes the receiver from the stream. The stream is closed once all receivers are closed.
+func (r *ChunkReceiver) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		f := r.fanOut
+		f.mu.Lock()
+		f.active--
+		last := f.active == 0
+		f.mu.Unlock()
+		if last {
+			f.stop()
+		}
+	})
+	return nil
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fanOutDeltas(n int) []string {
+	deltas := make([]string, n)
+	for i := range deltas {
+		deltas[i] = fmt.Sprint(i)
+	}
+	return deltas
+}
+
+// receiveAll reads r to the end, waiting delay before every chunk.
+func receiveAll(r *ChunkReceiver, delay time.Duration) ([]string, error) {
+	var deltas []string
+	for {
+		time.Sleep(delay)
+		chunk, err := r.Recv()
+		if err != nil {
+			return deltas, err
+		}
+		deltas = append(deltas, chunk.Choices[0].Delta.Content)
+	}
+}
+
+func TestFanOutBlock(t *testing.T) {
+	deltas := fanOutDeltas(20)
+	e := newChatStreamServer(t, deltas, nil)
+	s, err := e.ChatCompletionStream(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	receivers := FanOut(s, 2, FanOutOptions{Buffer: 2, Policy: SlowConsumerBlock})
+
+	var wg sync.WaitGroup
+	results := make([][]string, len(receivers))
+	errs := make([]error, len(receivers))
+	for i, r := range receivers {
+		wg.Add(1)
+		go func(i int, r *ChunkReceiver) {
+			defer wg.Done()
+			defer r.Close()
+			results[i], errs[i] = receiveAll(r, time.Duration(i)*2*time.Millisecond)
+		}(i, r)
+	}
+	wg.Wait()
+	for i := range receivers {
+		assert.Equal(t, io.EOF, errs[i], "receiver %d", i)
+		assert.Equal(t, deltas, results[i], "receiver %d must get every chunk", i)
+	}
+}
+
+// newPacedChatStreamServer streams the deltas as content of the chat completion, one per interval.
+func newPacedChatStreamServer(t *testing.T, deltas []string, interval time.Duration) *Engine {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range deltas {
+			fmt.Fprintf(w, "data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", delta)
+			w.(http.Flusher).Flush()
+			time.Sleep(interval)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	return e
+}
+
+func TestFanOutDrop(t *testing.T) {
+	deltas := fanOutDeltas(20)
+	e := newPacedChatStreamServer(t, deltas, 2*time.Millisecond)
+	s, err := e.ChatCompletionStream(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	receivers := FanOut(s, 2, FanOutOptions{Buffer: 4, Policy: SlowConsumerDrop})
+	fast, slow := receivers[0], receivers[1]
+	defer fast.Close()
+	defer slow.Close()
+
+	got, err := receiveAll(fast, 0)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, deltas, got, "the fast receiver must not be held back")
+
+	// The slow receiver starts reading after the stream has ended
+	got, err = receiveAll(slow, 0)
+	assert.ErrorIs(t, err, ErrSlowConsumer)
+	assert.Equal(t, deltas[:4], got, "buffered chunks must be delivered before the error")
+}
+
+func TestFanOutUpstreamError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"delta\":{\"content\":\"a\"}}]}\n\n")
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	s, err := e.ChatCompletionStream(context.Background(), testChatOptions())
+	require.NoError(t, err)
+
+	for i, r := range FanOut(s, 3, FanOutOptions{}) {
+		got, err := receiveAll(r, 0)
+		assert.Equal(t, []string{"a"}, got, "receiver %d", i)
+		assert.ErrorIs(t, err, ErrStreamClosed, "receiver %d", i)
+		r.Close()
+	}
+}
+
+func TestFanOutUnsubscribe(t *testing.T) {
+	disconnected := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"delta\":{\"content\":\"a\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(disconnected)
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	s, err := e.ChatCompletionStream(context.Background(), testChatOptions())
+	require.NoError(t, err)
+
+	receivers := FanOut(s, 2, FanOutOptions{})
+	chunk, err := receivers[0].Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "a", chunk.Choices[0].Delta.Content)
+	receivers[0].Close()
+	_, err = receivers[0].Recv()
+	assert.ErrorIs(t, err, ErrReceiverClosed)
+
+	select {
+	case <-disconnected:
+		t.Fatal("the stream must be read while a receiver is subscribed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	receivers[1].Close()
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("the stream must be closed once all receivers are closed")
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// contextWindows are the context windows of the chat models in tokens, by model prefix.
+// The longest matching prefix applies.
+//
+// Learn more: https://platform.openai.com/docs/models
+var contextWindows = map[string]int{
+	"gpt-3.5-turbo":      16385,
+	"gpt-3.5-turbo-0301": 4096,
+	"gpt-3.5-turbo-0613": 4096,
+	"gpt-4":              8192,
+	"gpt-4-32k":          32768,
+	"gpt-4-turbo":        128000,
+	"gpt-4o":             128000,
+	"gpt-4.1":            1047576,
+	"o1":                 200000,
+	"o3":                 200000,
+	"o4":                 200000,
+}
+
+// contextWindowOf returns the context window of the model, or zero if it isn't known.
+func contextWindowOf(model Model) int {
+	var prefix string
+	for p := range contextWindows {
+		if strings.HasPrefix(string(model), p) && len(p) > len(prefix) {
+			prefix = p
+		}
+	}
+	return contextWindows[prefix]
+}
+
+// FewShotExample is the example of the task: the user message and the expected assistant reply.
+type FewShotExample struct {
+	User      string
+	Assistant string
+}
+
+func (ex FewShotExample) messages() []ChatMessage {
+	return []ChatMessage{
+		{Role: "user", Content: ex.User},
+		{Role: "assistant", Content: ex.Assistant},
+	}
+}
+
+// FewShotSelector selects as many examples of the pool as fit into the token budget of the prompt.
+type FewShotSelector struct {
+	// Examples is the pool of examples.
+	Examples []FewShotExample
+	// Model the prompt is for, its tokens are counted by the tokenizer of the model, see
+	// Engine.CountMessagesTokens.
+	Model Model
+	// Budget is the number of tokens of the selected examples, including the message overhead.
+	Budget int
+	// ContextFraction is the fraction of the context window left after the fixed prompt,
+	// which is filled with the examples, e.g. 0.25 for 25%. It's used if Budget is zero.
+	ContextFraction float64
+	// ContextWindow of the model in tokens. If it's zero, the context window of the known models is used.
+	ContextWindow int
+	// Relevance scores the example, if it's set the examples are taken in the order of descending
+	// score rather than in the order of the pool. Examples of the same score keep their order.
+	Relevance func(FewShotExample) float64
+}
+
+// Select returns the examples which fit into the budget alongside the fixed prompt: the longest prefix
+// of the pool, or of the pool ordered by Relevance. The fixed prompt is only counted for ContextFraction.
+func (s *FewShotSelector) Select(fixed []ChatMessage) ([]FewShotExample, error) {
+	budget, err := s.budget(fixed)
+	if err != nil {
+		return nil, err
+	}
+	pool := append([]FewShotExample(nil), s.Examples...)
+	if s.Relevance != nil {
+		scores := make([]float64, len(pool))
+		order := make([]int, len(pool))
+		for i := range pool {
+			order[i] = i
+			scores[i] = s.Relevance(pool[i])
+		}
+		sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+		for i, j := range order {
+			pool[i] = s.Examples[j]
+		}
+	}
+	var selected []FewShotExample
+	for _, ex := range pool {
+		n, err := countMessagesTokens(s.Model, ex.messages())
+		if err != nil {
+			return nil, err
+		}
+		// The examples are inserted into the prompt, which has the reply primer already
+		n -= tokensPerReply
+		if n > budget {
+			break
+		}
+		budget -= n
+		selected = append(selected, ex)
+	}
+	return selected, nil
+}
+
+// Insert returns the messages with the selected examples inserted between the leading system
+// messages and the rest of the messages, e.g. the live history. The messages are the fixed
+// prompt of Select, they aren't modified.
+func (s *FewShotSelector) Insert(messages []ChatMessage) ([]ChatMessage, error) {
+	examples, err := s.Select(messages)
+	if err != nil {
+		return nil, err
+	}
+	system := 0
+	for system < len(messages) && (messages[system].Role == "system" || messages[system].Role == "developer") {
+		system++
+	}
+	out := make([]ChatMessage, 0, len(messages)+2*len(examples))
+	out = append(out, messages[:system]...)
+	for _, ex := range examples {
+		out = append(out, ex.messages()...)
+	}
+	return append(out, messages[system:]...), nil
+}
+
+func (s *FewShotSelector) budget(fixed []ChatMessage) (int, error) {
+	if !isChatModel(s.Model) {
+		return 0, fmt.Errorf("%w: %q", ErrTokensUnsupportedModel, s.Model)
+	}
+	if s.Budget > 0 {
+		return s.Budget, nil
+	}
+	if s.ContextFraction <= 0 || s.ContextFraction > 1 {
+		return 0, errors.New("few-shot budget must be set, or context fraction must be in (0, 1]")
+	}
+	window := s.ContextWindow
+	if window == 0 {
+		window = contextWindowOf(s.Model)
+	}
+	if window == 0 {
+		return 0, fmt.Errorf("context window of the model %q isn't known", s.Model)
+	}
+	used, err := countMessagesTokens(s.Model, fixed)
+	if err != nil {
+		return 0, err
+	}
+	if used >= window {
+		return 0, nil
+	}
+	return int(float64(window-used) * s.ContextFraction), nil
+}
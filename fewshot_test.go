@@ -0,0 +1,118 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fewShotPool returns examples of 10 tokens of cl100k_base each: two messages of 3 tokens overhead,
+// 1 token of the role and 1 token of content.
+func fewShotPool() []FewShotExample {
+	return []FewShotExample{
+		{User: "one", Assistant: "two"},
+		{User: "red", Assistant: "car"},
+		{User: "sky", Assistant: "blue"},
+		{User: "hot", Assistant: "cold"},
+	}
+}
+
+func TestFewShotSelectorBudget(t *testing.T) {
+	for _, tc := range []struct {
+		budget int
+		want   int
+	}{
+		{9, 0},
+		{10, 1},
+		{29, 2},
+		{30, 3},
+		{40, 4},
+		{1000, 4},
+	} {
+		s := &FewShotSelector{Examples: fewShotPool(), Model: ModelGPT4, Budget: tc.budget}
+		examples, err := s.Select(nil)
+		require.NoError(t, err)
+		require.Len(t, examples, tc.want, "budget %d", tc.budget)
+		for i, ex := range examples {
+			assert.Equal(t, fewShotPool()[i], ex, "budget %d", tc.budget)
+		}
+	}
+
+	// The prefix ends at the first example which doesn't fit, even if the later ones would
+	pool := fewShotPool()
+	pool[1].Assistant = strings.Repeat(" x", 20)
+	s := &FewShotSelector{Examples: pool, Model: ModelGPT4, Budget: 30}
+	examples, err := s.Select(nil)
+	require.NoError(t, err)
+	assert.Equal(t, pool[:1], examples)
+
+	_, err = (&FewShotSelector{Examples: pool, Model: ModelWhisper, Budget: 30}).Select(nil)
+	assert.ErrorIs(t, err, ErrTokensUnsupportedModel)
+}
+
+func TestFewShotSelectorContextFraction(t *testing.T) {
+	// 3 + (3 + 1 + 5) tokens of cl100k_base, the 40 characters would be estimated as 10 tokens
+	fixed := []ChatMessage{{Role: "system", Content: strings.Repeat("x", 40)}}
+	s := &FewShotSelector{Examples: fewShotPool(), Model: ModelGPT4, ContextWindow: 52, ContextFraction: 0.5}
+	examples, err := s.Select(fixed)
+	require.NoError(t, err)
+	assert.Len(t, examples, 2, "half of the 40 tokens left, 35 tokens by the estimate")
+
+	s.ContextWindow = 51
+	examples, err = s.Select(fixed)
+	require.NoError(t, err)
+	assert.Len(t, examples, 1, "half of the 39 tokens left")
+
+	s.ContextWindow = 0
+	examples, err = s.Select(fixed)
+	require.NoError(t, err)
+	assert.Len(t, examples, 4, "the context window of gpt-4 is known")
+
+	s.Model = "gpt-4-unknown-window"
+	assert.Equal(t, 8192, contextWindowOf(s.Model))
+	assert.Equal(t, 32768, contextWindowOf(ModelGPT432K0314))
+	assert.Equal(t, 4096, contextWindowOf(ModelGPT3Dot5Turbo0301))
+
+	s.ContextFraction = 0
+	_, err = s.Select(fixed)
+	assert.Error(t, err)
+}
+
+func TestFewShotSelectorRelevance(t *testing.T) {
+	scores := map[string]float64{"one": 0.1, "red": 0.9, "sky": 0.5, "hot": 0.9}
+	s := &FewShotSelector{
+		Examples:  fewShotPool(),
+		Model:     ModelGPT4,
+		Budget:    30,
+		Relevance: func(ex FewShotExample) float64 { return scores[ex.User] },
+	}
+	examples, err := s.Select(nil)
+	require.NoError(t, err)
+	pool := fewShotPool()
+	assert.Equal(t, []FewShotExample{pool[1], pool[3], pool[2]}, examples, "the most relevant first, ties in the pool order")
+	assert.Equal(t, fewShotPool(), s.Examples, "the pool must not be reordered")
+}
+
+func TestFewShotSelectorInsert(t *testing.T) {
+	s := &FewShotSelector{Examples: fewShotPool(), Model: ModelGPT4, Budget: 20}
+	messages := []ChatMessage{
+		{Role: "system", Content: "Answer briefly."},
+		{Role: "user", Content: "sun"},
+	}
+	out, err := s.Insert(messages)
+	require.NoError(t, err)
+	assert.Equal(t, []ChatMessage{
+		{Role: "system", Content: "Answer briefly."},
+		{Role: "user", Content: "one"},
+		{Role: "assistant", Content: "two"},
+		{Role: "user", Content: "red"},
+		{Role: "assistant", Content: "car"},
+		{Role: "user", Content: "sun"},
+	}, out)
+	assert.Len(t, messages, 2)
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Purposes of the uploaded files.
+const (
+	FilePurposeAssistants = "assistants"
+	FilePurposeBatch      = "batch"
+	FilePurposeFineTune   = "fine-tune"
+	FilePurposeVision     = "vision"
+	FilePurposeUserData   = "user_data"
+)
+
+// File is a document uploaded to the API, e.g. for fine-tuning or file search.
+type File struct {
+	Id        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+}
+
+type RetrieveFileOptions struct {
+	// The ID of the file.
+	ID string `json:"id" binding:"required"`
+}
+
+// RetrieveFile returns information about a specific file.
+// The 404 response is returned as the APIError matching ErrNotFound.
+//
+// Docs: https://platform.openai.com/docs/api-reference/files/retrieve
+func (e *Engine) RetrieveFile(ctx context.Context, opts *RetrieveFileOptions) (*File, error) {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	url := e.apiBaseURL + "/files/" + opts.ID
+	ctx = withRequestInfo(ctx, "/files/{file_id}", "")
+	req, err := e.newReq(ctx, http.MethodGet, url, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.doReq(req)
+	if err != nil {
+		return nil, err
+	}
+	var jsonResp File
+	if err := unmarshal(resp, &jsonResp); err != nil {
+		return nil, err
+	}
+	return &jsonResp, nil
+}
+
+// RetrieveFileContent returns the content of the file, e.g. the output file of the batch.
+// The content is streamed, the caller must close it.
+// The 404 response is returned as the APIError matching ErrNotFound.
+//
+// Docs: https://platform.openai.com/docs/api-reference/files/retrieve-contents
+func (e *Engine) RetrieveFileContent(ctx context.Context, fileId string) (io.ReadCloser, error) {
+	uri := e.apiBaseURL + "/files/" + url.PathEscape(fileId) + "/content"
+	ctx = withRequestInfo(ctx, "/files/{file_id}/content", "")
+	req, err := e.newReq(ctx, http.MethodGet, uri, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.doReq(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// DeleteFile deletes the file.
+// The 404 response is returned as the APIError matching ErrNotFound.
+//
+// Docs: https://platform.openai.com/docs/api-reference/files/delete
+func (e *Engine) DeleteFile(ctx context.Context, fileId string) (*Deleted, error) {
+	uri := e.apiBaseURL + "/files/" + url.PathEscape(fileId)
+	ctx = withRequestInfo(ctx, "/files/{file_id}", "")
+	return e.deleteObject(ctx, uri)
+}
+
+type UploadFileOptions struct {
+	// The content of the file. If it's io.Seeker, e.g. *os.File, it's read from the current offset
+	// on every attempt of the upload, see SetMultipartBufferSize for other readers.
+	File io.Reader `binding:"required"`
+	// The name of the file, e.g. "requests.jsonl".
+	Filename string `binding:"required"`
+	// The intended purpose of the file, e.g. FilePurposeBatch or FilePurposeFineTune.
+	Purpose string `binding:"required"`
+	// ForceUpload uploads the file even if the same content is found in the upload index of the engine,
+	// see WithUploadIndex. The uploaded file replaces the file of the index.
+	ForceUpload bool
+}
+
+// UploadFile is used to upload the file for use across the endpoints of the API.
+// With the upload index of the engine, the file of the same content and purpose which
+// was already uploaded is returned instead, see WithUploadIndex.
+//
+// Docs: https://platform.openai.com/docs/api-reference/files/create
+func (e *Engine) UploadFile(ctx context.Context, opts *UploadFileOptions) (*File, error) {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	if e.uploadIndex != nil {
+		return e.uploadFileDedup(ctx, opts)
+	}
+	body, err := newUploadFileBody(opts, e.multipartBufferSize, nil)
+	if err != nil {
+		return nil, err
+	}
+	return e.uploadFile(ctx, body)
+}
+
+func (e *Engine) uploadFile(ctx context.Context, body *multipartBody) (*File, error) {
+	url := e.apiBaseURL + "/files"
+	ctx = withRequestInfo(ctx, "/files", "")
+	req, err := e.newMultipartReq(ctx, url, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.doReq(req)
+	if err != nil {
+		return nil, err
+	}
+	var jsonResp File
+	if err := unmarshal(resp, &jsonResp); err != nil {
+		return nil, err
+	}
+	return &jsonResp, nil
+}
+
+// newUploadFileBody returns the multipart body of the upload. If h is set, the content of the
+// file is written to it as it's read, see hashContent.
+func newUploadFileBody(opts *UploadFileOptions, bufferSize int64, h *contentHasher) (*multipartBody, error) {
+	writer := newMultipartBuilder(bufferSize)
+	if err := writer.WriteField("purpose", opts.Purpose); err != nil {
+		return nil, fmt.Errorf("write purpose: %w", err)
+	}
+	file := opts.File
+	if h != nil {
+		var err error
+		if file, err = h.hashContent(opts.File); err != nil {
+			return nil, fmt.Errorf("hash file: %w", err)
+		}
+	}
+	if err := writer.WriteFile("file", opts.Filename, file); err != nil {
+		return nil, fmt.Errorf("write file: %w", err)
+	}
+	return writer.Close()
+}
+
+// contentHasher computes the SHA-256 of the content of the file and counts its size.
+// It's safe for concurrent use, the streamed content is hashed as it's sent by the transport.
+type contentHasher struct {
+	mu sync.Mutex
+	h  hash.Hash
+	n  int64
+}
+
+func newContentHasher() *contentHasher {
+	return &contentHasher{h: sha256.New()}
+}
+
+func (c *contentHasher) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n += int64(len(p))
+	return c.h.Write(p)
+}
+
+// hashContent returns the reader of the content of r which is hashed. The seekable reader is
+// hashed right away: it's read up to the end and rewound, the content isn't copied. Other readers
+// are teed into the hasher as they're read, i.e. when they're buffered or sent.
+func (c *contentHasher) hashContent(r io.Reader) (io.Reader, error) {
+	s, ok := r.(io.ReadSeeker)
+	if !ok {
+		return io.TeeReader(r, c), nil
+	}
+	offset, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(c, s); err != nil {
+		return nil, err
+	}
+	if _, err := s.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// sum returns the hex encoded hash of the content read so far and its size.
+func (c *contentHasher) sum() (string, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return hex.EncodeToString(c.h.Sum(nil)), c.n
+}
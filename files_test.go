@@ -0,0 +1,63 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetrieveFile(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		if r.URL.Path != "/files/file-abc" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(notFoundBody))
+			return
+		}
+		w.Write([]byte(`{"id":"file-abc","object":"file","bytes":120000,"created_at":1677610602,"filename":"report.pdf","purpose":"assistants"}`))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	f, err := e.RetrieveFile(context.Background(), &RetrieveFileOptions{ID: "file-abc"})
+	require.NoError(t, err)
+	assert.Equal(t, &File{Id: "file-abc", Object: "file", Bytes: 120000, CreatedAt: 1677610602, Filename: "report.pdf", Purpose: "assistants"}, f)
+
+	_, err = e.RetrieveFile(context.Background(), &RetrieveFileOptions{ID: "file-missing"})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestUploadFile(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/files", r.URL.Path)
+		assert.Equal(t, "batch", r.FormValue("purpose"))
+		file, header, err := r.FormFile("file")
+		require.NoError(t, err)
+		content, err := io.ReadAll(file)
+		require.NoError(t, err)
+		assert.Equal(t, "requests.jsonl", header.Filename)
+		assert.Equal(t, "{}\n", string(content))
+		w.Write([]byte(`{"id":"file-abc","object":"file","bytes":3,"created_at":1677610602,"filename":"requests.jsonl","purpose":"batch"}`))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	f, err := e.UploadFile(context.Background(), &UploadFileOptions{File: strings.NewReader("{}\n"), Filename: "requests.jsonl", Purpose: FilePurposeBatch})
+	require.NoError(t, err)
+	assert.Equal(t, &File{Id: "file-abc", Object: "file", Bytes: 3, CreatedAt: 1677610602, Filename: "requests.jsonl", Purpose: "batch"}, f)
+
+	_, err = e.UploadFile(context.Background(), &UploadFileOptions{File: strings.NewReader("{}\n"), Filename: "requests.jsonl"})
+	assert.Error(t, err, "the purpose is required")
+}
@@ -0,0 +1,455 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Statuses of fine-tuning jobs.
+const (
+	FineTuningJobValidatingFiles = "validating_files"
+	FineTuningJobQueued          = "queued"
+	FineTuningJobRunning         = "running"
+	FineTuningJobSucceeded       = "succeeded"
+	FineTuningJobFailed          = "failed"
+	FineTuningJobCancelled       = "cancelled"
+)
+
+var (
+	// ErrFineTuningJobFailed is returned by WaitForFineTuningJob if the job failed.
+	ErrFineTuningJobFailed = errors.New("openai: fine-tuning job failed")
+	// ErrFineTuningJobCancelled is returned by WaitForFineTuningJob if the job was cancelled.
+	ErrFineTuningJobCancelled = errors.New("openai: fine-tuning job cancelled")
+)
+
+const defaultFineTuningPollInterval = 10 * time.Second
+
+// FineTuningJob is a job which creates a new model from the base model and the training file.
+//
+// Docs: https://platform.openai.com/docs/api-reference/fine-tuning/object
+type FineTuningJob struct {
+	Id             string `json:"id"`
+	Object         string `json:"object"`
+	CreatedAt      int64  `json:"created_at"`
+	FinishedAt     int64  `json:"finished_at,omitempty"`
+	Model          Model  `json:"model"`
+	FineTunedModel Model  `json:"fine_tuned_model,omitempty"`
+	OrganizationId string `json:"organization_id"`
+	// Status of the job, one of the FineTuningJob* statuses.
+	Status          string                     `json:"status"`
+	Hyperparameters *FineTuningHyperparameters `json:"hyperparameters,omitempty"`
+	TrainingFile    string                     `json:"training_file"`
+	ValidationFile  string                     `json:"validation_file,omitempty"`
+	ResultFiles     []string                   `json:"result_files,omitempty"`
+	TrainedTokens   int                        `json:"trained_tokens,omitempty"`
+	Seed            int                        `json:"seed,omitempty"`
+	// Estimated time when the job will finish, as Unix timestamp.
+	EstimatedFinish int64 `json:"estimated_finish,omitempty"`
+	// Error of the failed job.
+	Error *FineTuningJobError `json:"error,omitempty"`
+	// Checkpoints of the job, only listed with FineTuningIncludeCheckpoints.
+	Checkpoints []FineTuningJobCheckpoint `json:"checkpoints,omitempty"`
+	// Integrations of the job, e.g. to report the metrics to Weights & Biases.
+	Integrations []FineTuningIntegration `json:"integrations,omitempty"`
+}
+
+// FineTuningIncludeCheckpoints includes the checkpoints of the jobs listed by ListFineTuningJobs.
+const FineTuningIncludeCheckpoints = "checkpoints"
+
+// FineTuningJobCheckpoint is the model checkpoint created at the end of the training epoch.
+//
+// Docs: https://platform.openai.com/docs/api-reference/fine-tuning/checkpoint-object
+type FineTuningJobCheckpoint struct {
+	Id        string `json:"id"`
+	Object    string `json:"object"`
+	CreatedAt int64  `json:"created_at"`
+	// The name of the checkpoint model, it can be used as a model.
+	FineTunedModelCheckpoint Model  `json:"fine_tuned_model_checkpoint"`
+	FineTuningJobId          string `json:"fine_tuning_job_id"`
+	StepNumber               int    `json:"step_number"`
+	// Metrics of the step the checkpoint was created at.
+	Metrics *FineTuningMetrics `json:"metrics,omitempty"`
+}
+
+type FineTuningJobError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Param   string `json:"param,omitempty"`
+}
+
+// IsTerminal reports whether the job has finished, either succeeded, failed or cancelled.
+func (j *FineTuningJob) IsTerminal() bool {
+	switch j.Status {
+	case FineTuningJobSucceeded, FineTuningJobFailed, FineTuningJobCancelled:
+		return true
+	}
+	return false
+}
+
+// FineTuningIntegrationWandb is the type of the integration with Weights & Biases.
+const FineTuningIntegrationWandb = "wandb"
+
+// FineTuningIntegration is the integration of the fine-tuning job with the external service,
+// the variant of the type is set.
+type FineTuningIntegration struct {
+	// The type of the integration, only FineTuningIntegrationWandb is supported.
+	Type  string            `json:"type" binding:"oneof=wandb"`
+	Wandb *WandbIntegration `json:"wandb,omitempty" binding:"required_if=Type wandb"`
+}
+
+// WandbIntegration reports the metrics of the job to the run of the Weights & Biases project,
+// see WandbIntegrationBuilder. The API key of Weights & Biases must be set in the settings
+// of the organization.
+type WandbIntegration struct {
+	// The project of the run.
+	Project string `json:"project" binding:"required"`
+	// The name of the run, the ID of the job by default.
+	Name string `json:"name,omitempty"`
+	// The team or the user of the run, the default entity of the API key by default.
+	Entity string `json:"entity,omitempty"`
+	// The tags of the run, the ID of the job and "openai/finetune" are always added.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// WandbIntegrationBuilder is used to build the Weights & Biases integration of the fine-tuning job.
+type WandbIntegrationBuilder struct {
+	wandb WandbIntegration
+}
+
+func NewWandbIntegrationBuilder() *WandbIntegrationBuilder {
+	return &WandbIntegrationBuilder{}
+}
+
+func (b *WandbIntegrationBuilder) SetProject(project string) *WandbIntegrationBuilder {
+	b.wandb.Project = project
+	return b
+}
+
+func (b *WandbIntegrationBuilder) SetName(name string) *WandbIntegrationBuilder {
+	b.wandb.Name = name
+	return b
+}
+
+func (b *WandbIntegrationBuilder) SetEntity(entity string) *WandbIntegrationBuilder {
+	b.wandb.Entity = entity
+	return b
+}
+
+func (b *WandbIntegrationBuilder) AddTag(tag string) *WandbIntegrationBuilder {
+	b.wandb.Tags = append(b.wandb.Tags, tag)
+	return b
+}
+
+// Build returns the integration, the project must be set.
+func (b *WandbIntegrationBuilder) Build() FineTuningIntegration {
+	wandb := b.wandb
+	wandb.Tags = append([]string(nil), b.wandb.Tags...)
+	return FineTuningIntegration{Type: FineTuningIntegrationWandb, Wandb: &wandb}
+}
+
+type CreateFineTuningJobOptions struct {
+	// The base model, or the fine-tuned model to continue the training of.
+	Model Model `json:"model" binding:"required"`
+	// The ID of the uploaded training file of the FilePurposeFineTune purpose.
+	TrainingFile string `json:"training_file" binding:"required"`
+	// The ID of the uploaded validation file, the metrics of the validation are reported if it's set.
+	ValidationFile string `json:"validation_file,omitempty"`
+	// The hyperparameters of the job, see ValidateFineTuningHyperparameters.
+	Hyperparameters *FineTuningHyperparameters `json:"hyperparameters,omitempty"`
+	// The suffix of the name of the fine-tuned model, up to 64 characters.
+	Suffix string `json:"suffix,omitempty" binding:"max=64"`
+	Seed   int    `json:"seed,omitempty"`
+	// Integrations of the job, see WandbIntegrationBuilder.
+	Integrations []FineTuningIntegration `json:"integrations,omitempty" binding:"dive"`
+}
+
+// CreateFineTuningJob is used to start the fine-tuning job, see WaitForFineTuningJob.
+//
+// Docs: https://platform.openai.com/docs/api-reference/fine-tuning/create
+func (e *Engine) CreateFineTuningJob(ctx context.Context, opts *CreateFineTuningJobOptions) (*FineTuningJob, error) {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	uri := e.apiBaseURL + "/fine_tuning/jobs"
+	ctx = withRequestInfo(ctx, "/fine_tuning/jobs", opts.Model)
+	var job FineTuningJob
+	if err := e.sendJSON(ctx, http.MethodPost, uri, opts, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// RetrieveFineTuningJob returns information about the fine-tuning job.
+//
+// Docs: https://platform.openai.com/docs/api-reference/fine-tuning/retrieve
+func (e *Engine) RetrieveFineTuningJob(ctx context.Context, jobId string) (*FineTuningJob, error) {
+	uri := e.apiBaseURL + "/fine_tuning/jobs/" + jobId
+	ctx = withRequestInfo(ctx, "/fine_tuning/jobs/{fine_tuning_job_id}", "")
+	req, err := e.newReq(ctx, http.MethodGet, uri, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.doReq(req)
+	if err != nil {
+		return nil, err
+	}
+	var jsonResp FineTuningJob
+	if err := unmarshal(resp, &jsonResp); err != nil {
+		return nil, err
+	}
+	return &jsonResp, nil
+}
+
+type ListFineTuningJobsOptions struct {
+	ListOptions
+	// Additional data to include with the jobs, e.g. FineTuningIncludeCheckpoints.
+	Include []string
+}
+
+// ListFineTuningJobs returns the page of fine-tuning jobs of the organization.
+//
+// Docs: https://platform.openai.com/docs/api-reference/fine-tuning/list
+func (e *Engine) ListFineTuningJobs(ctx context.Context, opts *ListFineTuningJobsOptions) (*Page[FineTuningJob], error) {
+	if opts == nil {
+		opts = &ListFineTuningJobsOptions{}
+	}
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	q := opts.ListOptions.query()
+	if len(opts.Include) != 0 {
+		q.Set("include", strings.Join(opts.Include, ","))
+	}
+	uri := withQuery(e.apiBaseURL+"/fine_tuning/jobs", q)
+	ctx = withRequestInfo(ctx, "/fine_tuning/jobs", "")
+	var page Page[FineTuningJob]
+	if err := e.sendJSON(ctx, http.MethodGet, uri, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// AllFineTuningJobs iterates over the fine-tuning jobs of all pages, starting with the page of opts.
+func (e *Engine) AllFineTuningJobs(ctx context.Context, opts *ListFineTuningJobsOptions) iter.Seq2[FineTuningJob, error] {
+	var o ListFineTuningJobsOptions
+	if opts != nil {
+		o = *opts
+	}
+	return paginate(ctx, o.After, func(ctx context.Context, after string) (*Page[FineTuningJob], error) {
+		o.After = after
+		return e.ListFineTuningJobs(ctx, &o)
+	})
+}
+
+type WaitForFineTuningJobOptions struct {
+	// PollInterval is the time between retrievals of the job, 10 seconds if it's zero.
+	PollInterval time.Duration
+	// OnProgress is called with the job after every retrieval, including the last one.
+	OnProgress func(job *FineTuningJob)
+	// LogProgress logs changes of the job status with the default slog logger.
+	LogProgress bool
+}
+
+// WaitForFineTuningJob polls the fine-tuning job until it's succeeded, failed or cancelled.
+// The last retrieved job is returned in all of these cases, the error is ErrFineTuningJobFailed
+// or ErrFineTuningJobCancelled unless the job succeeded. Polling stops once ctx is done.
+func WaitForFineTuningJob(ctx context.Context, engine *Engine, jobId string, opts *WaitForFineTuningJobOptions) (*FineTuningJob, error) {
+	if opts == nil {
+		opts = &WaitForFineTuningJobOptions{}
+	}
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = defaultFineTuningPollInterval
+	}
+	var status string
+	for {
+		job, err := engine.RetrieveFineTuningJob(ctx, jobId)
+		if err != nil {
+			return nil, err
+		}
+		if opts.OnProgress != nil {
+			opts.OnProgress(job)
+		}
+		if opts.LogProgress && job.Status != status {
+			slog.Default().InfoContext(ctx, "fine-tuning job status changed",
+				slog.String("job_id", job.Id),
+				slog.String("status", job.Status),
+				slog.Int("trained_tokens", job.TrainedTokens),
+			)
+		}
+		status = job.Status
+		switch job.Status {
+		case FineTuningJobSucceeded:
+			return job, nil
+		case FineTuningJobFailed:
+			if job.Error != nil && job.Error.Message != "" {
+				return job, fmt.Errorf("%w: %s", ErrFineTuningJobFailed, job.Error.Message)
+			}
+			return job, ErrFineTuningJobFailed
+		case FineTuningJobCancelled:
+			return job, ErrFineTuningJobCancelled
+		}
+		if err := engine.clock.Sleep(ctx, interval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// maxFineTuningStreamReconnects is the number of reconnects in a row, without receiving
+// any event, after which the dropped event stream is reported as closed.
+const maxFineTuningStreamReconnects = 3
+
+// defaultFineTuningStreamRetry is the delay before reconnecting if the server didn't set it.
+const defaultFineTuningStreamRetry = time.Second
+
+// FineTuningEvent is an event of the fine-tuning job, e.g. status change or training metrics.
+type FineTuningEvent struct {
+	Id        string `json:"id"`
+	Object    string `json:"object"`
+	CreatedAt int64  `json:"created_at"`
+	// Level of the event, one of "info", "warn" or "error".
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	// Type of the event, either "message" or "metrics".
+	Type string `json:"type,omitempty"`
+	// Data of the metrics event.
+	Data *FineTuningMetrics `json:"data,omitempty"`
+}
+
+// FineTuningMetrics are the training metrics of the fine-tuning step.
+type FineTuningMetrics struct {
+	Step                   int     `json:"step"`
+	TotalSteps             int     `json:"total_steps,omitempty"`
+	TrainLoss              float64 `json:"train_loss,omitempty"`
+	TrainMeanTokenAccuracy float64 `json:"train_mean_token_accuracy,omitempty"`
+	ValidLoss              float64 `json:"valid_loss,omitempty"`
+	ValidMeanTokenAccuracy float64 `json:"valid_mean_token_accuracy,omitempty"`
+}
+
+// FineTuningEventStream is a live stream of events of the fine-tuning job, it must be closed after use.
+type FineTuningEventStream struct {
+	e           *Engine
+	ctx         context.Context
+	jobId       string
+	resp        *http.Response
+	reader      *sseReader
+	received    int
+	lastEventId string
+	retry       time.Duration
+	reconnects  int
+	seen        map[string]bool
+	done        bool
+}
+
+// StreamFineTuningEvents streams events of the fine-tuning job as they happen.
+// If the connection is dropped, the stream reconnects and resumes after the last received event.
+//
+// Docs: https://platform.openai.com/docs/api-reference/fine-tuning/list-events
+func (e *Engine) StreamFineTuningEvents(ctx context.Context, jobId string) (*FineTuningEventStream, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s := &FineTuningEventStream{
+		e:     e,
+		ctx:   withRequestInfo(ctx, "/fine_tuning/jobs/{fine_tuning_job_id}/events", ""),
+		jobId: jobId,
+		retry: defaultFineTuningStreamRetry,
+		seen:  make(map[string]bool),
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FineTuningEventStream) connect() error {
+	uri := s.e.apiBaseURL + "/fine_tuning/jobs/" + s.jobId + "/events?stream=true"
+	req, err := s.e.newReq(s.ctx, http.MethodGet, uri, "", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if s.lastEventId != "" {
+		req.Header.Set("Last-Event-ID", s.lastEventId)
+	}
+	resp, err := s.e.doReq(req)
+	if err != nil {
+		return err
+	}
+	s.resp = resp
+	s.reader = newSSEReader(resp.Body)
+	return nil
+}
+
+// Next returns the next event of the job. It returns io.EOF when the stream is finished,
+// ErrStreamCanceled if the context is done, StreamAPIError if the server reported the error,
+// StreamProtocolError if the event is malformed, or StreamClosedUnexpectedly if the stream
+// was dropped and couldn't be resumed. Events repeated by the server after reconnecting are skipped.
+func (s *FineTuningEventStream) Next() (*FineTuningEvent, error) {
+	for {
+		if s.done {
+			return nil, io.EOF
+		}
+		data, err := s.reader.next()
+		if err == nil {
+			var event FineTuningEvent
+			if err := json.Unmarshal(data, &event); err != nil {
+				return nil, frameError(s.reader.scanner.Event(), err)
+			}
+			s.received++
+			s.reconnects = 0
+			if id := s.reader.scanner.Event().ID; id != "" {
+				s.lastEventId = id
+			} else if event.Id != "" {
+				s.lastEventId = event.Id
+			}
+			if event.Id != "" {
+				if s.seen[event.Id] {
+					continue
+				}
+				s.seen[event.Id] = true
+			}
+			return &event, nil
+		}
+		if err == io.EOF {
+			s.done = true
+			return nil, io.EOF
+		}
+		// Only the dropped stream is resumed, errors reported by the server are final
+		var closedErr *StreamClosedUnexpectedly
+		if !errors.As(err, &closedErr) || s.ctx.Err() != nil || s.reconnects == maxFineTuningStreamReconnects {
+			if closedErr != nil {
+				closedErr.Chunks = s.received
+			}
+			return nil, streamError(s.ctx, err)
+		}
+		if retry := s.reader.scanner.Retry(); retry > 0 {
+			s.retry = retry
+		}
+		s.reconnects++
+		s.resp.Body.Close()
+		if err := s.e.clock.Sleep(s.ctx, s.retry); err != nil {
+			return nil, streamError(s.ctx, err)
+		}
+		if err := s.connect(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Close closes the stream.
+func (s *FineTuningEventStream) Close() error {
+	s.done = true
+	return s.resp.Body.Close()
+}
@@ -0,0 +1,298 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFineTuningJobServer responds with the job in the given statuses, one per retrieval.
+// The last status is repeated.
+func newFineTuningJobServer(t *testing.T, statuses ...string) *Engine {
+	var n int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/fine_tuning/jobs/ftjob-abc123", r.URL.Path)
+		status := statuses[len(statuses)-1]
+		if n < len(statuses) {
+			status = statuses[n]
+		}
+		n++
+		var extra string
+		switch status {
+		case FineTuningJobSucceeded:
+			extra = `,"fine_tuned_model":"ft:gpt-4o-mini:acme::abc123","trained_tokens":5768`
+		case FineTuningJobFailed:
+			extra = `,"error":{"code":"invalid_training_file","message":"Training file has too few examples","param":"training_file"}`
+		}
+		fmt.Fprintf(w, `{"id":"ftjob-abc123","object":"fine_tuning.job","model":"gpt-4o-mini","status":%q%s}`, status, extra)
+	}))
+	t.Cleanup(srv.Close)
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	return e
+}
+
+func TestWaitForFineTuningJob(t *testing.T) {
+	e := newFineTuningJobServer(t, FineTuningJobValidatingFiles, FineTuningJobQueued, FineTuningJobRunning, FineTuningJobRunning, FineTuningJobSucceeded)
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	clock := newAutoClock()
+	e.clock = clock
+	var progress []string
+	job, err := WaitForFineTuningJob(context.Background(), e, "ftjob-abc123", &WaitForFineTuningJobOptions{
+		OnProgress: func(job *FineTuningJob) {
+			progress = append(progress, job.Status)
+		},
+		LogProgress: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, FineTuningJobSucceeded, job.Status)
+	assert.Equal(t, Model("ft:gpt-4o-mini:acme::abc123"), job.FineTunedModel)
+	assert.True(t, job.IsTerminal())
+	assert.Equal(t, []string{"validating_files", "queued", "running", "running", "succeeded"}, progress)
+	assert.Equal(t, []time.Duration{defaultFineTuningPollInterval, defaultFineTuningPollInterval,
+		defaultFineTuningPollInterval, defaultFineTuningPollInterval}, clock.Slept())
+	assert.Equal(t, 4, strings.Count(buf.String(), "fine-tuning job status changed"), "only changes are logged")
+	assert.Contains(t, buf.String(), "status=succeeded trained_tokens=5768")
+}
+
+func TestWaitForFineTuningJobFailed(t *testing.T) {
+	e := newFineTuningJobServer(t, FineTuningJobRunning, FineTuningJobFailed)
+	e.clock = newAutoClock()
+	job, err := WaitForFineTuningJob(context.Background(), e, "ftjob-abc123", &WaitForFineTuningJobOptions{PollInterval: time.Minute})
+	assert.ErrorIs(t, err, ErrFineTuningJobFailed)
+	assert.EqualError(t, err, "openai: fine-tuning job failed: Training file has too few examples")
+	require.NotNil(t, job)
+	assert.Equal(t, "invalid_training_file", job.Error.Code)
+}
+
+func TestWaitForFineTuningJobCancelled(t *testing.T) {
+	e := newFineTuningJobServer(t, FineTuningJobCancelled)
+	job, err := WaitForFineTuningJob(context.Background(), e, "ftjob-abc123", nil)
+	assert.ErrorIs(t, err, ErrFineTuningJobCancelled)
+	require.NotNil(t, job)
+	assert.Equal(t, FineTuningJobCancelled, job.Status)
+}
+
+func TestWaitForFineTuningJobContext(t *testing.T) {
+	e := newFineTuningJobServer(t, FineTuningJobRunning)
+	clock := NewTestClock(time.Unix(1700000000, 0))
+	e.clock = clock
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := WaitForFineTuningJob(ctx, e, "ftjob-abc123", &WaitForFineTuningJobOptions{PollInterval: time.Hour})
+		done <- err
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+	clock.BlockUntil(1) // polled again
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Equal(t, []time.Duration{time.Hour, time.Hour}, clock.Slept())
+}
+
+func TestStreamFineTuningEvents(t *testing.T) {
+	var connects int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/fine_tuning/jobs/ftjob-abc123/events", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("stream"))
+		w.Header().Set("Content-Type", "text/event-stream")
+		connects++
+		switch connects {
+		case 1:
+			assert.Empty(t, r.Header.Get("Last-Event-ID"))
+			fmt.Fprint(w, "retry: 1\n\n")
+			fmt.Fprint(w, "id: ftevent-1\ndata: {\"id\":\"ftevent-1\",\"level\":\"info\",\"message\":\"Fine-tuning job started\",\"type\":\"message\"}\n\n")
+			fmt.Fprint(w, "id: ftevent-2\ndata: {\"id\":\"ftevent-2\",\"level\":\"info\",\"message\":\"Step 1/2: training loss=1.50\",\"type\":\"metrics\",\"data\":{\"step\":1,\"total_steps\":2,\"train_loss\":1.5}}\n\n")
+			// The connection is dropped in the middle of the event
+			fmt.Fprint(w, "id: ftevent-3\ndata: {\"id\":")
+		default:
+			assert.Equal(t, "ftevent-2", r.Header.Get("Last-Event-ID"))
+			// The last event before the drop is repeated
+			fmt.Fprint(w, "id: ftevent-2\ndata: {\"id\":\"ftevent-2\",\"level\":\"info\",\"message\":\"Step 1/2: training loss=1.50\",\"type\":\"metrics\",\"data\":{\"step\":1,\"total_steps\":2,\"train_loss\":1.5}}\n\n")
+			fmt.Fprint(w, "id: ftevent-3\ndata: {\"id\":\"ftevent-3\",\"level\":\"info\",\"message\":\"The job has successfully completed\",\"type\":\"message\"}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		}
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	s, err := e.StreamFineTuningEvents(context.Background(), "ftjob-abc123")
+	require.NoError(t, err)
+	defer s.Close()
+	var events []*FineTuningEvent
+	for {
+		event, err := s.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		events = append(events, event)
+	}
+	require.Len(t, events, 3)
+	assert.Equal(t, "ftevent-1", events[0].Id)
+	assert.Equal(t, &FineTuningMetrics{Step: 1, TotalSteps: 2, TrainLoss: 1.5}, events[1].Data)
+	assert.Equal(t, "ftevent-3", events[2].Id)
+	assert.Equal(t, 2, connects)
+
+	_, err = s.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestStreamFineTuningEventsClosed(t *testing.T) {
+	var connects int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connects++
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "retry: 1\n\n")
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	s, err := e.StreamFineTuningEvents(context.Background(), "ftjob-abc123")
+	require.NoError(t, err)
+	defer s.Close()
+	_, err = s.Next()
+	assert.ErrorIs(t, err, ErrStreamClosed)
+	assert.Equal(t, 1+maxFineTuningStreamReconnects, connects)
+}
+
+func TestStreamFineTuningEventsMalformed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"id\":\"ftevent-1\",\"level\":\"info\"}\n\ndata: {\"id\":\n\n")
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	s, err := e.StreamFineTuningEvents(context.Background(), "ftjob-abc123")
+	require.NoError(t, err)
+	defer s.Close()
+	_, err = s.Next()
+	require.NoError(t, err)
+	_, err = s.Next()
+	var protocolErr *StreamProtocolError
+	require.ErrorAs(t, err, &protocolErr)
+	assert.Equal(t, `{"id":`, protocolErr.Snippet)
+}
+
+func TestStreamFineTuningEventsCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	s, err := e.StreamFineTuningEvents(ctx, "ftjob-abc123")
+	require.NoError(t, err)
+	defer s.Close()
+	_, err = s.Next()
+	assert.ErrorIs(t, err, ErrStreamCanceled)
+}
+
+func TestListFineTuningJobs(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/fine_tuning/jobs", r.URL.Path)
+		queries = append(queries, r.URL.RawQuery)
+		if r.URL.Query().Get("after") == "" {
+			fmt.Fprint(w, `{"object":"list","data":[{"id":"ftjob-1","status":"succeeded","checkpoints":[`+
+				`{"id":"ftckpt-1","object":"fine_tuning.job.checkpoint","fine_tuned_model_checkpoint":"ft:gpt-4o-mini:acme::abc:ckpt-step-10",`+
+				`"fine_tuning_job_id":"ftjob-1","step_number":10,"metrics":{"step":10,"train_loss":0.5}}]}],"last_id":"ftjob-1","has_more":true}`)
+			return
+		}
+		fmt.Fprint(w, `{"object":"list","data":[{"id":"ftjob-2","status":"running"}],"last_id":"ftjob-2","has_more":false}`)
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	opts := &ListFineTuningJobsOptions{
+		ListOptions: ListOptions{Limit: 1},
+		Include:     []string{FineTuningIncludeCheckpoints, "metrics"},
+	}
+	page, err := e.ListFineTuningJobs(context.Background(), opts)
+	require.NoError(t, err)
+	require.Len(t, page.Data, 1)
+	require.Len(t, page.Data[0].Checkpoints, 1)
+	checkpoint := page.Data[0].Checkpoints[0]
+	assert.Equal(t, Model("ft:gpt-4o-mini:acme::abc:ckpt-step-10"), checkpoint.FineTunedModelCheckpoint)
+	assert.Equal(t, 10, checkpoint.StepNumber)
+	assert.Equal(t, 0.5, checkpoint.Metrics.TrainLoss)
+	assert.Equal(t, "include=checkpoints%2Cmetrics&limit=1", queries[0], "include must be a single comma-separated parameter")
+
+	var ids []string
+	for job, err := range e.AllFineTuningJobs(context.Background(), opts) {
+		require.NoError(t, err)
+		ids = append(ids, job.Id)
+	}
+	assert.Equal(t, []string{"ftjob-1", "ftjob-2"}, ids)
+	assert.Equal(t, "after=ftjob-1&include=checkpoints%2Cmetrics&limit=1", queries[2])
+
+	_, err = e.ListFineTuningJobs(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, queries[3])
+}
+
+func TestCreateFineTuningJobIntegrations(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/fine_tuning/jobs", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Write([]byte(`{"id":"ftjob-abc123","object":"fine_tuning.job","model":"gpt-4o-mini","status":"validating_files",
+			"training_file":"file-train","integrations":[{"type":"wandb","wandb":{"project":"support-bot","name":"run-1","tags":["v2"]}}]}`))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	builder := NewWandbIntegrationBuilder().SetProject("support-bot").SetName("run-1").SetEntity("acme").AddTag("v2")
+	integration := builder.Build()
+	builder.AddTag("v3")
+	assert.Equal(t, []string{"v2"}, integration.Wandb.Tags, "the integration isn't modified by the builder")
+
+	job, err := e.CreateFineTuningJob(context.Background(), &CreateFineTuningJobOptions{
+		Model:        "gpt-4o-mini",
+		TrainingFile: "file-train",
+		Integrations: []FineTuningIntegration{integration},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"type": "wandb",
+		"wandb": map[string]interface{}{"project": "support-bot", "name": "run-1", "entity": "acme", "tags": []interface{}{"v2"}}}}, body["integrations"])
+	require.Len(t, job.Integrations, 1)
+	assert.Equal(t, "support-bot", job.Integrations[0].Wandb.Project)
+
+	_, err = e.CreateFineTuningJob(context.Background(), &CreateFineTuningJobOptions{
+		Model:        "gpt-4o-mini",
+		TrainingFile: "file-train",
+		Integrations: []FineTuningIntegration{NewWandbIntegrationBuilder().SetName("run-1").Build()},
+	})
+	assert.ErrorContains(t, err, "Project", "the project is required")
+}
@@ -0,0 +1,247 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ErrFunctionNotFound is returned by FunctionRegistry.Call if the function isn't registered.
+var ErrFunctionNotFound = errors.New("openai: function not found")
+
+var (
+	contextType    = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorInterface = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// FunctionRegistry is the set of functions the model may call by name.
+type FunctionRegistry struct {
+	mu        sync.RWMutex
+	functions map[string]*registeredFunction
+}
+
+type registeredFunction struct {
+	tool      Tool
+	fn        reflect.Value
+	params    reflect.Type
+	validator *ToolCallValidator
+}
+
+// FunctionDescriber is implemented by handlers passed to RegisterFromStruct to describe their methods.
+// Descriptions are keyed by method name, see MethodDocs to take them from the doc comments.
+type FunctionDescriber interface {
+	FunctionDescriptions() map[string]string
+}
+
+// NewFunctionRegistry returns the empty registry.
+func NewFunctionRegistry() *FunctionRegistry {
+	return &FunctionRegistry{functions: make(map[string]*registeredFunction)}
+}
+
+// Register is used to register fn, the function of the signature
+// func(ctx context.Context, params T) (string, error), under name. The parameters schema is
+// generated from T by JSONSchemaOf, T must be a struct or a pointer to the struct.
+func (r *FunctionRegistry) Register(name, description string, fn interface{}) error {
+	if !functionNamePattern.MatchString(name) {
+		return fmt.Errorf("function name %q must match %s", name, functionNamePattern)
+	}
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return fmt.Errorf("function %s must be a func, got %T", name, fn)
+	}
+	f, err := newRegisteredFunction(v)
+	if err != nil {
+		return fmt.Errorf("function %s: %w", name, err)
+	}
+	f.tool.Name = name
+	f.tool.Description = description
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.functions[name]; ok {
+		return fmt.Errorf("function %s is already registered", name)
+	}
+	r.functions[name] = f
+	return nil
+}
+
+// RegisterFromStruct is used to register the exported methods of handler which have the signature
+// func(ctx context.Context, params T) (string, error). Methods of other signatures are skipped.
+// The function of the method is named in snake case, e.g. GetWeather is "get_weather". It
+// returns the error if handler has no such methods.
+//
+// Doc comments aren't available at runtime, so the methods are described by
+// FunctionDescriptions if handler implements FunctionDescriber.
+func (r *FunctionRegistry) RegisterFromStruct(handler interface{}) error {
+	v := reflect.ValueOf(handler)
+	if !v.IsValid() {
+		return errors.New("handler is nil")
+	}
+	var descriptions map[string]string
+	if d, ok := handler.(FunctionDescriber); ok {
+		descriptions = d.FunctionDescriptions()
+	}
+	registered := 0
+	for i := 0; i < v.NumMethod(); i++ {
+		name := v.Type().Method(i).Name
+		if !isFunctionType(v.Method(i).Type()) {
+			continue
+		}
+		if err := r.Register(snakeCase(name), descriptions[name], v.Method(i).Interface()); err != nil {
+			return err
+		}
+		registered++
+	}
+	if registered == 0 {
+		return fmt.Errorf("%T has no methods of the signature func(context.Context, T) (string, error)", handler)
+	}
+	return nil
+}
+
+// Describe returns the tools of the registered functions, sorted by name.
+func (r *FunctionRegistry) Describe() []Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tools := make([]Tool, 0, len(r.functions))
+	for _, f := range r.functions {
+		tools = append(tools, f.tool)
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools
+}
+
+// ChatTools returns the registered functions as the tools of the chat completion, sorted by name.
+func (r *FunctionRegistry) ChatTools() []ChatTool {
+	tools := r.Describe()
+	chatTools := make([]ChatTool, len(tools))
+	for i, tool := range tools {
+		chatTools[i] = ChatTool{
+			Type: tool.Type,
+			Function: FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		}
+	}
+	return chatTools
+}
+
+// AssistantTools returns the registered functions as the tools of the assistant, sorted by name.
+func (r *FunctionRegistry) AssistantTools() []AssistantTool {
+	chatTools := r.ChatTools()
+	tools := make([]AssistantTool, len(chatTools))
+	for i := range chatTools {
+		tools[i] = AssistantTool{Type: chatTools[i].Type, Function: &chatTools[i].Function}
+	}
+	return tools
+}
+
+// Call is used to call the function name with the JSON encoded arguments generated by the model.
+func (r *FunctionRegistry) Call(ctx context.Context, name, arguments string) (string, error) {
+	r.mu.RLock()
+	f, ok := r.functions[name]
+	r.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrFunctionNotFound, name)
+	}
+	params := reflect.New(indirect(f.params))
+	if strings.TrimSpace(arguments) != "" {
+		if err := json.Unmarshal([]byte(arguments), params.Interface()); err != nil {
+			return "", fmt.Errorf("decode arguments of %s: %w", name, err)
+		}
+	}
+	if f.params.Kind() != reflect.Ptr {
+		params = params.Elem()
+	}
+	out := f.fn.Call([]reflect.Value{reflect.ValueOf(ctx), params})
+	err, _ := out[1].Interface().(error)
+	return out[0].String(), err
+}
+
+func newRegisteredFunction(fn reflect.Value) (*registeredFunction, error) {
+	t := fn.Type()
+	if !isFunctionType(t) {
+		return nil, fmt.Errorf("signature must be func(context.Context, T) (string, error), got %s", t)
+	}
+	params := t.In(1)
+	if indirect(params).Kind() != reflect.Struct {
+		return nil, fmt.Errorf("parameters must be a struct, got %s", params)
+	}
+	schema, err := JSONSchemaOf(params)
+	if err != nil {
+		return nil, fmt.Errorf("parameters schema: %w", err)
+	}
+	return &registeredFunction{
+		tool:   Tool{Type: "function", Parameters: schema},
+		fn:     fn,
+		params: params,
+	}, nil
+}
+
+// isFunctionType reports whether t is func(context.Context, T) (string, error).
+func isFunctionType(t reflect.Type) bool {
+	return t.NumIn() == 2 && t.In(0) == contextType &&
+		t.NumOut() == 2 && t.Out(0).Kind() == reflect.String && t.Out(1) == errorInterface
+}
+
+// snakeCase converts the Go name into snake case, e.g. GetHTTPStatus is "get_http_status".
+func snakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// MethodDocs parses the Go package in dir and returns the doc comments of the methods of the type
+// typeName keyed by method name, e.g. for FunctionDescriber. The source must be available, so
+// it's meant for go:generate or the development builds rather than the deployed binaries.
+func MethodDocs(dir, typeName string) (map[string]string, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		var files []*ast.File
+		for _, f := range pkg.Files {
+			files = append(files, f)
+		}
+		p, err := doc.NewFromFiles(fset, files, "", doc.AllDecls)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range p.Types {
+			if t.Name != typeName {
+				continue
+			}
+			docs := make(map[string]string, len(t.Methods))
+			for _, m := range t.Methods {
+				docs[m.Name] = strings.TrimSpace(m.Doc)
+			}
+			return docs, nil
+		}
+	}
+	return nil, fmt.Errorf("type %s not found in %s", typeName, dir)
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type weatherParams struct {
+	City string `json:"city" description:"The name of the city"`
+	Unit string `json:"unit,omitempty" enum:"celsius,fahrenheit"`
+}
+
+// weatherHandler is described by the doc comments of testdata/functions.
+type weatherHandler struct {
+	descriptions map[string]string
+}
+
+func (h *weatherHandler) GetWeather(ctx context.Context, params weatherParams) (string, error) {
+	if params.City == "" {
+		return "", errors.New("city is required")
+	}
+	return fmt.Sprintf("sunny in %s, 20 %s", params.City, params.Unit), nil
+}
+
+func (h *weatherHandler) GetUVIndex(ctx context.Context, params *weatherParams) (string, error) {
+	return "3", nil
+}
+
+// String isn't a function, its signature differs.
+func (h *weatherHandler) String() string { return "weather" }
+
+func (h *weatherHandler) FunctionDescriptions() map[string]string { return h.descriptions }
+
+func TestFunctionRegistryRegisterFromStruct(t *testing.T) {
+	docs, err := MethodDocs("testdata/functions", "Handler")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"GetWeather": "GetWeather returns the current weather in the city.",
+		"GetUVIndex": "GetUVIndex returns the UV index in the city.",
+	}, docs)
+	_, err = MethodDocs("testdata/functions", "Missing")
+	assert.Error(t, err)
+
+	r := NewFunctionRegistry()
+	require.NoError(t, r.RegisterFromStruct(&weatherHandler{descriptions: docs}))
+
+	tools := r.Describe()
+	require.Len(t, tools, 2)
+	assert.Equal(t, "get_uv_index", tools[0].Name)
+	assert.Equal(t, "get_weather", tools[1].Name)
+	assert.Equal(t, "function", tools[1].Type)
+	assert.Equal(t, "GetWeather returns the current weather in the city.", tools[1].Description)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"city": {"type": "string", "description": "The name of the city"},
+			"unit": {"type": "string", "enum": ["celsius", "fahrenheit"]}
+		},
+		"required": ["city"]
+	}`, string(tools[1].Parameters))
+	assert.JSONEq(t, string(tools[1].Parameters), string(tools[0].Parameters))
+
+	out, err := r.Call(context.Background(), "get_weather", `{"city":"Berlin","unit":"celsius"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "sunny in Berlin, 20 celsius", out)
+	out, err = r.Call(context.Background(), "get_uv_index", `{"city":"Berlin"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "3", out)
+	_, err = r.Call(context.Background(), "get_weather", `{}`)
+	assert.EqualError(t, err, "city is required")
+	_, err = r.Call(context.Background(), "get_weather", `{"city":1}`)
+	assert.ErrorContains(t, err, "decode arguments of get_weather")
+	_, err = r.Call(context.Background(), "get_time", `{}`)
+	assert.ErrorIs(t, err, ErrFunctionNotFound)
+
+	assert.ErrorContains(t, r.RegisterFromStruct(&weatherHandler{}), "get_uv_index is already registered")
+	assert.ErrorContains(t, NewFunctionRegistry().RegisterFromStruct(struct{}{}), "has no methods")
+}
+
+func TestFunctionRegistryRegister(t *testing.T) {
+	r := NewFunctionRegistry()
+	require.NoError(t, r.Register("echo", "Echoes the text", func(ctx context.Context, params struct {
+		Text string `json:"text"`
+	}) (string, error) {
+		return params.Text, nil
+	}))
+	out, err := r.Call(context.Background(), "echo", `{"text":"hi"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "hi", out)
+
+	assert.ErrorContains(t, r.Register("echo back", "", func(context.Context, weatherParams) (string, error) { return "", nil }), "must match")
+	assert.ErrorContains(t, r.Register("echo2", "", func(string) string { return "" }), "signature must be")
+	assert.ErrorContains(t, r.Register("echo3", "", func(context.Context, string) (string, error) { return "", nil }), "parameters must be a struct")
+	assert.ErrorContains(t, r.Register("echo4", "", "echo"), "must be a func")
+}
+
+func TestSnakeCase(t *testing.T) {
+	for name, want := range map[string]string{
+		"GetWeather":    "get_weather",
+		"GetHTTPStatus": "get_http_status",
+		"ID":            "id",
+		"Search2":       "search2",
+	} {
+		assert.Equal(t, want, snakeCase(name), name)
+	}
+}
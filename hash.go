@@ -0,0 +1,97 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// canonicalHashVersion prefixes every hash returned by CanonicalHash. It's changed whenever
+// the canonical encoding changes, so hashes with the same prefix are comparable across
+// versions of the package.
+const canonicalHashVersion = "v1"
+
+type CanonicalHashOptions struct {
+	// Exclude are the fields which aren't hashed, by their JSON names, e.g. "metadata" or
+	// "metadata.trace_id" to exclude the single key of the map.
+	Exclude []string
+}
+
+// CanonicalHash returns the hash of the request, as it's sent to the API, which is the same for
+// the same logical request, e.g. to deduplicate or cache requests. See CanonicalHashWithOptions.
+func CanonicalHash(opts *ChatCompletionOptions) (string, error) {
+	return CanonicalHashWithOptions(opts, CanonicalHashOptions{})
+}
+
+// CanonicalHashWithOptions returns the hash of the request, as it's sent to the API, which is the same
+// for the same logical request. The request is encoded canonically: object keys are sorted, nil and empty
+// slices and maps are the same as unset fields, the default max_tokens is applied and the volatile messages
+// are moved if MoveVolatileMessages is set. Fields which aren't sent, e.g. Ctx, are ignored.
+// The canonical encoding is hashed with SHA-256.
+//
+// The hash has the form "v1:<hex>". Hashes of the same request are equal across versions of the package
+// as long as they have the same version prefix, the prefix is changed whenever the encoding changes.
+func CanonicalHashWithOptions(opts *ChatCompletionOptions, hashOpts CanonicalHashOptions) (string, error) {
+	if opts == nil {
+		opts = &ChatCompletionOptions{}
+	}
+	o := *opts
+	if o.MaxTokens == 0 && o.MaxCompletionTokens == 0 {
+		o.MaxTokens = defaultMaxTokens
+	}
+	b, err := json.Marshal(normalizePromptCache(&o))
+	if err != nil {
+		return "", err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return "", err
+	}
+	for _, path := range hashOpts.Exclude {
+		excludeField(v, strings.Split(path, "."))
+	}
+	// Maps are marshaled with sorted keys
+	if b, err = json.Marshal(canonicalValue(v)); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return canonicalHashVersion + ":" + hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalValue drops nil and empty values from objects and arrays, recursively.
+func canonicalValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if value = normalizeDiffValue(canonicalValue(value)); value == nil {
+				delete(v, key)
+			} else {
+				v[key] = value
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = canonicalValue(value)
+		}
+	}
+	return normalizeDiffValue(v)
+}
+
+func excludeField(v interface{}, path []string) {
+	fields, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		delete(fields, path[0])
+		return
+	}
+	excludeField(fields[path[0]], path[1:])
+}
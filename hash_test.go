@@ -0,0 +1,144 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// shuffledObject returns the JSON object of fields with the keys in random order.
+func shuffledObject(rnd *rand.Rand, fields map[string]string) json.RawMessage {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	rnd.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%q:%s", key, fields[key])
+	}
+	return json.RawMessage("{" + strings.Join(parts, ",") + "}")
+}
+
+// randomHashOptions returns random options, the same for the same seed except for the order of keys.
+func randomHashOptions(seed int64, order *rand.Rand) *ChatCompletionOptions {
+	rnd := rand.New(rand.NewSource(seed))
+	opts := &ChatCompletionOptions{
+		Model:       ModelGPT4,
+		Temperature: float32(rnd.Intn(20)) / 10,
+		Metadata:    make(map[string]string),
+	}
+	for i := 0; i < 1+rnd.Intn(5); i++ {
+		opts.Messages = append(opts.Messages, ChatMessage{Role: "user", Content: fmt.Sprint("message ", rnd.Int())})
+	}
+	keys := rnd.Perm(10)[:1+rnd.Intn(9)]
+	order.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	for _, k := range keys {
+		opts.Metadata[fmt.Sprint("key", k)] = fmt.Sprint("value", k)
+	}
+	opts.Tools = []ChatTool{{Type: "function", Function: FunctionDefinition{
+		Name: "lookup",
+		Parameters: shuffledObject(order, map[string]string{
+			"type":       `"object"`,
+			"properties": string(shuffledObject(order, map[string]string{"a": `{"type":"string"}`, "b": `{"type":"integer"}`})),
+			"required":   `["a"]`,
+		}),
+	}}}
+	if rnd.Intn(2) == 0 {
+		opts.Stop = []string{"\n"}
+	}
+	return opts
+}
+
+func TestCanonicalHashReorderedMaps(t *testing.T) {
+	order := rand.New(rand.NewSource(1))
+	for seed := int64(0); seed < 200; seed++ {
+		a, err := CanonicalHash(randomHashOptions(seed, order))
+		require.NoError(t, err)
+		b, err := CanonicalHash(randomHashOptions(seed, order))
+		require.NoError(t, err)
+		require.Equal(t, a, b, "seed %d", seed)
+		assert.True(t, strings.HasPrefix(a, "v1:"))
+	}
+}
+
+func TestCanonicalHashNormalization(t *testing.T) {
+	base := testChatOptions()
+	h, err := CanonicalHash(base)
+	require.NoError(t, err)
+
+	same := *base
+	same.Stop = []string{}
+	same.Tools = []ChatTool{}
+	same.Metadata = map[string]string{}
+	same.MaxTokens = defaultMaxTokens
+	got, err := CanonicalHash(&same)
+	require.NoError(t, err)
+	assert.Equal(t, h, got, "empty fields and the default max_tokens must not change the hash")
+
+	nilOpts, err := CanonicalHash(nil)
+	require.NoError(t, err)
+	empty, err := CanonicalHash(&ChatCompletionOptions{Messages: []ChatMessage{}})
+	require.NoError(t, err)
+	assert.Equal(t, nilOpts, empty)
+}
+
+func TestCanonicalHashSemanticChange(t *testing.T) {
+	order := rand.New(rand.NewSource(1))
+	mutations := map[string]func(o *ChatCompletionOptions){
+		"model":        func(o *ChatCompletionOptions) { o.Model = ModelGPT3Dot5Turbo },
+		"temperature":  func(o *ChatCompletionOptions) { o.Temperature += 0.05 },
+		"message":      func(o *ChatCompletionOptions) { o.Messages[0].Content += "!" },
+		"role":         func(o *ChatCompletionOptions) { o.Messages[0].Role = "system" },
+		"message list": func(o *ChatCompletionOptions) { o.Messages = append(o.Messages, ChatMessage{Role: "user"}) },
+		"metadata":     func(o *ChatCompletionOptions) { o.Metadata["extra"] = "x" },
+		"max tokens":   func(o *ChatCompletionOptions) { o.MaxTokens = 10 },
+		"tool":         func(o *ChatCompletionOptions) { o.Tools[0].Function.Name = "search" },
+		"n":            func(o *ChatCompletionOptions) { o.N = 2 },
+		"parallel":     func(o *ChatCompletionOptions) { o.ParallelToolCalls = boolPtr(false) },
+	}
+	for seed := int64(0); seed < 50; seed++ {
+		base, err := CanonicalHash(randomHashOptions(seed, order))
+		require.NoError(t, err)
+		for name, mutate := range mutations {
+			opts := randomHashOptions(seed, order)
+			mutate(opts)
+			got, err := CanonicalHash(opts)
+			require.NoError(t, err)
+			require.NotEqual(t, base, got, "seed %d, %s", seed, name)
+		}
+	}
+}
+
+func TestCanonicalHashExclude(t *testing.T) {
+	a := testChatOptions()
+	a.Metadata = map[string]string{"trace_id": "1", "tenant": "acme"}
+	b := testChatOptions()
+	b.Metadata = map[string]string{"trace_id": "2", "tenant": "acme"}
+
+	ha, err := CanonicalHash(a)
+	require.NoError(t, err)
+	hb, err := CanonicalHash(b)
+	require.NoError(t, err)
+	assert.NotEqual(t, ha, hb)
+
+	exclude := CanonicalHashOptions{Exclude: []string{"metadata.trace_id"}}
+	ha, err = CanonicalHashWithOptions(a, exclude)
+	require.NoError(t, err)
+	hb, err = CanonicalHashWithOptions(b, exclude)
+	require.NoError(t, err)
+	assert.Equal(t, ha, hb)
+
+	b.Metadata["tenant"] = "other"
+	hb, err = CanonicalHashWithOptions(b, exclude)
+	require.NoError(t, err)
+	assert.NotEqual(t, ha, hb, "other keys of metadata must be hashed")
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+type contextHeader struct {
+	key  interface{}
+	name string
+}
+
+type requestHeadersKey struct{}
+
+type requestIdKey struct{}
+
+// WithDefaultHeaders is used to set headers sent with every request.
+// It may be used multiple times, headers of later calls replace the ones with the same name.
+//
+// Headers are set on every request in the order of precedence, from the lowest to the highest:
+// defaults of engine, headers derived from the context (WithHeaderFromContext) and headers of
+// the request (ContextWithHeaders). A header of higher precedence replaces all values of the header
+// with the same name. Headers managed by engine itself, e.g. Authorization and Content-Type,
+// always take precedence. Denied headers (WithDeniedHeaders) are removed right before the request is sent.
+func WithDefaultHeaders(header http.Header) EngineOption {
+	return func(e *Engine) {
+		if e.defaultHeaders == nil {
+			e.defaultHeaders = make(http.Header)
+		}
+		for name, values := range header {
+			e.defaultHeaders[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+	}
+}
+
+// WithHeaderFromContext is used to send the value of ctx.Value(ctxKey) as the header, e.g. to propagate
+// the tenant ID or trace context. The value must be either string or fmt.Stringer, the header isn't
+// set if there is no value or it's empty.
+func WithHeaderFromContext(ctxKey interface{}, headerName string) EngineOption {
+	return func(e *Engine) {
+		e.contextHeaders = append(e.contextHeaders, contextHeader{key: ctxKey, name: headerName})
+	}
+}
+
+// WithDeniedHeaders is used to remove headers from every request, no matter if they were set
+// by defaults, the context, the request signer or the request itself. The Authorization header
+// can't be denied, it's ignored. Headers added by the HTTP client and its transport aren't affected.
+func WithDeniedHeaders(names ...string) EngineOption {
+	return func(e *Engine) {
+		for _, name := range names {
+			if name = http.CanonicalHeaderKey(name); name != "Authorization" {
+				e.deniedHeaders = append(e.deniedHeaders, name)
+			}
+		}
+	}
+}
+
+// ContextWithHeaders returns the context which makes requests sent with it carry the headers.
+// Headers of the parent context are kept unless they are replaced by the ones with the same name.
+func ContextWithHeaders(ctx context.Context, header http.Header) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	merged := make(http.Header)
+	if parent, ok := ctx.Value(requestHeadersKey{}).(http.Header); ok {
+		for name, values := range parent {
+			merged[name] = values
+		}
+	}
+	for name, values := range header {
+		merged[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+	}
+	return context.WithValue(ctx, requestHeadersKey{}, merged)
+}
+
+// ContextWithRequestId returns the context which makes requests sent with it carry id in the
+// X-Request-ID and X-OpenAI-Client-Request-ID headers, to correlate them with the logs and
+// traces of the caller. The ID replaces the one returned by the function set with WithRequestIdFunc.
+func ContextWithRequestId(ctx context.Context, id string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+// WithRequestIdFunc is used to set the function which returns the request ID of requests sent
+// without ContextWithRequestId, e.g. the trace ID of the span carried by the context:
+//
+//	openai.WithRequestIdFunc(func(ctx context.Context) string {
+//		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+//			return sc.TraceID().String() + "-" + sc.SpanID().String()
+//		}
+//		return ""
+//	})
+//
+// The headers aren't set if the function returns an empty string.
+func WithRequestIdFunc(fn func(ctx context.Context) string) EngineOption {
+	return func(e *Engine) {
+		e.requestIdFunc = fn
+	}
+}
+
+// requestId returns the request ID of ctx.
+func (e *Engine) requestId(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIdKey{}).(string); ok {
+		return id
+	}
+	if e.requestIdFunc != nil {
+		return e.requestIdFunc(ctx)
+	}
+	return ""
+}
+
+// setHeaders sets the headers of defaults, context and request in the order of precedence.
+func (e *Engine) setHeaders(ctx context.Context, h http.Header) {
+	for name, values := range e.defaultHeaders {
+		h[name] = append([]string(nil), values...)
+	}
+	for _, ch := range e.contextHeaders {
+		var value string
+		switch v := ctx.Value(ch.key).(type) {
+		case string:
+			value = v
+		case fmt.Stringer:
+			value = v.String()
+		}
+		if value != "" {
+			h.Set(ch.name, value)
+		}
+	}
+	if header, ok := ctx.Value(requestHeadersKey{}).(http.Header); ok {
+		for name, values := range header {
+			h[name] = append([]string(nil), values...)
+		}
+	}
+	if id := e.requestId(ctx); id != "" {
+		h.Set("X-Request-ID", id)
+		h.Set("X-OpenAI-Client-Request-ID", id)
+	}
+}
+
+type responseMetaKey struct{}
+
+// ResponseMeta is the metadata of the response, it's filled in after the request sent
+// with the context returned by ContextWithResponseMeta receives the response.
+type ResponseMeta struct {
+	// The status code of the response.
+	StatusCode int
+	// The headers of the response.
+	Header http.Header
+}
+
+// RequestId returns the ID of the request assigned by the API, it's empty if the API didn't return it.
+func (m *ResponseMeta) RequestId() string {
+	return m.Header.Get("X-Request-Id")
+}
+
+// ContextWithResponseMeta returns the context which makes the request sent with it fill in meta
+// with the metadata of its response. If the request is retried, meta describes the last attempt.
+func ContextWithResponseMeta(ctx context.Context, meta *ResponseMeta) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, responseMetaKey{}, meta)
+}
+
+func setResponseMeta(ctx context.Context, resp *http.Response) {
+	if meta, ok := ctx.Value(responseMetaKey{}).(*ResponseMeta); ok && meta != nil && resp != nil {
+		meta.StatusCode = resp.StatusCode
+		meta.Header = resp.Header
+	}
+}
+
+func (e *Engine) removeDeniedHeaders(h http.Header) {
+	for _, name := range e.deniedHeaders {
+		h.Del(name)
+	}
+}
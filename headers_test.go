@@ -0,0 +1,191 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type traceKey struct{}
+
+type traceParent string
+
+func (p traceParent) String() string {
+	return string(p)
+}
+
+// newHeaderServer records headers of every request and answers chat completions,
+// completion streams and transcriptions.
+func newHeaderServer(t *testing.T, headers *[]http.Header, opts ...EngineOption) *Engine {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*headers = append(*headers, r.Header.Clone())
+		switch r.URL.Path {
+		case "/completions":
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"id\":\"cmpl-1\",\"choices\":[{\"text\":\"a\",\"index\":0}]}\n\ndata: [DONE]\n\n"))
+		case "/audio/transcriptions":
+			w.Write([]byte(`{"text":"hallo"}`))
+		default:
+			w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	e := New("sk-test", opts...)
+	e.apiBaseURL = srv.URL
+	return e
+}
+
+func TestHeaderPrecedence(t *testing.T) {
+	var headers []http.Header
+	e := newHeaderServer(t, &headers,
+		WithDefaultHeaders(http.Header{
+			"X-Tenant-Id":   {"default-tenant"},
+			"X-Cost-Center": {"ml-platform"},
+			"Traceparent":   {"default-trace"},
+			"Authorization": {"Bearer default"},
+		}),
+		WithHeaderFromContext(tenantKey{}, "X-Tenant-Id"),
+		WithHeaderFromContext(traceKey{}, "traceparent"),
+	)
+	ctx := context.WithValue(context.Background(), tenantKey{}, "ctx-tenant")
+	ctx = context.WithValue(ctx, traceKey{}, traceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"))
+	ctx = ContextWithHeaders(ctx, http.Header{"x-tenant-id": {"request-tenant"}, "Authorization": {"Bearer request"}})
+
+	_, err := e.ChatCompletion(ctx, testChatOptions())
+	require.NoError(t, err)
+	s, err := e.CompletionStream(ctx, &CompletionOptions{Model: "gpt-3.5-turbo-instruct", Prompt: []string{"a"}})
+	require.NoError(t, err)
+	s.Close()
+	_, err = e.Transcribe(ctx, transcribeOptions(strings.NewReader("RIFF audio")))
+	require.NoError(t, err)
+
+	require.Len(t, headers, 3)
+	for _, h := range headers {
+		assert.Equal(t, []string{"request-tenant"}, h.Values("X-Tenant-Id"), "request headers take precedence")
+		assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", h.Get("Traceparent"), "context headers take precedence over defaults")
+		assert.Equal(t, "ml-platform", h.Get("X-Cost-Center"))
+		assert.Equal(t, "Bearer sk-test", h.Get("Authorization"), "engine headers take precedence")
+	}
+	assert.True(t, strings.HasPrefix(headers[2].Get("Content-Type"), "multipart/form-data"))
+
+	// Without the values in the context the defaults are sent
+	headers = nil
+	_, err = e.ChatCompletion(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	require.Len(t, headers, 1)
+	assert.Equal(t, "default-tenant", headers[0].Get("X-Tenant-Id"))
+	assert.Equal(t, "default-trace", headers[0].Get("Traceparent"))
+}
+
+func TestContextWithHeadersMerge(t *testing.T) {
+	var headers []http.Header
+	e := newHeaderServer(t, &headers)
+	ctx := ContextWithHeaders(context.Background(), http.Header{"X-A": {"1"}, "X-B": {"1"}})
+	ctx = ContextWithHeaders(ctx, http.Header{"X-B": {"2", "3"}})
+	_, err := e.ChatCompletion(ctx, testChatOptions())
+	require.NoError(t, err)
+	require.Len(t, headers, 1)
+	assert.Equal(t, "1", headers[0].Get("X-A"))
+	assert.Equal(t, []string{"2", "3"}, headers[0].Values("X-B"))
+}
+
+func TestDeniedHeaders(t *testing.T) {
+	var headers []http.Header
+	e := newHeaderServer(t, &headers,
+		WithDefaultHeaders(http.Header{"Cookie": {"internal-session=default"}, "X-Tenant-Id": {"acme"}}),
+		WithDeniedHeaders("cookie", "X-Internal-Auth", "authorization"),
+	)
+	e.SetRequestSigner(RequestSignerFunc(func(_ string, _ *url.URL, header http.Header, _ func() ([]byte, error)) error {
+		header.Set("X-Internal-Auth", "signer-secret")
+		header.Set("X-Signature", "sig")
+		return nil
+	}))
+	ctx := ContextWithHeaders(context.Background(), http.Header{"Cookie": {"internal-session=request"}})
+
+	_, err := e.ChatCompletion(ctx, testChatOptions())
+	require.NoError(t, err)
+	s, err := e.CompletionStream(ctx, &CompletionOptions{Model: "gpt-3.5-turbo-instruct", Prompt: []string{"a"}})
+	require.NoError(t, err)
+	s.Close()
+	_, err = e.Transcribe(ctx, transcribeOptions(strings.NewReader("RIFF audio")))
+	require.NoError(t, err)
+
+	require.Len(t, headers, 3)
+	for _, h := range headers {
+		assert.Empty(t, h.Values("Cookie"))
+		assert.Empty(t, h.Values("X-Internal-Auth"), "headers of middleware must be removed")
+		assert.Equal(t, "sig", h.Get("X-Signature"))
+		assert.Equal(t, "acme", h.Get("X-Tenant-Id"))
+		assert.Equal(t, "Bearer sk-test", h.Get("Authorization"), "Authorization can't be denied")
+	}
+}
+
+func TestRealTimeSessionHeaders(t *testing.T) {
+	received := make(chan http.Header, 1)
+	e := newRealTimeTestServer(t, func(t *testing.T, conn *websocket.Conn, r *http.Request) {
+		received <- r.Header.Clone()
+	})
+	WithDefaultHeaders(http.Header{"X-Tenant-Id": {"acme"}, "Cookie": {"internal-session=1"}})(e)
+	WithDeniedHeaders("Cookie")(e)
+
+	s, err := NewRealTimeSession(context.Background(), e, ModelGPT4oRealtimePreview, nil)
+	require.NoError(t, err)
+	defer s.Close()
+	h := <-received
+	assert.Equal(t, "acme", h.Get("X-Tenant-Id"))
+	assert.Empty(t, h.Values("Cookie"))
+	assert.Equal(t, "Bearer test", h.Get("Authorization"))
+}
+
+func TestRequestId(t *testing.T) {
+	var headers []http.Header
+	e := newHeaderServer(t, &headers, WithRequestIdFunc(func(ctx context.Context) string {
+		if tp, ok := ctx.Value(traceKey{}).(traceParent); ok {
+			return string(tp)
+		}
+		return ""
+	}))
+
+	_, err := e.ChatCompletion(ContextWithRequestId(context.Background(), "req-1"), testChatOptions())
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), traceKey{}, traceParent("trace-1"))
+	_, err = e.ChatCompletion(ctx, testChatOptions())
+	require.NoError(t, err)
+	_, err = e.ChatCompletion(ContextWithRequestId(ctx, "req-2"), testChatOptions())
+	require.NoError(t, err)
+	_, err = e.ChatCompletion(context.Background(), testChatOptions())
+	require.NoError(t, err)
+
+	require.Len(t, headers, 4)
+	for i, id := range []string{"req-1", "trace-1", "req-2", ""} {
+		assert.Equal(t, id, headers[i].Get("X-Request-ID"), "request %d", i)
+		assert.Equal(t, id, headers[i].Get("X-OpenAI-Client-Request-ID"), "request %d", i)
+	}
+}
+
+func TestResponseMeta(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req_abc")
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer srv.Close()
+	e := New("sk-test")
+	e.apiBaseURL = srv.URL
+
+	var meta ResponseMeta
+	_, err := e.ChatCompletion(ContextWithResponseMeta(context.Background(), &meta), testChatOptions())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, meta.StatusCode)
+	assert.Equal(t, "req_abc", meta.RequestId())
+	assert.Empty(t, new(ResponseMeta).RequestId())
+}
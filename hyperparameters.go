@@ -0,0 +1,148 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrHyperparameterUnsupported is matched by the error of ValidateFineTuningHyperparameters
+// if the hyperparameter isn't supported by the model.
+var ErrHyperparameterUnsupported = errors.New("openai: hyperparameter unsupported")
+
+// autoValue is the value of the hyperparameter chosen by the API.
+var autoValue = []byte(`"auto"`)
+
+// FineTuningHyperparameters are the hyperparameters used for the fine-tuning job.
+// The values are either numbers or "auto", the ones which are nil are chosen by the API.
+type FineTuningHyperparameters struct {
+	// The number of epochs, between 1 and 50.
+	NEpochs *IntOrAuto `json:"n_epochs,omitempty"`
+	// The number of examples in the batch, between 1 and 256.
+	BatchSize *IntOrAuto `json:"batch_size,omitempty"`
+	// The multiplier of the learning rate, greater than 0.
+	LearningRateMultiplier *FloatOrAuto `json:"learning_rate_multiplier,omitempty"`
+}
+
+// IntOrAuto is the integer hyperparameter, Value unless Auto is set, which makes the API choose
+// the value. It's encoded as the number or "auto".
+type IntOrAuto struct {
+	Value int
+	Auto  bool
+}
+
+func (v IntOrAuto) MarshalJSON() ([]byte, error) {
+	if v.Auto {
+		return autoValue, nil
+	}
+	return json.Marshal(v.Value)
+}
+
+func (v *IntOrAuto) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, autoValue) {
+		*v = IntOrAuto{Auto: true}
+		return nil
+	}
+	*v = IntOrAuto{}
+	return json.Unmarshal(b, &v.Value)
+}
+
+// FloatOrAuto is the floating-point hyperparameter, see IntOrAuto.
+type FloatOrAuto struct {
+	Value float64
+	Auto  bool
+}
+
+func (v FloatOrAuto) MarshalJSON() ([]byte, error) {
+	if v.Auto {
+		return autoValue, nil
+	}
+	return json.Marshal(v.Value)
+}
+
+func (v *FloatOrAuto) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, autoValue) {
+		*v = FloatOrAuto{Auto: true}
+		return nil
+	}
+	*v = FloatOrAuto{}
+	return json.Unmarshal(b, &v.Value)
+}
+
+// fineTuningHyperparameters are the hyperparameters of FineTuningHyperparameters supported by
+// the models which can be fine-tuned. The number of epochs is supported by all of them. The
+// hyperparameters of the reinforcement fine-tuning of the reasoning models aren't set with
+// FineTuningHyperparameters.
+//
+// Learn more: https://platform.openai.com/docs/guides/fine-tuning#which-models-can-be-fine-tuned
+var fineTuningHyperparameters = map[Model]struct {
+	nEpochs, batchSize, learningRateMultiplier bool
+}{
+	"gpt-4.1-2025-04-14":      {true, true, true},
+	"gpt-4.1-mini-2025-04-14": {true, true, true},
+	"gpt-4.1-nano-2025-04-14": {true, true, true},
+	"gpt-4o-2024-08-06":       {true, true, true},
+	"gpt-4o-mini-2024-07-18":  {true, true, true},
+	"gpt-4-0613":              {true, true, true},
+	"gpt-3.5-turbo-0125":      {true, true, true},
+	"gpt-3.5-turbo-1106":      {true, true, true},
+	"gpt-3.5-turbo-0613":      {true, false, false},
+	"babbage-002":             {true, true, true},
+	"davinci-002":             {true, true, true},
+	"o4-mini-2025-04-16":      {false, false, false},
+}
+
+// ValidateFineTuningHyperparameters reports whether params are valid for the fine-tuning job of
+// model, the base model or the fine-tuned model of the base model, whose training is continued.
+// It returns the error matching ErrHyperparameterUnsupported for every hyperparameter the model
+// doesn't support, and the errors of the values out of range. The values set to "auto" are always
+// valid, and so is nil params. The error is returned if the model can't be fine-tuned.
+func ValidateFineTuningHyperparameters(model Model, params *FineTuningHyperparameters) error {
+	base := string(model)
+	if name, ok := strings.CutPrefix(base, "ft:"); ok {
+		base, _, _ = strings.Cut(name, ":")
+	}
+	supported, ok := fineTuningHyperparameters[Model(base)]
+	if !ok {
+		return fmt.Errorf("openai: model %s can't be fine-tuned", model)
+	}
+	if params == nil {
+		return nil
+	}
+	var errs []error
+	check := func(name string, supported bool, invalid string) {
+		switch {
+		case !supported:
+			errs = append(errs, fmt.Errorf("%w: %s of model %s", ErrHyperparameterUnsupported, name, model))
+		case invalid != "":
+			errs = append(errs, fmt.Errorf("openai: %s %s", name, invalid))
+		}
+	}
+	if v := params.NEpochs; v != nil {
+		check("n_epochs", supported.nEpochs, intOutOfRange(*v, 1, 50))
+	}
+	if v := params.BatchSize; v != nil {
+		check("batch_size", supported.batchSize, intOutOfRange(*v, 1, 256))
+	}
+	if v := params.LearningRateMultiplier; v != nil {
+		var invalid string
+		if !v.Auto && v.Value <= 0 {
+			invalid = fmt.Sprintf("must be greater than 0, got %g", v.Value)
+		}
+		check("learning_rate_multiplier", supported.learningRateMultiplier, invalid)
+	}
+	return errors.Join(errs...)
+}
+
+// intOutOfRange describes the value out of the range between lo and hi, it's empty if the value is valid.
+func intOutOfRange(v IntOrAuto, lo, hi int) string {
+	if v.Auto || v.Value >= lo && v.Value <= hi {
+		return ""
+	}
+	return fmt.Sprintf("must be between %d and %d, got %d", lo, hi, v.Value)
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFineTuningHyperparametersJSON(t *testing.T) {
+	params := FineTuningHyperparameters{
+		NEpochs:                &IntOrAuto{Value: 3},
+		BatchSize:              &IntOrAuto{Auto: true},
+		LearningRateMultiplier: &FloatOrAuto{Value: 0.5},
+	}
+	b, err := json.Marshal(params)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"n_epochs":3,"batch_size":"auto","learning_rate_multiplier":0.5}`, string(b))
+
+	var decoded FineTuningHyperparameters
+	require.NoError(t, json.Unmarshal([]byte(`{"n_epochs":"auto","batch_size":8,"learning_rate_multiplier":"auto"}`), &decoded))
+	assert.Equal(t, FineTuningHyperparameters{
+		NEpochs:                &IntOrAuto{Auto: true},
+		BatchSize:              &IntOrAuto{Value: 8},
+		LearningRateMultiplier: &FloatOrAuto{Auto: true},
+	}, decoded)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"n_epochs":"three"}`), &decoded))
+}
+
+func TestValidateFineTuningHyperparameters(t *testing.T) {
+	valid := &FineTuningHyperparameters{
+		NEpochs:                &IntOrAuto{Value: 50},
+		BatchSize:              &IntOrAuto{Auto: true},
+		LearningRateMultiplier: &FloatOrAuto{Value: 1.8},
+	}
+	assert.NoError(t, ValidateFineTuningHyperparameters("gpt-4o-mini-2024-07-18", valid))
+	assert.NoError(t, ValidateFineTuningHyperparameters("ft:gpt-4o-mini-2024-07-18:acme::abc123", valid), "the training of the fine-tuned model is continued")
+	assert.NoError(t, ValidateFineTuningHyperparameters("gpt-4o-mini-2024-07-18", nil))
+
+	err := ValidateFineTuningHyperparameters("gpt-3.5-turbo-0613", valid)
+	assert.ErrorIs(t, err, ErrHyperparameterUnsupported)
+	assert.ErrorContains(t, err, "batch_size")
+	assert.ErrorContains(t, err, "learning_rate_multiplier")
+	assert.NotContains(t, err.Error(), "n_epochs")
+	assert.NoError(t, ValidateFineTuningHyperparameters("gpt-3.5-turbo-0613", &FineTuningHyperparameters{NEpochs: &IntOrAuto{Value: 4}}))
+
+	err = ValidateFineTuningHyperparameters("davinci-002", &FineTuningHyperparameters{
+		NEpochs:                &IntOrAuto{Value: 0},
+		BatchSize:              &IntOrAuto{Value: 512},
+		LearningRateMultiplier: &FloatOrAuto{Value: -1},
+	})
+	assert.NotErrorIs(t, err, ErrHyperparameterUnsupported)
+	assert.ErrorContains(t, err, "n_epochs must be between 1 and 50, got 0")
+	assert.ErrorContains(t, err, "batch_size must be between 1 and 256, got 512")
+	assert.ErrorContains(t, err, "learning_rate_multiplier must be greater than 0, got -1")
+
+	assert.ErrorContains(t, ValidateFineTuningHyperparameters("gpt-4o-audio-preview", nil), "can't be fine-tuned")
+}
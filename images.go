@@ -45,6 +45,18 @@ type ImageCreateOptions struct {
 	ResponseFormat string `json:"response_format,omitempty" binding:"omitempty,oneof=url b64_json"`
 }
 
+// withDefaults returns the copy of opts with the default size and response format set.
+func (opts *ImageCreateOptions) withDefaults() *ImageCreateOptions {
+	out := *opts
+	if len(out.Size) == 0 {
+		out.Size = SizeSmall
+	}
+	if len(out.ResponseFormat) == 0 {
+		out.ResponseFormat = ResponseFormatUrl
+	}
+	return &out
+}
+
 type ImageCreateResponse struct {
 	Created int `json:"created"`
 	Data    []struct {
@@ -56,16 +68,12 @@ type ImageCreateResponse struct {
 //
 // Docs: https://beta.openai.com/docs/api-reference/images/create
 func (e *Engine) ImageCreate(ctx context.Context, opts *ImageCreateOptions) (*ImageCreateResponse, error) {
-	if err := e.validate.StructCtx(ctx, opts); err != nil {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
 		return nil, err
 	}
 	url := e.apiBaseURL + "/images/generations"
-	if len(opts.Size) == 0 {
-		opts.Size = SizeSmall
-	}
-	if len(opts.ResponseFormat) == 0 {
-		opts.ResponseFormat = ResponseFormatUrl
-	}
+	ctx = withRequestInfo(ctx, "/images/generations", "")
+	opts = opts.withDefaults()
 	r, err := marshalJson(opts)
 	if err != nil {
 		return nil, err
@@ -106,6 +114,21 @@ type ImageEditOptions struct {
 	ResponseFormat string `binding:"omitempty,oneof=url b64_json"`
 }
 
+// withDefaults returns the copy of opts with the default number of images, size and response format set.
+func (opts *ImageEditOptions) withDefaults() *ImageEditOptions {
+	out := *opts
+	if out.N == 0 {
+		out.N = 1
+	}
+	if len(out.Size) == 0 {
+		out.Size = SizeSmall
+	}
+	if len(out.ResponseFormat) == 0 {
+		out.ResponseFormat = ResponseFormatUrl
+	}
+	return &out
+}
+
 type ImageEditResponse struct {
 	Created int `json:"created"`
 	Data    []struct {
@@ -117,19 +140,12 @@ type ImageEditResponse struct {
 //
 // Docs: https://beta.openai.com/docs/api-reference/images/create-edit
 func (e *Engine) ImageEdit(ctx context.Context, opts *ImageEditOptions) (*ImageEditResponse, error) {
-	if err := e.validate.StructCtx(ctx, opts); err != nil {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
 		return nil, err
 	}
 	uri := e.apiBaseURL + "/images/edits"
-	if opts.N == 0 {
-		opts.N = 1
-	}
-	if len(opts.Size) == 0 {
-		opts.Size = SizeSmall
-	}
-	if len(opts.ResponseFormat) == 0 {
-		opts.ResponseFormat = ResponseFormatUrl
-	}
+	ctx = withRequestInfo(ctx, "/images/edits", "")
+	opts = opts.withDefaults()
 	postValues := url.Values{
 		"image":           []string{opts.Image},
 		"mask":            []string{opts.Mask},
@@ -168,6 +184,21 @@ type ImageVariationOptions struct {
 	ResponseFormat string `binding:"omitempty,oneof=url b64_json"`
 }
 
+// withDefaults returns the copy of opts with the default number of images, size and response format set.
+func (opts *ImageVariationOptions) withDefaults() *ImageVariationOptions {
+	out := *opts
+	if out.N == 0 {
+		out.N = 1
+	}
+	if len(out.Size) == 0 {
+		out.Size = SizeSmall
+	}
+	if len(out.ResponseFormat) == 0 {
+		out.ResponseFormat = ResponseFormatUrl
+	}
+	return &out
+}
+
 type ImageVariationResponse struct {
 	Created int `json:"created"`
 	Data    []struct {
@@ -179,19 +210,12 @@ type ImageVariationResponse struct {
 //
 // Docs: https://beta.openai.com/docs/api-reference/images/create-variation
 func (e *Engine) ImageVariation(ctx context.Context, opts *ImageVariationOptions) (*ImageCreateResponse, error) {
-	if err := e.validate.StructCtx(ctx, opts); err != nil {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
 		return nil, err
 	}
 	uri := e.apiBaseURL + "/images/variations"
-	if opts.N == 0 {
-		opts.N = 1
-	}
-	if len(opts.Size) == 0 {
-		opts.Size = SizeSmall
-	}
-	if len(opts.ResponseFormat) == 0 {
-		opts.ResponseFormat = ResponseFormatUrl
-	}
+	ctx = withRequestInfo(ctx, "/images/variations", "")
+	opts = opts.withDefaults()
 	postValues := url.Values{
 		"model":           []string{opts.Image},
 		"n":               []string{strconv.Itoa(opts.N)},
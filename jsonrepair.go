@@ -0,0 +1,98 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrIrrepairable is returned by RepairJSON if the JSON can't be repaired by its fixups.
+var ErrIrrepairable = errors.New("openai: JSON can't be repaired")
+
+// RepairJSON is used to repair the nearly valid JSON object or array generated by the model,
+// e.g. cut off at max_tokens. It strips the text before and after the JSON value, such as
+// the code fences, removes the trailing commas before the closing braces and brackets,
+// and closes the unterminated string and the unclosed objects and arrays. The valid JSON
+// is returned as is, apart from the stripped text.
+//
+// It returns the error matching ErrIrrepairable if the result still isn't valid JSON,
+// e.g. if the value is cut off in the middle of the number or the key.
+func RepairJSON(raw string) (string, error) {
+	start := strings.IndexAny(raw, "{[")
+	if start < 0 {
+		return "", fmt.Errorf("%w: no JSON object or array", ErrIrrepairable)
+	}
+	var (
+		out      = make([]byte, 0, len(raw)-start+8)
+		stack    []byte
+		inString bool
+		escaped  bool
+	)
+	for i := start; i < len(raw) && (len(stack) > 0 || i == start); i++ {
+		c := raw[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			out = append(out, c)
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			stack = append(stack, c)
+		case '}', ']':
+			open := stack[len(stack)-1]
+			if open == '{' && c != '}' || open == '[' && c != ']' {
+				return "", fmt.Errorf("%w: mismatched %q at offset %d", ErrIrrepairable, c, i)
+			}
+			stack = stack[:len(stack)-1]
+			out = trimTrailingComma(out)
+		}
+		out = append(out, c)
+	}
+
+	if inString {
+		if escaped {
+			out = out[:len(out)-1] // the escape is cut off
+		}
+		out = append(out, '"')
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		out = trimTrailingComma(out)
+		if trimmed := bytes.TrimRight(out, " \t\r\n"); bytes.HasSuffix(trimmed, []byte(":")) {
+			out = append(trimmed, "null"...) // the value is cut off
+		}
+		if stack[i] == '{' {
+			out = append(out, '}')
+		} else {
+			out = append(out, ']')
+		}
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(out, &v); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrIrrepairable, err)
+	}
+	return string(out), nil
+}
+
+// trimTrailingComma removes the comma at the end of out, and the whitespace after it, if any.
+func trimTrailingComma(out []byte) []byte {
+	trimmed := bytes.TrimRight(out, " \t\r\n")
+	if !bytes.HasSuffix(trimmed, []byte(",")) {
+		return out
+	}
+	return trimmed[:len(trimmed)-1]
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepairJSON(t *testing.T) {
+	for _, tt := range []struct {
+		name, raw, want string
+	}{
+		{name: "valid", raw: `{"a":[1,2,{"b":"}"}]}`, want: `{"a":[1,2,{"b":"}"}]}`},
+		{name: "missing closing brace", raw: `{"city":"Berlin","unit":"celsius"`, want: `{"city":"Berlin","unit":"celsius"}`},
+		{name: "missing closing brackets", raw: `{"items":[{"name":"a"},{"name":"b"`, want: `{"items":[{"name":"a"},{"name":"b"}]}`},
+		{name: "trailing commas", raw: `{"items":[1,2,],"ok":true,}`, want: `{"items":[1,2],"ok":true}`},
+		{name: "trailing comma at cutoff", raw: "[1,\n  2,\n  ", want: "[1,\n  2]"},
+		{name: "unterminated string", raw: `{"text":"Once upon a`, want: `{"text":"Once upon a"}`},
+		{name: "unterminated escape", raw: `{"text":"say \`, want: `{"text":"say "}`},
+		{name: "cut off value", raw: `{"city":"Berlin","unit":`, want: `{"city":"Berlin","unit":null}`},
+		{name: "surrounding text", raw: "Here you go:\n```json\n{\"city\":\"Berlin\"}\n```\nAnything else?", want: `{"city":"Berlin"}`},
+		{name: "array", raw: `Result: ["a", "b"`, want: `["a", "b"]`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			repaired, err := RepairJSON(tt.raw)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, repaired)
+		})
+	}
+
+	for _, raw := range []string{
+		"",
+		"no JSON here",
+		`{"a":[1}`,
+		`{"city":"Berlin","un`,
+		`{"count":tru`,
+		`{"a" "b"}`,
+	} {
+		_, err := RepairJSON(raw)
+		assert.True(t, errors.Is(err, ErrIrrepairable), "%q: unexpected error: %v", raw, err)
+	}
+}
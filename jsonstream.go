@@ -0,0 +1,164 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+)
+
+// JSONStreamAccumulator accumulates fragments of a JSON value streamed by the model,
+// e.g. content deltas of a structured output, and reports when the value is complete.
+type JSONStreamAccumulator struct {
+	buf      bytes.Buffer
+	stack    []byte // expected closing brackets of open containers
+	inString bool
+	escaped  bool
+	opened   int
+	closed   int
+}
+
+// Write appends delta to the accumulated content.
+// It returns an error if delta closes a container which wasn't opened.
+func (a *JSONStreamAccumulator) Write(delta string) error {
+	for i := 0; i < len(delta); i++ {
+		c := delta[i]
+		if a.inString {
+			switch {
+			case a.escaped:
+				a.escaped = false
+			case c == '\\':
+				a.escaped = true
+			case c == '"':
+				a.inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			a.inString = true
+		case '{':
+			a.stack = append(a.stack, '}')
+			a.opened++
+		case '[':
+			a.stack = append(a.stack, ']')
+			a.opened++
+		case '}', ']':
+			if len(a.stack) == 0 || a.stack[len(a.stack)-1] != c {
+				a.buf.WriteString(delta[:i])
+				return fmt.Errorf("unexpected %q at offset %d", c, a.buf.Len())
+			}
+			a.stack = a.stack[:len(a.stack)-1]
+			a.closed++
+		}
+	}
+	a.buf.WriteString(delta)
+	return nil
+}
+
+// Result returns the accumulated content and true if it is a complete valid JSON value.
+func (a *JSONStreamAccumulator) Result() (json.RawMessage, bool) {
+	if !a.IsComplete() {
+		return nil, false
+	}
+	return json.RawMessage(bytes.TrimSpace(a.buf.Bytes())), true
+}
+
+// IsComplete reports whether the accumulated content is a complete valid JSON value.
+func (a *JSONStreamAccumulator) IsComplete() bool {
+	return len(a.stack) == 0 && !a.inString && json.Valid(a.buf.Bytes())
+}
+
+// Progress returns estimated completion of the value between 0 and 1,
+// based on the number of closed objects and arrays against the opened ones.
+// It returns 1 only when the value is complete.
+func (a *JSONStreamAccumulator) Progress() float64 {
+	if a.IsComplete() {
+		return 1
+	}
+	if a.opened == 0 {
+		return 0
+	}
+	p := float64(a.closed) / float64(a.opened)
+	if p >= 1 {
+		// All containers are closed, but the value isn't valid yet.
+		p = 0.99
+	}
+	return p
+}
+
+// StreamJSONArray yields elements of the JSON array streamed as the content of the first choice
+// of stream, each one as soon as it's complete. The content is parsed by encoding/json as it
+// arrives, so strings and nested values of elements may contain any brackets.
+//
+// The sequence ends with an error if the content isn't an array, the array isn't closed before
+// the stream ends, or an element can't be unmarshaled into T. The stream isn't closed.
+func StreamJSONArray[T any](stream *ChatCompletionStream) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		r := &chatContentReader{stream: stream}
+		dec := json.NewDecoder(r)
+		tok, err := dec.Token()
+		if err != nil {
+			yield(zero, r.arrayError(err))
+			return
+		}
+		if tok != json.Delim('[') {
+			yield(zero, fmt.Errorf("expected JSON array, got %v", tok))
+			return
+		}
+		for dec.More() {
+			var v T
+			if err := dec.Decode(&v); err != nil {
+				yield(zero, r.arrayError(err))
+				return
+			}
+			if !yield(v, nil) {
+				return
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			yield(zero, r.arrayError(err))
+		}
+	}
+}
+
+// chatContentReader reads the content of the first choice of the chat completion stream.
+type chatContentReader struct {
+	stream *ChatCompletionStream
+	buf    []byte
+	eof    bool
+}
+
+// arrayError reports the decoding error caused by the end of the stream in the middle
+// of the array as unexpected.
+func (r *chatContentReader) arrayError(err error) error {
+	var syntaxErr *json.SyntaxError
+	if err == io.EOF || r.eof && errors.As(err, &syntaxErr) {
+		return fmt.Errorf("JSON array isn't closed: %w", io.ErrUnexpectedEOF)
+	}
+	return err
+}
+
+func (r *chatContentReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		chunk, err := r.stream.Recv()
+		if err != nil {
+			r.eof = err == io.EOF
+			return 0, err
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Index == 0 {
+				r.buf = append(r.buf, choice.Delta.Content...)
+			}
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONStreamAccumulator(t *testing.T) {
+	deltas := []string{`{"name":`, `"a}]\"b",`, ` "tags":[`, `"x","y"]`, `,"n":{"v":1}`, `}`}
+	var a JSONStreamAccumulator
+	var last float64
+	for i, d := range deltas {
+		require.NoError(t, a.Write(d))
+		p := a.Progress()
+		assert.GreaterOrEqual(t, p, last, "progress must not decrease")
+		last = p
+		if i < len(deltas)-1 {
+			assert.False(t, a.IsComplete())
+			_, ok := a.Result()
+			assert.False(t, ok)
+		}
+	}
+	assert.True(t, a.IsComplete())
+	assert.Equal(t, 1.0, a.Progress())
+	r, ok := a.Result()
+	require.True(t, ok)
+	assert.JSONEq(t, `{"name":"a}]\"b","tags":["x","y"],"n":{"v":1}}`, string(r))
+}
+
+func TestJSONStreamAccumulatorScalar(t *testing.T) {
+	var a JSONStreamAccumulator
+	require.NoError(t, a.Write(`"unfinished`))
+	assert.False(t, a.IsComplete())
+	require.NoError(t, a.Write(` string"`))
+	r, ok := a.Result()
+	require.True(t, ok)
+	assert.Equal(t, `"unfinished string"`, string(r))
+}
+
+func TestJSONStreamAccumulatorMismatch(t *testing.T) {
+	var a JSONStreamAccumulator
+	require.NoError(t, a.Write(`{"a":[1,2`))
+	assert.Error(t, a.Write(`}`))
+	assert.False(t, a.IsComplete())
+}
+
+// newChatStreamServer streams the deltas as content of the chat completion. If wait isn't nil,
+// the delta at index wait.after is followed by waiting until wait.ch is closed.
+func newChatStreamServer(t *testing.T, deltas []string, wait *streamWait) *Engine {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, true, body["stream"])
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i, delta := range deltas {
+			b, _ := json.Marshal(ChatCompletionStreamResponse{Id: "chatcmpl-1", Choices: []ChatCompletionStreamChoice{{Delta: ChatMessageDelta{Content: delta}}}})
+			fmt.Fprintf(w, "data: %s\n\n", b)
+			w.(http.Flusher).Flush()
+			if wait != nil && wait.after == i {
+				select {
+				case <-wait.ch:
+				case <-time.After(time.Second):
+					t.Error("element wasn't yielded before the rest of the stream arrived")
+				}
+			}
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	return e
+}
+
+type streamWait struct {
+	after int
+	ch    chan struct{}
+}
+
+type question struct {
+	Q    string        `json:"q"`
+	Tags []interface{} `json:"tags,omitempty"`
+}
+
+func collectJSONArray[T any](t *testing.T, e *Engine) ([]T, error) {
+	s, err := e.ChatCompletionStream(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	defer s.Close()
+	var items []T
+	for item, err := range StreamJSONArray[T](s) {
+		if err != nil {
+			return items, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func TestStreamJSONArray(t *testing.T) {
+	content := ` [{"q":"a}]\"b","tags":["x",{"y":[1,"]"]}]}, {"q":"two"},{"q":"three}]"}] `
+	want := []question{
+		{Q: `a}]"b`, Tags: []interface{}{"x", map[string]interface{}{"y": []interface{}{float64(1), "]"}}}},
+		{Q: "two"},
+		{Q: "three}]"},
+	}
+	splits := [][]string{strings.Split(content, "")}
+	for i := 1; i < len(content); i++ {
+		splits = append(splits, []string{content[:i], content[i:]})
+	}
+	for _, deltas := range splits {
+		items, err := collectJSONArray[question](t, newChatStreamServer(t, deltas, nil))
+		require.NoError(t, err, "%q", deltas)
+		require.Equal(t, want, items, "%q", deltas)
+	}
+}
+
+func TestStreamJSONArrayIncremental(t *testing.T) {
+	wait := &streamWait{after: 1, ch: make(chan struct{})}
+	e := newChatStreamServer(t, []string{`[{"q":"one"`, `},`, `{"q":"two"}]`}, wait)
+	s, err := e.ChatCompletionStream(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	defer s.Close()
+	var n int
+	for item, err := range StreamJSONArray[question](s) {
+		require.NoError(t, err)
+		if n == 0 {
+			assert.Equal(t, "one", item.Q)
+			close(wait.ch)
+		}
+		n++
+	}
+	assert.Equal(t, 2, n)
+}
+
+func TestStreamJSONArrayErrors(t *testing.T) {
+	items, err := collectJSONArray[question](t, newChatStreamServer(t, []string{`[{"q":"one"},`, `{"q":"tw`}, nil))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF, "the array isn't closed")
+	assert.Equal(t, []question{{Q: "one"}}, items)
+
+	_, err = collectJSONArray[question](t, newChatStreamServer(t, []string{`[{"q":"one"}`}, nil))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	items, err = collectJSONArray[question](t, newChatStreamServer(t, []string{`[{"q":"one"},{"q":2}]`}, nil))
+	var typeErr *json.UnmarshalTypeError
+	assert.ErrorAs(t, err, &typeErr)
+	assert.Len(t, items, 1)
+
+	_, err = collectJSONArray[question](t, newChatStreamServer(t, []string{`{"q":"one"}`}, nil))
+	assert.ErrorContains(t, err, "expected JSON array")
+}
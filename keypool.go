@@ -0,0 +1,222 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultKeyCooldown is the cooldown of the rate limited key if the response has no Retry-After header.
+	defaultKeyCooldown = time.Second
+	// unauthorizedKeyCooldown is the cooldown of the key rejected with 401, e.g. revoked or expired.
+	unauthorizedKeyCooldown = 5 * time.Minute
+)
+
+// CredentialProvider is used to obtain the bearer token of the request,
+// e.g. the Azure AD token which has to be refreshed before it expires.
+type CredentialProvider interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticCredential is an API key which never changes.
+type StaticCredential string
+
+// Token returns the API key.
+func (c StaticCredential) Token(context.Context) (string, error) {
+	return string(c), nil
+}
+
+// KeySelection is the strategy used to select the key of the next request from the pool.
+type KeySelection int
+
+const (
+	// KeySelectionRoundRobin selects keys in turn.
+	KeySelectionRoundRobin KeySelection = iota
+	// KeySelectionLeastRateLimited selects the key which was rate limited least recently,
+	// keys which were never rate limited are selected in turn.
+	KeySelectionLeastRateLimited
+)
+
+// KeyStats is the observability snapshot of a key in the pool.
+type KeyStats struct {
+	// Index of the key in the pool.
+	Index int
+	// Number of requests sent with the key.
+	Requests int64
+	// Number of requests rejected with 429.
+	RateLimited int64
+	// Number of requests rejected with 401.
+	Unauthorized int64
+	// Time left until the key is selected again, zero if the key is available.
+	Cooldown time.Duration
+}
+
+// KeyPool spreads requests of a single engine across multiple credentials.
+//
+// Keys in cooldown are skipped by the selection. A key cools down for the duration of
+// Retry-After when it's rate limited, or for 5 minutes when it's rejected with 401.
+// If all keys cool down, the one which gets available first is selected.
+type KeyPool struct {
+	mu        sync.Mutex
+	keys      []*poolKey
+	selection KeySelection
+	next      int
+	clock     Clock
+}
+
+type poolKey struct {
+	index           int
+	credential      CredentialProvider
+	requests        int64
+	rateLimited     int64
+	unauthorized    int64
+	lastRateLimited time.Time
+	cooldownUntil   time.Time
+}
+
+// NewKeyPool is used to initialize pool of API keys.
+func NewKeyPool(apiKeys ...string) *KeyPool {
+	credentials := make([]CredentialProvider, len(apiKeys))
+	for i, apiKey := range apiKeys {
+		credentials[i] = StaticCredential(apiKey)
+	}
+	return NewCredentialPool(credentials...)
+}
+
+// NewCredentialPool is used to initialize pool of credentials, which may mix API keys and token providers.
+func NewCredentialPool(credentials ...CredentialProvider) *KeyPool {
+	p := &KeyPool{}
+	for i, credential := range credentials {
+		p.keys = append(p.keys, &poolKey{index: i, credential: credential})
+	}
+	return p
+}
+
+// WithKeyPool is used to send requests with credentials of the pool instead of the engine API key.
+//
+// With retries enabled, the request rejected with 429 or 401 is retried right away with the
+// next available key. Failover attempts count towards the retry budget set by SetMaxRetries.
+func WithKeyPool(pool *KeyPool) EngineOption {
+	return func(e *Engine) {
+		e.keys = pool
+	}
+}
+
+// SetSelection is used to set the strategy of the key selection, KeySelectionRoundRobin by default.
+func (p *KeyPool) SetSelection(selection KeySelection) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.selection = selection
+}
+
+// SetClock is used to set the clock of the cooldowns, the clock of the engine
+// is used if it's not set.
+func (p *KeyPool) SetClock(clock Clock) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clock = clock
+}
+
+// Stats returns the snapshot of counters of every key, in the order of the pool.
+func (p *KeyPool) Stats() []KeyStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := clockOrSystem(p.clock).Now()
+	stats := make([]KeyStats, len(p.keys))
+	for i, k := range p.keys {
+		stats[i] = KeyStats{
+			Index:        k.index,
+			Requests:     k.requests,
+			RateLimited:  k.rateLimited,
+			Unauthorized: k.unauthorized,
+		}
+		if k.cooldownUntil.After(now) {
+			stats[i].Cooldown = k.cooldownUntil.Sub(now)
+		}
+	}
+	return stats
+}
+
+// acquire selects the key of the next attempt and returns its token.
+func (p *KeyPool) acquire(ctx context.Context) (*poolKey, string, error) {
+	p.mu.Lock()
+	if len(p.keys) == 0 {
+		p.mu.Unlock()
+		return nil, "", errors.New("key pool is empty")
+	}
+	k := p.selectKey()
+	k.requests++
+	p.mu.Unlock()
+	token, err := k.credential.Token(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	return k, token, nil
+}
+
+func (p *KeyPool) selectKey() *poolKey {
+	now := clockOrSystem(p.clock).Now()
+	var selected, soonest *poolKey
+	for i := range p.keys {
+		k := p.keys[(p.next+i)%len(p.keys)]
+		if k.cooldownUntil.After(now) {
+			if soonest == nil || k.cooldownUntil.Before(soonest.cooldownUntil) {
+				soonest = k
+			}
+			continue
+		}
+		if selected == nil {
+			selected = k
+			if p.selection == KeySelectionRoundRobin {
+				break
+			}
+			continue
+		}
+		if k.lastRateLimited.Before(selected.lastRateLimited) {
+			selected = k
+		}
+	}
+	if selected == nil {
+		selected = soonest
+	}
+	p.next = (selected.index + 1) % len(p.keys)
+	return selected
+}
+
+// report records the outcome of the attempt sent with k. It reports whether
+// the key was rejected and another key is available to fail over to.
+func (p *KeyPool) report(k *poolKey, resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := clockOrSystem(p.clock).Now()
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		k.rateLimited++
+		k.lastRateLimited = now
+		cooldown, ok := retryAfter(resp)
+		if !ok {
+			cooldown = defaultKeyCooldown
+		}
+		k.cooldownUntil = now.Add(cooldown)
+	case http.StatusUnauthorized:
+		k.unauthorized++
+		k.cooldownUntil = now.Add(unauthorizedKeyCooldown)
+	default:
+		return false
+	}
+	for _, other := range p.keys {
+		if other != k && !other.cooldownUntil.After(now) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newKeyPoolServer returns the server which responds with status of the key, 200 by default,
+// and counts requests per key.
+func newKeyPoolServer(t *testing.T, statuses map[string]int) (*httptest.Server, func(key string) int) {
+	var (
+		mu     sync.Mutex
+		counts = make(map[string]int)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		mu.Lock()
+		counts[key]++
+		mu.Unlock()
+		if status, ok := statuses[key]; ok {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":{"message":"rejected","type":"requests"}}`))
+			return
+		}
+		w.Write([]byte(`{"data":[{"id":"gpt-4o"}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func(key string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return counts[key]
+	}
+}
+
+func TestKeyPoolFailover(t *testing.T) {
+	srv, count := newKeyPoolServer(t, map[string]int{"key-a": http.StatusTooManyRequests})
+	pool := NewKeyPool("key-a", "key-b", "key-c")
+	e := New("unused", WithKeyPool(pool))
+	e.apiBaseURL = srv.URL
+	e.clock = newAutoClock()
+	e.SetMaxRetries(1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := e.ListModels(context.Background())
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	limited := count("key-a")
+	require.NotZero(t, limited)
+
+	// key-a cools down for the duration of Retry-After, so the traffic shifts to the other keys
+	for i := 0; i < 10; i++ {
+		_, err := e.ListModels(context.Background())
+		require.NoError(t, err)
+	}
+	assert.Equal(t, limited, count("key-a"))
+	assert.Equal(t, 50+10, count("key-b")+count("key-c"))
+	assert.InDelta(t, count("key-b"), count("key-c"), 1, "keys without cooldown are selected in turn")
+
+	stats := pool.Stats()
+	require.Len(t, stats, 3)
+	assert.EqualValues(t, limited, stats[0].Requests)
+	assert.EqualValues(t, limited, stats[0].RateLimited)
+	assert.InDelta(t, time.Minute, stats[0].Cooldown, float64(time.Second))
+	assert.EqualValues(t, count("key-b"), stats[1].Requests)
+	assert.Zero(t, stats[1].RateLimited)
+	assert.Zero(t, stats[1].Cooldown)
+}
+
+func TestKeyPoolUnauthorized(t *testing.T) {
+	srv, count := newKeyPoolServer(t, map[string]int{"revoked": http.StatusUnauthorized})
+	var tokens int
+	pool := NewCredentialPool(StaticCredential("revoked"), credentialFunc(func(context.Context) (string, error) {
+		tokens++
+		return "azure-ad-token", nil
+	}))
+	e := New("unused", WithKeyPool(pool))
+	e.apiBaseURL = srv.URL
+	e.SetMaxRetries(1)
+
+	_, err := e.ListModels(context.Background())
+	require.NoError(t, err)
+	_, err = e.ListModels(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, count("revoked"))
+	assert.Equal(t, 2, count("azure-ad-token"))
+	assert.Equal(t, 2, tokens)
+	assert.EqualValues(t, 1, pool.Stats()[0].Unauthorized)
+}
+
+func TestKeyPoolWithoutRetries(t *testing.T) {
+	srv, _ := newKeyPoolServer(t, map[string]int{"key-a": http.StatusTooManyRequests})
+	e := New("unused", WithKeyPool(NewKeyPool("key-a", "key-b")))
+	e.apiBaseURL = srv.URL
+
+	_, err := e.ListModels(context.Background())
+	var apiErr APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.Err.StatusCode)
+	_, err = e.ListModels(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestKeyPoolLeastRateLimited(t *testing.T) {
+	clock := NewTestClock(time.Unix(1700000000, 0))
+	pool := NewKeyPool("a", "b", "c")
+	pool.SetClock(clock)
+	pool.SetSelection(KeySelectionLeastRateLimited)
+	rateLimited := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"1"}}}
+
+	acquire := func() string {
+		_, token, err := pool.acquire(context.Background())
+		require.NoError(t, err)
+		return token
+	}
+	k, _, err := pool.acquire(context.Background())
+	require.NoError(t, err)
+	assert.True(t, pool.report(k, rateLimited))
+	clock.Advance(time.Second)
+	k, _, err = pool.acquire(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, k.index)
+	assert.True(t, pool.report(k, rateLimited))
+	clock.Advance(time.Second)
+
+	// c was never rate limited, then a was rate limited before b
+	assert.Equal(t, "c", acquire())
+	assert.Equal(t, "c", acquire())
+	pool.SetSelection(KeySelectionRoundRobin)
+	assert.Equal(t, "a", acquire())
+	assert.Equal(t, "b", acquire())
+}
+
+func TestKeyPoolAllCoolingDown(t *testing.T) {
+	clock := NewTestClock(time.Unix(1700000000, 0))
+	pool := NewKeyPool("a", "b")
+	pool.SetClock(clock)
+	a, _, _ := pool.acquire(context.Background())
+	b, _, _ := pool.acquire(context.Background())
+	assert.True(t, pool.report(a, &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"30"}}}))
+	assert.False(t, pool.report(b, &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"10"}}}))
+
+	k, _, err := pool.acquire(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, b, k, "the key available first is selected")
+}
+
+type credentialFunc func(ctx context.Context) (string, error)
+
+func (f credentialFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+// MessageDelta is the part of the message streamed by the run, the "thread.message.delta" event.
+//
+// Docs: https://platform.openai.com/docs/api-reference/assistants-streaming/message-delta-object
+type MessageDelta struct {
+	Id     string             `json:"id"`
+	Object string             `json:"object"`
+	Delta  ThreadMessageDelta `json:"delta"`
+}
+
+type ThreadMessageDelta struct {
+	Role    string                `json:"role,omitempty"`
+	Content []MessageContentDelta `json:"content,omitempty"`
+}
+
+// MessageContentDelta is the part of the content of the message at Index.
+type MessageContentDelta struct {
+	Index int `json:"index"`
+	// Type of the content, e.g. "text" or "image_file".
+	Type      string                  `json:"type"`
+	Text      *TextDelta              `json:"text,omitempty"`
+	ImageFile *ThreadMessageImageFile `json:"image_file,omitempty"`
+}
+
+// TextDelta is the part of the text appended to the content, and the annotations of the text.
+type TextDelta struct {
+	Value       string            `json:"value,omitempty"`
+	Annotations []AnnotationDelta `json:"annotations,omitempty"`
+}
+
+// AnnotationDelta is the annotation of the text at Index of the annotations of the content.
+type AnnotationDelta struct {
+	Index int `json:"index"`
+	Annotation
+}
+
+// TextDeltaMerger merges the deltas of the streamed message into the message, e.g. to render
+// the message as it's generated. The zero value is ready to use.
+type TextDeltaMerger struct {
+	msg ThreadMessage
+}
+
+// NewTextDeltaMerger returns the merger of the deltas of msg, e.g. the message of the
+// "thread.message.created" event. msg isn't modified.
+func NewTextDeltaMerger(msg *ThreadMessage) *TextDeltaMerger {
+	m := &TextDeltaMerger{msg: *msg}
+	m.msg.Content = make([]ThreadMessageContent, len(msg.Content))
+	for i, c := range msg.Content {
+		m.msg.Content[i] = cloneMessageContent(c)
+	}
+	return m
+}
+
+func cloneMessageContent(c ThreadMessageContent) ThreadMessageContent {
+	if c.Text != nil {
+		text := *c.Text
+		text.Annotations = append([]Annotation(nil), text.Annotations...)
+		c.Text = &text
+	}
+	if c.ImageFile != nil {
+		image := *c.ImageFile
+		c.ImageFile = &image
+	}
+	return c
+}
+
+// Apply merges delta into the message and returns it. The deltas must be applied in the order
+// they are streamed. The text is appended to the content at the index of the delta, the annotations
+// replace the fields of the ones at their indexes, and the image files are set, the contents and
+// the annotations are added as needed. The returned message is updated in place by the next calls.
+func (m *TextDeltaMerger) Apply(delta *MessageDelta) *ThreadMessage {
+	if m.msg.Id == "" {
+		m.msg.Id = delta.Id
+	}
+	if delta.Delta.Role != "" {
+		m.msg.Role = delta.Delta.Role
+	}
+	for _, d := range delta.Delta.Content {
+		if d.Index < 0 {
+			continue
+		}
+		for len(m.msg.Content) <= d.Index {
+			m.msg.Content = append(m.msg.Content, ThreadMessageContent{})
+		}
+		c := &m.msg.Content[d.Index]
+		if d.Type != "" {
+			c.Type = d.Type
+		}
+		if d.ImageFile != nil {
+			image := *d.ImageFile
+			c.ImageFile = &image
+		}
+		if d.Text == nil {
+			continue
+		}
+		if c.Text == nil {
+			c.Text = &ThreadMessageText{}
+		}
+		c.Text.Value += d.Text.Value
+		for _, a := range d.Text.Annotations {
+			if a.Index < 0 {
+				continue
+			}
+			for len(c.Text.Annotations) <= a.Index {
+				c.Text.Annotations = append(c.Text.Annotations, Annotation{})
+			}
+			mergeAnnotation(&c.Text.Annotations[a.Index], a.Annotation)
+		}
+	}
+	return &m.msg
+}
+
+// mergeAnnotation sets the fields of dst to the ones set in src.
+func mergeAnnotation(dst *Annotation, src Annotation) {
+	if src.Type != "" {
+		dst.Type = src.Type
+	}
+	if src.Text != "" {
+		dst.Text = src.Text
+	}
+	if src.StartIndex != 0 || src.EndIndex != 0 {
+		dst.StartIndex, dst.EndIndex = src.StartIndex, src.EndIndex
+	}
+	if src.FileCitation != nil {
+		dst.FileCitation = src.FileCitation
+	}
+	if src.FilePath != nil {
+		dst.FilePath = src.FilePath
+	}
+	if src.URLCitation != nil {
+		dst.URLCitation = src.URLCitation
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/0x9ef/openai-go/sse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTextDeltaMerger(t *testing.T) {
+	f, err := os.Open("testdata/assistants/message_stream.sse")
+	require.NoError(t, err)
+	defer f.Close()
+
+	var (
+		merger    *TextDeltaMerger
+		merged    *ThreadMessage
+		completed ThreadMessage
+		texts     []string
+	)
+	s := sse.NewScanner(f)
+	for s.Scan() {
+		event := s.Event()
+		switch event.Type {
+		case "thread.message.created":
+			var msg ThreadMessage
+			require.NoError(t, json.Unmarshal(event.Data, &msg))
+			merger = NewTextDeltaMerger(&msg)
+		case "thread.message.delta":
+			var delta MessageDelta
+			require.NoError(t, json.Unmarshal(event.Data, &delta))
+			merged = merger.Apply(&delta)
+			texts = append(texts, merged.Content[0].Text.Value)
+		case "thread.message.completed":
+			require.NoError(t, json.Unmarshal(event.Data, &completed))
+		}
+	}
+	require.NoError(t, s.Err())
+
+	assert.Equal(t, []string{"The revenue", "The revenue grew", "The revenue grew【4:0†source】", "The revenue grew【4:0†source】",
+		"The revenue grew【4:0†source】. See the chart"}, texts[:5], "the message is up to date after every delta")
+	want, err := json.Marshal(completed)
+	require.NoError(t, err)
+	got, err := json.Marshal(merged)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(want), string(got), "the merged message is the completed one")
+	assert.Equal(t, "file-report", merged.Annotations()[0].FileCitation.FileId)
+}
+
+func TestTextDeltaMergerAnnotations(t *testing.T) {
+	var m TextDeltaMerger
+	m.Apply(&MessageDelta{Id: "msg_1", Delta: ThreadMessageDelta{Role: "assistant", Content: []MessageContentDelta{
+		{Index: 1, Type: "text", Text: &TextDelta{Value: "B", Annotations: []AnnotationDelta{
+			{Index: 1, Annotation: Annotation{Type: AnnotationFilePath, Text: "b", StartIndex: 0, EndIndex: 1}}}}},
+	}}})
+	msg := m.Apply(&MessageDelta{Id: "msg_1", Delta: ThreadMessageDelta{Content: []MessageContentDelta{
+		{Index: 1, Text: &TextDelta{Annotations: []AnnotationDelta{
+			{Index: 1, Annotation: Annotation{FilePath: &FilePath{FileId: "file-b"}}},
+			{Index: 0, Annotation: Annotation{Type: AnnotationFileCitation, Text: "a", StartIndex: 2, EndIndex: 3}}}}},
+		{Index: 0, Type: "text", Text: &TextDelta{Value: "A"}},
+	}}})
+
+	assert.Equal(t, "msg_1", msg.Id)
+	assert.Equal(t, "assistant", msg.Role)
+	require.Len(t, msg.Content, 2, "the contents are added up to the index")
+	assert.Equal(t, "A", msg.Content[0].Text.Value)
+	assert.Equal(t, []Annotation{
+		{Type: AnnotationFileCitation, Text: "a", StartIndex: 2, EndIndex: 3},
+		{Type: AnnotationFilePath, Text: "b", StartIndex: 0, EndIndex: 1, FilePath: &FilePath{FileId: "file-b"}},
+	}, msg.Content[1].Text.Annotations, "the fields of the annotations are merged")
+
+	orig := &ThreadMessage{Id: "msg_2", Content: []ThreadMessageContent{{Type: "text", Text: &ThreadMessageText{Value: "Hi"}}}}
+	NewTextDeltaMerger(orig).Apply(&MessageDelta{Delta: ThreadMessageDelta{Content: []MessageContentDelta{{Index: 0, Text: &TextDelta{Value: "!"}}}}})
+	assert.Equal(t, "Hi", orig.Content[0].Text.Value, "the message of the merger isn't modified")
+}
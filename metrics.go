@@ -0,0 +1,120 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// MetricsCollector collects metrics of the requests sent by engine,
+// it makes possible to plug in any observability backend (Prometheus, Datadog, CloudWatch, etc.).
+//
+// The endpoint is the path of the API endpoint relative to the base URL, e.g. "/chat/completions",
+// path parameters are replaced with placeholders, e.g. "/models/{model}".
+// The model is empty for endpoints which don't take a model.
+type MetricsCollector interface {
+	// RecordRequestDuration is called once per call to the API, including all retries.
+	// The statusCode is zero if no response was received.
+	RecordRequestDuration(endpoint, model string, duration time.Duration, statusCode int)
+	// RecordTokenUsage is called after every successful response which reports token usage.
+	RecordTokenUsage(model string, promptTokens, completionTokens int)
+	// RecordError is called for every failed call to the API. The errorType is the type
+	// of APIError returned by the API, or one of "network", "canceled", "decode".
+	RecordError(endpoint, model, errorType string)
+}
+
+// ConcurrencyCollector may be implemented by MetricsCollector to record the number of requests
+// in flight allowed by the adaptive concurrency of batch helpers, e.g. ChatCompletionBatch.
+type ConcurrencyCollector interface {
+	// RecordConcurrency is called with the initial limit and whenever the limit changes.
+	RecordConcurrency(endpoint string, limit int)
+}
+
+// CachedTokensCollector may be implemented by MetricsCollector to record the number of prompt
+// tokens read from the prompt cache, which makes the effect of the stable prompt prefix measurable.
+type CachedTokensCollector interface {
+	// RecordCachedTokens is called after every successful response which reports cached tokens.
+	RecordCachedTokens(model string, cachedTokens int)
+}
+
+// WithMetrics is used to register collector of request metrics.
+func WithMetrics(collector MetricsCollector) EngineOption {
+	return func(e *Engine) {
+		e.metrics = collector
+	}
+}
+
+type requestInfoKey struct{}
+
+// requestInfo describes the API call a request belongs to.
+type requestInfo struct {
+	endpoint string
+	model    Model
+}
+
+func withRequestInfo(ctx context.Context, endpoint string, model Model) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, requestInfoKey{}, requestInfo{endpoint: endpoint, model: model})
+}
+
+func requestInfoFrom(ctx context.Context) requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(requestInfo)
+	return info
+}
+
+func (e *Engine) recordRequest(req *http.Request, d time.Duration, resp *http.Response, err error) {
+	if e.metrics == nil {
+		return
+	}
+	info := requestInfoFrom(req.Context())
+	var statusCode int
+	if resp != nil {
+		statusCode = resp.StatusCode
+	}
+	e.metrics.RecordRequestDuration(info.endpoint, string(info.model), d, statusCode)
+	if err != nil {
+		e.metrics.RecordError(info.endpoint, string(info.model), errorType(req, resp, err))
+	}
+}
+
+func (e *Engine) recordUsage(model Model, usage Usage) {
+	e.recordCacheStats(model, usage)
+	if e.usageAggregator != nil {
+		e.usageAggregator.Add(model, usage)
+	}
+	if e.metrics == nil {
+		return
+	}
+	e.metrics.RecordTokenUsage(string(model), usage.PromptTokens, usage.CompletionTokens)
+	if c, ok := e.metrics.(CachedTokensCollector); ok && usage.PromptTokensDetails != nil {
+		c.RecordCachedTokens(string(model), usage.PromptTokensDetails.CachedTokens)
+	}
+}
+
+func (e *Engine) recordConcurrency(endpoint string, limit int) {
+	if c, ok := e.metrics.(ConcurrencyCollector); ok {
+		c.RecordConcurrency(endpoint, limit)
+	}
+}
+
+func errorType(req *http.Request, resp *http.Response, err error) string {
+	var apiErr APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.Err.Type != "":
+		return apiErr.Err.Type
+	case errors.As(err, &apiErr):
+		return "api_error"
+	case req.Context().Err() != nil:
+		return "canceled"
+	case resp != nil:
+		// The response was received, but its body couldn't be decoded.
+		return "decode"
+	}
+	return "network"
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordedDuration struct {
+	endpoint, model string
+	statusCode      int
+}
+
+type testCollector struct {
+	durations []recordedDuration
+	usage     [][3]interface{}
+	errors    [][3]string
+}
+
+func (c *testCollector) RecordRequestDuration(endpoint, model string, _ time.Duration, statusCode int) {
+	c.durations = append(c.durations, recordedDuration{endpoint, model, statusCode})
+}
+
+func (c *testCollector) RecordTokenUsage(model string, promptTokens, completionTokens int) {
+	c.usage = append(c.usage, [3]interface{}{model, promptTokens, completionTokens})
+}
+
+func (c *testCollector) RecordError(endpoint, model, errorType string) {
+	c.errors = append(c.errors, [3]string{endpoint, model, errorType})
+}
+
+func TestMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chat/completions":
+			w.Write([]byte(`{"id":"chatcmpl-1","usage":{"prompt_tokens":9,"completion_tokens":3,"total_tokens":12}}`))
+		default:
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"message":"slow down","type":"requests"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	c := &testCollector{}
+	e := New("test", WithMetrics(c))
+	e.apiBaseURL = srv.URL
+
+	_, err := e.ChatCompletion(context.Background(), &ChatCompletionOptions{
+		Model:    ModelGPT4,
+		Messages: []ChatMessage{{Role: "user", Content: "hello"}},
+	})
+	require.NoError(t, err)
+	_, err = e.RetrieveModel(context.Background(), &RetrieveModelOptions{ID: ModelGPT4})
+	require.Error(t, err)
+
+	assert.Equal(t, []recordedDuration{
+		{"/chat/completions", "gpt-4", http.StatusOK},
+		{"/models/{model}", "gpt-4", http.StatusTooManyRequests},
+	}, c.durations)
+	assert.Equal(t, [][3]interface{}{{"gpt-4", 9, 3}}, c.usage)
+	assert.Equal(t, [][3]string{{"/models/{model}", "gpt-4", "requests"}}, c.errors)
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// MockServer is the in-process HTTP server answering the requests of the API, so the application
+// code using Engine can be tested without the network and without the interfaces in place of
+// Engine, see NewEngineForMockServer. It must be closed after use.
+//
+// Every endpoint is answered with the minimal successful response, unless the response is set
+// with SetResponse or SetChatCompletionResponse. The bodies of the requests are checked against
+// the same rules as ValidationOnlyTransport, the requests violating them are answered with
+// 400 Bad Request of the ErrCodeLocalValidation code.
+type MockServer struct {
+	*httptest.Server
+
+	mu             sync.Mutex
+	responses      map[string]cannedResponse
+	chatCompletion func(opts *ChatCompletionOptions) *ChatCompletionResponse
+}
+
+// NewMockServer is used to start the mock server, see MockServer.
+func NewMockServer() *MockServer {
+	s := &MockServer{responses: make(map[string]cannedResponse)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// NewEngineForMockServer is used to initialize the engine which sends its requests to s,
+// configured with opts on top of it.
+func NewEngineForMockServer(s *MockServer, opts ...EngineOption) *Engine {
+	e := New("sk-mock", append([]EngineOption{WithHTTPClient(s.Client())}, opts...)...)
+	e.apiBaseURL = s.URL
+	return e
+}
+
+// SetResponse is used to set the response of the requests of the path, e.g. "/files/file-abc123",
+// instead of the default one, e.g. the error. The body is sent as JSON, unless it starts with
+// "data:", then it's sent as the event stream. It takes precedence over SetChatCompletionResponse.
+func (s *MockServer) SetResponse(path string, statusCode int, body string) {
+	contentType := "application/json"
+	if strings.HasPrefix(body, "data:") {
+		contentType = "text/event-stream"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[path] = cannedResponse{statusCode: statusCode, contentType: contentType, body: body}
+}
+
+// SetChatCompletionResponse is used to answer the chat completion requests with the response
+// returned by fn for the options of the request, or with the default one if it returns nil.
+// The response of the streamed request is sent as the chunk of every choice, followed by the
+// chunk of the usage if ChatStreamOptions.IncludeUsage is set.
+func (s *MockServer) SetChatCompletionResponse(fn func(opts *ChatCompletionOptions) *ChatCompletionResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chatCompletion = fn
+}
+
+func (s *MockServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var doc interface{}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" && len(body) != 0 {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			writeCanned(w, cannedError(fmt.Sprintf("body: invalid JSON: %v", err)))
+			return
+		}
+		for _, rule := range requestRules[r.URL.Path] {
+			if violation := rule.violation(doc); violation != "" {
+				writeCanned(w, cannedError(violation))
+				return
+			}
+		}
+	}
+
+	s.mu.Lock()
+	canned, ok := s.responses[r.URL.Path]
+	chatCompletion := s.chatCompletion
+	s.mu.Unlock()
+	switch {
+	case ok:
+	case r.URL.Path == "/chat/completions" && chatCompletion != nil:
+		canned, err = mockChatCompletion(body, isStreamRequest(doc), chatCompletion)
+		if err != nil {
+			writeCanned(w, cannedError(fmt.Sprintf("body: %v", err)))
+			return
+		}
+	default:
+		canned = defaultCannedResponse(r.URL.Path, doc)
+	}
+	writeCanned(w, canned)
+}
+
+// mockChatCompletion returns the response of fn to the chat completion request of the body.
+func mockChatCompletion(body []byte, stream bool, fn func(opts *ChatCompletionOptions) *ChatCompletionResponse) (cannedResponse, error) {
+	var opts ChatCompletionOptions
+	if err := json.Unmarshal(body, &opts); err != nil {
+		return cannedResponse{}, err
+	}
+	resp := fn(&opts)
+	if resp == nil {
+		var doc interface{}
+		if stream {
+			doc = map[string]interface{}{"stream": true}
+		}
+		return defaultCannedResponse("/chat/completions", doc), nil
+	}
+	if !stream {
+		b, err := json.Marshal(resp)
+		if err != nil {
+			return cannedResponse{}, err
+		}
+		return cannedResponse{statusCode: http.StatusOK, contentType: "application/json", body: string(b)}, nil
+	}
+
+	var events bytes.Buffer
+	writeChunk := func(chunk ChatCompletionStreamResponse) error {
+		chunk.Id, chunk.Object, chunk.Created, chunk.Model = resp.Id, "chat.completion.chunk", resp.Created, resp.Model
+		b, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&events, "data: %s\n\n", b)
+		return nil
+	}
+	for _, choice := range resp.Choices {
+		err := writeChunk(ChatCompletionStreamResponse{Choices: []ChatCompletionStreamChoice{{
+			Delta:        ChatMessageDelta{Role: choice.Message.Role, Content: choice.Message.Content},
+			Index:        choice.Index,
+			FinishReason: choice.FinishReason,
+		}}})
+		if err != nil {
+			return cannedResponse{}, err
+		}
+	}
+	if opts.StreamOptions != nil && opts.StreamOptions.IncludeUsage {
+		usage := resp.Usage
+		if err := writeChunk(ChatCompletionStreamResponse{Choices: []ChatCompletionStreamChoice{}, Usage: &usage}); err != nil {
+			return cannedResponse{}, err
+		}
+	}
+	events.WriteString("data: [DONE]\n\n")
+	return cannedResponse{statusCode: http.StatusOK, contentType: "text/event-stream", body: events.String()}, nil
+}
+
+func writeCanned(w http.ResponseWriter, canned cannedResponse) {
+	w.Header().Set("Content-Type", canned.contentType)
+	w.Header().Set("X-Request-Id", "req_mock")
+	w.WriteHeader(canned.statusCode)
+	io.WriteString(w, canned.body)
+}
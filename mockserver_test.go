@@ -0,0 +1,86 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockServerChatCompletion(t *testing.T) {
+	s := NewMockServer()
+	defer s.Close()
+	e := NewEngineForMockServer(s)
+
+	resp, err := e.ChatCompletion(context.Background(), &ChatCompletionOptions{
+		Model:    "gpt-4o-mini",
+		Messages: []ChatMessage{{Role: "user", Content: "Hello"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Choices, 1, "the default response")
+	assert.Equal(t, "req_mock", resp.RequestId)
+
+	s.SetChatCompletionResponse(func(opts *ChatCompletionOptions) *ChatCompletionResponse {
+		return &ChatCompletionResponse{
+			Id:      "chatcmpl-mock",
+			Model:   opts.Model,
+			Choices: []ChatCompletionChoice{{Message: ChatMessage{Role: "assistant", Content: "echo: " + opts.Messages[0].Content}, FinishReason: "stop"}},
+			Usage:   Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7},
+		}
+	})
+	resp, err = e.ChatCompletion(context.Background(), &ChatCompletionOptions{
+		Model:    "gpt-4o-mini",
+		Messages: []ChatMessage{{Role: "user", Content: "Hello"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "echo: Hello", resp.Choices[0].Message.Content)
+	assert.Equal(t, Model("gpt-4o-mini"), resp.Model)
+	assert.Equal(t, 7, resp.Usage.TotalTokens)
+
+	stream, err := e.ChatCompletionStream(context.Background(), &ChatCompletionOptions{
+		Model:         "gpt-4o-mini",
+		Messages:      []ChatMessage{{Role: "user", Content: "Hi"}},
+		StreamOptions: &ChatStreamOptions{IncludeUsage: true},
+	})
+	require.NoError(t, err)
+	defer stream.Close()
+	chunk, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, ChatMessageDelta{Role: "assistant", Content: "echo: Hi"}, chunk.Choices[0].Delta)
+	assert.Equal(t, "stop", chunk.Choices[0].FinishReason)
+	chunk, err = stream.Recv()
+	require.NoError(t, err)
+	require.NotNil(t, chunk.Usage)
+	assert.Equal(t, 7, chunk.Usage.TotalTokens)
+	_, err = stream.Recv()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestMockServerResponses(t *testing.T) {
+	s := NewMockServer()
+	defer s.Close()
+	e := NewEngineForMockServer(s)
+
+	_, err := e.ListModels(context.Background())
+	require.NoError(t, err, "every endpoint is answered")
+
+	_, err = e.ChatCompletion(context.Background(), &ChatCompletionOptions{
+		Model:    "gpt-4o-mini",
+		Messages: []ChatMessage{{Role: "robot", Content: "Hello"}},
+	})
+	var apiErr APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, ErrCodeLocalValidation, apiErr.Err.Code)
+	assert.Contains(t, apiErr.Err.Message, "messages[0].role")
+
+	s.SetResponse("/models", http.StatusUnauthorized, `{"error":{"message":"Incorrect API key provided","type":"invalid_request_error","code":"invalid_api_key"}}`)
+	_, err = e.ListModels(context.Background())
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
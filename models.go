@@ -5,7 +5,11 @@ package openai
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
 // Generative Pre-trained Transformer (GPT) model.
@@ -77,20 +81,33 @@ const (
 	ModelWhisper Model = "whisper-1"
 )
 
+// ModelObject is the model available to the organization.
+type ModelObject struct {
+	ID      Model  `json:"id"`
+	Object  string `json:"object"`
+	OwnedBy string `json:"owned_by"`
+}
+
 type ListModelsResponse struct {
-	Data []struct {
-		ID      Model  `json:"id"`
-		Object  string `json:"object"`
-		OwnedBy string `json:"owned_by"`
-	} `json:"data"`
+	Data []ModelObject `json:"data"`
+}
+
+type ListModelsOptions struct {
+	// Only return the models of the owner, e.g. "openai" or the ID of the organization for its fine-tuned
+	// models. It's sent as the query parameter, and the models are filtered by it on the client as well.
+	OwnedBy string
+	// FilterByCapability only keeps the models it returns true for, e.g. SupportsFunctionCalling().
+	// It's run on the client, all models are kept if it's nil.
+	FilterByCapability func(*ModelObject) bool
 }
 
 // ListModels lists the currently available models, and provides basic information about
-// each one such as the owner and availability.
+// each one such as the owner and availability. Filter them with ListModelsWithOptions.
 //
 // Docs: https://beta.openai.com/docs/api-reference/models/list
 func (e *Engine) ListModels(ctx context.Context) (*ListModelsResponse, error) {
 	url := e.apiBaseURL + "/models"
+	ctx = withRequestInfo(ctx, "/models", "")
 	req, err := e.newReq(ctx, http.MethodGet, url, "", nil)
 	if err != nil {
 		return nil, err
@@ -106,6 +123,116 @@ func (e *Engine) ListModels(ctx context.Context) (*ListModelsResponse, error) {
 	return &jsonResp, nil
 }
 
+// ListModelsWithOptions is like ListModels, but only returns the models of the owner and of the capability
+// of opts. opts may be nil.
+func (e *Engine) ListModelsWithOptions(ctx context.Context, opts *ListModelsOptions) (*ListModelsResponse, error) {
+	if opts == nil {
+		opts = &ListModelsOptions{}
+	}
+	q := url.Values{}
+	if opts.OwnedBy != "" {
+		q.Set("owned_by", opts.OwnedBy)
+	}
+	uri := withQuery(e.apiBaseURL+"/models", q)
+	ctx = withRequestInfo(ctx, "/models", "")
+	var models ListModelsResponse
+	if err := e.sendJSON(ctx, http.MethodGet, uri, nil, &models); err != nil {
+		return nil, err
+	}
+	filtered := models.Data[:0]
+	for i := range models.Data {
+		m := &models.Data[i]
+		if opts.OwnedBy != "" && m.OwnedBy != opts.OwnedBy {
+			continue
+		}
+		if opts.FilterByCapability != nil && !opts.FilterByCapability(m) {
+			continue
+		}
+		filtered = append(filtered, *m)
+	}
+	models.Data = filtered
+	return &models, nil
+}
+
+// modelCapability is the capabilities of the model: the tools, the images of the messages
+// and the JSON schema response format.
+type modelCapability struct {
+	functionCalling, vision, jsonSchema bool
+}
+
+// modelCapabilities are the capabilities of the models by model prefix. The longest matching prefix applies.
+//
+// Learn more: https://platform.openai.com/docs/models
+var modelCapabilities = map[string]modelCapability{
+	"gpt-3.5-turbo":          {true, false, false},
+	"gpt-3.5-turbo-0301":     {false, false, false},
+	"gpt-3.5-turbo-instruct": {false, false, false},
+	"gpt-4":                  {true, false, false},
+	"gpt-4-0314":             {false, false, false},
+	"gpt-4-32k-0314":         {false, false, false},
+	"gpt-4-turbo":            {true, true, false},
+	"gpt-4-vision-preview":   {false, true, false},
+	"gpt-4o":                 {true, true, true},
+	"gpt-4o-2024-05-13":      {true, true, false},
+	"gpt-4o-audio-preview":   {true, false, true},
+	"gpt-4o-realtime":        {true, false, true},
+	"gpt-4o-transcribe":      {false, false, true},
+	"gpt-4o-mini-audio":      {true, false, true},
+	"gpt-4o-mini-realtime":   {true, false, true},
+	"gpt-4o-mini-transcribe": {false, false, true},
+	"gpt-4o-mini-tts":        {false, false, true},
+	"gpt-4.1":                {true, true, true},
+	"gpt-4.5":                {true, true, true},
+	"gpt-5":                  {true, true, true},
+	"o1":                     {true, true, true},
+	"o1-mini":                {false, false, false},
+	"o1-preview":             {false, false, false},
+	"o3":                     {true, true, true},
+	"o3-mini":                {true, false, true},
+	"o4-mini":                {true, true, true},
+}
+
+// capabilitiesOf returns the capabilities of the model, or of the base model of the fine-tuned one.
+// The unknown models have none.
+func capabilitiesOf(model Model) modelCapability {
+	name := strings.TrimPrefix(string(model), "ft:")
+	var prefix string
+	for p := range modelCapabilities {
+		if strings.HasPrefix(name, p) && len(p) > len(prefix) {
+			prefix = p
+		}
+	}
+	return modelCapabilities[prefix]
+}
+
+// OwnerOpenAI returns the filter of ListModelsOptions which keeps the models of OpenAI,
+// rather than the fine-tuned models of the organization.
+func OwnerOpenAI() func(*ModelObject) bool {
+	return func(m *ModelObject) bool {
+		switch m.OwnedBy {
+		case "openai", "system", "openai-internal":
+			return true
+		}
+		return false
+	}
+}
+
+// SupportsFunctionCalling returns the filter of ListModelsOptions which keeps the chat models
+// supporting the tools, including the fine-tuned ones of such base models.
+func SupportsFunctionCalling() func(*ModelObject) bool {
+	return func(m *ModelObject) bool {
+		return capabilitiesOf(m.ID).functionCalling
+	}
+}
+
+// SupportsVision returns the filter of ListModelsOptions which keeps the chat models supporting
+// the images of the messages, including the fine-tuned ones of such base models.
+func SupportsVision() func(*ModelObject) bool {
+	return func(m *ModelObject) bool {
+		return capabilitiesOf(m.ID).vision
+	}
+}
+
 type RetrieveModelOptions struct {
 	// The ID of the model.
 	ID Model `json:"id" binding:"required"`
@@ -122,10 +249,11 @@ type RetrieveModelResponse struct {
 //
 // Docs: https://beta.openai.com/docs/api-reference/models/retrieve
 func (e *Engine) RetrieveModel(ctx context.Context, opts *RetrieveModelOptions) (*RetrieveModelResponse, error) {
-	if err := e.validate.StructCtx(ctx, opts); err != nil {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
 		return nil, err
 	}
 	url := e.apiBaseURL + "/models/" + string(opts.ID)
+	ctx = withRequestInfo(ctx, "/models/{model}", opts.ID)
 	req, err := e.newReq(ctx, http.MethodGet, url, "", nil)
 	if err != nil {
 		return nil, err
@@ -140,3 +268,28 @@ func (e *Engine) RetrieveModel(ctx context.Context, opts *RetrieveModelOptions)
 	}
 	return &jsonResp, nil
 }
+
+// ErrCannotDeleteBaseModel is returned by DeleteModel for the models which aren't fine-tuned.
+var ErrCannotDeleteBaseModel = errors.New("openai: only fine-tuned models can be deleted")
+
+type DeleteModelOptions struct {
+	// The ID of the fine-tuned model to delete.
+	ID Model `json:"id" binding:"required"`
+}
+
+// DeleteModel deletes a fine-tuned model. You must have the Owner role in your organization to delete a model.
+// The models whose IDs don't start with "ft:" aren't deleted, ErrCannotDeleteBaseModel is returned
+// without the request, so a base model can't be deleted by accident.
+//
+// Docs: https://platform.openai.com/docs/api-reference/models/delete
+func (e *Engine) DeleteModel(ctx context.Context, opts *DeleteModelOptions) (*Deleted, error) {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(string(opts.ID), "ft:") {
+		return nil, fmt.Errorf("%w: %s", ErrCannotDeleteBaseModel, opts.ID)
+	}
+	url := e.apiBaseURL + "/models/" + string(opts.ID)
+	ctx = withRequestInfo(ctx, "/models/{model}", opts.ID)
+	return e.deleteObject(ctx, url)
+}
@@ -7,8 +7,13 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestListModels(t *testing.T) {
@@ -38,3 +43,42 @@ func TestRetrieveModel(t *testing.T) {
 		log.Println(string(b))
 	}
 }
+
+func TestListModelsWithOptions(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/models", r.URL.Path)
+		queries = append(queries, r.URL.RawQuery)
+		w.Write([]byte(`{"object":"list","data":[
+			{"id":"gpt-4o-2024-08-06","object":"model","owned_by":"system"},
+			{"id":"gpt-3.5-turbo-instruct","object":"model","owned_by":"system"},
+			{"id":"o1-mini","object":"model","owned_by":"system"},
+			{"id":"o3-mini","object":"model","owned_by":"system"},
+			{"id":"text-embedding-3-small","object":"model","owned_by":"openai"},
+			{"id":"ft:gpt-4o-mini-2024-07-18:acme::abc","object":"model","owned_by":"org-acme"}]}`))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	ids := func(opts *ListModelsOptions) []Model {
+		t.Helper()
+		r, err := e.ListModelsWithOptions(context.Background(), opts)
+		require.NoError(t, err)
+		var ids []Model
+		for _, m := range r.Data {
+			ids = append(ids, m.ID)
+		}
+		return ids
+	}
+	assert.Len(t, ids(nil), 6)
+	assert.Equal(t, []Model{"ft:gpt-4o-mini-2024-07-18:acme::abc"}, ids(&ListModelsOptions{OwnedBy: "org-acme"}))
+	assert.Equal(t, []Model{"gpt-4o-2024-08-06", "o3-mini", "ft:gpt-4o-mini-2024-07-18:acme::abc"},
+		ids(&ListModelsOptions{FilterByCapability: SupportsFunctionCalling()}))
+	assert.Equal(t, []Model{"gpt-4o-2024-08-06", "ft:gpt-4o-mini-2024-07-18:acme::abc"},
+		ids(&ListModelsOptions{FilterByCapability: SupportsVision()}))
+	assert.Equal(t, []Model{"gpt-4o-2024-08-06", "o3-mini"},
+		ids(&ListModelsOptions{OwnedBy: "system", FilterByCapability: SupportsFunctionCalling()}))
+	assert.Len(t, ids(&ListModelsOptions{FilterByCapability: OwnerOpenAI()}), 5)
+	assert.Equal(t, []string{"", "owned_by=org-acme", "", "", "owned_by=system", ""}, queries)
+}
@@ -7,58 +7,74 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 )
 
 type ModerationResponse struct {
-	Id      string `json:"id"`
-	Model   string `json:"model"`
-	Results []struct {
-		Categories struct {
-			// Content that expresses, incites, or promotes hate based on race, gender, ethnicity,
-			// religion, nationality, sexual orientation, disability status, or caste.
-			Hate bool `json:"hate"`
-			// Hateful content that also includes violence or serious harm towards the targeted group.
-			HateThreatening bool `json:"hate/threatening"`
-			// Content that promotes, encourages, or depicts acts of self-harm, such as suicide,
-			// cutting, and eating disorders.
-			SelfHarm bool `json:"self-harm"`
-			// Content meant to arouse sexual excitement, such as the description of sexual activity,
-			// or that promotes sexual services (excluding sex education and wellness).
-			Sexual bool `json:"sexual"`
-			// Sexual content that includes an individual who is under 18 years old.
-			SexualMinors bool `json:"sexual/minors"`
-			// Content that promotes or glorifies violence or celebrates the suffering or humiliation of others.
-			Violence bool `json:"violence"`
-			// Violent content that depicts death, violence, or serious physical injury in extreme graphic detail.
-			ViolenceGraphic bool `json:"violence/graphic"`
-		} `json:"categories"`
-		CategoryScores struct {
-			Hate            float64 `json:"hate"`
-			HateThreatening float64 `json:"hate/threatening"`
-			SelfHarm        float64 `json:"self-harm"`
-			Sexual          float64 `json:"sexual"`
-			SexualMinors    float64 `json:"sexual/minors"`
-			Violence        float64 `json:"violence"`
-			ViolenceGraphic float64 `json:"violence/graphic"`
-		} `json:"category_scores"`
-		Flagged bool `json:"flagged"`
-	} `json:"results"`
+	Id      string             `json:"id"`
+	Model   string             `json:"model"`
+	Results []ModerationResult `json:"results"`
+}
+
+// ModerationResult is the classification of a single input.
+type ModerationResult struct {
+	Categories struct {
+		// Content that expresses, incites, or promotes hate based on race, gender, ethnicity,
+		// religion, nationality, sexual orientation, disability status, or caste.
+		Hate bool `json:"hate"`
+		// Hateful content that also includes violence or serious harm towards the targeted group.
+		HateThreatening bool `json:"hate/threatening"`
+		// Content that promotes, encourages, or depicts acts of self-harm, such as suicide,
+		// cutting, and eating disorders.
+		SelfHarm bool `json:"self-harm"`
+		// Content meant to arouse sexual excitement, such as the description of sexual activity,
+		// or that promotes sexual services (excluding sex education and wellness).
+		Sexual bool `json:"sexual"`
+		// Sexual content that includes an individual who is under 18 years old.
+		SexualMinors bool `json:"sexual/minors"`
+		// Content that promotes or glorifies violence or celebrates the suffering or humiliation of others.
+		Violence bool `json:"violence"`
+		// Violent content that depicts death, violence, or serious physical injury in extreme graphic detail.
+		ViolenceGraphic bool `json:"violence/graphic"`
+	} `json:"categories"`
+	CategoryScores struct {
+		Hate            float64 `json:"hate"`
+		HateThreatening float64 `json:"hate/threatening"`
+		SelfHarm        float64 `json:"self-harm"`
+		Sexual          float64 `json:"sexual"`
+		SexualMinors    float64 `json:"sexual/minors"`
+		Violence        float64 `json:"violence"`
+		ViolenceGraphic float64 `json:"violence/graphic"`
+	} `json:"category_scores"`
+	Flagged bool `json:"flagged"`
 }
 
 // Moderate classifies if text violates OpenAI's Content Policy
 //
 // Docs: https://platform.openai.com/docs/api-reference/moderations/create
 func (e *Engine) Moderate(ctx context.Context, input string) (*ModerationResponse, error) {
+	return e.moderate(ctx, input)
+}
+
+// ModerateInputs classifies multiple texts in one request, results are in the order of inputs.
+//
+// Docs: https://platform.openai.com/docs/api-reference/moderations/create
+func (e *Engine) ModerateInputs(ctx context.Context, inputs []string) (*ModerationResponse, error) {
+	return e.moderate(ctx, inputs)
+}
+
+func (e *Engine) moderate(ctx context.Context, input interface{}) (*ModerationResponse, error) {
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(struct {
-		Input string `json:"input"`
+		Input interface{} `json:"input"`
 	}{Input: input})
 	if err != nil {
 		return nil, err
 	}
 
 	uri := e.apiBaseURL + "/moderations"
+	ctx = withRequestInfo(ctx, "/moderations", "")
 	req, err := e.newReq(ctx, http.MethodPost, uri, "json", &buf)
 	if err != nil {
 		return nil, err
@@ -73,3 +89,79 @@ func (e *Engine) Moderate(ctx context.Context, input string) (*ModerationRespons
 	}
 	return &jsonResp, nil
 }
+
+// ModerationPolicy decides whether the moderated content is allowed.
+type ModerationPolicy interface {
+	Allow(result *ModerationResult) bool
+}
+
+// ModerationPolicyFunc is an adapter to use ordinary functions as ModerationPolicy.
+type ModerationPolicyFunc func(result *ModerationResult) bool
+
+func (f ModerationPolicyFunc) Allow(result *ModerationResult) bool {
+	return f(result)
+}
+
+// ModerationPolicyNotFlagged allows content which wasn't flagged by the moderation model.
+var ModerationPolicyNotFlagged ModerationPolicy = ModerationPolicyFunc(func(result *ModerationResult) bool {
+	return !result.Flagged
+})
+
+// ModeratedResponse is the chat completion response with moderation results of its choices.
+type ModeratedResponse struct {
+	*ChatCompletionResponse
+	// Moderation results by choice index. Choices without content aren't moderated and have no result.
+	Moderations map[int]*ModerationResult
+	policy      ModerationPolicy
+}
+
+// ModerateResponse moderates contents of all choices of resp in one request. Choices without
+// content, e.g. with tool calls only, are skipped. If policy is nil, ModerationPolicyNotFlagged is used.
+func (e *Engine) ModerateResponse(ctx context.Context, resp *ChatCompletionResponse, policy ModerationPolicy) (*ModeratedResponse, error) {
+	if policy == nil {
+		policy = ModerationPolicyNotFlagged
+	}
+	var (
+		inputs []string
+		// choice index of every input, results are returned in the order of inputs
+		indexes []int
+	)
+	for _, choice := range resp.Choices {
+		if choice.Message.Content == "" {
+			continue
+		}
+		inputs = append(inputs, choice.Message.Content)
+		indexes = append(indexes, choice.Index)
+	}
+	moderated := &ModeratedResponse{
+		ChatCompletionResponse: resp,
+		Moderations:            make(map[int]*ModerationResult, len(inputs)),
+		policy:                 policy,
+	}
+	if len(inputs) == 0 {
+		return moderated, nil
+	}
+	r, err := e.ModerateInputs(ctx, inputs)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Results) != len(inputs) {
+		return nil, fmt.Errorf("expected %d moderation results, got %d", len(inputs), len(r.Results))
+	}
+	for i, index := range indexes {
+		moderated.Moderations[index] = &r.Results[i]
+	}
+	return moderated, nil
+}
+
+// SafeChoices returns choices allowed by the policy, including choices which weren't moderated.
+func (r *ModeratedResponse) SafeChoices() []ChatCompletionChoice {
+	var choices []ChatCompletionChoice
+	for _, choice := range r.Choices {
+		if result, ok := r.Moderations[choice.Index]; ok && !r.policy.Allow(result) {
+			continue
+		}
+		choices = append(choices, choice)
+	}
+	return choices
+}
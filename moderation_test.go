@@ -5,11 +5,15 @@ package openai
 
 import (
 	"context"
+	"encoding/json"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestModerate(t *testing.T) {
@@ -82,3 +86,70 @@ func TestModerate(t *testing.T) {
 		})
 	}
 }
+
+func TestModerateResponse(t *testing.T) {
+	var inputs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/moderations", r.URL.Path)
+		var body struct {
+			Input []string `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		inputs = body.Input
+		w.Write([]byte(`{"id":"modr-1","results":[
+			{"flagged":false,"category_scores":{"violence":0.01}},
+			{"flagged":true,"categories":{"violence":true},"category_scores":{"violence":0.97}},
+			{"flagged":false,"category_scores":{"violence":0.4}}
+		]}`))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	resp := &ChatCompletionResponse{Choices: []ChatCompletionChoice{
+		{Index: 0, Message: ChatMessage{Role: "assistant", Content: "first"}},
+		{Index: 1, Message: ChatMessage{Role: "assistant"}},
+		{Index: 2, Message: ChatMessage{Role: "assistant", Content: "second"}},
+		{Index: 3, Message: ChatMessage{Role: "assistant", Content: "third"}},
+	}}
+	r, err := e.ModerateResponse(context.Background(), resp, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second", "third"}, inputs, "empty choices are skipped")
+	require.Len(t, r.Moderations, 3)
+	assert.False(t, r.Moderations[0].Flagged)
+	assert.NotContains(t, r.Moderations, 1)
+	assert.True(t, r.Moderations[2].Flagged)
+	assert.True(t, r.Moderations[2].Categories.Violence)
+	assert.False(t, r.Moderations[3].Flagged)
+
+	var safe []int
+	for _, choice := range r.SafeChoices() {
+		safe = append(safe, choice.Index)
+	}
+	assert.Equal(t, []int{0, 1, 3}, safe)
+
+	strict, err := e.ModerateResponse(context.Background(), resp, ModerationPolicyFunc(func(r *ModerationResult) bool {
+		return r.CategoryScores.Violence < 0.3
+	}))
+	require.NoError(t, err)
+	safe = nil
+	for _, choice := range strict.SafeChoices() {
+		safe = append(safe, choice.Index)
+	}
+	assert.Equal(t, []int{0, 1}, safe)
+}
+
+func TestModerateResponseResultsMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"modr-1","results":[{"flagged":false}]}`))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	_, err := e.ModerateResponse(context.Background(), &ChatCompletionResponse{Choices: []ChatCompletionChoice{
+		{Index: 0, Message: ChatMessage{Content: "a"}},
+		{Index: 1, Message: ChatMessage{Content: "b"}},
+	}}, nil)
+	assert.ErrorContains(t, err, "expected 2 moderation results, got 1")
+}
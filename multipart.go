@@ -0,0 +1,165 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// defaultMultipartBufferSize is the maximum size of the non-seekable file buffered in memory,
+// it covers the 25 MB limit of audio uploads.
+const defaultMultipartBufferSize = 32 << 20
+
+// ErrBodyNotReplayable is returned, wrapping the error of the request, when the failed request
+// would be retried, but its body was streamed from a one-shot reader and can't be sent again.
+// Pass files as io.Seeker (e.g. *os.File), or raise the limit with SetMultipartBufferSize,
+// to make such requests retryable.
+var ErrBodyNotReplayable = errors.New("openai: request body can't be replayed")
+
+// SetMultipartBufferSize is used to set the maximum size of the file which is buffered in memory
+// if it's not an io.Seeker, so the upload can be retried. Bigger files are streamed,
+// and the request isn't retried. By default files up to 32 MB are buffered.
+func (e *Engine) SetMultipartBufferSize(size int64) {
+	e.multipartBufferSize = size
+}
+
+// multipartBuilder builds multipart/form-data bodies without copying seekable files into memory.
+type multipartBuilder struct {
+	w          *multipart.Writer
+	buf        *bytes.Buffer // bytes written by w since the last file
+	parts      []multipartPart
+	bufferSize int64
+}
+
+// multipartPart is a segment of the body: either static bytes, a seekable file
+// which is re-read on every attempt, or the rest of a one-shot reader.
+type multipartPart struct {
+	data    []byte
+	file    io.ReadSeeker
+	offset  int64
+	size    int64
+	oneShot io.Reader
+}
+
+func newMultipartBuilder(bufferSize int64) *multipartBuilder {
+	buf := &bytes.Buffer{}
+	return &multipartBuilder{w: multipart.NewWriter(buf), buf: buf, bufferSize: bufferSize}
+}
+
+func (b *multipartBuilder) WriteField(name, value string) error {
+	return b.w.WriteField(name, value)
+}
+
+// WriteFile adds the file part. The content of r is read only when the body is sent,
+// if r is io.Seeker, or it's buffered up to the buffer size.
+func (b *multipartBuilder) WriteFile(name, filename string, r io.Reader) error {
+	if _, err := b.w.CreateFormFile(name, filename); err != nil {
+		return err
+	}
+	b.flush()
+	if s, ok := r.(io.ReadSeeker); ok {
+		offset, err := s.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		end, err := s.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		b.parts = append(b.parts, multipartPart{file: s, offset: offset, size: end - offset})
+		return nil
+	}
+	head, err := io.ReadAll(io.LimitReader(r, b.bufferSize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(head)) <= b.bufferSize {
+		b.parts = append(b.parts, multipartPart{data: head})
+		return nil
+	}
+	b.parts = append(b.parts, multipartPart{data: head}, multipartPart{oneShot: r})
+	return nil
+}
+
+func (b *multipartBuilder) flush() {
+	if b.buf.Len() > 0 {
+		b.parts = append(b.parts, multipartPart{data: append([]byte(nil), b.buf.Bytes()...)})
+		b.buf.Reset()
+	}
+}
+
+// Close finishes the body.
+func (b *multipartBuilder) Close() (*multipartBody, error) {
+	if err := b.w.Close(); err != nil {
+		return nil, fmt.Errorf("close writer: %w", err)
+	}
+	b.flush()
+	body := &multipartBody{parts: b.parts, contentType: b.w.FormDataContentType(), replayable: true}
+	for _, p := range b.parts {
+		if p.oneShot != nil {
+			body.replayable = false
+		}
+		body.length += int64(len(p.data)) + p.size
+	}
+	return body, nil
+}
+
+type multipartBody struct {
+	parts       []multipartPart
+	contentType string
+	length      int64
+	replayable  bool
+}
+
+// reader returns the reader of the whole body, rewinding the seekable files.
+func (m *multipartBody) reader() (io.Reader, error) {
+	readers := make([]io.Reader, 0, len(m.parts))
+	for _, p := range m.parts {
+		switch {
+		case p.file != nil:
+			if _, err := p.file.Seek(p.offset, io.SeekStart); err != nil {
+				return nil, err
+			}
+			readers = append(readers, io.LimitReader(p.file, p.size))
+		case p.oneShot != nil:
+			readers = append(readers, p.oneShot)
+		default:
+			readers = append(readers, bytes.NewReader(p.data))
+		}
+	}
+	return io.MultiReader(readers...), nil
+}
+
+// newMultipartReq creates POST request with the multipart body. The request can be retried
+// unless the body has a one-shot part.
+func (e *Engine) newMultipartReq(ctx context.Context, uri string, body *multipartBody) (*http.Request, error) {
+	r, err := body.reader()
+	if err != nil {
+		return nil, err
+	}
+	req, err := e.newReq(ctx, http.MethodPost, uri, body.contentType, r)
+	if err != nil {
+		return nil, err
+	}
+	if !body.replayable {
+		// The length of the streamed file is unknown, the body is sent in chunks
+		req.ContentLength = -1
+		return req, nil
+	}
+	req.ContentLength = body.length
+	req.GetBody = func() (io.ReadCloser, error) {
+		r, err := body.reader()
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(r), nil
+	}
+	return req, nil
+}
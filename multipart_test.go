@@ -0,0 +1,106 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type uploadAttempt struct {
+	contentLength int64
+	file          []byte
+}
+
+// newUploadServer fails the first upload with 500 and records the file of every attempt.
+func newUploadServer(t *testing.T, attempts *[]uploadAttempt) *Engine {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		assert.Equal(t, "whisper-1", r.FormValue("model"))
+		f, _, err := r.FormFile("file")
+		require.NoError(t, err)
+		b, err := io.ReadAll(f)
+		require.NoError(t, err)
+		*attempts = append(*attempts, uploadAttempt{r.ContentLength, b})
+		if len(*attempts) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":{"message":"try again","type":"server_error"}}`))
+			return
+		}
+		w.Write([]byte(`{"text":"hallo"}`))
+	}))
+	t.Cleanup(srv.Close)
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	e.clock = newAutoClock()
+	e.SetMaxRetries(2)
+	return e
+}
+
+func transcribeOptions(file io.Reader) *TranscribeOptions {
+	return &TranscribeOptions{AudioOptions: &AudioOptions{File: file, AudioFormat: "wav", Model: ModelWhisper}}
+}
+
+func TestMultipartRetrySeekable(t *testing.T) {
+	var attempts []uploadAttempt
+	e := newUploadServer(t, &attempts)
+	// Files larger than the buffer are streamed from disk, not buffered
+	e.SetMultipartBufferSize(16)
+	f, err := os.Open("testdata/german.wav")
+	require.NoError(t, err)
+	defer f.Close()
+	want, err := os.ReadFile("testdata/german.wav")
+	require.NoError(t, err)
+
+	r, err := e.Transcribe(context.Background(), transcribeOptions(f))
+	require.NoError(t, err)
+	assert.Equal(t, "hallo", r.Text)
+	require.Len(t, attempts, 2)
+	for _, a := range attempts {
+		assert.Equal(t, want, a.file)
+		assert.Greater(t, a.contentLength, int64(len(want)), "content length is known")
+	}
+	assert.Equal(t, attempts[0].contentLength, attempts[1].contentLength)
+}
+
+func TestMultipartRetryBuffered(t *testing.T) {
+	var attempts []uploadAttempt
+	e := newUploadServer(t, &attempts)
+	r, err := e.Transcribe(context.Background(), transcribeOptions(io.MultiReader(strings.NewReader("RIFF audio"))))
+	require.NoError(t, err)
+	assert.Equal(t, "hallo", r.Text)
+	require.Len(t, attempts, 2)
+	assert.Equal(t, []byte("RIFF audio"), attempts[1].file)
+	assert.Positive(t, attempts[1].contentLength)
+}
+
+func TestMultipartOneShotNotRetried(t *testing.T) {
+	var attempts []uploadAttempt
+	e := newUploadServer(t, &attempts)
+	e.SetMultipartBufferSize(16)
+	audio := bytes.Repeat([]byte("RIFF"), 64)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write(audio)
+		pw.Close()
+	}()
+
+	_, err := e.Transcribe(context.Background(), transcribeOptions(pr))
+	assert.ErrorIs(t, err, ErrBodyNotReplayable)
+	var apiErr APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusInternalServerError, apiErr.Err.StatusCode)
+	require.Len(t, attempts, 1)
+	assert.Equal(t, audio, attempts[0].file)
+	assert.EqualValues(t, -1, attempts[0].contentLength, "streamed body is chunked")
+}
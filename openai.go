@@ -9,38 +9,199 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
 	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
 
-	"github.com/go-playground/validator/v10"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Engine is the client of the OpenAI API. It's safe for concurrent use by multiple goroutines
+// once it's configured: the engine isn't modified by the requests, and the options passed to
+// the request methods are only read, so they may be shared by concurrent requests as well.
+// The defaults of the options, e.g. the max tokens, are set on their copies.
+// The counters, such as the prompt cache statistics and the key pool stats, are synchronized.
+//
+// The setters, e.g. SetApiKey and SetMaxRetries, must not be called concurrently with the requests.
+// Configure the engine before it's shared, clone it to change the configuration of some of the
+// requests, see Clone, or set the configuration of the request with its context, e.g.
+// ContextWithCredential and ContextWithMaxRetries.
 type Engine struct {
-	apiKey         string
-	apiBaseURL     string
-	organizationId string
-	client         *http.Client
-	validate       *validator.Validate
-	n              int
+	apiKey              string
+	apiBaseURL          string
+	organizationId      string
+	client              *http.Client
+	validate            Validator
+	signer              RequestSigner
+	metrics             MetricsCollector
+	embeddingsLimiter   *TokenRateLimiter
+	keys                *KeyPool
+	profiles            *ModelProfileRegistry
+	onProfileChange     func(model Model, changes []ProfileChange)
+	overflow            OverflowStrategy
+	defaultModel        Model
+	maxRetries          int
+	multipartBufferSize int64
+	backoff             func(attempt int, resp *http.Response) time.Duration
+	debugDump           *debugDumper
+	defaultHeaders      http.Header
+	contextHeaders      []contextHeader
+	deniedHeaders       []string
+	disableKeepAlive    bool
+	connPool            *connectionPool
+	router              Router
+	hostCredentials     map[string]CredentialProvider
+	requestIdFunc       func(ctx context.Context) string
+	sanitizer           func(string) string
+	propagator          propagation.TextMapPropagator
+	tracer              trace.Tracer
+	cacheStats          *cacheStats
+	cacheStatsCollector CacheStatsCollector
+	clock               Clock
+	uploadIndex         UploadIndex
+	latencyBudget       time.Duration
+	latencyBudgetFloor  time.Duration
+	jsonRepair          bool
+	adminAPIKey         string
+	usageAggregator     *UsageAggregator
+	logger              *slog.Logger
+	logBodies           bool
+	// n is the number of attempts sent by the engine. It's the pointer, so Clone copies
+	// the engine without reading the counter updated by the requests in flight.
+	n *atomic.Int64
 }
 
 const (
 	defaultMaxTokens = 1024
 )
 
+// Usage statistics for the completion request.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+	// Breakdown of the prompt tokens, reported by the chat completions.
+	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+}
+
+type PromptTokensDetails struct {
+	// The number of prompt tokens read from the prompt cache.
+	CachedTokens int `json:"cached_tokens"`
+}
+
+// CachedTokens returns the number of prompt tokens read from the prompt cache.
+func (u Usage) CachedTokens() int {
+	if u.PromptTokensDetails == nil {
+		return 0
+	}
+	return u.PromptTokensDetails.CachedTokens
+}
+
+// EngineOption is used to configure engine on initialization.
+type EngineOption func(e *Engine)
+
 // New is used to initialize engine.
-func New(apiKey string) *Engine {
+func New(apiKey string, opts ...EngineOption) *Engine {
 	e := &Engine{
-		apiKey:     apiKey,
-		apiBaseURL: "https://api.openai.com/v1",
-		client:     &http.Client{},
-		validate:   validator.New(),
-	}
-	v := validator.New()
-	v.SetTagName("binding")
-	e.validate = v
+		apiKey:              apiKey,
+		apiBaseURL:          "https://api.openai.com/v1",
+		client:              &http.Client{Transport: defaultTransport()},
+		validate:            newBindingValidator(),
+		backoff:             defaultBackoff,
+		multipartBufferSize: defaultMultipartBufferSize,
+		cacheStats:          &cacheStats{},
+		clock:               systemClock{},
+		n:                   new(atomic.Int64),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.shareClock()
+	if e.connPool != nil {
+		e.client = withConnectionPool(e.client, *e.connPool)
+	}
+	if e.disableKeepAlive {
+		e.client = withoutKeepAlive(e.client)
+	}
 	return e
 }
 
+// Clone is used to create the child engine, which inherits the configuration of e and
+// is configured with opts on top of it. The child shares the HTTP client, the key pool,
+// the rate limiters and the metrics collector with e, but changing the configuration
+// of the child doesn't affect e, and vice versa.
+func (e *Engine) Clone(opts ...EngineOption) (*Engine, error) {
+	for i, opt := range opts {
+		if opt == nil {
+			return nil, fmt.Errorf("engine option %d is nil", i)
+		}
+	}
+	c := &Engine{}
+	*c = *e
+	c.n = new(atomic.Int64)
+	c.defaultHeaders = e.defaultHeaders.Clone()
+	c.contextHeaders = slices.Clip(e.contextHeaders)
+	c.deniedHeaders = slices.Clip(e.deniedHeaders)
+	c.hostCredentials = maps.Clone(e.hostCredentials)
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.shareClock()
+	if c.connPool != nil && (c.connPool != e.connPool || c.client != e.client) {
+		c.client = withConnectionPool(c.client, *c.connPool)
+	}
+	if c.disableKeepAlive && (!e.disableKeepAlive || c.client != e.client) {
+		c.client = withoutKeepAlive(c.client)
+	}
+	return c, nil
+}
+
+// WithHTTPClient is used to set HTTP client which sends requests, e.g. with a custom transport.
+func WithHTTPClient(client *http.Client) EngineOption {
+	return func(e *Engine) {
+		e.client = client
+	}
+}
+
+// WithDisableKeepAlive is used to close the connection after every request, e.g. in CLI tools
+// which make a single request and exit without waiting for idle connections to be closed.
+// The requests are sent with the "Connection: close" header and keep-alives are disabled on
+// the transport of the HTTP client, if it's *http.Transport. The client passed with
+// WithHTTPClient isn't modified, a copy of it is used instead.
+func WithDisableKeepAlive() EngineOption {
+	return func(e *Engine) {
+		e.disableKeepAlive = true
+	}
+}
+
+// withoutKeepAlive returns a copy of client with keep-alives disabled on its transport.
+func withoutKeepAlive(client *http.Client) *http.Client {
+	return withTransport(client, func(t *http.Transport) {
+		t.DisableKeepAlives = true
+	})
+}
+
+// withTransport returns a copy of client with the copy of its transport configured by configure.
+// The client is returned as is if its transport isn't *http.Transport.
+func withTransport(client *http.Client, configure func(t *http.Transport)) *http.Client {
+	transport, ok := client.Transport.(*http.Transport)
+	if client.Transport == nil {
+		transport, ok = http.DefaultTransport.(*http.Transport)
+	}
+	if !ok {
+		return client
+	}
+	c := *client
+	t := transport.Clone()
+	configure(t)
+	c.Transport = t
+	return &c
+}
+
 // SetApiKey is used to set API key to access OpenAI API.
 func (e *Engine) SetApiKey(apiKey string) {
 	e.apiKey = apiKey
@@ -58,10 +219,15 @@ func (e *Engine) newReq(ctx context.Context, method string, uri string, postType
 	if body == nil {
 		body = new(bytes.Reader) // prevent nil body error
 	}
-	req, err := http.NewRequestWithContext(ctx, method, uri, body)
+	req, err := http.NewRequestWithContext(ctx, method, e.route(ctx, uri), body)
 	if err != nil {
 		return nil, err
 	}
+	e.setHeaders(ctx, req.Header)
+	if e.disableKeepAlive {
+		req.Close = true
+		req.Header.Set("Connection", "close")
+	}
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", e.apiKey))
 	if len(e.organizationId) != 0 {
 		req.Header.Set("OpenAI-Organization", e.organizationId)
@@ -79,36 +245,218 @@ func (e *Engine) newReq(ctx context.Context, method string, uri string, postType
 }
 
 func (e *Engine) doReq(req *http.Request) (*http.Response, error) {
-	e.n++ // increment number of requests
-	resp, err := e.client.Do(req)
+	maxRetries := e.retries(req.Context())
+	if maxRetries > 0 && req.Method != http.MethodGet && req.Header.Get("Idempotency-Key") == "" {
+		// The same key is sent with every attempt, so the server can
+		// recognize retries of the same logical request.
+		req.Header.Set("Idempotency-Key", newIdempotencyKey())
+	}
+	var (
+		attemptReq    *http.Request
+		key           *poolKey
+		resp          *http.Response
+		err           error
+		notReplayable bool
+		exhausted     bool
+	)
+	budget := e.newRequestBudget(req.Context())
+	start := e.clock.Now()
+	defer func() {
+		e.recordRequest(req, e.clock.Now().Sub(start), resp, err)
+	}()
+	for attempt := 0; ; attempt++ {
+		attemptReq, key, err = e.newAttempt(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+		var cancelAttempt context.CancelFunc
+		if budget != nil {
+			attemptReq, cancelAttempt = budget.startAttempt(attemptReq, attempt, maxRetries)
+		}
+		e.n.Add(1) // increment number of requests
+		reqDump := e.dumpRequest(attemptReq)
+		attemptStart := e.clock.Now()
+		resp, err = e.client.Do(attemptReq)
+		if budget != nil {
+			err = budget.endAttempt(resp, err, cancelAttempt)
+		}
+		endAttemptSpan(attemptReq.Context(), resp, err)
+		e.dumpResponse(reqDump, resp, err)
+		e.logAttempt(attemptReq, attempt+1, e.clock.Now().Sub(attemptStart), resp, err)
+		observeResponse(req.Context(), resp)
+		setResponseMeta(req.Context(), resp)
+		// The rejected key is failed over to another one right away
+		rejected := key != nil && e.keys.report(key, resp)
+		failover := rejected && canReplay(req)
+		if attempt >= maxRetries || !failover && !isRetryable(req, resp, err) {
+			notReplayable = attempt < maxRetries && req.Context().Err() == nil &&
+				!hasReplayableBody(req) && (rejected || isRetryableResult(resp, err))
+			exhausted = budget != nil && err != nil && budget.timedOut(req.Context())
+			break
+		}
+		var wait time.Duration
+		if !failover {
+			wait = e.backoff(attempt, resp)
+		}
+		if budget != nil && !budget.fits(req.Context(), wait) {
+			// The retry wouldn't fit into the budget
+			exhausted = true
+			break
+		}
+		// The error response is kept, in case the retry is cut short by ctx
+		var lastErr *APIError
+		if resp != nil && resp.StatusCode >= 300 {
+			if apiErr, decodeErr := newAPIError(resp); decodeErr == nil {
+				lastErr = &apiErr
+			}
+		} else if resp != nil {
+			drainBody(resp.Body)
+		}
+		if err = e.clock.Sleep(req.Context(), wait); err != nil {
+			resp = nil
+			if lastErr != nil {
+				lastErr.cause = err
+				err = *lastErr
+			}
+			return nil, err
+		}
+	}
 	if err != nil {
+		err = contextError(req.Context(), err)
+		if notReplayable {
+			err = fmt.Errorf("%w: %w", ErrBodyNotReplayable, err)
+		}
+		if exhausted {
+			err = budget.error(err)
+		}
 		return nil, err
 	}
 	// Check for valid status code
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 		return resp, nil
 	}
+	if err = doneReason(req.Context()); err != nil {
+		// The caller has abandoned the request, the error response doesn't matter
+		drainBody(resp.Body)
+		return nil, err
+	}
 
 	// If we have not-success HTTP status code, unmarshal to APIError
-	var apiErr APIError
-	if err := unmarshal(resp, &apiErr); err != nil {
+	apiErr, err := newAPIError(resp)
+	if err != nil {
 		return nil, err
 	}
-	if apiErr.Err.StatusCode == 0 {
-		// Overwrite apiErr status code if it's zero
-		apiErr.Err.StatusCode = resp.StatusCode
+	err = apiErr
+	if notReplayable {
+		err = fmt.Errorf("%w: %w", ErrBodyNotReplayable, err)
 	}
-	return resp, apiErr
+	if exhausted {
+		err = budget.error(err)
+	}
+	return resp, err
 }
 
+// sendJSON sends the request with body marshaled to JSON, if it's not nil,
+// and unmarshals the response into result.
+func (e *Engine) sendJSON(ctx context.Context, method, uri string, body, result interface{}) error {
+	var (
+		r        io.Reader
+		postType string
+	)
+	if body != nil {
+		var err error
+		if r, err = marshalJson(body); err != nil {
+			return err
+		}
+		postType = "json"
+	}
+	req, err := e.newReq(ctx, method, uri, postType, r)
+	if err != nil {
+		return err
+	}
+	resp, err := e.doReq(req)
+	if err != nil {
+		return err
+	}
+	return unmarshal(resp, result)
+}
+
+// newAttempt prepares a single attempt of req. Every attempt is sent as a copy
+// of req with a fresh body, so signing and retries never see the headers or
+// the consumed body of a previous attempt. The key of the pool the attempt
+// is sent with is returned, if the pool is set. The trace context is injected
+// for every attempt, so each of them carries its own span if attempt spans are enabled.
+func (e *Engine) newAttempt(req *http.Request, n int) (*http.Request, *poolKey, error) {
+	attempt := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, nil, err
+		}
+		attempt.Body = body
+	}
+	key, token, err := e.authorize(req.Context(), attempt.URL.Host)
+	if err != nil {
+		return nil, nil, err
+	}
+	attempt.Header.Set("Authorization", "Bearer "+token)
+	ctx := e.startAttemptSpan(req.Context(), req, n)
+	attempt = attempt.WithContext(ctx)
+	e.injectTraceContext(ctx, attempt.Header)
+	if e.signer != nil {
+		if err := e.signer.SignRequest(attempt.Method, attempt.URL, attempt.Header, bodyBytes(attempt)); err != nil {
+			err = fmt.Errorf("sign request: %w", err)
+			endAttemptSpan(ctx, nil, err)
+			return nil, nil, err
+		}
+	}
+	e.removeDeniedHeaders(attempt.Header)
+	return attempt, key, nil
+}
+
+// authorize returns the API key the request made with ctx is sent to host with: the credential
+// of the request, see credential, the key of the pool, if the pool is set, or the API key of
+// the engine. The key of the pool is returned along with its API key.
+func (e *Engine) authorize(ctx context.Context, host string) (*poolKey, string, error) {
+	if credential, ok := e.credential(ctx, host); ok {
+		token, err := credential.Token(ctx)
+		if err != nil {
+			return nil, "", fmt.Errorf("get credential: %w", err)
+		}
+		return nil, token, nil
+	}
+	if e.keys != nil {
+		key, token, err := e.keys.acquire(ctx)
+		if err != nil {
+			return nil, "", fmt.Errorf("get credential: %w", err)
+		}
+		return key, token, nil
+	}
+	return nil, e.apiKey, nil
+}
+
+// maxDrainBytes is the maximum number of bytes read from the abandoned response body
+// to let the connection be reused. Bigger bodies are closed along with the connection.
+const maxDrainBytes = 64 << 10
+
 func unmarshal(resp *http.Response, v interface{}) error {
-	defer resp.Body.Close()
+	defer drainBody(resp.Body)
 	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		if resp.Request != nil {
+			return contextError(resp.Request.Context(), err)
+		}
 		return err
 	}
 	return nil
 }
 
+// drainBody reads the rest of body and closes it. The connection is only reused
+// by the transport if the body was read to EOF, which the JSON decoder doesn't do.
+func drainBody(body io.ReadCloser) {
+	io.CopyN(io.Discard, body, maxDrainBytes)
+	body.Close()
+}
+
 func marshalJson(body interface{}) (io.Reader, error) {
 	b, err := json.Marshal(body)
 	if err != nil {
@@ -0,0 +1,296 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCountingServer starts server which counts new connections.
+func newCountingServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *int32) {
+	var conns int32
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv, &conns
+}
+
+func TestConnectionReuse(t *testing.T) {
+	// Trailing data after the JSON isn't read by the decoder and must be drained
+	padding := strings.Repeat(" ", 60<<10)
+	srv, conns := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/models/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintln(w, `{"error":{"message":"not found","type":"invalid_request_error"}}`+padding)
+			return
+		}
+		fmt.Fprintln(w, `{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"}}]}`+padding)
+	})
+
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	opts := &ChatCompletionOptions{
+		Model:    ModelGPT3Dot5Turbo,
+		Messages: []ChatMessage{{Role: "user", Content: "hello"}},
+	}
+	for i := 0; i < 100; i++ {
+		_, err := e.ChatCompletion(context.Background(), opts)
+		require.NoError(t, err)
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(conns), "sequential calls must reuse connection")
+
+	_, err := e.RetrieveModel(context.Background(), &RetrieveModelOptions{ID: "missing"})
+	require.Error(t, err)
+	_, err = e.ChatCompletion(context.Background(), opts)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(conns), "error response must not break reuse")
+}
+
+func TestConnectionReuseAfterRetry(t *testing.T) {
+	var n int32
+	srv, conns := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&n, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, `{"error":{"message":"overloaded"}}`)
+			return
+		}
+		fmt.Fprintln(w, `{"data":[]}`)
+	})
+
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	e.SetMaxRetries(1)
+	clock := newAutoClock()
+	e.clock = clock
+	_, err := e.ListModels(context.Background())
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&n))
+	assert.Equal(t, []time.Duration{defaultRetryBaseDelay}, clock.Slept())
+	assert.EqualValues(t, 1, atomic.LoadInt32(conns))
+}
+
+func TestDisableKeepAlive(t *testing.T) {
+	srv, conns := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, r.Close, "request must have Connection: close")
+		fmt.Fprintln(w, `{"data":[]}`)
+	})
+
+	client := &http.Client{Transport: &http.Transport{}}
+	e := New("test", WithHTTPClient(client), WithDisableKeepAlive())
+	e.apiBaseURL = srv.URL
+	for i := 0; i < 3; i++ {
+		_, err := e.ListModels(context.Background())
+		require.NoError(t, err)
+	}
+	assert.EqualValues(t, 3, atomic.LoadInt32(conns))
+	assert.True(t, e.client.Transport.(*http.Transport).DisableKeepAlives)
+	assert.False(t, client.Transport.(*http.Transport).DisableKeepAlives, "the client passed by the caller isn't modified")
+
+	e = New("test", WithDisableKeepAlive())
+	assert.True(t, e.client.Transport.(*http.Transport).DisableKeepAlives)
+	assert.False(t, http.DefaultTransport.(*http.Transport).DisableKeepAlives)
+}
+
+func TestClone(t *testing.T) {
+	var requests []http.Header
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Clone())
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+	})
+	parent := New("sk-parent",
+		WithDefaultHeaders(http.Header{"X-Team": {"search"}}),
+		WithDeniedHeaders("X-Debug"),
+	)
+	parent.apiBaseURL = srv.URL
+
+	child, err := parent.Clone(
+		WithDefaultHeaders(http.Header{"X-Subsystem": {"ranking"}}),
+		WithDeniedHeaders("X-Team"),
+	)
+	require.NoError(t, err)
+	child.SetApiKey("sk-child")
+	assert.Same(t, parent.client, child.client, "the HTTP client is shared")
+
+	_, err = parent.ChatCompletion(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	_, err = child.ChatCompletion(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	require.Len(t, requests, 2)
+	assert.Equal(t, "Bearer sk-parent", requests[0].Get("Authorization"))
+	assert.Equal(t, "search", requests[0].Get("X-Team"))
+	assert.Empty(t, requests[0].Get("X-Subsystem"), "the child options don't affect the parent")
+	assert.Equal(t, "Bearer sk-child", requests[1].Get("Authorization"))
+	assert.Equal(t, "ranking", requests[1].Get("X-Subsystem"))
+	assert.Empty(t, requests[1].Get("X-Team"))
+
+	_, err = parent.Clone(nil)
+	assert.Error(t, err)
+}
+
+func TestCloneDisableKeepAlive(t *testing.T) {
+	parent := New("test")
+	child, err := parent.Clone(WithDisableKeepAlive())
+	require.NoError(t, err)
+	assert.True(t, child.client.Transport.(*http.Transport).DisableKeepAlives)
+	assert.False(t, parent.client.Transport.(*http.Transport).DisableKeepAlives)
+}
+
+func mustReadAll(t *testing.T, r *http.Request) []byte {
+	t.Helper()
+	b, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	return b
+}
+
+// concurrentCollector is the metrics collector safe for concurrent use.
+type concurrentCollector struct {
+	requests, usage, errors atomic.Int64
+}
+
+func (c *concurrentCollector) RecordRequestDuration(string, string, time.Duration, int) {
+	c.requests.Add(1)
+}
+func (c *concurrentCollector) RecordTokenUsage(string, int, int)  { c.usage.Add(1) }
+func (c *concurrentCollector) RecordError(string, string, string) { c.errors.Add(1) }
+
+// TestEngineConcurrentUse is the stress test of the guarantee of Engine: the engine, its clones
+// and the request options are shared by the goroutines sending chat completions, streams and
+// embeddings. Run it with -race.
+func TestEngineConcurrentUse(t *testing.T) {
+	const goroutines = 100
+	var (
+		served, failed atomic.Int64
+		retried        sync.Map
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt of every 7th request fails
+		_, retry := retried.LoadOrStore(r.Header.Get("Idempotency-Key"), true)
+		if served.Add(1)%7 == 0 && !retry {
+			failed.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":{"message":"overloaded","type":"server_error"}}`))
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.URL.Path == "/embeddings":
+			w.Write([]byte(`{"object":"list","data":[{"object":"embedding","embedding":[0.1,0.2],"index":0}],` +
+				`"model":"text-embedding-3-small","usage":{"prompt_tokens":2,"total_tokens":2}}`))
+		case strings.Contains(string(body), `"stream":true`):
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, content := range []string{"Hel", "lo"} {
+				fmt.Fprintf(w, "data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", content)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		default:
+			w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],` +
+				`"usage":{"prompt_tokens":9,"completion_tokens":3,"total_tokens":12}}`))
+		}
+	}))
+	defer srv.Close()
+
+	collector := &concurrentCollector{}
+	agg := &UsageAggregator{}
+	e := New("sk-engine",
+		WithClock(newAutoClock()),
+		WithMetrics(collector),
+		WithUsageAggregation(agg),
+		WithKeyPool(NewKeyPool("sk-1", "sk-2", "sk-3")),
+		WithModelProfiles(NewModelProfileRegistry(), nil),
+		WithEmbeddingsTokenLimit(NewTokenRateLimiter(1_000_000)),
+		WithContentSanitizer(),
+		WithDefaultHeaders(http.Header{"X-Team": {"search"}}),
+	)
+	e.apiBaseURL = srv.URL
+	e.SetMaxRetries(3)
+
+	// The options are shared by all the requests
+	chatOpts := testChatOptions()
+	embeddingsOpts := &EmbeddingsOptions{Model: ModelTextEmbedding3Small, Input: []string{"hello"}}
+	wantChat, wantEmbeddings := *chatOpts, *embeddingsOpts
+
+	var (
+		wg     sync.WaitGroup
+		errs   = make(chan error, goroutines*3)
+		chunks atomic.Int64
+	)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			engine := e
+			if i%10 == 0 {
+				clone, err := e.Clone(WithRequestIdFunc(func(context.Context) string { return "req" }))
+				if err != nil {
+					errs <- err
+					return
+				}
+				engine = clone
+			}
+			ctx := context.Background()
+			if _, err := engine.ChatCompletion(ctx, chatOpts); err != nil {
+				errs <- fmt.Errorf("chat: %w", err)
+			}
+			if _, err := engine.Embeddings(ctx, embeddingsOpts); err != nil {
+				errs <- fmt.Errorf("embeddings: %w", err)
+			}
+			stream, err := engine.ChatCompletionStream(ctx, chatOpts)
+			if err != nil {
+				errs <- fmt.Errorf("stream: %w", err)
+				return
+			}
+			defer stream.Close()
+			for {
+				_, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					errs <- fmt.Errorf("stream: %w", err)
+					return
+				}
+				chunks.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	assert.Equal(t, &wantChat, chatOpts, "the shared options must not be modified")
+	assert.Equal(t, &wantEmbeddings, embeddingsOpts, "the shared options must not be modified")
+	assert.Equal(t, int64(2*goroutines), chunks.Load())
+	summary := agg.Summary()
+	assert.Equal(t, int64(goroutines), summary[ModelGPT3Dot5Turbo].Requests)
+	assert.Equal(t, int64(goroutines), summary[ModelTextEmbedding3Small].Requests)
+	assert.Equal(t, int64(2*goroutines), collector.usage.Load())
+	assert.Equal(t, int64(3*goroutines), collector.requests.Load())
+	assert.Equal(t, int64(3*goroutines)+failed.Load(), served.Load(), "the failed attempts are retried")
+	assert.NotZero(t, failed.Load())
+	var keyRequests int64
+	for _, stats := range e.keys.Stats() {
+		keyRequests += stats.Requests
+	}
+	assert.Equal(t, served.Load(), keyRequests, "every attempt is sent with the key of the pool")
+}
@@ -0,0 +1,428 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"iter"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// The organization endpoints require the admin API key. Set it with WithAdminAPIKey,
+// or pass it for the requests with ContextWithCredential.
+
+// WithAdminAPIKey is used to authorize the requests to the organization endpoints, e.g.
+// CreateProject, with the admin API key of the organization instead of the engine API key,
+// the key pool or the host credential. The other requests aren't affected. The credential
+// set with ContextWithCredential takes precedence over it.
+func WithAdminAPIKey(key string) EngineOption {
+	return func(e *Engine) {
+		e.adminAPIKey = key
+	}
+}
+
+// isAdminEndpoint reports whether the endpoint requires the admin API key.
+func isAdminEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "/organization/")
+}
+
+// Statuses of the project.
+const (
+	ProjectActive   = "active"
+	ProjectArchived = "archived"
+)
+
+// Project is the project of the organization, which owns its API keys, service accounts and rate limits.
+type Project struct {
+	Id        string `json:"id"`
+	Object    string `json:"object"`
+	Name      string `json:"name"`
+	CreatedAt int64  `json:"created_at"`
+	// The Unix timestamp of the archival, zero if the project is active.
+	ArchivedAt int64  `json:"archived_at,omitempty"`
+	Status     string `json:"status"`
+}
+
+type CreateProjectOptions struct {
+	// The name of the project, which appears in reporting.
+	Name string `json:"name" binding:"required"`
+}
+
+type ModifyProjectOptions struct {
+	// The new name of the project.
+	Name string `json:"name" binding:"required"`
+}
+
+type ListProjectsOptions struct {
+	ListOptions
+	// Whether to include archived projects.
+	IncludeArchived bool
+}
+
+// CreateProject creates the project in the organization.
+//
+// Docs: https://platform.openai.com/docs/api-reference/projects/create
+func (e *Engine) CreateProject(ctx context.Context, opts *CreateProjectOptions) (*Project, error) {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	uri := e.apiBaseURL + "/organization/projects"
+	ctx = withRequestInfo(ctx, "/organization/projects", "")
+	var project Project
+	if err := e.sendJSON(ctx, http.MethodPost, uri, opts, &project); err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// ListProjects returns the page of projects of the organization.
+//
+// Docs: https://platform.openai.com/docs/api-reference/projects/list
+func (e *Engine) ListProjects(ctx context.Context, opts *ListProjectsOptions) (*Page[Project], error) {
+	if opts == nil {
+		opts = &ListProjectsOptions{}
+	}
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	q := opts.ListOptions.query()
+	if opts.IncludeArchived {
+		q.Set("include_archived", "true")
+	}
+	uri := withQuery(e.apiBaseURL+"/organization/projects", q)
+	ctx = withRequestInfo(ctx, "/organization/projects", "")
+	var page Page[Project]
+	if err := e.sendJSON(ctx, http.MethodGet, uri, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// AllProjects iterates over the projects of all pages, starting with the page of opts.
+func (e *Engine) AllProjects(ctx context.Context, opts *ListProjectsOptions) iter.Seq2[Project, error] {
+	var o ListProjectsOptions
+	if opts != nil {
+		o = *opts
+	}
+	return paginate(ctx, o.After, func(ctx context.Context, after string) (*Page[Project], error) {
+		o.After = after
+		return e.ListProjects(ctx, &o)
+	})
+}
+
+// RetrieveProject returns the project.
+//
+// Docs: https://platform.openai.com/docs/api-reference/projects/retrieve
+func (e *Engine) RetrieveProject(ctx context.Context, projectId string) (*Project, error) {
+	uri := e.apiBaseURL + "/organization/projects/" + url.PathEscape(projectId)
+	ctx = withRequestInfo(ctx, "/organization/projects/{project_id}", "")
+	var project Project
+	if err := e.sendJSON(ctx, http.MethodGet, uri, nil, &project); err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// ModifyProject renames the project.
+//
+// Docs: https://platform.openai.com/docs/api-reference/projects/modify
+func (e *Engine) ModifyProject(ctx context.Context, projectId string, opts *ModifyProjectOptions) (*Project, error) {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	uri := e.apiBaseURL + "/organization/projects/" + url.PathEscape(projectId)
+	ctx = withRequestInfo(ctx, "/organization/projects/{project_id}", "")
+	var project Project
+	if err := e.sendJSON(ctx, http.MethodPost, uri, opts, &project); err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// ArchiveProject archives the project. Archived projects can't be used or updated.
+//
+// Docs: https://platform.openai.com/docs/api-reference/projects/archive
+func (e *Engine) ArchiveProject(ctx context.Context, projectId string) (*Project, error) {
+	uri := e.apiBaseURL + "/organization/projects/" + url.PathEscape(projectId) + "/archive"
+	ctx = withRequestInfo(ctx, "/organization/projects/{project_id}/archive", "")
+	var project Project
+	if err := e.sendJSON(ctx, http.MethodPost, uri, nil, &project); err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// SecretKey is the API key value, which is returned once, when the key is created.
+// It's redacted when it's printed, logged or marshaled, the value is only returned by Reveal.
+type SecretKey struct {
+	value string
+}
+
+// Reveal returns the value of the key. Store it in the secret storage right away,
+// it can't be retrieved again.
+func (k SecretKey) Reveal() string {
+	return k.value
+}
+
+func (k SecretKey) String() string {
+	return redacted
+}
+
+func (k SecretKey) GoString() string {
+	return "openai.SecretKey{" + redacted + "}"
+}
+
+func (k SecretKey) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+func (k SecretKey) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redacted)
+}
+
+func (k *SecretKey) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &k.value)
+}
+
+// ServiceAccount is the bot user of the project, which isn't associated with any person.
+type ServiceAccount struct {
+	Id        string `json:"id"`
+	Object    string `json:"object"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// CreatedServiceAccount is the service account along with its API key, which is only
+// returned on creation.
+type CreatedServiceAccount struct {
+	ServiceAccount
+	APIKey ServiceAccountAPIKey `json:"api_key"`
+}
+
+// ServiceAccountAPIKey is the API key of the created service account.
+type ServiceAccountAPIKey struct {
+	Id        string    `json:"id"`
+	Object    string    `json:"object"`
+	Name      string    `json:"name"`
+	CreatedAt int64     `json:"created_at"`
+	Value     SecretKey `json:"value"`
+}
+
+type CreateServiceAccountOptions struct {
+	// The name of the service account.
+	Name string `json:"name" binding:"required"`
+}
+
+// CreateServiceAccount creates the service account of the project, along with its API key.
+// The value of the key is only returned by this call.
+//
+// Docs: https://platform.openai.com/docs/api-reference/project-service-accounts/create
+func (e *Engine) CreateServiceAccount(ctx context.Context, projectId string, opts *CreateServiceAccountOptions) (*CreatedServiceAccount, error) {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	uri := e.apiBaseURL + "/organization/projects/" + url.PathEscape(projectId) + "/service_accounts"
+	ctx = withRequestInfo(ctx, "/organization/projects/{project_id}/service_accounts", "")
+	var account CreatedServiceAccount
+	if err := e.sendJSON(ctx, http.MethodPost, uri, opts, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// ListServiceAccounts returns the page of service accounts of the project.
+//
+// Docs: https://platform.openai.com/docs/api-reference/project-service-accounts/list
+func (e *Engine) ListServiceAccounts(ctx context.Context, projectId string, opts *ListOptions) (*Page[ServiceAccount], error) {
+	if opts == nil {
+		opts = &ListOptions{}
+	}
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	uri := withQuery(e.apiBaseURL+"/organization/projects/"+url.PathEscape(projectId)+"/service_accounts", opts.query())
+	ctx = withRequestInfo(ctx, "/organization/projects/{project_id}/service_accounts", "")
+	var page Page[ServiceAccount]
+	if err := e.sendJSON(ctx, http.MethodGet, uri, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// AllServiceAccounts iterates over the service accounts of all pages, starting with the page of opts.
+func (e *Engine) AllServiceAccounts(ctx context.Context, projectId string, opts *ListOptions) iter.Seq2[ServiceAccount, error] {
+	var o ListOptions
+	if opts != nil {
+		o = *opts
+	}
+	return paginate(ctx, o.After, func(ctx context.Context, after string) (*Page[ServiceAccount], error) {
+		o.After = after
+		return e.ListServiceAccounts(ctx, projectId, &o)
+	})
+}
+
+// DeleteServiceAccount deletes the service account of the project, along with its API key.
+//
+// Docs: https://platform.openai.com/docs/api-reference/project-service-accounts/delete
+func (e *Engine) DeleteServiceAccount(ctx context.Context, projectId, serviceAccountId string) (*Deleted, error) {
+	uri := e.apiBaseURL + "/organization/projects/" + url.PathEscape(projectId) + "/service_accounts/" + url.PathEscape(serviceAccountId)
+	ctx = withRequestInfo(ctx, "/organization/projects/{project_id}/service_accounts/{service_account_id}", "")
+	return e.deleteObject(ctx, uri)
+}
+
+// ProjectRateLimit is the rate limit of the model in the project.
+type ProjectRateLimit struct {
+	Id                          string `json:"id"`
+	Object                      string `json:"object"`
+	Model                       Model  `json:"model"`
+	MaxRequestsPer1Minute       int    `json:"max_requests_per_1_minute"`
+	MaxTokensPer1Minute         int    `json:"max_tokens_per_1_minute"`
+	MaxImagesPer1Minute         int    `json:"max_images_per_1_minute,omitempty"`
+	MaxAudioMegabytesPer1Minute int    `json:"max_audio_megabytes_per_1_minute,omitempty"`
+	MaxRequestsPer1Day          int    `json:"max_requests_per_1_day,omitempty"`
+	Batch1DayMaxInputTokens     int    `json:"batch_1_day_max_input_tokens,omitempty"`
+}
+
+// ModifyProjectRateLimitOptions are the limits to change, the ones which aren't set are kept.
+type ModifyProjectRateLimitOptions struct {
+	MaxRequestsPer1Minute       *int `json:"max_requests_per_1_minute,omitempty" binding:"omitempty,min=0"`
+	MaxTokensPer1Minute         *int `json:"max_tokens_per_1_minute,omitempty" binding:"omitempty,min=0"`
+	MaxImagesPer1Minute         *int `json:"max_images_per_1_minute,omitempty" binding:"omitempty,min=0"`
+	MaxAudioMegabytesPer1Minute *int `json:"max_audio_megabytes_per_1_minute,omitempty" binding:"omitempty,min=0"`
+	MaxRequestsPer1Day          *int `json:"max_requests_per_1_day,omitempty" binding:"omitempty,min=0"`
+	Batch1DayMaxInputTokens     *int `json:"batch_1_day_max_input_tokens,omitempty" binding:"omitempty,min=0"`
+}
+
+// ListProjectRateLimits returns the page of rate limits of the project, one per model.
+//
+// Docs: https://platform.openai.com/docs/api-reference/project-rate-limits/list
+func (e *Engine) ListProjectRateLimits(ctx context.Context, projectId string, opts *ListOptions) (*Page[ProjectRateLimit], error) {
+	if opts == nil {
+		opts = &ListOptions{}
+	}
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	uri := withQuery(e.apiBaseURL+"/organization/projects/"+url.PathEscape(projectId)+"/rate_limits", opts.query())
+	ctx = withRequestInfo(ctx, "/organization/projects/{project_id}/rate_limits", "")
+	var page Page[ProjectRateLimit]
+	if err := e.sendJSON(ctx, http.MethodGet, uri, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// AllProjectRateLimits iterates over the rate limits of all pages, starting with the page of opts.
+func (e *Engine) AllProjectRateLimits(ctx context.Context, projectId string, opts *ListOptions) iter.Seq2[ProjectRateLimit, error] {
+	var o ListOptions
+	if opts != nil {
+		o = *opts
+	}
+	return paginate(ctx, o.After, func(ctx context.Context, after string) (*Page[ProjectRateLimit], error) {
+		o.After = after
+		return e.ListProjectRateLimits(ctx, projectId, &o)
+	})
+}
+
+// ModifyProjectRateLimit changes the rate limit of the project.
+//
+// Docs: https://platform.openai.com/docs/api-reference/project-rate-limits/update
+func (e *Engine) ModifyProjectRateLimit(ctx context.Context, projectId, rateLimitId string, opts *ModifyProjectRateLimitOptions) (*ProjectRateLimit, error) {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	uri := e.apiBaseURL + "/organization/projects/" + url.PathEscape(projectId) + "/rate_limits/" + url.PathEscape(rateLimitId)
+	ctx = withRequestInfo(ctx, "/organization/projects/{project_id}/rate_limits/{rate_limit_id}", "")
+	var limit ProjectRateLimit
+	if err := e.sendJSON(ctx, http.MethodPost, uri, opts, &limit); err != nil {
+		return nil, err
+	}
+	return &limit, nil
+}
+
+// APIKey is the API key of the project. Its value is only returned on creation,
+// the redacted value identifies the key.
+type APIKey struct {
+	Id            string      `json:"id"`
+	Object        string      `json:"object"`
+	Name          string      `json:"name"`
+	RedactedValue string      `json:"redacted_value"`
+	CreatedAt     int64       `json:"created_at"`
+	Owner         APIKeyOwner `json:"owner"`
+}
+
+// Types of the owner of the API key.
+const (
+	APIKeyOwnerUser           = "user"
+	APIKeyOwnerServiceAccount = "service_account"
+)
+
+// APIKeyOwner is the user or the service account which owns the API key, depending on the type.
+type APIKeyOwner struct {
+	Type           string          `json:"type"`
+	User           *ProjectUser    `json:"user,omitempty"`
+	ServiceAccount *ServiceAccount `json:"service_account,omitempty"`
+}
+
+// ProjectUser is the member of the project.
+type ProjectUser struct {
+	Id        string `json:"id"`
+	Object    string `json:"object"`
+	Name      string `json:"name"`
+	Email     string `json:"email,omitempty"`
+	Role      string `json:"role"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type ListAPIKeysOptions struct {
+	ListOptions
+}
+
+// ListProjectAPIKeys returns the page of API keys of the project.
+//
+// Docs: https://platform.openai.com/docs/api-reference/project-api-keys/list
+func (e *Engine) ListProjectAPIKeys(ctx context.Context, projectId string, opts *ListAPIKeysOptions) (*Page[APIKey], error) {
+	if opts == nil {
+		opts = &ListAPIKeysOptions{}
+	}
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	uri := withQuery(e.apiBaseURL+"/organization/projects/"+url.PathEscape(projectId)+"/api_keys", opts.ListOptions.query())
+	ctx = withRequestInfo(ctx, "/organization/projects/{project_id}/api_keys", "")
+	var page Page[APIKey]
+	if err := e.sendJSON(ctx, http.MethodGet, uri, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// AllProjectAPIKeys iterates over the API keys of all pages, starting with the page of opts.
+func (e *Engine) AllProjectAPIKeys(ctx context.Context, projectId string, opts *ListAPIKeysOptions) iter.Seq2[APIKey, error] {
+	var o ListAPIKeysOptions
+	if opts != nil {
+		o = *opts
+	}
+	return paginate(ctx, o.After, func(ctx context.Context, after string) (*Page[APIKey], error) {
+		o.After = after
+		return e.ListProjectAPIKeys(ctx, projectId, &o)
+	})
+}
+
+// DeleteProjectAPIKey deletes the API key of the project. The keys of the service accounts
+// can't be deleted this way, delete the service account instead, see DeleteServiceAccount.
+// It returns ErrNotFound if the key doesn't exist.
+//
+// Docs: https://platform.openai.com/docs/api-reference/project-api-keys/delete
+func (e *Engine) DeleteProjectAPIKey(ctx context.Context, projectId, keyId string) error {
+	uri := e.apiBaseURL + "/organization/projects/" + url.PathEscape(projectId) + "/api_keys/" + url.PathEscape(keyId)
+	ctx = withRequestInfo(ctx, "/organization/projects/{project_id}/api_keys/{key_id}", "")
+	_, err := e.deleteObject(ctx, uri)
+	return err
+}
@@ -0,0 +1,250 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testServiceAccountKey = "sk-svcacct-abcdefghijklmnop123"
+
+// newOrganizationServer serves the projects of the organization from memory.
+// Requests must be authorized with the admin key.
+func newOrganizationServer(t *testing.T) *Engine {
+	var projects []*Project
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk-admin" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"message":"admin key required","type":"invalid_request_error"}}`))
+			return
+		}
+		path := strings.TrimPrefix(r.URL.Path, "/organization/projects")
+		switch {
+		case r.Method == http.MethodPost && path == "":
+			var opts CreateProjectOptions
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&opts))
+			p := &Project{Id: "proj_" + strconv.Itoa(len(projects)+1), Object: "organization.project", Name: opts.Name, CreatedAt: 1711471533, Status: ProjectActive}
+			projects = append(projects, p)
+			json.NewEncoder(w).Encode(p)
+		case r.Method == http.MethodGet && path == "":
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			after := r.URL.Query().Get("after")
+			page := Page[Project]{Object: "list", Data: []Project{}}
+			var started, more bool
+			for _, p := range projects {
+				if p.Status == ProjectArchived && r.URL.Query().Get("include_archived") != "true" {
+					continue
+				}
+				if after != "" && !started {
+					started = p.Id == after
+					continue
+				}
+				if limit > 0 && len(page.Data) == limit {
+					more = true
+					break
+				}
+				page.Data = append(page.Data, *p)
+			}
+			if len(page.Data) > 0 {
+				page.FirstId, page.LastId = page.Data[0].Id, page.Data[len(page.Data)-1].Id
+			}
+			page.HasMore = more
+			json.NewEncoder(w).Encode(page)
+		case r.Method == http.MethodPost && strings.HasSuffix(path, "/archive"):
+			for _, p := range projects {
+				if "/"+p.Id+"/archive" == path {
+					p.Status, p.ArchivedAt = ProjectArchived, 1711471600
+					json.NewEncoder(w).Encode(p)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(notFoundBody))
+		case r.Method == http.MethodPost && strings.HasSuffix(path, "/service_accounts"):
+			fmt.Fprintf(w, `{"object":"organization.project.service_account","id":"svc_acct_abc","name":"Production App","role":"member","created_at":1711471533,
+				"api_key":{"object":"organization.project.service_account.api_key","value":%q,"name":"Secret Key","created_at":1711471533,"id":"key_abc"}}`, testServiceAccountKey)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(notFoundBody))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	e := New("sk-project")
+	e.apiBaseURL = srv.URL
+	return e
+}
+
+func TestProjects(t *testing.T) {
+	e := newOrganizationServer(t)
+	_, err := e.CreateProject(context.Background(), &CreateProjectOptions{Name: "tenant"})
+	assert.ErrorContains(t, err, "admin key required", "the project key isn't authorized")
+
+	ctx := ContextWithCredential(context.Background(), StaticCredential("sk-admin"))
+	for i := 1; i <= 5; i++ {
+		p, err := e.CreateProject(ctx, &CreateProjectOptions{Name: fmt.Sprintf("tenant-%d", i)})
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("proj_%d", i), p.Id)
+		assert.Equal(t, ProjectActive, p.Status)
+	}
+	_, err = e.CreateProject(ctx, &CreateProjectOptions{})
+	assert.Error(t, err, "the name is required")
+
+	archived, err := e.ArchiveProject(ctx, "proj_2")
+	require.NoError(t, err)
+	assert.Equal(t, ProjectArchived, archived.Status)
+	assert.NotZero(t, archived.ArchivedAt)
+	_, err = e.ArchiveProject(ctx, "proj_9")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	page, err := e.ListProjects(ctx, &ListProjectsOptions{ListOptions: ListOptions{Limit: 2}})
+	require.NoError(t, err)
+	assert.True(t, page.HasMore)
+	assert.Equal(t, "proj_3", page.LastId)
+
+	var names []string
+	for p, err := range e.AllProjects(ctx, &ListProjectsOptions{ListOptions: ListOptions{Limit: 2}}) {
+		require.NoError(t, err)
+		names = append(names, p.Name)
+	}
+	assert.Equal(t, []string{"tenant-1", "tenant-3", "tenant-4", "tenant-5"}, names)
+
+	var n int
+	for _, err := range e.AllProjects(ctx, &ListProjectsOptions{ListOptions: ListOptions{Limit: 1}, IncludeArchived: true}) {
+		require.NoError(t, err)
+		n++
+	}
+	assert.Equal(t, 5, n)
+
+	for _, err := range e.AllProjects(context.Background(), nil) {
+		assert.ErrorContains(t, err, "admin key required", "the error ends the iteration")
+	}
+}
+
+func TestCreateServiceAccount(t *testing.T) {
+	e := newOrganizationServer(t)
+	ctx := ContextWithCredential(context.Background(), StaticCredential("sk-admin"))
+	account, err := e.CreateServiceAccount(ctx, "proj_1", &CreateServiceAccountOptions{Name: "Production App"})
+	require.NoError(t, err)
+	assert.Equal(t, "svc_acct_abc", account.Id)
+	assert.Equal(t, "key_abc", account.APIKey.Id)
+	assert.Equal(t, testServiceAccountKey, account.APIKey.Value.Reveal())
+
+	// The key value doesn't leak when the account is printed, marshaled or logged
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("created", "key", account.APIKey.Value, "account", account)
+	b, err := json.Marshal(account)
+	require.NoError(t, err)
+	for _, out := range []string{
+		fmt.Sprint(account), fmt.Sprintf("%+v", account), fmt.Sprintf("%#v", account), string(b), buf.String(),
+	} {
+		assert.NotContains(t, out, testServiceAccountKey)
+		assert.Contains(t, out, "[REDACTED]")
+	}
+}
+
+func TestProjectRateLimits(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /organization/projects/proj_1/rate_limits":
+			assert.Equal(t, "rl-ada", r.URL.Query().Get("after"))
+			w.Write([]byte(`{"object":"list","data":[{"object":"project.rate_limit","id":"rl-gpt-4o","model":"gpt-4o","max_requests_per_1_minute":500,"max_tokens_per_1_minute":30000}],"first_id":"rl-gpt-4o","last_id":"rl-gpt-4o","has_more":false}`))
+		case "POST /organization/projects/proj_1/rate_limits/rl-gpt-4o":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			w.Write([]byte(`{"object":"project.rate_limit","id":"rl-gpt-4o","model":"gpt-4o","max_requests_per_1_minute":100,"max_tokens_per_1_minute":30000}`))
+		case "DELETE /organization/projects/proj_1/service_accounts/svc_acct_abc":
+			w.Write([]byte(`{"object":"organization.project.service_account.deleted","id":"svc_acct_abc","deleted":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(notFoundBody))
+		}
+	}))
+	defer srv.Close()
+	e := New("sk-admin")
+	e.apiBaseURL = srv.URL
+
+	var limits []ProjectRateLimit
+	for limit, err := range e.AllProjectRateLimits(context.Background(), "proj_1", &ListOptions{After: "rl-ada"}) {
+		require.NoError(t, err)
+		limits = append(limits, limit)
+	}
+	require.Len(t, limits, 1)
+	assert.Equal(t, 500, limits[0].MaxRequestsPer1Minute)
+
+	limit, err := e.ModifyProjectRateLimit(context.Background(), "proj_1", "rl-gpt-4o", &ModifyProjectRateLimitOptions{MaxRequestsPer1Minute: intPtr(100)})
+	require.NoError(t, err)
+	assert.Equal(t, 100, limit.MaxRequestsPer1Minute)
+	assert.Equal(t, map[string]interface{}{"max_requests_per_1_minute": float64(100)}, body, "unset limits are kept")
+
+	deleted, err := e.DeleteServiceAccount(context.Background(), "proj_1", "svc_acct_abc")
+	require.NoError(t, err)
+	assert.Equal(t, "svc_acct_abc", deleted.Id)
+}
+
+func TestProjectAPIKeys(t *testing.T) {
+	var auth []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		switch r.Method + " " + r.URL.Path {
+		case "GET /organization/projects/proj_1/api_keys":
+			if r.URL.Query().Get("after") == "" {
+				w.Write([]byte(`{"object":"list","data":[{"object":"organization.project.api_key","id":"key_abc","name":"My API Key","redacted_value":"sk-abc...def","created_at":1711471533,
+					"owner":{"type":"user","user":{"object":"organization.project.user","id":"user_abc","name":"First Last","email":"user@example.com","role":"owner","created_at":1711471533}}}],
+					"first_id":"key_abc","last_id":"key_abc","has_more":true}`))
+				return
+			}
+			assert.Equal(t, "key_abc", r.URL.Query().Get("after"))
+			w.Write([]byte(`{"object":"list","data":[{"object":"organization.project.api_key","id":"key_xyz","name":"Secret Key","redacted_value":"sk-xyz...uvw","created_at":1711471534,
+				"owner":{"type":"service_account","service_account":{"object":"organization.project.service_account","id":"svc_acct_abc","name":"Production App","role":"member","created_at":1711471533}}}],
+				"first_id":"key_xyz","last_id":"key_xyz","has_more":false}`))
+		case "DELETE /organization/projects/proj_1/api_keys/key_abc":
+			w.Write([]byte(`{"object":"organization.project.api_key.deleted","id":"key_abc","deleted":true}`))
+		case "GET /models":
+			w.Write([]byte(`{"object":"list","data":[]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(notFoundBody))
+		}
+	}))
+	defer srv.Close()
+	e := New("sk-project", WithAdminAPIKey("sk-admin"))
+	e.apiBaseURL = srv.URL
+
+	var keys []APIKey
+	for key, err := range e.AllProjectAPIKeys(context.Background(), "proj_1", nil) {
+		require.NoError(t, err)
+		keys = append(keys, key)
+	}
+	require.Len(t, keys, 2)
+	assert.Equal(t, "sk-abc...def", keys[0].RedactedValue)
+	assert.Equal(t, APIKeyOwnerUser, keys[0].Owner.Type)
+	require.NotNil(t, keys[0].Owner.User)
+	assert.Equal(t, "user@example.com", keys[0].Owner.User.Email)
+	assert.Equal(t, APIKeyOwnerServiceAccount, keys[1].Owner.Type)
+	require.NotNil(t, keys[1].Owner.ServiceAccount)
+	assert.Equal(t, "svc_acct_abc", keys[1].Owner.ServiceAccount.Id)
+
+	require.NoError(t, e.DeleteProjectAPIKey(context.Background(), "proj_1", "key_abc"))
+	err := e.DeleteProjectAPIKey(context.Background(), "proj_1", "key_missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = e.ListModels(context.Background())
+	require.NoError(t, err)
+	_, err = e.ListProjectAPIKeys(ContextWithCredential(context.Background(), StaticCredential("sk-other")), "proj_1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Bearer sk-admin", "Bearer sk-admin", "Bearer sk-admin", "Bearer sk-admin", "Bearer sk-project", "Bearer sk-other"}, auth,
+		"only the organization endpoints are authorized with the admin key, unless the credential is set for the request")
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ContextOverflow describes the chat completion request rejected because
+// the messages don't fit into the context window of the model.
+type ContextOverflow struct {
+	Model Model
+	// Copy of messages of the request, the strategy may modify it.
+	Messages []ChatMessage
+	// The error returned by the API.
+	Err APIError
+}
+
+// OverflowStrategy is used to reduce messages of the chat completion request which
+// failed with context_length_exceeded error. The request is retried once with the returned messages.
+type OverflowStrategy interface {
+	Reduce(ctx context.Context, overflow *ContextOverflow) ([]ChatMessage, error)
+}
+
+// WithOverflowStrategy is used to recover chat completions from context window overflows.
+// Recovery is attempted at most once per call, if the reduced request overflows again its error is returned.
+// The overflow error is returned as is if the strategy doesn't change the messages, e.g. if there are none to drop.
+func WithOverflowStrategy(strategy OverflowStrategy) EngineOption {
+	return func(e *Engine) {
+		e.overflow = strategy
+	}
+}
+
+type overflowRecoveryKey struct{}
+
+// withOverflowRecovery marks requests sent while recovering from the overflow, they are never recovered again.
+func withOverflowRecovery(ctx context.Context) context.Context {
+	return context.WithValue(ctx, overflowRecoveryKey{}, true)
+}
+
+func overflowRecoveryFrom(ctx context.Context) bool {
+	v, _ := ctx.Value(overflowRecoveryKey{}).(bool)
+	return v
+}
+
+func isContextLengthExceeded(err error) bool {
+	var apiErr APIError
+	return errors.As(err, &apiErr) && apiErr.Err.Code == "context_length_exceeded"
+}
+
+func (e *Engine) recoverOverflow(ctx context.Context, opts *ChatCompletionOptions, err error) (*ChatCompletionResponse, error) {
+	var apiErr APIError
+	errors.As(err, &apiErr)
+	ctx = withOverflowRecovery(ctx)
+	messages, reduceErr := e.overflow.Reduce(ctx, &ContextOverflow{
+		Model:    opts.Model,
+		Messages: append([]ChatMessage(nil), opts.Messages...),
+		Err:      apiErr,
+	})
+	if reduceErr != nil {
+		return nil, fmt.Errorf("reduce messages: %w (%v)", reduceErr, err)
+	}
+	if reflect.DeepEqual(messages, opts.Messages) {
+		return nil, err
+	}
+	reduced := *opts
+	reduced.Messages = messages
+	return e.chatCompletion(ctx, &reduced)
+}
+
+// DropOldest reduces messages by dropping the oldest turns. Leading system messages
+// and the last message are always kept.
+type DropOldest struct {
+	// Number of the most recent messages to keep after the leading system messages.
+	// If it's zero, half of them are kept.
+	Keep int
+}
+
+func (s DropOldest) Reduce(ctx context.Context, overflow *ContextOverflow) ([]ChatMessage, error) {
+	kept, _ := truncateMessages(overflow.Messages, s.Keep)
+	return kept, nil
+}
+
+// truncateMessages drops the oldest messages after the leading system messages, so at most keep
+// of them are left (half of them if keep is zero, at least one). The tool messages are kept along with
+// the assistant message whose tool calls they answer, so more of them are left if the cut would separate
+// them. It returns the kept and the dropped messages.
+func truncateMessages(messages []ChatMessage, keep int) (kept, dropped []ChatMessage) {
+	system := leadingSystemMessages(messages)
+	turns := messages[system:]
+	if keep <= 0 {
+		keep = len(turns) / 2
+	}
+	if keep < 1 {
+		keep = 1
+	}
+	if keep >= len(turns) {
+		return messages, nil
+	}
+	cut := len(turns) - keep
+	for cut > 0 && turns[cut].Role == "tool" {
+		cut--
+	}
+	if cut == 0 {
+		return messages, nil
+	}
+	kept = make([]ChatMessage, 0, len(messages)-cut)
+	kept = append(kept, messages[:system]...)
+	kept = append(kept, turns[cut:]...)
+	return kept, turns[:cut]
+}
+
+func leadingSystemMessages(messages []ChatMessage) int {
+	n := 0
+	for n < len(messages) && messages[n].Role == "system" {
+		n++
+	}
+	return n
+}
+
+// SummarizeWithModel reduces messages by replacing the oldest turns with a system note
+// which summarizes them, generated by a cheap model.
+type SummarizeWithModel struct {
+	// Engine used to generate the summary.
+	Engine *Engine
+	// Model which generates the summary, e.g. gpt-4o-mini.
+	Model Model
+	// Number of the most recent messages kept as they are, see DropOldest.
+	Keep int
+}
+
+const summarizePrompt = "Summarize the following conversation in a few sentences. " +
+	"Keep facts, decisions and open questions, which are needed to continue the conversation."
+
+func (s SummarizeWithModel) Reduce(ctx context.Context, overflow *ContextOverflow) ([]ChatMessage, error) {
+	kept, dropped := truncateMessages(overflow.Messages, s.Keep)
+	if len(dropped) == 0 {
+		return kept, nil
+	}
+	var transcript strings.Builder
+	for _, msg := range dropped {
+		fmt.Fprintf(&transcript, "%s: %s\n", msg.Role, msg.Content)
+	}
+	resp, err := s.Engine.ChatCompletion(ctx, &ChatCompletionOptions{
+		Model: s.Model,
+		Messages: []ChatMessage{
+			{Role: "system", Content: summarizePrompt},
+			{Role: "user", Content: transcript.String()},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("summarize: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("summarize: no choices")
+	}
+	// The note takes place of the dropped turns, after the leading system messages
+	system := leadingSystemMessages(kept)
+	note := ChatMessage{Role: "system", Content: "Summary of the earlier conversation: " + resp.Choices[0].Message.Content}
+	reduced := make([]ChatMessage, 0, len(kept)+1)
+	reduced = append(reduced, kept[:system]...)
+	reduced = append(reduced, note)
+	return append(reduced, kept[system:]...), nil
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const contextLengthExceeded = `{"error":{"message":"This model's maximum context length is 8192 tokens.","type":"invalid_request_error","code":"context_length_exceeded"}}`
+
+// newOverflowServer rejects chat completions of gpt-4 with more than maxMessages messages,
+// requests of other models are answered with a summary.
+func newOverflowServer(t *testing.T, maxMessages int, requests *[]ChatCompletionOptions) *Engine {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var opts ChatCompletionOptions
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&opts))
+		*requests = append(*requests, opts)
+		if opts.Model != ModelGPT4 {
+			w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"The user asked about cats."}}]}`))
+			return
+		}
+		if len(opts.Messages) > maxMessages {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(contextLengthExceeded))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	return e
+}
+
+func overflowMessages() []ChatMessage {
+	return []ChatMessage{
+		{Role: "system", Content: "You are helpful."},
+		{Role: "user", Content: "Tell me about cats."},
+		{Role: "assistant", Content: "Cats are small carnivores."},
+		{Role: "user", Content: "And dogs?"},
+		{Role: "assistant", Content: "Dogs are loyal."},
+		{Role: "user", Content: "Which is better?"},
+	}
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	var requests []ChatCompletionOptions
+	e := newOverflowServer(t, 4, &requests)
+	WithOverflowStrategy(DropOldest{})(e)
+
+	messages := overflowMessages()
+	r, err := e.ChatCompletion(context.Background(), &ChatCompletionOptions{Model: ModelGPT4, Messages: messages})
+	require.NoError(t, err)
+	assert.Equal(t, "ok", r.Choices[0].Message.Content)
+	require.Len(t, requests, 2)
+	assert.Equal(t, []ChatMessage{
+		{Role: "system", Content: "You are helpful."},
+		{Role: "assistant", Content: "Dogs are loyal."},
+		{Role: "user", Content: "Which is better?"},
+	}, requests[1].Messages)
+	assert.Equal(t, overflowMessages(), messages, "caller's messages must not be modified")
+}
+
+func TestOverflowRecoveredOnce(t *testing.T) {
+	var requests []ChatCompletionOptions
+	e := newOverflowServer(t, 0, &requests)
+	WithOverflowStrategy(DropOldest{Keep: 1})(e)
+
+	_, err := e.ChatCompletion(context.Background(), &ChatCompletionOptions{Model: ModelGPT4, Messages: overflowMessages()})
+	assert.True(t, isContextLengthExceeded(err))
+	assert.Len(t, requests, 2)
+}
+
+func TestOverflowWithoutStrategy(t *testing.T) {
+	var requests []ChatCompletionOptions
+	e := newOverflowServer(t, 0, &requests)
+
+	_, err := e.ChatCompletion(context.Background(), &ChatCompletionOptions{Model: ModelGPT4, Messages: overflowMessages()})
+	var apiErr APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "context_length_exceeded", apiErr.Err.Code)
+	assert.Len(t, requests, 1)
+}
+
+func TestOverflowSummarizeWithModel(t *testing.T) {
+	var requests []ChatCompletionOptions
+	e := newOverflowServer(t, 4, &requests)
+	WithOverflowStrategy(SummarizeWithModel{Engine: e, Model: "gpt-4o-mini", Keep: 2})(e)
+
+	messages := overflowMessages()
+	_, err := e.ChatCompletion(context.Background(), &ChatCompletionOptions{Model: ModelGPT4, Messages: messages})
+	require.NoError(t, err)
+	require.Len(t, requests, 3)
+
+	summary := requests[1]
+	assert.EqualValues(t, "gpt-4o-mini", summary.Model)
+	require.Len(t, summary.Messages, 2)
+	assert.True(t, strings.HasPrefix(summary.Messages[1].Content, "user: Tell me about cats.\n"))
+	assert.Contains(t, summary.Messages[1].Content, "user: And dogs?\n")
+	assert.NotContains(t, summary.Messages[1].Content, "Which is better?")
+
+	assert.Equal(t, []ChatMessage{
+		{Role: "system", Content: "You are helpful."},
+		{Role: "system", Content: "Summary of the earlier conversation: The user asked about cats."},
+		{Role: "assistant", Content: "Dogs are loyal."},
+		{Role: "user", Content: "Which is better?"},
+	}, requests[2].Messages)
+	assert.Equal(t, overflowMessages(), messages)
+}
+
+func TestTruncateMessages(t *testing.T) {
+	kept, dropped := truncateMessages(overflowMessages(), 0)
+	assert.Len(t, kept, 1+2)
+	assert.Len(t, dropped, 3)
+
+	kept, dropped = truncateMessages(overflowMessages(), 10)
+	assert.Equal(t, overflowMessages(), kept)
+	assert.Empty(t, dropped)
+
+	kept, _ = truncateMessages([]ChatMessage{{Role: "user", Content: "only"}}, 0)
+	assert.Equal(t, []ChatMessage{{Role: "user", Content: "only"}}, kept, "the last message is always kept")
+}
+
+func TestTruncateMessagesToolCalls(t *testing.T) {
+	messages := []ChatMessage{
+		{Role: "system", Content: "You are helpful."},
+		{Role: "user", Content: "Weather in Berlin and Paris?"},
+		{Role: "assistant", ToolCalls: []ToolCall{
+			{Id: "call_1", Type: "function", Function: ToolCallFunction{Name: "weather", Arguments: `{"city":"Berlin"}`}},
+			{Id: "call_2", Type: "function", Function: ToolCallFunction{Name: "weather", Arguments: `{"city":"Paris"}`}},
+		}},
+		{Role: "tool", ToolCallId: "call_1", Content: "20C"},
+		{Role: "tool", ToolCallId: "call_2", Content: "22C"},
+	}
+	kept, dropped := truncateMessages(messages, 1)
+	assert.Equal(t, messages[2:], kept[1:], "the tool calls are kept with their replies")
+	assert.Equal(t, messages[1:2], dropped)
+
+	kept, dropped = truncateMessages(messages[2:], 1)
+	assert.Equal(t, messages[2:], kept, "the tool calls can't be separated from their replies")
+	assert.Empty(t, dropped)
+}
+
+func TestOverflowNothingToDrop(t *testing.T) {
+	var requests []ChatCompletionOptions
+	e := newOverflowServer(t, 0, &requests)
+	WithOverflowStrategy(DropOldest{})(e)
+
+	_, err := e.ChatCompletion(context.Background(), &ChatCompletionOptions{Model: ModelGPT4, Messages: []ChatMessage{{Role: "user", Content: "only"}}})
+	assert.True(t, isContextLengthExceeded(err))
+	assert.Len(t, requests, 1, "the same request isn't sent again")
+}
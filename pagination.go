@@ -0,0 +1,75 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"iter"
+	"net/url"
+	"strconv"
+)
+
+// ListOptions is used to page through the objects of list endpoints.
+type ListOptions struct {
+	// The number of objects per page, between 1 and 100. The API default is used if it's zero.
+	Limit int `binding:"omitempty,min=1,max=100"`
+	// The cursor of the page, the ID of the object after which the page starts.
+	After string
+}
+
+func (o *ListOptions) query() url.Values {
+	q := url.Values{}
+	if o == nil {
+		return q
+	}
+	if o.Limit != 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.After != "" {
+		q.Set("after", o.After)
+	}
+	return q
+}
+
+// Page is the page of objects returned by list endpoints.
+type Page[T any] struct {
+	Object  string `json:"object"`
+	Data    []T    `json:"data"`
+	FirstId string `json:"first_id,omitempty"`
+	LastId  string `json:"last_id,omitempty"`
+	HasMore bool   `json:"has_more"`
+}
+
+// paginate iterates over the objects of all pages, starting with the page after the cursor.
+// The next page is only requested when the objects of the previous one were consumed.
+// The iteration stops on the first error, which is yielded with the zero object.
+func paginate[T any](ctx context.Context, after string, list func(ctx context.Context, after string) (*Page[T], error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for {
+			page, err := list(ctx, after)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, v := range page.Data {
+				if !yield(v, nil) {
+					return
+				}
+			}
+			if !page.HasMore || page.LastId == "" || page.LastId == after {
+				return
+			}
+			after = page.LastId
+		}
+	}
+}
+
+// withQuery returns uri with the query, if it's not empty.
+func withQuery(uri string, q url.Values) string {
+	if len(q) == 0 {
+		return uri
+	}
+	return uri + "?" + q.Encode()
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+)
+
+// ErrSystemMessageUnsupported is returned if the chat completion request has the system message
+// the model doesn't support, see ModelProfile.Instructions.
+var ErrSystemMessageUnsupported = errors.New("openai: system messages aren't supported by the model")
+
+// ModelProfile describes quirks of the model (or of the server which hosts it),
+// which require the chat completion request to be translated before sending.
+// The zero value is a passthrough profile which changes nothing.
+type ModelProfile struct {
+	// Name of the profile, used for logging.
+	Name string
+	// Send max_completion_tokens instead of max_tokens.
+	MaxCompletionTokens bool
+	// The model doesn't support sampling parameters: temperature, top_p,
+	// presence_penalty and frequency_penalty are dropped.
+	NoSampling bool
+	// Role to send system messages with, e.g. "developer". Empty leaves the role as is.
+	SystemRole string
+	// The server doesn't support parallel_tool_calls, it's dropped.
+	NoParallelToolCalls bool
+	// The model takes the system prompt in the top-level instructions instead of the system messages.
+	// The first system message of the text content is moved into instructions, unless they are set.
+	// The requests with other system messages fail with ErrSystemMessageUnsupported, unless SystemRole
+	// changes their role.
+	Instructions bool
+}
+
+// ProfileChange describes a single change of the request made by the model profile.
+type ProfileChange struct {
+	// Profile which made the change.
+	Profile string
+	// Field of the request, as it's named in JSON.
+	Field string
+	From  string
+	To    string
+}
+
+func (c ProfileChange) String() string {
+	return fmt.Sprintf("%s: %s %q -> %q", c.Profile, c.Field, c.From, c.To)
+}
+
+// Apply translates opts according to the profile. It returns a copy of opts with
+// the changes made, opts itself isn't modified.
+func (p ModelProfile) Apply(opts *ChatCompletionOptions) (*ChatCompletionOptions, []ProfileChange) {
+	out := *opts
+	var changes []ProfileChange
+	change := func(field, from, to string) {
+		changes = append(changes, ProfileChange{Profile: p.Name, Field: field, From: from, To: to})
+	}
+	if p.MaxCompletionTokens && out.MaxTokens != 0 {
+		if out.MaxCompletionTokens == 0 {
+			out.MaxCompletionTokens = out.MaxTokens
+			change("max_completion_tokens", "", fmt.Sprint(out.MaxTokens))
+		}
+		change("max_tokens", fmt.Sprint(out.MaxTokens), "")
+		out.MaxTokens = 0
+	}
+	if p.NoSampling {
+		for _, f := range []struct {
+			name string
+			v    *float32
+		}{
+			{"temperature", &out.Temperature},
+			{"top_p", &out.TopP},
+			{"presence_penalty", &out.PresencePenalty},
+			{"frequency_penalty", &out.FrequencyPenalty},
+		} {
+			if *f.v != 0 {
+				change(f.name, fmt.Sprint(*f.v), "")
+				*f.v = 0
+			}
+		}
+	}
+	if p.Instructions && out.Instructions == "" {
+		for i, m := range out.Messages {
+			if m.Role != "system" {
+				continue
+			}
+			if m.Parts == nil {
+				out.Messages = append(append([]ChatMessage(nil), out.Messages[:i]...), out.Messages[i+1:]...)
+				out.Instructions = m.Content
+				change(fmt.Sprintf("messages[%d].role", i), m.Role, "")
+				change("instructions", "", m.Content)
+			}
+			break
+		}
+	}
+	if p.SystemRole != "" {
+		copied := false
+		for i, m := range out.Messages {
+			if m.Role != "system" || m.Role == p.SystemRole {
+				continue
+			}
+			if !copied {
+				out.Messages = append([]ChatMessage(nil), out.Messages...)
+				copied = true
+			}
+			out.Messages[i].Role = p.SystemRole
+			change(fmt.Sprintf("messages[%d].role", i), m.Role, p.SystemRole)
+		}
+	}
+	if p.NoParallelToolCalls && out.ParallelToolCalls != nil {
+		change("parallel_tool_calls", fmt.Sprint(*out.ParallelToolCalls), "")
+		out.ParallelToolCalls = nil
+	}
+	return &out, changes
+}
+
+// ModelProfileRegistry maps model names to profiles.
+// Patterns are matched with path.Match, e.g. "o1*" or "llama-3-*".
+type ModelProfileRegistry struct {
+	mu      sync.RWMutex
+	entries []profileEntry
+}
+
+type profileEntry struct {
+	pattern string
+	profile ModelProfile
+}
+
+// Built-in profiles of the OpenAI model families.
+var (
+	// ProfileOpenAIChat is passthrough profile of GPT chat models.
+	ProfileOpenAIChat = ModelProfile{Name: "openai-chat"}
+	// ProfileOpenAIReasoning is profile of o-series reasoning models.
+	ProfileOpenAIReasoning = ModelProfile{
+		Name:                "openai-reasoning",
+		MaxCompletionTokens: true,
+		NoSampling:          true,
+		SystemRole:          "developer",
+	}
+	// ProfileOpenAIInstructions is profile of o1 and o3 reasoning models, which take the system prompt
+	// in the top-level instructions.
+	ProfileOpenAIInstructions = ModelProfile{
+		Name:                "openai-instructions",
+		MaxCompletionTokens: true,
+		NoSampling:          true,
+		Instructions:        true,
+	}
+)
+
+// NewModelProfileRegistry is used to initialize registry with profiles of the known OpenAI model families.
+func NewModelProfileRegistry() *ModelProfileRegistry {
+	r := &ModelProfileRegistry{}
+	for _, pattern := range []string{"gpt-3.5-turbo*", "gpt-4*"} {
+		r.Register(pattern, ProfileOpenAIChat)
+	}
+	r.Register("o4*", ProfileOpenAIReasoning)
+	for _, pattern := range []string{"o1*", "o3*"} {
+		r.Register(pattern, ProfileOpenAIInstructions)
+	}
+	return r
+}
+
+// Register registers profile for models matching pattern.
+// Profiles registered later take precedence, so built-in profiles can be overridden.
+func (r *ModelProfileRegistry) Register(pattern string, profile ModelProfile) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, profileEntry{pattern: pattern, profile: profile})
+	return nil
+}
+
+// Lookup returns profile of the model. Unknown models get the passthrough profile.
+func (r *ModelProfileRegistry) Lookup(model Model) ModelProfile {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		if ok, _ := path.Match(r.entries[i].pattern, string(model)); ok {
+			return r.entries[i].profile
+		}
+	}
+	return ModelProfile{Name: "passthrough"}
+}
+
+// builtinProfiles translate the requests of the engine without WithModelProfiles.
+var builtinProfiles = NewModelProfileRegistry()
+
+// WithModelProfiles is used to translate chat completion requests according to profile of the model.
+// Without it, the requests are translated by the built-in profiles of NewModelProfileRegistry.
+// The onChange callback is called with the changes made to every request, it may be nil.
+func WithModelProfiles(registry *ModelProfileRegistry, onChange func(model Model, changes []ProfileChange)) EngineOption {
+	return func(e *Engine) {
+		e.profiles = registry
+		e.onProfileChange = onChange
+	}
+}
+
+// translate applies profile of the model to opts. It returns ErrSystemMessageUnsupported
+// if the model doesn't support the remaining system messages.
+func (e *Engine) translate(opts *ChatCompletionOptions) (*ChatCompletionOptions, error) {
+	registry := e.profiles
+	if registry == nil {
+		registry = builtinProfiles
+	}
+	profile := registry.Lookup(opts.Model)
+	out, changes := profile.Apply(opts)
+	if len(changes) != 0 && e.onProfileChange != nil {
+		e.onProfileChange(opts.Model, changes)
+	}
+	if profile.Instructions {
+		for i, m := range out.Messages {
+			if m.Role == "system" {
+				return nil, fmt.Errorf("%w: messages[%d] of %s, set the instructions instead", ErrSystemMessageUnsupported, i, opts.Model)
+			}
+		}
+	}
+	return out, nil
+}
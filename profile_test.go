@@ -0,0 +1,180 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelProfiles(t *testing.T) {
+	parallel := true
+	newOpts := func(model Model) *ChatCompletionOptions {
+		return &ChatCompletionOptions{
+			Model:             model,
+			Temperature:       0.5,
+			MaxTokens:         100,
+			ParallelToolCalls: &parallel,
+			Messages: []ChatMessage{
+				{Role: "system", Content: "Be brief."},
+				{Role: "user", Content: "hello"},
+			},
+		}
+	}
+	testCases := []struct {
+		name     string
+		model    Model
+		expected string
+		changes  []ProfileChange
+	}{
+		{
+			name:  "openai chat is passthrough",
+			model: ModelGPT4,
+			expected: `{"model":"gpt-4","temperature":0.5,"max_tokens":100,"parallel_tool_calls":true,
+				"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"hello"}]}`,
+		},
+		{
+			name:  "openai reasoning",
+			model: "o4-mini",
+			expected: `{"model":"o4-mini","max_completion_tokens":100,"parallel_tool_calls":true,
+				"messages":[{"role":"developer","content":"Be brief."},{"role":"user","content":"hello"}]}`,
+			changes: []ProfileChange{
+				{"openai-reasoning", "max_completion_tokens", "", "100"},
+				{"openai-reasoning", "max_tokens", "100", ""},
+				{"openai-reasoning", "temperature", "0.5", ""},
+				{"openai-reasoning", "messages[0].role", "system", "developer"},
+			},
+		},
+		{
+			name:  "openai instructions",
+			model: "o3-mini",
+			expected: `{"model":"o3-mini","max_completion_tokens":100,"parallel_tool_calls":true,
+				"instructions":"Be brief.","messages":[{"role":"user","content":"hello"}]}`,
+			changes: []ProfileChange{
+				{"openai-instructions", "max_completion_tokens", "", "100"},
+				{"openai-instructions", "max_tokens", "100", ""},
+				{"openai-instructions", "temperature", "0.5", ""},
+				{"openai-instructions", "messages[0].role", "system", ""},
+				{"openai-instructions", "instructions", "", "Be brief."},
+			},
+		},
+		{
+			name:  "self-hosted",
+			model: "llama-3-70b",
+			expected: `{"model":"llama-3-70b","temperature":0.5,"max_tokens":100,
+				"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"hello"}]}`,
+			changes: []ProfileChange{
+				{"self-hosted", "parallel_tool_calls", "true", ""},
+			},
+		},
+		{
+			name:  "unknown model is passthrough",
+			model: "mistral-large",
+			expected: `{"model":"mistral-large","temperature":0.5,"max_tokens":100,"parallel_tool_calls":true,
+				"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"hello"}]}`,
+		},
+	}
+
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = mustReadAll(t, r)
+		w.Write([]byte(`{"id":"chatcmpl-1"}`))
+	}))
+	defer srv.Close()
+
+	registry := NewModelProfileRegistry()
+	require.NoError(t, registry.Register("llama-*", ModelProfile{Name: "self-hosted", NoParallelToolCalls: true}))
+	var changes []ProfileChange
+	e := New("test", WithModelProfiles(registry, func(_ Model, c []ProfileChange) {
+		changes = c
+	}))
+	e.apiBaseURL = srv.URL
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			changes = nil
+			opts := newOpts(tc.model)
+			_, err := e.ChatCompletion(context.Background(), opts)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(body))
+			assert.Equal(t, tc.changes, changes)
+			assert.Equal(t, newOpts(tc.model), opts, "options of the caller must not be modified")
+		})
+	}
+}
+
+func TestModelProfileRegistryOverride(t *testing.T) {
+	registry := NewModelProfileRegistry()
+	assert.Equal(t, "openai-instructions", registry.Lookup("o1-preview").Name)
+	require.NoError(t, registry.Register("o1-preview", ModelProfile{Name: "o1-preview", MaxCompletionTokens: true}))
+	assert.Equal(t, "o1-preview", registry.Lookup("o1-preview").Name)
+	assert.Equal(t, "openai-instructions", registry.Lookup("o1").Name)
+	assert.Equal(t, "openai-reasoning", registry.Lookup("o4-mini").Name)
+	assert.Error(t, registry.Register("[", ModelProfile{}))
+}
+
+func TestModelProfileInstructions(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = mustReadAll(t, r)
+		w.Write([]byte(`{"id":"chatcmpl-1"}`))
+	}))
+	defer srv.Close()
+	e := New("test", WithModelProfiles(NewModelProfileRegistry(), nil))
+	e.apiBaseURL = srv.URL
+
+	_, err := e.ChatCompletion(context.Background(), &ChatCompletionOptions{
+		Model:        "o1",
+		Instructions: "Be brief.",
+		Messages:     []ChatMessage{{Role: "user", Content: "hello"}},
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"model":"o1","max_completion_tokens":1024,"instructions":"Be brief.","messages":[{"role":"user","content":"hello"}]}`,
+		string(body), "the instructions are set directly")
+
+	body = nil
+	for _, messages := range [][]ChatMessage{
+		{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "hello"}, {Role: "system", Content: "Be polite."}},
+		{{Role: "system", Parts: []ContentPart{{Type: ContentPartText, Text: "Be brief."}}}, {Role: "user", Content: "hello"}},
+	} {
+		_, err = e.ChatCompletion(context.Background(), &ChatCompletionOptions{Model: "o3", Messages: messages})
+		assert.ErrorIs(t, err, ErrSystemMessageUnsupported)
+	}
+	_, err = e.ChatCompletion(context.Background(), &ChatCompletionOptions{
+		Model:        "o3",
+		Instructions: "Be brief.",
+		Messages:     []ChatMessage{{Role: "system", Content: "Be polite."}, {Role: "user", Content: "hello"}},
+	})
+	assert.EqualError(t, err, "openai: system messages aren't supported by the model: messages[0] of o3, set the instructions instead")
+	_, err = e.ChatCompletionStream(context.Background(), &ChatCompletionOptions{
+		Model:    "o3",
+		Messages: []ChatMessage{{Role: "user", Content: "hello"}, {Role: "system", Content: "Be brief."}, {Role: "system", Content: "Be polite."}},
+	})
+	assert.ErrorIs(t, err, ErrSystemMessageUnsupported)
+	assert.Nil(t, body, "the rejected requests aren't sent")
+}
+
+func TestModelProfileInstructionsWithoutRegistry(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = mustReadAll(t, r)
+		w.Write([]byte(`{"id":"chatcmpl-1"}`))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	_, err := e.ChatCompletion(context.Background(), &ChatCompletionOptions{
+		Model:    "o1",
+		Messages: []ChatMessage{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "hello"}},
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"model":"o1","max_completion_tokens":1024,"instructions":"Be brief.","messages":[{"role":"user","content":"hello"}]}`,
+		string(body), "the built-in profiles are applied")
+}
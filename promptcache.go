@@ -0,0 +1,214 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// minCachedPromptTokens is the minimum length of the prompt which is cached.
+	minCachedPromptTokens = 1024
+	// cachedPromptTokensIncrement is the granularity of the cached prefix of longer prompts.
+	cachedPromptTokensIncrement = 128
+)
+
+// volatilePatterns match content which typically differs between requests.
+var volatilePatterns = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{"timestamp", regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(:\d{2})?`)},
+	{"UUID", regexp.MustCompile(`(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)},
+}
+
+// PromptCacheFinding is the part of the prompt which defeats the prompt cache.
+type PromptCacheFinding struct {
+	// Path of the field, e.g. "messages[0].content".
+	Path string
+	// Reason why the field defeats the cache, e.g. "varies across requests".
+	Reason string
+}
+
+func (f PromptCacheFinding) String() string {
+	return f.Path + ": " + f.Reason
+}
+
+// PromptCacheReport is the result of PromptCacheLinter.
+type PromptCacheReport struct {
+	// Requests is the number of analyzed requests.
+	Requests int
+	// StableMessages is the number of leading messages which are the same in all requests.
+	StableMessages int
+	// StablePrefixTokens is the estimated number of leading prompt tokens
+	// which are the same in all requests.
+	StablePrefixTokens int
+	// CachedPrefixTokens is the estimated number of prompt tokens which can be served from the
+	// cache: the prefix is only cached if it's at least 1024 tokens long, in increments of 128 tokens.
+	CachedPrefixTokens int
+	// Findings are the fields which vary across requests, or look volatile, before the end
+	// of the stable prefix, and the volatile messages which aren't at the end.
+	Findings []PromptCacheFinding
+}
+
+// PromptCacheLinter analyzes chat completion requests for the prompt caching, which only
+// applies to the prompt prefix that is byte-identical across requests. Add the requests
+// made by the same code path, e.g. with different user input, and read the Report.
+//
+// The requests are analyzed as they are sent, with MoveVolatileMessages applied.
+//
+// Learn more: https://platform.openai.com/docs/guides/prompt-caching
+type PromptCacheLinter struct {
+	requests []*ChatCompletionOptions
+}
+
+// LintPromptCache is used to analyze the requests with PromptCacheLinter.
+func LintPromptCache(requests ...*ChatCompletionOptions) *PromptCacheReport {
+	var l PromptCacheLinter
+	for _, opts := range requests {
+		l.Add(opts)
+	}
+	return l.Report()
+}
+
+// Add adds the request to the analysis.
+func (l *PromptCacheLinter) Add(opts *ChatCompletionOptions) {
+	l.requests = append(l.requests, normalizePromptCache(opts))
+}
+
+// Report analyzes the added requests. A single request is only checked for volatile
+// content, e.g. timestamps and UUIDs, at the start of the prompt.
+func (l *PromptCacheLinter) Report() *PromptCacheReport {
+	report := &PromptCacheReport{Requests: len(l.requests)}
+	if len(l.requests) == 0 {
+		return report
+	}
+	first := l.requests[0]
+	for _, opts := range l.requests[1:] {
+		if opts.Model != first.Model {
+			report.Findings = append(report.Findings, PromptCacheFinding{"model", "varies across requests, the cache isn't shared between models"})
+			break
+		}
+	}
+
+	// The length of the prefix shared by all requests
+	prefix := promptCacheKey(first)
+	messages := len(first.Messages)
+	for _, opts := range l.requests[1:] {
+		prefix = commonPrefix(prefix, promptCacheKey(opts))
+		messages = min(messages, len(opts.Messages))
+	}
+	for i := 0; i < messages; i++ {
+		role, content := first.Messages[i].Role, messageContent(first.Messages[i])
+		var roleVaries, contentVaries bool
+		for _, opts := range l.requests[1:] {
+			roleVaries = roleVaries || opts.Messages[i].Role != role
+			contentVaries = contentVaries || messageContent(opts.Messages[i]) != content
+		}
+		if !roleVaries && !contentVaries && report.StableMessages == i {
+			report.StableMessages++
+		}
+		if roleVaries {
+			report.Findings = append(report.Findings, PromptCacheFinding{fmt.Sprintf("messages[%d].role", i), "varies across requests"})
+		}
+		if contentVaries {
+			report.Findings = append(report.Findings, PromptCacheFinding{fmt.Sprintf("messages[%d].content", i), "varies across requests"})
+		}
+	}
+	// Content which is the same in these requests may still vary over time, e.g. the date.
+	// The last message of the single request is the input, which is expected to vary.
+	checked := report.StableMessages
+	if len(l.requests) == 1 {
+		checked = len(first.Messages) - 1
+	}
+	for i := 0; i < checked; i++ {
+		if first.Messages[i].Volatile {
+			continue
+		}
+		content := messageContent(first.Messages[i])
+		for _, p := range volatilePatterns {
+			if p.re.MatchString(content) {
+				report.Findings = append(report.Findings, PromptCacheFinding{fmt.Sprintf("messages[%d].content", i), "contains " + p.kind})
+				break
+			}
+		}
+	}
+	for i, m := range first.Messages {
+		if m.Volatile && i < len(first.Messages)-1 && !first.Messages[i+1].Volatile {
+			report.Findings = append(report.Findings, PromptCacheFinding{fmt.Sprintf("messages[%d]", i), "is volatile, but isn't at the end, see MoveVolatileMessages"})
+		}
+	}
+
+	report.StablePrefixTokens = estimateInputTokens([]string{prefix})
+	if report.StablePrefixTokens >= minCachedPromptTokens {
+		report.CachedPrefixTokens = report.StablePrefixTokens / cachedPromptTokensIncrement * cachedPromptTokensIncrement
+	}
+	return report
+}
+
+// promptCacheKey approximates the prompt the model sees, which is cached by its prefix.
+func promptCacheKey(opts *ChatCompletionOptions) string {
+	var b strings.Builder
+	if opts.Instructions != "" {
+		b.WriteString("instructions\n")
+		b.WriteString(opts.Instructions)
+		b.WriteByte('\n')
+	}
+	for _, m := range opts.Messages {
+		b.WriteString(m.Role)
+		b.WriteByte('\n')
+		b.WriteString(messageContent(m))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// messageContent returns the content of the message, including its parts.
+func messageContent(m ChatMessage) string {
+	if m.Parts == nil {
+		return m.Content
+	}
+	var b strings.Builder
+	for _, part := range m.Parts {
+		b.WriteString(part.Text)
+		if part.ImageURL != nil {
+			b.WriteString(part.ImageURL.URL)
+		}
+	}
+	return b.String()
+}
+
+func commonPrefix(a, b string) string {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return a[:i]
+		}
+	}
+	return a[:n]
+}
+
+// normalizePromptCache returns opts with the volatile messages moved to the end
+// if MoveVolatileMessages is set. The messages of opts aren't modified.
+func normalizePromptCache(opts *ChatCompletionOptions) *ChatCompletionOptions {
+	if !opts.MoveVolatileMessages {
+		return opts
+	}
+	messages := make([]ChatMessage, 0, len(opts.Messages))
+	for _, m := range opts.Messages {
+		if !m.Volatile {
+			messages = append(messages, m)
+		}
+	}
+	for _, m := range opts.Messages {
+		if m.Volatile {
+			messages = append(messages, m)
+		}
+	}
+	out := *opts
+	out.Messages = messages
+	return &out
+}
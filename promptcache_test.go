@@ -0,0 +1,110 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var cachedInstructions = strings.Repeat("Answer questions about the product catalog. ", 150)
+
+// promptCacheRequests returns requests which start with the current time, followed by the
+// long instructions and the question.
+func promptCacheRequests(move bool) []*ChatCompletionOptions {
+	var requests []*ChatCompletionOptions
+	for i := 0; i < 3; i++ {
+		requests = append(requests, &ChatCompletionOptions{
+			Model: ModelGPT4,
+			Messages: []ChatMessage{
+				{Role: "system", Content: fmt.Sprintf("Current time: 2026-10-14T10:0%d:00Z", i), Volatile: true},
+				{Role: "system", Content: cachedInstructions},
+				{Role: "user", Content: fmt.Sprintf("Question %d?", i)},
+			},
+			MoveVolatileMessages: move,
+		})
+	}
+	return requests
+}
+
+func TestLintPromptCache(t *testing.T) {
+	original := LintPromptCache(promptCacheRequests(false)...)
+	assert.Equal(t, 3, original.Requests)
+	assert.Equal(t, 0, original.StableMessages)
+	assert.Less(t, original.StablePrefixTokens, 16)
+	assert.Equal(t, 0, original.CachedPrefixTokens)
+	assert.Contains(t, original.Findings, PromptCacheFinding{"messages[0].content", "varies across requests"})
+	assert.Contains(t, original.Findings, PromptCacheFinding{"messages[0]", "is volatile, but isn't at the end, see MoveVolatileMessages"})
+
+	reordered := LintPromptCache(promptCacheRequests(true)...)
+	assert.Equal(t, 1, reordered.StableMessages)
+	assert.Greater(t, reordered.StablePrefixTokens, estimateInputTokens([]string{cachedInstructions}))
+	assert.GreaterOrEqual(t, reordered.CachedPrefixTokens, minCachedPromptTokens)
+	assert.Zero(t, reordered.CachedPrefixTokens%cachedPromptTokensIncrement)
+	assert.LessOrEqual(t, reordered.CachedPrefixTokens, reordered.StablePrefixTokens)
+	assert.Equal(t, []PromptCacheFinding{
+		{"messages[1].content", "varies across requests"},
+		{"messages[2].content", "varies across requests"},
+	}, reordered.Findings)
+}
+
+func TestLintPromptCacheSingleRequest(t *testing.T) {
+	report := LintPromptCache(&ChatCompletionOptions{
+		Model: ModelGPT4,
+		Messages: []ChatMessage{
+			{Role: "system", Content: "Request 0b6a8f7e-52d4-4c1b-9f3e-2a7d5c8e1f60"},
+			{Role: "system", Content: cachedInstructions},
+			{Role: "user", Content: "Today is 2026-10-14 10:00"},
+		},
+	})
+	assert.Equal(t, 3, report.StableMessages)
+	assert.Equal(t, []PromptCacheFinding{{"messages[0].content", "contains UUID"}}, report.Findings,
+		"the last message is the input")
+	assert.Equal(t, "messages[0].content: contains UUID", report.Findings[0].String())
+
+	report = LintPromptCache(&ChatCompletionOptions{Model: ModelGPT4}, &ChatCompletionOptions{Model: ModelGPT3Dot5Turbo})
+	assert.Equal(t, []PromptCacheFinding{{"model", "varies across requests, the cache isn't shared between models"}}, report.Findings)
+}
+
+func TestMoveVolatileMessages(t *testing.T) {
+	var body struct {
+		Messages []ChatMessage `json:"messages"`
+	}
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Write([]byte(`{"id":"chatcmpl-1","usage":{"prompt_tokens":1600,"completion_tokens":5,"total_tokens":1605,"prompt_tokens_details":{"cached_tokens":1536}}}`))
+	})
+	c := &cachedTokensCollector{}
+	e := New("test", WithMetrics(c))
+	e.apiBaseURL = srv.URL
+
+	opts := promptCacheRequests(true)[0]
+	resp, err := e.ChatCompletion(context.Background(), opts)
+	require.NoError(t, err)
+	require.Len(t, body.Messages, 3)
+	assert.Equal(t, cachedInstructions, body.Messages[0].Content)
+	assert.Equal(t, "Question 0?", body.Messages[1].Content)
+	assert.Equal(t, "Current time: 2026-10-14T10:00:00Z", body.Messages[2].Content)
+	assert.True(t, opts.Messages[0].Volatile, "the options aren't modified")
+
+	assert.Equal(t, 1536, resp.Usage.CachedTokens())
+	assert.Equal(t, []int{1536}, c.cached)
+	assert.Zero(t, Usage{}.CachedTokens())
+}
+
+type cachedTokensCollector struct {
+	testCollector
+	cached []int
+}
+
+func (c *cachedTokensCollector) RecordCachedTokens(model string, cachedTokens int) {
+	c.cached = append(c.cached, cachedTokens)
+}
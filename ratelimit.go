@@ -0,0 +1,167 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenRateLimiter limits the number of tokens sent per minute (TPM).
+// The budget is refilled continuously, so up to tokensPerMinute tokens
+// can be sent at once after a minute of inactivity.
+//
+// Every request reserves the estimated number of tokens, the reservation is
+// reconciled with the actual usage reported by the API afterwards, so errors
+// of the estimation don't accumulate.
+type TokenRateLimiter struct {
+	mu        sync.Mutex
+	limit     float64
+	available float64
+	last      time.Time
+	clock     Clock
+}
+
+// TokenReservation is the number of tokens reserved by the request.
+type TokenReservation struct {
+	limiter *TokenRateLimiter
+	tokens  int
+}
+
+// NewTokenRateLimiter is used to initialize limiter with the budget of tokensPerMinute.
+// If tokensPerMinute isn't positive, the limiter is unlimited: it never waits.
+func NewTokenRateLimiter(tokensPerMinute int) *TokenRateLimiter {
+	return &TokenRateLimiter{
+		limit:     float64(tokensPerMinute),
+		available: float64(tokensPerMinute),
+	}
+}
+
+// SetClock is used to set the clock of the limiter, the clock of the engine
+// is used if it's not set, or the system clock outside of the engine.
+func (l *TokenRateLimiter) SetClock(clock Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clock = clock
+}
+
+// WithEmbeddingsTokenLimit is used to limit tokens per minute sent to the embeddings endpoint.
+func WithEmbeddingsTokenLimit(limiter *TokenRateLimiter) EngineOption {
+	return func(e *Engine) {
+		e.embeddingsLimiter = limiter
+	}
+}
+
+// Wait blocks until the budget allows to send the given number of tokens and reserves them.
+// Requests of more tokens than the whole budget are let through once the budget is full.
+func (l *TokenRateLimiter) Wait(ctx context.Context, tokens int) (*TokenReservation, error) {
+	if l.unlimited() {
+		return &TokenReservation{limiter: l, tokens: tokens}, nil
+	}
+	for {
+		l.mu.Lock()
+		l.refill()
+		need := float64(tokens)
+		if need > l.limit {
+			need = l.limit
+		}
+		if l.available >= need {
+			l.available -= float64(tokens)
+			l.mu.Unlock()
+			return &TokenReservation{limiter: l, tokens: tokens}, nil
+		}
+		wait := time.Duration((need - l.available) / l.limit * float64(time.Minute))
+		clock := clockOrSystem(l.clock)
+		l.mu.Unlock()
+		if err := clock.Sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Reconcile replaces the reserved number of tokens with the actual usage.
+// It must be called at most once.
+func (r *TokenReservation) Reconcile(actualTokens int) {
+	l := r.limiter
+	if l.unlimited() {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	l.available += float64(r.tokens - actualTokens)
+	if l.available > l.limit {
+		l.available = l.limit
+	}
+}
+
+// Utilization returns the used fraction of the budget, between 0 and 1.
+func (l *TokenRateLimiter) Utilization() float64 {
+	if l.unlimited() {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	u := 1 - l.available/l.limit
+	if u > 1 {
+		u = 1
+	}
+	return u
+}
+
+// Available returns the number of tokens which can be sent right now.
+// It's negative when the actual usage exceeded the budget, and math.MaxInt if the limiter is unlimited.
+func (l *TokenRateLimiter) Available() int {
+	if l.unlimited() {
+		return math.MaxInt
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	return int(l.available)
+}
+
+// unlimited reports whether the limiter was initialized without the budget. The limit isn't
+// changed after the initialization, so it's read without the lock.
+func (l *TokenRateLimiter) unlimited() bool {
+	return l.limit <= 0
+}
+
+func (l *TokenRateLimiter) refill() {
+	now := clockOrSystem(l.clock).Now()
+	if !l.last.IsZero() {
+		l.available += now.Sub(l.last).Minutes() * l.limit
+		if l.available > l.limit {
+			l.available = l.limit
+		}
+	}
+	l.last = now
+}
+
+// inputTokens returns the number of tokens of inputs counted by the tokenizer of the model,
+// or estimated if the tokenizer of the model isn't known, see estimateInputTokens.
+func inputTokens(model Model, inputs []string) int {
+	count, err := tokenCounter(model)
+	if err != nil {
+		return estimateInputTokens(inputs)
+	}
+	var n int
+	for _, s := range inputs {
+		n += count(s)
+	}
+	return n
+}
+
+// estimateInputTokens estimates the number of tokens of inputs,
+// which is about 4 characters per token for English text.
+func estimateInputTokens(inputs []string) int {
+	var n int
+	for _, s := range inputs {
+		n += (len(s) + 3) / 4
+	}
+	return n
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAutoClock returns the test clock which advances on sleeps.
+func newAutoClock() *TestClock {
+	clock := NewTestClock(time.Unix(1700000000, 0))
+	clock.SetAutoAdvance(true)
+	return clock
+}
+
+func TestEmbeddingsTokenLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every batch actually uses 10 tokens more than reserved
+		w.Write([]byte(`{"data":[{"index":0,"embedding":[0.1]}],"usage":{"prompt_tokens":50,"total_tokens":50}}`))
+	}))
+	defer srv.Close()
+
+	clock := newAutoClock()
+	limiter := NewTokenRateLimiter(100)
+	e := New("test", WithEmbeddingsTokenLimit(limiter), WithClock(clock))
+	e.apiBaseURL = srv.URL
+
+	batch := &EmbeddingsOptions{
+		Model: ModelTextEmbedding3Small,
+		Input: []string{strings.Repeat(" x", 40)}, // 40 tokens of cl100k_base, 20 by the estimate
+	}
+	assert.Equal(t, 20, inputTokens("unknown-embeddings-model", batch.Input), "the estimate without the tokenizer")
+
+	// 100 - 40 reserved, reconciled to 100 - 50
+	_, err := e.Embeddings(context.Background(), batch)
+	require.NoError(t, err)
+	assert.Equal(t, 50, limiter.Available())
+	assert.Equal(t, 0.5, limiter.Utilization())
+
+	// 50 - 40 reserved, reconciled to 50 - 50
+	_, err = e.Embeddings(context.Background(), batch)
+	require.NoError(t, err)
+	assert.Equal(t, 0, limiter.Available())
+	assert.Empty(t, clock.Slept())
+
+	// 40 tokens are refilled in 24 seconds, reconciled to -10
+	_, err = e.Embeddings(context.Background(), batch)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{24 * time.Second}, clock.Slept())
+	assert.Equal(t, -10, limiter.Available())
+	assert.Equal(t, 1.0, limiter.Utilization())
+
+	// The overuse is carried over to the next minute
+	clock.Advance(time.Minute)
+	assert.Equal(t, 90, limiter.Available())
+	assert.InDelta(t, 0.1, limiter.Utilization(), 1e-9)
+}
+
+func TestTokenRateLimiterRefundOnError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"bad input","type":"invalid_request_error"}}`))
+	}))
+	defer srv.Close()
+
+	limiter := NewTokenRateLimiter(100)
+	limiter.SetClock(newAutoClock())
+	e := New("test", WithEmbeddingsTokenLimit(limiter))
+	e.apiBaseURL = srv.URL
+
+	_, err := e.Embeddings(context.Background(), &EmbeddingsOptions{
+		Model: ModelTextEmbedding3Small,
+		Input: []string{strings.Repeat("a", 160)},
+	})
+	require.Error(t, err)
+	assert.Equal(t, 100, limiter.Available())
+}
+
+func TestTokenRateLimiterUnlimited(t *testing.T) {
+	for _, tokensPerMinute := range []int{0, -1} {
+		limiter := NewTokenRateLimiter(tokensPerMinute)
+		limiter.SetClock(NewTestClock(time.Unix(0, 0)))
+		reservation, err := limiter.Wait(context.Background(), 1000)
+		require.NoError(t, err, "the unlimited limiter doesn't wait")
+		reservation.Reconcile(2000)
+		assert.Equal(t, math.MaxInt, limiter.Available())
+		assert.Zero(t, limiter.Utilization())
+	}
+}
@@ -0,0 +1,683 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Realtime models support low-latency, multimodal conversations over WebSocket.
+//
+// Learn more: https://platform.openai.com/docs/guides/realtime
+const (
+	ModelGPT4oRealtimePreview Model = "gpt-4o-realtime-preview"
+)
+
+// Client events of the Realtime API.
+const (
+	ClientEventSessionUpdate            = "session.update"
+	ClientEventInputAudioBufferAppend   = "input_audio_buffer.append"
+	ClientEventInputAudioBufferCommit   = "input_audio_buffer.commit"
+	ClientEventInputAudioBufferClear    = "input_audio_buffer.clear"
+	ClientEventConversationItemCreate   = "conversation.item.create"
+	ClientEventConversationItemTruncate = "conversation.item.truncate"
+	ClientEventConversationItemDelete   = "conversation.item.delete"
+	ClientEventResponseCreate           = "response.create"
+	ClientEventResponseCancel           = "response.cancel"
+)
+
+// Server events of the Realtime API.
+const (
+	ServerEventError                               = "error"
+	ServerEventSessionCreated                      = "session.created"
+	ServerEventSessionUpdated                      = "session.updated"
+	ServerEventConversationCreated                 = "conversation.created"
+	ServerEventConversationItemCreated             = "conversation.item.created"
+	ServerEventConversationItemTranscriptionDone   = "conversation.item.input_audio_transcription.completed"
+	ServerEventConversationItemTranscriptionFailed = "conversation.item.input_audio_transcription.failed"
+	ServerEventConversationItemTruncated           = "conversation.item.truncated"
+	ServerEventConversationItemDeleted             = "conversation.item.deleted"
+	ServerEventInputAudioBufferCommitted           = "input_audio_buffer.committed"
+	ServerEventInputAudioBufferCleared             = "input_audio_buffer.cleared"
+	ServerEventInputAudioBufferSpeechStarted       = "input_audio_buffer.speech_started"
+	ServerEventInputAudioBufferSpeechStopped       = "input_audio_buffer.speech_stopped"
+	ServerEventResponseCreated                     = "response.created"
+	ServerEventResponseDone                        = "response.done"
+	ServerEventResponseOutputItemAdded             = "response.output_item.added"
+	ServerEventResponseOutputItemDone              = "response.output_item.done"
+	ServerEventResponseContentPartAdded            = "response.content_part.added"
+	ServerEventResponseContentPartDone             = "response.content_part.done"
+	ServerEventResponseTextDelta                   = "response.text.delta"
+	ServerEventResponseTextDone                    = "response.text.done"
+	ServerEventResponseAudioTranscriptDelta        = "response.audio_transcript.delta"
+	ServerEventResponseAudioTranscriptDone         = "response.audio_transcript.done"
+	ServerEventResponseAudioDelta                  = "response.audio.delta"
+	ServerEventResponseAudioDone                   = "response.audio.done"
+	ServerEventResponseFunctionCallArgumentsDelta  = "response.function_call_arguments.delta"
+	ServerEventResponseFunctionCallArgumentsDone   = "response.function_call_arguments.done"
+	ServerEventRateLimitsUpdated                   = "rate_limits.updated"
+)
+
+// RealTimeSessionOptions is the configuration of the session. Only the set fields are updated by session.update.
+type RealTimeSessionOptions struct {
+	// The set of modalities the model can respond with, e.g. ["text", "audio"].
+	Modalities []string `json:"modalities,omitempty"`
+	// The default system instructions prepended to model calls.
+	Instructions string `json:"instructions,omitempty"`
+	// The voice the model uses to respond, e.g. alloy, echo or shimmer.
+	Voice string `json:"voice,omitempty"`
+	// The format of input audio: pcm16, g711_ulaw, or g711_alaw.
+	InputAudioFormat string `json:"input_audio_format,omitempty"`
+	// The format of output audio: pcm16, g711_ulaw, or g711_alaw.
+	OutputAudioFormat string `json:"output_audio_format,omitempty"`
+	// Configuration of the input audio transcription, which is off by default.
+	InputAudioTranscription *AudioTranscriptionConfig `json:"input_audio_transcription,omitempty"`
+	// Configuration of the turn detection.
+	TurnDetection *TurnDetectionConfig `json:"turn_detection,omitempty"`
+	// Tools (functions) available to the model.
+	Tools []Tool `json:"tools,omitempty"`
+	// How the model chooses tools.
+	ToolChoice ToolChoice `json:"tool_choice,omitempty"`
+	// Sampling temperature for the model, between 0.6 and 1.2.
+	Temperature float64 `json:"temperature,omitempty"`
+	// Maximum number of output tokens for a single assistant response, inclusive of tool calls.
+	// Nil means no limit.
+	MaxResponseOutputTokens *int `json:"max_response_output_tokens,omitempty"`
+	// Whether the in-progress response is canceled when the user starts speaking (barge-in).
+	// It's handled by the client and only applies to options passed to NewRealTimeSession.
+	AutoCancelOnSpeech bool `json:"-"`
+}
+
+// AudioTranscriptionConfig is the configuration of the input audio transcription.
+type AudioTranscriptionConfig struct {
+	// The model to use for transcription, e.g. whisper-1.
+	Model Model `json:"model"`
+}
+
+// Types of the turn detection.
+const (
+	// TurnDetectionServerVAD detects start and end of speech based on the audio volume.
+	TurnDetectionServerVAD = "server_vad"
+	// TurnDetectionNone turns off the turn detection, the input audio buffer has to be
+	// committed and the response requested by the client.
+	TurnDetectionNone = "none"
+)
+
+// TurnDetectionConfig is the configuration of the voice activity detection.
+type TurnDetectionConfig struct {
+	// Type of the turn detection: server_vad or none.
+	Type string `json:"type"`
+	// Activation threshold for VAD, between 0.0 and 1.0.
+	Threshold float64 `json:"threshold,omitempty"`
+	// Amount of audio to include before speech starts, in milliseconds.
+	PrefixPaddingMs int `json:"prefix_padding_ms,omitempty"`
+	// Duration of silence to detect speech stop, in milliseconds.
+	SilenceDurationMs int `json:"silence_duration_ms,omitempty"`
+	// Whether the response is created automatically when the end of speech is detected.
+	// The server creates it if it's nil.
+	CreateResponse *bool `json:"create_response,omitempty"`
+}
+
+// MarshalJSON encodes the turn detection of type none as null, which is how the API turns it off.
+func (c TurnDetectionConfig) MarshalJSON() ([]byte, error) {
+	if c.Type == TurnDetectionNone {
+		return []byte("null"), nil
+	}
+	type config TurnDetectionConfig
+	return json.Marshal(config(c))
+}
+
+// RealTimeSessionObject is the session configuration reported by the server.
+type RealTimeSessionObject struct {
+	Id     string `json:"id"`
+	Object string `json:"object"`
+	Model  Model  `json:"model"`
+	RealTimeSessionOptions
+}
+
+func (s *RealTimeSessionObject) UnmarshalJSON(b []byte) error {
+	type object RealTimeSessionObject
+	v := struct {
+		*object
+		// The server reports "inf" if there is no limit
+		MaxResponseOutputTokens json.RawMessage `json:"max_response_output_tokens"`
+	}{object: (*object)(s)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	s.MaxResponseOutputTokens = nil
+	var limit int
+	if json.Unmarshal(v.MaxResponseOutputTokens, &limit) == nil {
+		s.MaxResponseOutputTokens = &limit
+	}
+	return nil
+}
+
+type RealTimeResponseOptions struct {
+	// The set of modalities the model can respond with, e.g. ["text", "audio"].
+	Modalities []string `json:"modalities,omitempty"`
+	// Instructions for this response only.
+	Instructions string `json:"instructions,omitempty"`
+	// The voice the model uses to respond.
+	Voice string `json:"voice,omitempty"`
+	// Sampling temperature for the response.
+	Temperature float64 `json:"temperature,omitempty"`
+	// Key-value pairs attached to the response, they're echoed in the response events.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Types of conversation items.
+const (
+	ConversationItemMessage            = "message"
+	ConversationItemFunctionCall       = "function_call"
+	ConversationItemFunctionCallOutput = "function_call_output"
+)
+
+// Types of content parts of conversation items.
+const (
+	ContentPartInputText  = "input_text"
+	ContentPartInputAudio = "input_audio"
+	ContentPartText       = "text"
+	ContentPartAudio      = "audio"
+)
+
+// ConversationItem is an item of the conversation: a message, a function call, or its output.
+type ConversationItem struct {
+	// The unique ID of the item, generated by the server if it's empty.
+	Id string `json:"id,omitempty"`
+	// The type of the item: message, function_call, or function_call_output.
+	Type string `json:"type"`
+	// The status of the item reported by the server: completed, incomplete, or in_progress.
+	Status string `json:"status,omitempty"`
+	// The role of the message sender: user, assistant, or system.
+	Role string `json:"role,omitempty"`
+	// The content of the message.
+	Content []ConversationItemContent `json:"content,omitempty"`
+	// The ID of the function call of function_call and function_call_output items.
+	CallId string `json:"call_id,omitempty"`
+	// The name of the function of function_call item.
+	Name string `json:"name,omitempty"`
+	// The JSON-encoded arguments of function_call item.
+	Arguments string `json:"arguments,omitempty"`
+	// The output of function_call_output item.
+	Output string `json:"output,omitempty"`
+}
+
+// FunctionCall is the call of the function requested by the model.
+type FunctionCall struct {
+	// The ID of the call, the output is submitted with it.
+	CallId string
+	// The name of the function.
+	Name string
+	// The JSON-encoded arguments of the call.
+	Arguments string
+}
+
+// ConversationItemContent is a content part of the message. Only fields of the given content type are set.
+type ConversationItemContent struct {
+	// The content type: input_text, input_audio, text, or audio.
+	Type string `json:"type"`
+	// The text of input_text and text content.
+	Text string `json:"text,omitempty"`
+	// Base64-encoded audio of input_audio content.
+	Audio string `json:"audio,omitempty"`
+	// The transcript of input_audio and audio content.
+	Transcript string `json:"transcript,omitempty"`
+}
+
+// ClientEvent is an event sent by the client. Only fields of the given event type are set.
+//
+// Docs: https://platform.openai.com/docs/api-reference/realtime-client-events
+type ClientEvent struct {
+	Type    string `json:"type"`
+	EventId string `json:"event_id,omitempty"`
+	// Session configuration of session.update.
+	Session *RealTimeSessionOptions `json:"session,omitempty"`
+	// Base64-encoded audio of input_audio_buffer.append.
+	Audio string `json:"audio,omitempty"`
+	// Item of conversation.item.create.
+	Item *ConversationItem `json:"item,omitempty"`
+	// ID of the item after which the item is inserted by conversation.item.create.
+	PreviousItemId string `json:"previous_item_id,omitempty"`
+	// ID of the item of conversation.item.truncate and conversation.item.delete.
+	ItemId string `json:"item_id,omitempty"`
+	// Index of the content part and the duration of the audio to keep, in milliseconds,
+	// of conversation.item.truncate. They are sent only with this event, where zero is a valid value.
+	ContentIndex int `json:"-"`
+	AudioEndMs   int `json:"-"`
+	// Response configuration of response.create.
+	Response *RealTimeResponseOptions `json:"response,omitempty"`
+}
+
+func (e ClientEvent) MarshalJSON() ([]byte, error) {
+	type event ClientEvent
+	if e.Type != ClientEventConversationItemTruncate {
+		return json.Marshal(event(e))
+	}
+	return json.Marshal(struct {
+		event
+		ContentIndex int `json:"content_index"`
+		AudioEndMs   int `json:"audio_end_ms"`
+	}{event(e), e.ContentIndex, e.AudioEndMs})
+}
+
+type RealTimeError struct {
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	Param   string `json:"param,omitempty"`
+	EventId string `json:"event_id,omitempty"`
+}
+
+func (e *RealTimeError) Error() string {
+	return fmt.Sprintf("realtime %s: %s", e.Type, e.Message)
+}
+
+type RealTimeRateLimit struct {
+	Name         string  `json:"name"`
+	Limit        int     `json:"limit"`
+	Remaining    int     `json:"remaining"`
+	ResetSeconds float64 `json:"reset_seconds"`
+}
+
+// ServerEvent is an event sent by the server. Only fields of the given event type are set,
+// the whole event is available in Raw.
+//
+// Docs: https://platform.openai.com/docs/api-reference/realtime-server-events
+type ServerEvent struct {
+	Type    string `json:"type"`
+	EventId string `json:"event_id"`
+	// Error details of the error event.
+	Error *RealTimeError `json:"error,omitempty"`
+	// Session of session.created and session.updated.
+	Session *RealTimeSessionObject `json:"session,omitempty"`
+	// Item of conversation.item.* and response.output_item.* events.
+	Item *ConversationItem `json:"item,omitempty"`
+	// Response of response.created and response.done.
+	Response       json.RawMessage `json:"response,omitempty"`
+	ResponseId     string          `json:"response_id,omitempty"`
+	ItemId         string          `json:"item_id,omitempty"`
+	PreviousItemId string          `json:"previous_item_id,omitempty"`
+	OutputIndex    int             `json:"output_index,omitempty"`
+	ContentIndex   int             `json:"content_index,omitempty"`
+	// Delta of the text, transcript, function call arguments, or base64-encoded audio.
+	Delta        string              `json:"delta,omitempty"`
+	Text         string              `json:"text,omitempty"`
+	Transcript   string              `json:"transcript,omitempty"`
+	CallId       string              `json:"call_id,omitempty"`
+	Name         string              `json:"name,omitempty"`
+	Arguments    string              `json:"arguments,omitempty"`
+	AudioStartMs int                 `json:"audio_start_ms,omitempty"`
+	AudioEndMs   int                 `json:"audio_end_ms,omitempty"`
+	RateLimits   []RealTimeRateLimit `json:"rate_limits,omitempty"`
+	Raw          json.RawMessage     `json:"-"`
+}
+
+// RealTimeSession is a WebSocket connection to the Realtime API.
+// Send may be called concurrently with Receive, but Receive must be called from a single goroutine.
+type RealTimeSession struct {
+	conn *websocket.Conn
+	mu   sync.Mutex // guards writes to conn
+
+	autoCancelOnSpeech bool
+	responding         bool // accessed by Receive only
+	streams            atomic.Uint64
+
+	hooksMu        sync.Mutex
+	onSpeechStart  func()
+	onFunctionCall func(ctx context.Context, call *FunctionCall) (string, error)
+
+	// ctx is canceled when the session is closed
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewRealTimeSession opens WebSocket connection to the Realtime API for the model.
+// If opts isn't nil, session.update event with the options is sent right after the connection is opened.
+// The connection is authorized the same way as the requests of engine, e.g. with the credential of ctx
+// (ContextWithCredential), the credential of the host (WithHostCredential) or the key pool (WithKeyPool).
+//
+// Docs: https://platform.openai.com/docs/guides/realtime
+func NewRealTimeSession(ctx context.Context, engine *Engine, model Model, opts *RealTimeSessionOptions) (*RealTimeSession, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = withRequestInfo(ctx, "/realtime", model)
+	u, err := url.Parse(engine.baseURL(ctx) + "/realtime")
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	}
+	u.RawQuery = url.Values{"model": []string{string(model)}}.Encode()
+
+	key, token, err := engine.authorize(ctx, u.Host)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	engine.setHeaders(ctx, header)
+	header.Set("Authorization", "Bearer "+token)
+	header.Set("OpenAI-Beta", "realtime=v1")
+	if len(engine.organizationId) != 0 {
+		header.Set("OpenAI-Organization", engine.organizationId)
+	}
+	engine.removeDeniedHeaders(header)
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, u.String(), header)
+	if key != nil {
+		engine.keys.report(key, resp)
+	}
+	if err != nil {
+		if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+			var apiErr APIError
+			if unmarshal(resp, &apiErr) == nil {
+				if apiErr.Err.StatusCode == 0 {
+					apiErr.Err.StatusCode = resp.StatusCode
+				}
+				return nil, apiErr
+			}
+		}
+		return nil, contextError(ctx, err)
+	}
+	s := &RealTimeSession{conn: conn}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	if opts != nil {
+		s.autoCancelOnSpeech = opts.AutoCancelOnSpeech
+		if err := s.UpdateSession(opts); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// UpdateSession sends session.update event, which updates the set fields of the session configuration.
+// The server confirms the update with session.updated event.
+//
+// Docs: https://platform.openai.com/docs/api-reference/realtime-client-events/session/update
+func (s *RealTimeSession) UpdateSession(opts *RealTimeSessionOptions) error {
+	return s.Send(&ClientEvent{Type: ClientEventSessionUpdate, Session: opts})
+}
+
+// Send sends event to the server.
+func (s *RealTimeSession) Send(event *ClientEvent) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.WriteMessage(websocket.TextMessage, b)
+}
+
+// SetTurnDetection updates only the turn detection of the session, other options are kept.
+// Nil config turns the turn detection off, like the config of type none.
+func (s *RealTimeSession) SetTurnDetection(config *TurnDetectionConfig) error {
+	if config == nil {
+		config = &TurnDetectionConfig{Type: TurnDetectionNone}
+	}
+	return s.UpdateSession(&RealTimeSessionOptions{TurnDetection: config})
+}
+
+// AppendMessage adds the item to the end of the conversation.
+//
+// Docs: https://platform.openai.com/docs/api-reference/realtime-client-events/conversation/item/create
+func (s *RealTimeSession) AppendMessage(msg *ConversationItem) error {
+	return s.Send(&ClientEvent{Type: ClientEventConversationItemCreate, Item: msg})
+}
+
+// TruncateMessage truncates audio of the assistant message, e.g. when the user interrupts
+// the playback. Audio after audioEnd milliseconds is removed along with its transcript.
+//
+// Docs: https://platform.openai.com/docs/api-reference/realtime-client-events/conversation/item/truncate
+func (s *RealTimeSession) TruncateMessage(itemId string, contentIndex int, audioEnd int) error {
+	return s.Send(&ClientEvent{
+		Type:         ClientEventConversationItemTruncate,
+		ItemId:       itemId,
+		ContentIndex: contentIndex,
+		AudioEndMs:   audioEnd,
+	})
+}
+
+// DeleteMessage removes the item from the conversation.
+//
+// Docs: https://platform.openai.com/docs/api-reference/realtime-client-events/conversation/item/delete
+func (s *RealTimeSession) DeleteMessage(itemId string) error {
+	return s.Send(&ClientEvent{Type: ClientEventConversationItemDelete, ItemId: itemId})
+}
+
+// CancelResponse cancels the in-progress response. The server responds with
+// response.done event with the cancelled status.
+//
+// Docs: https://platform.openai.com/docs/api-reference/realtime-client-events/response/cancel
+func (s *RealTimeSession) CancelResponse() error {
+	return s.Send(&ClientEvent{Type: ClientEventResponseCancel})
+}
+
+// OnSpeechStart sets the callback called by Receive when the server detects the start of speech
+// in the input audio buffer, e.g. to stop the playback of the response. It's called before
+// the event is returned and must not block.
+func (s *RealTimeSession) OnSpeechStart(fn func()) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.onSpeechStart = fn
+}
+
+// OnFunctionCall sets the handler of function calls requested by the model. When the arguments
+// of the call are done, the handler is run in its own goroutine and the returned output is submitted
+// with SubmitFunctionCallOutput. If the handler fails, {"error": "..."} is submitted instead, so the
+// model learns about the failure. The context of the handler is canceled when the session is closed.
+//
+// The model continues after the output is submitted once the response is requested with response.create.
+func (s *RealTimeSession) OnFunctionCall(handler func(ctx context.Context, call *FunctionCall) (string, error)) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.onFunctionCall = handler
+}
+
+// SubmitFunctionCallOutput adds the output of the function call to the conversation.
+//
+// Docs: https://platform.openai.com/docs/api-reference/realtime-client-events/conversation/item/create
+func (s *RealTimeSession) SubmitFunctionCallOutput(callId, output string) error {
+	return s.AppendMessage(&ConversationItem{
+		Type:   ConversationItemFunctionCallOutput,
+		CallId: callId,
+		Output: output,
+	})
+}
+
+func (s *RealTimeSession) callFunction(handler func(ctx context.Context, call *FunctionCall) (string, error), call *FunctionCall) {
+	output, err := handler(s.ctx, call)
+	if err != nil {
+		b, _ := json.Marshal(map[string]string{"error": err.Error()})
+		output = string(b)
+	}
+	// The session may be closed already, there is nobody to report the error to
+	s.SubmitFunctionCallOutput(call.CallId, output)
+}
+
+// Receive blocks until the next event is received from the server.
+// Error events are returned as events, not as errors.
+func (s *RealTimeSession) Receive() (*ServerEvent, error) {
+	_, b, err := s.conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	var event ServerEvent
+	if err := json.Unmarshal(b, &event); err != nil {
+		return nil, fmt.Errorf("decode server event: %w", err)
+	}
+	event.Raw = b
+	if err := s.handle(&event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// handle runs the client-side handling of the event before it's returned by Receive.
+func (s *RealTimeSession) handle(event *ServerEvent) error {
+	switch event.Type {
+	case ServerEventResponseCreated:
+		s.responding = true
+	case ServerEventResponseDone:
+		s.responding = false
+	case ServerEventResponseFunctionCallArgumentsDone:
+		s.hooksMu.Lock()
+		handler := s.onFunctionCall
+		s.hooksMu.Unlock()
+		if handler != nil {
+			go s.callFunction(handler, &FunctionCall{CallId: event.CallId, Name: event.Name, Arguments: event.Arguments})
+		}
+	case ServerEventInputAudioBufferSpeechStarted:
+		s.hooksMu.Lock()
+		fn := s.onSpeechStart
+		s.hooksMu.Unlock()
+		if fn != nil {
+			fn()
+		}
+		// Without the response in progress the server would reply with an error
+		if s.autoCancelOnSpeech && s.responding {
+			s.responding = false
+			if err := s.CancelResponse(); err != nil {
+				return fmt.Errorf("cancel response: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes the connection.
+func (s *RealTimeSession) Close() error {
+	s.cancel()
+	s.mu.Lock()
+	s.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	s.mu.Unlock()
+	return s.conn.Close()
+}
+
+// StreamAudio streams PCM16 audio chunks from input to the server, and writes PCM16 chunks of
+// the audio response to output. When input is closed, the input audio buffer is committed and
+// the response is requested. StreamAudio returns when the response is done, closing output.
+//
+// Error events of the server are returned as *RealTimeError. If ctx is done before the response
+// is finished, the connection can't be used anymore and should be closed.
+func (s *RealTimeSession) StreamAudio(ctx context.Context, input <-chan []byte, output chan<- []byte) error {
+	defer close(output)
+	ctx, cancel := context.WithCancel(ctx)
+	// Receive doesn't take a context, it's interrupted by the read deadline instead
+	stop := context.AfterFunc(ctx, func() {
+		s.conn.SetReadDeadline(time.Now())
+	})
+	var (
+		// The response requested by sendAudio is recognized by the metadata echoed in response.created,
+		// so responses created by the server on its own, e.g. on voice activity, don't finish the stream.
+		streamId   = strconv.FormatUint(s.streams.Add(1), 10)
+		responseId string
+		sendErr    = make(chan error, 1)
+		sendDone   = make(chan struct{})
+	)
+	go func() {
+		defer close(sendDone)
+		if err := s.sendAudio(ctx, input, streamId); err != nil {
+			sendErr <- err
+			cancel()
+		}
+	}()
+	defer func() {
+		stop()
+		cancel()
+		<-sendDone
+	}()
+
+	for {
+		event, err := s.Receive()
+		if err != nil {
+			select {
+			case err := <-sendErr:
+				return err
+			default:
+			}
+			return contextError(ctx, err)
+		}
+		switch event.Type {
+		case ServerEventError:
+			return event.Error
+		case ServerEventResponseAudioDelta:
+			chunk, err := base64.StdEncoding.DecodeString(event.Delta)
+			if err != nil {
+				return fmt.Errorf("decode audio delta: %w", err)
+			}
+			select {
+			case output <- chunk:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case ServerEventResponseCreated:
+			if response := parseStreamResponse(event.Response); response.Metadata[streamAudioMetadataKey] == streamId {
+				responseId = response.Id
+			}
+		case ServerEventResponseDone:
+			if responseId != "" && parseStreamResponse(event.Response).Id == responseId {
+				return nil
+			}
+		}
+	}
+}
+
+// streamAudioMetadataKey is the metadata key of the responses requested by StreamAudio.
+const streamAudioMetadataKey = "stream_audio_id"
+
+// streamResponse is the part of the response of the response events used by StreamAudio.
+type streamResponse struct {
+	Id       string            `json:"id"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+func parseStreamResponse(raw json.RawMessage) streamResponse {
+	var response streamResponse
+	json.Unmarshal(raw, &response)
+	return response
+}
+
+// sendAudio appends chunks of input to the input audio buffer until input is closed,
+// then commits the buffer and requests the response tagged with streamId.
+func (s *RealTimeSession) sendAudio(ctx context.Context, input <-chan []byte, streamId string) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case chunk, ok := <-input:
+			if !ok {
+				if err := s.Send(&ClientEvent{Type: ClientEventInputAudioBufferCommit}); err != nil {
+					return err
+				}
+				return s.Send(&ClientEvent{
+					Type:     ClientEventResponseCreate,
+					Response: &RealTimeResponseOptions{Metadata: map[string]string{streamAudioMetadataKey: streamId}},
+				})
+			}
+			if err := s.Send(&ClientEvent{
+				Type:  ClientEventInputAudioBufferAppend,
+				Audio: base64.StdEncoding.EncodeToString(chunk),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
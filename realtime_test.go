@@ -0,0 +1,447 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRealTimeTestServer starts fake Realtime API server, handler is called with every accepted connection.
+func newRealTimeTestServer(t *testing.T, handler func(t *testing.T, conn *websocket.Conn, r *http.Request)) *Engine {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		handler(t, conn, r)
+	}))
+	t.Cleanup(srv.Close)
+	e := New("test")
+	e.apiBaseURL = srv.URL + "/v1"
+	return e
+}
+
+func TestRealTimeSessionCredentials(t *testing.T) {
+	authorization := make(chan string, 1)
+	e := newRealTimeTestServer(t, func(t *testing.T, conn *websocket.Conn, r *http.Request) {
+		authorization <- r.Header.Get("Authorization")
+	})
+	WithKeyPool(NewKeyPool("sk-pool"))(e)
+
+	s, err := NewRealTimeSession(context.Background(), e, ModelGPT4oRealtimePreview, nil)
+	require.NoError(t, err)
+	s.Close()
+	assert.Equal(t, "Bearer sk-pool", <-authorization, "the key of the pool")
+
+	s, err = NewRealTimeSession(ContextWithCredential(context.Background(), StaticCredential("sk-ctx")), e, ModelGPT4oRealtimePreview, nil)
+	require.NoError(t, err)
+	s.Close()
+	assert.Equal(t, "Bearer sk-ctx", <-authorization, "the credential of the context takes precedence")
+}
+
+// readClientEvent reads the next client event as a map.
+func readClientEvent(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	t.Helper()
+	var event map[string]interface{}
+	require.NoError(t, conn.ReadJSON(&event))
+	return event
+}
+
+func TestRealTimeSession(t *testing.T) {
+	e := newRealTimeTestServer(t, func(t *testing.T, conn *websocket.Conn, r *http.Request) {
+		assert.Equal(t, "/v1/realtime", r.URL.Path)
+		assert.Equal(t, "gpt-4o-realtime-preview", r.URL.Query().Get("model"))
+		assert.Equal(t, "Bearer test", r.Header.Get("Authorization"))
+		assert.Equal(t, "realtime=v1", r.Header.Get("OpenAI-Beta"))
+
+		conn.WriteJSON(map[string]interface{}{
+			"type":     "session.created",
+			"event_id": "event_1",
+			"session":  map[string]interface{}{"id": "sess_1", "object": "realtime.session", "model": "gpt-4o-realtime-preview", "voice": "alloy"},
+		})
+		assert.Equal(t, map[string]interface{}{
+			"type":    "session.update",
+			"session": map[string]interface{}{"instructions": "Be brief.", "modalities": []interface{}{"text"}},
+		}, readClientEvent(t, conn))
+
+		assert.Equal(t, map[string]interface{}{
+			"type":     "response.create",
+			"response": map[string]interface{}{"instructions": "Say hi"},
+		}, readClientEvent(t, conn))
+		conn.WriteJSON(map[string]interface{}{
+			"type": "response.text.delta", "event_id": "event_2", "response_id": "resp_1", "item_id": "item_1", "delta": "Hi",
+		})
+		conn.WriteJSON(map[string]interface{}{
+			"type": "error", "event_id": "event_3", "error": map[string]interface{}{"type": "invalid_request_error", "message": "bad"},
+		})
+	})
+
+	s, err := NewRealTimeSession(context.Background(), e, ModelGPT4oRealtimePreview, &RealTimeSessionOptions{
+		Modalities:   []string{"text"},
+		Instructions: "Be brief.",
+	})
+	require.NoError(t, err)
+	defer s.Close()
+
+	event, err := s.Receive()
+	require.NoError(t, err)
+	assert.Equal(t, ServerEventSessionCreated, event.Type)
+	assert.Equal(t, "sess_1", event.Session.Id)
+	assert.Equal(t, "alloy", event.Session.Voice)
+
+	require.NoError(t, s.Send(&ClientEvent{
+		Type:     ClientEventResponseCreate,
+		Response: &RealTimeResponseOptions{Instructions: "Say hi"},
+	}))
+	event, err = s.Receive()
+	require.NoError(t, err)
+	assert.Equal(t, ServerEventResponseTextDelta, event.Type)
+	assert.Equal(t, "Hi", event.Delta)
+	assert.Equal(t, "resp_1", event.ResponseId)
+
+	event, err = s.Receive()
+	require.NoError(t, err)
+	assert.Equal(t, ServerEventError, event.Type)
+	assert.Equal(t, "bad", event.Error.Message)
+	var raw map[string]interface{}
+	require.NoError(t, json.Unmarshal(event.Raw, &raw))
+	assert.Equal(t, "event_3", raw["event_id"])
+}
+
+func TestRealTimeSessionUnauthorized(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":{"message":"Incorrect API key","type":"invalid_request_error"}}`))
+	}))
+	defer srv.Close()
+	e := New("bad")
+	e.apiBaseURL = srv.URL
+
+	_, err := NewRealTimeSession(context.Background(), e, ModelGPT4oRealtimePreview, nil)
+	var apiErr APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.Err.StatusCode)
+}
+
+func TestRealTimeSessionStreamAudio(t *testing.T) {
+	e := newRealTimeTestServer(t, func(t *testing.T, conn *websocket.Conn, r *http.Request) {
+		var received []byte
+		for {
+			event := readClientEvent(t, conn)
+			if event["type"] != ClientEventInputAudioBufferAppend {
+				assert.Equal(t, ClientEventInputAudioBufferCommit, event["type"])
+				break
+			}
+			chunk, err := base64.StdEncoding.DecodeString(event["audio"].(string))
+			require.NoError(t, err)
+			received = append(received, chunk...)
+		}
+		assert.Equal(t, []byte{1, 2, 3, 4, 5}, received)
+		create := readClientEvent(t, conn)
+		assert.Equal(t, ClientEventResponseCreate, create["type"])
+
+		// The response created by the server on its own before the request doesn't finish the stream
+		conn.WriteJSON(map[string]interface{}{"type": "response.done", "response": map[string]interface{}{"id": "resp_0"}})
+		conn.WriteJSON(map[string]interface{}{
+			"type":     "response.created",
+			"response": map[string]interface{}{"id": "resp_1", "metadata": create["response"].(map[string]interface{})["metadata"]},
+		})
+		for _, chunk := range [][]byte{{5, 4}, {3, 2, 1}} {
+			conn.WriteJSON(map[string]interface{}{
+				"type":  "response.audio.delta",
+				"delta": base64.StdEncoding.EncodeToString(chunk),
+			})
+		}
+		conn.WriteJSON(map[string]interface{}{"type": "response.audio.done"})
+		conn.WriteJSON(map[string]interface{}{"type": "response.done", "response": map[string]interface{}{"id": "resp_1"}})
+	})
+	s, err := NewRealTimeSession(context.Background(), e, ModelGPT4oRealtimePreview, nil)
+	require.NoError(t, err)
+	defer s.Close()
+
+	input := make(chan []byte, 2)
+	input <- []byte{1, 2, 3}
+	input <- []byte{4, 5}
+	close(input)
+	output := make(chan []byte, 10)
+	require.NoError(t, s.StreamAudio(context.Background(), input, output))
+
+	var audio [][]byte
+	for chunk := range output {
+		audio = append(audio, chunk)
+	}
+	assert.Equal(t, [][]byte{{5, 4}, {3, 2, 1}}, audio)
+}
+
+func TestRealTimeSessionStreamAudioError(t *testing.T) {
+	e := newRealTimeTestServer(t, func(t *testing.T, conn *websocket.Conn, r *http.Request) {
+		readClientEvent(t, conn)
+		conn.WriteJSON(map[string]interface{}{
+			"type":  "error",
+			"error": map[string]interface{}{"type": "invalid_request_error", "message": "invalid audio"},
+		})
+		conn.ReadMessage()
+	})
+	s, err := NewRealTimeSession(context.Background(), e, ModelGPT4oRealtimePreview, nil)
+	require.NoError(t, err)
+	defer s.Close()
+
+	input := make(chan []byte, 1)
+	input <- []byte{1}
+	err = s.StreamAudio(context.Background(), input, make(chan []byte))
+	var rtErr *RealTimeError
+	require.ErrorAs(t, err, &rtErr)
+	assert.Equal(t, "invalid audio", rtErr.Message)
+}
+
+func TestRealTimeSessionStreamAudioCancel(t *testing.T) {
+	e := newRealTimeTestServer(t, func(t *testing.T, conn *websocket.Conn, r *http.Request) {
+		conn.ReadMessage()
+	})
+	s, err := NewRealTimeSession(context.Background(), e, ModelGPT4oRealtimePreview, nil)
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	input := make(chan []byte)
+	go func() {
+		input <- []byte{1}
+		cancel()
+	}()
+	err = s.StreamAudio(ctx, input, make(chan []byte))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRealTimeSessionUpdateSession(t *testing.T) {
+	e := newRealTimeTestServer(t, func(t *testing.T, conn *websocket.Conn, r *http.Request) {
+		var event map[string]interface{}
+		_, b, err := conn.ReadMessage()
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(b, &event))
+		assert.JSONEq(t, `{
+			"type": "session.update",
+			"session": {
+				"modalities": ["text", "audio"],
+				"instructions": "Be brief.",
+				"voice": "alloy",
+				"input_audio_format": "pcm16",
+				"output_audio_format": "g711_ulaw",
+				"input_audio_transcription": {"model": "whisper-1"},
+				"turn_detection": {"type": "server_vad", "threshold": 0.5, "prefix_padding_ms": 300, "silence_duration_ms": 500},
+				"tools": [{"type": "function", "name": "get_weather", "description": "Get the weather", "parameters": {"type": "object"}}],
+				"tool_choice": {"type": "function", "name": "get_weather"},
+				"temperature": 0.8,
+				"max_response_output_tokens": 256
+			}
+		}`, string(b))
+		conn.WriteJSON(map[string]interface{}{
+			"type": "session.updated",
+			"session": map[string]interface{}{
+				"id":                         "sess_1",
+				"voice":                      "alloy",
+				"tool_choice":                "auto",
+				"max_response_output_tokens": "inf",
+			},
+		})
+		conn.ReadMessage()
+	})
+	s, err := NewRealTimeSession(context.Background(), e, ModelGPT4oRealtimePreview, nil)
+	require.NoError(t, err)
+	defer s.Close()
+
+	maxTokens := 256
+	require.NoError(t, s.UpdateSession(&RealTimeSessionOptions{
+		Modalities:              []string{"text", "audio"},
+		Instructions:            "Be brief.",
+		Voice:                   "alloy",
+		InputAudioFormat:        "pcm16",
+		OutputAudioFormat:       "g711_ulaw",
+		InputAudioTranscription: &AudioTranscriptionConfig{Model: ModelWhisper},
+		TurnDetection:           &TurnDetectionConfig{Type: "server_vad", Threshold: 0.5, PrefixPaddingMs: 300, SilenceDurationMs: 500},
+		Tools: []Tool{{
+			Type:        "function",
+			Name:        "get_weather",
+			Description: "Get the weather",
+			Parameters:  json.RawMessage(`{"type":"object"}`),
+		}},
+		ToolChoice:              ToolChoiceFunction("get_weather"),
+		Temperature:             0.8,
+		MaxResponseOutputTokens: &maxTokens,
+	}))
+	event, err := s.Receive()
+	require.NoError(t, err)
+	assert.Equal(t, ServerEventSessionUpdated, event.Type)
+	assert.Equal(t, "sess_1", event.Session.Id)
+	assert.Equal(t, ToolChoiceAuto, event.Session.ToolChoice)
+	assert.Nil(t, event.Session.MaxResponseOutputTokens)
+}
+
+func TestRealTimeSessionConversationItems(t *testing.T) {
+	e := newRealTimeTestServer(t, func(t *testing.T, conn *websocket.Conn, r *http.Request) {
+		for _, want := range []string{
+			`{"type":"conversation.item.create","item":{"id":"msg_1","type":"message","role":"user","content":[{"type":"input_text","text":"Hello"}]}}`,
+			`{"type":"conversation.item.truncate","item_id":"msg_2","content_index":0,"audio_end_ms":1500}`,
+			`{"type":"conversation.item.delete","item_id":"msg_1"}`,
+		} {
+			_, b, err := conn.ReadMessage()
+			require.NoError(t, err)
+			assert.JSONEq(t, want, string(b))
+		}
+		conn.WriteJSON(map[string]interface{}{
+			"type":             "conversation.item.created",
+			"previous_item_id": "msg_0",
+			"item": map[string]interface{}{
+				"id": "msg_1", "type": "message", "status": "completed", "role": "user",
+				"content": []interface{}{map[string]interface{}{"type": "input_text", "text": "Hello"}},
+			},
+		})
+		conn.ReadMessage()
+	})
+	s, err := NewRealTimeSession(context.Background(), e, ModelGPT4oRealtimePreview, nil)
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.NoError(t, s.AppendMessage(&ConversationItem{
+		Id:      "msg_1",
+		Type:    ConversationItemMessage,
+		Role:    "user",
+		Content: []ConversationItemContent{{Type: ContentPartInputText, Text: "Hello"}},
+	}))
+	require.NoError(t, s.TruncateMessage("msg_2", 0, 1500))
+	require.NoError(t, s.DeleteMessage("msg_1"))
+
+	event, err := s.Receive()
+	require.NoError(t, err)
+	assert.Equal(t, ServerEventConversationItemCreated, event.Type)
+	assert.Equal(t, "msg_0", event.PreviousItemId)
+	assert.Equal(t, &ConversationItem{
+		Id:      "msg_1",
+		Type:    ConversationItemMessage,
+		Status:  "completed",
+		Role:    "user",
+		Content: []ConversationItemContent{{Type: ContentPartInputText, Text: "Hello"}},
+	}, event.Item)
+}
+
+func TestRealTimeSessionSetTurnDetection(t *testing.T) {
+	e := newRealTimeTestServer(t, func(t *testing.T, conn *websocket.Conn, r *http.Request) {
+		for _, want := range []string{
+			`{"type":"session.update","session":{"turn_detection":{"type":"server_vad","threshold":0.6,"prefix_padding_ms":200,"silence_duration_ms":700,"create_response":false}}}`,
+			`{"type":"session.update","session":{"turn_detection":{"type":"server_vad"}}}`,
+			`{"type":"session.update","session":{"turn_detection":null}}`,
+			`{"type":"session.update","session":{"turn_detection":null}}`,
+		} {
+			_, b, err := conn.ReadMessage()
+			require.NoError(t, err)
+			assert.JSONEq(t, want, string(b))
+		}
+	})
+	s, err := NewRealTimeSession(context.Background(), e, ModelGPT4oRealtimePreview, nil)
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.NoError(t, s.SetTurnDetection(&TurnDetectionConfig{
+		Type:              TurnDetectionServerVAD,
+		Threshold:         0.6,
+		PrefixPaddingMs:   200,
+		SilenceDurationMs: 700,
+		CreateResponse:    boolPtr(false),
+	}))
+	// The minimal config leaves the response to be created by the server
+	require.NoError(t, s.SetTurnDetection(&TurnDetectionConfig{Type: TurnDetectionServerVAD}))
+	require.NoError(t, s.SetTurnDetection(&TurnDetectionConfig{Type: TurnDetectionNone}))
+	require.NoError(t, s.SetTurnDetection(nil))
+}
+
+func TestRealTimeSessionAutoCancelOnSpeech(t *testing.T) {
+	e := newRealTimeTestServer(t, func(t *testing.T, conn *websocket.Conn, r *http.Request) {
+		assert.Equal(t, ClientEventSessionUpdate, readClientEvent(t, conn)["type"])
+		conn.WriteJSON(map[string]interface{}{"type": "input_audio_buffer.speech_started", "audio_start_ms": 100})
+		conn.WriteJSON(map[string]interface{}{"type": "response.created"})
+		conn.WriteJSON(map[string]interface{}{"type": "input_audio_buffer.speech_started", "audio_start_ms": 2000})
+
+		// Nothing is canceled before the response is created
+		assert.Equal(t, map[string]interface{}{"type": "conversation.item.delete", "item_id": "marker"}, readClientEvent(t, conn))
+		assert.Equal(t, map[string]interface{}{"type": "response.cancel"}, readClientEvent(t, conn))
+		assert.Equal(t, map[string]interface{}{"type": "response.cancel"}, readClientEvent(t, conn))
+	})
+	s, err := NewRealTimeSession(context.Background(), e, ModelGPT4oRealtimePreview, &RealTimeSessionOptions{AutoCancelOnSpeech: true})
+	require.NoError(t, err)
+	defer s.Close()
+	var speechStarts int
+	s.OnSpeechStart(func() {
+		speechStarts++
+	})
+
+	event, err := s.Receive()
+	require.NoError(t, err)
+	assert.Equal(t, 100, event.AudioStartMs)
+	require.NoError(t, s.DeleteMessage("marker"))
+	for i := 0; i < 2; i++ {
+		_, err = s.Receive()
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, speechStarts)
+	require.NoError(t, s.CancelResponse())
+}
+
+func TestRealTimeSessionFunctionCall(t *testing.T) {
+	e := newRealTimeTestServer(t, func(t *testing.T, conn *websocket.Conn, r *http.Request) {
+		conn.WriteJSON(map[string]interface{}{
+			"type": "response.function_call_arguments.done", "call_id": "call_1", "name": "get_weather", "arguments": `{"city":"Berlin"}`,
+		})
+		conn.WriteJSON(map[string]interface{}{
+			"type": "response.function_call_arguments.done", "call_id": "call_2", "name": "get_time", "arguments": `{}`,
+		})
+		outputs := make(map[string]interface{})
+		for i := 0; i < 2; i++ {
+			event := readClientEvent(t, conn)
+			assert.Equal(t, ClientEventConversationItemCreate, event["type"])
+			item := event["item"].(map[string]interface{})
+			assert.Equal(t, ConversationItemFunctionCallOutput, item["type"])
+			outputs[item["call_id"].(string)] = item["output"]
+		}
+		assert.Equal(t, map[string]interface{}{
+			"call_1": `{"temperature":21}`,
+			"call_2": `{"error":"clock is broken"}`,
+		}, outputs)
+	})
+	s, err := NewRealTimeSession(context.Background(), e, ModelGPT4oRealtimePreview, nil)
+	require.NoError(t, err)
+	defer s.Close()
+
+	calls := make(chan *FunctionCall, 2)
+	s.OnFunctionCall(func(ctx context.Context, call *FunctionCall) (string, error) {
+		calls <- call
+		if call.Name == "get_time" {
+			return "", errors.New("clock is broken")
+		}
+		return `{"temperature":21}`, nil
+	})
+	for i := 0; i < 2; i++ {
+		_, err := s.Receive()
+		require.NoError(t, err)
+	}
+	// Handlers run concurrently, so the calls may arrive in any order
+	received := make(map[string]*FunctionCall)
+	for i := 0; i < 2; i++ {
+		call := <-calls
+		received[call.CallId] = call
+	}
+	assert.Equal(t, &FunctionCall{CallId: "call_1", Name: "get_weather", Arguments: `{"city":"Berlin"}`}, received["call_1"])
+	assert.Equal(t, "get_time", received["call_2"].Name)
+	// The server is done once both outputs were submitted
+	_, err = s.Receive()
+	assert.Error(t, err)
+}
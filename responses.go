@@ -0,0 +1,463 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"iter"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Types of the items of the input and the output of the response.
+const (
+	ResponseItemMessage            = "message"
+	ResponseItemFunctionCall       = "function_call"
+	ResponseItemFunctionCallOutput = "function_call_output"
+	ResponseItemReasoning          = "reasoning"
+	ResponseItemReference          = "item_reference"
+	ResponseItemWebSearchCall      = "web_search_call"
+	ResponseItemFileSearchCall     = "file_search_call"
+)
+
+// Statuses of the response.
+const (
+	ResponseCompleted  = "completed"
+	ResponseFailed     = "failed"
+	ResponseInProgress = "in_progress"
+	ResponseIncomplete = "incomplete"
+)
+
+// Truncation strategies of the input exceeding the context window of the model.
+const (
+	// TruncationAuto drops the items from the beginning of the conversation.
+	TruncationAuto = "auto"
+	// TruncationDisabled fails the request with the 400 error.
+	TruncationDisabled = "disabled"
+)
+
+// Reasoning efforts of the reasoning models, the higher effort the more reasoning tokens are spent.
+const (
+	ReasoningEffortLow    = "low"
+	ReasoningEffortMedium = "medium"
+	ReasoningEffortHigh   = "high"
+)
+
+type CreateResponseOptions struct {
+	// ID of the model to use.
+	Model Model `json:"model" binding:"required"`
+	// The text input of the model, the user message. Set either Input or InputItems.
+	Input string `json:"-" binding:"required_without=InputItems"`
+	// The items of the input, e.g. the messages and the outputs of the function calls of the previous response.
+	InputItems []InputItem `json:"-" binding:"required_without=Input,dive"`
+	// The system message inserted into the context of the model. The instructions of the previous
+	// response aren't carried over to the next one.
+	Instructions string `json:"instructions,omitempty"`
+	// The ID of the previous response the conversation continues from, the state of the conversation
+	// is kept by the server, so only the new items are sent as the input.
+	PreviousResponseId string `json:"previous_response_id,omitempty"`
+	// The tools the model may call, e.g. the functions of FunctionRegistry.Describe.
+	Tools []Tool `json:"tools,omitempty"`
+	// Which tool is called by the model, see ToolChoice.
+	ToolChoice ToolChoice `json:"tool_choice,omitempty"`
+	// What sampling temperature to use, between 0 and 2.
+	Temperature float32 `json:"temperature,omitempty"`
+	// An upper bound for the number of tokens that can be generated, including the reasoning tokens.
+	MaxOutputTokens int `json:"max_output_tokens,omitempty"`
+	// The truncation strategy, TruncationAuto or TruncationDisabled. The API default is TruncationDisabled.
+	Truncation string `json:"truncation,omitempty" binding:"omitempty,oneof=auto disabled"`
+	// Whether to store the response, so it can be retrieved and continued with PreviousResponseId. The API
+	// stores the responses by default.
+	Store *bool `json:"store,omitempty"`
+	// Set of up to 16 key-value pairs attached to the response.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// The options of the reasoning models.
+	Reasoning *ReasoningOptions `json:"reasoning,omitempty"`
+}
+
+// MarshalJSON encodes Input as the string and InputItems as the array of the input.
+func (o CreateResponseOptions) MarshalJSON() ([]byte, error) {
+	type options CreateResponseOptions
+	var input interface{} = o.Input
+	if o.InputItems != nil {
+		input = o.InputItems
+	}
+	return json.Marshal(struct {
+		options
+		Input interface{} `json:"input"`
+	}{options(o), input})
+}
+
+type ReasoningOptions struct {
+	// The effort of the reasoning, e.g. ReasoningEffortLow.
+	Effort string `json:"effort,omitempty" binding:"omitempty,oneof=low medium high"`
+	// The detail of the summary of the reasoning, "auto", "concise" or "detailed". It isn't generated if it's empty.
+	Summary string `json:"summary,omitempty"`
+}
+
+// InputItem is the item of the input of the response. The fields depend on the type.
+type InputItem struct {
+	// The type of the item, e.g. ResponseItemMessage.
+	Type string `json:"type" binding:"required"`
+	// The ID of the item, set for the items of the stored responses and for ResponseItemReference.
+	Id string `json:"id,omitempty"`
+	// The role and the text of the message, ResponseItemMessage.
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+	// The call of the function, ResponseItemFunctionCall, and its result, ResponseItemFunctionCallOutput.
+	CallId    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    string `json:"output,omitempty"`
+}
+
+// UnmarshalJSON decodes the content of the message which is either the string,
+// or the parts of the content, e.g. the input items listed by ListResponseInputItems,
+// whose texts are joined.
+func (it *InputItem) UnmarshalJSON(b []byte) error {
+	type item InputItem
+	var v struct {
+		item
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*it = InputItem(v.item)
+	if len(v.Content) == 0 || string(v.Content) == "null" {
+		return nil
+	}
+	if v.Content[0] != '[' {
+		return json.Unmarshal(v.Content, &it.Content)
+	}
+	var parts []struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(v.Content, &parts); err != nil {
+		return err
+	}
+	var text strings.Builder
+	for _, p := range parts {
+		text.WriteString(p.Text)
+	}
+	it.Content = text.String()
+	return nil
+}
+
+// InputMessage returns the message input item of the role, e.g. "user" or "developer".
+func InputMessage(role, content string) InputItem {
+	return InputItem{Type: ResponseItemMessage, Role: role, Content: content}
+}
+
+// InputFunctionCallOutput returns the input item of the result of the function call of the previous response.
+func InputFunctionCallOutput(callId, output string) InputItem {
+	return InputItem{Type: ResponseItemFunctionCallOutput, CallId: callId, Output: output}
+}
+
+// InputItemReference returns the input item referring to the item of the stored response by its ID.
+func InputItemReference(id string) InputItem {
+	return InputItem{Type: ResponseItemReference, Id: id}
+}
+
+// Response is the response of the model generated by CreateResponse.
+type Response struct {
+	Id        string `json:"id"`
+	Object    string `json:"object"`
+	CreatedAt int64  `json:"created_at"`
+	// The status of the response, e.g. ResponseCompleted.
+	Status string `json:"status"`
+	Model  Model  `json:"model"`
+	// The error of the failed response, nil if it didn't fail.
+	Error *ResponseError `json:"error,omitempty"`
+	// Why the response is incomplete, nil if it's complete.
+	IncompleteDetails *ResponseIncompleteDetails `json:"incomplete_details,omitempty"`
+	// The items generated by the model, in order, see OutputText.
+	Output             []OutputItem      `json:"output"`
+	Instructions       string            `json:"instructions,omitempty"`
+	PreviousResponseId string            `json:"previous_response_id,omitempty"`
+	Tools              []Tool            `json:"tools,omitempty"`
+	ToolChoice         ToolChoice        `json:"tool_choice,omitempty"`
+	Temperature        float32           `json:"temperature,omitempty"`
+	MaxOutputTokens    int               `json:"max_output_tokens,omitempty"`
+	Truncation         string            `json:"truncation,omitempty"`
+	Store              bool              `json:"store"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+	Reasoning          *ReasoningOptions `json:"reasoning,omitempty"`
+	Usage              *ResponseUsage    `json:"usage,omitempty"`
+}
+
+// OutputText returns the text of the messages of the output, joined.
+func (r *Response) OutputText() string {
+	var text strings.Builder
+	for _, item := range r.Output {
+		if item.Message == nil {
+			continue
+		}
+		for _, c := range item.Message.Content {
+			text.WriteString(c.Text)
+		}
+	}
+	return text.String()
+}
+
+// FunctionCalls returns the calls of the functions of the output, in order. Send their results
+// with InputFunctionCallOutput in the input of the next response.
+func (r *Response) FunctionCalls() []OutputFunctionCall {
+	var calls []OutputFunctionCall
+	for _, item := range r.Output {
+		if item.FunctionCall != nil {
+			calls = append(calls, *item.FunctionCall)
+		}
+	}
+	return calls
+}
+
+type ResponseError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type ResponseIncompleteDetails struct {
+	// The reason, e.g. "max_output_tokens" or "content_filter".
+	Reason string `json:"reason"`
+}
+
+type ResponseUsage struct {
+	InputTokens        int `json:"input_tokens"`
+	InputTokensDetails struct {
+		// The number of input tokens read from the prompt cache.
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+	OutputTokens        int `json:"output_tokens"`
+	OutputTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"output_tokens_details"`
+	TotalTokens int `json:"total_tokens"`
+}
+
+// usage returns the usage in the format of the chat completions.
+func (u *ResponseUsage) usage() Usage {
+	return Usage{
+		PromptTokens:        u.InputTokens,
+		CompletionTokens:    u.OutputTokens,
+		TotalTokens:         u.TotalTokens,
+		PromptTokensDetails: &PromptTokensDetails{CachedTokens: u.InputTokensDetails.CachedTokens},
+	}
+}
+
+// OutputItem is the item generated by the model. The variant of the type is set, e.g. Message for
+// ResponseItemMessage, the items of other types, e.g. ResponseItemWebSearchCall, only have Raw.
+type OutputItem struct {
+	Type   string `json:"type"`
+	Id     string `json:"id"`
+	Status string `json:"status,omitempty"`
+
+	Message      *OutputMessage      `json:"-"`
+	FunctionCall *OutputFunctionCall `json:"-"`
+	Reasoning    *OutputReasoning    `json:"-"`
+	// Raw is the JSON of the item, e.g. to decode the fields of the types without the variant.
+	Raw json.RawMessage `json:"-"`
+}
+
+func (it *OutputItem) UnmarshalJSON(b []byte) error {
+	type item OutputItem
+	if err := json.Unmarshal(b, (*item)(it)); err != nil {
+		return err
+	}
+	it.Raw = append(json.RawMessage(nil), b...)
+	var variant interface{}
+	switch it.Type {
+	case ResponseItemMessage:
+		it.Message = &OutputMessage{}
+		variant = it.Message
+	case ResponseItemFunctionCall:
+		it.FunctionCall = &OutputFunctionCall{}
+		variant = it.FunctionCall
+	case ResponseItemReasoning:
+		it.Reasoning = &OutputReasoning{}
+		variant = it.Reasoning
+	default:
+		return nil
+	}
+	return json.Unmarshal(b, variant)
+}
+
+// MarshalJSON encodes the item as Raw, if it's set, or as the fields of the variant.
+func (it OutputItem) MarshalJSON() ([]byte, error) {
+	if it.Raw != nil {
+		return it.Raw, nil
+	}
+	type item OutputItem
+	b, err := json.Marshal(item(it))
+	if err != nil {
+		return nil, err
+	}
+	var variant interface{}
+	switch {
+	case it.Message != nil:
+		variant = it.Message
+	case it.FunctionCall != nil:
+		variant = it.FunctionCall
+	case it.Reasoning != nil:
+		variant = it.Reasoning
+	default:
+		return b, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	vb, err := json.Marshal(variant)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(vb, &fields); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// OutputMessage is the message of the model, ResponseItemMessage.
+type OutputMessage struct {
+	Role    string          `json:"role"`
+	Content []OutputContent `json:"content"`
+}
+
+// OutputContent is the part of the content of the message, the text or the refusal,
+// depending on the type, "output_text" or "refusal".
+type OutputContent struct {
+	Type        string               `json:"type"`
+	Text        string               `json:"text,omitempty"`
+	Refusal     string               `json:"refusal,omitempty"`
+	Annotations []ResponseAnnotation `json:"annotations,omitempty"`
+}
+
+// ResponseAnnotation cites the source of the text of the message, the web page of "url_citation"
+// or the file of "file_citation", depending on the type.
+type ResponseAnnotation struct {
+	Type string `json:"type"`
+	// The part of the text citing the web page.
+	StartIndex int    `json:"start_index,omitempty"`
+	EndIndex   int    `json:"end_index,omitempty"`
+	URL        string `json:"url,omitempty"`
+	Title      string `json:"title,omitempty"`
+	// The file and the position in the text citing it.
+	FileId string `json:"file_id,omitempty"`
+	Index  int    `json:"index,omitempty"`
+}
+
+// OutputFunctionCall is the call of the function generated by the model, ResponseItemFunctionCall.
+type OutputFunctionCall struct {
+	// The ID of the call, the result of the function refers to it, see InputFunctionCallOutput.
+	CallId string `json:"call_id"`
+	Name   string `json:"name"`
+	// The arguments encoded in JSON, they aren't always valid.
+	Arguments string `json:"arguments"`
+}
+
+// OutputReasoning is the reasoning of the model, ResponseItemReasoning.
+type OutputReasoning struct {
+	// The summary of the reasoning, if it was requested with ReasoningOptions.Summary.
+	Summary []ReasoningSummary `json:"summary"`
+	// The encrypted reasoning to pass to the next response if the responses aren't stored.
+	EncryptedContent string `json:"encrypted_content,omitempty"`
+}
+
+type ReasoningSummary struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// CreateResponse is used to generate the response of the model for the input. Unlike the chat
+// completions, the state of the conversation is kept by the server: continue it by sending the
+// new input with PreviousResponseId set to the ID of the response.
+//
+// Docs: https://platform.openai.com/docs/api-reference/responses/create
+func (e *Engine) CreateResponse(ctx context.Context, opts *CreateResponseOptions) (*Response, error) {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	uri := e.apiBaseURL + "/responses"
+	ctx = withRequestInfo(ctx, "/responses", opts.Model)
+	var resp Response
+	if err := e.sendJSON(ctx, http.MethodPost, uri, opts, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Usage != nil {
+		e.recordUsage(opts.Model, resp.Usage.usage())
+	}
+	return &resp, nil
+}
+
+// GetResponse returns the response stored by CreateResponse, e.g. to resume the conversation
+// with its output, see PreviousResponseId.
+//
+// Docs: https://platform.openai.com/docs/api-reference/responses/get
+func (e *Engine) GetResponse(ctx context.Context, responseId string) (*Response, error) {
+	uri := e.apiBaseURL + "/responses/" + url.PathEscape(responseId)
+	ctx = withRequestInfo(ctx, "/responses/{response_id}", "")
+	var resp Response
+	if err := e.sendJSON(ctx, http.MethodGet, uri, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteResponse deletes the stored response. The responses continuing from it keep their
+// own input and output, but it can't be continued anymore.
+//
+// Docs: https://platform.openai.com/docs/api-reference/responses/delete
+func (e *Engine) DeleteResponse(ctx context.Context, responseId string) (*Deleted, error) {
+	uri := e.apiBaseURL + "/responses/" + url.PathEscape(responseId)
+	ctx = withRequestInfo(ctx, "/responses/{response_id}", "")
+	return e.deleteObject(ctx, uri)
+}
+
+type ListInputItemsOptions struct {
+	ListOptions
+	// The order of the items, "asc" or "desc". The API default is "desc", the most recent first.
+	Order string `binding:"omitempty,oneof=asc desc"`
+	// Additional fields to include, e.g. "file_search_call.results".
+	Include []string
+}
+
+// ListResponseInputItems returns the page of the items of the input of the stored response.
+//
+// Docs: https://platform.openai.com/docs/api-reference/responses/input-items
+func (e *Engine) ListResponseInputItems(ctx context.Context, responseId string, opts *ListInputItemsOptions) (*Page[InputItem], error) {
+	if opts == nil {
+		opts = &ListInputItemsOptions{}
+	}
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	q := opts.ListOptions.query()
+	if opts.Order != "" {
+		q.Set("order", opts.Order)
+	}
+	for _, field := range opts.Include {
+		q.Add("include[]", field)
+	}
+	uri := withQuery(e.apiBaseURL+"/responses/"+url.PathEscape(responseId)+"/input_items", q)
+	ctx = withRequestInfo(ctx, "/responses/{response_id}/input_items", "")
+	var page Page[InputItem]
+	if err := e.sendJSON(ctx, http.MethodGet, uri, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// AllResponseInputItems iterates over the input items of all pages, starting with the page of opts.
+func (e *Engine) AllResponseInputItems(ctx context.Context, responseId string, opts *ListInputItemsOptions) iter.Seq2[InputItem, error] {
+	var o ListInputItemsOptions
+	if opts != nil {
+		o = *opts
+	}
+	return paginate(ctx, o.After, func(ctx context.Context, after string) (*Page[InputItem], error) {
+		o.After = after
+		return e.ListResponseInputItems(ctx, responseId, &o)
+	})
+}
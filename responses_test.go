@@ -0,0 +1,144 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testResponse = `{"id":"resp_1","object":"response","created_at":1741476542,"status":"completed","model":"gpt-4o-2024-08-06",
+"output":[
+{"type":"reasoning","id":"rs_1","summary":[{"type":"summary_text","text":"The user asks for the weather."}]},
+{"type":"function_call","id":"fc_1","status":"completed","call_id":"call_1","name":"get_weather","arguments":"{\"city\":\"Berlin\"}"},
+{"type":"message","id":"msg_1","status":"completed","role":"assistant","content":[
+{"type":"output_text","text":"It's sunny ","annotations":[]},
+{"type":"output_text","text":"in Berlin.","annotations":[{"type":"url_citation","start_index":0,"end_index":10,"url":"https://example.com","title":"Weather"}]}]},
+{"type":"web_search_call","id":"ws_1","status":"completed"}],
+"store":true,"truncation":"auto",
+"usage":{"input_tokens":36,"input_tokens_details":{"cached_tokens":12},"output_tokens":87,"output_tokens_details":{"reasoning_tokens":20},"total_tokens":123}}`
+
+func TestCreateResponse(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/responses", r.URL.Path)
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(b, &body))
+		w.Write([]byte(testResponse))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	ctx := context.Background()
+
+	resp, err := e.CreateResponse(ctx, &CreateResponseOptions{
+		Model:        "gpt-4o",
+		Input:        "What's the weather in Berlin?",
+		Instructions: "Be brief.",
+		Truncation:   TruncationAuto,
+		Reasoning:    &ReasoningOptions{Effort: ReasoningEffortLow},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "What's the weather in Berlin?", body["input"])
+	assert.Equal(t, "Be brief.", body["instructions"])
+	assert.Equal(t, map[string]interface{}{"effort": "low"}, body["reasoning"])
+	assert.NotContains(t, body, "store")
+
+	assert.Equal(t, ResponseCompleted, resp.Status)
+	require.Len(t, resp.Output, 4)
+	require.NotNil(t, resp.Output[0].Reasoning)
+	assert.Equal(t, "The user asks for the weather.", resp.Output[0].Reasoning.Summary[0].Text)
+	assert.Equal(t, []OutputFunctionCall{{CallId: "call_1", Name: "get_weather", Arguments: `{"city":"Berlin"}`}}, resp.FunctionCalls())
+	require.NotNil(t, resp.Output[2].Message)
+	assert.Equal(t, "https://example.com", resp.Output[2].Message.Content[1].Annotations[0].URL)
+	assert.Equal(t, "It's sunny in Berlin.", resp.OutputText())
+	ws := resp.Output[3]
+	assert.True(t, ws.Message == nil && ws.FunctionCall == nil && ws.Reasoning == nil, "the item of the unknown type has no variant")
+	assert.JSONEq(t, `{"type":"web_search_call","id":"ws_1","status":"completed"}`, string(ws.Raw))
+	assert.Equal(t, 12, resp.Usage.InputTokensDetails.CachedTokens)
+	assert.Equal(t, 20, resp.Usage.OutputTokensDetails.ReasoningTokens)
+
+	_, err = e.CreateResponse(ctx, &CreateResponseOptions{
+		Model:              "gpt-4o",
+		PreviousResponseId: "resp_1",
+		InputItems:         []InputItem{InputFunctionCallOutput("call_1", "sunny"), InputItemReference("msg_1")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"type": "function_call_output", "call_id": "call_1", "output": "sunny"},
+		map[string]interface{}{"type": "item_reference", "id": "msg_1"},
+	}, body["input"])
+	assert.Equal(t, "resp_1", body["previous_response_id"])
+
+	_, err = e.CreateResponse(ctx, &CreateResponseOptions{Model: "gpt-4o"})
+	assert.Error(t, err, "the input is required")
+}
+
+func TestGetResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/responses/resp_1", r.URL.Path)
+		w.Write([]byte(testResponse))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	resp, err := e.GetResponse(context.Background(), "resp_1")
+	require.NoError(t, err)
+	assert.Equal(t, "resp_1", resp.Id)
+	assert.Equal(t, "It's sunny in Berlin.", resp.OutputText())
+
+	_, err = e.ListResponseInputItems(context.Background(), "resp_1", &ListInputItemsOptions{Order: "newest"})
+	assert.Error(t, err, "the order is validated")
+}
+
+func TestOutputItemJSON(t *testing.T) {
+	var resp Response
+	require.NoError(t, json.Unmarshal([]byte(testResponse), &resp))
+	for _, item := range resp.Output {
+		b, err := json.Marshal(item)
+		require.NoError(t, err)
+		assert.JSONEq(t, string(item.Raw), string(b))
+	}
+
+	b, err := json.Marshal(OutputItem{Type: ResponseItemFunctionCall, Id: "fc_1",
+		FunctionCall: &OutputFunctionCall{CallId: "call_1", Name: "get_weather", Arguments: "{}"}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"function_call","id":"fc_1","call_id":"call_1","name":"get_weather","arguments":"{}"}`, string(b))
+}
+
+func TestListResponseInputItems(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/responses/resp_1/input_items", r.URL.Path)
+		assert.Equal(t, "include%5B%5D=file_search_call.results&order=asc", r.URL.RawQuery)
+		w.Write([]byte(`{"object":"list","data":[
+{"type":"message","id":"msg_1","role":"user","content":[{"type":"input_text","text":"What's the weather "},{"type":"input_text","text":"in Berlin?"}]},
+{"type":"function_call_output","id":"fco_1","call_id":"call_1","output":"sunny"}],
+"first_id":"msg_1","last_id":"fco_1","has_more":false}`))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	var items []InputItem
+	for item, err := range e.AllResponseInputItems(context.Background(), "resp_1",
+		&ListInputItemsOptions{Order: "asc", Include: []string{"file_search_call.results"}}) {
+		require.NoError(t, err)
+		items = append(items, item)
+	}
+	assert.Equal(t, []InputItem{
+		{Type: ResponseItemMessage, Id: "msg_1", Role: "user", Content: "What's the weather in Berlin?"},
+		{Type: ResponseItemFunctionCallOutput, Id: "fco_1", CallId: "call_1", Output: "sunny"},
+	}, items)
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	defaultRetryMaxDelay  = 8 * time.Second
+)
+
+// SetMaxRetries is used to set how many times a failed request is retried.
+// Requests are retried on network errors, 408, 429 and 5xx status codes.
+// By default requests are not retried.
+//
+// When retries are enabled, every non-GET request carries an Idempotency-Key
+// header which stays the same across all attempts of the request.
+func (e *Engine) SetMaxRetries(maxRetries int) {
+	e.maxRetries = maxRetries
+}
+
+type maxRetriesKey struct{}
+
+// ContextWithMaxRetries returns the context which makes requests sent with it retried at most
+// maxRetries times, or fewer if engine is set to retry less (SetMaxRetries).
+func ContextWithMaxRetries(ctx context.Context, maxRetries int) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, maxRetriesKey{}, maxRetries)
+}
+
+// retries returns the number of times the request sent with ctx may be retried.
+func (e *Engine) retries(ctx context.Context) int {
+	if n, ok := ctx.Value(maxRetriesKey{}).(int); ok && n < e.maxRetries {
+		return n
+	}
+	return e.maxRetries
+}
+
+// isRetryable reports whether the attempt that produced resp and err
+// can be sent again.
+func isRetryable(req *http.Request, resp *http.Response, err error) bool {
+	return canReplay(req) && isRetryableResult(resp, err)
+}
+
+// isRetryableResult reports whether the attempt failed with a transient error.
+func isRetryableResult(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= 500:
+		return true
+	}
+	return false
+}
+
+// canReplay reports whether req can be sent once more.
+func canReplay(req *http.Request) bool {
+	return req.Context().Err() == nil && hasReplayableBody(req)
+}
+
+// hasReplayableBody reports whether the body of req can be sent again.
+// A body without GetBody was consumed by the previous attempt.
+func hasReplayableBody(req *http.Request) bool {
+	return req.GetBody != nil || req.Body == nil || req.Body == http.NoBody
+}
+
+// retryAfter returns the delay of the Retry-After header of resp, if it's set.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+// defaultBackoff honors the Retry-After header of the response if it's set,
+// otherwise the delay grows exponentially with every attempt.
+func defaultBackoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if d, ok := retryAfter(resp); ok {
+			return d
+		}
+	}
+	d := defaultRetryBaseDelay << attempt
+	if d <= 0 || d > defaultRetryMaxDelay {
+		d = defaultRetryMaxDelay
+	}
+	return d
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand never fails on supported platforms, fall back to
+		// the clock to keep the key unique enough anyway.
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// RetryPolicy decides whether the call of DoWithRetry is retried. ShouldRetry is called with the
+// number of the attempt, counting from 1, and its result, and returns whether to retry it and the wait
+// before the retry. The policy defines the maximum number of attempts, e.g. by returning false once
+// attempt reaches it.
+type RetryPolicy interface {
+	ShouldRetry(attempt int, resp *ChatCompletionResponse, err error) (bool, time.Duration)
+}
+
+// RetryPolicyFunc is the function used as RetryPolicy.
+type RetryPolicyFunc func(attempt int, resp *ChatCompletionResponse, err error) (bool, time.Duration)
+
+func (f RetryPolicyFunc) ShouldRetry(attempt int, resp *ChatCompletionResponse, err error) (bool, time.Duration) {
+	return f(attempt, resp, err)
+}
+
+// DoWithRetry is used to call fn, e.g. the ChatCompletion of engine, until policy stops retrying it,
+// and returns the result of the last call. It makes possible to retry on conditions the engine
+// doesn't retry on, e.g. the malformed content of the successful response:
+//
+//	resp, err := engine.DoWithRetry(ctx, func() (*openai.ChatCompletionResponse, error) {
+//		return engine.ChatCompletion(ctx, opts)
+//	}, openai.RetryPolicyFunc(func(attempt int, resp *openai.ChatCompletionResponse, err error) (bool, time.Duration) {
+//		return attempt < 3 && err == nil && !json.Valid([]byte(resp.Choices[0].Message.Content)), 0
+//	}))
+//
+// The policy applies on top of the retries of the engine (SetMaxRetries), every call of fn is retried
+// by the engine as usual and its final result is passed to the policy. The wait is measured by the clock
+// of the engine, see WithClock. The error of ctx is returned if it's done during the wait.
+func (e *Engine) DoWithRetry(ctx context.Context, fn func() (*ChatCompletionResponse, error), policy RetryPolicy) (*ChatCompletionResponse, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for attempt := 1; ; attempt++ {
+		resp, err := fn()
+		retry, wait := policy.ShouldRetry(attempt, resp, err)
+		if !retry {
+			return resp, err
+		}
+		if err := e.clock.Sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoWithRetry(t *testing.T) {
+	var calls int
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":{"message":"overloaded"}}`))
+		case 2:
+			w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"{\"city\":"}}]}`))
+		default:
+			w.Write([]byte(`{"id":"chatcmpl-2","choices":[{"message":{"role":"assistant","content":"{\"city\":\"Berlin\"}"}}]}`))
+		}
+	})
+	clock := NewTestClock(time.Unix(0, 0))
+	e := New("test", WithClock(clock))
+	e.apiBaseURL = srv.URL
+	e.SetMaxRetries(1)
+
+	var attempts []int
+	policy := RetryPolicyFunc(func(attempt int, resp *ChatCompletionResponse, err error) (bool, time.Duration) {
+		attempts = append(attempts, attempt)
+		return attempt < 3 && err == nil && !json.Valid([]byte(resp.Choices[0].Message.Content)), time.Second
+	})
+	done := make(chan struct{})
+	var (
+		resp *ChatCompletionResponse
+		err  error
+	)
+	go func() {
+		defer close(done)
+		resp, err = e.DoWithRetry(context.Background(), func() (*ChatCompletionResponse, error) {
+			return e.ChatCompletion(context.Background(), testChatOptions())
+		}, policy)
+	}()
+	clock.BlockUntil(1) // the backoff of the engine
+	clock.Advance(time.Minute)
+	clock.BlockUntil(1) // the wait of the policy
+	clock.Advance(time.Second)
+	<-done
+	require.NoError(t, err)
+	assert.Equal(t, "chatcmpl-2", resp.Id)
+	assert.Equal(t, 3, calls, "the engine retries the 503, the policy retries the malformed content")
+	assert.Equal(t, []int{1, 2}, attempts)
+}
+
+func TestDoWithRetryStops(t *testing.T) {
+	e := New("test")
+	errFailed := errors.New("failed")
+	var calls int
+	fn := func() (*ChatCompletionResponse, error) {
+		calls++
+		return nil, errFailed
+	}
+	resp, err := e.DoWithRetry(context.Background(), fn, RetryPolicyFunc(func(attempt int, _ *ChatCompletionResponse, _ error) (bool, time.Duration) {
+		return attempt < 3, 0
+	}))
+	assert.Nil(t, resp)
+	assert.Equal(t, errFailed, err, "the result of the last call is returned")
+	assert.Equal(t, 3, calls)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	_, err = e.DoWithRetry(ctx, fn, RetryPolicyFunc(func(int, *ChatCompletionResponse, error) (bool, time.Duration) {
+		return true, time.Hour
+	}))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"strings"
+)
+
+// Router is used to route requests to the API base URL by the endpoint and the model,
+// e.g. embeddings to a local server. If ok is false, the request is sent to the base URL
+// of the engine. The endpoint is the path template of the request, e.g. "/chat/completions".
+type Router func(endpoint string, model Model) (baseURL string, ok bool)
+
+// WithRouter is used to send requests to different hosts through one engine, which
+// shares the middleware, metrics and rate limiting between all of them.
+// The base URL set with ContextWithBaseURL takes precedence over the router.
+func WithRouter(router Router) EngineOption {
+	return func(e *Engine) {
+		e.router = router
+	}
+}
+
+// WithHostCredential is used to authorize requests to the host, e.g. the one chosen by the router,
+// with the credential instead of the engine API key or the key pool. The host is matched
+// with the host of the request URL, including the port if it's set.
+func WithHostCredential(host string, credential CredentialProvider) EngineOption {
+	return func(e *Engine) {
+		if e.hostCredentials == nil {
+			e.hostCredentials = make(map[string]CredentialProvider)
+		}
+		e.hostCredentials[host] = credential
+	}
+}
+
+type baseURLKey struct{}
+
+// ContextWithBaseURL returns ctx with the API base URL, which the requests made with ctx
+// are sent to instead of the base URL of the engine or the one chosen by the router.
+func ContextWithBaseURL(ctx context.Context, baseURL string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, baseURLKey{}, baseURL)
+}
+
+type credentialKey struct{}
+
+// ContextWithCredential returns ctx with the credential, which authorizes the requests
+// made with ctx instead of the engine API key, the key pool or the host credential,
+// e.g. the admin API key of the organization endpoints.
+func ContextWithCredential(ctx context.Context, credential CredentialProvider) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, credentialKey{}, credential)
+}
+
+// credential returns the credential of the request made with ctx, the one set with
+// ContextWithCredential, the admin API key of the organization endpoints or the one
+// of the host, if any is set.
+func (e *Engine) credential(ctx context.Context, host string) (CredentialProvider, bool) {
+	if credential, ok := ctx.Value(credentialKey{}).(CredentialProvider); ok && credential != nil {
+		return credential, true
+	}
+	if e.adminAPIKey != "" && isAdminEndpoint(requestInfoFrom(ctx).endpoint) {
+		return StaticCredential(e.adminAPIKey), true
+	}
+	credential, ok := e.hostCredentials[host]
+	return credential, ok
+}
+
+// baseURL returns the API base URL of the request made with ctx.
+func (e *Engine) baseURL(ctx context.Context) string {
+	if baseURL, ok := ctx.Value(baseURLKey{}).(string); ok && baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/")
+	}
+	if e.router != nil {
+		info := requestInfoFrom(ctx)
+		if baseURL, ok := e.router(info.endpoint, info.model); ok && baseURL != "" {
+			return strings.TrimSuffix(baseURL, "/")
+		}
+	}
+	return e.apiBaseURL
+}
+
+// route replaces the base URL of the engine in uri with the base URL of the request made with ctx.
+func (e *Engine) route(ctx context.Context, uri string) string {
+	if !strings.HasPrefix(uri, e.apiBaseURL) {
+		return uri
+	}
+	return e.baseURL(ctx) + strings.TrimPrefix(uri, e.apiBaseURL)
+}
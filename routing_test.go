@@ -0,0 +1,81 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRoutedServer starts the chat server which records the authorization of requests.
+func newRoutedServer(t *testing.T, authorization *[]string) string {
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		*authorization = append(*authorization, r.Header.Get("Authorization"))
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+	})
+	return srv.URL + "/v1"
+}
+
+func TestRouter(t *testing.T) {
+	var openaiAuth, localAuth []string
+	openaiURL := newRoutedServer(t, &openaiAuth)
+	localURL := newRoutedServer(t, &localAuth)
+	local, _ := url.Parse(localURL)
+
+	var middleware []string
+	c := &testCollector{}
+	e := New("sk-openai",
+		WithHTTPClient(&http.Client{
+			Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				middleware = append(middleware, req.URL.Host)
+				return http.DefaultTransport.RoundTrip(req)
+			}),
+		}),
+		WithMetrics(c),
+		WithRouter(func(endpoint string, model Model) (string, bool) {
+			if endpoint == "/chat/completions" && model == "llama-3" {
+				return localURL + "/", true
+			}
+			return "", false
+		}),
+		WithHostCredential(local.Host, StaticCredential("sk-local")),
+	)
+	e.apiBaseURL = openaiURL
+
+	opts := testChatOptions()
+	_, err := e.ChatCompletion(context.Background(), opts)
+	require.NoError(t, err)
+	opts = testChatOptions()
+	opts.Model = "llama-3"
+	_, err = e.ChatCompletion(context.Background(), opts)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Bearer sk-openai"}, openaiAuth)
+	assert.Equal(t, []string{"Bearer sk-local"}, localAuth)
+	openai, _ := url.Parse(openaiURL)
+	assert.Equal(t, []string{openai.Host, local.Host}, middleware, "the middleware is shared by the destinations")
+	require.Len(t, c.durations, 2)
+	assert.Equal(t, "llama-3", c.durations[1].model)
+}
+
+func TestContextWithBaseURL(t *testing.T) {
+	var defaultAuth, overrideAuth []string
+	defaultURL := newRoutedServer(t, &defaultAuth)
+	overrideURL := newRoutedServer(t, &overrideAuth)
+	e := New("test", WithRouter(func(endpoint string, model Model) (string, bool) {
+		return "http://unreachable.invalid/v1", true
+	}))
+	e.apiBaseURL = defaultURL
+
+	_, err := e.ChatCompletion(ContextWithBaseURL(context.Background(), overrideURL), testChatOptions())
+	require.NoError(t, err, "the base URL of the context takes precedence over the router")
+	assert.Len(t, overrideAuth, 1)
+	assert.Empty(t, defaultAuth)
+}
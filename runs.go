@@ -0,0 +1,276 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+)
+
+// Statuses of the run.
+const (
+	RunQueued         = "queued"
+	RunInProgress     = "in_progress"
+	RunRequiresAction = "requires_action"
+	RunCancelling     = "cancelling"
+	RunCancelled      = "cancelled"
+	RunFailed         = "failed"
+	RunCompleted      = "completed"
+	RunIncomplete     = "incomplete"
+	RunExpired        = "expired"
+)
+
+// Run is the execution of the assistant on the thread.
+type Run struct {
+	Id          string `json:"id"`
+	Object      string `json:"object"`
+	CreatedAt   int64  `json:"created_at"`
+	ThreadId    string `json:"thread_id"`
+	AssistantId string `json:"assistant_id"`
+	// The status of the run, e.g. RunInProgress.
+	Status string `json:"status"`
+	// The action required to continue the run of RunRequiresAction, nil otherwise.
+	RequiredAction *RunRequiredAction `json:"required_action,omitempty"`
+	// The error of the failed run, nil if it didn't fail.
+	LastError *RunError `json:"last_error,omitempty"`
+	// Why the run is incomplete, nil if it's not RunIncomplete.
+	IncompleteDetails *RunIncompleteDetails `json:"incomplete_details,omitempty"`
+	// The Unix timestamps of the changes of the status, zero until the run reaches the status.
+	ExpiresAt   int64 `json:"expires_at,omitempty"`
+	StartedAt   int64 `json:"started_at,omitempty"`
+	CancelledAt int64 `json:"cancelled_at,omitempty"`
+	FailedAt    int64 `json:"failed_at,omitempty"`
+	CompletedAt int64 `json:"completed_at,omitempty"`
+	// The model, the instructions and the tools the run uses, the ones of the assistant
+	// unless they were overridden for the run.
+	Model               Model             `json:"model"`
+	Instructions        string            `json:"instructions"`
+	Tools               []AssistantTool   `json:"tools"`
+	Temperature         float32           `json:"temperature,omitempty"`
+	MaxPromptTokens     int               `json:"max_prompt_tokens,omitempty"`
+	MaxCompletionTokens int               `json:"max_completion_tokens,omitempty"`
+	Metadata            map[string]string `json:"metadata,omitempty"`
+	// The usage of the run, nil until it's terminal.
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// Terminal reports whether the run is finished, so its status doesn't change anymore.
+func (r *Run) Terminal() bool {
+	switch r.Status {
+	case RunCancelled, RunFailed, RunCompleted, RunIncomplete, RunExpired:
+		return true
+	}
+	return false
+}
+
+type RunRequiredAction struct {
+	// The type of the action, only "submit_tool_outputs" is supported.
+	Type              string `json:"type"`
+	SubmitToolOutputs struct {
+		// The calls of the functions whose outputs continue the run.
+		ToolCalls []ToolCall `json:"tool_calls"`
+	} `json:"submit_tool_outputs"`
+}
+
+type RunError struct {
+	// The code of the error, e.g. "server_error" or "rate_limit_exceeded".
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type RunIncompleteDetails struct {
+	// The reason, e.g. "max_completion_tokens" or "max_prompt_tokens".
+	Reason string `json:"reason"`
+}
+
+// RetrieveRun returns the run of the thread.
+//
+// Docs: https://platform.openai.com/docs/api-reference/runs/getRun
+func (e *Engine) RetrieveRun(ctx context.Context, threadId, runId string) (*Run, error) {
+	uri := e.apiBaseURL + "/threads/" + url.PathEscape(threadId) + "/runs/" + url.PathEscape(runId)
+	ctx = assistantsContext(ctx, "/threads/{thread_id}/runs/{run_id}")
+	var run Run
+	if err := e.sendJSON(ctx, http.MethodGet, uri, nil, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+type CancelRunOptions struct {
+	// IgnoreTerminalState makes CancelRun return the run of the terminal status, e.g. if it
+	// completed in the meantime, instead of the error of the API rejecting the cancellation.
+	IgnoreTerminalState bool
+}
+
+// CancelRun cancels the run in progress. Its status is RunCancelling until the current step
+// is stopped, then RunCancelled. The API rejects the cancellation of the terminal run with
+// the 400 error, see CancelRunOptions.IgnoreTerminalState. opts may be nil.
+//
+// Docs: https://platform.openai.com/docs/api-reference/runs/cancelRun
+func (e *Engine) CancelRun(ctx context.Context, threadId, runId string, opts *CancelRunOptions) (*Run, error) {
+	if opts == nil {
+		opts = &CancelRunOptions{}
+	}
+	uri := e.apiBaseURL + "/threads/" + url.PathEscape(threadId) + "/runs/" + url.PathEscape(runId) + "/cancel"
+	var run Run
+	err := e.sendJSON(assistantsContext(ctx, "/threads/{thread_id}/runs/{run_id}/cancel"), http.MethodPost, uri, nil, &run)
+	if err == nil {
+		return &run, nil
+	}
+	var apiErr APIError
+	if !opts.IgnoreTerminalState || !errors.As(err, &apiErr) || apiErr.Err.StatusCode != http.StatusBadRequest {
+		return nil, err
+	}
+	// The cancellation is rejected for other reasons too, e.g. the run of another thread
+	current, rerr := e.RetrieveRun(ctx, threadId, runId)
+	if rerr != nil || !current.Terminal() {
+		return nil, err
+	}
+	return current, nil
+}
+
+// IncludeFileSearchResultsContent is included by ListRunStepsOptions.Include to return the content
+// of the results of the file search calls, see RunStep.FileSearchResults.
+const IncludeFileSearchResultsContent = "step_details.tool_calls[*].file_search.results[*].content"
+
+// ErrFileSearchResultsNotIncluded is returned by RunStep.FileSearchResults if the results of
+// the file search call weren't returned by the API.
+var ErrFileSearchResultsNotIncluded = errors.New("openai: file search results not included")
+
+// RunStep is the step of the run, the creation of the message or the tool calls.
+type RunStep struct {
+	Id          string `json:"id"`
+	Object      string `json:"object"`
+	CreatedAt   int64  `json:"created_at"`
+	ThreadId    string `json:"thread_id"`
+	RunId       string `json:"run_id"`
+	AssistantId string `json:"assistant_id"`
+	// The type of the step, "message_creation" or "tool_calls".
+	Type string `json:"type"`
+	// The status of the step, e.g. RunInProgress, see the statuses of the run.
+	Status      string         `json:"status"`
+	StepDetails RunStepDetails `json:"step_details"`
+	// The error of the failed step, nil if it didn't fail.
+	LastError   *RunError `json:"last_error,omitempty"`
+	CompletedAt int64     `json:"completed_at,omitempty"`
+	Usage       *Usage    `json:"usage,omitempty"`
+}
+
+// RunStepDetails are the details of the step, set according to the type.
+type RunStepDetails struct {
+	Type string `json:"type"`
+	// The message created by the step of "message_creation".
+	MessageCreation *struct {
+		MessageId string `json:"message_id"`
+	} `json:"message_creation,omitempty"`
+	// The tool calls of the step of "tool_calls".
+	ToolCalls []RunStepToolCall `json:"tool_calls,omitempty"`
+}
+
+// RunStepToolCall is the call of the tool of the step, the variant of the type is set.
+type RunStepToolCall struct {
+	Id string `json:"id"`
+	// The type of the tool, "code_interpreter", "file_search" or "function".
+	Type            string                  `json:"type"`
+	CodeInterpreter *RunStepCodeInterpreter `json:"code_interpreter,omitempty"`
+	FileSearch      *RunStepFileSearch      `json:"file_search,omitempty"`
+	Function        *RunStepFunctionCall    `json:"function,omitempty"`
+}
+
+type RunStepCodeInterpreter struct {
+	Input string `json:"input"`
+	// The outputs of the code, the logs or the images.
+	Outputs json.RawMessage `json:"outputs,omitempty"`
+}
+
+type RunStepFileSearch struct {
+	// The results of the search, nil unless they were included, see IncludeFileSearchResultsContent.
+	Results []FileSearchResult `json:"results,omitempty"`
+}
+
+type RunStepFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	// The output of the function submitted by the caller, empty until it's submitted.
+	Output string `json:"output,omitempty"`
+}
+
+// FileSearchResult is the chunk of the file found by the file search.
+type FileSearchResult struct {
+	FileId   string `json:"file_id"`
+	FileName string `json:"file_name"`
+	// The score of the relevance of the result, between 0 and 1.
+	Score float64 `json:"score"`
+	// The content of the result, only returned if it's included, see IncludeFileSearchResultsContent.
+	Content []FileSearchResultContent `json:"content,omitempty"`
+}
+
+type FileSearchResultContent struct {
+	// The type of the content, only "text" is supported.
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// FileSearchResults returns the results of all file search calls of the step, in order. It returns
+// nil if the step has no file search calls, and ErrFileSearchResultsNotIncluded if their results
+// weren't returned, list the steps with ListRunStepsOptions.Include to return them.
+func (s *RunStep) FileSearchResults() ([]FileSearchResult, error) {
+	var results []FileSearchResult
+	for _, call := range s.StepDetails.ToolCalls {
+		if call.Type != "file_search" {
+			continue
+		}
+		if call.FileSearch == nil || call.FileSearch.Results == nil {
+			return nil, fmt.Errorf("%w: tool call %s", ErrFileSearchResultsNotIncluded, call.Id)
+		}
+		results = append(results, call.FileSearch.Results...)
+	}
+	return results, nil
+}
+
+type ListRunStepsOptions struct {
+	ListOptions
+	// Additional fields to include, e.g. IncludeFileSearchResultsContent.
+	Include []string
+}
+
+// ListRunSteps returns the page of the steps of the run.
+//
+// Docs: https://platform.openai.com/docs/api-reference/run-steps/listRunSteps
+func (e *Engine) ListRunSteps(ctx context.Context, threadId, runId string, opts *ListRunStepsOptions) (*Page[RunStep], error) {
+	if opts == nil {
+		opts = &ListRunStepsOptions{}
+	}
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	q := opts.ListOptions.query()
+	for _, field := range opts.Include {
+		q.Add("include[]", field)
+	}
+	uri := withQuery(e.apiBaseURL+"/threads/"+url.PathEscape(threadId)+"/runs/"+url.PathEscape(runId)+"/steps", q)
+	ctx = assistantsContext(ctx, "/threads/{thread_id}/runs/{run_id}/steps")
+	var page Page[RunStep]
+	if err := e.sendJSON(ctx, http.MethodGet, uri, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// AllRunSteps iterates over the steps of the run of all pages, starting with the page of opts.
+func (e *Engine) AllRunSteps(ctx context.Context, threadId, runId string, opts *ListRunStepsOptions) iter.Seq2[RunStep, error] {
+	var o ListRunStepsOptions
+	if opts != nil {
+		o = *opts
+	}
+	return paginate(ctx, o.After, func(ctx context.Context, after string) (*Page[RunStep], error) {
+		o.After = after
+		return e.ListRunSteps(ctx, threadId, runId, &o)
+	})
+}
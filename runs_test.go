@@ -0,0 +1,125 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRunServer serves the cancellation of the run of the status, rejected unless it's in progress,
+// and the retrieval of the run.
+func newRunServer(t *testing.T, status string) (*Engine, *[]string) {
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		assert.Equal(t, "assistants=v2", r.Header.Get("OpenAI-Beta"))
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/threads/thread_1/runs/run_1/cancel":
+			if status != RunInProgress {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":{"message":"Cannot cancel run with status '` + status + `'.","type":"invalid_request_error","param":null,"code":null}}`))
+				return
+			}
+			w.Write([]byte(`{"id":"run_1","object":"thread.run","thread_id":"thread_1","assistant_id":"asst_1","status":"cancelling","model":"gpt-4o","tools":[]}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/threads/thread_1/runs/run_1":
+			w.Write([]byte(`{"id":"run_1","object":"thread.run","thread_id":"thread_1","assistant_id":"asst_1","status":"` + status + `",
+				"completed_at":1699075592,"model":"gpt-4o","tools":[{"type":"file_search"}],
+				"usage":{"prompt_tokens":123,"completion_tokens":456,"total_tokens":579}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	return e, &calls
+}
+
+func TestCancelRun(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("in progress", func(t *testing.T) {
+		e, calls := newRunServer(t, RunInProgress)
+		run, err := e.CancelRun(ctx, "thread_1", "run_1", nil)
+		require.NoError(t, err)
+		assert.Equal(t, RunCancelling, run.Status)
+		assert.False(t, run.Terminal())
+		assert.Equal(t, []string{"POST /threads/thread_1/runs/run_1/cancel"}, *calls)
+	})
+	t.Run("terminal", func(t *testing.T) {
+		e, _ := newRunServer(t, RunCompleted)
+		_, err := e.CancelRun(ctx, "thread_1", "run_1", nil)
+		var apiErr APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, "Cannot cancel run with status 'completed'.", apiErr.Err.Message)
+	})
+	t.Run("ignore terminal state", func(t *testing.T) {
+		e, calls := newRunServer(t, RunCompleted)
+		run, err := e.CancelRun(ctx, "thread_1", "run_1", &CancelRunOptions{IgnoreTerminalState: true})
+		require.NoError(t, err)
+		assert.Equal(t, RunCompleted, run.Status)
+		assert.True(t, run.Terminal())
+		assert.Equal(t, []AssistantTool{{Type: "file_search"}}, run.Tools)
+		assert.Equal(t, 579, run.Usage.TotalTokens)
+		assert.Equal(t, []string{"POST /threads/thread_1/runs/run_1/cancel", "GET /threads/thread_1/runs/run_1"}, *calls)
+	})
+	t.Run("ignore terminal state of the run in progress", func(t *testing.T) {
+		e, _ := newRunServer(t, RunCancelling)
+		_, err := e.CancelRun(ctx, "thread_1", "run_1", &CancelRunOptions{IgnoreTerminalState: true})
+		var apiErr APIError
+		require.ErrorAs(t, err, &apiErr, "the run isn't terminal, so the rejection is returned")
+		assert.Contains(t, apiErr.Err.Message, "'cancelling'")
+	})
+}
+
+const testRunSteps = `{"object":"list","data":[
+{"id":"step_2","object":"thread.run.step","created_at":1699063291,"run_id":"run_1","assistant_id":"asst_1","thread_id":"thread_1",
+"type":"message_creation","status":"completed","step_details":{"type":"message_creation","message_creation":{"message_id":"msg_1"}}},
+{"id":"step_1","object":"thread.run.step","created_at":1699063290,"run_id":"run_1","assistant_id":"asst_1","thread_id":"thread_1",
+"type":"tool_calls","status":"completed","step_details":{"type":"tool_calls","tool_calls":[
+{"id":"call_1","type":"file_search","file_search":{"ranking_options":{"ranker":"default_2024_08_21","score_threshold":0.0},"results":[
+{"file_id":"file-1","file_name":"handbook.pdf","score":0.92,"content":[{"type":"text","text":"Vacation is 25 days."}]},
+{"file_id":"file-2","file_name":"faq.md","score":0.61,"content":[{"type":"text","text":"Ask HR."}]}]}},
+{"id":"call_2","type":"function","function":{"name":"get_weather","arguments":"{}","output":"sunny"}},
+{"id":"call_3","type":"file_search","file_search":{"results":[]}}]},
+"usage":{"prompt_tokens":120,"completion_tokens":20,"total_tokens":140}}],
+"first_id":"step_2","last_id":"step_1","has_more":false}`
+
+func TestRunStepFileSearchResults(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/threads/thread_1/runs/run_1/steps", r.URL.Path)
+		assert.Equal(t, []string{IncludeFileSearchResultsContent}, r.URL.Query()["include[]"])
+		w.Write([]byte(testRunSteps))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	page, err := e.ListRunSteps(context.Background(), "thread_1", "run_1", &ListRunStepsOptions{Include: []string{IncludeFileSearchResultsContent}})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 2)
+
+	results, err := page.Data[0].FileSearchResults()
+	require.NoError(t, err)
+	assert.Nil(t, results, "the step of the message creation has no results")
+
+	results, err = page.Data[1].FileSearchResults()
+	require.NoError(t, err)
+	assert.Equal(t, []FileSearchResult{
+		{FileId: "file-1", FileName: "handbook.pdf", Score: 0.92, Content: []FileSearchResultContent{{Type: "text", Text: "Vacation is 25 days."}}},
+		{FileId: "file-2", FileName: "faq.md", Score: 0.61, Content: []FileSearchResultContent{{Type: "text", Text: "Ask HR."}}},
+	}, results)
+	assert.Equal(t, "sunny", page.Data[1].StepDetails.ToolCalls[1].Function.Output)
+
+	step := RunStep{Type: "tool_calls", StepDetails: RunStepDetails{Type: "tool_calls",
+		ToolCalls: []RunStepToolCall{{Id: "call_1", Type: "file_search", FileSearch: &RunStepFileSearch{}}}}}
+	_, err = step.FileSearchResults()
+	assert.ErrorIs(t, err, ErrFileSearchResultsNotIncluded)
+}
@@ -0,0 +1,268 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type CreateRunOptions struct {
+	// The ID of the assistant which executes the run.
+	AssistantId string `json:"assistant_id" binding:"required"`
+	// The model of the run, the model of the assistant if it's empty.
+	Model Model `json:"model,omitempty"`
+	// The instructions of the run, which replace the instructions of the assistant,
+	// see WithInstructionsOverride and WithInstructionsAppend.
+	Instructions string `json:"instructions,omitempty"`
+	// The instructions appended to the instructions of the run.
+	AdditionalInstructions string `json:"additional_instructions,omitempty"`
+	// The tools of the run, which replace the tools of the assistant.
+	Tools               []AssistantTool   `json:"tools,omitempty"`
+	Temperature         float32           `json:"temperature,omitempty"`
+	MaxPromptTokens     int               `json:"max_prompt_tokens,omitempty"`
+	MaxCompletionTokens int               `json:"max_completion_tokens,omitempty"`
+	Metadata            map[string]string `json:"metadata,omitempty"`
+}
+
+// RunOption is used to set the options of the run created by CreateRun and CreateRunStream,
+// on top of CreateRunOptions. The options are applied in order to the copy of CreateRunOptions.
+type RunOption func(ctx context.Context, e *Engine, opts *CreateRunOptions) error
+
+// WithInstructionsOverride is used to replace the instructions of the assistant for the run,
+// it sets CreateRunOptions.Instructions.
+func WithInstructionsOverride(instructions string) RunOption {
+	return func(ctx context.Context, e *Engine, opts *CreateRunOptions) error {
+		opts.Instructions = instructions
+		return nil
+	}
+}
+
+// WithInstructionsAppend is used to append suffix to the instructions of the run, e.g. to inject
+// the context of the request, include the separator in suffix. The instructions of the assistant
+// are retrieved unless they were overridden, see WithInstructionsOverride.
+func WithInstructionsAppend(suffix string) RunOption {
+	return func(ctx context.Context, e *Engine, opts *CreateRunOptions) error {
+		if opts.Instructions == "" {
+			assistant, err := e.RetrieveAssistant(ctx, opts.AssistantId)
+			if err != nil {
+				return fmt.Errorf("retrieve instructions of assistant %s: %w", opts.AssistantId, err)
+			}
+			opts.Instructions = assistant.Instructions
+		}
+		opts.Instructions += suffix
+		return nil
+	}
+}
+
+// runOptions returns the copy of opts with runOpts applied, opts is validated first.
+func (e *Engine) runOptions(ctx context.Context, opts *CreateRunOptions, runOpts []RunOption) (*CreateRunOptions, error) {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	req := *opts
+	for _, opt := range runOpts {
+		if err := opt(ctx, e, &req); err != nil {
+			return nil, err
+		}
+	}
+	return &req, nil
+}
+
+// CreateRun starts the run of the assistant on the thread. Poll it with RetrieveRun until it's
+// terminal, or stream its events with CreateRunStream instead. opts isn't modified by runOpts.
+//
+// Docs: https://platform.openai.com/docs/api-reference/runs/createRun
+func (e *Engine) CreateRun(ctx context.Context, threadId string, opts *CreateRunOptions, runOpts ...RunOption) (*Run, error) {
+	opts, err := e.runOptions(ctx, opts, runOpts)
+	if err != nil {
+		return nil, err
+	}
+	uri := e.apiBaseURL + "/threads/" + url.PathEscape(threadId) + "/runs"
+	ctx = assistantsContext(ctx, "/threads/{thread_id}/runs")
+	var run Run
+	if err := e.sendJSON(ctx, http.MethodPost, uri, opts, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// RunEvent is the event of the streamed run. The variant of the object of the event is set,
+// e.g. Run for the "thread.run.completed" event, the events of other objects, e.g.
+// "thread.run.step.delta", only have Data.
+//
+// Docs: https://platform.openai.com/docs/api-reference/assistants-streaming/events
+type RunEvent struct {
+	// Event is the type of the event, e.g. "thread.message.delta".
+	Event string
+	// Data is the object of the event.
+	Data json.RawMessage
+
+	// The run of the "thread.run.*" events.
+	Run *Run
+	// The step of the "thread.run.step.*" events, except for the deltas.
+	RunStep *RunStep
+	// The message of the "thread.message.*" events, except for the deltas.
+	Message *ThreadMessage
+	// The delta of the "thread.message.delta" event, see TextDeltaMerger.
+	MessageDelta *MessageDelta
+}
+
+// RunStream is the stream of the events of the run, it must be closed after use.
+type RunStream struct {
+	resp   *http.Response
+	reader *sseReader
+}
+
+// CreateRunStream is like CreateRun, but the events of the run are streamed back as it's executed.
+//
+// Docs: https://platform.openai.com/docs/api-reference/runs/createRun#runs-createrun-stream
+func (e *Engine) CreateRunStream(ctx context.Context, threadId string, opts *CreateRunOptions, runOpts ...RunOption) (*RunStream, error) {
+	opts, err := e.runOptions(ctx, opts, runOpts)
+	if err != nil {
+		return nil, err
+	}
+	uri := e.apiBaseURL + "/threads/" + url.PathEscape(threadId) + "/runs"
+	ctx = assistantsContext(ctx, "/threads/{thread_id}/runs")
+	r, err := marshalJson(struct {
+		*CreateRunOptions
+		Stream bool `json:"stream"`
+	}{opts, true})
+	if err != nil {
+		return nil, err
+	}
+	req, err := e.newReq(ctx, http.MethodPost, uri, "json", r)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.doReq(req)
+	if err != nil {
+		return nil, err
+	}
+	return &RunStream{resp: resp, reader: newSSEReader(resp.Body)}, nil
+}
+
+// Next returns the next event of the stream. It returns io.EOF when the stream is finished,
+// and the errors of the stream otherwise, see ChatCompletionStream.Recv.
+func (s *RunStream) Next() (*RunEvent, error) {
+	data, err := s.reader.next()
+	if err != nil {
+		return nil, streamError(s.resp.Request.Context(), err)
+	}
+	event := &RunEvent{Event: s.reader.scanner.Event().Type, Data: data}
+	var v interface{}
+	switch {
+	case event.Event == "thread.message.delta":
+		event.MessageDelta = &MessageDelta{}
+		v = event.MessageDelta
+	case strings.HasPrefix(event.Event, "thread.message."):
+		event.Message = &ThreadMessage{}
+		v = event.Message
+	case strings.HasPrefix(event.Event, "thread.run.step.") && event.Event != "thread.run.step.delta":
+		event.RunStep = &RunStep{}
+		v = event.RunStep
+	case strings.HasPrefix(event.Event, "thread.run.") && !strings.HasPrefix(event.Event, "thread.run.step."):
+		event.Run = &Run{}
+		v = event.Run
+	default:
+		return event, nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, frameError(s.reader.scanner.Event(), err)
+	}
+	return event, nil
+}
+
+// Close closes the stream. The connection is reused if the stream was
+// read to the end, otherwise it's closed.
+func (s *RunStream) Close() error {
+	if s.reader.done {
+		drainBody(s.resp.Body)
+		return nil
+	}
+	return s.resp.Body.Close()
+}
+
+// AssistantStreamHandler handles the events of the run streamed by RunStream.Handle.
+type AssistantStreamHandler interface {
+	// OnEvent is called with every event of the stream, in order. The stream stops with the error.
+	OnEvent(event *RunEvent) error
+	// OnError is called with the error of the stream, it's the last call of the handler.
+	OnError(err error)
+	// OnDone is called once the stream is finished, it's the last call of the handler.
+	OnDone()
+}
+
+// Handle reads the events of the stream and passes them to handler until the stream is finished,
+// the stream reports the error, handler returns the error, or ctx is done, and closes the stream.
+// The error of the stream is passed to OnError as well as returned, ErrStreamCanceled if ctx is done.
+// The error of OnEvent is returned as is.
+func (s *RunStream) Handle(ctx context.Context, handler AssistantStreamHandler) error {
+	defer s.Close()
+	// Closing the body unblocks the read of the next event
+	stop := context.AfterFunc(ctx, func() { s.resp.Body.Close() })
+	defer stop()
+	for {
+		event, err := s.Next()
+		if err == io.EOF {
+			handler.OnDone()
+			return nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				err = fmt.Errorf("%w: %w", ErrStreamCanceled, doneReason(ctx))
+			}
+			handler.OnError(err)
+			return err
+		}
+		if err := handler.OnEvent(event); err != nil {
+			return err
+		}
+	}
+}
+
+// NewPrintStreamHandler returns the handler which writes the text of the messages to w as it's
+// streamed, e.g. to prototype with os.Stdout. The messages are separated by blank lines, and
+// the error of the stream is written as well.
+func NewPrintStreamHandler(w io.Writer) AssistantStreamHandler {
+	return &printStreamHandler{w: w}
+}
+
+type printStreamHandler struct {
+	w        io.Writer
+	messages int
+}
+
+func (h *printStreamHandler) OnEvent(event *RunEvent) error {
+	switch {
+	case event.Event == "thread.message.created":
+		if h.messages++; h.messages > 1 {
+			_, err := io.WriteString(h.w, "\n\n")
+			return err
+		}
+	case event.MessageDelta != nil:
+		for _, c := range event.MessageDelta.Delta.Content {
+			if c.Text == nil {
+				continue
+			}
+			if _, err := io.WriteString(h.w, c.Text.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (h *printStreamHandler) OnError(err error) {
+	fmt.Fprintf(h.w, "\nerror: %v\n", err)
+}
+
+func (h *printStreamHandler) OnDone() {
+	io.WriteString(h.w, "\n")
+}
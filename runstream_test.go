@@ -0,0 +1,190 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRunStreamServer streams the events of the fixture of the run.
+func newRunStreamServer(t *testing.T, fixture string) *Engine {
+	events, err := os.ReadFile(fixture)
+	require.NoError(t, err)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/threads/thread_123/runs", r.URL.Path)
+		assert.Equal(t, "assistants=v2", r.Header.Get("OpenAI-Beta"))
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]interface{}{"assistant_id": "asst_123", "stream": true}, body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write(events)
+	}))
+	t.Cleanup(srv.Close)
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	return e
+}
+
+func TestRunStream(t *testing.T) {
+	e := newRunStreamServer(t, "testdata/assistants/run_stream.sse")
+	stream, err := e.CreateRunStream(context.Background(), "thread_123", &CreateRunOptions{AssistantId: "asst_123"})
+	require.NoError(t, err)
+	defer stream.Close()
+
+	var (
+		types  []string
+		merger TextDeltaMerger
+		msg    *ThreadMessage
+		last   *RunEvent
+	)
+	for {
+		event, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		types = append(types, event.Event)
+		if event.MessageDelta != nil {
+			msg = merger.Apply(event.MessageDelta)
+		}
+		last = event
+	}
+	assert.Equal(t, []string{"thread.run.created", "thread.run.in_progress", "thread.run.step.created", "thread.message.created",
+		"thread.message.delta", "thread.message.delta", "thread.message.completed", "thread.run.step.completed", "thread.run.completed"}, types)
+	assert.Equal(t, "Hello, world!", msg.Content[0].Text.Value)
+	require.NotNil(t, last.Run)
+	assert.Equal(t, RunCompleted, last.Run.Status)
+	assert.Equal(t, 31, last.Run.Usage.TotalTokens)
+}
+
+type recordingStreamHandler struct {
+	events []string
+	err    error
+	done   bool
+	fail   error
+}
+
+func (h *recordingStreamHandler) OnEvent(event *RunEvent) error {
+	h.events = append(h.events, event.Event)
+	if event.Event == "thread.message.completed" {
+		return h.fail
+	}
+	return nil
+}
+
+func (h *recordingStreamHandler) OnError(err error) { h.err = err }
+func (h *recordingStreamHandler) OnDone()           { h.done = true }
+
+func TestRunStreamHandle(t *testing.T) {
+	e := newRunStreamServer(t, "testdata/assistants/run_stream.sse")
+	ctx := context.Background()
+	opts := &CreateRunOptions{AssistantId: "asst_123"}
+
+	stream, err := e.CreateRunStream(ctx, "thread_123", opts)
+	require.NoError(t, err)
+	var h recordingStreamHandler
+	require.NoError(t, stream.Handle(ctx, &h))
+	assert.Len(t, h.events, 9)
+	assert.True(t, h.done)
+	assert.NoError(t, h.err)
+
+	stream, err = e.CreateRunStream(ctx, "thread_123", opts)
+	require.NoError(t, err)
+	h = recordingStreamHandler{fail: errors.New("stop")}
+	assert.EqualError(t, stream.Handle(ctx, &h), "stop")
+	assert.Len(t, h.events, 7, "the handler stops the stream")
+	assert.False(t, h.done)
+
+	stream, err = e.CreateRunStream(ctx, "thread_123", opts)
+	require.NoError(t, err)
+	var out bytes.Buffer
+	require.NoError(t, stream.Handle(ctx, NewPrintStreamHandler(&out)))
+	assert.Equal(t, "Hello, world!\n", out.String())
+}
+
+func TestRunStreamHandleError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: thread.run.created\ndata: {\"id\":\"run_123\",\"status\":\"queued\"}\n\n" +
+			"event: error\ndata: {\"error\":{\"message\":\"server overloaded\",\"type\":\"server_error\"}}\n\n"))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	stream, err := e.CreateRunStream(context.Background(), "thread_123", &CreateRunOptions{AssistantId: "asst_123"})
+	require.NoError(t, err)
+	var out bytes.Buffer
+	err = stream.Handle(context.Background(), NewPrintStreamHandler(&out))
+	var streamErr *StreamAPIError
+	require.ErrorAs(t, err, &streamErr)
+	assert.Equal(t, "server overloaded", streamErr.APIError.Err.Message)
+	assert.Contains(t, out.String(), "error: openai: stream error:")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stream, err = e.CreateRunStream(context.Background(), "thread_123", &CreateRunOptions{AssistantId: "asst_123"})
+	require.NoError(t, err)
+	var h recordingStreamHandler
+	assert.ErrorIs(t, stream.Handle(ctx, &h), ErrStreamCanceled)
+	assert.ErrorIs(t, h.err, ErrStreamCanceled)
+}
+
+func TestCreateRunInstructions(t *testing.T) {
+	var (
+		created    []CreateRunOptions
+		retrievals int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/assistants/asst_123":
+			retrievals++
+			w.Write([]byte(`{"id":"asst_123","object":"assistant","model":"gpt-4o","instructions":"You are a support agent.","tools":[]}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/threads/thread_123/runs":
+			var opts CreateRunOptions
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&opts))
+			created = append(created, opts)
+			json.NewEncoder(w).Encode(Run{Id: "run_123", Object: "thread.run", Status: RunQueued, Instructions: opts.Instructions})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(notFoundBody))
+		}
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	ctx := context.Background()
+	opts := &CreateRunOptions{AssistantId: "asst_123"}
+
+	run, err := e.CreateRun(ctx, "thread_123", opts, WithInstructionsOverride("Answer in German."))
+	require.NoError(t, err)
+	assert.Equal(t, "Answer in German.", run.Instructions)
+	assert.Zero(t, retrievals)
+
+	run, err = e.CreateRun(ctx, "thread_123", opts, WithInstructionsAppend(" The user is on the Pro plan."))
+	require.NoError(t, err)
+	assert.Equal(t, "You are a support agent. The user is on the Pro plan.", run.Instructions)
+	assert.Equal(t, 1, retrievals)
+
+	_, err = e.CreateRun(ctx, "thread_123", opts, WithInstructionsOverride("Be brief."), WithInstructionsAppend(" Be kind."))
+	require.NoError(t, err)
+	assert.Equal(t, "Be brief. Be kind.", created[2].Instructions, "the override is appended to")
+	assert.Equal(t, 1, retrievals)
+	assert.Empty(t, opts.Instructions, "opts isn't modified")
+
+	_, err = e.CreateRun(ctx, "thread_123", &CreateRunOptions{AssistantId: "asst_missing"}, WithInstructionsAppend("!"))
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Len(t, created, 3, "the run isn't created")
+}
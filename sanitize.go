@@ -0,0 +1,61 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"strings"
+	"unicode"
+)
+
+// WithContentSanitizer is used to pass the content of every chat message through fn before it's sent,
+// including the text parts of multimodal messages. StripControlCharacters is used if fn isn't passed.
+func WithContentSanitizer(fn ...func(string) string) EngineOption {
+	return func(e *Engine) {
+		if len(fn) == 0 || fn[0] == nil {
+			e.sanitizer = StripControlCharacters()
+			return
+		}
+		e.sanitizer = fn[0]
+	}
+}
+
+// StripControlCharacters returns the sanitizer which removes Unicode control characters (category Cc),
+// e.g. null bytes which are rejected by the API, except for tabs and newlines.
+func StripControlCharacters() func(string) string {
+	return func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if r != '\t' && r != '\n' && unicode.IsControl(r) {
+				return -1
+			}
+			return r
+		}, s)
+	}
+}
+
+// sanitize returns opts with the content of messages passed through the sanitizer, opts isn't modified.
+func (e *Engine) sanitize(opts *ChatCompletionOptions) *ChatCompletionOptions {
+	if e.sanitizer == nil {
+		return opts
+	}
+	out := *opts
+	if opts.Instructions != "" {
+		out.Instructions = e.sanitizer(opts.Instructions)
+	}
+	out.Messages = make([]ChatMessage, len(opts.Messages))
+	for i, m := range opts.Messages {
+		m.Content = e.sanitizer(m.Content)
+		if m.Parts != nil {
+			parts := make([]ContentPart, len(m.Parts))
+			for j, part := range m.Parts {
+				if part.Type == ContentPartText {
+					part.Text = e.sanitizer(part.Text)
+				}
+				parts[j] = part
+			}
+			m.Parts = parts
+		}
+		out.Messages[i] = m
+	}
+	return &out
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripControlCharacters(t *testing.T) {
+	strip := StripControlCharacters()
+	assert.Equal(t, "hello world", strip("hello\x00 wor\x1bld\x7f"))
+	assert.Equal(t, "line\n\tindented", strip("line\r\n\tindented"))
+	assert.Equal(t, "naïve 日本\u200b", strip("naïve\u0085 日本\u200b"), "only the Cc category is removed")
+}
+
+func TestContentSanitizer(t *testing.T) {
+	var messages []ChatMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []ChatMessage `json:"messages"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		messages = body.Messages
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer srv.Close()
+
+	e := New("sk-test", WithContentSanitizer())
+	e.apiBaseURL = srv.URL
+	opts := &ChatCompletionOptions{Model: ModelGPT4, Messages: []ChatMessage{
+		{Role: "user", Content: "null\x00byte"},
+		{Role: "user", Parts: []ContentPart{{Type: ContentPartText, Text: "part\x00"}, NewImageURLPart("https://example.com/a\x00.png", "")}},
+	}}
+	_, err := e.ChatCompletion(context.Background(), opts)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.Equal(t, "nullbyte", messages[0].Content)
+	assert.Equal(t, "part", messages[1].Parts[0].Text)
+	assert.Equal(t, "https://example.com/a\x00.png", messages[1].Parts[1].ImageURL.URL, "only text is sanitized")
+	assert.Equal(t, "null\x00byte", opts.Messages[0].Content, "options must not be modified")
+
+	e = New("sk-test", WithContentSanitizer(strings.ToUpper))
+	e.apiBaseURL = srv.URL
+	_, err = e.ChatCompletion(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	assert.Equal(t, strings.ToUpper(testChatOptions().Messages[0].Content), messages[0].Content)
+}
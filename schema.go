@@ -0,0 +1,139 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// JSONSchemaOf returns the JSON Schema of the value of type t as it's encoded by encoding/json.
+//
+// Fields of structs are named by their json tags, and are required unless they're tagged with
+// omitempty. The description tag of the field is its description, e.g.
+//
+//	type WeatherParams struct {
+//		City string `json:"city" description:"The name of the city"`
+//		Unit string `json:"unit,omitempty" enum:"celsius,fahrenheit"`
+//	}
+//
+// The enum tag lists the allowed values of the string field. Recursive types, channels,
+// functions and maps with keys other than strings are not supported.
+func JSONSchemaOf(t reflect.Type) (json.RawMessage, error) {
+	schema, err := schemaOf(t, nil)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(schema)
+}
+
+func schemaOf(t reflect.Type, seen []reflect.Type) (map[string]interface{}, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string"}, nil // encoded in base64
+		}
+		items, err := schemaOf(t.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map key of %s must be a string", t)
+		}
+		values, err := schemaOf(t.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": values}, nil
+	case reflect.Interface:
+		return map[string]interface{}{}, nil // any value
+	case reflect.Struct:
+		for _, s := range seen {
+			if s == t {
+				return nil, fmt.Errorf("recursive type %s isn't supported", t)
+			}
+		}
+		return structSchema(t, append(seen, t))
+	}
+	return nil, fmt.Errorf("type %s isn't supported", t)
+}
+
+func structSchema(t reflect.Type, seen []reflect.Type) (map[string]interface{}, error) {
+	properties := make(map[string]interface{})
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		embedded := f.Anonymous && name == "" && indirect(f.Type).Kind() == reflect.Struct
+		if !f.IsExported() && !embedded {
+			continue
+		}
+		if embedded {
+			// Fields of embedded structs are promoted
+			schema, err := schemaOf(f.Type, seen)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range schema["properties"].(map[string]interface{}) {
+				properties[k] = v
+			}
+			required = append(required, schema["required"].([]string)...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		property, err := schemaOf(f.Type, seen)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", t.Name(), f.Name, err)
+		}
+		if description := f.Tag.Get("description"); description != "" {
+			property["description"] = description
+		}
+		if enum := f.Tag.Get("enum"); enum != "" {
+			property["enum"] = strings.Split(enum, ",")
+		}
+		properties[name] = property
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			required = append(required, name)
+		}
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}, nil
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type schemaBase struct {
+	Id string `json:"id"`
+}
+
+type schemaParams struct {
+	schemaBase
+	Tags     []string          `json:"tags,omitempty"`
+	Limit    *int              `json:"limit,omitempty"`
+	Score    float64           `json:"score"`
+	Exact    bool              `json:"exact"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Since    time.Time         `json:"since"`
+	Extra    interface{}       `json:"extra,omitempty"`
+	Internal string            `json:"-"`
+	hidden   string
+}
+
+type schemaNode struct {
+	Children []schemaNode `json:"children"`
+}
+
+func TestJSONSchemaOf(t *testing.T) {
+	schema, err := JSONSchemaOf(reflect.TypeOf(&schemaParams{}))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"id": {"type": "string"},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"limit": {"type": "integer"},
+			"score": {"type": "number"},
+			"exact": {"type": "boolean"},
+			"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+			"since": {"type": "string", "format": "date-time"},
+			"extra": {}
+		},
+		"required": ["id", "score", "exact", "since"]
+	}`, string(schema))
+	var decoded interface{}
+	require.NoError(t, json.Unmarshal(schema, &decoded))
+	assert.Empty(t, isObjectSchema(decoded), "the schema must pass the local validation")
+
+	_, err = JSONSchemaOf(reflect.TypeOf(schemaNode{}))
+	assert.ErrorContains(t, err, "recursive type")
+	_, err = JSONSchemaOf(reflect.TypeOf(map[int]string{}))
+	assert.ErrorContains(t, err, "map key")
+	_, err = JSONSchemaOf(reflect.TypeOf(struct{ C chan int }{}))
+	assert.ErrorContains(t, err, "type chan int isn't supported")
+}
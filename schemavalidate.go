@@ -0,0 +1,195 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// SchemaViolation is the part of the JSON document which doesn't conform to the schema.
+type SchemaViolation struct {
+	// Path of the value, e.g. "$.items[0].name", "$" is the document.
+	Path    string
+	Message string
+}
+
+func (v SchemaViolation) String() string {
+	return v.Path + ": " + v.Message
+}
+
+// SchemaViolationError is returned if the JSON document doesn't conform to the schema.
+type SchemaViolationError struct {
+	Violations []SchemaViolation
+}
+
+func (e *SchemaViolationError) Error() string {
+	violations := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		violations[i] = v.String()
+	}
+	return "openai: schema violation: " + strings.Join(violations, "; ")
+}
+
+// ValidateAgainstSchema is used to validate the JSON document data against the JSON schema.
+// It returns *SchemaViolationError listing every violation, or the error if data or schema
+// isn't valid JSON.
+//
+// Only the subset of JSON Schema used by structured outputs is supported: type, required,
+// enum, properties, additionalProperties, items and anyOf. Other keywords are ignored.
+func ValidateAgainstSchema(data []byte, schema json.RawMessage) error {
+	var s map[string]interface{}
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return fmt.Errorf("decode schema: %w", err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("decode document: %w", err)
+	}
+	var violations []SchemaViolation
+	validateValue(v, s, "$", &violations)
+	if len(violations) != 0 {
+		return &SchemaViolationError{Violations: violations}
+	}
+	return nil
+}
+
+func validateValue(v interface{}, schema map[string]interface{}, path string, violations *[]SchemaViolation) {
+	violate := func(format string, args ...interface{}) {
+		*violations = append(*violations, SchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if t, ok := schema["type"]; ok && !matchesSchemaType(v, t) {
+		violate("must be of type %s, got %s", schemaTypeString(t), jsonTypeOf(v))
+		return
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(v, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			b, _ := json.Marshal(v)
+			violate("must be one of %s, got %s", enumString(enum), b)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok && !matchesAnyOf(v, anyOf, path) {
+		violate("must match one of anyOf schemas")
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				if name, _ := r.(string); name != "" {
+					if _, ok := v[name]; !ok {
+						violate("missing required property %q", name)
+					}
+				}
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := properties[name].(map[string]interface{}); ok {
+				validateValue(v[name], property, path+"."+name, violations)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					violate("unexpected property %q", name)
+				}
+			case map[string]interface{}:
+				validateValue(v[name], additional, path+"."+name, violations)
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validateValue(item, items, fmt.Sprintf("%s[%d]", path, i), violations)
+			}
+		}
+	}
+}
+
+func matchesAnyOf(v interface{}, anyOf []interface{}, path string) bool {
+	for _, s := range anyOf {
+		schema, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var violations []SchemaViolation
+		validateValue(v, schema, path, &violations)
+		if len(violations) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesSchemaType reports whether v is of the type t, the type name or the list of them.
+func matchesSchemaType(v interface{}, t interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		actual := jsonTypeOf(v)
+		if t == "integer" {
+			f, ok := v.(float64)
+			return ok && f == math.Trunc(f)
+		}
+		return actual == t
+	case []interface{}:
+		for _, t := range t {
+			if matchesSchemaType(v, t) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func jsonTypeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func schemaTypeString(t interface{}) string {
+	if types, ok := t.([]interface{}); ok {
+		names := make([]string, len(types))
+		for i, t := range types {
+			names[i] = fmt.Sprint(t)
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func enumString(enum []interface{}) string {
+	b, _ := json.Marshal(enum)
+	return string(b)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAgainstSchema(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		schema     string
+		data       string
+		violations []string
+	}{
+		{"type", `{"type":"string"}`, `"a"`, nil},
+		{"type mismatch", `{"type":"string"}`, `1`, []string{"$: must be of type string, got number"}},
+		{"integer", `{"type":"integer"}`, `2`, nil},
+		{"integer fraction", `{"type":"integer"}`, `2.5`, []string{"$: must be of type integer, got number"}},
+		{"type list", `{"type":["string","null"]}`, `null`, nil},
+		{"type list mismatch", `{"type":["string","null"]}`, `true`, []string{"$: must be of type string or null, got boolean"}},
+		{"required", `{"type":"object","required":["a","b"]}`, `{"a":1}`, []string{`$: missing required property "b"`}},
+		{"enum", `{"enum":["red","green"]}`, `"green"`, nil},
+		{"enum mismatch", `{"enum":["red","green"]}`, `"blue"`, []string{`$: must be one of ["red","green"], got "blue"`}},
+		{"enum number", `{"enum":[1,2]}`, `2`, nil},
+		{"additional properties forbidden", `{"type":"object","properties":{"a":{}},"additionalProperties":false}`, `{"a":1,"b":2}`,
+			[]string{`$: unexpected property "b"`}},
+		{"additional properties allowed", `{"type":"object","properties":{"a":{}}}`, `{"a":1,"b":2}`, nil},
+		{"additional properties schema", `{"type":"object","additionalProperties":{"type":"integer"}}`, `{"a":1,"b":"2"}`,
+			[]string{"$.b: must be of type integer, got string"}},
+		{"items", `{"type":"array","items":{"type":"number"}}`, `[1,"2",3,null]`,
+			[]string{"$[1]: must be of type number, got string", "$[3]: must be of type number, got null"}},
+		{"any of", `{"anyOf":[{"type":"string"},{"type":"null"}]}`, `1`, []string{"$: must match one of anyOf schemas"}},
+		{"nested object", `{"type":"object","properties":{"address":{"type":"object","properties":{"city":{"type":"string"}},"required":["city","zip"]}}}`,
+			`{"address":{"city":7}}`, []string{`$.address: missing required property "zip"`, "$.address.city: must be of type string, got number"}},
+		{"nested array of objects", `{"type":"object","properties":{"items":{"type":"array","items":{"type":"object","properties":{"name":{"type":"string"},"kind":{"enum":["a","b"]}},"required":["name"],"additionalProperties":false}}}}`,
+			`{"items":[{"name":"x","kind":"a"},{"kind":"c","size":1}]}`,
+			[]string{`$.items[1]: missing required property "name"`, `$.items[1].kind: must be one of ["a","b"], got "c"`, `$.items[1]: unexpected property "size"`}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateAgainstSchema([]byte(tc.data), []byte(tc.schema))
+			if tc.violations == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var violationErr *SchemaViolationError
+			require.True(t, errors.As(err, &violationErr), "unexpected error: %v", err)
+			var violations []string
+			for _, v := range violationErr.Violations {
+				violations = append(violations, v.String())
+			}
+			assert.Equal(t, tc.violations, violations)
+		})
+	}
+}
+
+func TestValidateAgainstSchemaInvalidJSON(t *testing.T) {
+	err := ValidateAgainstSchema([]byte(`{"a":`), []byte(`{"type":"object"}`))
+	assert.ErrorContains(t, err, "decode document")
+	err = ValidateAgainstSchema([]byte(`{}`), []byte(`{"type":`))
+	assert.ErrorContains(t, err, "decode schema")
+	var violationErr *SchemaViolationError
+	assert.False(t, errors.As(err, &violationErr))
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// RequestSigner signs outgoing requests, e.g. when the traffic goes through a gateway
+// which requires a signature header computed over the request.
+//
+// SignRequest is called for every attempt right before the request is sent, after the
+// body is finalized, so each retry is signed again. The header map may be modified,
+// body returns the exact bytes that will be sent.
+type RequestSigner interface {
+	SignRequest(method string, u *url.URL, header http.Header, body func() ([]byte, error)) error
+}
+
+// RequestSignerFunc is an adapter to allow the use of ordinary functions as RequestSigner.
+type RequestSignerFunc func(method string, u *url.URL, header http.Header, body func() ([]byte, error)) error
+
+// SignRequest calls f(method, u, header, body).
+func (f RequestSignerFunc) SignRequest(method string, u *url.URL, header http.Header, body func() ([]byte, error)) error {
+	return f(method, u, header, body)
+}
+
+// SetRequestSigner is used to set signer which is invoked before sending every request.
+func (e *Engine) SetRequestSigner(signer RequestSigner) {
+	e.signer = signer
+}
+
+// bodyBytes returns accessor to the body of req. The body is read at most once,
+// and is replaced with an in-memory copy, so it can still be sent afterwards.
+func bodyBytes(req *http.Request) func() ([]byte, error) {
+	var (
+		b    []byte
+		err  error
+		read bool
+	)
+	return func() ([]byte, error) {
+		if read {
+			return b, err
+		}
+		read = true
+		if req.Body == nil || req.Body == http.NoBody {
+			return nil, nil
+		}
+		b, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(b))
+		return b, err
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSigningKey = []byte("gateway-secret")
+
+func testSignature(method, path, timestamp string, body []byte) string {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, testSigningKey)
+	mac.Write([]byte(method + "\n" + path + "\n" + timestamp + "\n" + hex.EncodeToString(sum[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type testAttempt struct {
+	timestamp      string
+	idempotencyKey string
+	body           string
+}
+
+func TestRequestSignerRetries(t *testing.T) {
+	var attempts []testAttempt
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		ts := r.Header.Get("X-Gateway-Timestamp")
+		if r.Header.Get("X-Gateway-Signature") != testSignature(r.Method, r.URL.Path, ts, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		attempts = append(attempts, testAttempt{ts, r.Header.Get("Idempotency-Key"), string(body)})
+		if len(attempts) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer srv.Close()
+
+	var clock int64 = 1700000000
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	e.clock = newAutoClock()
+	e.SetMaxRetries(2)
+	e.SetRequestSigner(RequestSignerFunc(func(method string, u *url.URL, header http.Header, body func() ([]byte, error)) error {
+		b, err := body()
+		if err != nil {
+			return err
+		}
+		clock++
+		ts := strconv.FormatInt(clock, 10)
+		header.Set("X-Gateway-Timestamp", ts)
+		header.Set("X-Gateway-Signature", testSignature(method, u.Path, ts, b))
+		return nil
+	}))
+
+	r, err := e.ChatCompletion(context.Background(), &ChatCompletionOptions{
+		Model:    ModelGPT3Dot5Turbo,
+		Messages: []ChatMessage{{Role: "user", Content: "hello"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hi", r.Choices[0].Message.Content)
+
+	require.Len(t, attempts, 2)
+	assert.NotEqual(t, attempts[0].timestamp, attempts[1].timestamp, "each attempt must be signed again")
+	assert.NotEmpty(t, attempts[0].idempotencyKey)
+	assert.Equal(t, attempts[0].idempotencyKey, attempts[1].idempotencyKey)
+	assert.Equal(t, attempts[0].body, attempts[1].body)
+}
+
+func TestRequestSignerError(t *testing.T) {
+	var called bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	e.SetMaxRetries(2)
+	errSign := errors.New("no signing key")
+	e.SetRequestSigner(RequestSignerFunc(func(string, *url.URL, http.Header, func() ([]byte, error)) error {
+		return errSign
+	}))
+	_, err := e.ListModels(context.Background())
+	assert.ErrorIs(t, err, errSign)
+	assert.False(t, called, "unsigned request must not be sent")
+}
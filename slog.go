@@ -0,0 +1,71 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"log/slog"
+	"strconv"
+)
+
+// maxLogContentLength is the maximum number of characters of the message content in log values.
+const maxLogContentLength = 100
+
+// LogValue implements slog.LogValuer, so the response is logged as a group of its
+// meaningful fields. The content of messages is truncated to 100 characters.
+func (r *ChatCompletionResponse) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("id", r.Id),
+		slog.String("model", string(r.Model)),
+		slog.Int("prompt_tokens", r.Usage.PromptTokens),
+		slog.Int("completion_tokens", r.Usage.CompletionTokens),
+	}
+	choices := make([]slog.Attr, 0, len(r.Choices))
+	for _, c := range r.Choices {
+		choices = append(choices, slog.Group(strconv.Itoa(c.Index),
+			slog.String("finish_reason", c.FinishReason),
+			slog.Any("message", c.Message),
+		))
+	}
+	attrs = append(attrs, slog.Attr{Key: "choices", Value: slog.GroupValue(choices...)})
+	return slog.GroupValue(attrs...)
+}
+
+// LogValue implements slog.LogValuer, so the options are logged as a group of its
+// meaningful fields. The content of messages is truncated to 100 characters.
+func (o *ChatCompletionOptions) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("model", string(o.Model)),
+		slog.Float64("temperature", float64(o.Temperature)),
+		slog.Int("max_tokens", o.MaxTokens),
+	}
+	attrs = append(attrs, slog.Attr{Key: "messages", Value: messagesLogValue(o.Messages)})
+	return slog.GroupValue(attrs...)
+}
+
+// LogValue implements slog.LogValuer. The content is truncated to 100 characters.
+func (m ChatMessage) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("role", m.Role),
+		slog.String("content", truncateLogContent(m.Content)),
+	)
+}
+
+func messagesLogValue(messages []ChatMessage) slog.Value {
+	attrs := make([]slog.Attr, 0, len(messages))
+	for i, m := range messages {
+		attrs = append(attrs, slog.Any(strconv.Itoa(i), m))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func truncateLogContent(s string) string {
+	var n int
+	for i := range s {
+		if n == maxLogContentLength {
+			return s[:i] + "..."
+		}
+		n++
+	}
+	return s
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatCompletionLogValue(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	long := strings.Repeat("ж", 150)
+	opts := &ChatCompletionOptions{
+		Model:       ModelGPT4,
+		Temperature: 0.5,
+		Messages:    []ChatMessage{{Role: "user", Content: long}},
+	}
+	resp := &ChatCompletionResponse{
+		Id:      "chatcmpl-1",
+		Model:   "gpt-4-0613",
+		Choices: []ChatCompletionChoice{{Message: ChatMessage{Role: "assistant", Content: "hi"}, FinishReason: "stop"}},
+		Usage:   Usage{PromptTokens: 12, CompletionTokens: 7},
+	}
+
+	logger.Info("completion", slog.Any("options", opts), slog.Any("response", resp))
+
+	truncated := strings.Repeat("ж", 100) + "..."
+	assert.JSONEq(t, `{
+		"level": "INFO",
+		"msg": "completion",
+		"options": {
+			"model": "gpt-4",
+			"temperature": 0.5,
+			"max_tokens": 0,
+			"messages": {"0": {"role": "user", "content": "`+truncated+`"}}
+		},
+		"response": {
+			"id": "chatcmpl-1",
+			"model": "gpt-4-0613",
+			"prompt_tokens": 12,
+			"completion_tokens": 7,
+			"choices": {"0": {"finish_reason": "stop", "message": {"role": "assistant", "content": "hi"}}}
+		}
+	}`, buf.String())
+}
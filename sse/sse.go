@@ -0,0 +1,212 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+// Package sse implements the parser of server-sent events, as used by streaming endpoints of the API.
+//
+// Spec: https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+// DefaultMaxEventSize is the default limit of the size of a single event.
+const DefaultMaxEventSize = 8 << 20
+
+// ErrEventTooLarge is returned by Err if the event exceeds the size limit.
+var ErrEventTooLarge = errors.New("sse: event too large")
+
+var bom = []byte("\xEF\xBB\xBF")
+
+// Event is a dispatched server-sent event.
+type Event struct {
+	// The event type, "message" unless it's set by the event field.
+	Type string
+	// The data of the event, lines of multi-line data are joined with "\n".
+	Data []byte
+	// The last event ID set by the id field of this or any previous event.
+	ID string
+	// Offset of the first line of the event in the stream, in bytes.
+	Offset int64
+}
+
+// Scanner reads events from the stream. Successive calls to Scan step through the events,
+// the scanning stops at the end of the stream or on the first error.
+//
+// The incomplete event at the end of the stream, i.e. without the terminating blank line,
+// is discarded as the spec requires.
+type Scanner struct {
+	r       *bufio.Reader
+	maxSize int
+	started bool
+
+	line      []byte
+	data      []byte
+	hasData   bool
+	eventType string
+	lastID    string
+	retry     time.Duration
+
+	// n is the number of bytes consumed, start is the offset of the current event
+	n     int64
+	start int64
+
+	event Event
+	err   error
+}
+
+// NewScanner returns the scanner of events read from r.
+func NewScanner(r io.Reader) *Scanner {
+	return &Scanner{r: bufio.NewReader(r), maxSize: DefaultMaxEventSize}
+}
+
+// SetMaxEventSize sets the maximum size of the event in bytes, including its field names.
+// Scanning fails with ErrEventTooLarge when the limit is exceeded.
+func (s *Scanner) SetMaxEventSize(size int) {
+	s.maxSize = size
+}
+
+// Scan advances the scanner to the next event, which is then available through Event.
+// It returns false at the end of the stream or on error.
+func (s *Scanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+	if !s.started {
+		s.started = true
+		if b, err := s.r.Peek(len(bom)); err == nil && bytes.Equal(b, bom) {
+			s.r.Discard(len(bom))
+			s.n += int64(len(bom))
+		}
+		s.start = s.n
+	}
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			s.err = err
+			return false
+		}
+		if len(line) == 0 {
+			dispatched := s.dispatch()
+			s.start = s.n
+			if dispatched {
+				return true
+			}
+			continue
+		}
+		s.processField(line)
+	}
+}
+
+// Event returns the event read by the last call to Scan.
+func (s *Scanner) Event() Event {
+	return s.event
+}
+
+// Err returns the error that stopped scanning, or nil at the end of the stream.
+func (s *Scanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
+
+// Offset returns the number of bytes of the stream consumed by the scanner.
+func (s *Scanner) Offset() int64 {
+	return s.n
+}
+
+// Retry returns the reconnection time set by the last retry field, zero if it wasn't set.
+func (s *Scanner) Retry() time.Duration {
+	return s.retry
+}
+
+// readLine reads the line terminated by CRLF, LF or CR, without the terminator.
+// The line at the end of the stream without the terminator is returned with io.EOF,
+// which discards it along with the incomplete event.
+func (s *Scanner) readLine() ([]byte, error) {
+	s.line = s.line[:0]
+	for {
+		c, err := s.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		s.n++
+		switch c {
+		case '\n':
+			return s.line, nil
+		case '\r':
+			// CRLF is a single terminator, even if LF comes in the next read
+			if next, err := s.r.Peek(1); err == nil && next[0] == '\n' {
+				s.r.Discard(1)
+				s.n++
+			}
+			return s.line, nil
+		}
+		if len(s.data)+len(s.line) >= s.maxSize {
+			return nil, ErrEventTooLarge
+		}
+		s.line = append(s.line, c)
+	}
+}
+
+func (s *Scanner) processField(line []byte) {
+	if line[0] == ':' {
+		// Comment, e.g. keep-alive
+		return
+	}
+	name, value := line, []byte(nil)
+	if i := bytes.IndexByte(line, ':'); i >= 0 {
+		name, value = line[:i], line[i+1:]
+		value = bytes.TrimPrefix(value, []byte(" "))
+	}
+	switch string(name) {
+	case "data":
+		s.data = append(s.data, value...)
+		s.data = append(s.data, '\n')
+		s.hasData = true
+	case "event":
+		s.eventType = string(value)
+	case "id":
+		// IDs with NULL are ignored
+		if bytes.IndexByte(value, 0) < 0 {
+			s.lastID = string(value)
+		}
+	case "retry":
+		if ms, err := strconv.ParseUint(string(value), 10, 63); err == nil && isDigits(value) {
+			s.retry = time.Duration(ms) * time.Millisecond
+		}
+	}
+}
+
+// dispatch completes the event at the blank line. Events without data aren't dispatched.
+func (s *Scanner) dispatch() bool {
+	eventType := s.eventType
+	s.eventType = ""
+	if !s.hasData {
+		return false
+	}
+	if eventType == "" {
+		eventType = "message"
+	}
+	data := s.data[:len(s.data)-1] // trailing "\n"
+	s.event = Event{Type: eventType, Data: append([]byte{}, data...), ID: s.lastID, Offset: s.start}
+	s.data = s.data[:0]
+	s.hasData = false
+	return true
+}
+
+func isDigits(b []byte) bool {
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return len(b) > 0
+}
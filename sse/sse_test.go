@@ -0,0 +1,171 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package sse
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scanAll(t *testing.T, r io.Reader, maxSize int) ([]Event, error) {
+	t.Helper()
+	s := NewScanner(r)
+	if maxSize > 0 {
+		s.SetMaxEventSize(maxSize)
+	}
+	var events []Event
+	for s.Scan() {
+		event := s.Event()
+		event.Offset = 0 // checked by TestScannerOffset
+		events = append(events, event)
+	}
+	return events, s.Err()
+}
+
+func msg(data string) Event {
+	return Event{Type: "message", Data: []byte(data)}
+}
+
+// splitReader returns the input in two reads split at n.
+type splitReader struct {
+	parts []string
+}
+
+func (r *splitReader) Read(p []byte) (int, error) {
+	if len(r.parts) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.parts[0])
+	r.parts[0] = r.parts[0][n:]
+	if len(r.parts[0]) == 0 {
+		r.parts = r.parts[1:]
+	}
+	return n, nil
+}
+
+func TestScanner(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		input  string
+		events []Event
+	}{
+		{"single event", "data: hello\n\n", []Event{msg("hello")}},
+		{"multiple events", "data: a\n\ndata: b\n\n", []Event{msg("a"), msg("b")}},
+		{"multi-line data", "data: a\ndata: b\ndata: c\n\n", []Event{msg("a\nb\nc")}},
+		{"no space after colon", "data:a\n\n", []Event{msg("a")}},
+		{"only one space stripped", "data:  a \n\n", []Event{msg(" a ")}},
+		{"empty data", "data\n\ndata:\n\n", []Event{msg(""), msg("")}},
+		{"empty data lines", "data\ndata\n\n", []Event{msg("\n")}},
+		{"CRLF", "data: a\r\ndata: b\r\n\r\n", []Event{msg("a\nb")}},
+		{"CR", "data: a\rdata: b\r\r", []Event{msg("a\nb")}},
+		{"mixed line endings", "data: a\r\n\ndata: b\r\rdata: c\n\r\n", []Event{msg("a"), msg("b"), msg("c")}},
+		{"BOM", "\xEF\xBB\xBFdata: a\n\n", []Event{msg("a")}},
+		{"BOM only stripped at start", "data: a\n\n\xEF\xBB\xBFdata: b\n\n", []Event{msg("a")}},
+		{"comments", ": keep-alive\ndata: a\n: another\n\n:\n\n", []Event{msg("a")}},
+		{"event type", "event: delta\ndata: a\n\ndata: b\n\n", []Event{{Type: "delta", Data: []byte("a")}, msg("b")}},
+		{"event type without data is reset", "event: ping\n\ndata: a\n\n", []Event{msg("a")}},
+		{"id persists", "id: 1\ndata: a\n\ndata: b\n\nid\ndata: c\n\n", []Event{
+			{Type: "message", Data: []byte("a"), ID: "1"},
+			{Type: "message", Data: []byte("b"), ID: "1"},
+			{Type: "message", Data: []byte("c")},
+		}},
+		{"id with NULL ignored", "id: 1\nid: 2\x003\ndata: a\n\n", []Event{{Type: "message", Data: []byte("a"), ID: "1"}}},
+		{"unknown fields ignored", "foo: bar\ndata: a\nDATA: b\n\n", []Event{msg("a")}},
+		{"empty events", "\n\n\n\ndata: a\n\n\n\n", []Event{msg("a")}},
+		{"no events", "", nil},
+		{"missing final blank line", "data: a\n\ndata: b\n", []Event{msg("a")}},
+		{"missing final newline", "data: a\n\ndata: b", []Event{msg("a")}},
+		{"UTF-8", "data: Grüße 👋\n\n", []Event{msg("Grüße 👋")}},
+		{"DONE", "data: {\"a\":1}\n\ndata: [DONE]\n\n", []Event{msg(`{"a":1}`), msg("[DONE]")}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			events, err := scanAll(t, strings.NewReader(tc.input), 0)
+			require.NoError(t, err)
+			assert.Equal(t, tc.events, events)
+
+			// Events split across byte reads, e.g. in the middle of UTF-8 characters or CRLF
+			events, err = scanAll(t, iotest.OneByteReader(strings.NewReader(tc.input)), 0)
+			require.NoError(t, err)
+			assert.Equal(t, tc.events, events, "one byte reads")
+
+			for i := 1; i < len(tc.input); i++ {
+				events, err = scanAll(t, &splitReader{[]string{tc.input[:i], tc.input[i:]}}, 0)
+				require.NoError(t, err)
+				assert.Equal(t, tc.events, events, "split at %d", i)
+			}
+		})
+	}
+}
+
+func TestScannerOffset(t *testing.T) {
+	input := "\xEF\xBB\xBFdata: a\r\n\r\n: keep-alive\n\nid: 2\ndata: b\n\ndata: c\r\rdata: d"
+	for _, r := range []io.Reader{
+		strings.NewReader(input),
+		iotest.OneByteReader(strings.NewReader(input)),
+	} {
+		s := NewScanner(r)
+		var offsets []int64
+		for s.Scan() {
+			offsets = append(offsets, s.Event().Offset)
+		}
+		require.NoError(t, s.Err())
+		assert.Equal(t, []int64{3, 28, 43}, offsets)
+		assert.Equal(t, int64(len(input)), s.Offset())
+	}
+}
+
+func TestScannerRetry(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		retry time.Duration
+	}{
+		{"retry: 3000\n\n", 3 * time.Second},
+		{"retry: 3000\nretry: 1x\nretry: -1\nretry:\n\n", 3 * time.Second},
+		{"retry: 1.5\n\n", 0},
+	} {
+		s := NewScanner(strings.NewReader(tc.input))
+		for s.Scan() {
+		}
+		require.NoError(t, s.Err())
+		assert.Equal(t, tc.retry, s.Retry(), tc.input)
+	}
+}
+
+func TestScannerMaxEventSize(t *testing.T) {
+	events, err := scanAll(t, strings.NewReader("data: small\n\ndata: "+strings.Repeat("x", 100)+"\n\n"), 32)
+	assert.ErrorIs(t, err, ErrEventTooLarge)
+	assert.Equal(t, []Event{msg("small")}, events)
+
+	// The limit applies to the whole event, not to single lines
+	events, err = scanAll(t, strings.NewReader(strings.Repeat("data: xxxxxxxx\n", 10)+"\n"), 32)
+	assert.ErrorIs(t, err, ErrEventTooLarge)
+	assert.Empty(t, events)
+
+	// Stream without line breaks doesn't grow the buffer past the limit
+	_, err = scanAll(t, io.LimitReader(infiniteReader{}, 1<<20), 1024)
+	assert.ErrorIs(t, err, ErrEventTooLarge)
+}
+
+func TestScannerReadError(t *testing.T) {
+	errRead := errors.New("connection reset")
+	events, err := scanAll(t, io.MultiReader(strings.NewReader("data: a\n\ndata: b"), iotest.ErrReader(errRead)), 0)
+	assert.ErrorIs(t, err, errRead)
+	assert.Equal(t, []Event{msg("a")}, events)
+}
+
+type infiniteReader struct{}
+
+func (infiniteReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'x'
+	}
+	return len(p), nil
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/0x9ef/openai-go/sse"
+)
+
+// streamDone is the data of the event which terminates the stream.
+var streamDone = []byte("[DONE]")
+
+// maxFrameSnippet is the maximum length of the frame snippet of StreamProtocolError.
+const maxFrameSnippet = 64
+
+// StreamAPIError is returned by streams when the server reports the error in the middle
+// of the stream, e.g. when the rate limit is hit during the generation. It unwraps
+// to the decoded APIError, so it matches ErrRateLimit for rate limit errors.
+type StreamAPIError struct {
+	APIError APIError
+}
+
+func (e *StreamAPIError) Error() string {
+	return "openai: stream error: " + e.APIError.Error()
+}
+
+func (e *StreamAPIError) Unwrap() error {
+	return e.APIError
+}
+
+// StreamProtocolError is returned by streams when the frame can't be decoded,
+// e.g. its data isn't valid JSON.
+type StreamProtocolError struct {
+	// Offset of the frame in the stream, in bytes.
+	Offset int64
+	// Snippet of the frame data, at most 64 bytes.
+	Snippet string
+	// Err is the decoding error.
+	Err error
+}
+
+func (e *StreamProtocolError) Error() string {
+	return fmt.Sprintf("openai: invalid stream frame at offset %d: %v: %q", e.Offset, e.Err, e.Snippet)
+}
+
+func (e *StreamProtocolError) Unwrap() error {
+	return e.Err
+}
+
+// StreamClosedUnexpectedly is returned by streams when the stream ended before it was finished,
+// e.g. the connection was dropped, or the server ended the stream without the [DONE] event.
+// It matches ErrStreamClosed.
+type StreamClosedUnexpectedly struct {
+	// Chunks is the number of chunks received before the stream ended.
+	Chunks int
+	// Bytes is the number of bytes received before the stream ended.
+	Bytes int64
+	// Err is the read error, or io.ErrUnexpectedEOF if the stream ended without [DONE].
+	Err error
+}
+
+func (e *StreamClosedUnexpectedly) Error() string {
+	return fmt.Sprintf("%v after %d chunks (%d bytes): %v", ErrStreamClosed, e.Chunks, e.Bytes, e.Err)
+}
+
+func (e *StreamClosedUnexpectedly) Unwrap() []error {
+	return []error{ErrStreamClosed, e.Err}
+}
+
+// sseReader reads data of server-sent events from the streaming endpoints.
+type sseReader struct {
+	scanner *sse.Scanner
+	done    bool
+	chunks  int
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	return &sseReader{scanner: sse.NewScanner(r)}
+}
+
+// next returns data of the next event. Data of multi-line events are joined with "\n".
+// It returns io.EOF after the [DONE] event, StreamAPIError if the event is an error,
+// or StreamClosedUnexpectedly if the stream ended without [DONE].
+func (s *sseReader) next() ([]byte, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+	if !s.scanner.Scan() {
+		err := s.scanner.Err()
+		if errors.Is(err, sse.ErrEventTooLarge) {
+			return nil, &StreamProtocolError{Offset: s.scanner.Offset(), Err: err}
+		}
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, &StreamClosedUnexpectedly{Chunks: s.chunks, Bytes: s.scanner.Offset(), Err: err}
+	}
+	event := s.scanner.Event()
+	if bytes.Equal(event.Data, streamDone) {
+		s.done = true
+		return nil, io.EOF
+	}
+	if err := eventError(event); err != nil {
+		return nil, err
+	}
+	s.chunks++
+	return event.Data, nil
+}
+
+// decode reads the next event and unmarshals its data into v.
+func (s *sseReader) decode(v interface{}) error {
+	data, err := s.next()
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return frameError(s.scanner.Event(), err)
+	}
+	return nil
+}
+
+// eventError returns StreamAPIError if the event reports the error, either with the error
+// event type, or with the error object in place of the chunk.
+func eventError(event sse.Event) error {
+	if event.Type != "error" && !bytes.Contains(event.Data, []byte(`"error"`)) {
+		return nil
+	}
+	var apiErr APIError
+	if err := json.Unmarshal(event.Data, &apiErr); err != nil {
+		if event.Type == "error" {
+			return frameError(event, err)
+		}
+		return nil
+	}
+	if apiErr.Err.Message == "" && apiErr.Err.Type == "" && apiErr.Err.Code == "" {
+		if event.Type != "error" {
+			return nil
+		}
+		// The error event without the envelope
+		if err := json.Unmarshal(event.Data, &apiErr.Err); err != nil {
+			return frameError(event, err)
+		}
+	}
+	return &StreamAPIError{APIError: apiErr}
+}
+
+func frameError(event sse.Event, err error) error {
+	snippet := event.Data
+	if len(snippet) > maxFrameSnippet {
+		snippet = snippet[:maxFrameSnippet]
+	}
+	return &StreamProtocolError{Offset: event.Offset, Snippet: string(snippet), Err: err}
+}
+
+// streamError classifies err returned by the reader of the stream requested with ctx.
+// io.EOF is returned as is. If ctx is done, the error wraps ErrStreamCanceled.
+// The errors of the stream taxonomy, i.e. StreamAPIError, StreamProtocolError and
+// StreamClosedUnexpectedly, are returned as is, other errors wrap ErrStreamClosed.
+func streamError(ctx context.Context, err error) error {
+	var (
+		apiErr      *StreamAPIError
+		protocolErr *StreamProtocolError
+		closedErr   *StreamClosedUnexpectedly
+	)
+	switch {
+	case err == io.EOF:
+		return err
+	case ctx.Err() != nil:
+		return fmt.Errorf("%w: %w", ErrStreamCanceled, doneReason(ctx))
+	case errors.As(err, &apiErr), errors.As(err, &protocolErr), errors.As(err, &closedErr):
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrStreamClosed, err)
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testChunk = `data: {"id":"cmpl-1","choices":[{"text":"a"}]}` + "\n\n"
+
+// readChunks reads the stream until the error, returning the number of chunks read.
+func readChunks(r io.Reader) (int, error) {
+	reader := newSSEReader(r)
+	var n int
+	for {
+		var chunk CompletionStreamResponse
+		if err := reader.decode(&chunk); err != nil {
+			return n, streamError(context.Background(), err)
+		}
+		n++
+	}
+}
+
+func TestStreamDone(t *testing.T) {
+	n, err := readChunks(strings.NewReader(testChunk + testChunk + "data: [DONE]\n\n"))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestStreamAPIError(t *testing.T) {
+	for _, frame := range []string{
+		"event: error\ndata: {\"error\":{\"message\":\"Rate limit reached\",\"type\":\"tokens\",\"code\":\"rate_limit_exceeded\"}}\n\n",
+		"data: {\"error\":{\"message\":\"Rate limit reached\",\"type\":\"tokens\",\"code\":\"rate_limit_exceeded\"}}\n\n",
+		"event: error\ndata: {\"message\":\"Rate limit reached\",\"type\":\"tokens\",\"code\":\"rate_limit_exceeded\"}\n\n",
+	} {
+		n, err := readChunks(strings.NewReader(testChunk + frame + testChunk))
+		assert.Equal(t, 1, n)
+		var streamErr *StreamAPIError
+		require.ErrorAs(t, err, &streamErr, frame)
+		assert.Equal(t, "Rate limit reached", streamErr.APIError.Err.Message)
+		assert.ErrorIs(t, err, ErrRateLimit)
+		var apiErr APIError
+		assert.ErrorAs(t, err, &apiErr)
+		assert.NotErrorIs(t, err, ErrStreamClosed)
+	}
+
+	// The chunk mentioning the error in its content isn't an error
+	n, err := readChunks(strings.NewReader(`data: {"choices":[{"text":"\"error\""}]}` + "\n\ndata: [DONE]\n\n"))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestStreamProtocolError(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	n, err := readChunks(strings.NewReader(testChunk + ": keep-alive\n\ndata: {\"id\":" + long + "\n\n" + testChunk))
+	assert.Equal(t, 1, n)
+	var protocolErr *StreamProtocolError
+	require.ErrorAs(t, err, &protocolErr)
+	assert.Equal(t, int64(len(testChunk)+len(": keep-alive\n\n")), protocolErr.Offset)
+	assert.Equal(t, (`{"id":` + long)[:maxFrameSnippet], protocolErr.Snippet)
+	assert.NotErrorIs(t, err, ErrStreamClosed)
+
+	_, err = readChunks(strings.NewReader("event: error\ndata: not json\n\n"))
+	assert.ErrorAs(t, err, &protocolErr, "the malformed error event")
+}
+
+func TestStreamClosedUnexpectedly(t *testing.T) {
+	input := testChunk + testChunk
+	n, err := readChunks(strings.NewReader(input))
+	assert.Equal(t, 2, n)
+	var closedErr *StreamClosedUnexpectedly
+	require.ErrorAs(t, err, &closedErr)
+	assert.Equal(t, &StreamClosedUnexpectedly{Chunks: 2, Bytes: int64(len(input)), Err: io.ErrUnexpectedEOF}, closedErr)
+	assert.ErrorIs(t, err, ErrStreamClosed)
+
+	// The connection is dropped in the middle of the chunk
+	errReset := errors.New("connection reset by peer")
+	_, err = readChunks(io.MultiReader(strings.NewReader(testChunk+testChunk[:10]), iotest.ErrReader(errReset)))
+	require.ErrorAs(t, err, &closedErr)
+	assert.Equal(t, 1, closedErr.Chunks)
+	assert.Equal(t, int64(len(testChunk)+10), closedErr.Bytes)
+	assert.ErrorIs(t, err, errReset)
+	assert.ErrorIs(t, err, ErrStreamClosed)
+	assert.Equal(t, "openai: stream closed before completion after 1 chunks (58 bytes): connection reset by peer", err.Error())
+}
+
+func TestCompletionStreamCollectAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, testChunk)
+		fmt.Fprint(w, "event: error\ndata: {\"error\":{\"message\":\"The server had an error\",\"type\":\"server_error\"}}\n\n")
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	s, err := e.CompletionStream(context.Background(), &CompletionOptions{Model: "gpt-3.5-turbo-instruct", Prompt: []string{"a"}})
+	require.NoError(t, err)
+	_, err = s.Collect()
+	var streamErr *StreamAPIError
+	require.ErrorAs(t, err, &streamErr)
+	assert.Equal(t, "server_error", streamErr.APIError.Err.Type)
+}
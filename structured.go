@@ -0,0 +1,219 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Types of the response format of the chat completion.
+const (
+	ResponseFormatText       = "text"
+	ResponseFormatJSONObject = "json_object"
+	ResponseFormatJSONSchema = "json_schema"
+)
+
+var (
+	// ErrModelRefusal is returned if the model refused to reply in the requested format.
+	ErrModelRefusal = errors.New("openai: model refused to reply")
+	// ErrModelUnsupported is returned if the model doesn't support the requested feature.
+	ErrModelUnsupported = errors.New("openai: model doesn't support the feature")
+)
+
+// maxJSONCorrections is the number of corrective requests ChatCompletionJSON sends after the first one.
+const maxJSONCorrections = 2
+
+// ChatResponseFormat is the format of the output of the chat completion.
+//
+// Learn more: https://platform.openai.com/docs/guides/structured-outputs
+type ChatResponseFormat struct {
+	// Type of the format, ResponseFormatText, ResponseFormatJSONObject or ResponseFormatJSONSchema.
+	Type string `json:"type"`
+	// The schema of ResponseFormatJSONSchema.
+	JSONSchema *JSONSchemaFormat `json:"json_schema,omitempty"`
+}
+
+// JSONSchemaFormat is the JSON schema the output of the chat completion conforms to.
+type JSONSchemaFormat struct {
+	// The name of the format, up to 64 letters, digits, underscores and dashes.
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// The schema of the output, see JSONSchemaOf.
+	Schema json.RawMessage `json:"schema,omitempty"`
+	// Whether to enable strict schema adherence, only a subset of JSON Schema is supported.
+	Strict bool `json:"strict,omitempty"`
+}
+
+// validateResponseSchema validates the content of the first choice against the schema of the response format.
+func validateResponseSchema(opts *ChatCompletionOptions, resp *ChatCompletionResponse) error {
+	format := opts.ResponseFormat
+	if format == nil || format.Type != ResponseFormatJSONSchema || format.JSONSchema == nil || len(format.JSONSchema.Schema) == 0 {
+		return nil
+	}
+	if len(resp.Choices) == 0 {
+		return errors.New("validate response schema: no choices")
+	}
+	content := []byte(resp.Choices[0].Message.Content)
+	if !json.Valid(content) {
+		return &SchemaViolationError{Violations: []SchemaViolation{{Path: "$", Message: "must be valid JSON"}}}
+	}
+	return ValidateAgainstSchema(content, format.JSONSchema.Schema)
+}
+
+// WithJSONRepair is used to repair the nearly valid JSON content of ChatCompletionJSON and
+// ChatCompletionTyped with RepairJSON, e.g. cut off at max_tokens, before it's validated and decoded.
+// The content of the response is replaced with the repaired JSON.
+func WithJSONRepair() EngineOption {
+	return func(e *Engine) {
+		e.jsonRepair = true
+	}
+}
+
+// ChatCompletionJSON is used to request the chat completion in JSON and decode the content of
+// the first choice into v. If the model refuses to reply, the error matching ErrModelRefusal
+// is returned along with the response. If the content isn't valid JSON, can't be decoded into v, or violates
+// the schema with opts.ValidateResponseSchema set, the model is asked to correct it: the reply
+// and the error are appended to the messages, and the request is sent again, up to 2 times.
+// The error of the last reply is returned along with its response if it's still not valid.
+// With WithJSONRepair the invalid JSON is repaired before the model is asked.
+//
+// opts.ResponseFormat is JSON object if it isn't set. opts isn't modified.
+func (e *Engine) ChatCompletionJSON(ctx context.Context, opts *ChatCompletionOptions, v interface{}) (*ChatCompletionResponse, error) {
+	return e.chatCompletionJSON(ctx, opts, v, e.jsonRepair)
+}
+
+func (e *Engine) chatCompletionJSON(ctx context.Context, opts *ChatCompletionOptions, v interface{}, repair bool) (*ChatCompletionResponse, error) {
+	req := *opts
+	req.Messages = append([]ChatMessage(nil), opts.Messages...)
+	if req.ResponseFormat == nil {
+		req.ResponseFormat = &ChatResponseFormat{Type: ResponseFormatJSONObject}
+	}
+	// The content is validated once it's repaired
+	req.ValidateResponseSchema = false
+	for correction := 0; ; correction++ {
+		resp, err := e.ChatCompletion(ctx, &req)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Choices) == 0 {
+			return resp, errors.New("chat completion JSON: no choices")
+		}
+		if refusal := resp.Choices[0].Message.Refusal; refusal != "" {
+			return resp, fmt.Errorf("%w: %s", ErrModelRefusal, refusal)
+		}
+		if repair {
+			repairContent(&resp.Choices[0].Message)
+		}
+		if opts.ValidateResponseSchema {
+			err = validateResponseSchema(&req, resp)
+		}
+		if err == nil {
+			if err = json.Unmarshal([]byte(resp.Choices[0].Message.Content), v); err == nil {
+				return resp, nil
+			}
+			err = fmt.Errorf("decode JSON content: %w", err)
+		}
+		if correction == maxJSONCorrections {
+			return resp, err
+		}
+		req.Messages = append(req.Messages, resp.Choices[0].Message, ChatMessage{
+			Role:    "user",
+			Content: fmt.Sprintf("The reply isn't valid: %v. Reply with the corrected JSON only.", err),
+		})
+	}
+}
+
+// repairContent replaces the content of msg with the repaired JSON if it isn't valid.
+// The irrepairable content is kept, so its error is reported to the model.
+func repairContent(msg *ChatMessage) {
+	if json.Valid([]byte(msg.Content)) {
+		return
+	}
+	if repaired, err := RepairJSON(msg.Content); err == nil {
+		msg.Content = repaired
+	}
+}
+
+// ChatCompletionTyped is used to request the chat completion in JSON and decode the content of
+// the first choice into T, see ChatCompletionJSON. If opts.ResponseFormat isn't set, the schema
+// of T generated by JSONSchemaOf is requested, so T should be a struct.
+func ChatCompletionTyped[T any](ctx context.Context, e *Engine, opts *ChatCompletionOptions) (T, *ChatCompletionResponse, error) {
+	var v T
+	req := *opts
+	if req.ResponseFormat == nil {
+		format, err := schemaResponseFormat[T]()
+		if err != nil {
+			return v, nil, err
+		}
+		req.ResponseFormat = format
+	}
+	resp, err := e.ChatCompletionJSON(ctx, &req, &v)
+	return v, resp, err
+}
+
+// ChatCompletionWithSchema is used to request the chat completion in the JSON schema of T generated
+// by JSONSchemaOf, and decode the content of the first choice into T. The content is repaired
+// with RepairJSON if it's needed, validated against the schema, decoded, and then validated by
+// the validator of the engine, see WithValidator, if T is a struct. The model is asked to correct
+// the content which isn't valid JSON or violates the schema, see ChatCompletionJSON.
+//
+// It returns the error matching ErrModelRefusal if the model refused to reply, and the error
+// matching ErrModelUnsupported if the model doesn't support the JSON schema response format.
+// opts.ResponseFormat is replaced with the schema of T. opts isn't modified.
+func ChatCompletionWithSchema[T any](ctx context.Context, engine *Engine, opts *ChatCompletionOptions) (*T, *ChatCompletionResponse, error) {
+	if model := engine.chatModel(opts.Model); !supportsJSONSchema(model) {
+		return nil, nil, fmt.Errorf("%w: %q doesn't support the JSON schema response format", ErrModelUnsupported, model)
+	}
+	format, err := schemaResponseFormat[T]()
+	if err != nil {
+		return nil, nil, err
+	}
+	req := *opts
+	req.ResponseFormat = format
+	req.ValidateResponseSchema = true
+	v := new(T)
+	resp, err := engine.chatCompletionJSON(ctx, &req, v, true)
+	if err != nil {
+		return nil, resp, err
+	}
+	rv := reflect.ValueOf(v).Elem()
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Struct {
+		if err := engine.validate.ValidateCtx(ctx, rv.Addr().Interface()); err != nil {
+			return nil, resp, err
+		}
+	}
+	return v, resp, nil
+}
+
+// schemaResponseFormat returns the JSON schema response format of T, named after T.
+func schemaResponseFormat[T any]() (*ChatResponseFormat, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	schema, err := JSONSchemaOf(t)
+	if err != nil {
+		return nil, fmt.Errorf("schema of %s: %w", t, err)
+	}
+	name := indirect(t).Name()
+	if !functionNamePattern.MatchString(name) {
+		name = "response"
+	}
+	return &ChatResponseFormat{
+		Type:       ResponseFormatJSONSchema,
+		JSONSchema: &JSONSchemaFormat{Name: name, Schema: schema},
+	}, nil
+}
+
+// supportsJSONSchema reports whether the model, or the base model of the fine-tuned one,
+// supports the JSON schema response format.
+//
+// Learn more: https://platform.openai.com/docs/guides/structured-outputs#supported-models
+func supportsJSONSchema(model Model) bool {
+	return capabilitiesOf(model).jsonSchema
+}
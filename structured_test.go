@@ -0,0 +1,227 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const weatherSchema = `{"type":"object","properties":{"city":{"type":"string"},"unit":{"enum":["celsius","fahrenheit"]}},"required":["city","unit"],"additionalProperties":false}`
+
+func assistantJSON(t *testing.T, content string) string {
+	b, err := json.Marshal(ChatMessage{Role: "assistant", Content: content})
+	require.NoError(t, err)
+	return string(b)
+}
+
+func weatherFormatOptions() *ChatCompletionOptions {
+	opts := testChatOptions()
+	opts.ResponseFormat = &ChatResponseFormat{
+		Type:       ResponseFormatJSONSchema,
+		JSONSchema: &JSONSchemaFormat{Name: "weather", Schema: json.RawMessage(weatherSchema)},
+	}
+	opts.ValidateResponseSchema = true
+	return opts
+}
+
+func TestChatCompletionValidateResponseSchema(t *testing.T) {
+	var requests []*ChatCompletionOptions
+	e := newAgentServer(t, &requests, assistantJSON(t, `{"city":"Berlin","unit":"kelvin"}`))
+
+	resp, err := e.ChatCompletion(context.Background(), weatherFormatOptions())
+	var violationErr *SchemaViolationError
+	require.True(t, errors.As(err, &violationErr), "unexpected error: %v", err)
+	assert.Equal(t, []SchemaViolation{{Path: "$.unit", Message: `must be one of ["celsius","fahrenheit"], got "kelvin"`}}, violationErr.Violations)
+	require.NotNil(t, resp)
+	format, err := json.Marshal(requests[0].ResponseFormat)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"json_schema","json_schema":{"name":"weather","schema":`+weatherSchema+`}}`, string(format))
+
+	opts := weatherFormatOptions()
+	opts.ValidateResponseSchema = false
+	_, err = e.ChatCompletion(context.Background(), opts)
+	assert.NoError(t, err, "the validation is opt-in")
+}
+
+func TestChatCompletionJSONCorrections(t *testing.T) {
+	var requests []*ChatCompletionOptions
+	e := newAgentServer(t, &requests,
+		assistantJSON(t, `{"city":"Berlin"`),
+		assistantJSON(t, `{"city":"Berlin","unit":"kelvin"}`),
+		assistantJSON(t, `{"city":"Berlin","unit":"celsius"}`),
+	)
+	var weather struct {
+		City string `json:"city"`
+		Unit string `json:"unit"`
+	}
+	opts := weatherFormatOptions()
+	_, err := e.ChatCompletionJSON(context.Background(), opts, &weather)
+	require.NoError(t, err)
+	assert.Equal(t, "celsius", weather.Unit)
+	assert.Len(t, opts.Messages, 1)
+
+	require.Len(t, requests, 3)
+	require.Len(t, requests[2].Messages, 5)
+	assert.Equal(t, `{"city":"Berlin"`, requests[1].Messages[1].Content)
+	assert.Contains(t, requests[1].Messages[2].Content, "$: must be valid JSON")
+	assert.Contains(t, requests[2].Messages[4].Content, `$.unit: must be one of ["celsius","fahrenheit"], got "kelvin"`)
+}
+
+func TestChatCompletionJSONGivesUp(t *testing.T) {
+	var requests []*ChatCompletionOptions
+	e := newAgentServer(t, &requests, assistantJSON(t, `{"city":"Berlin"}`))
+	var weather map[string]string
+	resp, err := e.ChatCompletionJSON(context.Background(), weatherFormatOptions(), &weather)
+	var violationErr *SchemaViolationError
+	assert.True(t, errors.As(err, &violationErr))
+	assert.NotNil(t, resp)
+	assert.Len(t, requests, 1+maxJSONCorrections)
+
+	requests = nil
+	e = newAgentServer(t, &requests, assistantJSON(t, `{"a":1}`))
+	var v map[string]interface{}
+	_, err = e.ChatCompletionJSON(context.Background(), testChatOptions(), &v)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"a": 1.0}, v)
+
+	// Without the schema validation the content is only decoded
+	requests = nil
+	e = newAgentServer(t, &requests, assistantJSON(t, `{"a":`), assistantJSON(t, `{"a":2}`))
+	_, err = e.ChatCompletionJSON(context.Background(), testChatOptions(), &v)
+	require.NoError(t, err)
+	assert.Contains(t, requests[1].Messages[2].Content, "decode JSON content")
+	assert.Equal(t, ResponseFormatJSONObject, requests[0].ResponseFormat.Type)
+}
+
+func TestChatCompletionJSONRepair(t *testing.T) {
+	var requests []*ChatCompletionOptions
+	e := newAgentServer(t, &requests, assistantJSON(t, "```json\n{\"city\":\"Berlin\",\"unit\":\"celsius\",\n"))
+	WithJSONRepair()(e)
+	var weather struct {
+		City string `json:"city"`
+		Unit string `json:"unit"`
+	}
+	resp, err := e.ChatCompletionJSON(context.Background(), weatherFormatOptions(), &weather)
+	require.NoError(t, err)
+	assert.Equal(t, "celsius", weather.Unit)
+	assert.Equal(t, `{"city":"Berlin","unit":"celsius"}`, resp.Choices[0].Message.Content)
+	assert.Len(t, requests, 1, "the repaired content isn't corrected")
+}
+
+type typedWeather struct {
+	City string `json:"city"`
+	Unit string `json:"unit" enum:"celsius,fahrenheit"`
+}
+
+func TestChatCompletionTyped(t *testing.T) {
+	var requests []*ChatCompletionOptions
+	e := newAgentServer(t, &requests,
+		assistantJSON(t, `{"city":"Berlin","unit":"celsius"`),
+		assistantJSON(t, `{"city":"Berlin","unit":"celsius"}`),
+	)
+	weather, _, err := ChatCompletionTyped[typedWeather](context.Background(), e, testChatOptions())
+	require.NoError(t, err)
+	assert.Equal(t, typedWeather{City: "Berlin", Unit: "celsius"}, weather)
+	require.Len(t, requests, 2, "without the repair the model is asked to correct the content")
+	assert.Equal(t, ResponseFormatJSONSchema, requests[0].ResponseFormat.Type)
+	assert.Equal(t, "typedWeather", requests[0].ResponseFormat.JSONSchema.Name)
+	schema, err := JSONSchemaOf(reflect.TypeOf(typedWeather{}))
+	require.NoError(t, err)
+	assert.JSONEq(t, string(schema), string(requests[0].ResponseFormat.JSONSchema.Schema))
+
+	requests = nil
+	WithJSONRepair()(e)
+	weather, _, err = ChatCompletionTyped[typedWeather](context.Background(), e, testChatOptions())
+	require.NoError(t, err)
+	assert.Equal(t, "Berlin", weather.City)
+	assert.Len(t, requests, 1)
+
+	requests = nil
+	_, _, err = ChatCompletionTyped[map[string]string](context.Background(), e, testChatOptions())
+	require.NoError(t, err)
+	assert.Equal(t, "response", requests[0].ResponseFormat.JSONSchema.Name)
+}
+
+type schemaWeather struct {
+	City string `json:"city" binding:"min=3"`
+	Unit string `json:"unit" enum:"celsius,fahrenheit"`
+}
+
+func TestChatCompletionWithSchema(t *testing.T) {
+	var requests []*ChatCompletionOptions
+	e := newAgentServer(t, &requests, assistantJSON(t, `Sure: {"city":"Berlin","unit":"celsius"`))
+	opts := testChatOptions()
+	opts.Model = "gpt-4o-mini"
+	weather, resp, err := ChatCompletionWithSchema[schemaWeather](context.Background(), e, opts)
+	require.NoError(t, err)
+	assert.Equal(t, &schemaWeather{City: "Berlin", Unit: "celsius"}, weather)
+	assert.Equal(t, `{"city":"Berlin","unit":"celsius"}`, resp.Choices[0].Message.Content, "the content is repaired")
+	require.Len(t, requests, 1)
+	assert.Equal(t, ResponseFormatJSONSchema, requests[0].ResponseFormat.Type)
+	assert.Equal(t, "schemaWeather", requests[0].ResponseFormat.JSONSchema.Name)
+	assert.Nil(t, opts.ResponseFormat, "the options must not be modified")
+
+	requests = nil
+	e = newAgentServer(t, &requests, assistantJSON(t, `{"city":"Berlin","unit":"kelvin"}`), assistantJSON(t, `{"city":"NY","unit":"celsius"}`))
+	_, _, err = ChatCompletionWithSchema[schemaWeather](context.Background(), e, opts)
+	assert.ErrorContains(t, err, "'City' failed on the 'min' tag", "the result is validated by the validator of the engine")
+	assert.Len(t, requests, 2, "the schema violation is corrected")
+}
+
+func TestChatCompletionWithSchemaRefusal(t *testing.T) {
+	var requests []*ChatCompletionOptions
+	e := newAgentServer(t, &requests, `{"role":"assistant","content":null,"refusal":"I can't help with that."}`)
+	opts := testChatOptions()
+	opts.Model = "gpt-4o-2024-08-06"
+	weather, resp, err := ChatCompletionWithSchema[schemaWeather](context.Background(), e, opts)
+	assert.True(t, errors.Is(err, ErrModelRefusal), "unexpected error: %v", err)
+	assert.ErrorContains(t, err, "I can't help with that.")
+	assert.Nil(t, weather)
+	require.NotNil(t, resp)
+	assert.Equal(t, "I can't help with that.", resp.Choices[0].Message.Refusal)
+	assert.Len(t, requests, 1, "the refusal isn't corrected")
+
+	b, err := json.Marshal(resp.Choices[0].Message)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"role":"assistant","content":"","refusal":"I can't help with that."}`, string(b))
+}
+
+func TestChatCompletionWithSchemaUnsupportedModel(t *testing.T) {
+	var requests []*ChatCompletionOptions
+	e := newAgentServer(t, &requests, assistantJSON(t, `{"city":"Berlin","unit":"celsius"}`))
+	for model, supported := range map[Model]bool{
+		ModelGPT3Dot5Turbo:                   false,
+		"gpt-4o-2024-05-13":                  false,
+		"o1-mini":                            false,
+		"gpt-4o":                             true,
+		"gpt-4.1-nano":                       true,
+		"o3-mini":                            true,
+		"ft:gpt-4o-mini-2024-07-18:acme::1a": true,
+	} {
+		opts := testChatOptions()
+		opts.Model = model
+		_, _, err := ChatCompletionWithSchema[schemaWeather](context.Background(), e, opts)
+		if supported {
+			assert.NoError(t, err, model)
+			continue
+		}
+		assert.True(t, errors.Is(err, ErrModelUnsupported), "%s: unexpected error: %v", model, err)
+	}
+	assert.Len(t, requests, 4, "the request isn't sent to the unsupported model")
+
+	WithDefaultModel("gpt-4o-mini")(e)
+	opts := testChatOptions()
+	opts.Model = ""
+	_, _, err := ChatCompletionWithSchema[schemaWeather](context.Background(), e, opts)
+	assert.NoError(t, err, "the default model of the engine is checked")
+	require.Len(t, requests, 5)
+	assert.Equal(t, Model("gpt-4o-mini"), requests[4].Model)
+}
@@ -0,0 +1,20 @@
+// Package weather is the source of the doc comments parsed by TestFunctionRegistryRegisterFromStruct.
+package weather
+
+import "context"
+
+type Params struct {
+	City string `json:"city"`
+}
+
+type Handler struct{}
+
+// GetWeather returns the current weather in the city.
+func (h *Handler) GetWeather(ctx context.Context, params Params) (string, error) {
+	return "sunny", nil
+}
+
+// GetUVIndex returns the UV index in the city.
+func (h *Handler) GetUVIndex(ctx context.Context, params *Params) (string, error) {
+	return "3", nil
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+)
+
+// Types of the annotations of thread message text.
+const (
+	AnnotationFileCitation = "file_citation"
+	AnnotationFilePath     = "file_path"
+)
+
+// ThreadMessage is a message of the Assistants API thread, e.g. retrieved with Do
+// from "/threads/{thread_id}/messages".
+//
+// Docs: https://platform.openai.com/docs/api-reference/messages/object
+type ThreadMessage struct {
+	Id          string                 `json:"id"`
+	Object      string                 `json:"object"`
+	CreatedAt   int64                  `json:"created_at"`
+	ThreadId    string                 `json:"thread_id"`
+	Role        string                 `json:"role"`
+	Content     []ThreadMessageContent `json:"content"`
+	AssistantId string                 `json:"assistant_id,omitempty"`
+	RunId       string                 `json:"run_id,omitempty"`
+}
+
+type ThreadMessageContent struct {
+	// Type of the content, e.g. "text" or "image_file".
+	Type string `json:"type"`
+	// Text of the content, set for the "text" type.
+	Text *ThreadMessageText `json:"text,omitempty"`
+	// The image file of the content, set for the "image_file" type.
+	ImageFile *ThreadMessageImageFile `json:"image_file,omitempty"`
+}
+
+type ThreadMessageImageFile struct {
+	FileId string `json:"file_id"`
+	// The detail of the image, "auto", "low" or "high".
+	Detail string `json:"detail,omitempty"`
+}
+
+type ThreadMessageText struct {
+	Value       string       `json:"value"`
+	Annotations []Annotation `json:"annotations,omitempty"`
+}
+
+// Annotation references a file or the web page from the part of the message text between
+// StartIndex and EndIndex, the variant of the type is set.
+type Annotation struct {
+	// Type of the annotation, AnnotationFileCitation, AnnotationFilePath or AnnotationURLCitation.
+	Type string `json:"type"`
+	// The text in the message content that needs to be replaced.
+	Text         string        `json:"text"`
+	StartIndex   int           `json:"start_index"`
+	EndIndex     int           `json:"end_index"`
+	FileCitation *FileCitation `json:"file_citation,omitempty"`
+	FilePath     *FilePath     `json:"file_path,omitempty"`
+	// The cited web page, its offsets are the ones of the annotation.
+	URLCitation *URLCitation `json:"url_citation,omitempty"`
+}
+
+// FileCitation points to a specific quote from a file used by the file_search tool.
+type FileCitation struct {
+	FileId string `json:"file_id"`
+	Quote  string `json:"quote,omitempty"`
+}
+
+// FilePath points to a file generated by the code_interpreter tool.
+type FilePath struct {
+	FileId string `json:"file_id"`
+}
+
+// Annotations returns the annotations of all text contents of the message, in order. Their offsets
+// are the ones within the text of their content.
+func (m *ThreadMessage) Annotations() []Annotation {
+	var annotations []Annotation
+	for _, content := range m.Content {
+		if content.Text != nil {
+			annotations = append(annotations, content.Text.Annotations...)
+		}
+	}
+	return annotations
+}
+
+// ResolvedCitation is a file citation of the message along with the name of the cited file.
+type ResolvedCitation struct {
+	// Index of the content of the message the annotation belongs to.
+	ContentIndex int
+	// Index of the annotation within the content, e.g. to number footnotes.
+	AnnotationIndex int
+	// The text in the message content replaced by the citation, and its offsets.
+	Text       string
+	StartIndex int
+	EndIndex   int
+	FileId     string
+	Quote      string
+	// Filename of the cited file, empty if the citation isn't resolved.
+	Filename string
+	// Resolved reports whether the cited file was found, files may be deleted after the run.
+	Resolved bool
+}
+
+// ResolveAnnotations returns the file citations of the message with the names of the cited files.
+// Every file is retrieved once per call, no matter how many times it's cited. Citations of the files
+// which don't exist anymore are returned unresolved, other errors of retrieving files are returned.
+func ResolveAnnotations(ctx context.Context, e *Engine, msg *ThreadMessage) ([]ResolvedCitation, error) {
+	var citations []ResolvedCitation
+	files := make(map[string]*File) // nil for files which don't exist
+	for i, content := range msg.Content {
+		if content.Text == nil {
+			continue
+		}
+		for j, annotation := range content.Text.Annotations {
+			if annotation.FileCitation == nil {
+				continue
+			}
+			fileId := annotation.FileCitation.FileId
+			file, ok := files[fileId]
+			if !ok {
+				var err error
+				file, err = e.RetrieveFile(ctx, &RetrieveFileOptions{ID: fileId})
+				if err != nil && !errors.Is(err, ErrNotFound) {
+					return nil, err
+				}
+				files[fileId] = file
+			}
+			citation := ResolvedCitation{
+				ContentIndex:    i,
+				AnnotationIndex: j,
+				Text:            annotation.Text,
+				StartIndex:      annotation.StartIndex,
+				EndIndex:        annotation.EndIndex,
+				FileId:          fileId,
+				Quote:           annotation.FileCitation.Quote,
+			}
+			if file != nil {
+				citation.Filename = file.Filename
+				citation.Resolved = true
+			}
+			citations = append(citations, citation)
+		}
+	}
+	return citations, nil
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testThreadMessage = `{
+	"id": "msg_abc123",
+	"object": "thread.message",
+	"thread_id": "thread_abc123",
+	"role": "assistant",
+	"content": [
+		{
+			"type": "text",
+			"text": {
+				"value": "The revenue grew【4:0†source】 while costs fell【4:1†source】. The margin improved【4:2†source】.",
+				"annotations": [
+					{"type": "file_citation", "text": "【4:0†source】", "start_index": 18, "end_index": 30, "file_citation": {"file_id": "file-report", "quote": "revenue grew by 12%"}},
+					{"type": "file_citation", "text": "【4:1†source】", "start_index": 47, "end_index": 59, "file_citation": {"file_id": "file-deleted"}},
+					{"type": "file_path", "text": "sandbox:/mnt/data/chart.png", "start_index": 60, "end_index": 87, "file_path": {"file_id": "file-chart"}}
+				]
+			}
+		},
+		{"type": "image_file"},
+		{
+			"type": "text",
+			"text": {
+				"value": "See also【4:3†source】.",
+				"annotations": [
+					{"type": "file_citation", "text": "【4:3†source】", "start_index": 8, "end_index": 20, "file_citation": {"file_id": "file-report", "quote": "margin"}}
+				]
+			}
+		}
+	]
+}`
+
+func TestResolveAnnotations(t *testing.T) {
+	lookups := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/files/")
+		lookups[id]++
+		if id != "file-report" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(notFoundBody))
+			return
+		}
+		w.Write([]byte(`{"id":"file-report","object":"file","filename":"q3-report.pdf","purpose":"assistants"}`))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	var msg ThreadMessage
+	require.NoError(t, json.Unmarshal([]byte(testThreadMessage), &msg))
+	citations, err := ResolveAnnotations(context.Background(), e, &msg)
+	require.NoError(t, err)
+	assert.Equal(t, []ResolvedCitation{
+		{ContentIndex: 0, AnnotationIndex: 0, Text: "【4:0†source】", StartIndex: 18, EndIndex: 30, FileId: "file-report", Quote: "revenue grew by 12%", Filename: "q3-report.pdf", Resolved: true},
+		{ContentIndex: 0, AnnotationIndex: 1, Text: "【4:1†source】", StartIndex: 47, EndIndex: 59, FileId: "file-deleted"},
+		{ContentIndex: 2, AnnotationIndex: 0, Text: "【4:3†source】", StartIndex: 8, EndIndex: 20, FileId: "file-report", Quote: "margin", Filename: "q3-report.pdf", Resolved: true},
+	}, citations)
+	assert.Equal(t, map[string]int{"file-report": 1, "file-deleted": 1}, lookups, "every file must be retrieved once")
+}
+
+func TestResolveAnnotationsError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":{"message":"internal error","type":"server_error"}}`))
+	}))
+	defer srv.Close()
+	e := New("test")
+	e.apiBaseURL = srv.URL
+
+	var msg ThreadMessage
+	require.NoError(t, json.Unmarshal([]byte(testThreadMessage), &msg))
+	_, err := ResolveAnnotations(context.Background(), e, &msg)
+	var apiErr APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusInternalServerError, apiErr.Err.StatusCode)
+}
+
+func TestThreadMessageAnnotations(t *testing.T) {
+	var msg ThreadMessage
+	require.NoError(t, json.Unmarshal([]byte(testThreadMessage), &msg))
+	annotations := msg.Annotations()
+	require.Len(t, annotations, 4)
+	assert.Equal(t, "file-report", annotations[0].FileCitation.FileId)
+	assert.Equal(t, "revenue grew by 12%", annotations[0].FileCitation.Quote)
+	assert.Equal(t, AnnotationFilePath, annotations[2].Type)
+	assert.Equal(t, "file-chart", annotations[2].FilePath.FileId)
+	assert.Equal(t, 8, annotations[3].StartIndex, "the offsets are the ones within the content")
+
+	const webMessage = `{"id":"msg_2","object":"thread.message","role":"assistant","content":[{"type":"text","text":{
+		"value":"Go 1.23 added iterators [1].",
+		"annotations":[{"type":"url_citation","text":"[1]","start_index":24,"end_index":27,
+			"url_citation":{"url":"https://go.dev/blog/go1.23","title":"Go 1.23 is released"}}]}}]}`
+	msg = ThreadMessage{}
+	require.NoError(t, json.Unmarshal([]byte(webMessage), &msg))
+	assert.Equal(t, []Annotation{{Type: AnnotationURLCitation, Text: "[1]", StartIndex: 24, EndIndex: 27,
+		URLCitation: &URLCitation{URL: "https://go.dev/blog/go1.23", Title: "Go 1.23 is released"}}}, msg.Annotations())
+
+	extracted := ExtractText(&msg, CitationFootnotes)
+	assert.Equal(t, "Go 1.23 added iterators[1].", extracted.Text)
+	assert.Equal(t, []CitationSource{{Type: AnnotationURLCitation, URL: "https://go.dev/blog/go1.23", Title: "Go 1.23 is released"}}, extracted.Sources)
+}
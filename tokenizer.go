@@ -0,0 +1,135 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktokenloader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// Encodings of the tokenizers of the models.
+const (
+	encodingCL100kBase = "cl100k_base"
+	encodingO200kBase  = "o200k_base"
+	// encodingR50kBase is the encoding of GPT-2, which the tokenizer of Whisper is based on.
+	encodingR50kBase = "r50k_base"
+)
+
+// tokenEncodings are the encodings of the chat and embeddings models by model prefix.
+// The longest matching prefix applies.
+//
+// Learn more: https://github.com/openai/tiktoken/blob/main/tiktoken/model.py
+var tokenEncodings = map[string]string{
+	"gpt-3.5-turbo": encodingCL100kBase,
+	"gpt-4":         encodingCL100kBase,
+	"gpt-4o":        encodingO200kBase,
+	"gpt-4.1":       encodingO200kBase,
+	"gpt-4.5":       encodingO200kBase,
+	"gpt-5":         encodingO200kBase,
+	"chatgpt-4o":    encodingO200kBase,
+	"o1":            encodingO200kBase,
+	"o3":            encodingO200kBase,
+	"o4":            encodingO200kBase,
+	// The embeddings models
+	"text-embedding-3":       encodingCL100kBase,
+	"text-embedding-ada-002": encodingCL100kBase,
+}
+
+// tokenEncodingOf returns the encoding of the model, or of the base model of the fine-tuned one,
+// ok is false if the model isn't known.
+func tokenEncodingOf(model Model) (encoding string, ok bool) {
+	name := strings.TrimPrefix(string(model), "ft:")
+	var prefix string
+	for p := range tokenEncodings {
+		if strings.HasPrefix(name, p) && len(p) > len(prefix) {
+			prefix = p
+		}
+	}
+	encoding, ok = tokenEncodings[prefix]
+	return encoding, ok
+}
+
+var (
+	tokenizersMu sync.Mutex
+	tokenizers   = make(map[string]*tiktoken.Tiktoken)
+)
+
+// tokenizer returns the tokenizer of the encoding. The vocabularies are embedded, they are loaded
+// on the first use of the encoding, which takes a while, and kept for the next ones.
+func tokenizer(encoding string) (*tiktoken.Tiktoken, error) {
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+	if t, ok := tokenizers[encoding]; ok {
+		return t, nil
+	}
+	if len(tokenizers) == 0 {
+		tiktoken.SetBpeLoader(tiktokenloader.NewOfflineLoader())
+	}
+	t, err := tiktoken.GetEncoding(encoding)
+	if err != nil {
+		return nil, err
+	}
+	tokenizers[encoding] = t
+	return t, nil
+}
+
+// tokenCounter returns the function counting the tokens of the text by the tokenizer of the model.
+// ErrTokensUnsupportedModel is returned if the encoding of the model isn't known.
+func tokenCounter(model Model) (func(text string) int, error) {
+	encoding, ok := tokenEncodingOf(model)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrTokensUnsupportedModel, model)
+	}
+	t, err := tokenizer(encoding)
+	if err != nil {
+		return nil, err
+	}
+	return func(text string) int {
+		return len(t.EncodeOrdinary(text))
+	}, nil
+}
+
+// countMessagesTokens returns the number of tokens of the prompt made of the messages, counted
+// by the tokenizer of the model the way the API counts them: every message takes 3 tokens for
+// the separators, 4 for gpt-3.5-turbo-0301, and the tokens of its role and content, and the prompt
+// ends with the 3 tokens of the reply primer. The names and the arguments of the tool calls are
+// counted as the text. Only the images aren't counted by the tokenizer, they are estimated by
+// their detail level, for the 1024x1024 image at the high detail level.
+//
+// Learn more: https://cookbook.openai.com/examples/how_to_count_tokens_with_tiktoken
+func countMessagesTokens(model Model, messages []ChatMessage) (int, error) {
+	count, err := tokenCounter(model)
+	if err != nil {
+		return 0, err
+	}
+	perMessage := tokensPerMessage - 1
+	if strings.HasPrefix(string(model), "gpt-3.5-turbo-0301") {
+		perMessage = tokensPerMessage
+	}
+	n := tokensPerReply
+	for _, m := range messages {
+		n += perMessage + count(m.Role) + count(m.Refusal)
+		if m.Parts == nil {
+			n += count(m.Content)
+		}
+		for _, part := range m.Parts {
+			switch {
+			case part.Type == ContentPartImageURL && part.ImageURL != nil && part.ImageURL.Detail == ImageDetailLow:
+				n += tokensPerLowDetailImage
+			case part.Type == ContentPartImageURL:
+				n += tokensPerHighDetailImage
+			default:
+				n += count(part.Text)
+			}
+		}
+		for _, call := range m.ToolCalls {
+			n += count(call.Function.Name) + count(call.Function.Arguments)
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrTokensUnsupportedModel is returned if tokens are counted for the model which isn't a chat model.
+var ErrTokensUnsupportedModel = errors.New("openai: token counting isn't supported for the model")
+
+const (
+	// tokensPerMessage is the overhead of every message: the role and the separators.
+	tokensPerMessage = 4
+	// tokensPerReply is the overhead of the reply primer, which every prompt ends with.
+	tokensPerReply = 3
+	// Tokens of images by detail level, the high detail level is estimated for the 1024x1024 image.
+	// Learn more: https://platform.openai.com/docs/guides/vision#calculating-costs
+	tokensPerLowDetailImage  = 85
+	tokensPerHighDetailImage = 765
+)
+
+// chatModelPrefixes are the prefixes of the chat models, which share the chat format.
+var chatModelPrefixes = []string{"gpt-3.5-turbo", "gpt-4", "chatgpt-", "o1", "o3", "o4"}
+
+// ChatMessages is the list of chat messages, e.g. the prompt of the chat completion.
+type ChatMessages []ChatMessage
+
+// Tokens returns the number of tokens of the message in the prompt of the model, including the
+// overhead of the role and separators, counted by the tokenizer of the model the same way as
+// Engine.CountMessagesTokens, but without the reply primer. ErrTokensUnsupportedModel is returned if the model isn't a chat model.
+func (m ChatMessage) Tokens(model Model) (int, error) {
+	if !isChatModel(model) {
+		return 0, fmt.Errorf("%w: %q", ErrTokensUnsupportedModel, model)
+	}
+	n, err := countMessagesTokens(model, []ChatMessage{m})
+	if err != nil {
+		return 0, err
+	}
+	return n - tokensPerReply, nil
+}
+
+// TotalTokens returns the number of tokens of the prompt made of the messages, including
+// the reply primer. See ChatMessage.Tokens for how tokens are counted.
+func (m ChatMessages) TotalTokens(model Model) (int, error) {
+	if !isChatModel(model) {
+		return 0, fmt.Errorf("%w: %q", ErrTokensUnsupportedModel, model)
+	}
+	return countMessagesTokens(model, m)
+}
+
+// WithDefaultModel is used to set the model of the chat completion requests whose model is empty.
+func WithDefaultModel(model Model) EngineOption {
+	return func(e *Engine) {
+		e.defaultModel = model
+	}
+}
+
+// chatModel returns the model the chat completion request of the model is sent with.
+func (e *Engine) chatModel(model Model) Model {
+	if model == "" {
+		return e.defaultModel
+	}
+	return model
+}
+
+// CountMessagesTokens returns the number of tokens of the prompt made of the messages, counted
+// by the tokenizer of the model, cl100k_base for gpt-4 and gpt-3.5-turbo and o200k_base for gpt-4o
+// and later models, including the overhead of the messages and the reply primer. The messages are
+// counted for the model the chat completion request would be sent with: the model, or the default
+// model of the engine if it's empty, see WithDefaultModel. The messages and the model are validated
+// the same way as the request, so the validator of the engine may set the model, see WithValidator.
+// Only the images of the messages are estimated. ErrTokensUnsupportedModel is returned if
+// the tokenizer of the model isn't known.
+func (e *Engine) CountMessagesTokens(ctx context.Context, messages []ChatMessage, model Model) (int, error) {
+	opts := &ChatCompletionOptions{Model: e.chatModel(model), Messages: messages}
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return 0, err
+	}
+	return countMessagesTokens(opts.Model, opts.Messages)
+}
+
+func isChatModel(model Model) bool {
+	for _, prefix := range chatModelPrefixes {
+		if strings.HasPrefix(string(model), prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatMessageTokens(t *testing.T) {
+	// "user" is 1 token and "Hello, world" 3 tokens of cl100k_base
+	n, err := ChatMessage{Role: "user", Content: "Hello, world"}.Tokens(ModelGPT4)
+	require.NoError(t, err)
+	assert.Equal(t, 3+1+3, n)
+
+	message := ChatMessage{Role: "user", Content: "お誕生日おめでとう"}
+	n, err = message.Tokens(ModelGPT4)
+	require.NoError(t, err)
+	total, err := New("test").CountMessagesTokens(context.Background(), []ChatMessage{message}, ModelGPT4)
+	require.NoError(t, err)
+	assert.Equal(t, total-3, n, "the same count as CountMessagesTokens without the reply primer")
+
+	n, err = ChatMessage{Role: "user", Parts: []ContentPart{
+		{Type: ContentPartText, Text: "What's this?"},
+		NewImageURLPart("https://example.com/a.png", ImageDetailLow),
+		NewImageURLPart("https://example.com/b.png", ""),
+	}}.Tokens(ModelGPT3Dot5Turbo)
+	require.NoError(t, err)
+	assert.Equal(t, 3+1+4+85+765, n)
+
+	_, err = ChatMessage{Role: "user", Content: "Hello"}.Tokens(ModelTextEmbedding3Small)
+	assert.ErrorIs(t, err, ErrTokensUnsupportedModel)
+}
+
+func TestChatMessagesTotalTokens(t *testing.T) {
+	messages := ChatMessages{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "Hello, world"},
+	}
+	n, err := messages.TotalTokens(ModelGPT4)
+	require.NoError(t, err)
+	assert.Equal(t, 3+(3+1+3)+(3+1+3), n)
+
+	n, err = ChatMessages(nil).TotalTokens(ModelGPT4)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	_, err = messages.TotalTokens(ModelWhisper)
+	assert.ErrorIs(t, err, ErrTokensUnsupportedModel)
+}
+
+type defaultModelValidator struct {
+	Validator
+	model Model
+}
+
+func (v defaultModelValidator) ValidateCtx(ctx context.Context, s interface{}) error {
+	if opts, ok := s.(*ChatCompletionOptions); ok && opts.Model == "" {
+		opts.Model = v.model
+	}
+	return v.Validator.ValidateCtx(ctx, s)
+}
+
+func TestCountMessagesTokens(t *testing.T) {
+	// The content is 9 tokens of cl100k_base and 8 tokens of o200k_base, "user" is 1 token of both
+	messages := []ChatMessage{{Role: "user", Content: "お誕生日おめでとう"}}
+
+	_, err := New("test").CountMessagesTokens(context.Background(), messages, "")
+	assert.ErrorContains(t, err, "Model", "the model is required without the default model")
+
+	e := New("test", WithDefaultModel(ModelGPT4))
+	n, err := e.CountMessagesTokens(context.Background(), messages, "")
+	require.NoError(t, err)
+	assert.Equal(t, 3+(3+1+9), n)
+	n, err = e.CountMessagesTokens(context.Background(), messages, "gpt-3.5-turbo-0301")
+	require.NoError(t, err)
+	assert.Equal(t, 3+(4+1+9), n, "the message overhead of gpt-3.5-turbo-0301")
+	_, err = e.CountMessagesTokens(context.Background(), messages, ModelWhisper)
+	assert.ErrorIs(t, err, ErrTokensUnsupportedModel, "the model overrides the default model")
+	_, err = e.CountMessagesTokens(context.Background(), nil, "")
+	assert.ErrorContains(t, err, "Messages", "the messages are validated as the request")
+
+	e = New("test")
+	WithValidator(defaultModelValidator{Validator: e.validate, model: "gpt-4o"})(e)
+	n, err = e.CountMessagesTokens(context.Background(), messages, "")
+	require.NoError(t, err)
+	assert.Equal(t, 3+(3+1+8), n, "o200k_base of gpt-4o")
+
+	n, err = e.CountMessagesTokens(context.Background(), []ChatMessage{{Role: "user", Parts: []ContentPart{
+		{Type: ContentPartText, Text: "お誕生日おめでとう"},
+		NewImageURLPart("https://example.com/a.png", ImageDetailLow),
+	}}}, "ft:gpt-4o-mini-2024-07-18:acme::abc123")
+	require.NoError(t, err)
+	assert.Equal(t, 3+(3+1+8+85), n)
+
+	// "assistant" is 1 token, the name of the call 2 and the arguments 7 tokens of cl100k_base
+	n, err = e.CountMessagesTokens(context.Background(), []ChatMessage{{Role: "assistant", ToolCalls: []ToolCall{{
+		Id:       "call_1",
+		Type:     "function",
+		Function: ToolCallFunction{Name: "get_weather", Arguments: `{"city":"東京"}`},
+	}}}}, ModelGPT4)
+	require.NoError(t, err)
+	assert.Equal(t, 3+(3+1+2+7), n, "the tool calls are counted by the tokenizer")
+}
+
+func TestChatCompletionDefaultModel(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o-mini","choices":[]}`))
+	}))
+	defer srv.Close()
+	e := New("test", WithDefaultModel("gpt-4o-mini"))
+	e.apiBaseURL = srv.URL
+
+	opts := &ChatCompletionOptions{Messages: []ChatMessage{{Role: "user", Content: "Hello"}}}
+	_, err := e.ChatCompletion(context.Background(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o-mini", body["model"])
+	assert.Empty(t, opts.Model, "opts isn't modified")
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Tool is a function the model may call.
+type Tool struct {
+	// The type of the tool, only "function" is supported.
+	Type string `json:"type"`
+	// The name of the function.
+	Name string `json:"name"`
+	// A description of what the function does, used by the model to choose when and how to call the function.
+	Description string `json:"description,omitempty"`
+	// The parameters the function accepts, described as a JSON Schema object.
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ChatTool is a tool the model may call during the chat completion.
+type ChatTool struct {
+	// The type of the tool, only "function" is supported.
+	Type string `json:"type"`
+	// The function the model may call.
+	Function FunctionDefinition `json:"function"`
+}
+
+// FunctionDefinition describes the function of the chat tool.
+type FunctionDefinition struct {
+	// The name of the function, up to 64 letters, digits, underscores and dashes.
+	Name string `json:"name"`
+	// A description of what the function does, used by the model to choose when and how to call the function.
+	Description string `json:"description,omitempty"`
+	// The parameters the function accepts, described as a JSON Schema object.
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+	// Whether to enable strict schema adherence when generating the function call.
+	Strict bool `json:"strict,omitempty"`
+}
+
+// ToolCall is the call of the function generated by the model.
+type ToolCall struct {
+	// ID of the call, the tool message with the result refers to it.
+	Id string `json:"id"`
+	// The type of the tool, only "function" is supported.
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction is the name of the function to call with the arguments.
+type ToolCallFunction struct {
+	Name string `json:"name"`
+	// The arguments encoded in JSON. The model doesn't always generate valid JSON,
+	// and may hallucinate parameters not defined by the schema.
+	Arguments string `json:"arguments"`
+}
+
+// ToolChoice controls which tool is called by the model. It's either one of the modes
+// ToolChoiceAuto, ToolChoiceNone or ToolChoiceRequired, or the name of the function to call.
+type ToolChoice string
+
+const (
+	// ToolChoiceAuto lets the model choose between calling tools and generating a message.
+	ToolChoiceAuto ToolChoice = "auto"
+	// ToolChoiceNone forbids the model to call tools.
+	ToolChoiceNone ToolChoice = "none"
+	// ToolChoiceRequired forces the model to call one or more tools.
+	ToolChoiceRequired ToolChoice = "required"
+)
+
+// ToolChoiceFunction forces the model to call the function with the given name.
+func ToolChoiceFunction(name string) ToolChoice {
+	return ToolChoice(name)
+}
+
+type toolChoiceFunction struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// MarshalJSON encodes modes as strings, and function names as {"type": "function", "name": "..."}.
+func (c ToolChoice) MarshalJSON() ([]byte, error) {
+	switch c {
+	case ToolChoiceAuto, ToolChoiceNone, ToolChoiceRequired:
+		return json.Marshal(string(c))
+	}
+	return json.Marshal(toolChoiceFunction{Type: "function", Name: string(c)})
+}
+
+func (c *ToolChoice) UnmarshalJSON(b []byte) error {
+	var mode string
+	if err := json.Unmarshal(b, &mode); err == nil {
+		*c = ToolChoice(mode)
+		return nil
+	}
+	var fn toolChoiceFunction
+	if err := json.Unmarshal(b, &fn); err != nil {
+		return fmt.Errorf("tool choice must be a string or an object: %w", err)
+	}
+	*c = ToolChoice(fn.Name)
+	return nil
+}
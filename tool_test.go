@@ -0,0 +1,38 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolChoiceJSON(t *testing.T) {
+	for _, tc := range []struct {
+		choice ToolChoice
+		json   string
+	}{
+		{ToolChoiceAuto, `"auto"`},
+		{ToolChoiceNone, `"none"`},
+		{ToolChoiceRequired, `"required"`},
+		{ToolChoiceFunction("get_weather"), `{"type":"function","name":"get_weather"}`},
+	} {
+		b, err := json.Marshal(tc.choice)
+		require.NoError(t, err)
+		assert.JSONEq(t, tc.json, string(b))
+
+		var choice ToolChoice
+		require.NoError(t, json.Unmarshal(b, &choice))
+		assert.Equal(t, tc.choice, choice)
+	}
+
+	b, err := json.Marshal(struct {
+		ToolChoice ToolChoice `json:"tool_choice,omitempty"`
+	}{})
+	require.NoError(t, err)
+	assert.Equal(t, `{}`, string(b))
+}
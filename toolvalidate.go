@@ -0,0 +1,187 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ToolCallRule is the rule of ToolCallValidator the tool call must pass.
+type ToolCallRule string
+
+const (
+	// ToolCallRuleUnknownTool rejects calls of the tools which weren't offered to the model.
+	ToolCallRuleUnknownTool ToolCallRule = "unknown_tool"
+	// ToolCallRuleJSON rejects calls whose arguments aren't the valid JSON object.
+	ToolCallRuleJSON ToolCallRule = "json"
+	// ToolCallRuleSchema rejects calls whose arguments don't conform to the parameters schema of the tool.
+	ToolCallRuleSchema ToolCallRule = "schema"
+	// ToolCallRuleMaxLength rejects calls with string arguments longer than ToolCallValidator.MaxStringLength.
+	ToolCallRuleMaxLength ToolCallRule = "max_length"
+	// ToolCallRuleDenyList rejects calls with string arguments matching one of ToolCallValidator.DenyPatterns.
+	ToolCallRuleDenyList ToolCallRule = "deny_list"
+	// ToolCallRuleControlCharacters rejects calls with string arguments containing control characters.
+	ToolCallRuleControlCharacters ToolCallRule = "control_characters"
+)
+
+// ToolCallRejectedError is returned if the tool call doesn't pass the rule of ToolCallValidator.
+type ToolCallRejectedError struct {
+	// CallId is the ID of the rejected call.
+	CallId string
+	// Tool is the name of the function the model called.
+	Tool string
+	Rule ToolCallRule
+	// Reason describes the violation of the rule, e.g. `$.query: matches the denied pattern "(?i)drop table"`.
+	Reason string
+	// Err is the underlying error, e.g. *SchemaViolationError for ToolCallRuleSchema, if any.
+	Err error
+}
+
+func (e *ToolCallRejectedError) Error() string {
+	return fmt.Sprintf("openai: tool call %s of %s rejected by rule %s: %s", e.CallId, e.Tool, e.Rule, e.Reason)
+}
+
+func (e *ToolCallRejectedError) Unwrap() error {
+	return e.Err
+}
+
+// ToolCallValidator is the defense-in-depth check of the tool calls generated by the model before
+// they are executed, e.g. against prompt injections carried by the content the model has read.
+// The arguments of the call must be the JSON object conforming to the parameters schema of the tool,
+// and the tool must be one of the offered tools. The string arguments, including the nested ones,
+// are screened by the optional rules of the validator. The zero value only checks the call against
+// the tools and their schemas.
+type ToolCallValidator struct {
+	// MaxStringLength is the maximum length of the string argument in characters, no limit if it's zero.
+	MaxStringLength int
+	// DenyPatterns reject the string arguments which match any of them.
+	DenyPatterns []*regexp.Regexp
+	// DenyControlCharacters rejects the string arguments containing control characters,
+	// other than tabs and line breaks.
+	DenyControlCharacters bool
+}
+
+// Validate is used to check call against the tools offered to the model. It returns
+// *ToolCallRejectedError identifying the first rule the call doesn't pass. The nil validator
+// only checks the call against the tools and their schemas.
+func (v *ToolCallValidator) Validate(call ToolCall, tools []ChatTool) error {
+	reject := func(rule ToolCallRule, reason string, err error) error {
+		return &ToolCallRejectedError{CallId: call.Id, Tool: call.Function.Name, Rule: rule, Reason: reason, Err: err}
+	}
+	var tool *ChatTool
+	for i := range tools {
+		if tools[i].Function.Name == call.Function.Name {
+			tool = &tools[i]
+			break
+		}
+	}
+	if tool == nil {
+		return reject(ToolCallRuleUnknownTool, fmt.Sprintf("tool %q wasn't offered", call.Function.Name), nil)
+	}
+
+	arguments := call.Function.Arguments
+	if strings.TrimSpace(arguments) == "" {
+		arguments = "{}"
+	}
+	var args interface{}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return reject(ToolCallRuleJSON, "arguments must be valid JSON: "+err.Error(), err)
+	}
+	if _, ok := args.(map[string]interface{}); !ok {
+		return reject(ToolCallRuleJSON, "arguments must be a JSON object, got "+jsonTypeOf(args), nil)
+	}
+	if len(tool.Function.Parameters) != 0 {
+		err := ValidateAgainstSchema([]byte(arguments), tool.Function.Parameters)
+		if violation, ok := err.(*SchemaViolationError); ok {
+			violations := make([]string, len(violation.Violations))
+			for i, v := range violation.Violations {
+				violations[i] = v.String()
+			}
+			return reject(ToolCallRuleSchema, strings.Join(violations, "; "), err)
+		}
+		if err != nil {
+			return reject(ToolCallRuleSchema, err.Error(), err)
+		}
+	}
+	if v == nil {
+		return nil
+	}
+	if rule, reason := v.screen(args, "$"); rule != "" {
+		return reject(rule, reason, nil)
+	}
+	return nil
+}
+
+// screen checks the string values of the decoded JSON value at path, and returns the rule
+// and the reason of the first violation, or the empty rule.
+func (v *ToolCallValidator) screen(value interface{}, path string) (ToolCallRule, string) {
+	switch value := value.(type) {
+	case string:
+		if v.MaxStringLength > 0 && utf8.RuneCountInString(value) > v.MaxStringLength {
+			return ToolCallRuleMaxLength, fmt.Sprintf("%s: longer than %d characters", path, v.MaxStringLength)
+		}
+		for _, pattern := range v.DenyPatterns {
+			if pattern.MatchString(value) {
+				return ToolCallRuleDenyList, fmt.Sprintf("%s: matches the denied pattern %q", path, pattern)
+			}
+		}
+		if v.DenyControlCharacters {
+			for _, r := range value {
+				if unicode.IsControl(r) && r != '\t' && r != '\n' && r != '\r' {
+					return ToolCallRuleControlCharacters, fmt.Sprintf("%s: contains the control character %U", path, r)
+				}
+			}
+		}
+	case map[string]interface{}:
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if rule, reason := v.screen(value[name], path+"."+name); rule != "" {
+				return rule, reason
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			if rule, reason := v.screen(item, fmt.Sprintf("%s[%d]", path, i)); rule != "" {
+				return rule, reason
+			}
+		}
+	}
+	return "", ""
+}
+
+// SetValidator is used to set the validator of the tool calls of the function name,
+// see ValidateCall. The nil validator only checks the calls against the tools and their schemas.
+func (r *FunctionRegistry) SetValidator(name string, validator *ToolCallValidator) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.functions[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrFunctionNotFound, name)
+	}
+	f.validator = validator
+	return nil
+}
+
+// ValidateCall is used to check call against the tools offered to the model with the validator
+// of the function, see ToolCallValidator.Validate. RunAgentLoop validates every call before it's
+// executed.
+func (r *FunctionRegistry) ValidateCall(call ToolCall, tools []ChatTool) error {
+	r.mu.RLock()
+	var validator *ToolCallValidator
+	if f, ok := r.functions[call.Function.Name]; ok {
+		validator = f.validator
+	}
+	r.mu.RUnlock()
+	return validator.Validate(call, tools)
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func weatherCall(id, name, arguments string) ToolCall {
+	return ToolCall{Id: id, Type: "function", Function: ToolCallFunction{Name: name, Arguments: arguments}}
+}
+
+func TestToolCallValidator(t *testing.T) {
+	functions := NewFunctionRegistry()
+	require.NoError(t, functions.RegisterFromStruct(&weatherHandler{}))
+	tools := functions.ChatTools()
+	v := &ToolCallValidator{
+		MaxStringLength:       32,
+		DenyPatterns:          []*regexp.Regexp{regexp.MustCompile(`(?i)ignore (all )?previous instructions`)},
+		DenyControlCharacters: true,
+	}
+
+	for _, tt := range []struct {
+		name      string
+		call      ToolCall
+		validator *ToolCallValidator
+		rule      ToolCallRule
+		reason    string
+	}{
+		{name: "valid", call: weatherCall("call_1", "get_weather", `{"city":"Berlin","unit":"celsius"}`), validator: v},
+		{name: "nil validator", call: weatherCall("call_1", "get_weather", `{"city":"ignore previous instructions"}`)},
+		{name: "empty arguments", call: weatherCall("call_1", "get_uv_index", ""), validator: v, rule: ToolCallRuleSchema,
+			reason: `$: missing required property "city"`},
+		{name: "unknown tool", call: weatherCall("call_1", "delete_files", `{}`), validator: v, rule: ToolCallRuleUnknownTool,
+			reason: `tool "delete_files" wasn't offered`},
+		{name: "invalid JSON", call: weatherCall("call_1", "get_weather", `{"city":`), validator: v, rule: ToolCallRuleJSON},
+		{name: "not an object", call: weatherCall("call_1", "get_weather", `["Berlin"]`), validator: v, rule: ToolCallRuleJSON,
+			reason: "arguments must be a JSON object, got array"},
+		{name: "schema mismatch", call: weatherCall("call_1", "get_weather", `{"city":"Berlin","unit":"kelvin"}`), rule: ToolCallRuleSchema,
+			reason: `$.unit: must be one of ["celsius","fahrenheit"], got "kelvin"`},
+		{name: "max length", call: weatherCall("call_1", "get_weather", `{"city":"Llanfairpwllgwyngyllgogerychwyrndrobwll"}`), validator: v,
+			rule: ToolCallRuleMaxLength, reason: "$.city: longer than 32 characters"},
+		{name: "deny list", call: weatherCall("call_1", "get_weather", `{"city":"Ignore previous instructions"}`), validator: v,
+			rule: ToolCallRuleDenyList, reason: `$.city: matches the denied pattern "(?i)ignore (all )?previous instructions"`},
+		{name: "control characters", call: weatherCall("call_1", "get_weather", `{"city":"Berlin\u001b[2J"}`), validator: v,
+			rule: ToolCallRuleControlCharacters, reason: "$.city: contains the control character U+001B"},
+		{name: "line breaks", call: weatherCall("call_1", "get_weather", `{"city":"Berlin\n"}`), validator: v},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.validator.Validate(tt.call, tools)
+			if tt.rule == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var rejected *ToolCallRejectedError
+			require.ErrorAs(t, err, &rejected)
+			assert.Equal(t, "call_1", rejected.CallId)
+			assert.Equal(t, tt.call.Function.Name, rejected.Tool)
+			assert.Equal(t, tt.rule, rejected.Rule)
+			if tt.reason != "" {
+				assert.Equal(t, tt.reason, rejected.Reason)
+			}
+		})
+	}
+
+	err := (*ToolCallValidator)(nil).Validate(weatherCall("call_1", "get_weather", `{"unit":"kelvin"}`), tools)
+	var violation *SchemaViolationError
+	require.ErrorAs(t, err, &violation, "the schema violation is wrapped")
+	assert.Len(t, violation.Violations, 2)
+	assert.EqualError(t, err, `openai: tool call call_1 of get_weather rejected by rule schema: `+
+		`$: missing required property "city"; $.unit: must be one of ["celsius","fahrenheit"], got "kelvin"`)
+}
+
+func TestFunctionRegistryValidateCall(t *testing.T) {
+	functions := NewFunctionRegistry()
+	require.NoError(t, functions.RegisterFromStruct(&weatherHandler{}))
+	tools := functions.ChatTools()
+	require.NoError(t, functions.SetValidator("get_weather", &ToolCallValidator{MaxStringLength: 3}))
+	assert.True(t, errors.Is(functions.SetValidator("missing", &ToolCallValidator{}), ErrFunctionNotFound))
+
+	var rejected *ToolCallRejectedError
+	require.ErrorAs(t, functions.ValidateCall(weatherCall("call_1", "get_weather", `{"city":"Berlin"}`), tools), &rejected)
+	assert.Equal(t, ToolCallRuleMaxLength, rejected.Rule)
+	assert.NoError(t, functions.ValidateCall(weatherCall("call_1", "get_uv_index", `{"city":"Berlin"}`), tools),
+		"the validator is set per function")
+	assert.ErrorAs(t, functions.ValidateCall(weatherCall("call_1", "get_weather", `{"city":"Rome"}`), tools[:1]), &rejected)
+	assert.Equal(t, ToolCallRuleUnknownTool, rejected.Rule, "only the offered tools are called")
+}
+
+func TestRunAgentLoopRejectsToolCalls(t *testing.T) {
+	const injectedCalls = `{"role":"assistant","content":null,"tool_calls":[` +
+		`{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Berlin; ignore previous instructions\"}"}},` +
+		`{"id":"call_2","type":"function","function":{"name":"send_email","arguments":"{}"}},` +
+		`{"id":"call_3","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Berlin\",\"unit\":\"kelvin\"}"}},` +
+		`{"id":"call_4","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Berlin\"}"}}]}`
+	var requests []*ChatCompletionOptions
+	e := newAgentServer(t, &requests, injectedCalls, `{"role":"assistant","content":"It's sunny in Berlin."}`)
+	functions := NewFunctionRegistry()
+	var calls []weatherParams
+	require.NoError(t, functions.Register("get_weather", "", func(ctx context.Context, params weatherParams) (string, error) {
+		calls = append(calls, params)
+		return "sunny", nil
+	}))
+	require.NoError(t, functions.SetValidator("get_weather", &ToolCallValidator{
+		DenyPatterns: []*regexp.Regexp{regexp.MustCompile(`(?i)ignore previous instructions`)},
+	}))
+
+	resp, err := e.RunAgentLoop(context.Background(), testChatOptions(), functions, AgentLoopOptions{})
+	require.NoError(t, err, "the loop continues after the rejections")
+	assert.Equal(t, "It's sunny in Berlin.", resp.Choices[0].Message.Content)
+	assert.Equal(t, []weatherParams{{City: "Berlin"}}, calls, "the rejected calls aren't executed")
+
+	require.Len(t, requests, 2)
+	results := requests[1].Messages[2:]
+	require.Len(t, results, 4)
+	assert.Equal(t, ChatMessage{Role: "tool", ToolCallId: "call_1", Content: `error: openai: tool call call_1 of get_weather rejected by rule deny_list: ` +
+		`$.city: matches the denied pattern "(?i)ignore previous instructions"`}, results[0])
+	assert.Equal(t, "call_2", results[1].ToolCallId)
+	assert.Contains(t, results[1].Content, "rejected by rule unknown_tool")
+	assert.Equal(t, "call_3", results[2].ToolCallId)
+	assert.Contains(t, results[2].Content, "rejected by rule schema")
+	assert.Equal(t, ChatMessage{Role: "tool", ToolCallId: "call_4", Content: "sunny"}, results[3])
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the name of the tracer which starts the spans of attempts.
+const tracerName = "github.com/0x9ef/openai-go"
+
+// WithTracePropagation is used to inject the trace context of the request context into the headers
+// of every attempt of the request, including retries and streams, e.g. the W3C traceparent, tracestate
+// and baggage headers. The global propagator of OpenTelemetry is used if propagator is nil. Nothing is
+// injected if the context doesn't carry the span.
+func WithTracePropagation(propagator propagation.TextMapPropagator) EngineOption {
+	return func(e *Engine) {
+		e.propagator = propagator
+		if propagator == nil {
+			e.propagator = otel.GetTextMapPropagator()
+		}
+	}
+}
+
+// WithAttemptSpans is used to start the client span for every attempt of the request, as the child
+// of the span of the request context, so retries show up as separate spans of the same trace.
+// The headers injected by WithTracePropagation carry the span of the attempt. The global tracer
+// provider of OpenTelemetry is used if tp is nil.
+func WithAttemptSpans(tp trace.TracerProvider) EngineOption {
+	return func(e *Engine) {
+		if tp == nil {
+			tp = otel.GetTracerProvider()
+		}
+		e.tracer = tp.Tracer(tracerName)
+	}
+}
+
+type attemptSpanKey struct{}
+
+// startAttemptSpan starts the span of the attempt of req, if attempt spans are enabled
+// and ctx carries the span.
+func (e *Engine) startAttemptSpan(ctx context.Context, req *http.Request, attempt int) context.Context {
+	if e.tracer == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	ctx, span := e.tracer.Start(ctx, req.Method+" "+requestInfoFrom(ctx).endpoint,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Host),
+			attribute.Int("http.request.resend_count", attempt),
+		))
+	// The span is marked, so the span of the caller is never ended instead
+	return context.WithValue(ctx, attemptSpanKey{}, span)
+}
+
+// endAttemptSpan ends the span of the attempt started by startAttemptSpan.
+func endAttemptSpan(ctx context.Context, resp *http.Response, err error) {
+	span, ok := ctx.Value(attemptSpanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+	switch {
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	case resp.StatusCode >= 400:
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	default:
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	}
+	span.End()
+}
+
+// injectTraceContext sets the trace context headers of the attempt, if ctx carries the span.
+func (e *Engine) injectTraceContext(ctx context.Context, h http.Header) {
+	if e.propagator == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+		return
+	}
+	e.propagator.Inject(ctx, propagation.HeaderCarrier(h))
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingPropagator propagates the W3C trace context and baggage, recording the injected span contexts.
+type recordingPropagator struct {
+	propagation.TextMapPropagator
+	mu       sync.Mutex
+	injected []trace.SpanContext
+}
+
+func newRecordingPropagator() *recordingPropagator {
+	return &recordingPropagator{TextMapPropagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})}
+}
+
+func (p *recordingPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	p.mu.Lock()
+	p.injected = append(p.injected, trace.SpanContextFromContext(ctx))
+	p.mu.Unlock()
+	p.TextMapPropagator.Inject(ctx, carrier)
+}
+
+type testTracerProvider struct {
+	embedded.TracerProvider
+	tracer *testTracer
+}
+
+func (p *testTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return p.tracer
+}
+
+type testTracer struct {
+	embedded.Tracer
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sc := trace.SpanContextFromContext(ctx).WithSpanID(trace.SpanID{0xa, byte(len(t.spans) + 1)})
+	span := &testSpan{Span: noop.Span{}, sc: sc, name: name}
+	t.spans = append(t.spans, span)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type testSpan struct {
+	trace.Span
+	sc     trace.SpanContext
+	name   string
+	status codes.Code
+	ended  bool
+}
+
+func (s *testSpan) SpanContext() trace.SpanContext      { return s.sc }
+func (s *testSpan) IsRecording() bool                   { return !s.ended }
+func (s *testSpan) SetStatus(code codes.Code, _ string) { s.status = code }
+func (s *testSpan) End(...trace.SpanEndOption)          { s.ended = true }
+
+var testParentSpan = trace.NewSpanContext(trace.SpanContextConfig{
+	TraceID:    trace.TraceID{0x1, 0x2, 0x3},
+	SpanID:     trace.SpanID{0x1},
+	TraceFlags: trace.FlagsSampled,
+})
+
+func testTraceContext(t *testing.T) context.Context {
+	member, err := baggage.NewMember("tenant", "acme")
+	require.NoError(t, err)
+	bag, err := baggage.New(member)
+	require.NoError(t, err)
+	return baggage.ContextWithBaggage(trace.ContextWithSpanContext(context.Background(), testParentSpan), bag)
+}
+
+// newTracingServer fails the first chat completion with 500, records headers of every request.
+func newTracingServer(t *testing.T, headers *[]http.Header, opts ...EngineOption) *Engine {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*headers = append(*headers, r.Header.Clone())
+		switch {
+		case r.URL.Path == "/completions":
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"id\":\"cmpl-1\",\"choices\":[{\"text\":\"a\",\"index\":0}]}\n\ndata: [DONE]\n\n"))
+		case len(*headers) == 1:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":{"message":"internal","type":"server_error"}}`))
+		default:
+			w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	e := New("sk-test", opts...)
+	e.apiBaseURL = srv.URL
+	e.clock = newAutoClock()
+	e.SetMaxRetries(1)
+	return e
+}
+
+func TestTracePropagation(t *testing.T) {
+	var headers []http.Header
+	propagator := newRecordingPropagator()
+	e := newTracingServer(t, &headers, WithTracePropagation(propagator))
+
+	_, err := e.ChatCompletion(testTraceContext(t), testChatOptions())
+	require.NoError(t, err)
+	s, err := e.CompletionStream(testTraceContext(t), &CompletionOptions{Model: ModelGPT3TextDavinci003, Prompt: []string{"a"}})
+	require.NoError(t, err)
+	s.Close()
+
+	require.Len(t, headers, 3)
+	for i, h := range headers {
+		assert.Equal(t, "00-01020300000000000000000000000000-0100000000000000-01", h.Get("Traceparent"), "request %d", i)
+		assert.Equal(t, "tenant=acme", h.Get("Baggage"), "request %d", i)
+	}
+	assert.Len(t, propagator.injected, 3, "the trace context must be injected into every attempt")
+}
+
+func TestTracePropagationAttemptSpans(t *testing.T) {
+	var headers []http.Header
+	tracer := &testTracer{}
+	e := newTracingServer(t, &headers, WithTracePropagation(newRecordingPropagator()), WithAttemptSpans(&testTracerProvider{tracer: tracer}))
+
+	_, err := e.ChatCompletion(testTraceContext(t), testChatOptions())
+	require.NoError(t, err)
+
+	require.Len(t, headers, 2)
+	require.Len(t, tracer.spans, 2)
+	assert.Equal(t, "00-01020300000000000000000000000000-0a01000000000000-01", headers[0].Get("Traceparent"))
+	assert.Equal(t, "00-01020300000000000000000000000000-0a02000000000000-01", headers[1].Get("Traceparent"),
+		"retries must be separate spans of the same trace")
+	assert.Equal(t, "POST /chat/completions", tracer.spans[0].name)
+	assert.True(t, tracer.spans[0].ended && tracer.spans[1].ended)
+	assert.Equal(t, codes.Error, tracer.spans[0].status)
+	assert.Equal(t, codes.Unset, tracer.spans[1].status)
+}
+
+func TestTracePropagationWithoutSpan(t *testing.T) {
+	var headers []http.Header
+	propagator := newRecordingPropagator()
+	tracer := &testTracer{}
+	e := newTracingServer(t, &headers, WithTracePropagation(propagator), WithAttemptSpans(&testTracerProvider{tracer: tracer}))
+
+	member, err := baggage.NewMember("tenant", "acme")
+	require.NoError(t, err)
+	bag, err := baggage.New(member)
+	require.NoError(t, err)
+	_, err = e.ChatCompletion(baggage.ContextWithBaggage(context.Background(), bag), testChatOptions())
+	require.NoError(t, err)
+
+	require.Len(t, headers, 2)
+	for _, h := range headers {
+		assert.Empty(t, h.Get("Traceparent"))
+		assert.Empty(t, h.Get("Baggage"))
+	}
+	assert.Empty(t, propagator.injected)
+	assert.Empty(t, tracer.spans)
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// UploadKey identifies the content of the uploaded file for the purpose.
+type UploadKey struct {
+	// Hash is the hex encoded SHA-256 of the content.
+	Hash    string
+	Purpose string
+}
+
+// UploadIndex maps the content of the uploaded files to their IDs, see WithUploadIndex.
+// MemoryUploadIndex keeps it in memory, a shared store, e.g. Redis, can back it to deduplicate
+// the uploads across processes.
+type UploadIndex interface {
+	// Get returns the ID of the file uploaded with the content of key, ok is false if there is none.
+	Get(ctx context.Context, key UploadKey) (fileId string, ok bool, err error)
+	// Put sets the ID of the file uploaded with the content of key, replacing the previous one.
+	Put(ctx context.Context, key UploadKey, fileId string) error
+	// Delete removes the entry of key, e.g. if its file was deleted.
+	Delete(ctx context.Context, key UploadKey) error
+}
+
+// WithUploadIndex is used to deduplicate the uploads of UploadFile by content. The SHA-256 of the
+// content is looked up in index with the purpose, and if the file of the entry is still live,
+// which is verified with RetrieveFile, it's returned without the upload. Otherwise the entry is
+// evicted, the file is uploaded and indexed.
+//
+// The seekable content, e.g. *os.File, is hashed before the upload by reading it without copying,
+// other content is hashed as it's buffered, see SetMultipartBufferSize. Content bigger than the
+// buffer which isn't seekable is hashed while it's uploaded, so it's indexed but can't be
+// deduplicated. Set UploadFileOptions.ForceUpload to skip the lookup.
+func WithUploadIndex(index UploadIndex) EngineOption {
+	return func(e *Engine) {
+		e.uploadIndex = index
+	}
+}
+
+func (e *Engine) uploadFileDedup(ctx context.Context, opts *UploadFileOptions) (*File, error) {
+	h := newContentHasher()
+	body, err := newUploadFileBody(opts, e.multipartBufferSize, h)
+	if err != nil {
+		return nil, err
+	}
+	// The replayable body is seekable or buffered, so its content has been hashed whole
+	if body.replayable && !opts.ForceUpload {
+		hash, size := h.sum()
+		f, err := e.indexedFile(ctx, UploadKey{Hash: hash, Purpose: opts.Purpose}, size)
+		if err != nil || f != nil {
+			return f, err
+		}
+	}
+	f, err := e.uploadFile(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	hash, _ := h.sum()
+	if err := e.uploadIndex.Put(ctx, UploadKey{Hash: hash, Purpose: opts.Purpose}, f.Id); err != nil {
+		return f, fmt.Errorf("index uploaded file %s: %w", f.Id, err)
+	}
+	return f, nil
+}
+
+// indexedFile returns the live file of the entry of key, or nil if there is none. The entry is
+// evicted if its file was deleted, or it doesn't match the content of the size and the purpose.
+func (e *Engine) indexedFile(ctx context.Context, key UploadKey, size int64) (*File, error) {
+	id, ok, err := e.uploadIndex.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("get upload index: %w", err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	f, err := e.RetrieveFile(ctx, &RetrieveFileOptions{ID: id})
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("verify indexed file %s: %w", id, err)
+	}
+	if err == nil && f.Bytes == size && f.Purpose == key.Purpose {
+		return f, nil
+	}
+	if err := e.uploadIndex.Delete(ctx, key); err != nil {
+		return nil, fmt.Errorf("evict indexed file %s: %w", id, err)
+	}
+	return nil, nil
+}
+
+// MemoryUploadIndex is the UploadIndex kept in memory, it's safe for concurrent use.
+type MemoryUploadIndex struct {
+	mu    sync.RWMutex
+	files map[UploadKey]string
+}
+
+// NewMemoryUploadIndex returns the empty index.
+func NewMemoryUploadIndex() *MemoryUploadIndex {
+	return &MemoryUploadIndex{files: make(map[UploadKey]string)}
+}
+
+func (m *MemoryUploadIndex) Get(ctx context.Context, key UploadKey) (string, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	id, ok := m.files[key]
+	return id, ok, nil
+}
+
+func (m *MemoryUploadIndex) Put(ctx context.Context, key UploadKey, fileId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[key] = fileId
+	return nil
+}
+
+func (m *MemoryUploadIndex) Delete(ctx context.Context, key UploadKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.files, key)
+	return nil
+}
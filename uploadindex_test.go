@@ -0,0 +1,210 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// filesServer is the fake Files API which stores the uploaded files in memory.
+type filesServer struct {
+	mu        sync.Mutex
+	files     map[string]*File
+	uploads   int
+	retrieves int
+}
+
+func newFilesServer(t *testing.T) (*Engine, *filesServer) {
+	s := &filesServer{files: make(map[string]*File)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if r.Method == http.MethodPost && r.URL.Path == "/files" {
+			file, header, err := r.FormFile("file")
+			require.NoError(t, err)
+			n, err := io.Copy(io.Discard, file)
+			require.NoError(t, err)
+			s.uploads++
+			f := &File{Id: fmt.Sprintf("file-%d", s.uploads), Object: "file", Bytes: n, Filename: header.Filename, Purpose: r.FormValue("purpose")}
+			s.files[f.Id] = f
+			json.NewEncoder(w).Encode(f)
+			return
+		}
+		s.retrieves++
+		f, ok := s.files[strings.TrimPrefix(r.URL.Path, "/files/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(notFoundBody))
+			return
+		}
+		json.NewEncoder(w).Encode(f)
+	}))
+	t.Cleanup(srv.Close)
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	return e, s
+}
+
+func (s *filesServer) delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, id)
+}
+
+func (s *filesServer) counts() (uploads, retrieves int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.uploads, s.retrieves
+}
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+const batchContent = `{"custom_id":"1","method":"POST","url":"/v1/chat/completions","body":{}}` + "\n"
+
+func uploadBatch(e *Engine, r io.Reader) (*File, error) {
+	return e.UploadFile(context.Background(), &UploadFileOptions{File: r, Filename: "batch.jsonl", Purpose: FilePurposeBatch})
+}
+
+func TestUploadFileDedupHit(t *testing.T) {
+	e, srv := newFilesServer(t)
+	index := NewMemoryUploadIndex()
+	WithUploadIndex(index)(e)
+
+	first, err := uploadBatch(e, strings.NewReader(batchContent))
+	require.NoError(t, err)
+	id, ok, err := index.Get(context.Background(), UploadKey{Hash: sha256Hex(batchContent), Purpose: FilePurposeBatch})
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, first.Id, id)
+
+	path := filepath.Join(t.TempDir(), "batch.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(batchContent), 0o600))
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	second, err := uploadBatch(e, file)
+	require.NoError(t, err)
+	assert.Equal(t, first, second, "the seekable content is deduplicated")
+
+	// The pipe is buffered, so it's hashed before the upload
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte(batchContent))
+		pw.Close()
+	}()
+	third, err := uploadBatch(e, pr)
+	require.NoError(t, err)
+	assert.Equal(t, first, third, "the piped content is deduplicated")
+
+	uploads, retrieves := srv.counts()
+	assert.Equal(t, 1, uploads)
+	assert.Equal(t, 2, retrieves, "the indexed file is verified")
+}
+
+func TestUploadFileDedupMiss(t *testing.T) {
+	e, srv := newFilesServer(t)
+	e.uploadIndex = NewMemoryUploadIndex()
+
+	first, err := uploadBatch(e, strings.NewReader(batchContent))
+	require.NoError(t, err)
+	second, err := uploadBatch(e, strings.NewReader(batchContent+batchContent))
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Id, second.Id)
+	third, err := e.UploadFile(context.Background(), &UploadFileOptions{File: strings.NewReader(batchContent), Filename: "batch.jsonl", Purpose: FilePurposeFineTune})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Id, third.Id, "the index is keyed by the purpose")
+
+	uploads, retrieves := srv.counts()
+	assert.Equal(t, 3, uploads)
+	assert.Zero(t, retrieves)
+}
+
+func TestUploadFileDedupStaleEntry(t *testing.T) {
+	e, srv := newFilesServer(t)
+	index := NewMemoryUploadIndex()
+	e.uploadIndex = index
+	key := UploadKey{Hash: sha256Hex(batchContent), Purpose: FilePurposeBatch}
+
+	first, err := uploadBatch(e, strings.NewReader(batchContent))
+	require.NoError(t, err)
+	srv.delete(first.Id)
+
+	second, err := uploadBatch(e, strings.NewReader(batchContent))
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Id, second.Id, "the deleted file is uploaded again")
+	id, _, _ := index.Get(context.Background(), key)
+	assert.Equal(t, second.Id, id)
+
+	// The file of the entry doesn't match the size of the content
+	srv.mu.Lock()
+	srv.files[second.Id].Bytes++
+	srv.mu.Unlock()
+	third, err := uploadBatch(e, strings.NewReader(batchContent))
+	require.NoError(t, err)
+	assert.NotEqual(t, second.Id, third.Id)
+
+	uploads, retrieves := srv.counts()
+	assert.Equal(t, 3, uploads)
+	assert.Equal(t, 2, retrieves)
+}
+
+func TestUploadFileDedupForceUpload(t *testing.T) {
+	e, srv := newFilesServer(t)
+	index := NewMemoryUploadIndex()
+	e.uploadIndex = index
+
+	first, err := uploadBatch(e, strings.NewReader(batchContent))
+	require.NoError(t, err)
+	second, err := e.UploadFile(context.Background(), &UploadFileOptions{File: strings.NewReader(batchContent), Filename: "batch.jsonl", Purpose: FilePurposeBatch, ForceUpload: true})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Id, second.Id)
+	id, _, _ := index.Get(context.Background(), UploadKey{Hash: sha256Hex(batchContent), Purpose: FilePurposeBatch})
+	assert.Equal(t, second.Id, id, "the uploaded file replaces the indexed one")
+
+	uploads, retrieves := srv.counts()
+	assert.Equal(t, 2, uploads)
+	assert.Zero(t, retrieves)
+}
+
+func TestUploadFileDedupStreamed(t *testing.T) {
+	e, srv := newFilesServer(t)
+	index := NewMemoryUploadIndex()
+	e.uploadIndex = index
+	e.SetMultipartBufferSize(16)
+
+	content := strings.Repeat(batchContent, 4)
+	// The reader isn't seekable and is bigger than the buffer, so it's hashed while it's sent
+	upload := func() *File {
+		f, err := uploadBatch(e, io.MultiReader(bytes.NewReader([]byte(content))))
+		require.NoError(t, err)
+		return f
+	}
+	first := upload()
+	id, ok, _ := index.Get(context.Background(), UploadKey{Hash: sha256Hex(content), Purpose: FilePurposeBatch})
+	assert.True(t, ok, "the streamed content is indexed")
+	assert.Equal(t, first.Id, id)
+	assert.NotEqual(t, first.Id, upload().Id, "the streamed content isn't deduplicated")
+
+	uploads, _ := srv.counts()
+	assert.Equal(t, 2, uploads)
+}
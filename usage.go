@@ -0,0 +1,129 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"strings"
+	"sync"
+)
+
+// modelPrice is the price of the model in USD per 1M tokens.
+type modelPrice struct {
+	input, cached, output float64
+}
+
+// modelPrices are the prices of the models by model prefix. The longest matching prefix applies.
+//
+// Learn more: https://openai.com/api/pricing
+var modelPrices = map[string]modelPrice{
+	"gpt-4o":                 {2.50, 1.25, 10.00},
+	"gpt-4o-mini":            {0.15, 0.075, 0.60},
+	"gpt-4.1":                {2.00, 0.50, 8.00},
+	"gpt-4.1-mini":           {0.40, 0.10, 1.60},
+	"gpt-4.1-nano":           {0.10, 0.025, 0.40},
+	"o1":                     {15.00, 7.50, 60.00},
+	"o1-mini":                {1.10, 0.55, 4.40},
+	"o3":                     {2.00, 0.50, 8.00},
+	"o3-mini":                {1.10, 0.55, 4.40},
+	"o4-mini":                {1.10, 0.275, 4.40},
+	"text-embedding-3-small": {0.02, 0.02, 0},
+	"text-embedding-3-large": {0.13, 0.13, 0},
+	"text-embedding-ada-002": {0.10, 0.10, 0},
+}
+
+// modelPriceOf returns the price of the model, ok is false if the model isn't known.
+func modelPriceOf(model Model) (price modelPrice, ok bool) {
+	var prefix string
+	for p := range modelPrices {
+		if strings.HasPrefix(string(model), p) && len(p) > len(prefix) {
+			prefix = p
+		}
+	}
+	price, ok = modelPrices[prefix]
+	return price, ok
+}
+
+// estimatedCost returns the cost of the usage in USD, zero if the model isn't known.
+// The cached prompt tokens are charged at the discounted price.
+func estimatedCost(model Model, usage Usage) float64 {
+	price, ok := modelPriceOf(model)
+	if !ok {
+		return 0
+	}
+	cached := usage.CachedTokens()
+	return (float64(usage.PromptTokens-cached)*price.input +
+		float64(cached)*price.cached +
+		float64(usage.CompletionTokens)*price.output) / 1e6
+}
+
+// AggregatedUsage is the cumulative token usage of the model.
+type AggregatedUsage struct {
+	// Requests is the number of responses the usage was added from.
+	Requests              int64
+	TotalPromptTokens     int64
+	TotalCompletionTokens int64
+	TotalTokens           int64
+	// EstimatedCostUSD is estimated by the public prices of the models, including the discount
+	// of the cached prompt tokens. It's zero for the models of the unknown pricing, e.g. the
+	// fine-tuned ones.
+	EstimatedCostUSD float64
+}
+
+// add returns the sum of the usages.
+func (u AggregatedUsage) add(other AggregatedUsage) AggregatedUsage {
+	u.Requests += other.Requests
+	u.TotalPromptTokens += other.TotalPromptTokens
+	u.TotalCompletionTokens += other.TotalCompletionTokens
+	u.TotalTokens += other.TotalTokens
+	u.EstimatedCostUSD += other.EstimatedCostUSD
+	return u
+}
+
+// UsageAggregator is used to track the cumulative token usage by model across the API calls,
+// e.g. for cost reporting. It's safe for concurrent use, the zero value is ready to use.
+type UsageAggregator struct {
+	mu    sync.Mutex
+	usage map[Model]AggregatedUsage
+}
+
+// Add is used to add the usage of the response of the model.
+func (a *UsageAggregator) Add(model Model, usage Usage) {
+	total := usage.TotalTokens
+	if total == 0 {
+		total = usage.PromptTokens + usage.CompletionTokens
+	}
+	cost := estimatedCost(model, usage)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.usage == nil {
+		a.usage = make(map[Model]AggregatedUsage)
+	}
+	a.usage[model] = a.usage[model].add(AggregatedUsage{
+		Requests:              1,
+		TotalPromptTokens:     int64(usage.PromptTokens),
+		TotalCompletionTokens: int64(usage.CompletionTokens),
+		TotalTokens:           int64(total),
+		EstimatedCostUSD:      cost,
+	})
+}
+
+// Summary returns the snapshot of the usage by model.
+func (a *UsageAggregator) Summary() map[Model]AggregatedUsage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	summary := make(map[Model]AggregatedUsage, len(a.usage))
+	for model, u := range a.usage {
+		summary[model] = u
+	}
+	return summary
+}
+
+// WithUsageAggregation is used to add the usage of every successful chat completion, completion,
+// edit and embedding response to the aggregator, by the model of the request. The aggregator
+// may be shared by multiple engines, and it's shared with the clones of the engine.
+func WithUsageAggregation(agg *UsageAggregator) EngineOption {
+	return func(e *Engine) {
+		e.usageAggregator = agg
+	}
+}
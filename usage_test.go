@@ -0,0 +1,78 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageAggregator(t *testing.T) {
+	var agg UsageAggregator
+	assert.Empty(t, agg.Summary())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			agg.Add("gpt-4o-2024-08-06", Usage{PromptTokens: 2000, CompletionTokens: 100, TotalTokens: 2100,
+				PromptTokensDetails: &PromptTokensDetails{CachedTokens: 1024}})
+		}()
+	}
+	wg.Wait()
+	agg.Add("ft:gpt-3.5-turbo:acme", Usage{PromptTokens: 10, CompletionTokens: 5})
+
+	summary := agg.Summary()
+	require.Len(t, summary, 2)
+	u := summary["gpt-4o-2024-08-06"]
+	assert.Equal(t, int64(100), u.Requests)
+	assert.Equal(t, int64(200000), u.TotalPromptTokens)
+	assert.Equal(t, int64(10000), u.TotalCompletionTokens)
+	assert.Equal(t, int64(210000), u.TotalTokens)
+	assert.InDelta(t, 100*(976*2.50+1024*1.25+100*10.00)/1e6, u.EstimatedCostUSD, 1e-9, "the cached tokens are discounted")
+	assert.Equal(t, AggregatedUsage{Requests: 1, TotalPromptTokens: 10, TotalCompletionTokens: 5, TotalTokens: 15},
+		summary["ft:gpt-3.5-turbo:acme"], "the model of the unknown pricing costs nothing")
+
+	summary["gpt-4o-2024-08-06"] = AggregatedUsage{}
+	assert.Equal(t, int64(100), agg.Summary()["gpt-4o-2024-08-06"].Requests, "the snapshot must be returned")
+}
+
+func TestWithUsageAggregation(t *testing.T) {
+	var fail bool
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"invalid request","type":"invalid_request_error"}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"}}],` +
+			`"usage":{"prompt_tokens":1000,"completion_tokens":500,"total_tokens":1500}}`))
+	})
+	agg := &UsageAggregator{}
+	e := New("test", WithUsageAggregation(agg))
+	e.apiBaseURL = srv.URL
+	clone, err := e.Clone()
+	require.NoError(t, err)
+
+	opts := testChatOptions()
+	opts.Model = "gpt-4o-mini"
+	_, err = e.ChatCompletion(context.Background(), opts)
+	require.NoError(t, err)
+	_, err = clone.ChatCompletion(context.Background(), opts)
+	require.NoError(t, err)
+	fail = true
+	_, err = e.ChatCompletion(context.Background(), opts)
+	require.Error(t, err)
+
+	u := agg.Summary()["gpt-4o-mini"]
+	assert.Equal(t, int64(2), u.Requests, "the failed response isn't counted")
+	assert.Equal(t, int64(3000), u.TotalTokens)
+	assert.InDelta(t, 2*(1000*0.15+500*0.60)/1e6, u.EstimatedCostUSD, 1e-12)
+}
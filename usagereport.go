@@ -0,0 +1,204 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Widths of the time buckets of the usage.
+const (
+	UsageBucketMinute = "1m"
+	UsageBucketHour   = "1h"
+	UsageBucketDay    = "1d"
+)
+
+// UsageQueryOptions is the query of the usage of the organization.
+type UsageQueryOptions struct {
+	// The start of the time range, inclusive.
+	StartTime time.Time `binding:"required"`
+	// The end of the time range, exclusive. The usage up to now is returned if it's zero.
+	EndTime time.Time
+	// The width of the time buckets, one of UsageBucketMinute, UsageBucketHour and UsageBucketDay.
+	// The API default, UsageBucketDay, is used if it's empty.
+	BucketWidth string `binding:"omitempty,oneof=1m 1h 1d"`
+	// Only return the usage of the project.
+	ProjectId string
+	// The fields to group the usage of every bucket by, e.g. "project_id" and "model".
+	GroupBy []string
+	// The number of buckets per page. The API default is used if it's zero.
+	Limit int `binding:"omitempty,min=1"`
+	// The cursor of the page, UsagePage.NextPage of the previous page.
+	Page string
+}
+
+func (o *UsageQueryOptions) query() url.Values {
+	q := url.Values{
+		"start_time": {strconv.FormatInt(o.StartTime.Unix(), 10)},
+	}
+	if !o.EndTime.IsZero() {
+		q["end_time"] = []string{strconv.FormatInt(o.EndTime.Unix(), 10)}
+	}
+	if o.BucketWidth != "" {
+		q["bucket_width"] = []string{o.BucketWidth}
+	}
+	if o.ProjectId != "" {
+		q["project_ids"] = []string{o.ProjectId}
+	}
+	if len(o.GroupBy) != 0 {
+		q["group_by"] = o.GroupBy
+	}
+	if o.Limit != 0 {
+		q["limit"] = []string{strconv.Itoa(o.Limit)}
+	}
+	if o.Page != "" {
+		q["page"] = []string{o.Page}
+	}
+	return q
+}
+
+// UsagePage is the page of the time buckets of the usage.
+type UsagePage struct {
+	Object string        `json:"object"`
+	Data   []UsageBucket `json:"data"`
+	// HasMore is true if there are more buckets, request them with NextPage.
+	HasMore  bool   `json:"has_more"`
+	NextPage string `json:"next_page,omitempty"`
+}
+
+// Summary returns the usage of all the buckets of the page, see UsageBucket.Summary.
+func (p *UsagePage) Summary() AggregatedUsage {
+	var summary AggregatedUsage
+	for _, b := range p.Data {
+		summary = summary.add(b.Summary())
+	}
+	return summary
+}
+
+// UsageBucket is the usage in the time range, grouped as requested by UsageQueryOptions.GroupBy.
+type UsageBucket struct {
+	Object string `json:"object"`
+	// The Unix timestamps of the time range, the end is exclusive.
+	StartTime int64         `json:"start_time"`
+	EndTime   int64         `json:"end_time"`
+	Results   []UsageResult `json:"results"`
+}
+
+// Summary returns the usage of all the results of the bucket. The cost is estimated for the
+// results of the known models, so the usage must be grouped by model to estimate it.
+func (b *UsageBucket) Summary() AggregatedUsage {
+	var summary AggregatedUsage
+	for _, r := range b.Results {
+		summary = summary.add(AggregatedUsage{
+			Requests:              r.NumModelRequests,
+			TotalPromptTokens:     r.InputTokens,
+			TotalCompletionTokens: r.OutputTokens,
+			TotalTokens:           r.InputTokens + r.OutputTokens,
+			EstimatedCostUSD:      r.EstimatedCostUSD(),
+		})
+	}
+	return summary
+}
+
+// UsageResult is the usage of the group of the bucket. The fields of the usage depend
+// on the endpoint, e.g. the tokens are reported for the completions and the embeddings,
+// and the images for the images. The fields of the group are only set if the usage
+// is grouped by them.
+type UsageResult struct {
+	Object string `json:"object"`
+	// The number of requests.
+	NumModelRequests int64 `json:"num_model_requests"`
+	// The tokens of the completions, the embeddings and the moderations. The input
+	// tokens include the cached and the audio ones.
+	InputTokens       int64 `json:"input_tokens,omitempty"`
+	OutputTokens      int64 `json:"output_tokens,omitempty"`
+	InputCachedTokens int64 `json:"input_cached_tokens,omitempty"`
+	InputAudioTokens  int64 `json:"input_audio_tokens,omitempty"`
+	OutputAudioTokens int64 `json:"output_audio_tokens,omitempty"`
+	// The number of the generated images.
+	Images int64 `json:"images,omitempty"`
+	// The number of the characters of the speeches.
+	Characters int64 `json:"characters,omitempty"`
+	// The number of the seconds of the transcribed audio.
+	Seconds int64 `json:"seconds,omitempty"`
+
+	ProjectId string `json:"project_id,omitempty"`
+	UserId    string `json:"user_id,omitempty"`
+	APIKeyId  string `json:"api_key_id,omitempty"`
+	Model     Model  `json:"model,omitempty"`
+	// Whether the usage is of the batch requests, nil if it isn't grouped by batch.
+	Batch *bool `json:"batch,omitempty"`
+	// The source and the size of the images, e.g. "image.generation" and "1024x1024".
+	Source string `json:"source,omitempty"`
+	Size   string `json:"size,omitempty"`
+}
+
+// EstimatedCostUSD returns the cost of the tokens estimated by the public prices of the model,
+// including the discount of the cached input tokens. It's zero if the model isn't known.
+func (r UsageResult) EstimatedCostUSD() float64 {
+	return estimatedCost(r.Model, Usage{
+		PromptTokens:        int(r.InputTokens),
+		CompletionTokens:    int(r.OutputTokens),
+		PromptTokensDetails: &PromptTokensDetails{CachedTokens: int(r.InputCachedTokens)},
+	})
+}
+
+// ListCompletionUsage returns the page of the usage of the completions of the organization.
+//
+// Docs: https://platform.openai.com/docs/api-reference/usage/completions
+func (e *Engine) ListCompletionUsage(ctx context.Context, opts *UsageQueryOptions) (*UsagePage, error) {
+	return e.listUsage(ctx, "/organization/usage/completions", opts)
+}
+
+// ListEmbeddingUsage returns the page of the usage of the embeddings of the organization.
+//
+// Docs: https://platform.openai.com/docs/api-reference/usage/embeddings
+func (e *Engine) ListEmbeddingUsage(ctx context.Context, opts *UsageQueryOptions) (*UsagePage, error) {
+	return e.listUsage(ctx, "/organization/usage/embeddings", opts)
+}
+
+// ListModerationUsage returns the page of the usage of the moderations of the organization.
+//
+// Docs: https://platform.openai.com/docs/api-reference/usage/moderations
+func (e *Engine) ListModerationUsage(ctx context.Context, opts *UsageQueryOptions) (*UsagePage, error) {
+	return e.listUsage(ctx, "/organization/usage/moderations", opts)
+}
+
+// ListImageUsage returns the page of the usage of the images of the organization.
+//
+// Docs: https://platform.openai.com/docs/api-reference/usage/images
+func (e *Engine) ListImageUsage(ctx context.Context, opts *UsageQueryOptions) (*UsagePage, error) {
+	return e.listUsage(ctx, "/organization/usage/images", opts)
+}
+
+// ListAudioSpeechUsage returns the page of the usage of the speeches of the organization.
+//
+// Docs: https://platform.openai.com/docs/api-reference/usage/audio_speeches
+func (e *Engine) ListAudioSpeechUsage(ctx context.Context, opts *UsageQueryOptions) (*UsagePage, error) {
+	return e.listUsage(ctx, "/organization/usage/audio_speeches", opts)
+}
+
+// ListAudioTranscriptionUsage returns the page of the usage of the transcriptions of the organization.
+//
+// Docs: https://platform.openai.com/docs/api-reference/usage/audio_transcriptions
+func (e *Engine) ListAudioTranscriptionUsage(ctx context.Context, opts *UsageQueryOptions) (*UsagePage, error) {
+	return e.listUsage(ctx, "/organization/usage/audio_transcriptions", opts)
+}
+
+func (e *Engine) listUsage(ctx context.Context, endpoint string, opts *UsageQueryOptions) (*UsagePage, error) {
+	if err := e.validate.ValidateCtx(ctx, opts); err != nil {
+		return nil, err
+	}
+	uri := withQuery(e.apiBaseURL+endpoint, opts.query())
+	ctx = withRequestInfo(ctx, endpoint, "")
+	var page UsagePage
+	if err := e.sendJSON(ctx, http.MethodGet, uri, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListCompletionUsage(t *testing.T) {
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/organization/usage/completions", r.URL.Path)
+		assert.Equal(t, "Bearer sk-admin", r.Header.Get("Authorization"))
+		query = r.URL.Query()
+		w.Write([]byte(`{"object":"page","has_more":true,"next_page":"page_AAAA","data":[
+			{"object":"bucket","start_time":1730419200,"end_time":1730505600,"results":[
+				{"object":"organization.usage.completions.result","input_tokens":2000000,"output_tokens":500000,
+					"input_cached_tokens":1000000,"num_model_requests":30,"project_id":"proj_1","model":"gpt-4o-2024-08-06","batch":null},
+				{"object":"organization.usage.completions.result","input_tokens":1000,"output_tokens":100,
+					"num_model_requests":2,"project_id":"proj_1","model":"ft:gpt-4o:acme::abc"}]},
+			{"object":"bucket","start_time":1730505600,"end_time":1730592000,"results":[
+				{"object":"organization.usage.completions.result","input_tokens":1000000,"output_tokens":0,
+					"num_model_requests":8,"project_id":"proj_1","model":"gpt-4o-mini"}]}]}`))
+	}))
+	defer srv.Close()
+	e := New("sk-project", WithAdminAPIKey("sk-admin"))
+	e.apiBaseURL = srv.URL
+
+	page, err := e.ListCompletionUsage(context.Background(), &UsageQueryOptions{
+		StartTime:   time.Unix(1730419200, 0),
+		EndTime:     time.Unix(1730592000, 0),
+		BucketWidth: UsageBucketDay,
+		ProjectId:   "proj_1",
+		GroupBy:     []string{"project_id", "model"},
+		Limit:       2,
+		Page:        "page_0",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{
+		"start_time":   {"1730419200"},
+		"end_time":     {"1730592000"},
+		"bucket_width": {"1d"},
+		"project_ids":  {"proj_1"},
+		"group_by":     {"project_id", "model"},
+		"limit":        {"2"},
+		"page":         {"page_0"},
+	}, query)
+	assert.True(t, page.HasMore)
+	assert.Equal(t, "page_AAAA", page.NextPage)
+	require.Len(t, page.Data, 2)
+	assert.Equal(t, int64(1730505600), page.Data[0].EndTime)
+	assert.Equal(t, Model("gpt-4o-2024-08-06"), page.Data[0].Results[0].Model)
+	assert.Nil(t, page.Data[0].Results[0].Batch)
+
+	// 1M tokens at 2.50, 1M cached at 1.25 and 0.5M output at 10.00
+	assert.InDelta(t, 8.75, page.Data[0].Results[0].EstimatedCostUSD(), 1e-9)
+	assert.Zero(t, page.Data[0].Results[1].EstimatedCostUSD(), "the price of the fine-tuned model isn't known")
+	summary := page.Data[0].Summary()
+	assert.Equal(t, AggregatedUsage{
+		Requests:              32,
+		TotalPromptTokens:     2001000,
+		TotalCompletionTokens: 500100,
+		TotalTokens:           2501100,
+		EstimatedCostUSD:      summary.EstimatedCostUSD,
+	}, summary)
+	assert.InDelta(t, 8.75, summary.EstimatedCostUSD, 1e-9)
+	summary = page.Summary()
+	assert.Equal(t, int64(40), summary.Requests)
+	assert.Equal(t, int64(3501100), summary.TotalTokens)
+	assert.InDelta(t, 8.90, summary.EstimatedCostUSD, 1e-9)
+}
+
+func TestListUsageEndpoints(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		assert.Equal(t, url.Values{"start_time": {"1730419200"}}, r.URL.Query())
+		w.Write([]byte(`{"object":"page","data":[{"object":"bucket","start_time":1730419200,"end_time":1730505600,"results":[
+			{"object":"organization.usage.images.result","images":3,"seconds":20,"characters":120,"num_model_requests":2,"source":"image.generation","size":"1024x1024"}]}]}`))
+	}))
+	defer srv.Close()
+	e := New("sk-admin")
+	e.apiBaseURL = srv.URL
+
+	opts := &UsageQueryOptions{StartTime: time.Unix(1730419200, 0)}
+	for _, list := range []func(context.Context, *UsageQueryOptions) (*UsagePage, error){
+		e.ListEmbeddingUsage,
+		e.ListModerationUsage,
+		e.ListImageUsage,
+		e.ListAudioSpeechUsage,
+		e.ListAudioTranscriptionUsage,
+	} {
+		page, err := list(context.Background(), opts)
+		require.NoError(t, err)
+		require.Len(t, page.Data, 1)
+		assert.Equal(t, UsageResult{Object: "organization.usage.images.result", NumModelRequests: 2, Images: 3, Seconds: 20,
+			Characters: 120, Source: "image.generation", Size: "1024x1024"}, page.Data[0].Results[0])
+	}
+	assert.Equal(t, []string{
+		"/organization/usage/embeddings",
+		"/organization/usage/moderations",
+		"/organization/usage/images",
+		"/organization/usage/audio_speeches",
+		"/organization/usage/audio_transcriptions",
+	}, paths)
+
+	_, err := e.ListCompletionUsage(context.Background(), &UsageQueryOptions{})
+	assert.Error(t, err, "the start time is required")
+	_, err = e.ListCompletionUsage(context.Background(), &UsageQueryOptions{StartTime: time.Unix(1730419200, 0), BucketWidth: "1w"})
+	assert.Error(t, err)
+	assert.Len(t, paths, 5, "the invalid queries aren't sent")
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Validator is used to validate options of requests before they are sent.
+// The returned error is returned by the request method as is.
+type Validator interface {
+	ValidateCtx(ctx context.Context, v interface{}) error
+}
+
+// WithValidator is used to replace the default validator, which validates options
+// by their binding tags with go-playground/validator.
+func WithValidator(v Validator) EngineOption {
+	return func(e *Engine) {
+		e.validate = v
+	}
+}
+
+// bindingValidator validates structs by their binding tags.
+type bindingValidator struct {
+	validate *validator.Validate
+}
+
+func newBindingValidator() *bindingValidator {
+	v := validator.New()
+	v.SetTagName("binding")
+	return &bindingValidator{validate: v}
+}
+
+func (v *bindingValidator) ValidateCtx(ctx context.Context, s interface{}) error {
+	return v.validate.StructCtx(ctx, s)
+}
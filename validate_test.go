@@ -0,0 +1,51 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type validatorFunc func(ctx context.Context, v interface{}) error
+
+func (f validatorFunc) ValidateCtx(ctx context.Context, v interface{}) error {
+	return f(ctx, v)
+}
+
+func TestWithValidator(t *testing.T) {
+	srv := newChatTestServer(t, nil)
+	errNoTemperature := errors.New("temperature is required")
+	var validated interface{}
+	e := New("test", WithValidator(validatorFunc(func(ctx context.Context, v interface{}) error {
+		validated = v
+		if opts, ok := v.(*ChatCompletionOptions); ok && opts.Temperature == 0 {
+			return errNoTemperature
+		}
+		return nil
+	})))
+	e.apiBaseURL = srv.URL
+
+	opts := testChatOptions()
+	_, err := e.ChatCompletion(context.Background(), opts)
+	assert.Equal(t, errNoTemperature, err)
+	assert.Same(t, opts, validated)
+
+	// The binding tags aren't validated by the custom validator
+	opts = &ChatCompletionOptions{Temperature: 0.5}
+	_, err = e.ChatCompletion(context.Background(), opts)
+	require.NoError(t, err)
+}
+
+func TestDefaultValidator(t *testing.T) {
+	e := New("test")
+	_, err := e.ChatCompletion(context.Background(), &ChatCompletionOptions{})
+	var errs validator.ValidationErrors
+	assert.ErrorAs(t, err, &errs)
+}
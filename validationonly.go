@@ -0,0 +1,395 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrCodeLocalValidation is the code of APIError returned for requests rejected by
+// ValidationOnlyTransport.
+const ErrCodeLocalValidation = "local_validation_failed"
+
+// ValidationOnlyTransport is the http.RoundTripper which doesn't send requests. It checks
+// the body of every request against the rules of its endpoint and answers with the canned
+// response, so the code building requests can be exercised in CI without the network, going
+// through the same validation, defaulting, marshaling and header assembly of engine as real requests.
+//
+// Requests violating the rules are answered with 400 Bad Request, which is returned by the
+// request method as APIError with ErrCodeLocalValidation code and the message naming the
+// offending field, e.g. "tools[0].function.parameters.type: must be \"object\"".
+//
+// The checks cover the mistakes the API rejects most often, they are not the full schema of the API.
+type ValidationOnlyTransport struct {
+	mu        sync.Mutex
+	responses map[string]cannedResponse
+}
+
+type cannedResponse struct {
+	statusCode  int
+	contentType string
+	body        string
+}
+
+// NewValidationOnlyTransport is used to initialize the transport with the minimal successful
+// responses of the endpoints.
+func NewValidationOnlyTransport() *ValidationOnlyTransport {
+	return &ValidationOnlyTransport{responses: make(map[string]cannedResponse)}
+}
+
+// WithValidationOnly is used to make engine answer requests with t instead of sending them.
+func WithValidationOnly(t *ValidationOnlyTransport) EngineOption {
+	return func(e *Engine) {
+		e.client = &http.Client{Transport: t}
+	}
+}
+
+// SetResponse is used to set the response returned for valid requests of the endpoint, e.g.
+// "/chat/completions" or "/files/{id}", instead of the default one. The body is sent as JSON,
+// unless it starts with "data:", then it's sent as the event stream. The successful JSON response
+// isn't used for streamed requests, they are answered with the empty event stream instead.
+func (t *ValidationOnlyTransport) SetResponse(endpoint string, statusCode int, body string) {
+	contentType := "application/json"
+	if strings.HasPrefix(body, "data:") {
+		contentType = "text/event-stream"
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.responses[endpoint] = cannedResponse{statusCode: statusCode, contentType: contentType, body: body}
+}
+
+func (t *ValidationOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := requestInfoFrom(req.Context()).endpoint
+	if endpoint == "" {
+		endpoint = req.URL.Path
+	}
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+	var doc interface{}
+	if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType == "application/json" && len(body) != 0 {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return validationOnlyResponse(req, cannedError(fmt.Sprintf("body: invalid JSON: %v", err))), nil
+		}
+		for _, rule := range requestRules[endpoint] {
+			if violation := rule.violation(doc); violation != "" {
+				return validationOnlyResponse(req, cannedError(violation)), nil
+			}
+		}
+	}
+	t.mu.Lock()
+	canned, ok := t.responses[endpoint]
+	t.mu.Unlock()
+	if ok && isStreamRequest(doc) && canned.statusCode < 300 && canned.contentType != "text/event-stream" {
+		ok = false // the response is set for requests which aren't streamed
+	}
+	if !ok {
+		canned = defaultCannedResponse(endpoint, doc)
+	}
+	return validationOnlyResponse(req, canned), nil
+}
+
+func validationOnlyResponse(req *http.Request, canned cannedResponse) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", canned.statusCode, http.StatusText(canned.statusCode)),
+		StatusCode:    canned.statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {canned.contentType}, "X-Request-Id": {"req_validation_only"}},
+		Body:          io.NopCloser(strings.NewReader(canned.body)),
+		ContentLength: int64(len(canned.body)),
+		Request:       req,
+	}
+}
+
+func cannedError(message string) cannedResponse {
+	var apiErr APIError
+	apiErr.Err.StatusCode = http.StatusBadRequest
+	apiErr.Err.Message = message
+	apiErr.Err.Type = "invalid_request_error"
+	apiErr.Err.Code = ErrCodeLocalValidation
+	b, _ := json.Marshal(apiErr)
+	return cannedResponse{statusCode: http.StatusBadRequest, contentType: "application/json", body: string(b)}
+}
+
+// defaultCannedResponse returns the minimal successful response of the endpoint.
+func defaultCannedResponse(endpoint string, doc interface{}) cannedResponse {
+	if isStreamRequest(doc) {
+		return cannedResponse{statusCode: http.StatusOK, contentType: "text/event-stream", body: "data: [DONE]\n\n"}
+	}
+	body := "{}"
+	switch endpoint {
+	case "/chat/completions":
+		body = `{"id":"chatcmpl-validation-only","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":""},"finish_reason":"stop"}],"usage":{}}`
+	case "/completions":
+		body = `{"id":"cmpl-validation-only","object":"text_completion","choices":[{"index":0,"text":"","finish_reason":"stop"}],"usage":{}}`
+	case "/embeddings":
+		body = `{"object":"list","data":[],"usage":{}}`
+	case "/models":
+		body = `{"object":"list","data":[]}`
+	}
+	return cannedResponse{statusCode: http.StatusOK, contentType: "application/json", body: body}
+}
+
+func isStreamRequest(doc interface{}) bool {
+	fields, ok := doc.(map[string]interface{})
+	return ok && fields["stream"] == true
+}
+
+// requestRule checks the value of the field at path of the request body. The path is
+// dotted, "[]" stands for every element of the array, e.g. "messages.[].role".
+type requestRule struct {
+	path     string
+	required bool
+	check    func(v interface{}) string
+}
+
+// violation returns the description of the first value violating the rule, empty if there is none.
+func (r requestRule) violation(doc interface{}) string {
+	return r.violationAt(doc, strings.Split(r.path, "."), "")
+}
+
+func (r requestRule) violationAt(v interface{}, path []string, at string) string {
+	if len(path) == 0 {
+		switch {
+		case v == nil && r.required:
+			return at + ": is required"
+		case v == nil:
+			return ""
+		}
+		if r.check == nil {
+			return ""
+		}
+		if reason := r.check(v); reason != "" {
+			return at + ": " + reason
+		}
+		return ""
+	}
+	if path[0] == "[]" {
+		items, _ := v.([]interface{})
+		for i, item := range items {
+			if violation := r.violationAt(item, path[1:], fmt.Sprintf("%s[%d]", at, i)); violation != "" {
+				return violation
+			}
+		}
+		return ""
+	}
+	fields, ok := v.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if at != "" {
+		at += "."
+	}
+	return r.violationAt(fields[path[0]], path[1:], at+path[0])
+}
+
+// requestRules are the rules of the request bodies by endpoint.
+var requestRules = map[string][]requestRule{
+	"/chat/completions": {
+		{path: "model", required: true, check: isNonEmptyString},
+		{path: "messages", required: true, check: isNonEmptyArray},
+		{path: "messages.[].role", required: true, check: isOneOf("system", "developer", "user", "assistant", "tool", "function")},
+		{path: "metadata", check: isMetadata},
+		{path: "tools", check: hasMaxItems(128)},
+		{path: "tools.[].type", required: true, check: isOneOf("function")},
+		{path: "tools.[].function", required: true},
+		{path: "tools.[].function.name", required: true, check: matches(functionNamePattern)},
+		{path: "tools.[].function.parameters", check: isObjectSchema},
+	},
+	"/completions": {
+		{path: "model", required: true, check: isNonEmptyString},
+	},
+	"/embeddings": {
+		{path: "model", required: true, check: isNonEmptyString},
+		{path: "input", required: true, check: isNonEmptyArray},
+		{path: "input", check: hasMaxItems(maxEmbeddingsInputs)},
+	},
+	"/moderations": {
+		{path: "input", required: true},
+	},
+	"/images/generations": {
+		{path: "prompt", required: true, check: isNonEmptyString},
+	},
+}
+
+var functionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+const (
+	maxMetadataPairs       = 16
+	maxMetadataKeyLength   = 64
+	maxMetadataValueLength = 512
+)
+
+func isNonEmptyString(v interface{}) string {
+	if s, ok := v.(string); !ok || s == "" {
+		return "must be a non-empty string"
+	}
+	return ""
+}
+
+func isNonEmptyArray(v interface{}) string {
+	if items, ok := v.([]interface{}); !ok || len(items) == 0 {
+		return "must be a non-empty array"
+	}
+	return ""
+}
+
+func hasMaxItems(n int) func(v interface{}) string {
+	return func(v interface{}) string {
+		if items, ok := v.([]interface{}); ok && len(items) > n {
+			return fmt.Sprintf("must have at most %d items, got %d", n, len(items))
+		}
+		return ""
+	}
+}
+
+func isOneOf(values ...string) func(v interface{}) string {
+	return func(v interface{}) string {
+		s, _ := v.(string)
+		for _, value := range values {
+			if s == value {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of %q", values)
+	}
+}
+
+func matches(pattern *regexp.Regexp) func(v interface{}) string {
+	return func(v interface{}) string {
+		if s, ok := v.(string); !ok || !pattern.MatchString(s) {
+			return fmt.Sprintf("must match %s", pattern)
+		}
+		return ""
+	}
+}
+
+func isMetadata(v interface{}) string {
+	fields, ok := v.(map[string]interface{})
+	if !ok {
+		return "must be an object"
+	}
+	if len(fields) > maxMetadataPairs {
+		return fmt.Sprintf("must have at most %d pairs, got %d", maxMetadataPairs, len(fields))
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, ok := fields[key].(string)
+		switch {
+		case len(key) > maxMetadataKeyLength:
+			return fmt.Sprintf("key %q must be at most %d characters", key, maxMetadataKeyLength)
+		case !ok:
+			return fmt.Sprintf("value of %q must be a string", key)
+		case len(value) > maxMetadataValueLength:
+			return fmt.Sprintf("value of %q must be at most %d characters", key, maxMetadataValueLength)
+		}
+	}
+	return ""
+}
+
+// isObjectSchema checks that v is the JSON Schema of the object, as required of function parameters.
+func isObjectSchema(v interface{}) string {
+	schema, ok := v.(map[string]interface{})
+	if !ok {
+		return "must be a JSON Schema object"
+	}
+	if schema["type"] != "object" {
+		return `type: must be "object"`
+	}
+	return schemaViolation(schema, "")
+}
+
+var schemaTypes = map[string]bool{
+	"string": true, "number": true, "integer": true, "boolean": true,
+	"array": true, "object": true, "null": true,
+}
+
+// schemaViolation checks the types, properties and required fields of the schema and its subschemas.
+func schemaViolation(schema map[string]interface{}, at string) string {
+	field := func(name string) string {
+		if at == "" {
+			return name
+		}
+		return at + "." + name
+	}
+	switch t := schema["type"].(type) {
+	case nil:
+	case string:
+		if !schemaTypes[t] {
+			return field("type") + fmt.Sprintf(": unknown type %q", t)
+		}
+	case []interface{}:
+		for _, v := range t {
+			if s, _ := v.(string); !schemaTypes[s] {
+				return field("type") + fmt.Sprintf(": unknown type %v", v)
+			}
+		}
+	default:
+		return field("type") + ": must be a string or an array of strings"
+	}
+	properties, hasProperties := schema["properties"].(map[string]interface{})
+	if p, ok := schema["properties"]; ok && !hasProperties {
+		return field("properties") + fmt.Sprintf(": must be an object, got %v", p)
+	}
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		property, ok := properties[name].(map[string]interface{})
+		if !ok {
+			return field("properties."+name) + ": must be a JSON Schema object"
+		}
+		if violation := schemaViolation(property, field("properties."+name)); violation != "" {
+			return violation
+		}
+	}
+	if r, ok := schema["required"]; ok {
+		required, ok := r.([]interface{})
+		if !ok {
+			return field("required") + ": must be an array of property names"
+		}
+		for _, v := range required {
+			name, ok := v.(string)
+			if !ok {
+				return field("required") + ": must be an array of property names"
+			}
+			if _, ok := properties[name]; !ok {
+				return field("required") + fmt.Sprintf(": property %q isn't defined", name)
+			}
+		}
+	}
+	if items, ok := schema["items"]; ok {
+		itemsSchema, ok := items.(map[string]interface{})
+		if !ok {
+			return field("items") + ": must be a JSON Schema object"
+		}
+		return schemaViolation(itemsSchema, field("items"))
+	}
+	return ""
+}
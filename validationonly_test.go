@@ -0,0 +1,114 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func requireLocalValidationError(t *testing.T, err error) APIError {
+	t.Helper()
+	var apiErr APIError
+	require.True(t, errors.As(err, &apiErr), "unexpected error: %v", err)
+	assert.Equal(t, http.StatusBadRequest, apiErr.Err.StatusCode)
+	assert.Equal(t, ErrCodeLocalValidation, apiErr.Err.Code)
+	return apiErr
+}
+
+func TestValidationOnlyToolSchema(t *testing.T) {
+	e := New("sk-test", WithValidationOnly(NewValidationOnlyTransport()))
+
+	opts := testChatOptions()
+	opts.Tools = []ChatTool{{
+		Type: "function",
+		Function: FunctionDefinition{
+			Name:       "get_weather",
+			Parameters: json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}},"required":["city"]}`),
+		},
+	}}
+	resp, err := e.ChatCompletion(context.Background(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, "req_validation_only", resp.RequestId)
+
+	for _, tc := range []struct {
+		parameters string
+		message    string
+	}{
+		{`{"type":"array"}`, `tools[0].function.parameters: type: must be "object"`},
+		{`{"type":"object","properties":{"city":{"type":"text"}}}`, `tools[0].function.parameters: properties.city.type: unknown type "text"`},
+		{`{"type":"object","properties":{"city":{"type":"string"}},"required":["country"]}`, `tools[0].function.parameters: required: property "country" isn't defined`},
+		{`{"type":"object","properties":["city"]}`, `tools[0].function.parameters: properties: must be an object, got [city]`},
+	} {
+		opts := testChatOptions()
+		opts.Tools = []ChatTool{{
+			Type:     "function",
+			Function: FunctionDefinition{Name: "get_weather", Parameters: json.RawMessage(tc.parameters)},
+		}}
+		_, err := e.ChatCompletion(context.Background(), opts)
+		apiErr := requireLocalValidationError(t, err)
+		assert.Equal(t, tc.message, apiErr.Err.Message, tc.parameters)
+	}
+
+	opts = testChatOptions()
+	opts.Tools = []ChatTool{{Type: "function", Function: FunctionDefinition{Name: "get weather"}}}
+	_, err = e.ChatCompletion(context.Background(), opts)
+	apiErr := requireLocalValidationError(t, err)
+	assert.Contains(t, apiErr.Err.Message, "tools[0].function.name: must match")
+}
+
+func TestValidationOnlyMetadata(t *testing.T) {
+	e := New("sk-test", WithValidationOnly(NewValidationOnlyTransport()))
+
+	opts := testChatOptions()
+	opts.Store = true
+	opts.Metadata = make(map[string]string)
+	for i := 0; i < maxMetadataPairs+1; i++ {
+		opts.Metadata[fmt.Sprintf("key%d", i)] = "value"
+	}
+	_, err := e.ChatCompletion(context.Background(), opts)
+	apiErr := requireLocalValidationError(t, err)
+	assert.Equal(t, "metadata: must have at most 16 pairs, got 17", apiErr.Err.Message)
+
+	opts.Metadata = map[string]string{"tenant": string(make([]byte, maxMetadataValueLength+1))}
+	_, err = e.ChatCompletion(context.Background(), opts)
+	apiErr = requireLocalValidationError(t, err)
+	assert.Equal(t, `metadata: value of "tenant" must be at most 512 characters`, apiErr.Err.Message)
+}
+
+func TestValidationOnlyResponses(t *testing.T) {
+	transport := NewValidationOnlyTransport()
+	transport.SetResponse("/chat/completions", http.StatusOK,
+		`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"canned"}}]}`)
+	transport.SetResponse("/models", http.StatusUnauthorized,
+		`{"error":{"message":"invalid key","type":"invalid_request_error"}}`)
+	e := New("sk-test", WithValidationOnly(transport))
+
+	resp, err := e.ChatCompletion(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	assert.Equal(t, "canned", resp.Choices[0].Message.Content)
+
+	_, err = e.ListModels(context.Background())
+	var apiErr APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "invalid key", apiErr.Err.Message)
+
+	embeddings, err := e.Embeddings(context.Background(), &EmbeddingsOptions{Model: ModelTextEmbedding3Small, Input: []string{"a"}})
+	require.NoError(t, err)
+	assert.Empty(t, embeddings.Data)
+
+	stream, err := e.ChatCompletionStream(context.Background(), testChatOptions())
+	require.NoError(t, err)
+	defer stream.Close()
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+}
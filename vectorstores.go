@@ -0,0 +1,121 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Statuses of the vector store.
+const (
+	VectorStoreInProgress = "in_progress"
+	VectorStoreCompleted  = "completed"
+	VectorStoreExpired    = "expired"
+)
+
+// ErrVectorStoreExpired is returned by PollUntilReady if the vector store expired.
+var ErrVectorStoreExpired = errors.New("openai: vector store expired")
+
+const (
+	defaultVectorStorePollInterval    = time.Second
+	defaultVectorStorePollMaxInterval = 30 * time.Second
+)
+
+// VectorStore is the store of the chunks of the files searched by the file_search tool.
+//
+// Docs: https://platform.openai.com/docs/api-reference/vector-stores/object
+type VectorStore struct {
+	Id        string `json:"id"`
+	Object    string `json:"object"`
+	CreatedAt int64  `json:"created_at"`
+	Name      string `json:"name"`
+	// The total size of the files of the store, in bytes.
+	UsageBytes int64 `json:"usage_bytes"`
+	// The status of the store, VectorStoreCompleted once all files are processed.
+	Status     string                `json:"status"`
+	FileCounts VectorStoreFileCounts `json:"file_counts"`
+	// The expiration policy of the store, nil if it doesn't expire.
+	ExpiresAfter *VectorStoreExpiresAfter `json:"expires_after,omitempty"`
+	ExpiresAt    int64                    `json:"expires_at,omitempty"`
+	LastActiveAt int64                    `json:"last_active_at,omitempty"`
+	Metadata     map[string]string        `json:"metadata,omitempty"`
+}
+
+type VectorStoreFileCounts struct {
+	InProgress int `json:"in_progress"`
+	Completed  int `json:"completed"`
+	Failed     int `json:"failed"`
+	Cancelled  int `json:"cancelled"`
+	Total      int `json:"total"`
+}
+
+type VectorStoreExpiresAfter struct {
+	// The timestamp the expiration is counted from, only "last_active_at" is supported.
+	Anchor string `json:"anchor"`
+	Days   int    `json:"days"`
+}
+
+// RetrieveVectorStore returns the vector store.
+//
+// Docs: https://platform.openai.com/docs/api-reference/vector-stores/retrieve
+func (e *Engine) RetrieveVectorStore(ctx context.Context, vectorStoreId string) (*VectorStore, error) {
+	uri := e.apiBaseURL + "/vector_stores/" + url.PathEscape(vectorStoreId)
+	ctx = assistantsContext(ctx, "/vector_stores/{vector_store_id}")
+	var vs VectorStore
+	if err := e.sendJSON(ctx, http.MethodGet, uri, nil, &vs); err != nil {
+		return nil, err
+	}
+	return &vs, nil
+}
+
+type PollOptions struct {
+	// Interval is the time before the second retrieval, 1 second if it's zero. It doubles
+	// with every retrieval up to MaxInterval.
+	Interval time.Duration
+	// MaxInterval is the maximum time between retrievals, 30 seconds if it's zero.
+	MaxInterval time.Duration
+	// OnProgress is called with the vector store after every retrieval, including the last one.
+	OnProgress func(vs *VectorStore)
+}
+
+// PollUntilReady polls the vector store until all its files are processed, e.g. after adding
+// the files, and returns it. The time between the retrievals grows exponentially, see PollOptions.
+// It returns the last retrieved store along with ErrVectorStoreExpired if the store expired.
+// Polling stops once ctx is done.
+func PollUntilReady(ctx context.Context, engine *Engine, vectorStoreId string, opts *PollOptions) (*VectorStore, error) {
+	if opts == nil {
+		opts = &PollOptions{}
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = defaultVectorStorePollInterval
+	}
+	maxInterval := opts.MaxInterval
+	if maxInterval <= 0 {
+		maxInterval = defaultVectorStorePollMaxInterval
+	}
+	for {
+		vs, err := engine.RetrieveVectorStore(ctx, vectorStoreId)
+		if err != nil {
+			return nil, err
+		}
+		if opts.OnProgress != nil {
+			opts.OnProgress(vs)
+		}
+		switch vs.Status {
+		case VectorStoreCompleted:
+			return vs, nil
+		case VectorStoreExpired:
+			return vs, ErrVectorStoreExpired
+		}
+		if err := engine.clock.Sleep(ctx, min(interval, maxInterval)); err != nil {
+			return nil, err
+		}
+		interval = min(2*interval, maxInterval)
+	}
+}
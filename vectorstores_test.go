@@ -0,0 +1,82 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newVectorStoreServer serves the vector store of the statuses of the consecutive retrievals,
+// the last one is repeated.
+func newVectorStoreServer(t *testing.T, statuses ...string) *Engine {
+	var n int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/vector_stores/vs_1", r.URL.Path)
+		assert.Equal(t, "assistants=v2", r.Header.Get("OpenAI-Beta"))
+		status := statuses[min(n, len(statuses)-1)]
+		completed := min(n, 3)
+		n++
+		fmt.Fprintf(w, `{"id":"vs_1","object":"vector_store","name":"Handbook","status":%q,"usage_bytes":123456,
+			"file_counts":{"in_progress":%d,"completed":%d,"failed":0,"cancelled":0,"total":3},
+			"expires_after":{"anchor":"last_active_at","days":7}}`, status, 3-completed, completed)
+	}))
+	t.Cleanup(srv.Close)
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	return e
+}
+
+func TestPollUntilReady(t *testing.T) {
+	e := newVectorStoreServer(t, VectorStoreInProgress, VectorStoreInProgress, VectorStoreInProgress, VectorStoreCompleted)
+	clock := newAutoClock()
+	e.clock = clock
+	var progress []int
+	vs, err := PollUntilReady(context.Background(), e, "vs_1", &PollOptions{
+		MaxInterval: 3 * time.Second,
+		OnProgress: func(vs *VectorStore) {
+			progress = append(progress, vs.FileCounts.Completed)
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, VectorStoreCompleted, vs.Status)
+	assert.Equal(t, 7, vs.ExpiresAfter.Days)
+	assert.Equal(t, []int{0, 1, 2, 3}, progress)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, clock.Slept(), "the backoff is capped")
+}
+
+func TestPollUntilReadyExpired(t *testing.T) {
+	e := newVectorStoreServer(t, VectorStoreInProgress, VectorStoreExpired)
+	e.clock = newAutoClock()
+	vs, err := PollUntilReady(context.Background(), e, "vs_1", nil)
+	assert.ErrorIs(t, err, ErrVectorStoreExpired)
+	require.NotNil(t, vs)
+	assert.Equal(t, VectorStoreExpired, vs.Status)
+}
+
+func TestPollUntilReadyContext(t *testing.T) {
+	e := newVectorStoreServer(t, VectorStoreInProgress)
+	clock := NewTestClock(time.Unix(1700000000, 0))
+	e.clock = clock
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := PollUntilReady(ctx, e, "vs_1", &PollOptions{Interval: 10 * time.Second})
+		done <- err
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(10 * time.Second)
+	clock.BlockUntil(1)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Equal(t, []time.Duration{10 * time.Second, 20 * time.Second}, clock.Slept())
+}
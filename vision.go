@@ -0,0 +1,89 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Types of the content parts of chat messages, in addition to ContentPartText.
+const (
+	ContentPartImageURL = "image_url"
+)
+
+// ErrInvalidImageFormat is returned if the image isn't in one of the formats supported by vision models:
+// PNG, JPEG, GIF or WebP.
+var ErrInvalidImageFormat = errors.New("openai: invalid image format")
+
+// ContentPart is a part of the multimodal content of the chat message.
+type ContentPart struct {
+	// Type of the part, either ContentPartText or ContentPartImageURL.
+	Type string `json:"type"`
+	// Text of the part, set for the ContentPartText type.
+	Text string `json:"text,omitempty"`
+	// Image of the part, set for the ContentPartImageURL type.
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// Detail levels of images, they control how many tokens the image costs.
+//
+// Learn more: https://platform.openai.com/docs/guides/vision#low-or-high-fidelity-image-understanding
+const (
+	ImageDetailLow  = "low"
+	ImageDetailHigh = "high"
+	ImageDetailAuto = "auto"
+)
+
+// ImageURL is either the URL of the image or the base64-encoded image data URL.
+type ImageURL struct {
+	URL string `json:"url" binding:"required"`
+	// Detail level of the image, one of ImageDetailLow, ImageDetailHigh or ImageDetailAuto.
+	// The model chooses the level if it's empty.
+	Detail string `json:"detail,omitempty" binding:"omitempty,oneof=low high auto"`
+}
+
+// NewImageURLPart returns the image part of the message content with the detail level,
+// the url is either the URL of the image or the base64-encoded image data URL.
+func NewImageURLPart(url, detail string) ContentPart {
+	return ContentPart{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: url, Detail: detail}}
+}
+
+var supportedImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// NewUserMessageWithImages returns user message with the text followed by the images.
+// Every image is read into memory and sent as the base64-encoded data URL,
+// its MIME type is detected from the content.
+func NewUserMessageWithImages(text string, images ...io.Reader) (ChatMessage, error) {
+	parts := make([]ContentPart, 0, len(images)+1)
+	parts = append(parts, ContentPart{Type: ContentPartText, Text: text})
+	for i, image := range images {
+		b, err := io.ReadAll(image)
+		if err != nil {
+			return ChatMessage{}, fmt.Errorf("read image %d: %w", i, err)
+		}
+		url, err := imageDataURL(b)
+		if err != nil {
+			return ChatMessage{}, fmt.Errorf("image %d: %w", i, err)
+		}
+		parts = append(parts, NewImageURLPart(url, ""))
+	}
+	return ChatMessage{Role: "user", Parts: parts}, nil
+}
+
+func imageDataURL(b []byte) (string, error) {
+	mime := http.DetectContentType(b)
+	if !supportedImageTypes[mime] {
+		return "", fmt.Errorf("%w: %s", ErrInvalidImageFormat, mime)
+	}
+	return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testPNG  = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+	testJPEG = "\xff\xd8\xff\xe0\x00\x10JFIF\x00"
+)
+
+func TestNewUserMessageWithImages(t *testing.T) {
+	m, err := NewUserMessageWithImages("What's the difference?", strings.NewReader(testPNG), strings.NewReader(testJPEG))
+	require.NoError(t, err)
+	assert.Equal(t, ChatMessage{Role: "user", Parts: []ContentPart{
+		{Type: ContentPartText, Text: "What's the difference?"},
+		{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte(testPNG))}},
+		{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString([]byte(testJPEG))}},
+	}}, m)
+
+	b, err := json.Marshal(m)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"role":"user","content":[
+		{"type":"text","text":"What's the difference?"},
+		{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw0KGgoAAAANSUhEUg=="}},
+		{"type":"image_url","image_url":{"url":"data:image/jpeg;base64,/9j/4AAQSkZJRgA="}}
+	]}`, string(b))
+
+	var decoded ChatMessage
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, m, decoded)
+}
+
+func TestNewUserMessageWithImagesInvalid(t *testing.T) {
+	_, err := NewUserMessageWithImages("hi", strings.NewReader(testPNG), strings.NewReader("%PDF-1.7\n"))
+	assert.ErrorIs(t, err, ErrInvalidImageFormat)
+	assert.EqualError(t, err, "image 1: openai: invalid image format: application/pdf")
+
+	errRead := errors.New("disk failure")
+	_, err = NewUserMessageWithImages("hi", iotest.ErrReader(errRead))
+	assert.ErrorIs(t, err, errRead)
+	assert.NotErrorIs(t, err, ErrInvalidImageFormat)
+}
+
+func TestChatMessageJSON(t *testing.T) {
+	b, err := json.Marshal(ChatMessage{Role: "user", Content: "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"content":"hello","role":"user"}`, string(b))
+
+	var m ChatMessage
+	require.NoError(t, json.Unmarshal([]byte(`{"role":"assistant","content":null}`), &m))
+	assert.Equal(t, ChatMessage{Role: "assistant"}, m)
+	require.NoError(t, json.Unmarshal([]byte(`{"role":"assistant","content":"hi"}`), &m))
+	assert.Equal(t, ChatMessage{Role: "assistant", Content: "hi"}, m)
+
+	var ft FineTuningMessage
+	require.NoError(t, json.Unmarshal([]byte(`{"role":"assistant","content":"hi","weight":0}`), &ft))
+	assert.Equal(t, FineTuningMessage{ChatMessage: ChatMessage{Role: "assistant", Content: "hi"}, Weight: intPtr(0)}, ft)
+}
+
+func TestImageDetail(t *testing.T) {
+	b, err := json.Marshal(NewImageURLPart("https://example.com/cat.png", ImageDetailLow))
+	require.NoError(t, err)
+	assert.Equal(t, `{"type":"image_url","image_url":{"url":"https://example.com/cat.png","detail":"low"}}`, string(b))
+
+	var called bool
+	srv := newChatTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"a cat"}}]}`))
+	})
+	e := New("test")
+	e.apiBaseURL = srv.URL
+	newOptions := func(detail string) *ChatCompletionOptions {
+		return &ChatCompletionOptions{
+			Model: ModelGPT4,
+			Messages: []ChatMessage{{Role: "user", Parts: []ContentPart{
+				{Type: ContentPartText, Text: "What's this?"},
+				NewImageURLPart("https://example.com/cat.png", detail),
+			}}},
+		}
+	}
+
+	_, err = e.ChatCompletion(context.Background(), newOptions("ultra"))
+	assert.ErrorContains(t, err, "Detail")
+	assert.False(t, called, "invalid detail must be rejected before sending")
+
+	for _, detail := range []string{"", ImageDetailLow, ImageDetailHigh, ImageDetailAuto} {
+		_, err = e.ChatCompletion(context.Background(), newOptions(detail))
+		assert.NoError(t, err, detail)
+	}
+	assert.True(t, called)
+}
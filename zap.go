@@ -0,0 +1,28 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import "go.uber.org/zap/zapcore"
+
+// MarshalLogObject implements zapcore.ObjectMarshaler, so the response can be logged
+// as structured fields with zap.Object. The content of messages isn't logged.
+func (r *ChatCompletionResponse) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("id", r.Id)
+	enc.AddString("model", string(r.Model))
+	enc.AddInt("prompt_tokens", r.Usage.PromptTokens)
+	enc.AddInt("completion_tokens", r.Usage.CompletionTokens)
+	if r.SystemFingerprint != "" {
+		enc.AddString("system_fingerprint", r.SystemFingerprint)
+	}
+	return nil
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler, so the options can be logged
+// as structured fields with zap.Object. The content of messages isn't logged.
+func (o *ChatCompletionOptions) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("model", string(o.Model))
+	enc.AddFloat32("temperature", o.Temperature)
+	enc.AddInt("messages", len(o.Messages))
+	return nil
+}
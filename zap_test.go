@@ -0,0 +1,48 @@
+// Copyright (c) 2022 0x9ef. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+package openai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestChatCompletionMarshalLogObject(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := zap.New(core)
+
+	opts := &ChatCompletionOptions{
+		Model:       ModelGPT4,
+		Temperature: 0.5,
+		Messages:    []ChatMessage{{Role: "system", Content: "secret"}, {Role: "user", Content: "hello"}},
+	}
+	resp := &ChatCompletionResponse{
+		Id:                "chatcmpl-1",
+		Model:             "gpt-4-0613",
+		SystemFingerprint: "fp_44709d6fcb",
+		Usage:             Usage{PromptTokens: 12, CompletionTokens: 7, TotalTokens: 19},
+	}
+	logger.Info("completion", zap.Object("options", opts), zap.Object("response", resp))
+
+	entries := logs.All()
+	assert.Len(t, entries, 1)
+	assert.Equal(t, map[string]interface{}{
+		"options": map[string]interface{}{
+			"model":       "gpt-4",
+			"temperature": float32(0.5),
+			"messages":    2,
+		},
+		"response": map[string]interface{}{
+			"id":                 "chatcmpl-1",
+			"model":              "gpt-4-0613",
+			"prompt_tokens":      12,
+			"completion_tokens":  7,
+			"system_fingerprint": "fp_44709d6fcb",
+		},
+	}, entries[0].ContextMap())
+}